@@ -0,0 +1,53 @@
+package main
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// Workers poll abort:{id} while processing a job; when it's set they stop
+// and report status "aborted". The signal expires if no worker picks it up.
+const abortSignalTTL = 60 * time.Second
+
+func abortKey(jobID string) string {
+    return "abort:" + jobID
+}
+
+// POST /jobs/:id/abort asks the worker slicing a job to stop. Queued and
+// scheduled jobs are withdrawn with DELETE /jobs/:id instead.
+func handleAbortJob(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    status, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if !authorizeJob(c, jobID) {
+        return
+    }
+    if parseJobStatus(status).IsTerminal() {
+        c.JSON(http.StatusConflict, gin.H{"error": "Job has already finished", "status": status})
+        return
+    }
+    if status != "processing" {
+        c.JSON(http.StatusConflict, gin.H{"error": "Only processing jobs can be aborted; cancel it with DELETE /jobs/" + jobID, "status": status})
+        return
+    }
+
+    if err := rdb.Set(ctx, abortKey(jobID), "1", abortSignalTTL).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    recordHistory(ctx, jobID, "abort_requested", "")
+    event := auditEventFor(c, auditAbortRequested, jobID, requestOwner(c))
+    event.Before = status
+    audit.Record(ctx, event)
+
+    c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "status": status, "message": "Abort signalled to the worker"})
+}
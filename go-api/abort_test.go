@@ -0,0 +1,68 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+)
+
+func TestAbortJob(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    if w := do(r, http.MethodPost, "/jobs/j1/abort", ""); w.Code != http.StatusAccepted {
+        t.Fatalf("abort: status = %d, want 202 (body %s)", w.Code, w.Body)
+    }
+    if v, _ := rdb.Get(ctx, abortKey("j1")).Result(); v != "1" {
+        t.Fatalf("abort signal = %q, want 1", v)
+    }
+    if ttl := rdb.TTL(ctx, abortKey("j1")).Val(); ttl <= 0 || ttl > abortSignalTTL {
+        t.Errorf("abort signal TTL = %v, want at most %v", ttl, abortSignalTTL)
+    }
+
+    if code := reportStatus(t, r, "j1", `{"status":"aborted"}`); code != http.StatusOK {
+        t.Fatalf("worker report: status = %d, want 200", code)
+    }
+    if n := rdb.Exists(ctx, abortKey("j1")).Val(); n != 0 {
+        t.Error("abort signal left behind after the worker reported aborted")
+    }
+
+    var got struct {
+        Status    string `json:"status"`
+        AbortedAt string `json:"aborted_at"`
+    }
+    w := do(r, http.MethodGet, "/status/j1", "")
+    json.Unmarshal(w.Body.Bytes(), &got)
+    if got.Status != "aborted" || got.AbortedAt == "" {
+        t.Fatalf("status body %s; want aborted with aborted_at", w.Body)
+    }
+
+    if w := do(r, http.MethodPost, "/jobs/j1/abort", ""); w.Code != http.StatusConflict {
+        t.Errorf("aborting an aborted job: status = %d, want 409", w.Code)
+    }
+}
+
+func TestAbortJobRejects(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:done", "completed", 0)
+    rdb.Set(ctx, "status:waiting", "queued", 0)
+
+    tests := []struct {
+        path string
+        want int
+    }{
+        {"/jobs/missing/abort", http.StatusNotFound},
+        {"/jobs/done/abort", http.StatusConflict},
+        {"/jobs/waiting/abort", http.StatusConflict},
+    }
+    for _, tt := range tests {
+        if w := do(r, http.MethodPost, tt.path, ""); w.Code != tt.want {
+            t.Errorf("POST %s: status = %d, want %d", tt.path, w.Code, tt.want)
+        }
+    }
+    if n := rdb.Exists(ctx, abortKey("done"), abortKey("waiting")).Val(); n != 0 {
+        t.Error("rejected aborts still set a signal")
+    }
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "crypto/subtle"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// requireAdmin guards /admin routes with the configured ADMIN_TOKEN, sent as
+// "Authorization: Bearer <token>". Admin routes are disabled when it's unset.
+func requireAdmin(c *gin.Context) {
+    token := cfg().AdminToken
+    if token == "" {
+        c.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResponse{Error: "Admin API disabled"})
+        return
+    }
+    if accountLockedOut(c, authAccountAdmin) {
+        return
+    }
+    given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+    if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+        recordAuthFailure(c, authAccountAdmin)
+        c.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResponse{Error: "Invalid admin token"})
+        return
+    }
+    clearAuthFailures(c, authAccountAdmin)
+    c.Next()
+}
+
+// handleStuckJobs lists stream entries a worker has claimed but not XACKed
+// for longer than ?min_idle= seconds (default 600).
+func handleStuckJobs(c *gin.Context) {
+    ctx := c.Request.Context()
+    minIdle, err := strconv.Atoi(c.DefaultQuery("min_idle", "600"))
+    if err != nil || minIdle < 0 {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "min_idle must be a number of seconds"})
+        return
+    }
+
+    stuck := []gin.H{}
+    for _, q := range jobQueues() {
+        pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+            Stream: streamFor(q),
+            Group:  consumerGroup,
+            Idle:   time.Duration(minIdle) * time.Second,
+            Start:  "-",
+            End:    "+",
+            Count:  100,
+        }).Result()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+        for _, p := range pending {
+            stuck = append(stuck, gin.H{
+                "stream":       streamFor(q),
+                "entry_id":     p.ID,
+                "consumer":     p.Consumer,
+                "idle_seconds": int(p.Idle.Seconds()),
+                "deliveries":   p.RetryCount,
+            })
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{"stuck_jobs": stuck})
+}
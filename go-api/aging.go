@@ -0,0 +1,166 @@
+package main
+
+import (
+    "log"
+    "strings"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var promotedJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+    Name: "jobs_promoted_total",
+    Help: "Standard jobs moved to the rush list after waiting past AGING_THRESHOLD_SECONDS.",
+}, []string{"queue"})
+
+const agingScanBatch = 100
+
+// promoteStreamEntry moves an undelivered entry from one stream to another.
+var promoteStreamEntry = redis.NewScript(claimUndeliveredLua + `
+if redis.call('XDEL', KEYS[1], ARGV[1]) == 0 then
+    return 0
+end
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[4], '*', 'payload', ARGV[3])
+redis.call('SET', KEYS[3], ARGV[3], 'EX', ARGV[5])
+return 1
+`)
+
+// promoteAgedJobs moves standard jobs that have waited longer than
+// AGING_THRESHOLD_SECONDS onto the tail of their rush queue, so a steady
+// stream of rush orders can't starve them. It looks at undelivered stream
+// entries, the legacy lists while they are published to, and the fair lists
+// jobs wait in before dispatch. All are oldest first, so each scan stops at
+// the first job that's still young.
+func promoteAgedJobs() {
+    if cfg().AgingThresholdSeconds == 0 || singleQueue() {
+        return
+    }
+    cutoff := time.Now().Add(-cfg().AgingThreshold()).Unix()
+
+    for _, q := range jobQueues() {
+        if strings.HasSuffix(q, ":rush") {
+            continue
+        }
+        // A job is on both the stream and the list while dual publishing;
+        // promote it once
+        seen := map[string]bool{}
+        if group, err := streamGroup(ctx, q); err == nil && group != nil {
+            entries, _ := undelivered(ctx, q, group, agingScanBatch)
+            for _, e := range entries {
+                entry, _ := e.Values["payload"].(string)
+                job, ok := agedJob(entry, cutoff)
+                if !ok {
+                    break
+                }
+                seen[entry] = true
+                promoteJob(q, entry, e.ID, job)
+            }
+        }
+        if legacyListQueue() {
+            entries, _ := rdb.LRange(ctx, q, 0, agingScanBatch-1).Result()
+            for _, entry := range entries {
+                job, ok := agedJob(entry, cutoff)
+                if !ok {
+                    break
+                }
+                if !seen[entry] {
+                    promoteJob(q, entry, "", job)
+                }
+            }
+        }
+        promoteAgedFair(q, cutoff)
+    }
+}
+
+// promoteAgedFair hands jobs that aged out in a submitter's fair list
+// straight to the rush queue, since they already waited past their turn.
+// LREM is the claim against the dispatcher.
+func promoteAgedFair(queue string, cutoff int64) {
+    submitters, _ := rdb.ZRange(ctx, fairIndexKey(queue), 0, -1).Result()
+    for _, s := range submitters {
+        entries, _ := rdb.LRange(ctx, fairListKey(queue, s), 0, agingScanBatch-1).Result()
+        for _, entry := range entries {
+            job, ok := agedJob(entry, cutoff)
+            if !ok {
+                break
+            }
+            if removed, _ := rdb.LRem(ctx, fairListKey(queue, s), 1, entry).Result(); removed == 0 {
+                continue
+            }
+            jobID, _ := job["id"].(string)
+            to := markPromoted(queue, job)
+            if err := enqueue(ctx, to, jobID, marshalPayload(job)); err != nil {
+                rdb.LPush(ctx, fairListKey(queue, s), entry)
+                continue
+            }
+            notePromotion(queue, to, jobID)
+        }
+    }
+}
+
+// agedJob decodes entry and reports whether it was submitted before cutoff.
+// Undecodable payloads and ones without submitted_at count as young.
+func agedJob(entry string, cutoff int64) (map[string]interface{}, bool) {
+    job, err := readPayload([]byte(entry))
+    if err != nil {
+        return nil, false
+    }
+    submittedAt, _ := job["submitted_at"].(float64)
+    if submittedAt == 0 || int64(submittedAt) > cutoff {
+        return nil, false
+    }
+    return job, true
+}
+
+// promoteJob moves one queued job: its stream entry (when streamID is set)
+// via promoteStreamEntry, and its legacy list copy with LREM as the claim
+// against workers and other replicas.
+func promoteJob(from, entry, streamID string, job map[string]interface{}) {
+    jobID, _ := job["id"].(string)
+    to := markPromoted(from, job)
+    jsonData := marshalPayload(job)
+
+    moved := false
+    if streamID != "" {
+        n, err := promoteStreamEntry.Run(ctx, rdb,
+            []string{streamFor(from), streamFor(to), "params:" + jobID},
+            streamID, consumerGroup, jsonData, streamMaxLen, int((24 * time.Hour).Seconds()),
+        ).Int()
+        if err != nil {
+            log.Printf("aging: failed to move stream entry %s: %v", streamID, err)
+        }
+        moved = n == 1
+    }
+    if legacyListQueue() {
+        if removed, _ := rdb.LRem(ctx, from, 1, entry).Result(); removed == 1 {
+            pipe := rdb.TxPipeline()
+            pipe.RPush(ctx, to, jsonData)
+            pipe.Set(ctx, "params:"+jobID, jsonData, 24*time.Hour)
+            if _, err := pipe.Exec(ctx); err != nil {
+                rdb.LPush(ctx, from, entry)
+            } else {
+                moved = true
+            }
+        }
+    }
+    if moved {
+        notePromotion(from, to, jobID)
+    }
+}
+
+// markPromoted points job at the rush queue for from. The rush flag is left
+// alone since it also drives pricing.
+func markPromoted(from string, job map[string]interface{}) string {
+    to := rushQueueFor(from)
+    job["promoted"] = true
+    job["queue"] = to
+    return to
+}
+
+func notePromotion(from, to, jobID string) {
+    promotedJobs.WithLabelValues(from).Inc()
+    recordHistory(ctx, jobID, "promoted", "waited over "+cfg().AgingThreshold().String()+", moved to "+to)
+    log.Printf("aging: promoted %s from %s to %s", jobID, from, to)
+}
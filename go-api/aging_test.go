@@ -0,0 +1,70 @@
+package main
+
+import (
+    "encoding/json"
+    "strings"
+    "testing"
+    "time"
+)
+
+func agingTestConfig(legacy bool) func(*Config) {
+    return func(c *Config) {
+        c.LegacyListQueue = legacy
+        c.FairScheduling = true
+        c.AgingThresholdSeconds = 60
+    }
+}
+
+func TestPromoteAgedJobsFromStream(t *testing.T) {
+    setupTest(t, agingTestConfig(false))
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    old := time.Now().Unix() - 600
+    for _, id := range []string{"taken", "waiting"} {
+        data, _ := json.Marshal(map[string]interface{}{"id": id, "submitted_at": old, "rush": false})
+        enqueue(ctx, standardQueue, id, data)
+    }
+    // A worker already has the first one; it must stay where it is
+    readFromStream(t, 1)
+
+    promoteAgedJobs()
+
+    if n, _ := streamBacklog(ctx, standardQueue); n != 0 {
+        t.Errorf("standard stream backlog = %d, want 0", n)
+    }
+    entries, _ := rdb.XRange(ctx, streamFor(rushQueueFor(standardQueue)), "-", "+").Result()
+    if len(entries) != 1 || !strings.Contains(entries[0].Values["payload"].(string), `"waiting"`) {
+        t.Fatalf("rush stream = %v, want only the waiting job", entries)
+    }
+    var job map[string]interface{}
+    json.Unmarshal([]byte(rdb.Get(ctx, "params:waiting").Val()), &job)
+    if job["promoted"] != true || job["queue"] != rushQueueFor(standardQueue) || job["rush"] != false {
+        t.Errorf("params:waiting = %v, want promoted onto the rush queue with rush unchanged", job)
+    }
+}
+
+func TestPromoteAgedJobsFromFairLists(t *testing.T) {
+    setupTest(t, agingTestConfig(true))
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    now := time.Now().Unix()
+    for i, id := range []string{"old", "new"} {
+        data, _ := json.Marshal(map[string]interface{}{"id": id, "submitted_at": now - int64(600*(1-i))})
+        submitJob(ctx, standardQueue, id, "alice", data)
+    }
+
+    promoteAgedJobs()
+
+    if n, _ := rdb.LLen(ctx, fairListKey(standardQueue, "alice")).Result(); n != 1 {
+        t.Errorf("fair list holds %d, want 1", n)
+    }
+    rush := rushQueueFor(standardQueue)
+    if n, _ := rdb.LLen(ctx, rush).Result(); n != 1 {
+        t.Errorf("%s holds %d, want 1", rush, n)
+    }
+    if n, _ := streamBacklog(ctx, rush); n != 1 {
+        t.Errorf("%s stream backlog = %d, want 1", rush, n)
+    }
+}
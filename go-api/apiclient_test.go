@@ -0,0 +1,59 @@
+package main
+
+import (
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "slicer-api/internal/api"
+    "slicer-api/internal/client"
+)
+
+// The client against the real router, so the two can't drift apart.
+func TestClientAgainstRouter(t *testing.T) {
+    dir := localStorage(t, func(c *Config) { c.APIKeys = map[string]string{"k1": "billing"} })
+    srv := httptest.NewServer(newRouter())
+    defer srv.Close()
+    c := client.NewClient(srv.URL, "k1")
+
+    job, err := c.SubmitJob(ctx, api.QuotationRequest{DownloadURL: "https://example.com/part.stl", Material: "PLA", Infill: 20})
+    if err != nil {
+        t.Fatal(err)
+    }
+    st, err := c.GetStatus(ctx, job.JobID)
+    if err != nil || st.Status != "queued" {
+        t.Fatalf("GetStatus = %+v, %v", st, err)
+    }
+
+    updates, err := c.WatchStatus(ctx, job.JobID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if first := <-updates; first.Status != "queued" {
+        t.Fatalf("first update = %+v", first)
+    }
+    if err := c.CancelJob(ctx, job.JobID); err != nil {
+        t.Fatal(err)
+    }
+    var statuses []string
+    for st := range updates {
+        statuses = append(statuses, st.Status)
+    }
+    if got := strings.Join(statuses, ","); got != "cancelled" {
+        t.Errorf("statuses after cancel = %s, want the stream to end on cancelled", got)
+    }
+
+    up, err := c.UploadFile(ctx, "cube.stl", strings.NewReader("solid cube"), 10, client.UploadOptions{Material: "PETG", Infill: 20, BedAdhesion: "raft"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if stored, err := os.ReadFile(filepath.Join(dir, up.JobID+".stl")); err != nil || string(stored) != "solid cube" {
+        t.Errorf("stored upload = %q, %v", stored, err)
+    }
+    raw, _ := rdb.Get(ctx, "params:"+up.JobID).Bytes()
+    if payload, _ := readPayload(raw); payload["material"] != "PETG" || payload["bed_adhesion"] != "raft" {
+        t.Errorf("upload payload = %v, want the options", payload)
+    }
+}
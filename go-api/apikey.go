@@ -0,0 +1,55 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// apiKeyOwners maps sha256(key) to the key's name from API_KEYS, so lookups
+// don't compare the secret itself.
+var apiKeyOwners = configDerived[map[string]string]{build: func(c *Config) map[string]string {
+    owners := map[string]string{}
+    for k, name := range c.APIKeys {
+        owners[hashAPIKey(k)] = name
+    }
+    return owners
+}}
+
+func hashAPIKey(key string) string {
+    sum := sha256.Sum256([]byte(key))
+    return hex.EncodeToString(sum[:])
+}
+
+func apiKeyOwner(key string) (string, bool) {
+    name, ok := apiKeyOwners.get()[hashAPIKey(key)]
+    return name, ok
+}
+
+// apiKeyAuth identifies API clients sending "Authorization: Bearer <key>".
+// Requests without the header stay anonymous; a wrong key is a 401 and
+// counts towards the IP's lockout.
+func apiKeyAuth(c *gin.Context) {
+    header := c.GetHeader("Authorization")
+    if !strings.HasPrefix(header, "Bearer ") {
+        c.Next()
+        return
+    }
+    if accountLockedOut(c, authAccountAPIKey) {
+        return
+    }
+    name, ok := apiKeyOwner(strings.TrimPrefix(header, "Bearer "))
+    if !ok {
+        recordAuthFailure(c, authAccountAPIKey)
+        c.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResponse{Error: "Invalid API key"})
+        return
+    }
+    clearAuthFailures(c, authAccountAPIKey)
+    c.Set(ownerIDKey, "apikey:"+name)
+    c.Next()
+}
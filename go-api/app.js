@@ -0,0 +1,109 @@
+const form = document.getElementById('uploadForm');
+const submitBtn = document.getElementById('submitBtn');
+const statusBox = document.getElementById('status-box');
+const statusText = document.getElementById('status-text');
+const resultData = document.getElementById('result-data');
+
+// Helper to update UI on error
+const showError = (msg) => {
+    submitBtn.disabled = false;
+    submitBtn.innerText = "Get Quote";
+    statusText.innerHTML = `<span style="color:red">❌ Error: ${msg}</span>`;
+    console.error(msg);
+};
+
+form.onsubmit = async (e) => {
+    e.preventDefault();
+    submitBtn.disabled = true;
+    submitBtn.innerText = "Uploading...";
+    statusBox.style.display = 'block';
+    statusText.innerHTML = '⏳ <b>Step 1/2:</b> Uploading file...';
+    resultData.style.display = 'none';
+    
+    const formData = new FormData();
+    formData.append('file', document.getElementById('fileInput').files[0]);
+    formData.append('material', document.getElementById('material').value);
+    formData.append('infill', document.getElementById('infill').value);
+
+    try {
+        // 1. Upload
+        const res = await fetch('/v1/upload', {
+            method: 'POST',
+            body: formData,
+            headers: { 'X-CSRF-Token': document.querySelector('meta[name="csrf-token"]').content }
+        });
+        const data = await res.json();
+        
+        if (!res.ok) throw new Error(data.error || 'Upload failed');
+        
+        statusText.innerHTML = `⚙️ <b>Step 2/2:</b> Slicing model (Job: ${data.job_id.slice(0,8)})...`;
+
+        // 2. Follow the status stream
+        const stream = new EventSource(`/v1/status/${data.job_id}/stream`);
+        stream.addEventListener('status', (ev) => {
+            const result = JSON.parse(ev.data);
+
+            if (result.status === 'processing' && result.current_step) {
+                statusText.innerHTML = `⚙️ <b>Step 2/2:</b> ${result.current_step.replace('_', ' ')} (${result.progress_percent}%)...`;
+            } else if (result.status === 'completed') {
+                stream.close();
+                submitBtn.disabled = false;
+                submitBtn.innerText = "Get Another Quote";
+                statusText.innerHTML = `✅ <b>Success!</b> Quotation ready.`;
+                
+                const summary = result.data.summary;
+                
+                // Render Stats
+                resultData.style.display = 'grid';
+                resultData.innerHTML = `
+                    <div class="stat-item">
+                        <span class="stat-label">Est. Cost</span>
+                        <div class="stat-val">$${summary.total_cost.toFixed(2)}</div>
+                    </div>
+                    <div class="stat-item">
+                        <span class="stat-label">Print Time</span>
+                        <div class="stat-val">${summary.print_time}</div>
+                    </div>
+                    <div class="stat-item">
+                        <span class="stat-label">Material</span>
+                        <div class="stat-val">${summary.material}</div>
+                    </div>
+                    <div class="stat-item">
+                        <span class="stat-label">Complexity</span>
+                        <div class="stat-val" style="text-transform: capitalize;">${summary.complexity}</div>
+                    </div>
+                `;
+                if (result.has_thumbnail) {
+                    resultData.innerHTML += `<img src="/v1/jobs/${data.job_id}/thumbnail" alt="Preview of the model" style="grid-column: 1 / -1; max-width: 100%;">`;
+                }
+            } else if (result.status === 'failed') {
+                stream.close();
+                const failure = result.data || {};
+                showError(failure.error_description || "Worker processing failed");
+                // Customers can fix these themselves, e.g. with another file
+                if (failure.user_actionable) {
+                    submitBtn.innerText = "Try a Different File";
+                }
+            }
+        });
+        stream.addEventListener('end', (ev) => {
+            stream.close();
+            if (ev.data !== 'completed' && ev.data !== 'failed') {
+                showError(`Job ${ev.data}`);
+            }
+        });
+        // EventSource reconnects by itself; give up only once it stops trying
+        stream.onerror = () => {
+            if (stream.readyState === EventSource.CLOSED) {
+                showError("Network error following status");
+            }
+        };
+
+    } catch (err) {
+        showError(err.message);
+    }
+};
+
+document.getElementById('infill').addEventListener('input', (e) => {
+    document.getElementById('infillVal').innerText = e.target.value + '%';
+});
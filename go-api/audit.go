@@ -0,0 +1,156 @@
+package main
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+const auditStream = "audit:events"
+
+// Audit event types.
+const (
+    auditJobSubmitted   = "job_submitted"
+    auditJobCancelled   = "job_cancelled"
+    auditStatusChanged  = "status_changed"
+    auditAbortRequested = "abort_requested"
+    auditQuoteAccepted  = "quote_accepted"
+    auditJobReordered   = "job_reordered"
+)
+
+// AuditEvent is one entry in the compliance trail.
+type AuditEvent struct {
+    EventType string `json:"event_type"`
+    JobID     string `json:"job_id"`
+    OwnerID   string `json:"owner_id,omitempty"`
+    Timestamp string `json:"timestamp"`
+    RemoteIP  string `json:"remote_ip,omitempty"`
+    UserAgent string `json:"user_agent,omitempty"`
+    Before    string `json:"before,omitempty"`
+    After     string `json:"after,omitempty"`
+}
+
+// AuditLog appends events to the audit:events stream, trimmed to about
+// AUDIT_STREAM_MAXLEN entries.
+type AuditLog struct {
+    rdb    *redis.Client
+    maxLen int64
+}
+
+// audit is set up in main; a nil AuditLog drops events.
+var audit *AuditLog
+
+func newAuditLog(client *redis.Client, maxLen int) *AuditLog {
+    return &AuditLog{rdb: client, maxLen: int64(maxLen)}
+}
+
+// auditEventFor fills in who made the request and when.
+func auditEventFor(c *gin.Context, eventType, jobID, ownerID string) AuditEvent {
+    return AuditEvent{
+        EventType: eventType,
+        JobID:     jobID,
+        OwnerID:   ownerID,
+        Timestamp: time.Now().UTC().Format(time.RFC3339),
+        RemoteIP:  c.ClientIP(),
+        UserAgent: c.Request.UserAgent(),
+    }
+}
+
+// Record appends e. Failures are logged rather than returned so a Redis
+// hiccup on the audit stream doesn't fail the request it describes.
+func (a *AuditLog) Record(ctx context.Context, e AuditEvent) {
+    if a == nil {
+        return
+    }
+    err := a.rdb.XAdd(ctx, &redis.XAddArgs{
+        Stream: auditStream,
+        MaxLen: a.maxLen,
+        Approx: true,
+        Values: map[string]interface{}{
+            "event_type": e.EventType,
+            "job_id":     e.JobID,
+            "owner_id":   e.OwnerID,
+            "timestamp":  e.Timestamp,
+            "remote_ip":  e.RemoteIP,
+            "user_agent": e.UserAgent,
+            "before":     e.Before,
+            "after":      e.After,
+        },
+    }).Err()
+    if err != nil {
+        log.Printf("audit: failed to record %s for %s: %v", e.EventType, e.JobID, err)
+    }
+}
+
+// jobOwner reads owner_id from the job's stored payload.
+func jobOwner(ctx context.Context, jobID string) string {
+    payload, err := rdb.Get(ctx, "params:"+jobID).Bytes()
+    if err != nil {
+        return ""
+    }
+    var job struct {
+        OwnerID string `json:"owner_id"`
+    }
+    unmarshalPayload(payload, &job)
+    return job.OwnerID
+}
+
+const auditMaxLimit = 1000
+
+// auditStreamBound turns an RFC3339 query param into a stream ID bound.
+// Stream IDs start with the entry's unix time in milliseconds.
+func auditStreamBound(value, open string) (string, error) {
+    if value == "" {
+        return open, nil
+    }
+    t, err := time.Parse(time.RFC3339, value)
+    if err != nil {
+        return "", err
+    }
+    return strconv.FormatInt(t.UnixMilli(), 10), nil
+}
+
+// GET /admin/audit?from=&to=&limit= lists audit events oldest first. from and
+// to are RFC3339; limit defaults to 100 and is capped at 1000.
+func handleListAudit(c *gin.Context) {
+    start, err := auditStreamBound(c.Query("from"), "-")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "from must be an RFC3339 time"})
+        return
+    }
+    end, err := auditStreamBound(c.Query("to"), "+")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "to must be an RFC3339 time"})
+        return
+    }
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+    if err != nil || limit <= 0 {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "limit must be a positive number"})
+        return
+    }
+    limit = min(limit, auditMaxLimit)
+
+    msgs, err := rdb.XRangeN(c.Request.Context(), auditStream, start, end, int64(limit)).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    events := make([]gin.H, 0, len(msgs))
+    for _, m := range msgs {
+        entry := gin.H{"id": m.ID}
+        for k, v := range m.Values {
+            if s, _ := v.(string); s != "" {
+                entry[k] = s
+            }
+        }
+        events = append(events, entry)
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(events), "events": events})
+}
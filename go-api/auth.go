@@ -0,0 +1,164 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "golang.org/x/oauth2"
+    "golang.org/x/oauth2/github"
+    "golang.org/x/oauth2/google"
+
+    "slicer-api/internal/api"
+)
+
+const (
+    sessionCookie = "session"
+    sessionTTL    = 7 * 24 * time.Hour
+    oauthStateTTL = 10 * time.Minute
+)
+
+// oauthProvider describes where to send users and how to read their ID back.
+type oauthProvider struct {
+    endpoint   oauth2.Endpoint
+    scopes     []string
+    profileURL string
+    // userID extracts the provider's stable user ID from the profile JSON
+    userID func(profile map[string]interface{}) string
+}
+
+var oauthProviders = map[string]oauthProvider{
+    "github": {
+        endpoint:   github.Endpoint,
+        scopes:     []string{"read:user"},
+        profileURL: "https://api.github.com/user",
+        userID: func(p map[string]interface{}) string {
+            if id, ok := p["id"].(float64); ok {
+                return fmt.Sprintf("%.0f", id)
+            }
+            return ""
+        },
+    },
+    "google": {
+        endpoint:   google.Endpoint,
+        scopes:     []string{"openid", "profile"},
+        profileURL: "https://www.googleapis.com/oauth2/v2/userinfo",
+        userID: func(p map[string]interface{}) string {
+            id, _ := p["id"].(string)
+            return id
+        },
+    },
+}
+
+func randomToken() string {
+    b := make([]byte, 32)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// oauthConfig builds the client config for the configured provider. The
+// redirect URL defaults to /auth/callback on whatever host the user hit.
+func oauthConfig(c *gin.Context) (*oauth2.Config, oauthProvider, bool) {
+    provider, ok := oauthProviders[cfg().OAuth2Provider]
+    if !ok || cfg().OAuth2ClientID == "" {
+        return nil, provider, false
+    }
+    redirectURL := cfg().OAuth2RedirectURL
+    if redirectURL == "" {
+        scheme := "http"
+        if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+            scheme = "https"
+        }
+        redirectURL = scheme + "://" + c.Request.Host + "/auth/callback"
+    }
+    return &oauth2.Config{
+        ClientID:     cfg().OAuth2ClientID,
+        ClientSecret: cfg().OAuth2ClientSecret,
+        Endpoint:     provider.endpoint,
+        Scopes:       provider.scopes,
+        RedirectURL:  redirectURL,
+    }, provider, true
+}
+
+// GET /auth/login redirects to the provider's consent page.
+func handleAuthLogin(c *gin.Context) {
+    conf, _, ok := oauthConfig(c)
+    if !ok {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "OAuth2 login is not configured"})
+        return
+    }
+
+    state := randomToken()
+    if err := rdb.Set(c.Request.Context(), "oauth_state:"+state, "1", oauthStateTTL).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.Redirect(http.StatusFound, conf.AuthCodeURL(state))
+}
+
+// GET /auth/callback exchanges the code, looks up the user and starts a session.
+func handleAuthCallback(c *gin.Context) {
+    ctx := c.Request.Context()
+
+    conf, provider, ok := oauthConfig(c)
+    if !ok {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "OAuth2 login is not configured"})
+        return
+    }
+
+    // State is single use: GETDEL so a replayed callback fails
+    if n, err := rdb.GetDel(ctx, "oauth_state:"+c.Query("state")).Result(); err != nil || n != "1" {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Invalid or expired login state"})
+        return
+    }
+
+    token, err := conf.Exchange(ctx, c.Query("code"))
+    if err != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Failed to exchange authorization code"})
+        return
+    }
+
+    resp, err := conf.Client(ctx, token).Get(provider.profileURL)
+    if err != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Failed to fetch user profile"})
+        return
+    }
+    defer resp.Body.Close()
+    var profile map[string]interface{}
+    if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&profile) != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Invalid user profile response"})
+        return
+    }
+    userID := provider.userID(profile)
+    if userID == "" {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "User profile has no ID"})
+        return
+    }
+
+    sessionToken, err := sessionStoreFrom(c).CreateSession(ctx, cfg().OAuth2Provider+":"+userID, sessionTTL)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+
+    secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+    c.SetSameSite(http.SameSiteLaxMode)
+    c.SetCookie(sessionCookie, sessionToken, int(sessionTTL.Seconds()), "/", "", secure, true)
+    c.Redirect(http.StatusFound, "/")
+}
+
+// POST /auth/logout ends the session and clears the cookie.
+func handleAuthLogout(c *gin.Context) {
+    if token, err := c.Cookie(sessionCookie); err == nil && token != "" {
+        if err := sessionStoreFrom(c).DeleteSession(c.Request.Context(), token); err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+    }
+    c.SetCookie(sessionCookie, "", -1, "/", "", false, true)
+    c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
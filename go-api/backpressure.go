@@ -0,0 +1,79 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+
+    "slicer-api/internal/api"
+)
+
+var rejectedSubmissions = promauto.NewCounter(prometheus.CounterOpts{
+    Name: "job_submissions_rejected_total",
+    Help: "Submissions turned away because the queue was over QUEUE_REJECT_DEPTH.",
+})
+
+// pendingDepth is the number of jobs waiting for a worker, across every
+// queue's backlog and the per-submitter fair lists.
+func pendingDepth(ctx context.Context) (int64, error) {
+    var total int64
+    for _, q := range jobQueues() {
+        n, err := queueBacklog(ctx, q)
+        if err != nil {
+            return 0, err
+        }
+        total += n
+    }
+    if cfg().FairScheduling {
+        for _, submitters := range submitterDepths(ctx) {
+            for _, n := range submitters {
+                total += n
+            }
+        }
+    }
+    return total, nil
+}
+
+// estimatedWait is a rough drain time for depth jobs at the configured
+// average slice time.
+func estimatedWait(depth int64) time.Duration {
+    return time.Duration(depth) * cfg().EstimatedSliceTime()
+}
+
+// checkBackpressure rejects the submission with 503 when the queue is past
+// QUEUE_REJECT_DEPTH and returns false. Past QUEUE_WARN_DEPTH it still
+// accepts, returning a warning for the 202 so the client knows.
+func checkBackpressure(c *gin.Context) (api.QueueWarning, bool) {
+    depth, err := pendingDepth(c.Request.Context())
+    if err != nil {
+        // Don't turn customers away because the check itself failed
+        return api.QueueWarning{}, true
+    }
+
+    wait := estimatedWait(depth)
+    if cfg().QueueRejectDepth > 0 && depth >= int64(cfg().QueueRejectDepth) {
+        rejectedSubmissions.Inc()
+        retryAfter := estimatedWait(depth - int64(cfg().QueueRejectDepth) + 1)
+        retryAfter = min(max(retryAfter, 30*time.Second), time.Hour)
+        c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+        c.JSON(http.StatusServiceUnavailable, gin.H{
+            "error":                  "Queue is full, please try again later",
+            "queue_depth":            depth,
+            "estimated_wait_seconds": int(wait.Seconds()),
+        })
+        return api.QueueWarning{}, false
+    }
+
+    if cfg().QueueWarnDepth > 0 && depth >= int64(cfg().QueueWarnDepth) {
+        return api.QueueWarning{
+            Warning:              "The queue is busy, results will take longer than usual",
+            EstimatedWaitSeconds: int(wait.Seconds()),
+        }, true
+    }
+    return api.QueueWarning{}, true
+}
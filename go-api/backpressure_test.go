@@ -0,0 +1,91 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "testing"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// enqueueTestJobs submits n standard PLA jobs and returns their payloads.
+func enqueueTestJobs(t *testing.T, n int) []string {
+    t.Helper()
+    var payloads []string
+    for i := 0; i < n; i++ {
+        id := fmt.Sprintf("job-%d", i)
+        data, _ := json.Marshal(map[string]interface{}{"id": id, "submitted_at": 1000 + i})
+        if err := enqueue(ctx, standardQueue, id, data); err != nil {
+            t.Fatal(err)
+        }
+        payloads = append(payloads, string(data))
+    }
+    return payloads
+}
+
+// readFromStream has a worker take n entries through the consumer group.
+func readFromStream(t *testing.T, n int64) {
+    t.Helper()
+    err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+        Group:    consumerGroup,
+        Consumer: "test",
+        Streams:  []string{streamFor(standardQueue), ">"},
+        Count:    n,
+        Block:    -1,
+    }).Err()
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestPendingDepthFromStream(t *testing.T) {
+    tests := []struct {
+        name   string
+        legacy bool
+    }{
+        {"stream only", false},
+        // Workers read the stream and nobody pops the list, which keeps
+        // every entry
+        {"dual publish", true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setupTest(t, func(c *Config) { c.LegacyListQueue = tt.legacy })
+            if err := initStreams(); err != nil {
+                t.Fatal(err)
+            }
+            enqueueTestJobs(t, 3)
+            readFromStream(t, 1)
+
+            depth, err := pendingDepth(ctx)
+            if err != nil || depth != 2 {
+                t.Fatalf("pendingDepth = %d, %v; want 2", depth, err)
+            }
+            if pos, _ := queuePosition(ctx, "job-2"); !tt.legacy && pos != 2 {
+                t.Errorf("queuePosition(job-2) = %d, want 2", pos)
+            }
+            if got := queueDepths(ctx)[standardQueue]; got != 2 {
+                t.Errorf("queueDepths[%s] = %d, want 2", standardQueue, got)
+            }
+        })
+    }
+}
+
+func TestPendingDepthCountsFairLists(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.LegacyListQueue = false
+        c.FairScheduling = true
+    })
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    enqueueTestJobs(t, 1)
+    if err := submitJob(ctx, standardQueue, "fair-1", "alice", []byte(`{"id":"fair-1"}`)); err != nil {
+        t.Fatal(err)
+    }
+
+    depth, err := pendingDepth(ctx)
+    if err != nil || depth != 2 {
+        t.Fatalf("pendingDepth = %d, %v; want 2", depth, err)
+    }
+}
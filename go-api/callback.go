@@ -0,0 +1,132 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+// A /quote may name a callback_url to be POSTed the final status and result
+// once the job completes or fails. callback:{id} holds the URL from
+// submission and, once tried, the outcome; it expires with the job.
+func callbackKey(jobID string) string {
+    return "callback:" + jobID
+}
+
+// callbackClient delivers callbacks, with the same address checks on every
+// connection as webhooks.
+var callbackClient = webhookClient
+
+// validCallback accepts https URLs whose host resolves only to public
+// addresses, as long as there is a secret to sign their deliveries with:
+// the request's own or WEBHOOK_SECRET, unless WEBHOOK_ALLOW_UNSIGNED.
+func validCallback(raw, secret string) error {
+    if u, err := url.Parse(raw); err != nil || u.Scheme != "https" {
+        return fmt.Errorf("callback_url must be an https URL")
+    }
+    if err := checkWebhookURL(raw); err != nil {
+        return fmt.Errorf("callback_url: %v", err)
+    }
+    if signingSecret(secret) == "" && !cfg().WebhookAllowUnsigned {
+        return fmt.Errorf("callback_url needs a callback_secret to sign deliveries with")
+    }
+    return nil
+}
+
+// registerCallback stores jobID's callback URL and secret, if it has one.
+func registerCallback(ctx context.Context, jobID, callbackURL, secret string) {
+    if callbackURL == "" {
+        return
+    }
+    pipe := rdb.TxPipeline()
+    pipe.HSet(ctx, callbackKey(jobID), "url", callbackURL)
+    if secret != "" {
+        pipe.HSet(ctx, callbackKey(jobID), "secret", secret)
+    }
+    pipe.Expire(ctx, callbackKey(jobID), 24*time.Hour)
+    pipe.Exec(ctx)
+}
+
+// fireCallback queues jobID's callback in the outbox, which retries it like
+// a webhook, when it has one that hasn't been sent yet. result is the
+// worker's result JSON. The lookup happens before going to the background,
+// so jobs without a callback don't start a goroutine.
+func fireCallback(jobID, status string, result json.RawMessage) {
+    key := callbackKey(jobID)
+    if n, err := rdb.Exists(ctx, key).Result(); err != nil || n == 0 {
+        return
+    }
+    // Only the first finish sends it, should the job report twice
+    if first, err := rdb.HSetNX(ctx, key, "sent_at", time.Now().UTC().Format(time.RFC3339)).Result(); err != nil || !first {
+        return
+    }
+    body, _ := json.Marshal(gin.H{
+        "job_id":    jobID,
+        "status":    status,
+        "result":    result,
+        "timestamp": time.Now().UTC().Format(time.RFC3339),
+    })
+    id, err := enqueueDelivery(ctx, outboxDelivery{
+        Kind:    outboxCallback,
+        JobID:   jobID,
+        Event:   "job." + status,
+        Payload: string(body),
+    })
+    if err != nil {
+        log.Printf("callback: queueing %s for %s: %v", status, jobID, err)
+        return
+    }
+    rdb.HSet(ctx, key, "delivery_id", id)
+    go attemptDelivery(id)
+}
+
+// postCallback sends one attempt of jobID's callback to the URL and with the
+// secret it was registered with, returning the response status.
+func postCallback(ctx context.Context, jobID, event string, body []byte) (int, error) {
+    cb, err := rdb.HGetAll(ctx, callbackKey(jobID)).Result()
+    if err != nil {
+        return 0, err
+    }
+    if cb["url"] == "" {
+        return 0, errDeliveryGone
+    }
+    ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, cb["url"], bytes.NewReader(body))
+    if err != nil {
+        return 0, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Webhook-Event", event)
+    setSignatureHeaders(req.Header, signingSecret(cb["secret"]), body)
+    resp, err := callbackClient.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, deliveryBodyLimit))
+    if resp.StatusCode >= 300 {
+        return resp.StatusCode, fmt.Errorf("callback answered %d", resp.StatusCode)
+    }
+    return resp.StatusCode, nil
+}
+
+// recordCallbackOutcome notes in callback:{id} how delivery went, for
+// /status's webhook_delivered once it is settled.
+func recordCallbackOutcome(pipe redis.Pipeliner, jobID string, attempts int, err error, settled bool) {
+    fields := []interface{}{"attempts", attempts, "error", errString(err)}
+    if settled {
+        fields = append(fields, "delivered", strconv.FormatBool(err == nil))
+    }
+    pipe.HSet(ctx, callbackKey(jobID), fields...)
+}
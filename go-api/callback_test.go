@@ -0,0 +1,222 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// callbackServer answers with codes in turn, then 200, and records bodies.
+func callbackServer(t *testing.T, codes ...int) (*httptest.Server, func() []map[string]interface{}) {
+    t.Helper()
+    var mu sync.Mutex
+    var bodies []map[string]interface{}
+    srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mu.Lock()
+        defer mu.Unlock()
+        raw, _ := io.ReadAll(r.Body)
+        var body map[string]interface{}
+        json.Unmarshal(raw, &body)
+        bodies = append(bodies, body)
+        if len(bodies) <= len(codes) {
+            w.WriteHeader(codes[len(bodies)-1])
+        }
+    }))
+    t.Cleanup(srv.Close)
+    saved := callbackClient
+    callbackClient = srv.Client()
+    t.Cleanup(func() { callbackClient = saved })
+    return srv, func() []map[string]interface{} {
+        mu.Lock()
+        defer mu.Unlock()
+        return append([]map[string]interface{}(nil), bodies...)
+    }
+}
+
+func callbackQuote(url string) string {
+    return `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20,"callback_url":"` + url + `","callback_secret":"cb-secret"}`
+}
+
+// callbackDelivery waits for jobID's callback to be queued and its first
+// attempt made, and returns the outbox ID.
+func callbackDelivery(t *testing.T, jobID string) string {
+    t.Helper()
+    for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+        if id := rdb.HGet(ctx, callbackKey(jobID), "delivery_id").Val(); id != "" {
+            waitAttempts(t, id, 1)
+            return id
+        }
+    }
+    t.Fatal("callback never queued")
+    return ""
+}
+
+// waitDelivered waits for the callback outcome to be recorded.
+func waitDelivered(t *testing.T, jobID string) map[string]string {
+    t.Helper()
+    for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+        if h := rdb.HGetAll(ctx, callbackKey(jobID)).Val(); h["delivered"] != "" {
+            return h
+        }
+    }
+    t.Fatal("callback outcome never recorded")
+    return nil
+}
+
+func TestQuoteValidatesCallbackURL(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    r := newRouter()
+    for _, u := range []string{"http://example.com/hook", "ftp://example.com/", "https://127.0.0.1/hook", "https://10.0.0.8/hook"} {
+        if w := do(r, http.MethodPost, "/quote", callbackQuote(u)); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", u, w.Code)
+        }
+    }
+}
+
+func TestCallbackDeliveredWithRetry(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.InternalSecret = "s"
+        c.WebhookAllowPrivate = true
+    })
+    srv, bodies := callbackServer(t, http.StatusBadGateway)
+    r := newRouter()
+    code, jobID, _ := quoteJobID(t, r, callbackQuote(srv.URL+"/erp"))
+    if code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202", code)
+    }
+    payload, _ := rdb.Get(ctx, "params:"+jobID).Bytes()
+    if job, _ := readPayload(payload); job["callback_url"] != srv.URL+"/erp" {
+        t.Errorf("payload callback_url = %v", job["callback_url"])
+    }
+
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    reportStatus(t, r, jobID, `{"status":"completed","result":{"summary":{"total_cost":9.9}}}`)
+    callbackDelivery(t, jobID)
+    if h := rdb.HGetAll(ctx, callbackKey(jobID)).Val(); h["delivered"] != "" || h["attempts"] != "1" || h["error"] == "" {
+        t.Fatalf("outcome after the failed first attempt = %v, want unsettled", h)
+    }
+    retryDeliveries(t)
+    if h := waitDelivered(t, jobID); h["delivered"] != "true" || h["attempts"] != "2" {
+        t.Fatalf("outcome = %v, want delivered on the second attempt", h)
+    }
+    got := bodies()
+    if len(got) != 2 || got[1]["status"] != "completed" || got[1]["job_id"] != jobID {
+        t.Fatalf("deliveries = %v", got)
+    }
+    if res, _ := got[1]["result"].(map[string]interface{}); res["summary"] == nil {
+        t.Errorf("callback result = %v, want the worker's result", got[1]["result"])
+    }
+
+    w := do(r, http.MethodGet, "/jobs/"+jobID, "")
+    var resp map[string]interface{}
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if resp["webhook_delivered"] != true {
+        t.Errorf("GET /jobs/:id = %v, want webhook_delivered true", resp)
+    }
+}
+
+func TestCallbackFailureRecorded(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.InternalSecret = "s"
+        c.WebhookAllowPrivate = true
+        c.WebhookMaxAttempts = 3
+    })
+    srv, bodies := callbackServer(t, 500, 500, 500, 500)
+    r := newRouter()
+    _, jobID, _ := quoteJobID(t, r, callbackQuote(srv.URL))
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    reportStatus(t, r, jobID, `{"status":"failed","result":{"error":"bad mesh"}}`)
+    id := callbackDelivery(t, jobID)
+    retryDeliveries(t)
+    retryDeliveries(t)
+
+    if h := waitDelivered(t, jobID); h["delivered"] != "false" || h["attempts"] != "3" {
+        t.Fatalf("outcome = %v, want undelivered after 3 attempts", h)
+    }
+    if n := len(bodies()); n != 3 {
+        t.Errorf("%d attempts, want 3", n)
+    }
+    if d, _ := loadOutbox(ctx, id); d.State != outboxFailed || len(d.Attempts) != 3 || d.Attempts[2].ResponseStatus != 500 {
+        t.Errorf("delivery = %+v, want failed with the 500s recorded", d)
+    }
+    w := do(r, http.MethodGet, "/status/"+jobID, "")
+    var resp map[string]interface{}
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if resp["webhook_delivered"] != false {
+        t.Errorf("status = %v, want webhook_delivered false", resp)
+    }
+}
+
+func TestQuoteCallbackNeedsSecret(t *testing.T) {
+    unsigned := `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20,"callback_url":"https://127.0.0.1/hook"}`
+    for _, tc := range []struct {
+        name      string
+        configure func(*Config)
+        want      int
+    }{
+        {"no secret", func(*Config) {}, http.StatusBadRequest},
+        {"deployment secret", func(c *Config) { c.WebhookSecret = "shared" }, http.StatusAccepted},
+        {"unsigned allowed", func(c *Config) { c.WebhookAllowUnsigned = true }, http.StatusAccepted},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            setupTest(t, func(c *Config) {
+                c.WebhookAllowPrivate = true
+                tc.configure(c)
+            })
+            if code, _, _ := quoteJobID(t, newRouter(), unsigned); code != tc.want {
+                t.Errorf("status = %d, want %d", code, tc.want)
+            }
+        })
+    }
+}
+
+func TestCallbackSigned(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.InternalSecret = "s"
+        c.WebhookAllowPrivate = true
+        c.WebhookSecret = "shared"
+    })
+    type delivery struct {
+        body           []byte
+        timestamp, sig string
+    }
+    got := make(chan delivery, 1)
+    srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        got <- delivery{body, r.Header.Get("X-Timestamp"), r.Header.Get("X-Signature")}
+    }))
+    defer srv.Close()
+    saved := callbackClient
+    callbackClient = srv.Client()
+    defer func() { callbackClient = saved }()
+
+    r := newRouter()
+    _, jobID, _ := quoteJobID(t, r, callbackQuote(srv.URL))
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    reportStatus(t, r, jobID, `{"status":"completed","result":{}}`)
+    d := <-got
+    waitDelivered(t, jobID)
+
+    // The job's own secret wins over WEBHOOK_SECRET
+    want := "sha256=" + signBody("cb-secret", []byte(d.timestamp+"."+string(d.body)))
+    if d.sig != want {
+        t.Errorf("X-Signature = %q, want %q", d.sig, want)
+    }
+    ts, err := strconv.ParseInt(d.timestamp, 10, 64)
+    if err != nil || time.Since(time.Unix(ts, 0)).Abs() > time.Minute {
+        t.Errorf("X-Timestamp = %q, want the current Unix time", d.timestamp)
+    }
+    if secret := rdb.HGet(ctx, callbackKey(jobID), "secret").Val(); secret != "cb-secret" {
+        t.Errorf("stored secret = %q", secret)
+    }
+    payload, _ := rdb.Get(ctx, "params:"+jobID).Bytes()
+    if strings.Contains(string(payload), "cb-secret") {
+        t.Error("the callback secret leaked into the job payload")
+    }
+}
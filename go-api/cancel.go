@@ -0,0 +1,222 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// removeStreamEntry deletes an entry no worker has read yet.
+var removeStreamEntry = redis.NewScript(claimUndeliveredLua + `
+return redis.call('XDEL', KEYS[1], ARGV[1])
+`)
+
+// cancelChannelPrefix + job ID is the pub/sub channel a forced cancel is
+// announced on; abort:{id} is set too, for workers that check between
+// stages or missed the message.
+const cancelChannelPrefix = "cancel:"
+
+// casStatus sets status:{id} to ARGV[2] only if it is still ARGV[1], so a
+// cancel can't overwrite a status a worker wrote after it was read.
+var casStatus = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+    return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'EX', ARGV[3])
+return 1
+`)
+
+// DELETE /jobs/:id withdraws a job that no worker has started: scheduled,
+// waiting in a queue or a fair list, or backing off before a retry; those
+// are cancelled at once. Processing jobs get 409 unless ?force=true, which
+// asks the worker to stop and marks them "cancelling" until it does (they
+// become "cancelled"), or until their result arrives first.
+func handleCancelJob(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    status, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if !authorizeJob(c, jobID) {
+        return
+    }
+    c.JSON(cancelJob(c, jobID, status, c.Query("force") == "true"))
+}
+
+// cancelJob cancels jobID, last seen in status, for handleCancelJob and the
+// WebSocket's cancel action, and returns the response for it.
+func cancelJob(c *gin.Context, jobID, status string, force bool) (int, gin.H) {
+    ctx := c.Request.Context()
+    next, note := "cancelled", ""
+    switch {
+    case status == "scheduled":
+        payload, _ := rdb.Get(ctx, "params:"+jobID).Result()
+        if removed, _ := rdb.ZRem(ctx, scheduledQueue, payload).Result(); removed == 0 {
+            // Released between the status read and now
+            return http.StatusConflict, gin.H{"error": "Job has already been released to the queue"}
+        }
+        note = "Cancelled before release"
+    case status == "queued":
+        removed, err := withdrawQueued(ctx, jobID)
+        if err != nil {
+            return http.StatusInternalServerError, gin.H{"error": "Redis error"}
+        }
+        if removed {
+            note = "Cancelled while queued"
+        } else if !force {
+            return http.StatusConflict, gin.H{"error": "A worker has already picked up this job; retry with ?force=true", "status": "processing"}
+        } else {
+            next = "cancelling"
+        }
+    case status == "processing" && force:
+        next = "cancelling"
+    case status == "processing":
+        return http.StatusConflict, gin.H{"error": "Job is already processing; retry with ?force=true to stop it", "status": status}
+    case status == "cancelling":
+        return http.StatusAccepted, gin.H{"job_id": jobID, "status": status}
+    default:
+        return http.StatusConflict, gin.H{"error": "Job has already finished", "status": status}
+    }
+
+    if next == "cancelling" {
+        // Until the worker answers, the sweeper settles it at the deadline
+        rdb.Set(ctx, abortKey(jobID), "1", cfg().ProcessingDeadline())
+        note = "Cancel requested; waiting for the worker to stop"
+    }
+    // A queued job's status only changes when it is claimed, and the claim
+    // here already took it off the queue. Others may finish meanwhile.
+    swapped, err := casStatus.Run(ctx, rdb, []string{"status:" + jobID}, status, next, int((24 * time.Hour).Seconds())).Int()
+    if err != nil {
+        return http.StatusInternalServerError, gin.H{"error": "Redis error"}
+    }
+    if swapped == 0 && next == "cancelling" {
+        // The worker reported in between; cancelling a job a worker has
+        // already picked up is always best effort
+        current, _ := rdb.Get(ctx, "status:"+jobID).Result()
+        if current == "processing" {
+            swapped, _ = casStatus.Run(ctx, rdb, []string{"status:" + jobID}, current, next, int((24 * time.Hour).Seconds())).Int()
+        }
+        if swapped == 0 {
+            rdb.Del(ctx, abortKey(jobID))
+            return http.StatusConflict, gin.H{"error": "Job finished before the cancel", "status": current}
+        }
+        status = current
+    } else if swapped == 0 {
+        // We took it off the queue, so only a copy a list worker popped
+        // while dual publishing can have moved it on. The cancel stands
+        // and that worker's reports are ignored, unless it already
+        // finished the job.
+        current, err := setStatus(ctx, jobID, JobStatus(next), 24*time.Hour)
+        if errors.Is(err, errInvalidTransition) {
+            return http.StatusConflict, gin.H{"error": "Job finished before the cancel", "status": string(current)}
+        } else if err != nil {
+            return http.StatusInternalServerError, gin.H{"error": "Redis error"}
+        }
+    }
+
+    if next == "cancelled" {
+        // Withdrawn before any worker downloaded it
+        deleteUpload(ctx, jobID)
+    }
+    pipe := rdb.TxPipeline()
+    pipe.Set(ctx, "note:"+jobID, note, 24*time.Hour)
+    if next == "cancelled" {
+        pipe.Del(ctx, "params:"+jobID, "next_retry_at:"+jobID, progressKey(jobID))
+    } else {
+        pipe.Publish(ctx, cancelChannelPrefix+jobID, "cancel")
+    }
+    if _, err := pipe.Exec(ctx); err != nil {
+        return http.StatusInternalServerError, gin.H{"error": "Redis error"}
+    }
+    publishStatus(ctx, jobID, next, note)
+
+    event := auditEventFor(c, auditJobCancelled, jobID, requestOwner(c))
+    event.Before, event.After = status, next
+    audit.Record(ctx, event)
+
+    code := http.StatusOK
+    if next == "cancelling" {
+        code = http.StatusAccepted
+    }
+    return code, gin.H{"job_id": jobID, "status": next}
+}
+
+// settleCancel finishes a forced cancel the worker will never confirm.
+func settleCancel(jobID, why string) {
+    swapped, _ := casStatus.Run(ctx, rdb, []string{"status:" + jobID}, "cancelling", "cancelled", int((24 * time.Hour).Seconds())).Int()
+    if swapped == 0 {
+        return
+    }
+    deleteUpload(ctx, jobID)
+    rdb.Del(ctx, abortKey(jobID), "params:"+jobID, progressKey(jobID))
+    rdb.Set(ctx, "note:"+jobID, "Cancelled while processing; "+why, 24*time.Hour)
+    publishStatus(ctx, jobID, "cancelled", why)
+}
+
+// withdrawQueued takes jobID off wherever a queued job waits before a worker
+// claims it: its fair list, the undelivered part of its stream, the legacy
+// list and the retry backoff set. Each removal is itself the claim against
+// workers, the dispatcher and other replicas. It reports whether any copy
+// was removed; false means a worker got there first.
+func withdrawQueued(ctx context.Context, jobID string) (bool, error) {
+    payload, err := rdb.Get(ctx, "params:"+jobID).Result()
+    if err == redis.Nil {
+        return false, nil
+    } else if err != nil {
+        return false, err
+    }
+    job, err := readPayload([]byte(payload))
+    if err != nil {
+        return false, err
+    }
+    queue := payloadQueue(job)
+    owner, _ := job["owner_id"].(string)
+
+    removed := false
+    if n, _ := rdb.LRem(ctx, fairListKey(queue, submitterOf(owner)), 1, payload).Result(); n > 0 {
+        removed = true
+    }
+    if group, err := streamGroup(ctx, queue); err == nil && group != nil {
+        entries, _ := undelivered(ctx, queue, group, streamMaxLen)
+        for _, e := range entries {
+            if e.Values["payload"] != payload {
+                continue
+            }
+            n, err := removeStreamEntry.Run(ctx, rdb, []string{streamFor(queue)}, e.ID, consumerGroup).Int()
+            if err != nil {
+                return removed, err
+            }
+            removed = removed || n == 1
+            break
+        }
+    }
+    if legacyListQueue() {
+        if n, _ := rdb.LRem(ctx, queue, 1, payload).Result(); n > 0 {
+            removed = true
+        }
+    }
+    // Backoff entries carry the attempt count, so they differ from params
+    delayed, _ := rdb.ZRange(ctx, delayedQueue, 0, -1).Result()
+    for _, entry := range delayed {
+        var d struct {
+            ID string `json:"id"`
+        }
+        if unmarshalPayload([]byte(entry), &d) != nil || d.ID != jobID {
+            continue
+        }
+        if n, _ := rdb.ZRem(ctx, delayedQueue, entry).Result(); n > 0 {
+            removed = true
+        }
+        break
+    }
+    return removed, nil
+}
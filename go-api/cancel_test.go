@@ -0,0 +1,240 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+)
+
+// submitForCancel queues a quote and returns its job ID and access token.
+func submitForCancel(t *testing.T, h http.Handler) (string, string) {
+    t.Helper()
+    w := do(h, http.MethodPost, "/quote", dedupeQuote)
+    var resp struct {
+        JobID       string `json:"job_id"`
+        AccessToken string `json:"access_token"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if w.Code != http.StatusAccepted || resp.JobID == "" || resp.AccessToken == "" {
+        t.Fatalf("submit: status = %d, body %s; want 202 with job_id and access_token", w.Code, w.Body)
+    }
+    return resp.JobID, resp.AccessToken
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+    tests := []struct {
+        name      string
+        configure func(*Config)
+    }{
+        {"fair list", func(c *Config) {}},
+        {"stream and legacy list", func(c *Config) { c.FairScheduling = false }},
+        {"stream only", func(c *Config) { c.FairScheduling, c.LegacyListQueue = false, false }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setupTest(t, tt.configure)
+            if err := initStreams(); err != nil {
+                t.Fatal(err)
+            }
+            r := newRouter()
+            jobID, token := submitForCancel(t, r)
+
+            w := do(r, http.MethodDelete, "/jobs/"+jobID, "", jobTokenHeader, token)
+            if w.Code != http.StatusOK {
+                t.Fatalf("cancel: status = %d, want 200 (body %s)", w.Code, w.Body)
+            }
+            if n, _ := pendingDepth(ctx); n != 0 {
+                t.Errorf("%d jobs still waiting after the cancel, want 0", n)
+            }
+            if n := rdb.LLen(ctx, standardQueue).Val(); n != 0 {
+                t.Errorf("legacy list still holds %d entries", n)
+            }
+            var got struct {
+                Status string `json:"status"`
+            }
+            json.Unmarshal(do(r, http.MethodGet, "/status/"+jobID, "").Body.Bytes(), &got)
+            if got.Status != "cancelled" {
+                t.Errorf("/status = %q, want cancelled", got.Status)
+            }
+        })
+    }
+}
+
+func TestCancelNeedsAccessToken(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    jobID, _ := submitForCancel(t, r)
+
+    if w := do(r, http.MethodDelete, "/jobs/"+jobID, ""); w.Code != http.StatusForbidden {
+        t.Errorf("no token: status = %d, want 403", w.Code)
+    }
+    if w := do(r, http.MethodDelete, "/jobs/"+jobID, "", jobTokenHeader, "guess"); w.Code != http.StatusForbidden {
+        t.Errorf("wrong token: status = %d, want 403", w.Code)
+    }
+    if s := rdb.Get(ctx, "status:"+jobID).Val(); s != "queued" {
+        t.Errorf("status = %q after refused cancels, want queued", s)
+    }
+}
+
+func TestCancelPickedUpJob(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.FairScheduling, c.LegacyListQueue = false, false
+        c.InternalSecret = "s"
+    })
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    r := newRouter()
+    jobID, token := submitForCancel(t, r)
+    readFromStream(t, 1)
+
+    if w := do(r, http.MethodDelete, "/jobs/"+jobID, "", jobTokenHeader, token); w.Code != http.StatusConflict {
+        t.Fatalf("cancel after pickup: status = %d, want 409", w.Code)
+    }
+    if w := do(r, http.MethodDelete, "/jobs/"+jobID+"?force=true", "", jobTokenHeader, token); w.Code != http.StatusAccepted {
+        t.Fatalf("forced cancel: status = %d, want 202 (body %s)", w.Code, w.Body)
+    }
+    if n := rdb.Exists(ctx, abortKey(jobID)).Val(); n != 1 {
+        t.Error("forced cancel did not signal the worker to stop")
+    }
+
+    // The worker stops and says so
+    reportStatus(t, r, jobID, `{"status":"aborted"}`)
+    if s := rdb.Get(ctx, "status:"+jobID).Val(); s != "cancelled" {
+        t.Errorf("status = %q after the worker stopped, want cancelled", s)
+    }
+}
+
+func TestCancelProcessingAndFinished(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:p", "processing", 0)
+    rdb.Set(ctx, "status:d", "completed", 0)
+
+    if w := do(r, http.MethodDelete, "/jobs/p", ""); w.Code != http.StatusConflict {
+        t.Errorf("processing: status = %d, want 409", w.Code)
+    }
+    if w := do(r, http.MethodDelete, "/jobs/d?force=true", ""); w.Code != http.StatusConflict {
+        t.Errorf("finished, forced: status = %d, want 409", w.Code)
+    }
+    if w := do(r, http.MethodDelete, "/jobs/p?force=true", ""); w.Code != http.StatusAccepted {
+        t.Errorf("processing, forced: status = %d, want 202", w.Code)
+    }
+}
+
+// forceCancel marks processing job j1 cancelling the way a client would.
+func forceCancel(t *testing.T, h http.Handler) {
+    t.Helper()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    if w := do(h, http.MethodDelete, "/jobs/j1?force=true", ""); w.Code != http.StatusAccepted {
+        t.Fatalf("forced cancel: status = %d, want 202 (body %s)", w.Code, w.Body)
+    }
+    if s := rdb.Get(ctx, "status:j1").Val(); s != "cancelling" {
+        t.Fatalf("status = %q after a forced cancel, want cancelling", s)
+    }
+}
+
+func TestForcedCancelPublishes(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    sub := rdb.Subscribe(ctx, cancelChannelPrefix+"j1")
+    defer sub.Close()
+    if _, err := sub.Receive(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    forceCancel(t, r)
+    msg, err := sub.ReceiveMessage(ctx)
+    if err != nil || msg.Channel != cancelChannelPrefix+"j1" {
+        t.Fatalf("message = %v, %v; want one on %sj1", msg, err, cancelChannelPrefix)
+    }
+    if n := rdb.Exists(ctx, abortKey("j1")).Val(); n != 1 {
+        t.Error("forced cancel did not set the flag the worker checks between stages")
+    }
+}
+
+func TestCancelRacesWithWorker(t *testing.T) {
+    tests := []struct {
+        name       string
+        reports    []string
+        wantStatus string
+        wantResult bool
+    }{
+        {"worker stops", []string{`{"status":"aborted"}`}, "cancelled", false},
+        {"result arrives first", []string{`{"status":"completed","result":{"price":1}}`}, "completed", true},
+        {"failure arrives first", []string{`{"status":"failed","result":{"error":"bad mesh"}}`}, "failed", true},
+        {"progress keeps it cancelling", []string{`{"status":"processing","step":"slicing"}`}, "cancelling", false},
+        {"progress, then the worker stops", []string{`{"status":"processing","step":"slicing"}`, `{"status":"aborted"}`}, "cancelled", false},
+        {"a report after the cancel settled is ignored", []string{`{"status":"aborted"}`, `{"status":"completed","result":{"price":1}}`}, "cancelled", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+            r := newRouter()
+            forceCancel(t, r)
+            for _, body := range tt.reports {
+                if code := reportStatus(t, r, "j1", body); code != http.StatusOK {
+                    t.Fatalf("report %s: status = %d, want 200", body, code)
+                }
+            }
+            if s := rdb.Get(ctx, "status:j1").Val(); s != tt.wantStatus {
+                t.Errorf("status = %q, want %q", s, tt.wantStatus)
+            }
+            if has := rdb.Exists(ctx, "result:j1").Val() == 1; has != tt.wantResult {
+                t.Errorf("result stored = %v, want %v", has, tt.wantResult)
+            }
+            if tt.wantStatus != "cancelling" && rdb.Exists(ctx, abortKey("j1")).Val() != 0 {
+                t.Error("cancel flag left behind once the job settled")
+            }
+        })
+    }
+}
+
+func TestCancelAfterCompletion(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    reportStatus(t, r, "j1", `{"status":"completed","result":{"price":1}}`)
+
+    if w := do(r, http.MethodDelete, "/jobs/j1?force=true", ""); w.Code != http.StatusConflict {
+        t.Fatalf("cancel after completion: status = %d, want 409", w.Code)
+    }
+    if s := rdb.Get(ctx, "status:j1").Val(); s != "completed" {
+        t.Errorf("status = %q, want completed", s)
+    }
+    if n := rdb.Exists(ctx, abortKey("j1")).Val(); n != 0 {
+        t.Error("refused cancel still signalled the worker")
+    }
+}
+
+func TestCasStatusLosesToWorker(t *testing.T) {
+    setupTest(t)
+    // The handler read "processing", then the worker finished
+    rdb.Set(ctx, "status:j1", "completed", 0)
+    swapped, err := casStatus.Run(ctx, rdb, []string{"status:j1"}, "processing", "cancelling", 60).Int()
+    if err != nil || swapped != 0 {
+        t.Fatalf("casStatus = %d, %v; want 0", swapped, err)
+    }
+    if s := rdb.Get(ctx, "status:j1").Val(); s != "completed" {
+        t.Errorf("status = %q, want completed kept", s)
+    }
+}
+
+func TestUnconfirmedCancelSettles(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    forceCancel(t, r)
+    payload := marshalPayload(map[string]interface{}{"id": "j1"})
+    rdb.RPush(ctx, processingQueue, payload)
+    rdb.HSet(ctx, claimedAtKey, "j1", 1)
+
+    if err := reapProcessing(); err != nil {
+        t.Fatal(err)
+    }
+    if s := rdb.Get(ctx, "status:j1").Val(); s != "cancelled" {
+        t.Errorf("status = %q after the reaper found the dead claim, want cancelled", s)
+    }
+    if n := rdb.LLen(ctx, processingQueue).Val(); n != 0 {
+        t.Errorf("processing list still holds %d entries", n)
+    }
+}
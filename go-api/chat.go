@@ -0,0 +1,239 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// Operators can be told of job events in Slack or Discord through an
+// incoming webhook: SLACK_WEBHOOK_URL and DISCORD_WEBHOOK_URL. Every status
+// publishStatus puts out whose event is in CHAT_EVENTS is posted there,
+// through the outbox like any webhook, at most CHAT_MAX_PER_MINUTE a
+// minute. The rest of a minute's events are counted in
+// chat_overflow:{minute} and posted as one summary once the minute is
+// over; chat_overflow indexes the minutes still to sum up.
+const (
+    chatOverflowKey  = "chat_overflow"
+    chatSampleSize   = 5
+    chatCountTTL     = 2 * time.Minute
+    chatOverflowTTL  = time.Hour
+    chatPollInterval = 15 * time.Second
+)
+
+// chatClient posts to the configured webhooks. Unlike customer webhooks
+// they're set by the operator, so any address may be used.
+var chatClient = &http.Client{Timeout: webhookTimeout}
+
+func chatCountKey(minute int64) string {
+    return "chat_count:" + strconv.FormatInt(minute, 10)
+}
+
+func chatOverflowMinuteKey(minute int64) string {
+    return chatOverflowKey + ":" + strconv.FormatInt(minute, 10)
+}
+
+// chatSentKey marks an event as posted or counted, should the job publish
+// the same status twice.
+func chatSentKey(jobID, status string) string {
+    return "chat_sent:" + jobID + ":" + status
+}
+
+// chatTargets are the outbox kinds for the webhooks that are configured.
+func chatTargets() []string {
+    var kinds []string
+    if cfg().SlackWebhookURL != "" {
+        kinds = append(kinds, outboxSlack)
+    }
+    if cfg().DiscordWebhookURL != "" {
+        kinds = append(kinds, outboxDiscord)
+    }
+    return kinds
+}
+
+func chatWanted(event string) bool {
+    for _, e := range cfg().ChatEvents {
+        if e == event {
+            return true
+        }
+    }
+    return false
+}
+
+// notifyChat posts jobID's new status to the operators' chat, or counts it
+// towards the minute's summary once the minute's cap is used up.
+func notifyChat(ctx context.Context, jobID, status string) {
+    event := "job." + status
+    if len(chatTargets()) == 0 || !chatWanted(event) {
+        return
+    }
+    if first, err := rdb.SetNX(ctx, chatSentKey(jobID, status), 1, jobTTL(ctx, jobID)).Result(); err != nil || !first {
+        return
+    }
+    if max := cfg().ChatMaxPerMinute; max > 0 {
+        minute := time.Now().Unix() / 60
+        n, err := rdb.Incr(ctx, chatCountKey(minute)).Result()
+        if err != nil {
+            return
+        }
+        rdb.Expire(ctx, chatCountKey(minute), chatCountTTL)
+        if n > int64(max) {
+            countChatOverflow(ctx, minute, event, jobID)
+            return
+        }
+    }
+    postChat(ctx, jobID, event, chatMessage(ctx, jobID, status))
+}
+
+// chatMessage is one line: the job, its material and error code, and a
+// link to GET /jobs/:id.
+func chatMessage(ctx context.Context, jobID, status string) string {
+    parts := []string{"Job " + jobID + " " + status}
+    vals, _ := rdb.MGet(ctx, "params:"+jobID, "result:"+jobID).Result()
+    if raw, ok := vals[0].(string); ok {
+        if job, err := readPayload([]byte(raw)); err == nil {
+            if m, _ := job["material"].(string); m != "" {
+                parts = append(parts, m)
+            }
+        }
+    }
+    if raw, ok := vals[1].(string); ok {
+        if r, err := parseResult([]byte(raw)); err == nil && r.ErrorCode != "" {
+            parts = append(parts, r.ErrorCode)
+        }
+    }
+    parts = append(parts, strings.TrimSuffix(cfg().Host, "/")+"/"+apiV1+"/jobs/"+jobID)
+    return strings.Join(parts, " · ")
+}
+
+// countChatOverflow adds an event past the cap to its minute's summary,
+// keeping the latest few job IDs as examples.
+func countChatOverflow(ctx context.Context, minute int64, event, jobID string) {
+    key := chatOverflowMinuteKey(minute)
+    pipe := rdb.TxPipeline()
+    pipe.HIncrBy(ctx, key, event, 1)
+    pipe.LPush(ctx, key+":jobs", jobID)
+    pipe.LTrim(ctx, key+":jobs", 0, chatSampleSize-1)
+    pipe.Expire(ctx, key, chatOverflowTTL)
+    pipe.Expire(ctx, key+":jobs", chatOverflowTTL)
+    pipe.ZAdd(ctx, chatOverflowKey, &redis.Z{Score: float64(minute), Member: minute})
+    if _, err := pipe.Exec(ctx); err != nil {
+        log.Printf("chat: counting %s for %s: %v", event, jobID, err)
+    }
+}
+
+// flushChatOverflow posts the summary of every minute ended by now. The
+// replica whose ZREM takes a minute posts it, so each is posted once.
+func flushChatOverflow(ctx context.Context, now time.Time) {
+    current := now.Unix() / 60
+    minutes, err := rdb.ZRangeByScore(ctx, chatOverflowKey, &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(current-1, 10)}).Result()
+    if err != nil {
+        return
+    }
+    for _, m := range minutes {
+        if n, err := rdb.ZRem(ctx, chatOverflowKey, m).Result(); err != nil || n == 0 {
+            continue
+        }
+        minute, _ := strconv.ParseInt(m, 10, 64)
+        key := chatOverflowMinuteKey(minute)
+        counts, _ := rdb.HGetAll(ctx, key).Result()
+        jobs, _ := rdb.LRange(ctx, key+":jobs", 0, -1).Result()
+        rdb.Del(ctx, key, key+":jobs")
+        if len(counts) > 0 {
+            postChat(ctx, "", "summary", chatSummary(minute, counts, jobs))
+        }
+    }
+}
+
+// chatSummary sums up a minute's events past the cap, e.g. "Held back 480
+// notifications at 14:02 UTC: 478 job.failed, 2 job.completed. Latest: …".
+func chatSummary(minute int64, counts map[string]string, jobs []string) string {
+    events := make([]string, 0, len(counts))
+    total := 0
+    for e := range counts {
+        events = append(events, e)
+    }
+    sort.Strings(events)
+    for i, e := range events {
+        n, _ := strconv.Atoi(counts[e])
+        total += n
+        events[i] = strconv.Itoa(n) + " " + e
+    }
+    at := time.Unix(minute*60, 0).UTC().Format("15:04 MST")
+    msg := fmt.Sprintf("Held back %d notifications at %s, over CHAT_MAX_PER_MINUTE: %s.", total, at, strings.Join(events, ", "))
+    if len(jobs) > 0 {
+        msg += " Latest: " + strings.Join(jobs, ", ")
+    }
+    return msg
+}
+
+// postChat queues text for each configured webhook and makes the first
+// attempts in the background.
+func postChat(ctx context.Context, jobID, event, text string) {
+    for _, kind := range chatTargets() {
+        var body []byte
+        if kind == outboxSlack {
+            body, _ = json.Marshal(map[string]string{"text": text})
+        } else {
+            body, _ = json.Marshal(map[string]string{"content": text})
+        }
+        id, err := enqueueDelivery(ctx, outboxDelivery{
+            Kind:    kind,
+            JobID:   jobID,
+            Event:   event,
+            Payload: string(body),
+        })
+        if err != nil {
+            log.Printf("chat: queueing %s %s for %s: %v", kind, event, jobID, err)
+            continue
+        }
+        go attemptDelivery(id)
+    }
+}
+
+// sendChat makes one attempt at a Slack or Discord delivery.
+func sendChat(ctx context.Context, kind string, body []byte) (int, error) {
+    target := cfg().SlackWebhookURL
+    if kind == outboxDiscord {
+        target = cfg().DiscordWebhookURL
+    }
+    if target == "" {
+        return 0, errDeliveryGone
+    }
+    ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+    if err != nil {
+        return 0, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := chatClient.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, deliveryBodyLimit))
+    if resp.StatusCode >= 300 {
+        return resp.StatusCode, fmt.Errorf("%s answered %d", kind, resp.StatusCode)
+    }
+    return resp.StatusCode, nil
+}
+
+// startChatSummaries posts ended minutes' summaries every chatPollInterval.
+func startChatSummaries() {
+    go func() {
+        for range time.Tick(chatPollInterval) {
+            flushChatOverflow(ctx, time.Now())
+        }
+    }()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// chatServers stands in for Slack and Discord, recording the text of each
+// message.
+type chatServers struct {
+    mu             sync.Mutex
+    slack, discord []string
+}
+
+func startChatServers(t *testing.T, configure ...func(*Config)) *chatServers {
+    t.Helper()
+    s := &chatServers{}
+    record := func(list *[]string, field string) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            raw, _ := io.ReadAll(r.Body)
+            var body map[string]string
+            json.Unmarshal(raw, &body)
+            s.mu.Lock()
+            *list = append(*list, body[field])
+            s.mu.Unlock()
+            w.WriteHeader(http.StatusNoContent)
+        }
+    }
+    slack := httptest.NewTLSServer(record(&s.slack, "text"))
+    discord := httptest.NewTLSServer(record(&s.discord, "content"))
+    t.Cleanup(slack.Close)
+    t.Cleanup(discord.Close)
+    saved := chatClient
+    chatClient = slack.Client()
+    t.Cleanup(func() { chatClient = saved })
+
+    setupTest(t, append([]func(*Config){func(c *Config) {
+        c.InternalSecret = "s"
+        c.Host = "https://print.example.com"
+        c.SlackWebhookURL = slack.URL + "/services/T0/B0/x"
+        c.DiscordWebhookURL = discord.URL + "/api/webhooks/1/x"
+    }}, configure...)...)
+    return s
+}
+
+// wait returns the messages once each server has at least n.
+func (s *chatServers) wait(t *testing.T, n int) ([]string, []string) {
+    t.Helper()
+    for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+        s.mu.Lock()
+        slack, discord := append([]string(nil), s.slack...), append([]string(nil), s.discord...)
+        s.mu.Unlock()
+        if len(slack) >= n && len(discord) >= n {
+            return slack, discord
+        }
+    }
+    t.Fatalf("never got %d messages each: %v, %v", n, s.slack, s.discord)
+    return nil, nil
+}
+
+func TestChatPostsFailures(t *testing.T) {
+    s := startChatServers(t)
+    r := newRouter()
+    _, failed, _ := quoteJobID(t, r, `{"download_url":"https://example.com/a.stl","material":"PETG","infill":20}`)
+    _, done, _ := quoteJobID(t, r, `{"download_url":"https://example.com/b.stl","material":"PLA","infill":20}`)
+    for _, id := range []string{failed, done} {
+        reportStatus(t, r, id, `{"status":"processing"}`)
+    }
+    reportStatus(t, r, done, `{"status":"completed","result":{"summary":{"total_cost":2}}}`)
+    reportStatus(t, r, failed, `{"status":"failed","result":{"error":"not watertight","error_code":"geometry_error"}}`)
+    // Reported twice, posted once
+    reportStatus(t, r, failed, `{"status":"failed","result":{"error":"not watertight","error_code":"geometry_error"}}`)
+
+    slack, discord := s.wait(t, 1)
+    time.Sleep(50 * time.Millisecond)
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if len(s.slack) != 1 || len(s.discord) != 1 {
+        t.Fatalf("messages = %v, %v; want only the failure, once each", s.slack, s.discord)
+    }
+    want := "Job " + failed + " failed · PETG · geometry_error · https://print.example.com/v1/jobs/" + failed
+    if slack[0] != want || discord[0] != want {
+        t.Errorf("message = %q / %q, want %q", slack[0], discord[0], want)
+    }
+}
+
+func TestChatCapSummarizesTheRest(t *testing.T) {
+    s := startChatServers(t, func(c *Config) {
+        c.ChatMaxPerMinute = 2
+        c.ChatEvents = []string{"job.failed", "job.completed"}
+    })
+    // Keep the burst within one minute
+    if time.Now().Second() >= 58 {
+        time.Sleep(3 * time.Second)
+    }
+    ids := []string{"j1", "j2", "j3", "j4", "j5", "j6", "j7", "j8"}
+    for i, id := range ids {
+        status := "failed"
+        if i == len(ids)-1 {
+            status = "completed"
+        }
+        notifyChat(ctx, id, status)
+    }
+    s.wait(t, 2)
+
+    // The minute isn't over yet
+    flushChatOverflow(ctx, time.Now())
+    time.Sleep(50 * time.Millisecond)
+    if s.mu.Lock(); len(s.slack) != 2 {
+        t.Errorf("%d messages before the minute ended, want 2", len(s.slack))
+    }
+    s.mu.Unlock()
+
+    flushChatOverflow(ctx, time.Now().Add(time.Minute))
+    slack, _ := s.wait(t, 3)
+    summary := slack[2]
+    if !strings.Contains(summary, "Held back 6 notifications") || !strings.Contains(summary, "1 job.completed, 5 job.failed") || !strings.Contains(summary, "Latest: j8, j7, j6, j5, j4") {
+        t.Errorf("summary = %q", summary)
+    }
+    // Posted once, whichever replica flushes
+    flushChatOverflow(ctx, time.Now().Add(time.Minute))
+    time.Sleep(50 * time.Millisecond)
+    if s.mu.Lock(); len(s.slack) != 3 {
+        t.Errorf("%d messages after a second flush, want 3", len(s.slack))
+    }
+    s.mu.Unlock()
+}
+
+func TestChatOffWithoutWebhooks(t *testing.T) {
+    setupTest(t)
+    notifyChat(ctx, "j1", "failed")
+    if n := rdb.DBSize(ctx).Val(); n != 0 {
+        t.Errorf("%d keys written, want none", n)
+    }
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "io"
+)
+
+// Serialized jobs over PAYLOAD_COMPRESS_MIN_BYTES are gzipped and prefixed
+// with gzipPayloadPrefix. Plain payloads are JSON and start with '{', so one
+// byte tells readers (the worker included) which they have.
+const gzipPayloadPrefix = 0x01
+
+// marshalPayload serializes a job for the queues.
+func marshalPayload(job map[string]interface{}) []byte {
+    data, _ := json.Marshal(job)
+    return encodePayload(data)
+}
+
+func encodePayload(data []byte) []byte {
+    if !cfg().PayloadCompression || len(data) < cfg().PayloadCompressMinBytes {
+        return data
+    }
+    var buf bytes.Buffer
+    buf.WriteByte(gzipPayloadPrefix)
+    zw := gzip.NewWriter(&buf)
+    zw.Write(data)
+    zw.Close()
+    // Tiny payloads can come out larger
+    if buf.Len() >= len(data) {
+        return data
+    }
+    return buf.Bytes()
+}
+
+// decodePayload returns the JSON of a payload, compressed or not.
+func decodePayload(data []byte) ([]byte, error) {
+    if len(data) == 0 || data[0] != gzipPayloadPrefix {
+        return data, nil
+    }
+    zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return io.ReadAll(zr)
+}
+
+// unmarshalPayload is json.Unmarshal for payloads read back from Redis.
+func unmarshalPayload(data []byte, v interface{}) error {
+    decoded, err := decodePayload(data)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(decoded, v)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "github.com/google/uuid"
+
+    "slicer-api/internal/api"
+)
+
+// jobParams is the part of a payload a submitter chooses. Pointers tell a
+// field that's absent from one set to the default.
+type jobParams struct {
+    DownloadURL     *string  `json:"download_url"`
+    Material        *string  `json:"material"`
+    LayerHeight     *float64 `json:"layer_height"`
+    Infill          *int     `json:"infill"`
+    Rush            *bool    `json:"rush"`
+    Priority        *string  `json:"priority"`
+    Nozzle          *float64 `json:"nozzle"`
+    BedAdhesion     *string  `json:"bed_adhesion"`
+    Queue           *string  `json:"queue"`
+    MaxRetries      *int     `json:"max_retries"`
+    DeadlineSeconds *int     `json:"deadline_seconds"`
+    SubmitAt        *string  `json:"submit_at"`
+    OwnerID         *string  `json:"owner_id"`
+}
+
+// paramField is one field of a jobParams, nil when absent.
+type paramField struct {
+    name  string
+    value interface{}
+}
+
+func field[T comparable](name string, v *T) paramField {
+    if v == nil {
+        return paramField{name: name}
+    }
+    return paramField{name: name, value: *v}
+}
+
+// fields lists p in a fixed order, so both sides line up.
+func (p jobParams) fields() []paramField {
+    return []paramField{
+        field("download_url", p.DownloadURL),
+        field("material", p.Material),
+        field("layer_height", p.LayerHeight),
+        field("infill", p.Infill),
+        field("rush", p.Rush),
+        field("priority", p.Priority),
+        field("nozzle", p.Nozzle),
+        field("bed_adhesion", p.BedAdhesion),
+        field("queue", p.Queue),
+        field("max_retries", p.MaxRetries),
+        field("deadline_seconds", p.DeadlineSeconds),
+        field("submit_at", p.SubmitAt),
+        field("owner_id", p.OwnerID),
+    }
+}
+
+// validJobID reports whether id has the shape of the UUIDs submissions get.
+func validJobID(id string) bool {
+    _, err := uuid.Parse(id)
+    return err == nil
+}
+
+// loadJobParams reads and upgrades params:{id}, so fields older payloads
+// left out compare as their defaults.
+func loadJobParams(c *gin.Context, jobID string) (*jobParams, error) {
+    payload, err := rdb.Get(c.Request.Context(), "params:"+jobID).Bytes()
+    if err != nil {
+        return nil, err
+    }
+    job, err := readPayload(payload)
+    if err != nil {
+        return nil, err
+    }
+    upgraded, _ := json.Marshal(job)
+    var p jobParams
+    if err := json.Unmarshal(upgraded, &p); err != nil {
+        return nil, err
+    }
+    return &p, nil
+}
+
+// GET /jobs/compare?a={id}&b={id} diffs the parameters of two jobs field
+// by field.
+func handleCompareJobs(c *gin.Context) {
+    idA, idB := c.Query("a"), c.Query("b")
+    if !validJobID(idA) || !validJobID(idB) {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "a and b must be job IDs"})
+        return
+    }
+
+    var params [2]*jobParams
+    for i, id := range []string{idA, idB} {
+        p, err := loadJobParams(c, id)
+        if err == redis.Nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Job not found", "job_id": id})
+            return
+        } else if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Unreadable job payload", "job_id": id})
+            return
+        }
+        if p.OwnerID != nil && *p.OwnerID != requestOwner(c) {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Not your job", "job_id": id})
+            return
+        }
+        params[i] = p
+    }
+
+    changed := gin.H{}
+    onlyInA, onlyInB := gin.H{}, gin.H{}
+    identical := []string{}
+    fieldsB := params[1].fields()
+    for i, fa := range params[0].fields() {
+        fb := fieldsB[i]
+        switch {
+        case fa.value == nil && fb.value == nil:
+        case fb.value == nil:
+            onlyInA[fa.name] = fa.value
+        case fa.value == nil:
+            onlyInB[fb.name] = fb.value
+        case fa.value == fb.value:
+            identical = append(identical, fa.name)
+        default:
+            changed[fa.name] = gin.H{"before": fa.value, "after": fb.value}
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "a":                idA,
+        "b":                idB,
+        "identical":        len(changed) == 0 && len(onlyInA) == 0 && len(onlyInB) == 0,
+        "changed":          changed,
+        "only_in_a":        onlyInA,
+        "only_in_b":        onlyInB,
+        "identical_fields": identical,
+    })
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+)
+
+const (
+    compareJobA = "0a1b2c3d-0000-4000-8000-00000000000a"
+    compareJobB = "0a1b2c3d-0000-4000-8000-00000000000b"
+)
+
+func storeCompareJob(id string, fields map[string]interface{}) {
+    job := map[string]interface{}{"schema_version": 1, "id": id, "download_url": "https://example.com/a.stl", "material": "PLA", "infill": 15}
+    for k, v := range fields {
+        job[k] = v
+    }
+    rdb.Set(ctx, "params:"+id, marshalPayload(job), 0)
+}
+
+func TestCompareJobs(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    storeCompareJob(compareJobA, map[string]interface{}{"submit_at": "2026-10-15T09:00:00Z"})
+    storeCompareJob(compareJobB, map[string]interface{}{"infill": 40})
+
+    w := do(r, http.MethodGet, "/jobs/compare?a="+compareJobA+"&b="+compareJobB, "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+    var diff struct {
+        Identical bool                              `json:"identical"`
+        Changed   map[string]map[string]interface{} `json:"changed"`
+        OnlyInA   map[string]interface{}            `json:"only_in_a"`
+        OnlyInB   map[string]interface{}            `json:"only_in_b"`
+        Same      []string                          `json:"identical_fields"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &diff)
+    if diff.Identical || len(diff.Changed) != 1 || diff.Changed["infill"]["before"] != 15.0 || diff.Changed["infill"]["after"] != 40.0 {
+        t.Errorf("changed = %v, want only infill 15 -> 40", diff.Changed)
+    }
+    if len(diff.OnlyInA) != 1 || diff.OnlyInA["submit_at"] != "2026-10-15T09:00:00Z" || len(diff.OnlyInB) != 0 {
+        t.Errorf("only_in_a = %v, only_in_b = %v; want submit_at only in a", diff.OnlyInA, diff.OnlyInB)
+    }
+    if len(diff.Same) == 0 {
+        t.Error("identical_fields is empty")
+    }
+
+    storeCompareJob(compareJobB, map[string]interface{}{"submit_at": "2026-10-15T09:00:00Z"})
+    w = do(r, http.MethodGet, "/jobs/compare?a="+compareJobA+"&b="+compareJobB, "")
+    json.Unmarshal(w.Body.Bytes(), &diff)
+    if !diff.Identical {
+        t.Errorf("identical = false for matching jobs (body %s)", w.Body)
+    }
+}
+
+func TestCompareJobsErrors(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    storeCompareJob(compareJobA, nil)
+    tests := []struct {
+        query string
+        want  int
+    }{
+        {"a=" + compareJobA, http.StatusBadRequest},
+        {"a=" + compareJobA + "&b=not-a-job", http.StatusBadRequest},
+        {"a=" + compareJobA + "&b=" + compareJobB, http.StatusNotFound},
+    }
+    for _, tt := range tests {
+        if w := do(r, http.MethodGet, "/jobs/compare?"+tt.query, ""); w.Code != tt.want {
+            t.Errorf("?%s: status = %d, want %d", tt.query, w.Code, tt.want)
+        }
+    }
+}
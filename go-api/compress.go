@@ -0,0 +1,148 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/andybalholm/brotli"
+    "github.com/gin-gonic/gin"
+)
+
+// Paths that are never compressed: Prometheus scrapes, proxied binary
+// downloads which are already compressed or not worth the CPU, and the log
+// and status event streams, which proxies must pass through line by line.
+var compressExcluded = map[string]bool{
+    "/metrics":             true,
+    "/jobs/:id/result":     true,
+    "/jobs/:id/gcode":      true,
+    "/jobs/:id/thumbnail":  true,
+    "/jobs/:id/logs":       true,
+    "/admin/jobs/:id/logs": true,
+    "/status/:id/stream":   true,
+    "/ws/jobs/:id":         true,
+}
+
+// negotiateEncoding picks br over gzip when the client accepts both.
+func negotiateEncoding(acceptEncoding string) string {
+    accepted := map[string]bool{}
+    for _, part := range strings.Split(acceptEncoding, ",") {
+        name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+        // q=0, q=0.0, q=0.000 all mean "not acceptable"
+        if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+            if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+                continue
+            }
+        }
+        accepted[strings.ToLower(name)] = true
+    }
+    switch {
+    case accepted["br"]:
+        return "br"
+    case accepted["gzip"]:
+        return "gzip"
+    }
+    return ""
+}
+
+// compressWriter buffers the first minBytes of the body; only responses that
+// grow past that are compressed, smaller ones are written through unchanged.
+type compressWriter struct {
+    gin.ResponseWriter
+    encoding string
+    minBytes int
+    buf      bytes.Buffer
+    enc      io.WriteCloser
+    decided  bool
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+    if w.decided {
+        if w.enc != nil {
+            return w.enc.Write(p)
+        }
+        return w.ResponseWriter.Write(p)
+    }
+    w.buf.Write(p)
+    if w.buf.Len() >= w.minBytes {
+        if err := w.start(true); err != nil {
+            return 0, err
+        }
+    }
+    return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+    return w.Write([]byte(s))
+}
+
+// start commits to compressing (or not) and flushes the buffered bytes.
+func (w *compressWriter) start(compress bool) error {
+    w.decided = true
+    // Don't double-encode handlers that set their own Content-Encoding
+    if w.Header().Get("Content-Encoding") != "" {
+        compress = false
+    }
+    if compress {
+        h := w.Header()
+        h.Set("Content-Encoding", w.encoding)
+        h.Add("Vary", "Accept-Encoding")
+        h.Del("Content-Length")
+        if w.encoding == "br" {
+            w.enc = brotli.NewWriter(w.ResponseWriter)
+        } else {
+            w.enc = gzip.NewWriter(w.ResponseWriter)
+        }
+        _, err := w.enc.Write(w.buf.Bytes())
+        w.buf.Reset()
+        return err
+    }
+    _, err := w.ResponseWriter.Write(w.buf.Bytes())
+    w.buf.Reset()
+    return err
+}
+
+// Flush lets streaming handlers push data out; anything still buffered is
+// sent as-is.
+func (w *compressWriter) Flush() {
+    if !w.decided {
+        w.start(false)
+    }
+    if f, ok := w.enc.(interface{ Flush() error }); ok {
+        f.Flush()
+    }
+    w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) close() {
+    if !w.decided {
+        w.start(false)
+    }
+    if w.enc != nil {
+        w.enc.Close()
+    }
+}
+
+// compressMiddleware compresses responses of at least COMPRESS_MIN_BYTES
+// (default 1024) with brotli or gzip, as negotiated via Accept-Encoding.
+// minBytes is read per request, so a reload applies to the next one.
+func compressMiddleware(minBytes func() int) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+        if encoding == "" || c.Request.Method == http.MethodHead || compressExcluded[unversionedPath(c.FullPath())] {
+            c.Next()
+            return
+        }
+
+        w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minBytes: minBytes()}
+        c.Writer = w
+        defer func() {
+            w.close()
+            c.Writer = w.ResponseWriter
+        }()
+        c.Next()
+    }
+}
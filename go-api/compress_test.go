@@ -0,0 +1,102 @@
+package main
+
+import (
+    "compress/gzip"
+    "io"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+    tests := []struct {
+        acceptEncoding string
+        want           string
+    }{
+        {"", ""},
+        {"identity", ""},
+        {"gzip", "gzip"},
+        {"GZIP", "gzip"},
+        {"gzip, br", "br"},
+        {"br;q=0, gzip", "gzip"},
+        {"br; q=0, gzip;q=0.5", "gzip"},
+        {"gzip;q=0", ""},
+        {"gzip;q=0.0, br;q=0.000", ""},
+        {"deflate, gzip;q=0.8", "gzip"},
+    }
+    for _, tt := range tests {
+        if got := negotiateEncoding(tt.acceptEncoding); got != tt.want {
+            t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+        }
+    }
+}
+
+func compressTestRouter(t *testing.T) *gin.Engine {
+    t.Helper()
+    setupTest(t, func(c *Config) { c.CompressMinBytes = 1024 })
+    big := strings.Repeat("sliced layer data ", 200)
+    r := gin.New()
+    r.Use(compressMiddleware(func() int { return cfg().CompressMinBytes }))
+    r.GET("/big", func(c *gin.Context) { c.String(http.StatusOK, big) })
+    r.HEAD("/big", func(c *gin.Context) { c.Status(http.StatusOK) })
+    r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "tiny") })
+    r.GET("/unchanged", func(c *gin.Context) { c.Status(http.StatusNotModified) })
+    r.GET("/jobs/:id/result", func(c *gin.Context) { c.String(http.StatusOK, big) })
+    return r
+}
+
+func TestCompressMiddleware(t *testing.T) {
+    r := compressTestRouter(t)
+    tests := []struct {
+        name, method, path, acceptEncoding string
+        wantEncoding                       string
+    }{
+        {"gzip past the threshold", http.MethodGet, "/big", "gzip", "gzip"},
+        {"br preferred", http.MethodGet, "/big", "gzip, br", "br"},
+        {"refused with q=0", http.MethodGet, "/big", "gzip;q=0", ""},
+        {"below the threshold", http.MethodGet, "/small", "gzip", ""},
+        {"HEAD", http.MethodHead, "/big", "gzip", ""},
+        {"304", http.MethodGet, "/unchanged", "gzip", ""},
+        {"result proxy", http.MethodGet, "/jobs/j1/result", "gzip", ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := do(r, tt.method, tt.path, "", "Accept-Encoding", tt.acceptEncoding)
+            if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+                t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+            }
+            if tt.wantEncoding != "" && !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+                t.Errorf("Vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+            }
+            if tt.path == "/unchanged" && (w.Code != http.StatusNotModified || w.Body.Len() != 0) {
+                t.Errorf("304 came back as %d with %d bytes", w.Code, w.Body.Len())
+            }
+        })
+    }
+}
+
+func TestCompressThresholdFollowsReloads(t *testing.T) {
+    r := compressTestRouter(t)
+    next := *cfg()
+    next.CompressMinBytes = 1 << 20
+    setConfig(&next)
+    if got := do(r, http.MethodGet, "/big", "", "Accept-Encoding", "gzip").Header().Get("Content-Encoding"); got != "" {
+        t.Errorf("Content-Encoding = %q under a raised threshold, want none", got)
+    }
+}
+
+func TestCompressMiddlewareGzipRoundTrip(t *testing.T) {
+    r := compressTestRouter(t)
+    plain := do(r, http.MethodGet, "/big", "")
+    w := do(r, http.MethodGet, "/big", "", "Accept-Encoding", "gzip")
+    zr, err := gzip.NewReader(w.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, _ := io.ReadAll(zr)
+    if string(body) != plain.Body.String() || w.Body.Len() >= plain.Body.Len() {
+        t.Fatalf("gzip body decodes to %d bytes (want %d), sent %d", len(body), plain.Body.Len(), w.Body.Len())
+    }
+}
@@ -0,0 +1,694 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "net/mail"
+    "net/url"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/goccy/go-yaml"
+    "github.com/kelseyhightower/envconfig"
+)
+
+// Config holds every setting the API reads. Values come from the defaults
+// below, then config.yaml (or CONFIG_FILE), then matching env vars.
+type Config struct {
+    RedisURL   string `yaml:"redis_url" envconfig:"REDIS_URL"`
+    AdminToken string `yaml:"admin_token" envconfig:"ADMIN_TOKEN"`
+    // Shared with workers to sign /internal requests
+    InternalSecret string `yaml:"internal_secret" envconfig:"INTERNAL_SECRET"`
+    // API keys for /quote and /upload as key -> name; owner_id is "apikey:<name>"
+    APIKeys map[string]string `yaml:"api_keys" envconfig:"API_KEYS"`
+    // Signs the CSRF cookie; 32 bytes, raw or hex-encoded
+    CSRFAuthKey string `yaml:"csrf_auth_key" envconfig:"CSRF_AUTH_KEY"`
+
+    // OAuth2 login for the web UI (github or google), off when unset
+    OAuth2Provider     string `yaml:"oauth2_provider" envconfig:"OAUTH2_PROVIDER"`
+    OAuth2ClientID     string `yaml:"oauth2_client_id" envconfig:"OAUTH2_CLIENT_ID"`
+    OAuth2ClientSecret string `yaml:"oauth2_client_secret" envconfig:"OAUTH2_CLIENT_SECRET"`
+    OAuth2RedirectURL  string `yaml:"oauth2_redirect_url" envconfig:"OAUTH2_REDIRECT_URL"`
+    // Signs session tokens
+    SessionSecret string `yaml:"session_secret" envconfig:"SESSION_SECRET"`
+
+    // Client IP filtering, comma-separated CIDRs; blocking wins
+    AllowedIPs []string `yaml:"allowed_ips" envconfig:"ALLOWED_IPS"`
+    BlockedIPs []string `yaml:"blocked_ips" envconfig:"BLOCKED_IPS"`
+    // Proxies whose X-Forwarded-For is believed; empty means the client IP
+    // is always the connection's peer address
+    TrustedProxies []string `yaml:"trusted_proxies" envconfig:"TRUSTED_PROXIES"`
+
+    // Lock an IP out after this many consecutive failed auth checks
+    AuthLockoutThreshold       int `yaml:"auth_lockout_threshold" envconfig:"AUTH_LOCKOUT_THRESHOLD"`
+    AuthLockoutDurationMinutes int `yaml:"auth_lockout_duration_minutes" envconfig:"AUTH_LOCKOUT_DURATION_MINUTES"`
+    // ...and a credential after this many failures from any IPs
+    AuthAccountLockoutThreshold int `yaml:"auth_account_lockout_threshold" envconfig:"AUTH_ACCOUNT_LOCKOUT_THRESHOLD"`
+
+    // Queueing
+    // Material -> list, e.g. TPU:print_jobs_flex,default:print_jobs
+    QueueMap    map[string]string `yaml:"queue_map" envconfig:"QUEUE_MAP"`
+    SingleQueue bool              `yaml:"single_queue" envconfig:"SINGLE_QUEUE"`
+    // Round-robin new submissions across submitters; false is plain FIFO
+    FairScheduling bool `yaml:"fair_scheduling" envconfig:"FAIR_SCHEDULING"`
+    // Send jobs that name a region to that region's lists, e.g. print_jobs:eu
+    RegionRoutingEnabled bool `yaml:"region_routing_enabled" envconfig:"REGION_ROUTING_ENABLED"`
+    // Gzip queued payloads past this size; turn off while old workers remain
+    PayloadCompression      bool `yaml:"payload_compression" envconfig:"PAYLOAD_COMPRESSION"`
+    PayloadCompressMinBytes int  `yaml:"payload_compress_min_bytes" envconfig:"PAYLOAD_COMPRESS_MIN_BYTES"`
+    FairDispatchBuffer      int  `yaml:"fair_dispatch_buffer" envconfig:"FAIR_DISPATCH_BUFFER"`
+    // Where jobs are handed to workers: redis (streams and lists). nats
+    // (JetStream, configured by the NATS settings) is rejected for now
+    QueueBackend      string `yaml:"queue_backend" envconfig:"QUEUE_BACKEND"`
+    NATSURL           string `yaml:"nats_url" envconfig:"NATS_URL"`
+    NATSStream        string `yaml:"nats_stream" envconfig:"NATS_STREAM"`
+    NATSSubjectPrefix string `yaml:"nats_subject_prefix" envconfig:"NATS_SUBJECT_PREFIX"`
+    // limits, workqueue or interest
+    NATSRetention   string `yaml:"nats_retention" envconfig:"NATS_RETENTION"`
+    NATSReplicas    int    `yaml:"nats_replicas" envconfig:"NATS_REPLICAS"`
+    NATSMaxAgeHours int    `yaml:"nats_max_age_hours" envconfig:"NATS_MAX_AGE_HOURS"`
+    // Standard jobs waiting longer than this move to the rush list (0 disables)
+    AgingThresholdSeconds    int  `yaml:"aging_threshold_seconds" envconfig:"AGING_THRESHOLD_SECONDS"`
+    LegacyListQueue          bool `yaml:"legacy_list_queue" envconfig:"LEGACY_LIST_QUEUE"`
+    VisibilityTimeoutSeconds int  `yaml:"visibility_timeout_seconds" envconfig:"VISIBILITY_TIMEOUT_SECONDS"`
+    ReaperIntervalSeconds    int  `yaml:"reaper_interval_seconds" envconfig:"REAPER_INTERVAL_SECONDS"`
+    MaxAttempts              int  `yaml:"max_attempts" envconfig:"MAX_ATTEMPTS"`
+    DLQTTLHours              int  `yaml:"dlq_ttl_hours" envconfig:"DLQ_TTL_HOURS"`
+    DefaultMaxRetries        int  `yaml:"default_max_retries" envconfig:"DEFAULT_MAX_RETRIES"`
+    MaxRetriesCap            int  `yaml:"max_retries_cap" envconfig:"MAX_RETRIES_CAP"`
+    RetryBaseDelaySeconds    int  `yaml:"retry_base_delay_seconds" envconfig:"RETRY_BASE_DELAY_SECONDS"`
+    // How often POST /jobs/:id/retry may resubmit the same original job
+    MaxManualRetries int `yaml:"max_manual_retries" envconfig:"MAX_MANUAL_RETRIES"`
+    // Failures with error_code download_failed are retried with backoff up
+    // to MaxDownloadRetries times, or the job's max_retries if lower
+    DownloadRetryEnabled bool `yaml:"download_retry_enabled" envconfig:"DOWNLOAD_RETRY_ENABLED"`
+    MaxDownloadRetries   int  `yaml:"max_download_retries" envconfig:"MAX_DOWNLOAD_RETRIES"`
+    // How far ahead submit_at may be
+    ScheduleHorizonHours int `yaml:"schedule_horizon_hours" envconfig:"SCHEDULE_HORIZON_HOURS"`
+    // Lifetime of POST /jobs/:id/share links, and the key that signs them;
+    // share links are off without one
+    ShareLinkExpiryHours int    `yaml:"share_link_expiry_hours" envconfig:"SHARE_LINK_EXPIRY_HOURS"`
+    ShareSecret          string `yaml:"share_secret" envconfig:"SHARE_SECRET"`
+    // How long successful results are reused for identical requests; 0 disables
+    SliceCacheTTLHours int `yaml:"slice_cache_ttl_hours" envconfig:"SLICE_CACHE_TTL_HOURS"`
+    // How long a finished job is kept, completed or otherwise, and how far
+    // past its finish POST /jobs/:id/extend may keep it
+    ResultTTLCompletedHours int `yaml:"result_ttl_completed_hours" envconfig:"RESULT_TTL_COMPLETED_HOURS"`
+    ResultTTLFailedHours    int `yaml:"result_ttl_failed_hours" envconfig:"RESULT_TTL_FAILED_HOURS"`
+    ResultTTLMaxHours       int `yaml:"result_ttl_max_hours" envconfig:"RESULT_TTL_MAX_HOURS"`
+    // Identical submissions from one caller this close together return the
+    // first job; 0 disables
+    DuplicateWindowSeconds int `yaml:"duplicate_window_seconds" envconfig:"DUPLICATE_WINDOW_SECONDS"`
+    // Refuse submissions once no worker heartbeat has been seen for this
+    // long; 0 keeps accepting them
+    WorkerAbsentGraceSeconds int `yaml:"worker_absent_grace_seconds" envconfig:"WORKER_ABSENT_GRACE_SECONDS"`
+    // Refuse submissions with 503 unless a live registered worker can slice
+    // them, rather than queueing by QUEUE_MAP while none are registered
+    RequireCapableWorker bool `yaml:"require_capable_worker" envconfig:"REQUIRE_CAPABLE_WORKER"`
+    // Rush jobs should complete within this long of created_at, which
+    // GET /admin/reports/sla measures
+    RushSLAMinutes int `yaml:"rush_sla_minutes" envconfig:"RUSH_SLA_MINUTES"`
+    // Every HEARTBEAT_CHECK_INTERVAL_SECONDS, workers silent for the
+    // heartbeat timeout are marked stale, and those silent for the dead
+    // timeout dead, their jobs handed back to the queue
+    HeartbeatCheckIntervalSeconds int `yaml:"heartbeat_check_interval_seconds" envconfig:"HEARTBEAT_CHECK_INTERVAL_SECONDS"`
+    WorkerHeartbeatTimeoutSeconds int `yaml:"worker_heartbeat_timeout_seconds" envconfig:"WORKER_HEARTBEAT_TIMEOUT_SECONDS"`
+    WorkerDeadTimeoutSeconds      int `yaml:"worker_dead_timeout_seconds" envconfig:"WORKER_DEAD_TIMEOUT_SECONDS"`
+    // /health/ready gives each dependency this long to answer and reuses its
+    // verdict for ReadinessCacheSeconds; 0 checks on every probe
+    ReadinessCheckTimeoutMS int `yaml:"readiness_check_timeout_ms" envconfig:"READINESS_CHECK_TIMEOUT_MS"`
+    ReadinessCacheSeconds   int `yaml:"readiness_cache_seconds" envconfig:"READINESS_CACHE_SECONDS"`
+    // Invoices from /jobs/:id/invoice are due this many days after issue
+    InvoiceDueDays int `yaml:"invoice_due_days" envconfig:"INVOICE_DUE_DAYS"`
+    // /quote/estimate leaves out its orientation advice when working it out
+    // takes longer than this; 0 leaves it out always
+    OrientationTimeoutMS int `yaml:"orientation_timeout_ms" envconfig:"ORIENTATION_TIMEOUT_MS"`
+
+    // Jobs still "processing" after this long are failed with reason "timeout"
+    ProcessingDeadlineSeconds      int `yaml:"processing_deadline_seconds" envconfig:"PROCESSING_DEADLINE_SECONDS"`
+    ProcessingDeadlinePerMBSeconds int `yaml:"processing_deadline_per_mb_seconds" envconfig:"PROCESSING_DEADLINE_PER_MB_SECONDS"`
+
+    // Backpressure: warn in the 202 past QueueWarnDepth, 503 past
+    // QueueRejectDepth (0 disables either)
+    QueueWarnDepth        int `yaml:"queue_warn_depth" envconfig:"QUEUE_WARN_DEPTH"`
+    QueueRejectDepth      int `yaml:"queue_reject_depth" envconfig:"QUEUE_REJECT_DEPTH"`
+    EstimatedSliceSeconds int `yaml:"estimated_slice_seconds" envconfig:"ESTIMATED_SLICE_SECONDS"`
+
+    // Returned by /quote and /upload while intake is paused via /admin/queue/pause
+    PausedMessage           string `yaml:"paused_message" envconfig:"PAUSED_MESSAGE"`
+    PausedRetryAfterSeconds int    `yaml:"paused_retry_after_seconds" envconfig:"PAUSED_RETRY_AFTER_SECONDS"`
+
+    // Approximate cap on the audit:events stream
+    AuditStreamMaxLen int `yaml:"audit_stream_maxlen" envconfig:"AUDIT_STREAM_MAXLEN"`
+
+    // HTTP
+    HSTSMaxAgeSeconds    int    `yaml:"hsts_max_age_seconds" envconfig:"HSTS_MAX_AGE_SECONDS"`
+    CSP                  string `yaml:"csp" envconfig:"CSP"`
+    CompressMinBytes     int    `yaml:"compress_min_bytes" envconfig:"COMPRESS_MIN_BYTES"`
+    UploadTimeoutSeconds int    `yaml:"upload_timeout_seconds" envconfig:"UPLOAD_TIMEOUT_SECONDS"`
+    APITimeoutSeconds    int    `yaml:"api_timeout_seconds" envconfig:"API_TIMEOUT_SECONDS"`
+    MaxConcurrentUploads int    `yaml:"max_concurrent_uploads" envconfig:"MAX_CONCURRENT_UPLOADS"`
+    // Where the gRPC PrintJobService listens; empty turns it off
+    GRPCAddr string `yaml:"grpc_addr" envconfig:"GRPC_ADDR"`
+    // Where /upload keeps models: tmpfiles (tmpfiles.org) or local
+    // (LOCAL_STORAGE_PATH, served at HOST/files/)
+    StorageBackend   string `yaml:"storage_backend" envconfig:"STORAGE_BACKEND"`
+    LocalStoragePath string `yaml:"local_storage_path" envconfig:"LOCAL_STORAGE_PATH"`
+    // The server's external base URL, which workers download local files from
+    Host           string `yaml:"host" envconfig:"HOST"`
+    MaxUploadBytes int64  `yaml:"max_upload_bytes" envconfig:"MAX_UPLOAD_BYTES"`
+    // Largest job thumbnail a worker may store
+    ThumbnailMaxBytes int64 `yaml:"thumbnail_max_bytes" envconfig:"THUMBNAIL_MAX_BYTES"`
+    // How much slicer output GET /jobs/:id/logs returns as JSON
+    LogTailBytes int `yaml:"log_tail_bytes" envconfig:"LOG_TAIL_BYTES"`
+    // Let webhooks reach loopback and private addresses (local development)
+    WebhookAllowPrivate bool `yaml:"webhook_allow_private" envconfig:"WEBHOOK_ALLOW_PRIVATE"`
+    // Signs webhooks and callbacks that have no secret of their own
+    WebhookSecret string `yaml:"webhook_secret" envconfig:"WEBHOOK_SECRET"`
+    // Accept a callback_url with no secret at all to sign it with
+    WebhookAllowUnsigned bool `yaml:"webhook_allow_unsigned" envconfig:"WEBHOOK_ALLOW_UNSIGNED"`
+    // Webhook and callback deliveries are tried this many times, the
+    // retries WebhookRetryBaseSeconds apart, doubling each time
+    WebhookMaxAttempts      int `yaml:"webhook_max_attempts" envconfig:"WEBHOOK_MAX_ATTEMPTS"`
+    WebhookRetryBaseSeconds int `yaml:"webhook_retry_base_seconds" envconfig:"WEBHOOK_RETRY_BASE_SECONDS"`
+    // The mail server notify_email messages go out through; without
+    // SMTPHost they aren't sent at all
+    SMTPHost     string `yaml:"smtp_host" envconfig:"SMTP_HOST"`
+    SMTPPort     int    `yaml:"smtp_port" envconfig:"SMTP_PORT"`
+    SMTPUsername string `yaml:"smtp_username" envconfig:"SMTP_USERNAME"`
+    SMTPPassword string `yaml:"smtp_password" envconfig:"SMTP_PASSWORD"`
+    // The sender, e.g. "Print Shop <quotes@example.com>"
+    SMTPFrom string `yaml:"smtp_from" envconfig:"SMTP_FROM"`
+    // Incoming webhooks operators are posted job events on, ChatEvents of
+    // them; past ChatMaxPerMinute a minute the rest are summed up in one
+    // message, and 0 posts them all
+    SlackWebhookURL   string   `yaml:"slack_webhook_url" envconfig:"SLACK_WEBHOOK_URL"`
+    DiscordWebhookURL string   `yaml:"discord_webhook_url" envconfig:"DISCORD_WEBHOOK_URL"`
+    ChatEvents        []string `yaml:"chat_events" envconfig:"CHAT_EVENTS"`
+    ChatMaxPerMinute  int      `yaml:"chat_max_per_minute" envconfig:"CHAT_MAX_PER_MINUTE"`
+}
+
+// The effective configuration, set in main before anything else and
+// replaced whole by a reload; see reload.go.
+var (
+    configMu     sync.RWMutex
+    activeConfig *Config
+)
+
+// cfg returns the active configuration. A reload swaps in a new Config
+// rather than changing this one, so the fields of what it returns stay
+// consistent for as long as the caller holds on to it.
+func cfg() *Config {
+    configMu.RLock()
+    defer configMu.RUnlock()
+    return activeConfig
+}
+
+func setConfig(c *Config) {
+    configMu.Lock()
+    activeConfig = c
+    configMu.Unlock()
+}
+
+func defaultConfig() *Config {
+    return &Config{
+        AuthLockoutThreshold:        10,
+        AuthLockoutDurationMinutes:  30,
+        AuthAccountLockoutThreshold: 100,
+
+        LegacyListQueue:               true,
+        QueueBackend:                  queueBackendRedis,
+        NATSURL:                       "nats://localhost:4222",
+        NATSStream:                    "PRINT_JOBS",
+        NATSSubjectPrefix:             "jobs",
+        NATSRetention:                 "workqueue",
+        NATSReplicas:                  1,
+        NATSMaxAgeHours:               24,
+        FairScheduling:                true,
+        FairDispatchBuffer:            2,
+        PayloadCompression:            true,
+        PayloadCompressMinBytes:       1024,
+        AgingThresholdSeconds:         7200,
+        VisibilityTimeoutSeconds:      3900,
+        ReaperIntervalSeconds:         30,
+        MaxAttempts:                   3,
+        DLQTTLHours:                   168,
+        DefaultMaxRetries:             2,
+        MaxRetriesCap:                 5,
+        RetryBaseDelaySeconds:         30,
+        MaxManualRetries:              3,
+        DownloadRetryEnabled:          true,
+        MaxDownloadRetries:            3,
+        ScheduleHorizonHours:          168,
+        ShareLinkExpiryHours:          72,
+        SliceCacheTTLHours:            168,
+        ResultTTLCompletedHours:       24,
+        ResultTTLFailedHours:          24,
+        ResultTTLMaxHours:             720,
+        RushSLAMinutes:                60,
+        HeartbeatCheckIntervalSeconds: 30,
+        WorkerHeartbeatTimeoutSeconds: 90,
+        WorkerDeadTimeoutSeconds:      600,
+        DuplicateWindowSeconds:        60,
+        InvoiceDueDays:                30,
+        OrientationTimeoutMS:          1000,
+        ReadinessCheckTimeoutMS:       500,
+        ReadinessCacheSeconds:         5,
+
+        ProcessingDeadlineSeconds:      3600,
+        ProcessingDeadlinePerMBSeconds: 30,
+        QueueWarnDepth:                 200,
+        QueueRejectDepth:               1000,
+        EstimatedSliceSeconds:          120,
+        PausedMessage:                  "Job intake is paused for maintenance, please try again later",
+        PausedRetryAfterSeconds:        300,
+
+        AuditStreamMaxLen:    100000,
+        HSTSMaxAgeSeconds:    31536000,
+        CSP:                  defaultCSP,
+        CompressMinBytes:     1024,
+        UploadTimeoutSeconds: 120,
+        APITimeoutSeconds:    10,
+        MaxConcurrentUploads: 10,
+        GRPCAddr:             ":50051",
+        StorageBackend:       storageTmpfiles,
+        LocalStoragePath:     "/tmp/prusaslicer-rpc/uploads",
+        Host:                 "http://localhost:8000",
+        MaxUploadBytes:       100 << 20,
+        ThumbnailMaxBytes:    256 << 10,
+        LogTailBytes:         64 << 10,
+
+        WebhookMaxAttempts:      5,
+        WebhookRetryBaseSeconds: 30,
+        SMTPPort:                587,
+        ChatEvents:              []string{"job.failed"},
+        ChatMaxPerMinute:        10,
+    }
+}
+
+// Env vars that are no longer read, and what replaced them.
+var deprecatedEnv = map[string]string{
+    "REDIS_ADDR": "REDIS_URL (e.g. redis://redis:6379)",
+}
+
+// LoadConfig reads the YAML file at path and overlays environment variables.
+// A missing file is only an error when it was asked for via CONFIG_FILE.
+func LoadConfig(path string) (*Config, error) {
+    c := defaultConfig()
+
+    data, err := os.ReadFile(path)
+    switch {
+    case err == nil:
+        if err := yaml.Unmarshal(data, c); err != nil {
+            return nil, fmt.Errorf("parse %s: %w", path, err)
+        }
+    case errors.Is(err, os.ErrNotExist) && os.Getenv("CONFIG_FILE") == "":
+        // No config file, env vars and defaults only
+    default:
+        return nil, err
+    }
+
+    if err := envconfig.Process("", c); err != nil {
+        return nil, err
+    }
+
+    for name, replacement := range deprecatedEnv {
+        if os.Getenv(name) != "" {
+            log.Printf("WARNING: %s is deprecated and ignored, use %s", name, replacement)
+        }
+    }
+
+    return c, c.Validate()
+}
+
+// Validate rejects values the API can't run with.
+func (c *Config) Validate() error {
+    if c.RedisURL != "" {
+        if _, err := url.Parse(c.RedisURL); err != nil {
+            return fmt.Errorf("redis_url: %w", err)
+        }
+    }
+    if c.CSRFAuthKey != "" && len(c.CSRFAuthKey) != 32 && len(c.CSRFAuthKey) != 64 {
+        return fmt.Errorf("csrf_auth_key must be 32 bytes or 64 hex characters")
+    }
+    if _, err := parseIPNets(c.AllowedIPs); err != nil {
+        return fmt.Errorf("allowed_ips: %w", err)
+    }
+    if _, err := parseIPNets(c.BlockedIPs); err != nil {
+        return fmt.Errorf("blocked_ips: %w", err)
+    }
+    if _, err := parseIPNets(c.TrustedProxies); err != nil {
+        return fmt.Errorf("trusted_proxies: %w", err)
+    }
+    switch c.QueueBackend {
+    case queueBackendRedis:
+    case queueBackendNATS:
+        // Cancelling, positions, backpressure, fair dispatch and aging all
+        // read the Redis queues, and the bundled worker only reads those
+        return fmt.Errorf("queue_backend nats is not supported yet; use redis")
+    default:
+        return fmt.Errorf("queue_backend must be redis, got %q", c.QueueBackend)
+    }
+    if _, ok := natsRetentions[c.NATSRetention]; !ok {
+        return fmt.Errorf("nats_retention must be limits, workqueue or interest, got %q", c.NATSRetention)
+    }
+    if c.NATSReplicas < 1 || c.NATSReplicas > 5 {
+        return fmt.Errorf("nats_replicas must be from 1 to 5")
+    }
+    if c.NATSStream == "" || strings.ContainsAny(c.NATSStream, ".*> ") {
+        return fmt.Errorf("nats_stream must be a name without dots, wildcards or spaces")
+    }
+    if c.NATSSubjectPrefix == "" || strings.ContainsAny(c.NATSSubjectPrefix, "*> ") {
+        return fmt.Errorf("nats_subject_prefix must be a subject without wildcards or spaces")
+    }
+    if c.GRPCAddr != "" {
+        if _, _, err := net.SplitHostPort(c.GRPCAddr); err != nil {
+            return fmt.Errorf("grpc_addr: %w", err)
+        }
+    }
+    if c.StorageBackend != storageTmpfiles && c.StorageBackend != storageLocal {
+        return fmt.Errorf("storage_backend must be tmpfiles or local, got %q", c.StorageBackend)
+    }
+    if c.StorageBackend == storageLocal {
+        if c.LocalStoragePath == "" {
+            return fmt.Errorf("local_storage_path is required with storage_backend local")
+        }
+        if u, err := url.Parse(c.Host); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return fmt.Errorf("host must be an http or https URL, got %q", c.Host)
+        }
+    }
+    if c.LogTailBytes <= 0 {
+        return fmt.Errorf("log_tail_bytes must be positive, got %d", c.LogTailBytes)
+    }
+    if c.MaxUploadBytes <= 0 {
+        return fmt.Errorf("max_upload_bytes must be positive")
+    }
+    if c.ThumbnailMaxBytes <= 0 {
+        return fmt.Errorf("thumbnail_max_bytes must be positive, got %d", c.ThumbnailMaxBytes)
+    }
+    if c.OAuth2Provider != "" {
+        if _, ok := oauthProviders[c.OAuth2Provider]; !ok {
+            return fmt.Errorf("oauth2_provider must be github or google, got %q", c.OAuth2Provider)
+        }
+        if c.OAuth2ClientID == "" || c.OAuth2ClientSecret == "" {
+            return fmt.Errorf("oauth2_provider is set but oauth2_client_id/oauth2_client_secret are missing")
+        }
+    }
+    positive := map[string]int{
+        "visibility_timeout_seconds":     c.VisibilityTimeoutSeconds,
+        "reaper_interval_seconds":        c.ReaperIntervalSeconds,
+        "nats_max_age_hours":             c.NATSMaxAgeHours,
+        "max_attempts":                   c.MaxAttempts,
+        "dlq_ttl_hours":                  c.DLQTTLHours,
+        "retry_base_delay_seconds":       c.RetryBaseDelaySeconds,
+        "schedule_horizon_hours":         c.ScheduleHorizonHours,
+        "share_link_expiry_hours":        c.ShareLinkExpiryHours,
+        "processing_deadline_seconds":    c.ProcessingDeadlineSeconds,
+        "upload_timeout_seconds":         c.UploadTimeoutSeconds,
+        "api_timeout_seconds":            c.APITimeoutSeconds,
+        "max_concurrent_uploads":         c.MaxConcurrentUploads,
+        "fair_dispatch_buffer":           c.FairDispatchBuffer,
+        "auth_lockout_threshold":         c.AuthLockoutThreshold,
+        "auth_lockout_duration_minutes":  c.AuthLockoutDurationMinutes,
+        "auth_account_lockout_threshold": c.AuthAccountLockoutThreshold,
+        "estimated_slice_seconds":        c.EstimatedSliceSeconds,
+        "paused_retry_after_seconds":     c.PausedRetryAfterSeconds,
+        "audit_stream_maxlen":            c.AuditStreamMaxLen,
+    }
+    for name, v := range positive {
+        if v <= 0 {
+            return fmt.Errorf("%s must be positive, got %d", name, v)
+        }
+    }
+    if c.MaxManualRetries < 0 {
+        return fmt.Errorf("max_manual_retries must not be negative, got %d", c.MaxManualRetries)
+    }
+    if c.MaxDownloadRetries < 0 {
+        return fmt.Errorf("max_download_retries must not be negative, got %d", c.MaxDownloadRetries)
+    }
+    if c.DefaultMaxRetries < 0 || c.DefaultMaxRetries > c.MaxRetriesCap {
+        return fmt.Errorf("default_max_retries must be between 0 and max_retries_cap (%d), got %d", c.MaxRetriesCap, c.DefaultMaxRetries)
+    }
+    // A slice that is merely slow must hit its deadline before the reaper
+    // takes it for a crash, or it is sliced twice
+    if c.VisibilityTimeoutSeconds <= c.ProcessingDeadlineSeconds {
+        return fmt.Errorf("visibility_timeout_seconds (%d) must exceed processing_deadline_seconds (%d)", c.VisibilityTimeoutSeconds, c.ProcessingDeadlineSeconds)
+    }
+    if c.ProcessingDeadlinePerMBSeconds < 0 {
+        return fmt.Errorf("processing_deadline_per_mb_seconds must not be negative, got %d", c.ProcessingDeadlinePerMBSeconds)
+    }
+    if c.QueueWarnDepth < 0 || c.QueueRejectDepth < 0 {
+        return fmt.Errorf("queue_warn_depth and queue_reject_depth must not be negative")
+    }
+    if c.QueueRejectDepth > 0 && c.QueueWarnDepth > c.QueueRejectDepth {
+        return fmt.Errorf("queue_warn_depth (%d) must not exceed queue_reject_depth (%d)", c.QueueWarnDepth, c.QueueRejectDepth)
+    }
+    if c.PayloadCompressMinBytes < 0 {
+        return fmt.Errorf("payload_compress_min_bytes must not be negative, got %d", c.PayloadCompressMinBytes)
+    }
+    if c.SliceCacheTTLHours < 0 {
+        return fmt.Errorf("slice_cache_ttl_hours must not be negative, got %d", c.SliceCacheTTLHours)
+    }
+    if c.ResultTTLCompletedHours <= 0 || c.ResultTTLFailedHours <= 0 {
+        return fmt.Errorf("result_ttl_completed_hours and result_ttl_failed_hours must be positive")
+    }
+    if c.ResultTTLMaxHours < c.ResultTTLCompletedHours || c.ResultTTLMaxHours < c.ResultTTLFailedHours {
+        return fmt.Errorf("result_ttl_max_hours (%d) must be at least result_ttl_completed_hours and result_ttl_failed_hours", c.ResultTTLMaxHours)
+    }
+    if c.DuplicateWindowSeconds < 0 {
+        return fmt.Errorf("duplicate_window_seconds must not be negative, got %d", c.DuplicateWindowSeconds)
+    }
+    if c.RushSLAMinutes <= 0 {
+        return fmt.Errorf("rush_sla_minutes must be positive, got %d", c.RushSLAMinutes)
+    }
+    if c.HeartbeatCheckIntervalSeconds <= 0 || c.WorkerHeartbeatTimeoutSeconds <= 0 {
+        return fmt.Errorf("heartbeat_check_interval_seconds and worker_heartbeat_timeout_seconds must be positive")
+    }
+    if c.WorkerDeadTimeoutSeconds <= c.WorkerHeartbeatTimeoutSeconds {
+        return fmt.Errorf("worker_dead_timeout_seconds (%d) must exceed worker_heartbeat_timeout_seconds (%d)", c.WorkerDeadTimeoutSeconds, c.WorkerHeartbeatTimeoutSeconds)
+    }
+    if c.WorkerAbsentGraceSeconds < 0 {
+        return fmt.Errorf("worker_absent_grace_seconds must not be negative, got %d", c.WorkerAbsentGraceSeconds)
+    }
+    if c.WebhookMaxAttempts < 1 {
+        return fmt.Errorf("webhook_max_attempts must be at least 1, got %d", c.WebhookMaxAttempts)
+    }
+    if c.WebhookRetryBaseSeconds <= 0 {
+        return fmt.Errorf("webhook_retry_base_seconds must be positive, got %d", c.WebhookRetryBaseSeconds)
+    }
+    if c.SMTPHost != "" {
+        if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+            return fmt.Errorf("smtp_port must be between 1 and 65535, got %d", c.SMTPPort)
+        }
+        if _, err := mail.ParseAddress(c.SMTPFrom); err != nil {
+            return fmt.Errorf("smtp_host is set but smtp_from %q is not an address: %v", c.SMTPFrom, err)
+        }
+    }
+    for name, raw := range map[string]string{"slack_webhook_url": c.SlackWebhookURL, "discord_webhook_url": c.DiscordWebhookURL} {
+        if u, err := url.Parse(raw); raw != "" && (err != nil || u.Scheme != "https" || u.Host == "") {
+            return fmt.Errorf("%s must be an https URL", name)
+        }
+    }
+    for _, e := range c.ChatEvents {
+        if !subscriptionEvents[e] {
+            return fmt.Errorf("chat_events: unknown event %q", e)
+        }
+    }
+    if c.ChatMaxPerMinute < 0 {
+        return fmt.Errorf("chat_max_per_minute must not be negative, got %d", c.ChatMaxPerMinute)
+    }
+    if c.ReadinessCheckTimeoutMS <= 0 {
+        return fmt.Errorf("readiness_check_timeout_ms must be positive, got %d", c.ReadinessCheckTimeoutMS)
+    }
+    if c.OrientationTimeoutMS < 0 {
+        return fmt.Errorf("orientation_timeout_ms must not be negative, got %d", c.OrientationTimeoutMS)
+    }
+    if c.ReadinessCacheSeconds < 0 {
+        return fmt.Errorf("readiness_cache_seconds must not be negative, got %d", c.ReadinessCacheSeconds)
+    }
+    if c.InvoiceDueDays < 0 {
+        return fmt.Errorf("invoice_due_days must not be negative, got %d", c.InvoiceDueDays)
+    }
+    if c.AgingThresholdSeconds < 0 {
+        return fmt.Errorf("aging_threshold_seconds must not be negative, got %d", c.AgingThresholdSeconds)
+    }
+    if c.HSTSMaxAgeSeconds < 0 {
+        return fmt.Errorf("hsts_max_age_seconds must not be negative, got %d", c.HSTSMaxAgeSeconds)
+    }
+    for material, q := range c.QueueMap {
+        if q == "" || strings.HasSuffix(q, ":rush") || q == processingQueue {
+            return fmt.Errorf("queue_map: %q maps to unusable list %q", material, q)
+        }
+    }
+    if c.CompressMinBytes < 0 {
+        return fmt.Errorf("compress_min_bytes must not be negative, got %d", c.CompressMinBytes)
+    }
+    return nil
+}
+
+// Masked returns a copy that is safe to log.
+func (c Config) Masked() Config {
+    if c.AdminToken != "" {
+        c.AdminToken = "****"
+    }
+    if c.InternalSecret != "" {
+        c.InternalSecret = "****"
+    }
+    if c.OAuth2ClientSecret != "" {
+        c.OAuth2ClientSecret = "****"
+    }
+    if c.CSRFAuthKey != "" {
+        c.CSRFAuthKey = "****"
+    }
+    if c.SessionSecret != "" {
+        c.SessionSecret = "****"
+    }
+    if c.ShareSecret != "" {
+        c.ShareSecret = "****"
+    }
+    if c.WebhookSecret != "" {
+        c.WebhookSecret = "****"
+    }
+    if c.SMTPPassword != "" {
+        c.SMTPPassword = "****"
+    }
+    // The path is the webhook's secret
+    if c.SlackWebhookURL != "" {
+        c.SlackWebhookURL = "****"
+    }
+    if c.DiscordWebhookURL != "" {
+        c.DiscordWebhookURL = "****"
+    }
+    if len(c.APIKeys) > 0 {
+        masked := make(map[string]string, len(c.APIKeys))
+        for _, name := range c.APIKeys {
+            masked["****"+name] = name
+        }
+        c.APIKeys = masked
+    }
+    if u, err := url.Parse(c.RedisURL); err == nil && u.User != nil {
+        u.User = url.UserPassword(u.User.Username(), "****")
+        c.RedisURL = u.String()
+    }
+    if u, err := url.Parse(c.NATSURL); err == nil && u.User != nil {
+        u.User = url.UserPassword(u.User.Username(), "****")
+        c.NATSURL = u.String()
+    }
+    return c
+}
+
+func (c *Config) VisibilityTimeout() time.Duration {
+    return time.Duration(c.VisibilityTimeoutSeconds) * time.Second
+}
+
+func (c *Config) ReaperInterval() time.Duration {
+    return time.Duration(c.ReaperIntervalSeconds) * time.Second
+}
+
+func (c *Config) DLQTTL() time.Duration {
+    return time.Duration(c.DLQTTLHours) * time.Hour
+}
+
+func (c *Config) NATSMaxAge() time.Duration {
+    return time.Duration(c.NATSMaxAgeHours) * time.Hour
+}
+
+func (c *Config) UploadTimeout() time.Duration {
+    return time.Duration(c.UploadTimeoutSeconds) * time.Second
+}
+
+func (c *Config) APITimeout() time.Duration {
+    return time.Duration(c.APITimeoutSeconds) * time.Second
+}
+
+func (c *Config) RetryBaseDelay() time.Duration {
+    return time.Duration(c.RetryBaseDelaySeconds) * time.Second
+}
+
+func (c *Config) ProcessingDeadline() time.Duration {
+    return time.Duration(c.ProcessingDeadlineSeconds) * time.Second
+}
+
+func (c *Config) ProcessingDeadlinePerMB() time.Duration {
+    return time.Duration(c.ProcessingDeadlinePerMBSeconds) * time.Second
+}
+
+func (c *Config) EstimatedSliceTime() time.Duration {
+    return time.Duration(c.EstimatedSliceSeconds) * time.Second
+}
+
+func (c *Config) ScheduleHorizon() time.Duration {
+    return time.Duration(c.ScheduleHorizonHours) * time.Hour
+}
+
+func (c *Config) AuthLockoutDuration() time.Duration {
+    return time.Duration(c.AuthLockoutDurationMinutes) * time.Minute
+}
+
+func (c *Config) AgingThreshold() time.Duration {
+    return time.Duration(c.AgingThresholdSeconds) * time.Second
+}
+
+func (c *Config) ShareLinkExpiry() time.Duration {
+    return time.Duration(c.ShareLinkExpiryHours) * time.Hour
+}
+
+func (c *Config) SliceCacheTTL() time.Duration {
+    return time.Duration(c.SliceCacheTTLHours) * time.Hour
+}
+
+// ResultTTL is how long a job that finished as status is kept.
+func (c *Config) ResultTTL(status JobStatus) time.Duration {
+    if status == StatusCompleted {
+        return time.Duration(c.ResultTTLCompletedHours) * time.Hour
+    }
+    return time.Duration(c.ResultTTLFailedHours) * time.Hour
+}
+
+func (c *Config) ResultTTLMax() time.Duration {
+    return time.Duration(c.ResultTTLMaxHours) * time.Hour
+}
+
+func (c *Config) DuplicateWindow() time.Duration {
+    return time.Duration(c.DuplicateWindowSeconds) * time.Second
+}
+
+func (c *Config) HeartbeatCheckInterval() time.Duration {
+    return time.Duration(c.HeartbeatCheckIntervalSeconds) * time.Second
+}
+
+func (c *Config) WorkerHeartbeatTimeout() time.Duration {
+    return time.Duration(c.WorkerHeartbeatTimeoutSeconds) * time.Second
+}
+
+func (c *Config) WorkerDeadTimeout() time.Duration {
+    return time.Duration(c.WorkerDeadTimeoutSeconds) * time.Second
+}
+
+func (c *Config) WorkerAbsentGrace() time.Duration {
+    return time.Duration(c.WorkerAbsentGraceSeconds) * time.Second
+}
+
+func (c *Config) WebhookRetryBase() time.Duration {
+    return time.Duration(c.WebhookRetryBaseSeconds) * time.Second
+}
+
+func (c *Config) ReadinessCheckTimeout() time.Duration {
+    return time.Duration(c.ReadinessCheckTimeoutMS) * time.Millisecond
+}
+
+func (c *Config) OrientationTimeout() time.Duration {
+    return time.Duration(c.OrientationTimeoutMS) * time.Millisecond
+}
+
+func (c *Config) ReadinessCache() time.Duration {
+    return time.Duration(c.ReadinessCacheSeconds) * time.Second
+}
+
+func (c *Config) InvoiceDue() time.Duration {
+    return time.Duration(c.InvoiceDueDays) * 24 * time.Hour
+}
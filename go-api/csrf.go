@@ -0,0 +1,101 @@
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "html/template"
+    "log"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/csrf"
+
+    "slicer-api/internal/api"
+)
+
+const csrfMaxAge = 24 * 60 * 60
+
+// indexTemplate is index.html rendered with the CSRF token in a meta tag,
+// which the page's fetch() calls send back as X-CSRF-Token.
+var indexTemplate = template.Must(template.New("index").Parse(string(indexHTML)))
+
+type ginContextKey struct{}
+
+// csrfAuthKey decodes CSRF_AUTH_KEY (32 bytes, raw or hex). Without one a
+// random key is generated, so tokens don't survive a restart and replicas
+// won't accept each other's cookies.
+func csrfAuthKey() []byte {
+    key := cfg().CSRFAuthKey
+    if b, err := hex.DecodeString(key); err == nil && len(b) == 32 {
+        return b
+    }
+    if len(key) == 32 {
+        return []byte(key)
+    }
+    log.Printf("WARNING: CSRF_AUTH_KEY is not set, using a random key")
+    b := make([]byte, 32)
+    rand.Read(b)
+    return b
+}
+
+// csrfExempt reports whether a request can skip the token check. Bearer and
+// HMAC-signed requests don't rely on cookies, and without a session cookie
+// there is no ambient credential for a forged request to ride on.
+func csrfExempt(r *http.Request) bool {
+    if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+        return true
+    }
+    if strings.HasPrefix(unversionedPath(r.URL.Path), "/internal/") {
+        return true
+    }
+    _, err := r.Cookie(sessionCookie)
+    return err != nil
+}
+
+func isSafeMethod(method string) bool {
+    switch method {
+    case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+        return true
+    }
+    return false
+}
+
+// csrfMiddleware adapts gorilla/csrf to gin. The signed token cookie is set
+// on every response and checked on POST/PUT/PATCH/DELETE.
+func csrfMiddleware() gin.HandlerFunc {
+    protect := csrf.Protect(csrfAuthKey(),
+        csrf.MaxAge(csrfMaxAge),
+        csrf.Path("/"),
+        csrf.SameSite(csrf.SameSiteLaxMode),
+        csrf.ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            c := r.Context().Value(ginContextKey{}).(*gin.Context)
+            c.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResponse{Error: "CSRF check failed: " + csrf.FailureReason(r).Error()})
+        })),
+    )(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        c := r.Context().Value(ginContextKey{}).(*gin.Context)
+        c.Request = r
+        c.Next()
+    }))
+
+    return func(c *gin.Context) {
+        r := c.Request.WithContext(context.WithValue(c.Request.Context(), ginContextKey{}, c))
+        // Plain HTTP (local dev) has no Referer to check against
+        if r.TLS == nil && r.Header.Get("X-Forwarded-Proto") != "https" {
+            r = csrf.PlaintextHTTPRequest(r)
+        }
+        // Skipping also skips issuing a token, so only skip the check itself
+        if !isSafeMethod(r.Method) && csrfExempt(r) {
+            r = csrf.UnsafeSkipCheck(r)
+        }
+        protect.ServeHTTP(c.Writer, r)
+    }
+}
+
+// handleIndex serves the web UI with this session's CSRF token.
+func handleIndex(c *gin.Context) {
+    c.Header("Content-Type", "text/html; charset=utf-8")
+    c.Status(http.StatusOK)
+    indexTemplate.Execute(c.Writer, gin.H{"CSRFToken": csrf.Token(c.Request)})
+}
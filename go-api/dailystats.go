@@ -0,0 +1,208 @@
+package main
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// stats:daily:{YYYY-MM-DD} tallies each UTC day as jobs are submitted and
+// finish, for GET /admin/stats/daily:
+//
+//	jobs_submitted, jobs_completed, jobs_failed   counts
+//	processing_seconds, processing_jobs          from started_at to the
+//	                                             final status, over the
+//	                                             jobs that have a started_at
+//	material_grams, revenue                      summed from completed
+//	                                             jobs' results
+//
+// Every hour the submissions of the last two days are checked against the
+// audit stream, which records each one.
+const (
+    dailyStatsMaxDays   = 366
+    dailyStatsRetention = 400 * 24 * time.Hour
+    dailyStatsReconcile = time.Hour
+)
+
+func dailyStatsKey(day time.Time) string {
+    return "stats:daily:" + day.UTC().Format("2006-01-02")
+}
+
+// countSubmission counts a newly accepted job, in the metrics and today's
+// stats.
+func countSubmission(ctx context.Context) {
+    jobsSubmittedTotal.Inc()
+    key := dailyStatsKey(time.Now())
+    pipe := rdb.TxPipeline()
+    pipe.HIncrBy(ctx, key, "jobs_submitted", 1)
+    pipe.Expire(ctx, key, dailyStatsRetention)
+    pipe.Exec(ctx)
+}
+
+// countFinished adds a job that completed or failed to today's stats.
+// publishStatus calls it for every status.
+func countFinished(ctx context.Context, jobID, status string) {
+    if status != string(StatusCompleted) && status != string(StatusFailed) {
+        return
+    }
+    vals, _ := rdb.MGet(ctx, "started_at:"+jobID, "result:"+jobID).Result()
+    key := dailyStatsKey(time.Now())
+    pipe := rdb.TxPipeline()
+    pipe.HIncrBy(ctx, key, "jobs_"+status, 1)
+    if len(vals) == 2 {
+        if raw, ok := vals[0].(string); ok {
+            if started, err := strconv.ParseInt(raw, 10, 64); err == nil {
+                pipe.HIncrBy(ctx, key, "processing_seconds", max(time.Now().Unix()-started, 0))
+                pipe.HIncrBy(ctx, key, "processing_jobs", 1)
+            }
+        }
+        if raw, ok := vals[1].(string); ok && status == string(StatusCompleted) {
+            if r, err := parseResult([]byte(raw)); err == nil {
+                if r.FilamentGrams != nil {
+                    pipe.HIncrByFloat(ctx, key, "material_grams", *r.FilamentGrams)
+                }
+                if r.Price != nil {
+                    pipe.HIncrByFloat(ctx, key, "revenue", *r.Price)
+                }
+            }
+        }
+    }
+    pipe.Expire(ctx, key, dailyStatsRetention)
+    if _, err := pipe.Exec(ctx); err != nil {
+        log.Printf("stats: counting %s of %s: %v", status, jobID, err)
+    }
+}
+
+// dailyStats is one day of GET /admin/stats/daily.
+type dailyStats struct {
+    Date                     string   `json:"date"`
+    JobsSubmitted            int64    `json:"jobs_submitted"`
+    JobsCompleted            int64    `json:"jobs_completed"`
+    JobsFailed               int64    `json:"jobs_failed"`
+    AvgProcessingTimeSeconds *float64 `json:"avg_processing_time_seconds"`
+    TotalMaterialGrams       float64  `json:"total_material_grams"`
+    TotalRevenue             float64  `json:"total_revenue"`
+}
+
+func parseDailyStats(date string, h map[string]string) dailyStats {
+    d := dailyStats{Date: date}
+    d.JobsSubmitted, _ = strconv.ParseInt(h["jobs_submitted"], 10, 64)
+    d.JobsCompleted, _ = strconv.ParseInt(h["jobs_completed"], 10, 64)
+    d.JobsFailed, _ = strconv.ParseInt(h["jobs_failed"], 10, 64)
+    seconds, _ := strconv.ParseFloat(h["processing_seconds"], 64)
+    if n, _ := strconv.ParseFloat(h["processing_jobs"], 64); n > 0 {
+        avg := round2(seconds / n)
+        d.AvgProcessingTimeSeconds = &avg
+    }
+    grams, _ := strconv.ParseFloat(h["material_grams"], 64)
+    revenue, _ := strconv.ParseFloat(h["revenue"], 64)
+    d.TotalMaterialGrams, d.TotalRevenue = round2(grams), roundCents(revenue)
+    return d
+}
+
+// GET /admin/stats/daily?days=30 returns a record for each of the last days
+// UTC, oldest first and ending today. Days without jobs are all zeros.
+func handleDailyStats(c *gin.Context) {
+    ctx := c.Request.Context()
+    days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+    if err != nil || days < 1 || days > dailyStatsMaxDays {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "days must be between 1 and " + strconv.Itoa(dailyStatsMaxDays)})
+        return
+    }
+
+    today := time.Now().UTC()
+    pipe := rdb.Pipeline()
+    reads := make([]*redis.StringStringMapCmd, days)
+    dates := make([]string, days)
+    for i := range reads {
+        day := today.AddDate(0, 0, i-days+1)
+        dates[i] = day.Format("2006-01-02")
+        reads[i] = pipe.HGetAll(ctx, dailyStatsKey(day))
+    }
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    stats := make([]dailyStats, days)
+    for i, read := range reads {
+        stats[i] = parseDailyStats(dates[i], read.Val())
+    }
+    c.JSON(http.StatusOK, stats)
+}
+
+// reconcileDailySubmissions recounts the submissions of today and
+// yesterday from the audit stream and corrects jobs_submitted where it's
+// off, e.g. after a replica died between accepting a job and counting
+// it. Days the stream no longer reaches back to the start of are left as
+// they are.
+func reconcileDailySubmissions(ctx context.Context, now time.Time) error {
+    oldest, err := rdb.XRangeN(ctx, auditStream, "-", "+", 1).Result()
+    if err != nil || len(oldest) == 0 {
+        return err
+    }
+    today := now.UTC().Truncate(24 * time.Hour)
+    for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+        if oldest[0].ID > strconv.FormatInt(day.UnixMilli(), 10) {
+            continue
+        }
+        n, err := countAuditSubmissions(ctx, day, day.AddDate(0, 0, 1))
+        if err != nil {
+            return err
+        }
+        key := dailyStatsKey(day)
+        counted, _ := rdb.HGet(ctx, key, "jobs_submitted").Int64()
+        if counted == n {
+            continue
+        }
+        log.Printf("WARN stats: %s had %d submissions counted, the audit stream has %d; correcting", day.Format("2006-01-02"), counted, n)
+        pipe := rdb.TxPipeline()
+        pipe.HSet(ctx, key, "jobs_submitted", n)
+        pipe.Expire(ctx, key, dailyStatsRetention)
+        if _, err := pipe.Exec(ctx); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// countAuditSubmissions counts the job_submitted events from from up to,
+// but not including, to, a batch at a time.
+func countAuditSubmissions(ctx context.Context, from, to time.Time) (int64, error) {
+    var n int64
+    start, end := strconv.FormatInt(from.UnixMilli(), 10), strconv.FormatInt(to.UnixMilli()-1, 10)
+    for {
+        msgs, err := rdb.XRangeN(ctx, auditStream, start, end, exportBatch).Result()
+        if err != nil {
+            return 0, err
+        }
+        for _, m := range msgs {
+            if m.Values["event_type"] == auditJobSubmitted {
+                n++
+            }
+        }
+        if int64(len(msgs)) < exportBatch {
+            return n, nil
+        }
+        start = nextStreamID(msgs[len(msgs)-1].ID)
+    }
+}
+
+func startDailyStats() {
+    registerLease("daily_stats")
+    go func() {
+        for range time.Tick(dailyStatsReconcile) {
+            runLeased("daily_stats", leaseTTL(dailyStatsReconcile), func() {
+                if err := reconcileDailySubmissions(ctx, time.Now()); err != nil {
+                    log.Printf("WARN stats: reconciling submissions: %v", err)
+                }
+            })
+        }
+    }()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "testing"
+    "time"
+)
+
+func dailyStatsFor(t *testing.T, query string) []dailyStats {
+    t.Helper()
+    w := do(newRouter(), http.MethodGet, "/admin/stats/daily"+query, "", "Authorization", "Bearer secret")
+    if w.Code != http.StatusOK {
+        t.Fatalf("stats: status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+    var stats []dailyStats
+    if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+        t.Fatal(err)
+    }
+    return stats
+}
+
+func TestDailyStatsCountsJobs(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    r := newRouter()
+    for i := 0; i < 3; i++ {
+        if code, _, _ := quoteJobID(t, r, `{"download_url":"https://example.com/m`+strconv.Itoa(i)+`.stl","material":"PLA","infill":20}`); code != http.StatusAccepted {
+            t.Fatalf("quote %d: status = %d, want 202", i, code)
+        }
+    }
+    now := time.Now().Unix()
+    rdb.Set(ctx, "started_at:j1", now-100, 0)
+    rdb.Set(ctx, "result:j1", `{"price":12.5,"filament_grams":40.25}`, 0)
+    publishStatus(ctx, "j1", string(StatusCompleted), "")
+    rdb.Set(ctx, "started_at:j2", now-300, 0)
+    rdb.Set(ctx, "result:j2", `{"summary":{"total_cost":7.5},"filament":{"grams":10}}`, 0)
+    publishStatus(ctx, "j2", string(StatusCompleted), "")
+    // Failed jobs count, and their time, but not their material or price
+    rdb.Set(ctx, "started_at:j3", now-200, 0)
+    rdb.Set(ctx, "result:j3", `{"price":99,"error":"slicing failed"}`, 0)
+    publishStatus(ctx, "j3", string(StatusFailed), "")
+    publishStatus(ctx, "j4", string(StatusProcessing), "")
+
+    stats := dailyStatsFor(t, "?days=3")
+    if len(stats) != 3 {
+        t.Fatalf("days = %d, want 3", len(stats))
+    }
+    today := stats[2]
+    if want := time.Now().UTC().Format("2006-01-02"); today.Date != want {
+        t.Errorf("last date = %s, want today %s", today.Date, want)
+    }
+    if today.JobsSubmitted != 3 || today.JobsCompleted != 2 || today.JobsFailed != 1 {
+        t.Errorf("counts = %d/%d/%d, want 3 submitted, 2 completed, 1 failed", today.JobsSubmitted, today.JobsCompleted, today.JobsFailed)
+    }
+    if avg := today.AvgProcessingTimeSeconds; avg == nil || *avg < 200 || *avg > 202 {
+        t.Errorf("avg processing time = %v, want about 200", avg)
+    }
+    if today.TotalMaterialGrams != 50.25 || today.TotalRevenue != 20 {
+        t.Errorf("material = %v, revenue = %v, want 50.25 and 20", today.TotalMaterialGrams, today.TotalRevenue)
+    }
+    for _, d := range stats[:2] {
+        if d.JobsSubmitted != 0 || d.AvgProcessingTimeSeconds != nil || d.TotalRevenue != 0 {
+            t.Errorf("%s = %+v, want an empty day", d.Date, d)
+        }
+    }
+    if ttl := rdb.TTL(ctx, dailyStatsKey(time.Now())).Val(); ttl < dailyStatsRetention-time.Minute {
+        t.Errorf("stats TTL = %v, want about %v", ttl, dailyStatsRetention)
+    }
+}
+
+func TestDailyStatsDays(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    if stats := dailyStatsFor(t, ""); len(stats) != 30 {
+        t.Errorf("default days = %d, want 30", len(stats))
+    }
+    r := newRouter()
+    for _, q := range []string{"0", "367", "a"} {
+        if w := do(r, http.MethodGet, "/admin/stats/daily?days="+q, "", "Authorization", "Bearer secret"); w.Code != http.StatusBadRequest {
+            t.Errorf("days=%s: status = %d, want 400", q, w.Code)
+        }
+    }
+    if w := do(r, http.MethodGet, "/admin/stats/daily", ""); w.Code != http.StatusUnauthorized {
+        t.Errorf("without a token: status = %d, want 401", w.Code)
+    }
+}
+
+func TestReconcileDailySubmissions(t *testing.T) {
+    setupTest(t)
+    now := time.Now().UTC()
+    today := now.Truncate(24 * time.Hour)
+    yesterday := today.AddDate(0, 0, -1)
+    auditSubmission(t, "old", yesterday.Add(-time.Hour))
+    auditSubmission(t, "y1", yesterday.Add(time.Hour))
+    auditSubmission(t, "y2", yesterday.Add(2*time.Hour))
+    auditSubmission(t, "t1", today)
+    rdb.HSet(ctx, dailyStatsKey(yesterday), "jobs_submitted", 1, "jobs_completed", 4)
+    rdb.HSet(ctx, dailyStatsKey(today), "jobs_submitted", 1)
+
+    if err := reconcileDailySubmissions(ctx, now); err != nil {
+        t.Fatal(err)
+    }
+    if n, _ := rdb.HGet(ctx, dailyStatsKey(yesterday), "jobs_submitted").Int(); n != 2 {
+        t.Errorf("yesterday's submissions = %d, want the audit stream's 2", n)
+    }
+    if n, _ := rdb.HGet(ctx, dailyStatsKey(yesterday), "jobs_completed").Int(); n != 4 {
+        t.Errorf("yesterday's completions = %d, want them left at 4", n)
+    }
+    if n, _ := rdb.HGet(ctx, dailyStatsKey(today), "jobs_submitted").Int(); n != 1 {
+        t.Errorf("today's submissions = %d, want 1", n)
+    }
+}
+
+func TestReconcileSkipsTrimmedDays(t *testing.T) {
+    setupTest(t)
+    now := time.Now().UTC()
+    today := now.Truncate(24 * time.Hour)
+    // The stream was trimmed to today: yesterday can't be recounted
+    auditSubmission(t, "t1", today.Add(time.Second))
+    rdb.HSet(ctx, dailyStatsKey(today.AddDate(0, 0, -1)), "jobs_submitted", 7)
+
+    if err := reconcileDailySubmissions(ctx, now); err != nil {
+        t.Fatal(err)
+    }
+    if n, _ := rdb.HGet(ctx, dailyStatsKey(today.AddDate(0, 0, -1)), "jobs_submitted").Int(); n != 7 {
+        t.Errorf("yesterday's submissions = %d, want 7 untouched", n)
+    }
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+    _ "embed"
+    "encoding/json"
+    "fmt"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+)
+
+// grafanaDashboard is a Grafana dashboard over the metrics in metrics.go,
+// with variables for the Prometheus data source and an environment label.
+//
+//go:embed grafana_dashboard.json
+var grafanaDashboard []byte
+
+// checkDashboard makes sure the embedded dashboard parses; main refuses to
+// start with a broken one.
+func checkDashboard() error {
+    var d struct {
+        Panels []json.RawMessage `json:"panels"`
+    }
+    if err := json.Unmarshal(grafanaDashboard, &d); err != nil {
+        return fmt.Errorf("grafana_dashboard.json: %v", err)
+    }
+    if len(d.Panels) == 0 {
+        return fmt.Errorf("grafana_dashboard.json has no panels")
+    }
+    return nil
+}
+
+// GET /admin/dashboard/grafana returns the dashboard, ready to import.
+func handleGrafanaDashboard(c *gin.Context) {
+    c.Header("Content-Disposition", `attachment; filename="slicer-api-dashboard.json"`)
+    c.Data(http.StatusOK, "application/json", grafanaDashboard)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "regexp"
+    "strings"
+    "testing"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestEmbeddedDashboardParses(t *testing.T) {
+    if err := checkDashboard(); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestGrafanaDashboardNeedsAdmin(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    r := newRouter()
+    if w := do(r, http.MethodGet, "/admin/dashboard/grafana", ""); w.Code != http.StatusUnauthorized {
+        t.Errorf("without the token: %d, want 401", w.Code)
+    }
+    w := do(r, http.MethodGet, "/admin/dashboard/grafana", "", "Authorization", "Bearer secret")
+    if w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+        t.Fatalf("with the token: %d, want 200 and JSON", w.Code)
+    }
+    if !strings.Contains(w.Body.String(), `"${datasource}"`) || !strings.Contains(w.Body.String(), `$environment`) {
+        t.Error("dashboard doesn't use the datasource and environment variables")
+    }
+}
+
+// Every metric a panel queries has to be one we export.
+func TestDashboardQueriesKnownMetrics(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    // Vectors only show up once they have a series
+    jobProcessingSeconds.WithLabelValues("completed")
+    jobFailureTotal.WithLabelValues("timeout")
+    storageUploadDuration.WithLabelValues(storageTmpfiles)
+    families, err := prometheus.DefaultGatherer.Gather()
+    if err != nil {
+        t.Fatal(err)
+    }
+    known := map[string]bool{}
+    for _, f := range families {
+        known[f.GetName()] = true
+    }
+
+    var d struct {
+        Panels []struct {
+            Title   string `json:"title"`
+            Targets []struct {
+                Expr string `json:"expr"`
+            } `json:"targets"`
+        } `json:"panels"`
+    }
+    json.Unmarshal(grafanaDashboard, &d)
+    metric := regexp.MustCompile(`([a-z_]+)\{`)
+    for _, p := range d.Panels {
+        for _, tg := range p.Targets {
+            for _, m := range metric.FindAllStringSubmatch(tg.Expr, -1) {
+                name := m[1]
+                for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+                    name = strings.TrimSuffix(name, suffix)
+                }
+                if !known[name] {
+                    t.Errorf("panel %q queries %s, which isn't exported", p.Title, m[1])
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// A submission identical to one the same caller made less than
+// DUPLICATE_WINDOW_SECONDS ago gets the earlier job back instead of a second
+// one. It's a safety net for double clicks from clients that don't send an
+// Idempotency-Key. dup:{fingerprint} holds the first job's ID for the window;
+// the fingerprint is the slice cache key (caller, file, slicing parameters)
+// plus the fields that only change how the job is run.
+
+func duplicateDetection() bool {
+    return cfg().DuplicateWindowSeconds > 0
+}
+
+func duplicateKey(fingerprint string, maxRetries int, submitAt *time.Time) string {
+    at := ""
+    if submitAt != nil {
+        at = submitAt.UTC().Format(time.RFC3339)
+    }
+    sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", fingerprint, maxRetries, at)))
+    return "dup:" + hex.EncodeToString(sum[:])
+}
+
+// claimSubmission records jobID as the submission for key. If another job
+// already holds it, the request is answered with that job and true is
+// returned. The caller must defer releaseSubmission when a key comes back.
+func claimSubmission(c *gin.Context, key, jobID string) (string, bool) {
+    if !duplicateDetection() {
+        return "", false
+    }
+    ctx := c.Request.Context()
+    claimed, err := rdb.SetNX(ctx, key, jobID, cfg().DuplicateWindow()).Result()
+    if err != nil {
+        // Don't turn submissions away because the check itself failed
+        return "", false
+    }
+    if claimed {
+        return key, false
+    }
+    existing, err := rdb.Get(ctx, key).Result()
+    if err != nil {
+        // Expired in between
+        return "", false
+    }
+    // A withdrawn job doesn't count; the resubmission takes its place
+    if status, _ := rdb.Get(ctx, "status:"+existing).Result(); status == "cancelled" {
+        if rdb.SetXX(ctx, key, jobID, cfg().DuplicateWindow()).Val() {
+            return key, false
+        }
+        return "", false
+    }
+    c.JSON(http.StatusOK, api.SubmitJobResponse{
+        JobID:       existing,
+        DuplicateOf: existing,
+        Message:     "An identical submission was received moments ago. Poll " + statusPath(c, existing) + " for results.",
+    })
+    return "", true
+}
+
+// releaseSubmission frees the claim when the submission was turned away, so
+// a retry isn't pointed at a job that was never created.
+func releaseSubmission(c *gin.Context, key, jobID string) {
+    if key == "" {
+        return
+    }
+    if s := c.Writer.Status(); s == http.StatusOK || s == http.StatusAccepted {
+        return
+    }
+    if rdb.Get(ctx, key).Val() == jobID {
+        rdb.Del(ctx, key)
+    }
+}
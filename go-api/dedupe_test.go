@@ -0,0 +1,67 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+)
+
+const dedupeQuote = `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`
+
+func quoteJobID(t *testing.T, h http.Handler, body string) (int, string, string) {
+    t.Helper()
+    w := do(h, http.MethodPost, "/quote", body)
+    var resp struct {
+        JobID       string `json:"job_id"`
+        DuplicateOf string `json:"duplicate_of"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    return w.Code, resp.JobID, resp.DuplicateOf
+}
+
+func TestDuplicateSubmissionReturnsFirstJob(t *testing.T) {
+    setupTest(t)
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    r := newRouter()
+
+    code, first, _ := quoteJobID(t, r, dedupeQuote)
+    if code != http.StatusAccepted || first == "" {
+        t.Fatalf("first submission: status = %d, job %q; want 202", code, first)
+    }
+    code, again, dupOf := quoteJobID(t, r, dedupeQuote)
+    if code != http.StatusOK || again != first || dupOf != first {
+        t.Fatalf("repeat: status = %d, job %q, duplicate_of %q; want 200 pointing at %s", code, again, dupOf, first)
+    }
+    if n, _ := pendingDepth(ctx); n != 1 {
+        t.Errorf("%d jobs queued, want 1", n)
+    }
+
+    code, other, _ := quoteJobID(t, r, `{"download_url":"https://example.com/part.stl","material":"PLA","infill":40}`)
+    if code != http.StatusAccepted || other == first {
+        t.Errorf("different infill: status = %d, job %q; want a new 202 job", code, other)
+    }
+}
+
+func TestDuplicateWindowDisabled(t *testing.T) {
+    setupTest(t, func(c *Config) { c.DuplicateWindowSeconds = 0 })
+    r := newRouter()
+    _, first, _ := quoteJobID(t, r, dedupeQuote)
+    code, second, _ := quoteJobID(t, r, dedupeQuote)
+    if code != http.StatusAccepted || second == first {
+        t.Fatalf("status = %d, job %q (first %q); want two separate jobs", code, second, first)
+    }
+}
+
+func TestRejectedSubmissionIsNotADuplicate(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    // Past the schedule horizon, so it is turned away with 400
+    body := `{"download_url":"https://example.com/part.stl","infill":20,"submit_at":"2099-01-01T00:00:00Z"}`
+    for i := 0; i < 2; i++ {
+        if code, _, dupOf := quoteJobID(t, r, body); code != http.StatusBadRequest || dupOf != "" {
+            t.Fatalf("attempt %d: status = %d, duplicate_of %q; want 400", i+1, code, dupOf)
+        }
+    }
+}
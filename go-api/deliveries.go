@@ -0,0 +1,110 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Every delivery attempt is appended to webhook_deliveries:{webhook_id},
+// along with the exact payload so it can be replayed. Only the size of the
+// response is kept, never its body, so the log can't be used to read back
+// what some other server answered.
+const (
+    deliveryBodyLimit   = 1024
+    deliveriesMaxLen    = 1000
+    deliveriesListLimit = 50
+)
+
+type webhookDelivery struct {
+    Event          string
+    Payload        string
+    DeliveredAt    string
+    ResponseStatus int
+    ResponseBytes  int64
+    Error          string
+    Attempt        int
+    DurationMS     int64
+    ReplayOf       string
+}
+
+func deliveriesKey(webhookID string) string {
+    return "webhook_deliveries:" + webhookID
+}
+
+func logDelivery(webhookID string, d webhookDelivery) {
+    rdb.XAdd(ctx, &redis.XAddArgs{
+        Stream: deliveriesKey(webhookID),
+        MaxLen: deliveriesMaxLen,
+        Approx: true,
+        Values: map[string]interface{}{
+            "event":           d.Event,
+            "payload":         d.Payload,
+            "delivered_at":    d.DeliveredAt,
+            "response_status": d.ResponseStatus,
+            "response_bytes":  d.ResponseBytes,
+            "error_message":   d.Error,
+            "attempt_number":  d.Attempt,
+            "duration_ms":     d.DurationMS,
+            "replay_of":       d.ReplayOf,
+        },
+    })
+}
+
+// GET /webhooks/:id/deliveries returns the latest 50 attempts, newest first.
+func handleListDeliveries(c *gin.Context) {
+    w := ownedWebhook(c)
+    if w == nil {
+        return
+    }
+    msgs, err := rdb.XRevRangeN(c.Request.Context(), deliveriesKey(w.ID), "+", "-", deliveriesListLimit).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    deliveries := make([]gin.H, 0, len(msgs))
+    for _, m := range msgs {
+        entry := gin.H{"id": m.ID}
+        for k, v := range m.Values {
+            entry[k] = v
+        }
+        deliveries = append(deliveries, entry)
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(deliveries), "deliveries": deliveries})
+}
+
+// POST /webhooks/:id/deliveries/:delivery_id/replay re-sends the logged
+// payload unchanged to the webhook's current URL and logs the new attempt.
+func handleReplayDelivery(c *gin.Context) {
+    w := ownedWebhook(c)
+    if w == nil {
+        return
+    }
+    deliveryID := c.Param("delivery_id")
+    msgs, err := rdb.XRange(c.Request.Context(), deliveriesKey(w.ID), deliveryID, deliveryID).Result()
+    if err != nil || len(msgs) == 0 {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Delivery not found"})
+        return
+    }
+    orig := msgs[0].Values
+    event, _ := orig["event"].(string)
+    payload, _ := orig["payload"].(string)
+    prev, _ := orig["attempt_number"].(string)
+    attempt, _ := strconv.Atoi(prev)
+
+    // The dialer refuses internal addresses too; this says why up front
+    if err := checkWebhookURL(w.URL); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    _, err = sendWebhook(c.Request.Context(), *w, event, []byte(payload), attempt+1, deliveryID)
+    if err != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Replay failed: " + err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"replayed": deliveryID})
+}
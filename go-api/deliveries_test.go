@@ -0,0 +1,45 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestDeliveryLogKeepsNoResponseBody(t *testing.T) {
+    setupTest(t, webhookTestConfig(true))
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        w.Write([]byte("internal secret"))
+    }))
+    defer srv.Close()
+    hook := webhook{ID: "h1", URL: srv.URL, ContentType: defaultWebhookContentType}
+
+    if _, err := sendWebhook(ctx, hook, "ping", []byte("{}"), 1, ""); err != nil {
+        t.Fatal(err)
+    }
+    msgs, _ := rdb.XRange(ctx, deliveriesKey("h1"), "-", "+").Result()
+    if len(msgs) != 1 {
+        t.Fatalf("logged %d deliveries, want 1", len(msgs))
+    }
+    if _, ok := msgs[0].Values["response_body"]; ok {
+        t.Errorf("delivery log has a response_body: %v", msgs[0].Values)
+    }
+    if msgs[0].Values["response_bytes"] != "15" {
+        t.Errorf("response_bytes = %v, want 15", msgs[0].Values["response_bytes"])
+    }
+}
+
+func TestReplayRefusesInternalAddresses(t *testing.T) {
+    setupTest(t, webhookTestConfig(false))
+    hook := webhook{ID: "h1", OwnerID: "apikey:acme", URL: "http://127.0.0.1:6379/", Events: []string{"job.completed"}, ContentType: defaultWebhookContentType}
+    if err := saveWebhook(ctx, hook); err != nil {
+        t.Fatal(err)
+    }
+    logDelivery("h1", webhookDelivery{Event: "ping", Payload: "{}", Attempt: 1})
+    msgs, _ := rdb.XRange(ctx, deliveriesKey("h1"), "-", "+").Result()
+
+    w := do(newRouter(), http.MethodPost, "/webhooks/h1/deliveries/"+msgs[0].ID+"/replay", "", "Authorization", "Bearer k1")
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400 (body %s)", w.Code, w.Body)
+    }
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// deprecatedRoute is a route scheduled for removal, and where its clients
+// should go instead.
+type deprecatedRoute struct {
+    method    string
+    path      string
+    sunset    time.Time
+    successor string
+}
+
+// deprecatedRoutes are the bare paths that were public before /v1/. Uploads
+// go first; pollers are given longer, since they outlive the clients that
+// submitted their jobs.
+var deprecatedRoutes = []deprecatedRoute{
+    {http.MethodPost, "/upload", time.Date(2027, time.March, 31, 0, 0, 0, 0, time.UTC), "/v1/upload"},
+    {http.MethodPost, "/quote", time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC), "/v1/quote"},
+    {http.MethodGet, "/status/:id", time.Date(2027, time.September, 30, 0, 0, 0, 0, time.UTC), "/v1/status/:id"},
+}
+
+// deprecated_calls:{method} {path} counts the requests a deprecated route
+// still gets, so its removal can wait for clients to move.
+func deprecatedCallsKey(method, path string) string {
+    return "deprecated_calls:" + method + " " + path
+}
+
+// DeprecationMiddleware marks every response as deprecated (RFC 8594),
+// with the date the route goes away and its successor. link may name the
+// route's parameters, e.g. /v1/status/:id, and gets the request's values.
+// Requests that chose their version through Accept aren't relying on the
+// bare path's default, so they are left unmarked.
+func DeprecationMiddleware(sunset time.Time, link string) gin.HandlerFunc {
+    date := sunset.UTC().Format(http.TimeFormat)
+    return func(c *gin.Context) {
+        if !c.GetBool(apiNegotiatedKey) {
+            c.Header("Deprecation", "true")
+            c.Header("Sunset", date)
+            c.Header("Link", "<"+expandRoute(c, link)+`>; rel="successor-version"`)
+            rdb.Incr(c.Request.Context(), deprecatedCallsKey(c.Request.Method, c.FullPath()))
+        }
+        c.Next()
+    }
+}
+
+// expandRoute fills in path's :params from the request.
+func expandRoute(c *gin.Context, path string) string {
+    segments := strings.Split(path, "/")
+    for i, s := range segments {
+        if name, ok := strings.CutPrefix(s, ":"); ok {
+            segments[i] = c.Param(name)
+        }
+    }
+    return strings.Join(segments, "/")
+}
+
+// deprecatedAlias is DeprecationMiddleware for the bare path, if it is
+// scheduled for removal, and a no-op otherwise.
+func deprecatedAlias(method, path string) gin.HandlerFunc {
+    for _, d := range deprecatedRoutes {
+        if d.method == method && d.path == path {
+            return DeprecationMiddleware(d.sunset, d.successor)
+        }
+    }
+    return func(c *gin.Context) { c.Next() }
+}
+
+// GET /api/deprecations lists the deprecated routes, when each goes away,
+// what replaces it and how many requests it has had.
+//
+//	@Summary	List deprecated routes
+//	@Produce	json
+//	@Success	200	{object}	api.DeprecationsResponse
+//	@Failure	500	{object}	api.ErrorResponse
+//	@Router		/api/deprecations [get]
+func handleDeprecations(c *gin.Context) {
+    ctx := c.Request.Context()
+    keys := make([]string, len(deprecatedRoutes))
+    for i, d := range deprecatedRoutes {
+        keys[i] = deprecatedCallsKey(d.method, d.path)
+    }
+    counts, err := rdb.MGet(ctx, keys...).Result()
+    if err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+
+    resp := api.DeprecationsResponse{Deprecations: make([]api.DeprecatedRoute, len(deprecatedRoutes))}
+    for i, d := range deprecatedRoutes {
+        var calls int64
+        if s, ok := counts[i].(string); ok {
+            calls, _ = strconv.ParseInt(s, 10, 64)
+        }
+        resp.Deprecations[i] = api.DeprecatedRoute{
+            Method:    d.method,
+            Path:      d.path,
+            Sunset:    d.sunset.Format(time.RFC3339),
+            Successor: d.successor,
+            Calls:     calls,
+        }
+    }
+    c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+func TestDeprecationMiddlewareHeaders(t *testing.T) {
+    setupTest(t)
+    r := gin.New()
+    sunset := time.Date(2027, time.January, 2, 15, 4, 5, 0, time.FixedZone("CET", 3600))
+    r.GET("/old/:id/files/:name", DeprecationMiddleware(sunset, "/new/:id/:name"), func(c *gin.Context) {
+        c.Status(http.StatusNoContent)
+    })
+
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/old/j1/files/part.stl", nil))
+    for header, want := range map[string]string{
+        "Deprecation": "true",
+        "Sunset":      "Sat, 02 Jan 2027 14:04:05 GMT",
+        "Link":        `</new/j1/part.stl>; rel="successor-version"`,
+    } {
+        if got := w.Header().Get(header); got != want {
+            t.Errorf("%s = %q, want %q", header, got, want)
+        }
+    }
+    if n := rdb.Get(ctx, deprecatedCallsKey(http.MethodGet, "/old/:id/files/:name")).Val(); n != "1" {
+        t.Errorf("calls = %q, want 1", n)
+    }
+}
+
+func TestDeprecationsList(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "queued", 0)
+
+    do(r, http.MethodGet, "/status/j1", "")
+    do(r, http.MethodGet, "/status/j1", "")
+    do(r, http.MethodPost, "/quote", versionQuote)
+    // Neither counts: one names its version, the other is the successor
+    do(r, http.MethodGet, "/status/j1", "", "Accept", "application/vnd.prusaslicer.v1+json")
+    do(r, http.MethodGet, "/v1/status/j1", "")
+
+    w := do(r, http.MethodGet, "/api/deprecations", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var resp api.DeprecationsResponse
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if len(resp.Deprecations) != len(deprecatedRoutes) {
+        t.Fatalf("deprecations = %+v, want %d routes", resp.Deprecations, len(deprecatedRoutes))
+    }
+    want := map[string]int64{"POST /upload": 0, "POST /quote": 1, "GET /status/:id": 2}
+    for _, d := range resp.Deprecations {
+        route := d.Method + " " + d.Path
+        if calls, ok := want[route]; !ok || d.Calls != calls {
+            t.Errorf("%s: calls = %d, want %d", route, d.Calls, calls)
+        }
+        if _, err := time.Parse(time.RFC3339, d.Sunset); err != nil || d.Successor != versionedPath(apiV1, d.Path) {
+            t.Errorf("%s: sunset %q, successor %q", route, d.Sunset, d.Successor)
+        }
+    }
+}
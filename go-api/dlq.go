@@ -0,0 +1,136 @@
+package main
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// Jobs that exhaust their max_retries are parked here instead of being requeued.
+// Each entry wraps the original payload with the reason it was given up on.
+const deadQueue = "print_jobs:dead"
+
+type deadLetter struct {
+    Job            map[string]interface{} `json:"job"`
+    LastError      string                 `json:"last_error"`
+    DeadLetteredAt int64                  `json:"dead_lettered_at"`
+}
+
+// lastError prefers the error the worker reported over our own reason.
+func lastError(jobID, fallback string) string {
+    res, err := rdb.Get(ctx, "result:"+jobID).Result()
+    if err != nil {
+        return fallback
+    }
+    var result struct {
+        Error string `json:"error"`
+    }
+    if json.Unmarshal([]byte(res), &result) != nil || result.Error == "" {
+        return fallback
+    }
+    return result.Error
+}
+
+// deadLetterJob moves a job to the DLQ and flags its status.
+func deadLetterJob(job map[string]interface{}, reason string) error {
+    jobID, _ := job["id"].(string)
+    if _, err := setStatus(ctx, jobID, StatusDeadLettered, cfg().DLQTTL()); err == errInvalidTransition {
+        return nil
+    } else if err != nil {
+        return err
+    }
+    entry, _ := json.Marshal(deadLetter{
+        Job:            job,
+        LastError:      lastError(jobID, reason),
+        DeadLetteredAt: time.Now().Unix(),
+    })
+    if err := rdb.RPush(ctx, deadQueue, entry).Err(); err != nil {
+        return err
+    }
+    rdb.Set(ctx, "note:"+jobID, "Gave up after too many attempts: "+reason, cfg().DLQTTL())
+    publishStatus(ctx, jobID, string(StatusDeadLettered), "gave up after too many attempts: "+reason)
+    log.Printf("dlq: %s dead-lettered: %s", jobID, reason)
+    return nil
+}
+
+// pruneDLQ drops entries older than the DLQ TTL. Entries are appended in
+// order, so it only needs to look at the head of the list.
+func pruneDLQ() {
+    cutoff := time.Now().Add(-cfg().DLQTTL()).Unix()
+    for {
+        head, err := rdb.LIndex(ctx, deadQueue, 0).Result()
+        if err != nil {
+            return
+        }
+        var dl deadLetter
+        if json.Unmarshal([]byte(head), &dl) == nil && dl.DeadLetteredAt > cutoff {
+            return
+        }
+        rdb.LRem(ctx, deadQueue, 1, head)
+    }
+}
+
+// GET /admin/dlq
+func handleListDLQ(c *gin.Context) {
+    ctx := c.Request.Context()
+    raw, err := rdb.LRange(ctx, deadQueue, 0, -1).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    entries := []deadLetter{}
+    for _, r := range raw {
+        var dl deadLetter
+        if json.Unmarshal([]byte(r), &dl) == nil {
+            upgradePayload(dl.Job)
+            entries = append(entries, dl)
+        }
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(entries), "entries": entries})
+}
+
+// POST /admin/dlq/:id/requeue gives a dead-lettered job exactly one more try.
+func handleRequeueDLQ(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    raw, err := rdb.LRange(ctx, deadQueue, 0, -1).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    for _, r := range raw {
+        var dl deadLetter
+        if json.Unmarshal([]byte(r), &dl) != nil || dl.Job["id"] != jobID {
+            continue
+        }
+        // LREM decides the race if two admins click at once
+        if removed, _ := rdb.LRem(ctx, deadQueue, 1, r).Result(); removed == 0 {
+            break
+        }
+
+        upgradePayload(dl.Job)
+        dl.Job["attempts"] = jobMaxRetries(dl.Job)
+        jsonData := marshalPayload(dl.Job)
+        if err := enqueue(ctx, payloadQueue(dl.Job), jobID, jsonData); err != nil {
+            rdb.RPush(ctx, deadQueue, r)
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to queue job"})
+            return
+        }
+        if _, err := setStatus(ctx, jobID, StatusQueued, 24*time.Hour); err == nil {
+            rdb.Set(ctx, "note:"+jobID, "Requeued from dead-letter queue", 24*time.Hour)
+            rdb.Del(ctx, "result:"+jobID)
+            publishStatus(ctx, jobID, string(StatusQueued), "requeued from the dead-letter queue")
+        }
+
+        c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "message": "Job requeued"})
+        return
+    }
+
+    c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not in dead-letter queue"})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "strconv"
+)
+
+// downloadRetryReason is how a retried download failure is described in the
+// job's note and history.
+const downloadRetryReason = "a failed download"
+
+// requeueFailedDownload puts a job whose worker reported download_failed
+// back through the retry machinery instead of failing it, and reports
+// whether it did. Most such failures are the file host briefly answering
+// 503, so the job stays "processing" meanwhile rather than flashing failed.
+// Once its download retries are used up, the failure stands, so links that
+// are really dead still fail.
+func requeueFailedDownload(ctx context.Context, jobID string, before string, result json.RawMessage) bool {
+    if !cfg().DownloadRetryEnabled || parseJobStatus(before) != StatusProcessing {
+        return false
+    }
+    if r, err := parseResult(result); err != nil || r.ErrorCode != errDownloadFailed {
+        return false
+    }
+    raw, err := rdb.Get(ctx, "params:"+jobID).Bytes()
+    if err != nil {
+        return false
+    }
+    job, err := readPayload(raw)
+    if err != nil {
+        return false
+    }
+
+    // params:{id} is the payload as submitted; earlier retries are counted
+    // in attempts:{id}
+    attempts, _ := job["attempts"].(float64)
+    if n, err := strconv.Atoi(rdb.Get(ctx, "attempts:"+jobID).Val()); err == nil && float64(n) > attempts {
+        attempts = float64(n)
+    }
+    attempt := int(attempts) + 1
+    maxRetries := jobMaxRetries(job)
+    if cfg().MaxDownloadRetries < maxRetries {
+        maxRetries = cfg().MaxDownloadRetries
+    }
+    if attempt > maxRetries {
+        return false
+    }
+
+    job["attempts"] = attempt
+    // The step reached on this attempt no longer applies
+    rdb.Del(ctx, progressKey(jobID))
+    return delayRetry(job, attempt, maxRetries, downloadRetryReason, StatusProcessing) == nil
+}
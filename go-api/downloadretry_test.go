@@ -0,0 +1,87 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+const downloadFailure = `{"status":"failed","result":{"success":false,"error":"503 Service Unavailable","error_code":"download_failed"}}`
+
+func downloadRetryRouter(t *testing.T, opts ...func(*Config)) (*gin.Engine, string) {
+    t.Helper()
+    setupTest(t, append([]func(*Config){func(c *Config) { c.InternalSecret = "s" }}, opts...)...)
+    r := newRouter()
+    _, jobID, _ := quoteJobID(t, r, dedupeQuote)
+    if code := reportStatus(t, r, jobID, `{"status":"processing"}`); code != http.StatusOK {
+        t.Fatalf("claim = %d", code)
+    }
+    return r, jobID
+}
+
+func TestDownloadFailureRequeued(t *testing.T) {
+    r, jobID := downloadRetryRouter(t)
+
+    if code := reportStatus(t, r, jobID, downloadFailure); code != http.StatusOK {
+        t.Fatalf("report = %d, want 200", code)
+    }
+    if got := rdb.Get(ctx, "status:"+jobID).Val(); got != "processing" {
+        t.Errorf("status = %q, want processing while it retries", got)
+    }
+    if n := rdb.ZCard(ctx, delayedQueue).Val(); n != 1 {
+        t.Errorf("delayed set holds %d entries, want the job", n)
+    }
+    if rdb.Exists(ctx, "result:"+jobID).Val() != 0 {
+        t.Error("the failed result was stored")
+    }
+
+    var body struct {
+        Status string `json:"status"`
+        Note   string `json:"note"`
+    }
+    json.Unmarshal(do(r, http.MethodGet, "/status/"+jobID, "").Body.Bytes(), &body)
+    if body.Status != "processing" || !strings.Contains(body.Note, "Retrying after a failed download") {
+        t.Errorf("status = %+v, want processing with a retrying note", body)
+    }
+}
+
+func TestDownloadFailureCap(t *testing.T) {
+    r, jobID := downloadRetryRouter(t, func(c *Config) { c.MaxDownloadRetries = 2 })
+
+    for attempt := 1; attempt <= 2; attempt++ {
+        reportStatus(t, r, jobID, downloadFailure)
+        if got := rdb.Get(ctx, "status:"+jobID).Val(); got != "processing" {
+            t.Fatalf("attempt %d: status = %q, want it retried", attempt, got)
+        }
+        // The worker claims the retry
+        reportStatus(t, r, jobID, `{"status":"processing"}`)
+    }
+    reportStatus(t, r, jobID, downloadFailure)
+    if got := rdb.Get(ctx, "status:"+jobID).Val(); got != "failed" {
+        t.Errorf("status = %q after the retries ran out, want failed", got)
+    }
+}
+
+func TestDownloadFailureKillSwitch(t *testing.T) {
+    r, jobID := downloadRetryRouter(t, func(c *Config) { c.DownloadRetryEnabled = false })
+
+    reportStatus(t, r, jobID, downloadFailure)
+    if got := rdb.Get(ctx, "status:"+jobID).Val(); got != "failed" {
+        t.Errorf("status = %q with retries off, want failed", got)
+    }
+}
+
+func TestOtherFailuresNotRequeued(t *testing.T) {
+    r, jobID := downloadRetryRouter(t)
+
+    reportStatus(t, r, jobID, `{"status":"failed","result":{"error":"Mesh validation failed","error_code":"geometry_error"}}`)
+    if got := rdb.Get(ctx, "status:"+jobID).Val(); got != "failed" {
+        t.Errorf("status = %q, want failed", got)
+    }
+    if n := rdb.ZCard(ctx, delayedQueue).Val(); n != 0 {
+        t.Errorf("delayed set holds %d entries, want none", n)
+    }
+}
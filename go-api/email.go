@@ -0,0 +1,252 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/tls"
+    "encoding/json"
+    "fmt"
+    "log"
+    "mime/quotedprintable"
+    "net"
+    "net/mail"
+    "net/smtp"
+    "strconv"
+    "strings"
+    "text/template"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+    "github.com/google/uuid"
+)
+
+// A /quote or /upload may name a notify_email to be sent the price once the
+// job completes or fails. notify_email:{id} is a hash of the address and,
+// once queued, when; it expires with the job. Email is inert without
+// SMTP_HOST: addresses are still checked but nothing is stored or sent.
+func notifyEmailKey(jobID string) string {
+    return "notify_email:" + jobID
+}
+
+// smtpTimeout bounds one whole delivery attempt, from dialling to QUIT.
+const smtpTimeout = 30 * time.Second
+
+// notifyEmailMax is the longest address SMTP allows.
+const notifyEmailMax = 254
+
+func emailEnabled() bool {
+    return cfg().SMTPHost != ""
+}
+
+// validNotifyEmail accepts a bare address, such as "ana@example.com": no
+// display name, comments or angle brackets, which would only end up in
+// the To header.
+func validNotifyEmail(raw string) error {
+    addr, err := mail.ParseAddress(raw)
+    if err != nil || addr.Name != "" || addr.Address != raw || len(raw) > notifyEmailMax {
+        return fmt.Errorf("notify_email must be an email address")
+    }
+    return nil
+}
+
+// registerNotifyEmail stores jobID's notify_email, if it has one and email
+// is on. Call it once the job's status is set, whose TTL it takes.
+func registerNotifyEmail(ctx context.Context, jobID, address string) {
+    if address == "" || !emailEnabled() {
+        return
+    }
+    pipe := rdb.TxPipeline()
+    pipe.HSet(ctx, notifyEmailKey(jobID), "address", address)
+    pipe.Expire(ctx, notifyEmailKey(jobID), jobTTL(ctx, jobID))
+    pipe.Exec(ctx)
+}
+
+// quoteEmailData is what quoteEmailTemplate is executed with. Price and
+// PrintTime are empty when the result doesn't have them.
+type quoteEmailData struct {
+    JobID     string
+    Completed bool
+    Price     string
+    PrintTime string
+    // What went wrong, for failures
+    Reason string
+    Link   string
+}
+
+var quoteEmailTemplate = template.Must(template.New("quote_email").Parse(
+    `{{if .Completed}}Your print quote is ready.
+{{if .Price}}
+Price: {{.Price}}{{end}}{{if .PrintTime}}
+Print time: {{.PrintTime}}{{end}}
+{{else}}We couldn't quote your print.
+{{if .Reason}}
+{{.Reason}}
+{{end}}{{end}}
+See the details at {{.Link}}
+
+Reference: {{.JobID}}
+`))
+
+// fireEmail queues jobID's quote email in the outbox, which retries it like
+// a webhook, when it has a notify_email that hasn't been sent yet. result
+// is the worker's result JSON. Nothing here waits on the mail server: the
+// first attempt is made in the background.
+func fireEmail(jobID, status string, result json.RawMessage) {
+    if !emailEnabled() {
+        return
+    }
+    key := notifyEmailKey(jobID)
+    to, err := rdb.HGet(ctx, key, "address").Result()
+    if err != nil || to == "" {
+        return
+    }
+    // Only the first finish sends it, should the job report twice
+    if first, err := rdb.HSetNX(ctx, key, "sent_at", time.Now().UTC().Format(time.RFC3339)).Result(); err != nil || !first {
+        return
+    }
+    msg, err := quoteEmail(jobID, status, to, result)
+    if err != nil {
+        log.Printf("email: rendering %s for %s: %v", status, jobID, err)
+        return
+    }
+    id, err := enqueueDelivery(ctx, outboxDelivery{
+        Kind:    outboxEmail,
+        JobID:   jobID,
+        Event:   "job." + status,
+        Payload: string(msg),
+    })
+    if err != nil {
+        log.Printf("email: queueing %s for %s: %v", status, jobID, err)
+        return
+    }
+    rdb.HSet(ctx, key, "delivery_id", id)
+    go attemptDelivery(id)
+}
+
+// quoteEmail renders the message to send to, headers and all.
+func quoteEmail(jobID, status, to string, result []byte) ([]byte, error) {
+    d := quoteEmailData{JobID: jobID, Completed: status == "completed", Link: quoteEmailLink(jobID)}
+    if r, err := parseResult(result); err == nil {
+        if r.Price != nil {
+            d.Price = fmt.Sprintf("%.2f %s", *r.Price, r.Currency)
+        }
+        if r.PrintTimeSeconds != nil {
+            d.PrintTime = formatPrintTime(*r.PrintTimeSeconds)
+        }
+        d.Reason = r.ErrorDescription
+    }
+    subject := "Your print quote is ready"
+    if !d.Completed {
+        subject = "Your print couldn't be quoted"
+    }
+
+    var body bytes.Buffer
+    qp := quotedprintable.NewWriter(&body)
+    if err := quoteEmailTemplate.Execute(qp, d); err != nil {
+        return nil, err
+    }
+    qp.Close()
+
+    from, _ := mail.ParseAddress(cfg().SMTPFrom)
+    var msg bytes.Buffer
+    for _, h := range [][2]string{
+        {"From", from.String()},
+        {"To", to},
+        {"Subject", subject},
+        {"Date", time.Now().Format(time.RFC1123Z)},
+        {"Message-ID", "<" + uuid.New().String() + "@" + emailDomain(from.Address) + ">"},
+        {"MIME-Version", "1.0"},
+        {"Content-Type", "text/plain; charset=utf-8"},
+        {"Content-Transfer-Encoding", "quoted-printable"},
+    } {
+        msg.WriteString(h[0] + ": " + h[1] + "\r\n")
+    }
+    msg.WriteString("\r\n")
+    // The quoted-printable writer has already made the line breaks CRLF
+    msg.Write(body.Bytes())
+    return msg.Bytes(), nil
+}
+
+// quoteEmailLink is a share link where SHARE_SECRET allows one, which the
+// customer can open without credentials, or else the job's status URL.
+func quoteEmailLink(jobID string) string {
+    base := strings.TrimSuffix(cfg().Host, "/")
+    if cfg().ShareSecret != "" {
+        if token, expiresAt, err := createShare(ctx, jobID); err == nil {
+            return base + sharePath(token, expiresAt)
+        }
+    }
+    return base + "/" + apiV1 + "/status/" + jobID
+}
+
+// formatPrintTime writes seconds to the nearest minute, e.g. "2h 05m".
+func formatPrintTime(seconds int64) string {
+    minutes := (seconds + 30) / 60
+    h, m := minutes/60, minutes%60
+    if h == 0 {
+        return strconv.FormatInt(m, 10) + "m"
+    }
+    return fmt.Sprintf("%dh %02dm", h, m)
+}
+
+func emailDomain(address string) string {
+    _, domain, _ := strings.Cut(address, "@")
+    return domain
+}
+
+// sendEmail makes one attempt at jobID's quote email: msg to the address it
+// was registered with, through SMTP_HOST.
+func sendEmail(jobID string, msg []byte) error {
+    to, err := rdb.HGet(ctx, notifyEmailKey(jobID), "address").Result()
+    if err == redis.Nil || !emailEnabled() {
+        return errDeliveryGone
+    } else if err != nil {
+        return err
+    }
+    return smtpSend(to, msg)
+}
+
+// smtpSend delivers msg to one recipient, upgrading to TLS when the server
+// offers STARTTLS and logging in when SMTP_USERNAME is set.
+func smtpSend(to string, msg []byte) error {
+    c := cfg()
+    conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.SMTPHost, strconv.Itoa(c.SMTPPort)), smtpTimeout)
+    if err != nil {
+        return err
+    }
+    conn.SetDeadline(time.Now().Add(smtpTimeout))
+    client, err := smtp.NewClient(conn, c.SMTPHost)
+    if err != nil {
+        conn.Close()
+        return err
+    }
+    defer client.Close()
+    if ok, _ := client.Extension("STARTTLS"); ok {
+        if err := client.StartTLS(&tls.Config{ServerName: c.SMTPHost}); err != nil {
+            return err
+        }
+    }
+    if c.SMTPUsername != "" {
+        if err := client.Auth(smtp.PlainAuth("", c.SMTPUsername, c.SMTPPassword, c.SMTPHost)); err != nil {
+            return err
+        }
+    }
+    from, _ := mail.ParseAddress(c.SMTPFrom)
+    if err := client.Mail(from.Address); err != nil {
+        return err
+    }
+    if err := client.Rcpt(to); err != nil {
+        return err
+    }
+    w, err := client.Data()
+    if err != nil {
+        return err
+    }
+    if _, err := w.Write(msg); err != nil {
+        return err
+    }
+    if err := w.Close(); err != nil {
+        return err
+    }
+    return client.Quit()
+}
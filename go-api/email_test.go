@@ -0,0 +1,223 @@
+package main
+
+import (
+    "bufio"
+    "io"
+    "mime/quotedprintable"
+    "net"
+    "net/http"
+    "net/mail"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// smtpServer is a mail server on loopback that turns the first reject
+// recipients away with a 451, then accepts everything.
+type smtpServer struct {
+    mu       sync.Mutex
+    reject   int
+    messages []*mail.Message
+    bodies   []string
+}
+
+func startSMTPServer(t *testing.T, reject int) (*smtpServer, int) {
+    t.Helper()
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { ln.Close() })
+    s := &smtpServer{reject: reject}
+    go func() {
+        for {
+            conn, err := ln.Accept()
+            if err != nil {
+                return
+            }
+            go s.serve(conn)
+        }
+    }()
+    return s, ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+    defer conn.Close()
+    r := bufio.NewReader(conn)
+    reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+    reply("220 test ESMTP")
+    for {
+        line, err := r.ReadString('\n')
+        if err != nil {
+            return
+        }
+        switch verb := strings.ToUpper(strings.Fields(line + " x")[0]); verb {
+        case "RCPT":
+            s.mu.Lock()
+            rejected := s.reject > 0
+            s.reject--
+            s.mu.Unlock()
+            if rejected {
+                reply("451 try again later")
+            } else {
+                reply("250 ok")
+            }
+        case "DATA":
+            reply("354 go ahead")
+            var data strings.Builder
+            for {
+                l, err := r.ReadString('\n')
+                if err != nil {
+                    return
+                }
+                if l == ".\r\n" {
+                    break
+                }
+                data.WriteString(strings.TrimPrefix(l, "."))
+            }
+            msg, err := mail.ReadMessage(strings.NewReader(data.String()))
+            if err == nil {
+                body, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+                s.mu.Lock()
+                s.messages = append(s.messages, msg)
+                s.bodies = append(s.bodies, string(body))
+                s.mu.Unlock()
+            }
+            reply("250 queued")
+        case "QUIT":
+            reply("221 bye")
+            return
+        default:
+            reply("250 test")
+        }
+    }
+}
+
+// received returns how many messages have arrived, with the latest.
+func (s *smtpServer) received() (int, *mail.Message, string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if len(s.messages) == 0 {
+        return 0, nil, ""
+    }
+    return len(s.messages), s.messages[len(s.messages)-1], s.bodies[len(s.bodies)-1]
+}
+
+func smtpConfig(port int) func(*Config) {
+    return func(c *Config) {
+        c.InternalSecret = "s"
+        c.SMTPHost = "127.0.0.1"
+        c.SMTPPort = port
+        c.SMTPFrom = "Print Shop <quotes@example.com>"
+        c.Host = "https://print.example.com"
+    }
+}
+
+func emailQuote(address string) string {
+    return `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20,"notify_email":"` + address + `"}`
+}
+
+// emailDelivery waits for jobID's email to be queued and its first attempt
+// made, and returns the outbox ID.
+func emailDelivery(t *testing.T, jobID string) string {
+    t.Helper()
+    for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+        if id := rdb.HGet(ctx, notifyEmailKey(jobID), "delivery_id").Val(); id != "" {
+            waitAttempts(t, id, 1)
+            return id
+        }
+    }
+    t.Fatal("email never queued")
+    return ""
+}
+
+func TestQuoteEmailDeliveredWithRetry(t *testing.T) {
+    srv, port := startSMTPServer(t, 1)
+    setupTest(t, smtpConfig(port), func(c *Config) { c.ShareSecret = "share" })
+    r := newRouter()
+    code, jobID, _ := quoteJobID(t, r, emailQuote("ana@example.com"))
+    if code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202", code)
+    }
+    payload, _ := rdb.Get(ctx, "params:"+jobID).Bytes()
+    if job, _ := readPayload(payload); job["notify_email"] != nil {
+        t.Errorf("payload = %v, want the address kept out of it", job)
+    }
+
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    reportStatus(t, r, jobID, `{"status":"completed","result":{"summary":{"total_cost":12.5,"print_time":"2h 5m"}}}`)
+    id := emailDelivery(t, jobID)
+    if n, _, _ := srv.received(); n != 0 {
+        t.Fatalf("%d messages after the rejected first attempt", n)
+    }
+    retryDeliveries(t)
+    if d := waitAttempts(t, id, 2); d.State != outboxDelivered {
+        t.Fatalf("delivery = %+v, want delivered on the second attempt", d)
+    }
+    // A second report of the finish doesn't send it again
+    reportStatus(t, r, jobID, `{"status":"completed","result":{"summary":{"total_cost":12.5}}}`)
+
+    n, msg, body := srv.received()
+    if n != 1 {
+        t.Fatalf("%d messages, want 1", n)
+    }
+    if msg.Header.Get("To") != "ana@example.com" || msg.Header.Get("Subject") != "Your print quote is ready" || msg.Header.Get("From") != `"Print Shop" <quotes@example.com>` {
+        t.Errorf("headers = %v", msg.Header)
+    }
+    for _, want := range []string{"Price: 12.50 USD", "Print time: 2h 05m", "https://print.example.com/shared/", "Reference: " + jobID} {
+        if !strings.Contains(body, want) {
+            t.Errorf("body lacks %q:\n%s", want, body)
+        }
+    }
+}
+
+func TestQuoteEmailForFailure(t *testing.T) {
+    srv, port := startSMTPServer(t, 0)
+    setupTest(t, smtpConfig(port))
+    r := newRouter()
+    _, jobID, _ := quoteJobID(t, r, emailQuote("ana@example.com"))
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    reportStatus(t, r, jobID, `{"status":"failed","result":{"error":"Mesh is not watertight","error_code":"geometry_error"}}`)
+    waitAttempts(t, emailDelivery(t, jobID), 1)
+
+    n, msg, body := srv.received()
+    if n != 1 || msg.Header.Get("Subject") != "Your print couldn't be quoted" {
+        t.Fatalf("%d messages, latest %v", n, msg)
+    }
+    // Without SHARE_SECRET the link is the status URL
+    if !strings.Contains(body, "https://print.example.com/v1/status/"+jobID) || strings.Contains(body, "Price:") {
+        t.Errorf("body =\n%s", body)
+    }
+}
+
+func TestQuoteEmailValidated(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    for _, address := range []string{"nope", "Ana <ana@example.com>", "ana@example.com\r\nBcc: x@example.com", strings.Repeat("a", 250) + "@example.com"} {
+        body := `{"download_url":"https://example.com/part.stl","infill":20,"notify_email":` + strconv.Quote(address) + `}`
+        if code, _, _ := quoteJobID(t, r, body); code != http.StatusBadRequest {
+            t.Errorf("%q: status = %d, want 400", address, code)
+        }
+    }
+}
+
+func TestQuoteEmailInertWithoutSMTP(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    code, jobID, _ := quoteJobID(t, r, emailQuote("ana@example.com"))
+    if code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202", code)
+    }
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    if code := reportStatus(t, r, jobID, `{"status":"completed","result":{"summary":{"total_cost":3}}}`); code != http.StatusOK {
+        t.Fatalf("completion = %d", code)
+    }
+    if n := rdb.Exists(ctx, notifyEmailKey(jobID)).Val(); n != 0 {
+        t.Error("address stored without SMTP_HOST")
+    }
+    if n := rdb.ZCard(ctx, outboxKey).Val(); n != 0 {
+        t.Errorf("%d deliveries queued, want none", n)
+    }
+}
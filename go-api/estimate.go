@@ -0,0 +1,235 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "mime/multipart"
+    "net"
+    "net/http"
+    "net/url"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// modelClient fetches the download_url of /quote/estimate. Like webhooks
+// it only reaches public addresses; unlike them it follows redirects, as
+// file hosts use them, since every hop is dialled through the same check.
+var modelClient = &http.Client{
+    Timeout: 30 * time.Second,
+    Transport: &http.Transport{
+        DialContext: (&net.Dialer{
+            Timeout: 5 * time.Second,
+            Control: webhookDialControl,
+        }).DialContext,
+        TLSHandshakeTimeout: 5 * time.Second,
+    },
+}
+
+// estimateFlowMM3PerSec is the volume a 0.4mm nozzle is taken to extrude
+// a second. Flow grows with the nozzle's cross-section, so a 0.8mm one
+// lays down four times as much.
+const estimateFlowMM3PerSec = 5.0
+
+// What the worker prints for each bed_adhesion, after cfg.ini and its
+// BED_ADHESION_SETTINGS: one line a layer high, or a raft of solid
+// layers under the model.
+const (
+    adhesionLayerMM = 0.2  // first_layer_height
+    adhesionLineMM  = 0.42 // first_layer_extrusion_width
+    skirtDistanceMM = 2
+    skirtLayers     = 3
+    brimWidthMM     = 5
+    raftLayers      = 3
+    raftExpansionMM = 1.5
+    raftDensity     = 0.9
+)
+
+// adhesionVolumeMM3 is the material the bed adhesion takes around a model
+// lying on the bed as bb has it.
+func adhesionVolumeMM3(adhesion string, bb BoundingBox) float64 {
+    w, d := bb.Max[0]-bb.Min[0], bb.Max[1]-bb.Min[1]
+    switch adhesion {
+    case "skirt":
+        perimeter := 2 * (w + d + 4*skirtDistanceMM)
+        return perimeter * adhesionLineMM * adhesionLayerMM * skirtLayers
+    case "brim":
+        ring := (w+2*brimWidthMM)*(d+2*brimWidthMM) - w*d
+        return ring * adhesionLayerMM
+    case "raft":
+        area := (w + 2*raftExpansionMM) * (d + 2*raftExpansionMM)
+        return area * adhesionLayerMM * raftLayers * raftDensity
+    }
+    return 0
+}
+
+// estimatePrintSeconds is how long extruding volumeMM3 takes through nozzle.
+func estimatePrintSeconds(volumeMM3, nozzle float64) int {
+    scale := nozzle / defaultNozzle
+    return int(math.Round(volumeMM3 / (estimateFlowMM3PerSec * scale * scale)))
+}
+
+// errModelTooLarge is a download_url past MAX_UPLOAD_BYTES.
+var errModelTooLarge = errors.New("model too large")
+
+// fetchModel downloads the model at rawURL, up to maxBytes of it.
+func fetchModel(ctx context.Context, rawURL string, maxBytes int64) ([]byte, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := modelClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("download_url answered %s", resp.Status)
+    }
+    data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+    if err != nil {
+        return nil, err
+    }
+    if int64(len(data)) > maxBytes {
+        return nil, errModelTooLarge
+    }
+    return data, nil
+}
+
+// POST /quote/estimate weighs and prices an STL from its volume and the
+// material's density, without queueing a job. It is immediate but
+// rough: the model is taken as printed solid and the print time as pure
+// extrusion, while a sliced quote accounts for infill, supports and the
+// slicer's own timing.
+//
+//	@Summary	Estimate a model's material use without slicing it
+//	@Tags		jobs
+//	@Accept		multipart/form-data
+//	@Produce	json
+//	@Param		file			formData	file	false	"STL model, unless download_url is given"
+//	@Param		download_url	formData	string	false	"Where to fetch the STL instead"
+//	@Param		material		formData	string	false	"Name or alias of a GET /materials profile, defaults to PLA"
+//	@Param		nozzle			formData	number	false	"Nozzle diameter in mm, defaults to 0.4"
+//	@Param		bed_adhesion	formData	string	false	"none, brim, raft or skirt, defaults to brim"
+//	@Success	200				{object}	api.EstimateResponse
+//	@Failure	400				{object}	api.ErrorResponse
+//	@Failure	413				{object}	api.ErrorResponse
+//	@Failure	422				{object}	api.ErrorResponse	"Not a readable STL"
+//	@Failure	502				{object}	api.ErrorResponse	"download_url couldn't be fetched"
+//	@Router		/quote/estimate [post]
+func handleEstimate(c *gin.Context) {
+    maxBytes := cfg().MaxUploadBytes
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+uploadFormSlack)
+    fileHeader, err := c.FormFile("file")
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) || (err == nil && fileHeader.Size > maxBytes) {
+        c.JSON(http.StatusRequestEntityTooLarge, api.ErrorResponse{Error: fmt.Sprintf("File exceeds %d bytes", maxBytes)})
+        return
+    }
+    downloadURL := c.PostForm("download_url")
+    if (err == nil) == (downloadURL != "") {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Send either a file or a download_url"})
+        return
+    }
+    filename := downloadURL
+    if fileHeader != nil {
+        filename = fileHeader.Filename
+    } else if u, err := url.Parse(downloadURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "download_url must be an http(s) URL"})
+        return
+    } else {
+        filename = u.Path
+    }
+    if !strings.EqualFold(filepath.Ext(filename), ".stl") {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Only STL models can be estimated; upload other formats for a quote"})
+        return
+    }
+    material, ok := findMaterial(c.DefaultPostForm("material", "PLA"))
+    if !ok {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Unknown material; see GET /materials"})
+        return
+    }
+    nozzle, err := strconv.ParseFloat(c.DefaultPostForm("nozzle", "0.4"), 64)
+    if err != nil {
+        nozzle = 0
+    }
+    bedAdhesion := c.DefaultPostForm("bed_adhesion", defaultBedAdhesion)
+    if err := checkPrintSettings(nozzle, bedAdhesion); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+
+    var data []byte
+    if fileHeader != nil {
+        data, err = readUpload(fileHeader)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to read upload"})
+            return
+        }
+    } else {
+        data, err = fetchModel(c.Request.Context(), downloadURL, maxBytes)
+        if err == errModelTooLarge {
+            c.JSON(http.StatusRequestEntityTooLarge, api.ErrorResponse{Error: fmt.Sprintf("Model exceeds %d bytes", maxBytes)})
+            return
+        } else if err != nil {
+            c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Couldn't fetch download_url: " + err.Error()})
+            return
+        }
+    }
+    meta, err := ParseSTLMetadata(data)
+    if err != nil {
+        c.JSON(http.StatusUnprocessableEntity, api.ErrorResponse{Error: "Couldn't read the model: " + err.Error()})
+        return
+    }
+
+    adhesionMM3 := adhesionVolumeMM3(bedAdhesion, meta.Bounds)
+    weight := meta.VolumeCM3() * material.DensityGPerCM3
+    adhesionWeight := adhesionMM3 / 1000 * material.DensityGPerCM3
+    resp := api.EstimateResponse{
+        Material:                  material.Name,
+        Triangles:                 meta.Triangles,
+        VolumeCM3:                 round2(meta.VolumeCM3()),
+        BoundingBoxMM:             [3]float64{round2(meta.SizeMM[0]), round2(meta.SizeMM[1]), round2(meta.SizeMM[2])},
+        Nozzle:                    nozzle,
+        BedAdhesion:               bedAdhesion,
+        WeightGrams:               round2(weight),
+        AdhesionWeightGrams:       round2(adhesionWeight),
+        Cost:                      roundCents((weight + adhesionWeight) * material.CostPerGram),
+        Currency:                  invoiceCurrency,
+        EstimatedPrintTimeSeconds: estimatePrintSeconds(meta.VolumeMM3+adhesionMM3, nozzle),
+    }
+    // Skipped rather than holding up the estimate
+    if timeout := cfg().OrientationTimeout(); timeout > 0 {
+        ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+        advisor, err := NewOrientationAdvisor(ctx, data)
+        cancel()
+        if err == nil {
+            advice := advisor.Recommend(meta.Bounds)
+            resp.RecommendedRotationDegrees = &advice.RotationDegrees
+            resp.EstimatedSupportVolumePct = &advice.SupportVolumePct
+        }
+    }
+    c.JSON(http.StatusOK, resp)
+}
+
+func readUpload(fileHeader *multipart.FileHeader) ([]byte, error) {
+    file, err := fileHeader.Open()
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    return io.ReadAll(file)
+}
+
+// round2 keeps the two decimals measurements are shown with.
+func round2(f float64) float64 {
+    return math.Round(f*100) / 100
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+
+    "slicer-api/internal/api"
+)
+
+// postEstimate sends the model with material and any further form fields,
+// given as name, value pairs.
+func postEstimate(r http.Handler, filename string, content []byte, material string, fields ...string) *httptest.ResponseRecorder {
+    body := &bytes.Buffer{}
+    mw := multipart.NewWriter(body)
+    if filename != "" {
+        part, _ := mw.CreateFormFile("file", filename)
+        part.Write(content)
+    }
+    if material != "" {
+        mw.WriteField("material", material)
+    }
+    for i := 0; i+1 < len(fields); i += 2 {
+        mw.WriteField(fields[i], fields[i+1])
+    }
+    mw.Close()
+    req := httptest.NewRequest(http.MethodPost, "/quote/estimate", body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    return w
+}
+
+func TestEstimateWeighsModel(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+
+    // 40mm cube: 64 cm³
+    w := postEstimate(r, "cube.STL", binarySTL(cubeTriangles(40)), "petg")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d %s, want 200", w.Code, w.Body)
+    }
+    var resp api.EstimateResponse
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if resp.RecommendedRotationDegrees == nil || *resp.RecommendedRotationDegrees != (api.Rotation{}) || resp.EstimatedSupportVolumePct == nil || *resp.EstimatedSupportVolumePct != 0 {
+        t.Errorf("orientation = %v, %v; want a cube left as it is without support", resp.RecommendedRotationDegrees, resp.EstimatedSupportVolumePct)
+    }
+    resp.RecommendedRotationDegrees, resp.EstimatedSupportVolumePct = nil, nil
+    want := api.EstimateResponse{
+        Material:      "PETG",
+        Triangles:     12,
+        VolumeCM3:     64,
+        BoundingBoxMM: [3]float64{40, 40, 40},
+        Nozzle:        0.4,
+        BedAdhesion:   "brim",
+        WeightGrams:   81.28,
+        // A 5mm brim, one layer high: 0.18 cm³
+        AdhesionWeightGrams: 0.23,
+        Cost:                2.28,
+        Currency:            "USD",
+        // 64.18 cm³ at 5 mm³/s
+        EstimatedPrintTimeSeconds: 12836,
+    }
+    if resp != want {
+        t.Errorf("estimate = %+v, want %+v", resp, want)
+    }
+    if n := rdb.DBSize(ctx).Val(); n != 0 {
+        t.Errorf("estimate wrote %d keys, want none", n)
+    }
+
+    json.Unmarshal(postEstimate(r, "cube.stl", []byte(asciiSTL(cubeTriangles(10))), "").Body.Bytes(), &resp)
+    if resp.Material != "PLA" || resp.WeightGrams != 1.24 {
+        t.Errorf("default material estimate = %+v, want 1 cm³ of PLA", resp)
+    }
+}
+
+func TestEstimateRejects(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    cube := binarySTL(cubeTriangles(10))
+
+    for _, tt := range []struct {
+        name, filename string
+        content        []byte
+        material       string
+        want           int
+    }{
+        {"unknown material", "cube.stl", cube, "unobtainium", http.StatusBadRequest},
+        {"other format", "cube.3mf", cube, "PLA", http.StatusBadRequest},
+        {"unreadable", "cube.stl", []byte("not a mesh"), "PLA", http.StatusUnprocessableEntity},
+        {"no file", "", nil, "PLA", http.StatusBadRequest},
+    } {
+        if w := postEstimate(r, tt.filename, tt.content, tt.material); w.Code != tt.want {
+            t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+        }
+    }
+}
+
+func postEstimateURL(r http.Handler, downloadURL string) *httptest.ResponseRecorder {
+    form := url.Values{"download_url": {downloadURL}}
+    return do(r, http.MethodPost, "/quote/estimate", form.Encode(), "Content-Type", "application/x-www-form-urlencoded")
+}
+
+func TestEstimateFromDownloadURL(t *testing.T) {
+    setupTest(t, func(c *Config) { c.WebhookAllowPrivate, c.MaxUploadBytes = true, 1000 })
+    r := newRouter()
+    // A 2mm board standing on its edge is best laid on its side
+    board := binarySTL(boxTriangles([3]float64{}, [3]float64{2, 40, 30}))
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        switch req.URL.Path {
+        case "/board.stl":
+            w.Write(board)
+        case "/big.stl":
+            w.Write(make([]byte, 1001))
+        default:
+            http.NotFound(w, req)
+        }
+    }))
+    defer srv.Close()
+
+    w := postEstimateURL(r, srv.URL+"/board.stl")
+    var resp api.EstimateResponse
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if w.Code != http.StatusOK || resp.VolumeCM3 != 2.4 || resp.RecommendedRotationDegrees == nil || *resp.RecommendedRotationDegrees != (api.Rotation{Y: 90}) {
+        t.Errorf("board: %d %s, want it rotated 90° about Y", w.Code, w.Body)
+    }
+
+    for path, want := range map[string]int{
+        "/missing.stl": http.StatusBadGateway,
+        "/big.stl":     http.StatusRequestEntityTooLarge,
+        "/board.3mf":   http.StatusBadRequest,
+    } {
+        if w := postEstimateURL(r, srv.URL+path); w.Code != want {
+            t.Errorf("%s: status = %d, want %d", path, w.Code, want)
+        }
+    }
+    if w := postEstimateURL(r, "file:///etc/passwd.stl"); w.Code != http.StatusBadRequest {
+        t.Errorf("file URL: status = %d, want 400", w.Code)
+    }
+}
+
+func TestEstimateSkipsOrientationWhenDisabled(t *testing.T) {
+    setupTest(t, func(c *Config) { c.OrientationTimeoutMS = 0 })
+    w := postEstimate(newRouter(), "cube.stl", binarySTL(cubeTriangles(10)), "")
+    if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "recommended_rotation_degrees") {
+        t.Errorf("estimate = %d %s, want no orientation advice", w.Code, w.Body)
+    }
+}
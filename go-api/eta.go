@@ -0,0 +1,124 @@
+package main
+
+import (
+    "context"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// Durations (seconds) of the most recently finished jobs, newest first.
+const (
+    sliceDurationsKey = "stats:slice_durations"
+    sliceDurationsMax = 50
+)
+
+// recordSliceDuration notes how long a finished job was in processing, using
+// the started_at:{id} the worker wrote when it claimed the job.
+func recordSliceDuration(ctx context.Context, jobID string) {
+    startedAt, err := rdb.Get(ctx, "started_at:"+jobID).Int64()
+    if err != nil {
+        return
+    }
+    secs := time.Now().Unix() - startedAt
+    if secs < 0 {
+        return
+    }
+    pipe := rdb.Pipeline()
+    pipe.LPush(ctx, sliceDurationsKey, secs)
+    pipe.LTrim(ctx, sliceDurationsKey, 0, sliceDurationsMax-1)
+    pipe.Exec(ctx)
+}
+
+// averageSliceTime is the rolling mean of recent jobs, or the configured
+// estimate until there is history.
+func averageSliceTime(ctx context.Context) time.Duration {
+    if d, ok := recordedSliceTime(ctx); ok {
+        return d
+    }
+    return cfg().EstimatedSliceTime()
+}
+
+// recordedSliceTime is the mean of the recorded durations, false when there
+// are none.
+func recordedSliceTime(ctx context.Context) (time.Duration, bool) {
+    vals, err := rdb.LRange(ctx, sliceDurationsKey, 0, -1).Result()
+    if err != nil {
+        return 0, false
+    }
+    var total, n int64
+    for _, v := range vals {
+        if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+            total += secs
+            n++
+        }
+    }
+    if n == 0 {
+        return 0, false
+    }
+    return time.Duration(total/n) * time.Second, true
+}
+
+// queuePosition is the 1-based place of a queued job in pop order: rush jobs
+// are served first, so standard jobs count everything on their rush list too.
+// Jobs no longer on a list (claimed by a worker) are at position 0.
+func queuePosition(ctx context.Context, jobID string) (int64, error) {
+    payload, err := rdb.Get(ctx, "params:"+jobID).Result()
+    if err == redis.Nil {
+        return 0, nil
+    } else if err != nil {
+        return 0, err
+    }
+    var job map[string]interface{}
+    unmarshalPayload([]byte(payload), &job)
+
+    queue := payloadQueue(job)
+    idx, found, err := queueIndex(ctx, queue, payload)
+    if err != nil {
+        return 0, err
+    }
+    if !found {
+        if cfg().FairScheduling {
+            owner, _ := job["owner_id"].(string)
+            if pos, ok := fairPosition(ctx, queue, owner, payload); ok {
+                return pos, nil
+            }
+        }
+        return 0, nil
+    }
+
+    ahead := int64(0)
+    if !strings.HasSuffix(queue, ":rush") && !singleQueue() {
+        ahead, _ = queueBacklog(ctx, rushQueueFor(queue))
+    }
+    return ahead + idx + 1, nil
+}
+
+// queueIndex is the 0-based place of payload among the jobs still waiting on
+// queue: its index in the legacy list, or among the stream entries the
+// consumer group hasn't read yet.
+func queueIndex(ctx context.Context, queue, payload string) (int64, bool, error) {
+    if legacyListQueue() {
+        idx, err := rdb.LPos(ctx, queue, payload, redis.LPosArgs{}).Result()
+        if err == redis.Nil {
+            return 0, false, nil
+        }
+        return idx, err == nil, err
+    }
+    group, err := streamGroup(ctx, queue)
+    if err != nil || group == nil {
+        return 0, false, err
+    }
+    entries, err := undelivered(ctx, queue, group, streamMaxLen)
+    if err != nil {
+        return 0, false, err
+    }
+    for i, e := range entries {
+        if e.Values["payload"] == payload {
+            return int64(i), true, nil
+        }
+    }
+    return 0, false, nil
+}
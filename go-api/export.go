@@ -0,0 +1,133 @@
+package main
+
+import (
+    "context"
+    "encoding/csv"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// exportBatch is how many audit entries one XRANGE of the export reads.
+var exportBatch int64 = 1000
+
+var exportHeader = []string{"job_id", "submitted_at", "completed_at", "material", "layer_height", "infill", "rush", "status", "estimated_price", "download_url"}
+
+// nextStreamID is the smallest stream ID after id, for resuming XRANGE
+// after the last entry read.
+func nextStreamID(id string) string {
+    ms, seq, _ := strings.Cut(id, "-")
+    n, _ := strconv.ParseUint(seq, 10, 64)
+    return ms + "-" + strconv.FormatUint(n+1, 10)
+}
+
+// GET /history/export?from=&to= streams every job submitted between from and
+// to (RFC3339, both optional) as CSV, oldest first. Submissions are read
+// from the audit stream a batch at a time, resuming after the last ID, and
+// each batch is joined with whatever the job's keys still hold: once they
+// expire only job_id and submitted_at are left.
+func handleHistoryExport(c *gin.Context) {
+    ctx := c.Request.Context()
+    start, err := auditStreamBound(c.Query("from"), "-")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "from must be an RFC3339 time"})
+        return
+    }
+    end, err := auditStreamBound(c.Query("to"), "+")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "to must be an RFC3339 time"})
+        return
+    }
+
+    c.Header("Content-Type", "text/csv; charset=utf-8")
+    c.Header("Content-Disposition", `attachment; filename="jobs_export_`+time.Now().UTC().Format("20060102T150405Z")+`.csv"`)
+    c.Status(http.StatusOK)
+    w := csv.NewWriter(c.Writer)
+    w.Write(exportHeader)
+
+    for {
+        msgs, err := rdb.XRangeN(ctx, auditStream, start, end, exportBatch).Result()
+        if err != nil {
+            // Too late for a status code; a short file is the signal
+            w.Write([]string{"# export stopped: Redis error"})
+            break
+        }
+        var ids, submitted []string
+        for _, m := range msgs {
+            if m.Values["event_type"] != auditJobSubmitted {
+                continue
+            }
+            id, _ := m.Values["job_id"].(string)
+            at, _ := m.Values["timestamp"].(string)
+            ids = append(ids, id)
+            submitted = append(submitted, at)
+        }
+        for i, row := range exportRows(ctx, ids) {
+            row[1] = submitted[i]
+            w.Write(row)
+        }
+        w.Flush()
+        c.Writer.Flush()
+        if int64(len(msgs)) < exportBatch || ctx.Err() != nil {
+            break
+        }
+        start = nextStreamID(msgs[len(msgs)-1].ID)
+    }
+    w.Flush()
+}
+
+// exportRows reads the rest of each job's row in one round trip.
+func exportRows(ctx context.Context, ids []string) [][]string {
+    rows := make([][]string, len(ids))
+    if len(ids) == 0 {
+        return rows
+    }
+    keys := make([]string, 0, 4*len(ids))
+    for _, id := range ids {
+        keys = append(keys, "params:"+id, "status:"+id, "result:"+id, "completed_at:"+id)
+    }
+    vals, _ := rdb.MGet(ctx, keys...).Result()
+    for i, id := range ids {
+        row := make([]string, len(exportHeader))
+        row[0] = id
+        if vals == nil {
+            rows[i] = row
+            continue
+        }
+        params, _ := vals[4*i].(string)
+        row[7], _ = vals[4*i+1].(string)
+        result, _ := vals[4*i+2].(string)
+        row[2], _ = vals[4*i+3].(string)
+
+        var job struct {
+            Material    string   `json:"material"`
+            LayerHeight *float64 `json:"layer_height"`
+            Infill      *int     `json:"infill"`
+            Rush        *bool    `json:"rush"`
+            DownloadURL string   `json:"download_url"`
+        }
+        if params != "" && unmarshalPayload([]byte(params), &job) == nil {
+            row[3] = job.Material
+            if job.LayerHeight != nil {
+                row[4] = strconv.FormatFloat(*job.LayerHeight, 'f', -1, 64)
+            }
+            if job.Infill != nil {
+                row[5] = strconv.Itoa(*job.Infill)
+            }
+            if job.Rush != nil {
+                row[6] = strconv.FormatBool(*job.Rush)
+            }
+            row[9] = job.DownloadURL
+        }
+        if price, ok := resultPrice([]byte(result)); ok {
+            row[8] = strconv.FormatFloat(price, 'f', 2, 64)
+        }
+        rows[i] = row
+    }
+    return rows
+}
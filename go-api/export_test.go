@@ -0,0 +1,104 @@
+package main
+
+import (
+    "encoding/csv"
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// auditSubmission adds a job_submitted entry at the given time, as a
+// submission at that moment would have.
+func auditSubmission(t *testing.T, jobID string, at time.Time) {
+    t.Helper()
+    err := rdb.XAdd(ctx, &redis.XAddArgs{
+        Stream: auditStream,
+        ID:     strconv.FormatInt(at.UnixMilli(), 10) + "-0",
+        Values: map[string]interface{}{"event_type": auditJobSubmitted, "job_id": jobID, "timestamp": at.UTC().Format(time.RFC3339)},
+    }).Err()
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+func exportCSV(t *testing.T, query string) [][]string {
+    t.Helper()
+    w := do(newRouter(), http.MethodGet, "/history/export"+query, "", "Authorization", "Bearer secret")
+    if w.Code != http.StatusOK {
+        t.Fatalf("export: status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+    if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="jobs_export_`) {
+        t.Errorf("Content-Disposition = %q", cd)
+    }
+    rows, err := csv.NewReader(w.Body).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return rows
+}
+
+func TestHistoryExport(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    auditSubmission(t, "j1", base)
+    rdb.Set(ctx, "params:j1", `{"id":"j1","material":"PETG","layer_height":0.2,"infill":20,"rush":true,"download_url":"https://example.com/a.stl"}`, 0)
+    rdb.Set(ctx, "status:j1", "completed", 0)
+    rdb.Set(ctx, "completed_at:j1", "2026-03-01T12:05:00Z", 0)
+    rdb.Set(ctx, "result:j1", `{"summary":{"total_cost":24.9}}`, 0)
+    // Expired long ago: only the audit trail remembers it
+    auditSubmission(t, "j2", base.Add(time.Hour))
+    rdb.XAdd(ctx, &redis.XAddArgs{Stream: auditStream, Values: map[string]interface{}{"event_type": auditStatusChanged, "job_id": "j1"}})
+
+    rows := exportCSV(t, "")
+    if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(exportHeader, ",") {
+        t.Fatalf("rows = %q, want the header and two submissions", rows)
+    }
+    want := "j1,2026-03-01T12:00:00Z,2026-03-01T12:05:00Z,PETG,0.2,20,true,completed,24.90,https://example.com/a.stl"
+    if got := strings.Join(rows[1], ","); got != want {
+        t.Errorf("row = %s\nwant  %s", got, want)
+    }
+    if rows[2][0] != "j2" || rows[2][1] != "2026-03-01T13:00:00Z" || rows[2][7] != "" {
+        t.Errorf("expired job row = %q", rows[2])
+    }
+
+    rows = exportCSV(t, "?from=2026-03-01T12:30:00Z")
+    if len(rows) != 2 || rows[1][0] != "j2" {
+        t.Errorf("from filter: rows = %q, want only j2", rows)
+    }
+    rows = exportCSV(t, "?to=2026-03-01T12:30:00Z")
+    if len(rows) != 2 || rows[1][0] != "j1" {
+        t.Errorf("to filter: rows = %q, want only j1", rows)
+    }
+}
+
+func TestHistoryExportBatches(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    saved := exportBatch
+    exportBatch = 2
+    t.Cleanup(func() { exportBatch = saved })
+    base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    for i := 0; i < 5; i++ {
+        auditSubmission(t, "j"+strconv.Itoa(i), base.Add(time.Duration(i)*time.Second))
+    }
+
+    rows := exportCSV(t, "")
+    if len(rows) != 6 {
+        t.Fatalf("got %d rows, want the header and 5 jobs", len(rows))
+    }
+    for i, row := range rows[1:] {
+        if row[0] != "j"+strconv.Itoa(i) {
+            t.Errorf("row %d is %s, want j%d in order", i, row[0], i)
+        }
+    }
+}
+
+func TestHistoryExportNeedsAdmin(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    if w := do(newRouter(), http.MethodGet, "/history/export", ""); w.Code == http.StatusOK {
+        t.Fatalf("export without the admin token: status = %d", w.Code)
+    }
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+    "context"
+    "log"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// With FAIR_SCHEDULING on, new submissions wait in one list per submitter
+// ("fair:<queue>:<owner_id>") instead of going straight onto <queue>. The
+// "fair:<queue>" sorted set indexes submitters by when they were last served,
+// and the dispatcher keeps <queue> topped up with FAIR_DISPATCH_BUFFER jobs
+// by always serving the longest-waiting submitter, giving round-robin.
+const (
+    fairPrefix           = "fair:"
+    anonymousSubmitter   = "anonymous"
+    fairDispatchInterval = 500 * time.Millisecond
+)
+
+func fairIndexKey(queue string) string {
+    return fairPrefix + queue
+}
+
+func fairListKey(queue, owner string) string {
+    return fairPrefix + queue + ":" + owner
+}
+
+func submitterOf(owner string) string {
+    if owner == "" {
+        return anonymousSubmitter
+    }
+    return owner
+}
+
+// submitJob queues a new submission, through the submitter's fair list when
+// FAIR_SCHEDULING is on. Retries and releases bypass it via enqueue, since
+// those jobs already waited their turn.
+func submitJob(ctx context.Context, queue, jobID, owner string, jsonData []byte) error {
+    if !cfg().FairScheduling {
+        return enqueue(ctx, queue, jobID, jsonData)
+    }
+    submitter := submitterOf(owner)
+    pipe := rdb.TxPipeline()
+    pipe.Set(ctx, "params:"+jobID, jsonData, 24*time.Hour)
+    pipe.RPush(ctx, fairListKey(queue, submitter), jsonData)
+    // NX keeps a returning submitter's place in the rotation
+    pipe.ZAddNX(ctx, fairIndexKey(queue), &redis.Z{Score: float64(time.Now().UnixNano()), Member: submitter})
+    _, err := pipe.Exec(ctx)
+    return err
+}
+
+// startFairDispatcher feeds every queue from the fair lists.
+func startFairDispatcher() {
+    if !cfg().FairScheduling {
+        return
+    }
+    registerLease("fair-dispatch")
+    go func() {
+        for range time.Tick(fairDispatchInterval) {
+            runLeased("fair-dispatch", leaseTTL(fairDispatchInterval), func() {
+                for _, q := range jobQueues() {
+                    dispatchFair(q)
+                }
+            })
+        }
+    }()
+}
+
+// dispatchFair moves jobs onto queue until FAIR_DISPATCH_BUFFER of them are
+// waiting for a worker, counted by queueBacklog so the limit holds whether
+// workers read the stream or the legacy list. LPOP is the claim, so replicas
+// dispatching together never duplicate a job.
+func dispatchFair(queue string) {
+    for {
+        n, err := queueBacklog(ctx, queue)
+        if err != nil || n >= int64(cfg().FairDispatchBuffer) {
+            return
+        }
+        next, err := rdb.ZRangeWithScores(ctx, fairIndexKey(queue), 0, 0).Result()
+        if err != nil || len(next) == 0 {
+            return
+        }
+        submitter, _ := next[0].Member.(string)
+
+        entry, err := rdb.LPop(ctx, fairListKey(queue, submitter)).Result()
+        if err == redis.Nil {
+            // Drained; a submission racing this ZREM re-adds itself with NX
+            rdb.ZRem(ctx, fairIndexKey(queue), submitter)
+            continue
+        } else if err != nil {
+            return
+        }
+        rdb.ZAdd(ctx, fairIndexKey(queue), &redis.Z{Score: float64(time.Now().UnixNano()), Member: submitter})
+
+        var job struct {
+            ID string `json:"id"`
+        }
+        unmarshalPayload([]byte(entry), &job)
+        if err := enqueue(ctx, queue, job.ID, []byte(entry)); err != nil {
+            log.Printf("fair: failed to dispatch %s: %v", job.ID, err)
+            rdb.LPush(ctx, fairListKey(queue, submitter), entry)
+            return
+        }
+    }
+}
+
+// fairPosition estimates how many jobs are ahead of one still waiting in a
+// fair list: the queue itself plus one job per submitter per round.
+func fairPosition(ctx context.Context, queue, owner, payload string) (int64, bool) {
+    idx, err := rdb.LPos(ctx, fairListKey(queue, submitterOf(owner)), payload, redis.LPosArgs{}).Result()
+    if err != nil {
+        return 0, false
+    }
+    queued, _ := queueBacklog(ctx, queue)
+    submitters, _ := rdb.ZCard(ctx, fairIndexKey(queue)).Result()
+    return queued + idx*max(submitters, 1) + 1, true
+}
+
+// submitterDepths reports each submitter's waiting jobs per queue.
+func submitterDepths(ctx context.Context) map[string]map[string]int64 {
+    depths := map[string]map[string]int64{}
+    for _, q := range jobQueues() {
+        submitters, err := rdb.ZRange(ctx, fairIndexKey(q), 0, -1).Result()
+        if err != nil || len(submitters) == 0 {
+            continue
+        }
+        depths[q] = map[string]int64{}
+        for _, s := range submitters {
+            n, _ := rdb.LLen(ctx, fairListKey(q, s)).Result()
+            depths[q][s] = n
+        }
+    }
+    return depths
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+    "fmt"
+    "testing"
+)
+
+func TestDispatchFairKeepsStreamBuffered(t *testing.T) {
+    tests := []struct {
+        name   string
+        legacy bool
+    }{
+        // Nothing is pushed to the list, so its length can't be the gate
+        {"stream only", false},
+        // Workers read the stream, so the list never drains
+        {"dual publish", true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setupTest(t, func(c *Config) {
+                c.LegacyListQueue = tt.legacy
+                c.FairScheduling = true
+                c.FairDispatchBuffer = 2
+            })
+            if err := initStreams(); err != nil {
+                t.Fatal(err)
+            }
+            for i := 0; i < 5; i++ {
+                id := fmt.Sprintf("job-%d", i)
+                if err := submitJob(ctx, standardQueue, id, "alice", []byte(`{"id":"`+id+`"}`)); err != nil {
+                    t.Fatal(err)
+                }
+            }
+
+            dispatchFair(standardQueue)
+            if n, _ := streamBacklog(ctx, standardQueue); n != 2 {
+                t.Fatalf("stream backlog after dispatch = %d, want 2", n)
+            }
+            if n, _ := rdb.LLen(ctx, fairListKey(standardQueue, "alice")).Result(); n != 3 {
+                t.Fatalf("fair list holds %d, want 3", n)
+            }
+
+            readFromStream(t, 2)
+            dispatchFair(standardQueue)
+            if n, _ := streamBacklog(ctx, standardQueue); n != 2 {
+                t.Fatalf("stream backlog after workers read = %d, want 2", n)
+            }
+            if n, _ := rdb.LLen(ctx, fairListKey(standardQueue, "alice")).Result(); n != 1 {
+                t.Fatalf("fair list holds %d, want 1", n)
+            }
+        })
+    }
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "hash/fnv"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// Flags live in the feature_flags hash, name -> "true", "false" or
+// "percent:N". Each replica keeps a copy refreshed every
+// featureRefreshInterval, so a change reaches them all within that without a
+// restart. Percentage rollouts bucket callers by owner so a given customer
+// keeps the same answer.
+const featureFlagsKey = "feature_flags"
+
+var featureRefreshInterval = 60 * time.Second
+
+// Flags the code checks, and what they mean while unset.
+const (
+    // Jobs are priced by the worker's pricing_v2 rates
+    featurePricingV2 = "pricing_v2"
+    // A job's region picks its queue, with REGION_ROUTING_ENABLED
+    featureRegionRouting = "region_routing"
+)
+
+var featureDefaults = map[string]bool{
+    featurePricingV2:     false,
+    featureRegionRouting: true,
+}
+
+// FeatureFlags is the replica's copy of the feature_flags hash.
+type FeatureFlags struct {
+    mu          sync.RWMutex
+    flags       map[string]string
+    refreshedAt time.Time
+}
+
+var features = newFeatureFlags()
+
+func newFeatureFlags() *FeatureFlags {
+    return &FeatureFlags{flags: map[string]string{}}
+}
+
+// startFeatureFlags loads the flags and keeps them fresh.
+func startFeatureFlags() {
+    if err := features.Refresh(ctx); err != nil {
+        log.Printf("WARN loading feature flags: %v", err)
+    }
+    go func() {
+        for range time.Tick(featureRefreshInterval) {
+            if err := features.Refresh(ctx); err != nil {
+                log.Printf("WARN refreshing feature flags: %v", err)
+            }
+        }
+    }()
+}
+
+// Refresh rereads the hash. On error the previous flags stay in force.
+func (f *FeatureFlags) Refresh(ctx context.Context) error {
+    flags, err := rdb.HGetAll(ctx, featureFlagsKey).Result()
+    if err != nil {
+        return err
+    }
+    f.mu.Lock()
+    f.flags, f.refreshedAt = flags, time.Now()
+    f.mu.Unlock()
+    return nil
+}
+
+// IsEnabled reports whether flag is on for ownerID: always for "true", never
+// for "false", and for "percent:N" when the owner's bucket, hash(ownerID +
+// flag) % 100, is below N. Unset flags take their default. A value that
+// doesn't parse counts as off.
+func (f *FeatureFlags) IsEnabled(flag, ownerID string) bool {
+    f.mu.RLock()
+    value, set := f.flags[flag]
+    f.mu.RUnlock()
+    if !set {
+        return featureDefaults[flag]
+    }
+    percent, err := parseFeatureValue(value)
+    if err != nil {
+        return false
+    }
+    return featureBucket(flag, ownerID) < percent
+}
+
+// IsEnabled checks flag against this replica's flags.
+func IsEnabled(flag, ownerID string) bool {
+    return features.IsEnabled(flag, ownerID)
+}
+
+// parseFeatureValue turns a flag value into the percentage of owners it is
+// on for.
+func parseFeatureValue(value string) (int, error) {
+    switch value {
+    case "true":
+        return 100, nil
+    case "false":
+        return 0, nil
+    }
+    n, ok := strings.CutPrefix(value, "percent:")
+    if !ok {
+        return 0, fmt.Errorf(`value must be "true", "false" or "percent:N"`)
+    }
+    percent, err := strconv.Atoi(n)
+    if err != nil || percent < 0 || percent > 100 {
+        return 0, fmt.Errorf("percent must be a whole number from 0 to 100")
+    }
+    return percent, nil
+}
+
+func featureBucket(flag, ownerID string) int {
+    h := fnv.New32a()
+    h.Write([]byte(ownerID + flag))
+    return int(h.Sum32() % 100)
+}
+
+// jobFeatures lists the flags on for owner that change how a job is
+// processed. They go into the payload as "features" for the worker, and
+// into the slice cache scope so results from either side of a rollout
+// aren't served to the other.
+func jobFeatures(owner string) []string {
+    var on []string
+    if IsEnabled(featurePricingV2, owner) {
+        on = append(on, featurePricingV2)
+    }
+    return on
+}
+
+// featureScope extends a slice cache scope with the job's features.
+func featureScope(scope string, on []string) string {
+    if len(on) == 0 {
+        return scope
+    }
+    return scope + "|" + strings.Join(on, ",")
+}
+
+// routedRegion is the region a job is routed by: its own, unless the owner
+// is outside the region_routing rollout.
+func routedRegion(region, owner string) string {
+    if !IsEnabled(featureRegionRouting, owner) {
+        return ""
+    }
+    return region
+}
+
+type featureState struct {
+    Value   string `json:"value,omitempty"`
+    Default bool   `json:"default"`
+    Known   bool   `json:"known"`
+}
+
+// GET /admin/features lists the flags set in Redis and those the code
+// checks, as this replica last read them.
+func handleListFeatures(c *gin.Context) {
+    features.mu.RLock()
+    list := make(map[string]featureState, len(features.flags)+len(featureDefaults))
+    for name, value := range features.flags {
+        _, known := featureDefaults[name]
+        list[name] = featureState{Value: value, Default: featureDefaults[name], Known: known}
+    }
+    refreshedAt := features.refreshedAt
+    features.mu.RUnlock()
+    for name, def := range featureDefaults {
+        if _, set := list[name]; !set {
+            list[name] = featureState{Default: def, Known: true}
+        }
+    }
+    resp := gin.H{"features": list}
+    if !refreshedAt.IsZero() {
+        resp["refreshed_at"] = refreshedAt.UTC().Format(time.RFC3339)
+    }
+    c.JSON(http.StatusOK, resp)
+}
+
+// PUT /admin/features/:name sets a flag from {"value": "percent:30"}. This
+// replica applies it at once; others on their next refresh.
+func handleSetFeature(c *gin.Context) {
+    name := c.Param("name")
+    var req struct {
+        Value string `json:"value" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if _, err := parseFeatureValue(req.Value); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    ctx := c.Request.Context()
+    if err := rdb.HSet(ctx, featureFlagsKey, name, req.Value).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    features.Refresh(ctx)
+    _, known := featureDefaults[name]
+    c.JSON(http.StatusOK, gin.H{"name": name, "value": req.Value, "known": known})
+}
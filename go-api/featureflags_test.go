@@ -0,0 +1,155 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+)
+
+func setFeature(t *testing.T, name, value string) {
+    t.Helper()
+    rdb.HSet(ctx, featureFlagsKey, name, value)
+    if err := features.Refresh(ctx); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestParseFeatureValue(t *testing.T) {
+    tests := []struct {
+        value   string
+        percent int
+        ok      bool
+    }{
+        {"true", 100, true},
+        {"false", 0, true},
+        {"percent:30", 30, true},
+        {"percent:0", 0, true},
+        {"percent:100", 100, true},
+        {"percent:101", 0, false},
+        {"percent:-1", 0, false},
+        {"percent:x", 0, false},
+        {"yes", 0, false},
+    }
+    for _, tt := range tests {
+        percent, err := parseFeatureValue(tt.value)
+        if (err == nil) != tt.ok || percent != tt.percent {
+            t.Errorf("parseFeatureValue(%q) = %d, %v; want %d, ok %v", tt.value, percent, err, tt.percent, tt.ok)
+        }
+    }
+}
+
+func TestFeaturePercentRollout(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    setFeature(t, "new_thing", "percent:30")
+
+    on := 0
+    for i := 0; i < 1000; i++ {
+        owner := fmt.Sprintf("apikey:customer%d", i)
+        got := IsEnabled("new_thing", owner)
+        if got {
+            on++
+        }
+        if IsEnabled("new_thing", owner) != got {
+            t.Fatalf("%s: answer changed between calls", owner)
+        }
+    }
+    if on < 250 || on > 350 {
+        t.Errorf("%d of 1000 owners enabled at 30%%", on)
+    }
+
+    setFeature(t, "new_thing", "true")
+    if !IsEnabled("new_thing", "apikey:anyone") {
+        t.Error(`"true" should enable everyone`)
+    }
+    setFeature(t, "new_thing", "garbage")
+    if IsEnabled("new_thing", "apikey:anyone") {
+        t.Error("an unparseable value should disable the flag")
+    }
+}
+
+func TestFeatureDefaults(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    if IsEnabled(featurePricingV2, "apikey:acme") || !IsEnabled(featureRegionRouting, "apikey:acme") {
+        t.Fatal("unset flags should take their defaults")
+    }
+    if IsEnabled("unknown", "apikey:acme") {
+        t.Fatal("unknown unset flags should be off")
+    }
+}
+
+func TestAdminFeatures(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    r := newRouter()
+    auth := []string{"Authorization", "Bearer secret"}
+
+    if w := do(r, http.MethodPut, "/admin/features/"+featurePricingV2, `{"value":"percent:200"}`, auth...); w.Code != http.StatusBadRequest {
+        t.Fatalf("bad value: status = %d, want 400", w.Code)
+    }
+    if w := do(r, http.MethodPut, "/admin/features/"+featurePricingV2, `{"value":"true"}`); w.Code != http.StatusUnauthorized {
+        t.Fatalf("no token: status = %d, want 401", w.Code)
+    }
+    if w := do(r, http.MethodPut, "/admin/features/"+featurePricingV2, `{"value":"true"}`, auth...); w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+    // Applied without waiting for the refresh
+    if !IsEnabled(featurePricingV2, "apikey:acme") {
+        t.Fatal("flag not applied on this replica")
+    }
+    if v := rdb.HGet(ctx, featureFlagsKey, featurePricingV2).Val(); v != "true" {
+        t.Fatalf("stored value = %q, want true", v)
+    }
+
+    w := do(r, http.MethodGet, "/admin/features", "", auth...)
+    var resp struct {
+        Features map[string]featureState `json:"features"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if got := resp.Features[featurePricingV2]; got.Value != "true" || !got.Known {
+        t.Errorf("pricing_v2 = %+v, want value true, known", got)
+    }
+    if got, ok := resp.Features[featureRegionRouting]; !ok || got.Value != "" || !got.Default {
+        t.Errorf("region_routing = %+v, want unset with default true", got)
+    }
+}
+
+func TestPricingV2Payload(t *testing.T) {
+    setupTest(t, func(c *Config) { c.FairScheduling = false })
+    r := newRouter()
+    _, before, _ := quoteJobID(t, r, regionQuote)
+    setFeature(t, featurePricingV2, "true")
+    _, after, _ := quoteJobID(t, r, regionQuote)
+
+    read := func(id string) map[string]interface{} {
+        payload, _ := rdb.Get(ctx, "params:"+id).Bytes()
+        job, err := readPayload(payload)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return job
+    }
+    if _, ok := read(before)["features"]; ok {
+        t.Errorf("job before the rollout has features: %v", read(before))
+    }
+    job := read(after)
+    if fs, _ := job["features"].([]interface{}); len(fs) != 1 || fs[0] != featurePricingV2 {
+        t.Errorf("features = %v, want [pricing_v2]", job["features"])
+    }
+    if before == after || read(before)["cache_key"] == job["cache_key"] {
+        t.Error("jobs on either side of the rollout share a slice cache entry")
+    }
+}
+
+func TestRegionRoutingFlagOff(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.RegionRoutingEnabled = true
+        c.FairScheduling = false
+    })
+    setFeature(t, featureRegionRouting, "false")
+    if code, _, _ := quoteJobID(t, newRouter(), regionQuote); code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202", code)
+    }
+    if n := rdb.LLen(ctx, standardQueue).Val(); n != 1 {
+        t.Fatalf("print_jobs has %d jobs, want 1 with region routing flagged off", n)
+    }
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+    "encoding/json"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// requestedFields is ?fields=, the comma-separated JSON keys the client
+// wants, or nil for the whole response.
+func requestedFields(c *gin.Context) []string {
+    var fields []string
+    for _, f := range strings.Split(c.Query("fields"), ",") {
+        if f = strings.TrimSpace(f); f != "" {
+            fields = append(fields, f)
+        }
+    }
+    return fields
+}
+
+// selectFields trims v, a response body, to the top-level keys in fields;
+// nil fields leaves it whole. Keys are picked from v as it would be
+// encoded, so only what the response already shows can be asked for: fields
+// left out of the JSON can't be named. Unknown keys are ignored.
+func selectFields(v interface{}, fields []string) interface{} {
+    if fields == nil {
+        return v
+    }
+    raw, err := json.Marshal(v)
+    if err != nil {
+        return v
+    }
+    var all map[string]json.RawMessage
+    if err := json.Unmarshal(raw, &all); err != nil {
+        return v
+    }
+    picked := make(map[string]json.RawMessage, len(fields))
+    for _, f := range fields {
+        if value, ok := all[f]; ok {
+            picked[f] = value
+        }
+    }
+    return picked
+}
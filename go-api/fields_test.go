@@ -0,0 +1,119 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "testing"
+    "time"
+
+    "slicer-api/internal/api"
+)
+
+func decodeKeys(t *testing.T, body []byte) map[string]json.RawMessage {
+    t.Helper()
+    var got map[string]json.RawMessage
+    if err := json.Unmarshal(body, &got); err != nil {
+        t.Fatal(err)
+    }
+    return got
+}
+
+func keys(m map[string]json.RawMessage) []string {
+    var ks []string
+    for k := range m {
+        ks = append(ks, k)
+    }
+    return ks
+}
+
+func TestStatusFields(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    _, jobID, _ := quoteJobID(t, r, dedupeQuote)
+
+    got := decodeKeys(t, do(r, http.MethodGet, "/status/"+jobID+"?fields=status,+job_id,nope", "").Body.Bytes())
+    if len(got) != 2 || string(got["status"]) != `"queued"` || string(got["job_id"]) != `"`+jobID+`"` {
+        t.Errorf("fields=status,job_id = %v, want only those keys", keys(got))
+    }
+
+    full := decodeKeys(t, do(r, http.MethodGet, "/status/"+jobID, "").Body.Bytes())
+    for _, query := range []string{"?fields=", "?fields=,"} {
+        if got := decodeKeys(t, do(r, http.MethodGet, "/status/"+jobID+query, "").Body.Bytes()); len(got) != len(full) {
+            t.Errorf("%s = %v, want the full response %v", query, keys(got), keys(full))
+        }
+    }
+}
+
+func TestStatusFieldsETag(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    _, jobID, _ := quoteJobID(t, r, dedupeQuote)
+
+    full := do(r, http.MethodGet, "/status/"+jobID, "").Header().Get("ETag")
+    trimmed := do(r, http.MethodGet, "/status/"+jobID+"?fields=status", "").Header().Get("ETag")
+    if full == trimmed {
+        t.Errorf("ETag %s is the same for the full and trimmed response", full)
+    }
+}
+
+func TestStatusFieldsHidesInternals(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    _, jobID, _ := quoteJobID(t, r, dedupeQuote)
+    reportStatus(t, r, jobID, `{"status":"completed","result":{"price":1}}`)
+
+    w := do(r, http.MethodGet, "/status/"+jobID+"?fields=access_token,owner_id,callback_secret,params,result,raw", "")
+    if got := decodeKeys(t, w.Body.Bytes()); len(got) != 0 {
+        t.Errorf("internal fields came back: %v", keys(got))
+    }
+    w = do(r, http.MethodGet, "/status/"+jobID+"?fields=data", "")
+    if got := decodeKeys(t, w.Body.Bytes()); len(got) != 1 || got["data"] == nil {
+        t.Errorf("fields=data = %v, want the result", keys(got))
+    }
+}
+
+func TestSelectFieldsSkipsHiddenFields(t *testing.T) {
+    type record struct {
+        ID     string `json:"id"`
+        Secret string `json:"-"`
+        owner  string
+    }
+    v := record{ID: "j1", Secret: "token", owner: "acme"}
+
+    got := selectFields(v, []string{"id", "Secret", "-", "secret", "owner"})
+    if want := map[string]json.RawMessage{"id": json.RawMessage(`"j1"`)}; !reflect.DeepEqual(got, want) {
+        t.Errorf("selectFields = %v, want only id", got)
+    }
+    if got := selectFields(v, nil); got != v {
+        t.Errorf("selectFields(nil) = %v, want v as is", got)
+    }
+}
+
+func TestListJobsFields(t *testing.T) {
+    r := jobListTestRouter(t)
+    base := time.Now().Add(-time.Hour)
+    seedJob("a", "apikey:acme", base)
+    seedJob("b", "apikey:acme", base.Add(time.Second))
+
+    w := do(r, http.MethodGet, "/jobs?limit=1&fields=job_id,owner_id", "", "Authorization", "Bearer k1")
+    var resp struct {
+        Jobs       []map[string]json.RawMessage `json:"jobs"`
+        NextCursor *string                      `json:"next_cursor"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    }
+    if len(resp.Jobs) != 1 || len(resp.Jobs[0]) != 1 || string(resp.Jobs[0]["job_id"]) != `"b"` {
+        t.Errorf("jobs = %v, want only job_id", resp.Jobs)
+    }
+    if resp.NextCursor == nil {
+        t.Fatal("next_cursor dropped by ?fields=")
+    }
+
+    var page api.JobListResponse
+    json.Unmarshal(do(r, http.MethodGet, "/jobs?cursor="+*resp.NextCursor+"&fields=status", "", "Authorization", "Bearer k1").Body.Bytes(), &page)
+    if len(page.Jobs) != 1 || page.Jobs[0].JobID != "" || page.Jobs[0].Status != "queued" {
+        t.Errorf("second page = %+v, want only a's status", page.Jobs)
+    }
+}
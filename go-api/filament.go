@@ -0,0 +1,89 @@
+package main
+
+import (
+    "fmt"
+    "math"
+
+    "slicer-api/internal/api"
+)
+
+// filamentAreaCM2 is the cross-section of the 1.75 mm filament the slicer
+// profiles use.
+var filamentAreaCM2 = math.Pi * 0.0875 * 0.0875
+
+// normalizeFilament gathers the filament use a worker reported, in any of
+// the shapes workers have written, into an api.Filament, deriving what's
+// missing. Grams and volume convert through the material's density, so
+// they can't be derived for materials without a profile. It returns nil if
+// the worker reported none.
+func normalizeFilament(w workerResult) (*api.Filament, error) {
+    // The bundled worker's pricing block has 0 when it didn't measure
+    legacyGrams := w.Pricing.FilamentWeightGrams
+    if legacyGrams != nil && *legacyGrams == 0 {
+        legacyGrams = nil
+    }
+    var legacyMeters *float64
+    if mm := w.Slicing.FilamentUsedMM; mm != nil {
+        m := *mm / 1000
+        legacyMeters = &m
+    }
+    grams := firstSet(w.Filament.Grams, w.FilamentGrams, w.Slicing.FilamentUsedGrams, legacyGrams)
+    meters := firstSet(w.Filament.Meters, w.FilamentMeters, legacyMeters)
+    cm3 := firstSet(w.Filament.CM3, w.FilamentCM3)
+    for name, v := range map[string]*float64{"filament grams": grams, "filament meters": meters, "filament cm3": cm3} {
+        if v != nil && (math.IsNaN(*v) || math.IsInf(*v, 0) || *v < 0) {
+            return nil, fmt.Errorf("%s %v is out of range", name, *v)
+        }
+    }
+    if grams == nil && meters == nil && cm3 == nil {
+        return nil, nil
+    }
+
+    f := &api.Filament{Measured: []string{}, Derived: []string{}}
+    for _, m := range []struct {
+        name string
+        v    *float64
+    }{{"grams", grams}, {"meters", meters}, {"cm3", cm3}} {
+        if m.v != nil {
+            f.Measured = append(f.Measured, m.name)
+        }
+    }
+    derive := func(name string, v float64) *float64 {
+        f.Derived = append(f.Derived, name)
+        return &v
+    }
+
+    var material MaterialProfile
+    known := false
+    for _, name := range []string{w.Material, w.Summary.Material, w.Pricing.Material} {
+        if name != "" {
+            material, known = findMaterial(name)
+            break
+        }
+    }
+    if cm3 == nil && meters != nil {
+        cm3 = derive("cm3", *meters*100*filamentAreaCM2)
+    }
+    if cm3 == nil && known {
+        cm3 = derive("cm3", *grams/material.DensityGPerCM3)
+    }
+    if grams == nil && cm3 != nil && known {
+        grams = derive("grams", *cm3*material.DensityGPerCM3)
+    }
+    if meters == nil && cm3 != nil {
+        meters = derive("meters", *cm3/filamentAreaCM2/100)
+    }
+    if grams != nil && known {
+        f.Cost = derive("cost", roundCents(*grams*material.CostPerGram))
+    }
+    f.Grams, f.Meters, f.CM3 = rounded(grams), rounded(meters), rounded(cm3)
+    return f, nil
+}
+
+func rounded(v *float64) *float64 {
+    if v == nil {
+        return nil
+    }
+    r := round2(*v)
+    return &r
+}
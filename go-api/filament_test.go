@@ -0,0 +1,66 @@
+package main
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// Each shape of filament use workers have reported, as recorded results.
+func TestNormalizeFilamentFixtures(t *testing.T) {
+    tests := []struct {
+        file, want string
+    }{
+        // The bundled worker's pricing block, grams only
+        {"v1_pricing.json", `{"grams":25.4,"meters":8.32,"cm3":20,"cost":0.71,"measured":["grams"],"derived":["cm3","meters","cost"]}`},
+        // ... which had 0 when it didn't measure
+        {"v1_pricing_unmeasured.json", `null`},
+        // Its slicing block, in millimetres
+        {"v1_slicing.json", `{"grams":12.4,"meters":4.16,"cm3":10,"cost":0.31,"measured":["grams","meters"],"derived":["cm3","cost"]}`},
+        // Typed results without a material can't be weighed or priced
+        {"v2_typed.json", `{"grams":40.2,"meters":13.1,"cm3":31.51,"measured":["grams","meters"],"derived":["cm3"]}`},
+        {"v2_cm3.json", `{"grams":10.4,"meters":4.16,"cm3":10,"cost":0.25,"measured":["cm3"],"derived":["grams","meters","cost"]}`},
+        {"v3_filament.json", `{"grams":3.7,"meters":1.24,"cm3":2.98,"cost":0.09,"measured":["grams","meters","cm3"],"derived":["cost"]}`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.file, func(t *testing.T) {
+            raw, err := os.ReadFile(filepath.Join("testdata", "results", tt.file))
+            if err != nil {
+                t.Fatal(err)
+            }
+            r, err := parseResult(raw)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got, _ := json.Marshal(r.Filament); string(got) != tt.want {
+                t.Errorf("filament = %s, want %s", got, tt.want)
+            }
+            if r.Filament != nil && (r.FilamentGrams != r.Filament.Grams || r.FilamentMeters != r.Filament.Meters) {
+                t.Errorf("filament_grams, filament_meters = %v, %v; want filament's", r.FilamentGrams, r.FilamentMeters)
+            }
+        })
+    }
+}
+
+func TestNormalizeFilamentPrefersNewestShape(t *testing.T) {
+    r, err := parseResult([]byte(`{"material":"PLA","filament":{"grams":5},"filament_grams":6,"pricing":{"filament_weight_grams":7}}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if *r.Filament.Grams != 5 {
+        t.Errorf("grams = %v, want filament.grams over the older fields", *r.Filament.Grams)
+    }
+}
+
+func TestNormalizeFilamentRejects(t *testing.T) {
+    for _, raw := range []string{
+        `{"filament":{"cm3":-1}}`,
+        `{"slicing":{"filament_used_mm":-10}}`,
+        `{"pricing":{"filament_weight_grams":-2}}`,
+    } {
+        if r, err := parseResult([]byte(raw)); err == nil {
+            t.Errorf("%s: accepted as %+v", raw, r.Filament)
+        }
+    }
+}
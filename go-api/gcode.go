@@ -0,0 +1,101 @@
+package main
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Workers upload a completed job's G-code and put its location in the
+// result as gcode_url, which /status doesn't show. Customers download it
+// through GET /jobs/:id/gcode once they have accepted the quote, which
+// sets accepted_at:{id} for as long as the job's other keys last.
+func acceptedKey(jobID string) string {
+    return "accepted_at:" + jobID
+}
+
+// Reasons a G-code download gets 404.
+const (
+    gcodeJobNotFound  = "job_not_found"
+    gcodeNotGenerated = "not_generated"
+    gcodeExpired      = "expired"
+)
+
+// POST /jobs/:id/accept accepts a completed job's quote. Accepting again
+// keeps the first time.
+func handleAcceptQuote(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    status, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if !authorizeJob(c, jobID) {
+        return
+    }
+    if status != string(StatusCompleted) {
+        c.JSON(http.StatusConflict, gin.H{"error": "Only completed quotes can be accepted", "status": status})
+        return
+    }
+
+    now := time.Now().UTC().Format(time.RFC3339)
+    first, err := rdb.SetNX(ctx, acceptedKey(jobID), now, jobTTL(ctx, jobID)).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    acceptedAt := now
+    if !first {
+        acceptedAt, _ = rdb.Get(ctx, acceptedKey(jobID)).Result()
+    } else {
+        recordHistory(ctx, jobID, "accepted", "")
+        audit.Record(ctx, auditEventFor(c, auditQuoteAccepted, jobID, requestOwner(c)))
+    }
+    c.JSON(http.StatusOK, gin.H{"job_id": jobID, "accepted_at": acceptedAt})
+}
+
+// GET /jobs/:id/gcode downloads an accepted job's G-code, with the same
+// credentials as cancelling it. GET /jobs/:id/result is its older name.
+func handleJobGcode(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    status, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err == redis.Nil {
+        gcodeMissing(c, gcodeJobNotFound, "Job not found")
+        return
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if !authorizeJob(c, jobID) {
+        return
+    }
+    if status != string(StatusCompleted) {
+        c.JSON(http.StatusConflict, gin.H{"error": "Only completed jobs have G-code", "status": status})
+        return
+    }
+    if n, err := rdb.Exists(ctx, acceptedKey(jobID)).Result(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    } else if n == 0 {
+        c.JSON(http.StatusForbidden, api.ErrorResponse{Error: "Accept the quote with POST /jobs/" + jobID + "/accept to download its G-code"})
+        return
+    }
+
+    url, err := gcodeURL(ctx, jobID)
+    if err == redis.Nil || (err == nil && url == "") {
+        gcodeMissing(c, gcodeNotGenerated, "The worker stored no G-code for this job")
+        return
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    proxyGcode(c, jobID, url)
+}
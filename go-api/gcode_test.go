@@ -0,0 +1,133 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// gcodeStorage serves gcode at /job.gcode with byte ranges, as tmpfiles.org
+// does, and 404 for anything else.
+func gcodeStorage(t *testing.T, gcode string) *httptest.Server {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/job.gcode" {
+            http.NotFound(w, r)
+            return
+        }
+        http.ServeContent(w, r, "job.gcode", time.Time{}, strings.NewReader(gcode))
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+// completeWithGcode submits a quote and completes it with a result pointing
+// at gcodeURL, returning the job and its access token.
+func completeWithGcode(t *testing.T, r http.Handler, gcodeURL string) (string, string) {
+    t.Helper()
+    jobID, token := submitForCancel(t, r)
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    result, _ := json.Marshal(map[string]interface{}{"summary": map[string]float64{"total_cost": 12.5}, "gcode_url": gcodeURL})
+    if code := reportStatus(t, r, jobID, `{"status":"completed","result":`+string(result)+`}`); code != http.StatusOK {
+        t.Fatalf("completing: status = %d", code)
+    }
+    return jobID, token
+}
+
+func TestGcodeDownloadAfterAccepting(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    gcode := "; generated by PrusaSlicer\nG28\nG1 X10 Y10\n"
+    srv := gcodeStorage(t, gcode)
+    jobID, token := completeWithGcode(t, r, srv.URL+"/job.gcode")
+
+    w := do(r, http.MethodGet, "/status/"+jobID, "")
+    if !strings.Contains(w.Body.String(), `"gcode_available":true`) || strings.Contains(w.Body.String(), srv.URL) {
+        t.Errorf("status = %s, want gcode_available without the storage URL", w.Body)
+    }
+
+    path := "/jobs/" + jobID + "/gcode"
+    if w := do(r, http.MethodGet, path, ""); w.Code != http.StatusForbidden {
+        t.Errorf("without a token: status = %d, want 403", w.Code)
+    }
+    if w := do(r, http.MethodGet, path, "", jobTokenHeader, token); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "/accept") {
+        t.Errorf("before accepting: status = %d %s, want 403 pointing at /accept", w.Code, w.Body)
+    }
+    if w := do(r, http.MethodPost, "/jobs/"+jobID+"/accept", "", jobTokenHeader, "wrong"); w.Code != http.StatusForbidden {
+        t.Errorf("accepting with a wrong token: status = %d, want 403", w.Code)
+    }
+
+    w = do(r, http.MethodPost, "/jobs/"+jobID+"/accept", "", jobTokenHeader, token)
+    var accepted struct {
+        AcceptedAt string `json:"accepted_at"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &accepted)
+    if w.Code != http.StatusOK || accepted.AcceptedAt == "" {
+        t.Fatalf("accept: status = %d %s", w.Code, w.Body)
+    }
+    if again := do(r, http.MethodPost, "/jobs/"+jobID+"/accept", "", jobTokenHeader, token); !strings.Contains(again.Body.String(), accepted.AcceptedAt) {
+        t.Errorf("accepting again = %s, want the first accepted_at", again.Body)
+    }
+    if ttl := rdb.TTL(ctx, acceptedKey(jobID)).Val(); ttl <= 0 {
+        t.Errorf("accepted_at TTL = %v, want it to expire with the job", ttl)
+    }
+
+    w = do(r, http.MethodGet, path, "", jobTokenHeader, token)
+    if w.Code != http.StatusOK || w.Body.String() != gcode {
+        t.Fatalf("download: status = %d, body %q", w.Code, w.Body)
+    }
+    if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="`+jobID+`.gcode"` {
+        t.Errorf("Content-Disposition = %q", cd)
+    }
+
+    w = do(r, http.MethodGet, path, "", jobTokenHeader, token, "Range", "bytes=0-4")
+    if w.Code != http.StatusPartialContent || w.Body.String() != gcode[:5] || w.Header().Get("Content-Range") != "bytes 0-4/"+strconv.Itoa(len(gcode)) {
+        t.Errorf("range: status = %d, body %q, Content-Range %q", w.Code, w.Body, w.Header().Get("Content-Range"))
+    }
+
+    // The older route has the same checks
+    if w := do(r, http.MethodGet, "/jobs/"+jobID+"/result", ""); w.Code != http.StatusForbidden {
+        t.Errorf("/result without a token: status = %d, want 403", w.Code)
+    }
+}
+
+func TestGcodeMissingReasons(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret, c.DuplicateWindowSeconds = "s", 0 })
+    r := newRouter()
+    srv := gcodeStorage(t, "G28\n")
+
+    reason := func(w *httptest.ResponseRecorder) string {
+        var body struct {
+            Reason string `json:"reason"`
+        }
+        json.Unmarshal(w.Body.Bytes(), &body)
+        return body.Reason
+    }
+
+    if w := do(r, http.MethodGet, "/jobs/nope/gcode", ""); w.Code != http.StatusNotFound || reason(w) != gcodeJobNotFound {
+        t.Errorf("unknown job: %d %s", w.Code, w.Body)
+    }
+    for url, want := range map[string]string{
+        "":                      gcodeNotGenerated,
+        srv.URL + "/gone.gcode": gcodeExpired,
+    } {
+        jobID, token := completeWithGcode(t, r, url)
+        do(r, http.MethodPost, "/jobs/"+jobID+"/accept", "", jobTokenHeader, token)
+        w := do(r, http.MethodGet, "/jobs/"+jobID+"/gcode", "", jobTokenHeader, token)
+        if w.Code != http.StatusNotFound || reason(w) != want {
+            t.Errorf("gcode_url %q: %d %s, want 404 with reason %s", url, w.Code, w.Body, want)
+        }
+    }
+
+    jobID, token := submitForCancel(t, r)
+    if w := do(r, http.MethodPost, "/jobs/"+jobID+"/accept", "", jobTokenHeader, token); w.Code != http.StatusConflict {
+        t.Errorf("accepting a queued job: status = %d, want 409", w.Code)
+    }
+    if w := do(r, http.MethodGet, "/jobs/"+jobID+"/gcode", "", jobTokenHeader, token); w.Code != http.StatusConflict || !bytes.Contains(w.Body.Bytes(), []byte(`"queued"`)) {
+        t.Errorf("queued job's G-code: %d %s, want 409", w.Code, w.Body)
+    }
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "log"
+    "net"
+    "net/http"
+    "net/url"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/peer"
+    "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/types/known/structpb"
+
+    pb "slicer-api/internal/proto"
+)
+
+// The gRPC PrintJobService (internal/proto/printjob.proto) serves each unary
+// call through the REST router in process, as the request its REST route
+// would get, so API keys, job tokens, quotas, idempotency and validation are
+// the very same code. WatchStatus checks access the same way and then
+// follows the job with the watcher behind /status/:id/stream.
+
+// grpcHeaders are the metadata keys passed on to the router as headers.
+var grpcHeaders = []string{"authorization", "x-job-token", "idempotency-key"}
+
+type grpcServer struct {
+    pb.UnimplementedPrintJobServiceServer
+    rest http.Handler
+}
+
+func newGRPCServer(rest http.Handler) *grpc.Server {
+    srv := grpc.NewServer()
+    pb.RegisterPrintJobServiceServer(srv, &grpcServer{rest: rest})
+    return srv
+}
+
+// startGRPC serves PrintJobService on GRPC_ADDR, unless it is empty.
+func startGRPC(rest http.Handler) {
+    addr := cfg().GRPCAddr
+    if addr == "" {
+        return
+    }
+    lis, err := net.Listen("tcp", addr)
+    if err != nil {
+        panic("Failed to listen for gRPC: " + err.Error())
+    }
+    log.Printf("INFO gRPC PrintJobService listening on %s", addr)
+    go func() {
+        if err := newGRPCServer(rest).Serve(lis); err != nil {
+            log.Printf("ERROR gRPC server stopped: %v", err)
+        }
+    }()
+}
+
+// grpcResponse records what the router answers.
+type grpcResponse struct {
+    header http.Header
+    code   int
+    body   bytes.Buffer
+}
+
+func (w *grpcResponse) Header() http.Header         { return w.header }
+func (w *grpcResponse) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *grpcResponse) WriteHeader(code int) {
+    if w.code == 0 {
+        w.code = code
+    }
+}
+
+// call makes the RPC's REST request and returns the decoded JSON body, or
+// the error status the REST status code maps to.
+func (s *grpcServer) call(ctx context.Context, method, path string, body interface{}, extra ...string) (gin.H, error) {
+    var data []byte
+    if body != nil {
+        data, _ = json.Marshal(body)
+    }
+    req, err := http.NewRequestWithContext(ctx, method, path, bytes.NewReader(data))
+    if err != nil {
+        return nil, status.Error(codes.InvalidArgument, err.Error())
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    md, _ := metadata.FromIncomingContext(ctx)
+    for _, key := range grpcHeaders {
+        if v := md.Get(key); len(v) > 0 {
+            req.Header.Set(key, v[0])
+        }
+    }
+    for i := 0; i+1 < len(extra); i += 2 {
+        if extra[i+1] != "" {
+            req.Header.Set(extra[i], extra[i+1])
+        }
+    }
+    // Peers that aren't on TCP, such as unix sockets, are local
+    req.RemoteAddr = "127.0.0.1:0"
+    if p, ok := peer.FromContext(ctx); ok {
+        if tcp, ok := p.Addr.(*net.TCPAddr); ok {
+            req.RemoteAddr = tcp.String()
+        }
+    }
+
+    w := &grpcResponse{header: http.Header{}}
+    s.rest.ServeHTTP(w, req)
+    if w.code == 0 {
+        w.code = http.StatusOK
+    }
+    resp := gin.H{}
+    json.Unmarshal(w.body.Bytes(), &resp)
+    if w.code >= 400 {
+        msg, _ := resp["error"].(string)
+        if msg == "" {
+            msg = http.StatusText(w.code)
+        }
+        return nil, status.Error(grpcCode(w.code), msg)
+    }
+    return resp, nil
+}
+
+// grpcCode is the gRPC status for a REST error status.
+func grpcCode(httpStatus int) codes.Code {
+    switch httpStatus {
+    case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+        return codes.InvalidArgument
+    case http.StatusUnauthorized:
+        return codes.Unauthenticated
+    case http.StatusForbidden:
+        return codes.PermissionDenied
+    case http.StatusNotFound:
+        return codes.NotFound
+    case http.StatusConflict, http.StatusUnprocessableEntity:
+        return codes.FailedPrecondition
+    case http.StatusTooManyRequests, http.StatusPaymentRequired:
+        return codes.ResourceExhausted
+    case http.StatusServiceUnavailable:
+        return codes.Unavailable
+    case http.StatusGatewayTimeout:
+        return codes.DeadlineExceeded
+    }
+    return codes.Internal
+}
+
+// SubmitJob is POST /quote.
+func (s *grpcServer) SubmitJob(ctx context.Context, req *pb.SubmitJobRequest) (*pb.SubmitJobResponse, error) {
+    body := gin.H{
+        "download_url":    req.DownloadUrl,
+        "material":        req.Material,
+        "layer_height":    req.LayerHeight,
+        "nozzle":          req.Nozzle,
+        "infill":          req.Infill,
+        "rush":            req.Rush,
+        "no_cache":        req.NoCache,
+        "region":          req.Region,
+        "callback_url":    req.CallbackUrl,
+        "callback_secret": req.CallbackSecret,
+    }
+    if req.MaxRetries != nil {
+        body["max_retries"] = *req.MaxRetries
+    }
+    if req.SubmitAt != "" {
+        body["submit_at"] = req.SubmitAt
+    }
+    resp, err := s.call(ctx, http.MethodPost, "/v1/quote", body, idempotencyHeader, req.IdempotencyKey)
+    if err != nil {
+        return nil, err
+    }
+    out := &pb.SubmitJobResponse{}
+    out.JobId, _ = resp["job_id"].(string)
+    out.AccessToken, _ = resp["access_token"].(string)
+    out.Message, _ = resp["message"].(string)
+    out.WorkerOnline, _ = resp["worker_online"].(bool)
+    out.SubmitAt, _ = resp["submit_at"].(string)
+    return out, nil
+}
+
+// GetStatus is GET /status/:id.
+func (s *grpcServer) GetStatus(ctx context.Context, req *pb.GetStatusRequest) (*pb.StatusResponse, error) {
+    resp, err := s.call(ctx, http.MethodGet, "/v1/status/"+url.PathEscape(req.JobId), nil)
+    if err != nil {
+        return nil, err
+    }
+    return grpcStatus(req.JobId, resp), nil
+}
+
+// CancelJob is DELETE /jobs/:id.
+func (s *grpcServer) CancelJob(ctx context.Context, req *pb.CancelJobRequest) (*pb.CancelJobResponse, error) {
+    path := "/jobs/" + url.PathEscape(req.JobId)
+    if req.Force {
+        path += "?force=true"
+    }
+    resp, err := s.call(ctx, http.MethodDelete, path, nil)
+    if err != nil {
+        return nil, err
+    }
+    out := &pb.CancelJobResponse{JobId: req.JobId}
+    out.Status, _ = resp["status"].(string)
+    return out, nil
+}
+
+// WatchStatus sends the job's status and then each change, like
+// /status/:id/stream, ending once the job finishes.
+func (s *grpcServer) WatchStatus(req *pb.WatchStatusRequest, stream pb.PrintJobService_WatchStatusServer) error {
+    ctx := stream.Context()
+    // Credentials are checked, and unknown jobs refused, as on /status
+    if _, err := s.call(ctx, http.MethodGet, "/v1/status/"+url.PathEscape(req.JobId), nil); err != nil {
+        return err
+    }
+    sub, snap, err := subscribeStatus(ctx, req.JobId)
+    if err == redis.Nil {
+        return status.Error(codes.NotFound, "Job not found")
+    } else if err != nil {
+        return status.Error(codes.Internal, "Redis error")
+    }
+    defer sub.Close()
+
+    var failed error
+    watchStatus(ctx, sub, req.JobId, snap, func(ev statusEvent) bool {
+        switch ev.Kind {
+        case "status":
+            return stream.Send(grpcStatus(req.JobId, ev.Snap)) == nil
+        case "end":
+            if ev.Detail == "expired" {
+                stream.Send(&pb.StatusResponse{JobId: req.JobId, Status: ev.Detail, Position: -1})
+            }
+            return false
+        case "heartbeat":
+            return true
+        default:
+            failed = status.Error(codes.Internal, ev.Detail)
+            return false
+        }
+    })
+    if failed == nil && ctx.Err() != nil {
+        return status.FromContextError(ctx.Err()).Err()
+    }
+    return failed
+}
+
+// grpcStatus converts a /status body or stream snapshot.
+func grpcStatus(jobID string, body gin.H) *pb.StatusResponse {
+    out := &pb.StatusResponse{JobId: jobID, Position: -1}
+    out.Status, _ = body["status"].(string)
+    out.Note, _ = body["note"].(string)
+    out.CurrentStep, _ = body["current_step"].(string)
+    out.Cached, _ = body["cached"].(bool)
+    if n, ok := grpcNumber(body["attempts"]); ok {
+        out.Attempts = int32(n)
+    }
+    if n, ok := grpcNumber(body["progress_percent"]); ok {
+        out.ProgressPercent = n
+    }
+    if n, ok := grpcNumber(body["position"]); ok {
+        out.Position = int64(n)
+    }
+    if data, ok := body["data"]; ok {
+        // Snapshots hold the result as a Result; round trip it to JSON's
+        if raw, err := json.Marshal(data); err == nil {
+            var plain map[string]interface{}
+            json.Unmarshal(raw, &plain)
+            out.Data, _ = structpb.NewStruct(plain)
+        }
+    }
+    return out
+}
+
+// grpcNumber reads a number from a decoded JSON body or a snapshot.
+func grpcNumber(v interface{}) (float64, bool) {
+    switch n := v.(type) {
+    case float64:
+        return n, true
+    case int:
+        return float64(n), true
+    case int64:
+        return float64(n), true
+    }
+    return 0, false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+    "context"
+    "io"
+    "net"
+    "testing"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+    "google.golang.org/grpc/test/bufconn"
+
+    pb "slicer-api/internal/proto"
+)
+
+// grpcClient serves PrintJobService over an in-memory connection with the
+// REST router r behind it.
+func grpcClient(t *testing.T) pb.PrintJobServiceClient {
+    t.Helper()
+    lis := bufconn.Listen(1 << 20)
+    srv := newGRPCServer(newRouter())
+    go srv.Serve(lis)
+    t.Cleanup(srv.Stop)
+    conn, err := grpc.NewClient("passthrough:///bufconn",
+        grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+        grpc.WithTransportCredentials(insecure.NewCredentials()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    return pb.NewPrintJobServiceClient(conn)
+}
+
+func TestGRPCSubmitStatusCancel(t *testing.T) {
+    setupTest(t)
+    client := grpcClient(t)
+
+    sub, err := client.SubmitJob(ctx, &pb.SubmitJobRequest{DownloadUrl: "https://example.com/part.stl", Material: "PLA", Infill: 20})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if sub.JobId == "" || sub.AccessToken == "" {
+        t.Fatalf("submit = %+v, want a job ID and access token", sub)
+    }
+    if _, err := client.SubmitJob(ctx, &pb.SubmitJobRequest{Material: "PLA", Infill: 20}); status.Code(err) != codes.InvalidArgument {
+        t.Errorf("submit without download_url: %v, want InvalidArgument", err)
+    }
+
+    // Anonymous jobs need their token, as on REST
+    if _, err := client.CancelJob(ctx, &pb.CancelJobRequest{JobId: sub.JobId}); status.Code(err) != codes.PermissionDenied {
+        t.Errorf("cancel without token: %v, want PermissionDenied", err)
+    }
+    withToken := metadata.AppendToOutgoingContext(ctx, "x-job-token", sub.AccessToken)
+    st, err := client.GetStatus(withToken, &pb.GetStatusRequest{JobId: sub.JobId})
+    if err != nil || st.Status != "queued" || st.Position < 0 {
+        t.Fatalf("status = %+v, %v; want queued with a position", st, err)
+    }
+    cancelled, err := client.CancelJob(withToken, &pb.CancelJobRequest{JobId: sub.JobId})
+    if err != nil || cancelled.Status != "cancelled" {
+        t.Fatalf("cancel = %+v, %v; want cancelled", cancelled, err)
+    }
+    if _, err := client.GetStatus(ctx, &pb.GetStatusRequest{JobId: "nope"}); status.Code(err) != codes.NotFound {
+        t.Errorf("unknown job: %v, want NotFound", err)
+    }
+}
+
+func TestGRPCPassesCredentials(t *testing.T) {
+    setupTest(t, func(c *Config) { c.APIKeys = map[string]string{"k1": "acme"} })
+    client := grpcClient(t)
+
+    bad := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong")
+    if _, err := client.GetStatus(bad, &pb.GetStatusRequest{JobId: "j1"}); status.Code(err) != codes.Unauthenticated {
+        t.Errorf("wrong key: %v, want Unauthenticated", err)
+    }
+    good := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer k1")
+    sub, err := client.SubmitJob(good, &pb.SubmitJobRequest{DownloadUrl: "https://example.com/part.stl", Material: "PLA", Infill: 20})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if owner := jobOwner(ctx, sub.JobId); owner != "apikey:acme" {
+        t.Errorf("owner = %q, want apikey:acme", owner)
+    }
+}
+
+func TestGRPCWatchStatus(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    client := grpcClient(t)
+    rdb.Set(ctx, "status:j1", "queued", 0)
+
+    stream, err := client.WatchStatus(ctx, &pb.WatchStatusRequest{JobId: "j1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    first, err := stream.Recv()
+    if err != nil || first.Status != "queued" {
+        t.Fatalf("first = %+v, %v; want queued", first, err)
+    }
+    reportStatus(t, r, "j1", `{"status":"processing"}`)
+    reportStatus(t, r, "j1", `{"status":"completed","result":{"price":12.5}}`)
+
+    var last *pb.StatusResponse
+    for {
+        msg, err := stream.Recv()
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            t.Fatal(err)
+        }
+        last = msg
+    }
+    if last == nil || last.Status != "completed" || last.Data.AsMap()["price"] != 12.5 {
+        t.Fatalf("last = %+v, want completed with its result", last)
+    }
+
+    unknown, _ := client.WatchStatus(ctx, &pb.WatchStatusRequest{JobId: "nope"})
+    if _, err := unknown.Recv(); status.Code(err) != codes.NotFound {
+        t.Errorf("unknown job: %v, want NotFound", err)
+    }
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// GET /health/live answers as long as the server does, so a Redis hiccup
+// doesn't get the pod restarted.
+func handleLive(c *gin.Context) {
+    c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readinessCheck tries one dependency within ctx.
+type readinessCheck struct {
+    name  string
+    check func(ctx context.Context) error
+}
+
+var readinessChecks = []readinessCheck{
+    {"redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() }},
+    {"storage", checkStorage},
+}
+
+// checkStorage asks the configured storage backend whether it can take
+// uploads.
+func checkStorage(ctx context.Context) error {
+    return activeStorage().Check(ctx)
+}
+
+// readinessResult is one run of the checks, reused by probes for
+// READINESS_CACHE_SECONDS. failed holds the names of checks that didn't
+// pass; their errors go to the log, not to whoever probes.
+type readinessResult struct {
+    failed  map[string]bool
+    checked time.Time
+}
+
+type readinessCache struct {
+    mu   sync.Mutex
+    last *readinessResult
+}
+
+var readiness = &readinessCache{}
+
+// get runs the checks, in parallel and each within
+// READINESS_CHECK_TIMEOUT_MS, unless the last run is recent enough. Probes
+// arriving meanwhile wait for it instead of checking again.
+func (r *readinessCache) get(ctx context.Context) *readinessResult {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.last != nil && time.Since(r.last.checked) < cfg().ReadinessCache() {
+        return r.last
+    }
+    ctx, cancel := context.WithTimeout(ctx, cfg().ReadinessCheckTimeout())
+    defer cancel()
+    errs := make([]error, len(readinessChecks))
+    var wg sync.WaitGroup
+    for i, rc := range readinessChecks {
+        wg.Add(1)
+        go func(i int, rc readinessCheck) {
+            defer wg.Done()
+            errs[i] = rc.check(ctx)
+        }(i, rc)
+    }
+    wg.Wait()
+    res := &readinessResult{failed: map[string]bool{}, checked: time.Now()}
+    for i, err := range errs {
+        if err != nil {
+            log.Printf("WARN readiness: %s: %v", readinessChecks[i].name, err)
+            res.failed[readinessChecks[i].name] = true
+        }
+    }
+    r.last = res
+    return res
+}
+
+// GET /health/ready checks Redis and storage: 200 when both answer, else 503
+// naming the ones that didn't.
+func handleReady(c *gin.Context) {
+    res := readiness.get(c.Request.Context())
+    checks := gin.H{}
+    failed := []string{}
+    for _, rc := range readinessChecks {
+        checks[rc.name] = "ok"
+        if res.failed[rc.name] {
+            checks[rc.name] = "unreachable"
+            failed = append(failed, rc.name)
+        }
+    }
+    resp := gin.H{"checks": checks, "checked_at": res.checked.UTC().Format(time.RFC3339)}
+    if len(failed) > 0 {
+        resp["status"], resp["failed"] = "unavailable", failed
+        c.JSON(http.StatusServiceUnavailable, resp)
+        return
+    }
+    resp["status"] = "ok"
+    c.JSON(http.StatusOK, resp)
+}
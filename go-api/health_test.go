@@ -0,0 +1,76 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// fakeStorage points the storage check at a server answering code.
+func fakeStorage(t *testing.T, code int) *httptest.Server {
+    t.Helper()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(code) }))
+    t.Cleanup(srv.Close)
+    saved := storageUploadURL
+    storageUploadURL = srv.URL + "/api/v1/upload"
+    t.Cleanup(func() { storageUploadURL = saved })
+    return srv
+}
+
+func readyBody(t *testing.T, r http.Handler, want int) map[string]interface{} {
+    t.Helper()
+    w := do(r, http.MethodGet, "/health/ready", "")
+    if w.Code != want {
+        t.Fatalf("status = %d, want %d (body %s)", w.Code, want, w.Body)
+    }
+    var body map[string]interface{}
+    json.Unmarshal(w.Body.Bytes(), &body)
+    return body
+}
+
+func TestLiveIgnoresRedis(t *testing.T) {
+    mr := setupTest(t, func(*Config) {})
+    mr.Close()
+    if w := do(newRouter(), http.MethodGet, "/health/live", ""); w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200 with Redis down", w.Code)
+    }
+}
+
+func TestReadyReportsFailedChecks(t *testing.T) {
+    mr := setupTest(t, func(c *Config) { c.ReadinessCacheSeconds = 0 })
+    fakeStorage(t, http.StatusMethodNotAllowed)
+    r := newRouter()
+    if body := readyBody(t, r, http.StatusOK); body["status"] != "ok" {
+        t.Errorf("body = %v, want ok", body)
+    }
+
+    mr.Close()
+    body := readyBody(t, r, http.StatusServiceUnavailable)
+    failed, _ := body["failed"].([]interface{})
+    if len(failed) != 1 || failed[0] != "redis" {
+        t.Errorf("failed = %v, want [redis]", body["failed"])
+    }
+    if checks, _ := body["checks"].(map[string]interface{}); checks["storage"] != "ok" || checks["redis"] != "unreachable" {
+        t.Errorf("checks = %v", body["checks"])
+    }
+}
+
+func TestReadyChecksStorage(t *testing.T) {
+    setupTest(t, func(c *Config) { c.ReadinessCacheSeconds = 0 })
+    fakeStorage(t, http.StatusBadGateway)
+    body := readyBody(t, newRouter(), http.StatusServiceUnavailable)
+    if failed, _ := body["failed"].([]interface{}); len(failed) != 1 || failed[0] != "storage" {
+        t.Errorf("failed = %v, want [storage]", body["failed"])
+    }
+}
+
+func TestReadyCachesVerdict(t *testing.T) {
+    mr := setupTest(t, func(*Config) {})
+    fakeStorage(t, http.StatusOK)
+    r := newRouter()
+    readyBody(t, r, http.StatusOK)
+    // Within READINESS_CACHE_SECONDS the outage isn't noticed
+    mr.Close()
+    readyBody(t, r, http.StatusOK)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+// Every worker, registered or not, SETs worker:heartbeat:{id} to the current
+// unix time with a TTL of a few heartbeat intervals, adds its ID to
+// heartbeatIndexKey and writes the time to lastHeartbeatKey, which doesn't
+// expire so the API can tell how long they have all been gone.
+const (
+    heartbeatIndexKey = "workers:heartbeat"
+    lastHeartbeatKey  = "workers:last_heartbeat"
+    // absentRetryAfter is the Retry-After on submissions refused while no
+    // worker is online
+    absentRetryAfter = 60
+)
+
+func heartbeatKey(workerID string) string {
+    return "worker:heartbeat:" + workerID
+}
+
+// recordHeartbeat queues the heartbeat writes for workerID on pipe. A
+// worker heard from again is no longer stale or dead, see workersweep.go.
+func recordHeartbeat(ctx context.Context, pipe redis.Pipeliner, workerID string, ttl time.Duration) {
+    now := time.Now().Unix()
+    pipe.Set(ctx, heartbeatKey(workerID), now, ttl)
+    pipe.SAdd(ctx, heartbeatIndexKey, workerID)
+    pipe.Set(ctx, lastHeartbeatKey, now, 0)
+    pipe.ZAdd(ctx, activeWorkersKey, &redis.Z{Score: float64(now), Member: workerID})
+    pipe.ZRem(ctx, staleWorkersKey, workerID)
+    pipe.ZRem(ctx, deadWorkersKey, workerID)
+}
+
+// workerLiveness reports whether any worker heartbeat is live, and when the
+// last one arrived (zero if never). Lapsed IDs are dropped from the index.
+func workerLiveness(ctx context.Context) (bool, time.Time, error) {
+    var lastSeen time.Time
+    if last, err := rdb.Get(ctx, lastHeartbeatKey).Int64(); err == nil {
+        lastSeen = time.Unix(last, 0)
+    } else if err != redis.Nil {
+        return false, lastSeen, err
+    }
+
+    n, err := liveHeartbeats(ctx)
+    return n > 0, lastSeen, err
+}
+
+// liveHeartbeats counts the workers whose heartbeat is live, dropping lapsed
+// IDs from the index.
+func liveHeartbeats(ctx context.Context) (int, error) {
+    ids, err := rdb.SMembers(ctx, heartbeatIndexKey).Result()
+    if err != nil || len(ids) == 0 {
+        return 0, err
+    }
+    keys := make([]string, len(ids))
+    for i, id := range ids {
+        keys[i] = heartbeatKey(id)
+    }
+    vals, err := rdb.MGet(ctx, keys...).Result()
+    if err != nil {
+        return 0, err
+    }
+    live := 0
+    for i, v := range vals {
+        if v == nil {
+            rdb.SRem(ctx, heartbeatIndexKey, ids[i])
+            continue
+        }
+        live++
+    }
+    return live, nil
+}
+
+// workerOnline is workerLiveness for responses; a failed check reports
+// online rather than alarming users over a Redis hiccup.
+func workerOnline(ctx context.Context) bool {
+    online, _, err := workerLiveness(ctx)
+    return online || err != nil
+}
+
+// rejectWhenWorkersAbsent refuses new jobs with 503 once no worker has sent
+// a heartbeat for WORKER_ABSENT_GRACE_SECONDS. A deployment that has never
+// seen a heartbeat is let through, since its workers may predate them.
+func rejectWhenWorkersAbsent(c *gin.Context) {
+    if cfg().WorkerAbsentGraceSeconds == 0 {
+        c.Next()
+        return
+    }
+    online, lastSeen, err := workerLiveness(c.Request.Context())
+    if err != nil || online || lastSeen.IsZero() || time.Since(lastSeen) < cfg().WorkerAbsentGrace() {
+        c.Next()
+        return
+    }
+    c.Header("Retry-After", strconv.Itoa(absentRetryAfter))
+    c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+        "error":            "No worker is online to process jobs, please try again later",
+        "worker_online":    false,
+        "worker_last_seen": lastSeen.UTC().Format(time.RFC3339),
+    })
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func beat(t *testing.T, workerID string, ttl time.Duration) {
+    t.Helper()
+    pipe := rdb.TxPipeline()
+    recordHeartbeat(ctx, pipe, workerID, ttl)
+    if _, err := pipe.Exec(ctx); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestWorkerOnlineInStatusAndHealthz(t *testing.T) {
+    mr := setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "queued", 0)
+    beat(t, "w1", time.Minute)
+
+    var got map[string]interface{}
+    json.Unmarshal(do(r, http.MethodGet, "/status/j1", "").Body.Bytes(), &got)
+    if got["worker_online"] != true {
+        t.Fatalf("status with a live heartbeat: worker_online = %v, want true", got["worker_online"])
+    }
+
+    mr.FastForward(2 * time.Minute)
+    got = nil
+    first := do(r, http.MethodGet, "/status/j1", "")
+    json.Unmarshal(first.Body.Bytes(), &got)
+    if got["worker_online"] != false {
+        t.Fatalf("status after the heartbeat lapsed: worker_online = %v, want false", got["worker_online"])
+    }
+
+    got = nil
+    json.Unmarshal(do(r, http.MethodGet, "/healthz", "").Body.Bytes(), &got)
+    if got["worker_online"] != false || got["worker_last_seen"] == nil {
+        t.Errorf("healthz = %v; want worker_online false with worker_last_seen", got)
+    }
+
+    // The ETag has to change when a worker comes back
+    beat(t, "w2", time.Minute)
+    if w := do(r, http.MethodGet, "/status/j1", "", "If-None-Match", first.Header().Get("ETag")); w.Code != http.StatusOK {
+        t.Errorf("poll after a worker returned: status = %d, want 200", w.Code)
+    }
+}
+
+func TestRejectWhenWorkersAbsent(t *testing.T) {
+    mr := setupTest(t, func(c *Config) { c.WorkerAbsentGraceSeconds = 300 })
+    r := newRouter()
+    body := `{"download_url":"https://example.com/a.stl","material":"PLA"}`
+
+    // Never seen a heartbeat: older workers don't send one
+    if w := do(r, http.MethodPost, "/quote", body); w.Code == http.StatusServiceUnavailable {
+        t.Fatalf("no heartbeat ever seen: status = 503, want the job accepted")
+    }
+
+    beat(t, "w1", time.Minute)
+    mr.FastForward(2 * time.Minute)
+    if w := do(r, http.MethodPost, "/quote", body); w.Code == http.StatusServiceUnavailable {
+        t.Fatalf("worker gone for less than the grace period: status = 503 (body %s)", w.Body)
+    }
+
+    mr.FastForward(5 * time.Minute)
+    rdb.Set(ctx, lastHeartbeatKey, time.Now().Add(-7*time.Minute).Unix(), 0)
+    w := do(r, http.MethodPost, "/quote", body)
+    if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+        t.Fatalf("worker gone past the grace period: status = %d, Retry-After %q; want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+    }
+}
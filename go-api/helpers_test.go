@@ -0,0 +1,49 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/alicebob/miniredis/v2"
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+// setupTest points the package globals at a fresh miniredis and a default
+// config adjusted by configure.
+func setupTest(t *testing.T, configure ...func(*Config)) *miniredis.Miniredis {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    mr := miniredis.RunT(t)
+    rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+    t.Cleanup(func() { rdb.Close() })
+
+    c := defaultConfig()
+    for _, f := range configure {
+        f(c)
+    }
+    setConfig(c)
+    if err := c.Validate(); err != nil {
+        t.Fatalf("invalid test config: %v", err)
+    }
+    features = newFeatureFlags()
+    readiness = &readinessCache{}
+    audit = newAuditLog(rdb, cfg().AuditStreamMaxLen)
+    return mr
+}
+
+// do sends a request through h from 192.0.2.1, httptest's default peer.
+func do(h http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    if body != "" {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    for i := 0; i+1 < len(headers); i += 2 {
+        req.Header.Set(headers[i], headers[i+1])
+    }
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, req)
+    return w
+}
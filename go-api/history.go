@@ -0,0 +1,94 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// history:{id} is the job's timeline, oldest first: every status the API
+// writes, with the status as the event, and manual interventions that don't
+// change it (promoted, prioritized, abort_requested...). Support reads it
+// from GET /jobs/:id/history to reconstruct what happened to a job. The
+// newest historyMax entries are kept.
+const historyMax = 100
+
+type historyEntry struct {
+    At     string `json:"at"`
+    Event  string `json:"event"`
+    Detail string `json:"detail,omitempty"`
+}
+
+// statusChangedKey holds when the job last changed status, so /status can
+// report it without reading the whole history.
+func statusChangedKey(jobID string) string {
+    return "status_changed_at:" + jobID
+}
+
+func recordHistory(ctx context.Context, jobID, event, detail string) error {
+    return appendHistory(ctx, jobID, event, detail, false)
+}
+
+// recordTransition adds the job's new status to its history.
+func recordTransition(ctx context.Context, jobID, status, detail string) error {
+    return appendHistory(ctx, jobID, status, detail, true)
+}
+
+func appendHistory(ctx context.Context, jobID, event, detail string, transition bool) error {
+    at := time.Now().UTC().Format(time.RFC3339)
+    data, _ := json.Marshal(historyEntry{
+        At:     at,
+        Event:  event,
+        Detail: detail,
+    })
+    key := "history:" + jobID
+    // As long as the job, which a finished one may be kept past a day
+    ttl := jobTTL(ctx, jobID)
+    pipe := rdb.TxPipeline()
+    pipe.RPush(ctx, key, data)
+    pipe.LTrim(ctx, key, -historyMax, -1)
+    pipe.Expire(ctx, key, ttl)
+    if transition {
+        pipe.Set(ctx, statusChangedKey(jobID), at, ttl)
+    }
+    _, err := pipe.Exec(ctx)
+    return err
+}
+
+// GET /jobs/:id/history returns the job's timeline. Jobs that have expired,
+// or predate the timeline and never changed status since, get 404.
+func handleJobHistory(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    pipe := rdb.Pipeline()
+    status := pipe.Get(ctx, "status:"+jobID)
+    hist := pipe.LRange(ctx, "history:"+jobID, 0, -1)
+    pipe.Exec(ctx)
+    if err := hist.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if status.Val() == "" && len(hist.Val()) == 0 {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+
+    history := make([]historyEntry, 0, len(hist.Val()))
+    for _, e := range hist.Val() {
+        var h historyEntry
+        if json.Unmarshal([]byte(e), &h) == nil {
+            history = append(history, h)
+        }
+    }
+    response := gin.H{"job_id": jobID, "history": history}
+    if status.Val() != "" {
+        response["status"] = status.Val()
+    }
+    c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "testing"
+)
+
+type historyResponse struct {
+    Status  string         `json:"status"`
+    History []historyEntry `json:"history"`
+}
+
+func jobHistory(t *testing.T, h http.Handler, jobID string) historyResponse {
+    t.Helper()
+    w := do(h, http.MethodGet, "/jobs/"+jobID+"/history", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("history = %d %s, want 200", w.Code, w.Body)
+    }
+    var resp historyResponse
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    return resp
+}
+
+func TestHistoryRecordsEveryTransition(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    _, id, _ := quoteJobID(t, r, `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`)
+
+    reportStatus(t, r, id, `{"status":"processing","step":"slicing"}`)
+    reportStatus(t, r, id, `{"status":"processing","progress_percent":60}`)
+    reportStatus(t, r, id, `{"status":"failed","result":{"success":false,"error":"non-manifold mesh"}}`)
+
+    resp := jobHistory(t, r, id)
+    if resp.Status != "failed" {
+        t.Fatalf("status = %q, want failed", resp.Status)
+    }
+    // Progress reports leave the status alone, so they aren't entries
+    want := []historyEntry{
+        {Event: "queued"},
+        {Event: "processing", Detail: "picked up by a worker"},
+        {Event: "failed", Detail: "non-manifold mesh"},
+    }
+    if len(resp.History) != len(want) {
+        t.Fatalf("history = %+v, want %d entries", resp.History, len(want))
+    }
+    for i, e := range resp.History {
+        if e.Event != want[i].Event || e.Detail != want[i].Detail || e.At == "" {
+            t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+        }
+    }
+
+    var status map[string]interface{}
+    json.Unmarshal(do(r, http.MethodGet, "/status/"+id, "").Body.Bytes(), &status)
+    if status["status_changed_at"] != resp.History[2].At {
+        t.Errorf("status_changed_at = %v, want %s", status["status_changed_at"], resp.History[2].At)
+    }
+    if _, ok := status["history"]; ok {
+        t.Error("/status still carries the full history")
+    }
+}
+
+func TestHistoryRecordsInterventions(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    w := do(r, http.MethodPost, "/quote", `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`)
+    var job struct {
+        JobID       string `json:"job_id"`
+        AccessToken string `json:"access_token"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &job)
+    id := job.JobID
+    if w := do(r, http.MethodDelete, "/jobs/"+id, "", jobTokenHeader, job.AccessToken); w.Code != http.StatusOK {
+        t.Fatalf("cancel = %d %s", w.Code, w.Body)
+    }
+    resp := jobHistory(t, r, id)
+    if len(resp.History) != 2 || resp.History[1].Event != "cancelled" || resp.History[1].Detail == "" {
+        t.Fatalf("history = %+v, want queued then cancelled with its note", resp.History)
+    }
+}
+
+func TestHistoryIsCapped(t *testing.T) {
+    setupTest(t)
+    rdb.Set(ctx, "status:j1", "queued", 0)
+    for i := 0; i < historyMax+5; i++ {
+        recordHistory(ctx, "j1", "promoted", strconv.Itoa(i))
+    }
+    resp := jobHistory(t, newRouter(), "j1")
+    if len(resp.History) != historyMax || resp.History[0].Detail != "5" {
+        t.Fatalf("kept %d entries starting at %q, want the newest %d", len(resp.History), resp.History[0].Detail, historyMax)
+    }
+}
+
+func TestHistoryUnknownJob(t *testing.T) {
+    setupTest(t)
+    if w := do(newRouter(), http.MethodGet, "/jobs/nope/history", ""); w.Code != http.StatusNotFound {
+        t.Fatalf("history = %d, want 404", w.Code)
+    }
+}
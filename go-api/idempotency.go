@@ -0,0 +1,201 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "net/http"
+    "sort"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Submissions carrying an Idempotency-Key are recorded under
+// idempotency:{submitter}:{key} for 24h: first as pending, then with the
+// response, so a retried request gets the original answer instead of a
+// second job.
+const (
+    idempotencyHeader = "Idempotency-Key"
+    idempotencyTTL    = 24 * time.Hour
+    idempotencyMaxLen = 255
+    idempotencyPoll   = 200 * time.Millisecond
+)
+
+type idempotencyRecord struct {
+    Fingerprint string          `json:"fingerprint"`
+    Done        bool            `json:"done"`
+    Status      int             `json:"status,omitempty"`
+    JobID       string          `json:"job_id,omitempty"`
+    Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// captureWriter passes the response through while keeping a copy.
+type captureWriter struct {
+    gin.ResponseWriter
+    body bytes.Buffer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+    w.body.Write(p)
+    return w.ResponseWriter.Write(p)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+    w.body.WriteString(s)
+    return w.ResponseWriter.WriteString(s)
+}
+
+func idempotencyKey(c *gin.Context, key string) string {
+    return "idempotency:" + callerScope(c) + ":" + key
+}
+
+// requestFingerprint hashes what the request asks for: the route, alike
+// with or without its version prefix, plus the JSON body, or for multipart
+// uploads the form values and file contents, since clients pick a new
+// boundary on every retry.
+func requestFingerprint(c *gin.Context) (string, error) {
+    h := sha256.New()
+    io.WriteString(h, unversionedPath(c.FullPath())+"\n")
+
+    if form, err := c.MultipartForm(); err == nil {
+        keys := make([]string, 0, len(form.Value))
+        for k := range form.Value {
+            keys = append(keys, k)
+        }
+        sort.Strings(keys)
+        for _, k := range keys {
+            for _, v := range form.Value[k] {
+                io.WriteString(h, k+"="+v+"\n")
+            }
+        }
+        for name, files := range form.File {
+            for _, fh := range files {
+                f, err := fh.Open()
+                if err != nil {
+                    return "", err
+                }
+                io.WriteString(h, name+":"+fh.Filename+"\n")
+                _, err = io.Copy(h, f)
+                f.Close()
+                if err != nil {
+                    return "", err
+                }
+            }
+        }
+        return hex.EncodeToString(h.Sum(nil)), nil
+    }
+
+    body, err := io.ReadAll(c.Request.Body)
+    if err != nil {
+        return "", err
+    }
+    c.Request.Body = io.NopCloser(bytes.NewReader(body))
+    h.Write(body)
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// idempotent makes a submission route honour Idempotency-Key. A replay gets
+// the stored response, a retry that arrives while the first attempt is still
+// running waits for it, and reusing a key for a different request is a 409.
+// Only 2xx responses are kept; after an error the key is released so the
+// client can try again.
+func idempotent(c *gin.Context) {
+    key := c.GetHeader(idempotencyHeader)
+    if key == "" {
+        c.Next()
+        return
+    }
+    if len(key) > idempotencyMaxLen {
+        c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResponse{Error: "Idempotency-Key is too long"})
+        return
+    }
+    ctx := c.Request.Context()
+    fingerprint, err := requestFingerprint(c)
+    if err != nil {
+        c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResponse{Error: "Failed to read request body"})
+        return
+    }
+
+    redisKey := idempotencyKey(c, key)
+    pending, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+    for {
+        claimed, err := rdb.SetNX(ctx, redisKey, pending, idempotencyTTL).Result()
+        if err != nil {
+            c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+        if claimed {
+            break
+        }
+        if replayIdempotent(c, redisKey, fingerprint) {
+            return
+        }
+        // The first attempt failed and released the key: this one takes over
+    }
+
+    w := &captureWriter{ResponseWriter: c.Writer}
+    c.Writer = w
+    c.Next()
+    c.Writer = w.ResponseWriter
+
+    // The request context may have timed out by now; record the outcome
+    // regardless
+    if w.Status() < 200 || w.Status() >= 300 {
+        rdb.Del(context.Background(), redisKey)
+        return
+    }
+    var resp struct {
+        JobID string `json:"job_id"`
+    }
+    json.Unmarshal(w.body.Bytes(), &resp)
+    done, _ := json.Marshal(idempotencyRecord{
+        Fingerprint: fingerprint,
+        Done:        true,
+        Status:      w.Status(),
+        JobID:       resp.JobID,
+        Body:        w.body.Bytes(),
+    })
+    rdb.Set(context.Background(), redisKey, done, redis.KeepTTL)
+}
+
+// replayIdempotent answers a request whose key is already taken, polling
+// until the first attempt finishes or the request runs out of time. It
+// returns false without answering if the key was released meanwhile.
+func replayIdempotent(c *gin.Context, redisKey, fingerprint string) bool {
+    ctx := c.Request.Context()
+    for {
+        data, err := rdb.Get(ctx, redisKey).Bytes()
+        var rec idempotencyRecord
+        if err == redis.Nil {
+            return false
+        }
+        if err != nil || json.Unmarshal(data, &rec) != nil {
+            c.AbortWithStatusJSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return true
+        }
+        if rec.Fingerprint != fingerprint {
+            c.AbortWithStatusJSON(http.StatusConflict, api.ErrorResponse{Error: "Idempotency-Key was already used for a different request"})
+            return true
+        }
+        if rec.Done {
+            c.Header("Idempotent-Replayed", "true")
+            c.Data(rec.Status, "application/json; charset=utf-8", rec.Body)
+            c.Abort()
+            return true
+        }
+        select {
+        case <-ctx.Done():
+            c.Header("Retry-After", "1")
+            c.AbortWithStatusJSON(http.StatusConflict, api.ErrorResponse{Error: "The original request with this Idempotency-Key is still in progress"})
+            return true
+        case <-time.After(idempotencyPoll):
+        }
+    }
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// signBody is the X-Internal-Signature value for body: hex HMAC-SHA256 keyed
+// with INTERNAL_SECRET.
+func signBody(secret string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requireInternalSignature lets through only requests whose raw body was
+// signed with INTERNAL_SECRET. The body is restored for the handler.
+func requireInternalSignature(c *gin.Context) {
+    if cfg().InternalSecret == "" {
+        c.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResponse{Error: "Internal API disabled"})
+        return
+    }
+
+    if accountLockedOut(c, authAccountInternal) {
+        return
+    }
+    body, err := io.ReadAll(c.Request.Body)
+    if err != nil {
+        c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResponse{Error: "Failed to read body"})
+        return
+    }
+    c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+    given, err := hex.DecodeString(strings.TrimPrefix(c.GetHeader("X-Internal-Signature"), "sha256="))
+    want, _ := hex.DecodeString(signBody(cfg().InternalSecret, body))
+    if err != nil || len(given) == 0 || !hmac.Equal(given, want) {
+        recordAuthFailure(c, authAccountInternal)
+        c.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResponse{Error: "Invalid signature"})
+        return
+    }
+    c.Next()
+}
+
+type statusUpdate struct {
+    Status          string          `json:"status" binding:"required"`
+    Result          json.RawMessage `json:"result"`
+    Step            string          `json:"step"`
+    ProgressPercent *int            `json:"progress_percent"`
+}
+
+// Statuses a worker may report.
+var workerStatuses = map[JobStatus]bool{
+    StatusProcessing: true,
+    StatusCompleted:  true,
+    StatusFailed:     true,
+    StatusAborted:    true,
+}
+
+// applyWorkerStatus records the status a worker reported and returns the
+// job's status after it. A forced cancel (see handleCancelJob) wins over
+// progress reports; the worker stopping turns it into "cancelled", while a
+// result that arrives first stands. Cancelled jobs stay cancelled, which
+// the script reports as "ignored". Otherwise the current status must be one
+// of ARGV[3:], the ones allowed to move to the reported status; if it isn't
+// the script reports "rejected".
+var applyWorkerStatus = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur == 'cancelled' then
+    return 'ignored'
+end
+local new = ARGV[1]
+if cur == 'cancelling' then
+    if new == 'aborted' then
+        new = 'cancelled'
+    elseif new == 'processing' then
+        new = cur
+    end
+else
+    local ok = false
+    for i = 3, #ARGV do
+        if ARGV[i] == cur then
+            ok = true
+        end
+    end
+    if not ok then
+        return 'rejected'
+    end
+end
+redis.call('SET', KEYS[1], new, 'EX', ARGV[2])
+return new
+`)
+
+// POST /internal/jobs/:id/status lets workers report progress without Redis
+// write access.
+func handleInternalStatus(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    var update statusUpdate
+    if err := c.ShouldBindJSON(&update); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if !workerStatuses[JobStatus(update.Status)] {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Unknown status " + update.Status})
+        return
+    }
+
+    reportsProgress := update.Step != "" || update.ProgressPercent != nil
+    if reportsProgress && update.Status != "processing" {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "step and progress_percent are only accepted with status processing"})
+        return
+    }
+
+    before, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+
+    if JobStatus(update.Status) == StatusFailed && requeueFailedDownload(ctx, jobID, before, update.Result) {
+        c.JSON(http.StatusOK, gin.H{"job_id": jobID, "status": before, "retrying": true})
+        return
+    }
+
+    // A progress update on its own stays within the step already reported
+    step := update.Step
+    if step == "" && update.ProgressPercent != nil {
+        raw, _ := rdb.Get(ctx, progressKey(jobID)).Result()
+        current, _ := parseProgress(raw)
+        step = current.Stage
+    }
+    if err := checkProgress(step, update.ProgressPercent); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+
+    args := append([]interface{}{update.Status, int((24 * time.Hour).Seconds())}, statusesBefore(JobStatus(update.Status))...)
+    status, err := applyWorkerStatus.Run(ctx, rdb, []string{"status:" + jobID}, args...).Text()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    // The job was withdrawn before the worker reported; whatever it says
+    // now doesn't change that
+    if status == "ignored" {
+        c.JSON(http.StatusOK, gin.H{"job_id": jobID, "status": "cancelled", "ignored": true})
+        return
+    }
+    // e.g. a late claim of a job that is already completed
+    if status == "rejected" {
+        logInvalidTransition(jobID, before, JobStatus(update.Status))
+        c.JSON(http.StatusConflict, gin.H{"error": "Job is " + before + "; it can't become " + update.Status, "status": before})
+        return
+    }
+
+    pipe := rdb.TxPipeline()
+    if len(update.Result) > 0 && status == update.Status {
+        pipe.Set(ctx, "result:"+jobID, []byte(update.Result), 24*time.Hour)
+    }
+    switch {
+    case reportsProgress:
+        progress, _, _ := progressRange(step)
+        if update.ProgressPercent != nil {
+            progress = *update.ProgressPercent
+        }
+        pipe.Set(ctx, progressKey(jobID), newProgress(step, progress), 24*time.Hour)
+    case parseJobStatus(status).IsTerminal():
+        // Kept a little longer for anyone looking into how the job went
+        pipe.Expire(ctx, progressKey(jobID), progressLinger)
+    default:
+        // A fresh claim; steps from an earlier attempt no longer apply
+        pipe.Del(ctx, progressKey(jobID))
+    }
+    switch {
+    case status == "aborted":
+        pipe.Del(ctx, abortKey(jobID))
+        pipe.Set(ctx, "aborted_at:"+jobID, time.Now().UTC().Format(time.RFC3339), 24*time.Hour)
+    case status == "cancelled":
+        // The worker acknowledged a forced cancel
+        deleteUpload(ctx, jobID)
+        pipe.Del(ctx, abortKey(jobID), "params:"+jobID)
+        pipe.Set(ctx, "note:"+jobID, "Cancelled while processing", 24*time.Hour)
+    case before == "cancelling" && status != "cancelling":
+        // The result beat the cancel
+        pipe.Del(ctx, abortKey(jobID))
+        pipe.Set(ctx, "note:"+jobID, "Finished before the cancel reached the worker", 24*time.Hour)
+    }
+    if _, err := pipe.Exec(ctx); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if reportsProgress {
+        recordProgressHistory(ctx, jobID)
+    }
+    if status == "completed" {
+        recordSliceDuration(ctx, jobID)
+        storeSliceResult(ctx, jobID, update.Result)
+    }
+    if status == before {
+        publishProgress(ctx, jobID, status)
+    } else {
+        publishStatus(ctx, jobID, status, workerStatusDetail(jobID, before, status))
+    }
+
+    response := gin.H{"job_id": jobID, "status": status}
+    if update.Step != "" {
+        response["step"] = update.Step
+    }
+    // Step and progress reports don't change the status, so they stay out
+    // of the audit log
+    if status == before && reportsProgress {
+        c.JSON(http.StatusOK, response)
+        return
+    }
+
+    observeTransition(ctx, jobID, before, status, update.Result)
+    event := auditEventFor(c, auditStatusChanged, jobID, jobOwner(ctx, jobID))
+    event.Before, event.After = before, status
+    audit.Record(ctx, event)
+    if status == "completed" || status == "failed" || status == "aborted" {
+        fireWebhooks(event.OwnerID, "job."+status, jobID, update.Result)
+    }
+    if status == "completed" || status == "failed" {
+        fireCallback(jobID, status, update.Result)
+        fireEmail(jobID, status, update.Result)
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+type progressUpdate struct {
+    Percent *int   `json:"percent"`
+    Step    string `json:"step"`
+}
+
+// PATCH /internal/jobs/:id/progress records how far along a processing job
+// is, as {"percent": 42, "step": "slicing"}. It is the progress half of
+// POST /internal/jobs/:id/status: without a step the percent stays within
+// the step already reported, and a percent outside 0–100, or outside the
+// step's range, gets 422.
+func handleInternalProgress(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    var update progressUpdate
+    if err := c.ShouldBindJSON(&update); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if update.Percent == nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "percent is required"})
+        return
+    }
+    if *update.Percent < 0 || *update.Percent > 100 {
+        c.JSON(http.StatusUnprocessableEntity, api.ErrorResponse{Error: "percent must be between 0 and 100"})
+        return
+    }
+
+    vals, err := rdb.MGet(ctx, "status:"+jobID, progressKey(jobID)).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    status, ok := vals[0].(string)
+    if !ok {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if status != "processing" {
+        c.JSON(http.StatusConflict, gin.H{"error": "Job is " + status + "; progress is only accepted while it is processing", "status": status})
+        return
+    }
+    step := update.Step
+    if step == "" {
+        raw, _ := vals[1].(string)
+        current, _ := parseProgress(raw)
+        step = current.Stage
+    }
+    if _, _, known := progressRange(step); !known {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Unknown step " + step})
+        return
+    }
+    if err := checkProgress(step, update.Percent); err != nil {
+        c.JSON(http.StatusUnprocessableEntity, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+
+    if err := rdb.Set(ctx, progressKey(jobID), newProgress(step, *update.Percent), jobTTL(ctx, jobID)).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    recordProgressHistory(ctx, jobID)
+    publishProgress(ctx, jobID, status)
+
+    response := gin.H{"job_id": jobID, "status": status, "progress_percent": *update.Percent}
+    if step != "" {
+        response["step"] = step
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// workerStatusDetail explains a status the worker reported, for the job's
+// history.
+func workerStatusDetail(jobID, before, status string) string {
+    switch {
+    case status == "aborted":
+        return "stopped by the worker on request"
+    case status == "cancelled":
+        return "the worker stopped"
+    case before == "cancelling":
+        return "finished before the cancel reached the worker"
+    case status == "failed":
+        return lastError(jobID, "")
+    case status == "processing" && before == "queued":
+        return "picked up by a worker"
+    }
+    return ""
+}
@@ -0,0 +1,279 @@
+// Package api holds the JSON bodies the REST API takes and answers with,
+// so clients and generated SDKs have one place to read their shape from.
+// Field names are the ones the API has always sent; fields added since are
+// omitted when empty.
+package api
+
+import "time"
+
+// ErrorResponse is the body of every error answer.
+type ErrorResponse struct {
+    Error string `json:"error"`
+    // A stable, machine-readable name for the error
+    Code string `json:"code,omitempty"`
+    // Structured context, e.g. which field failed validation
+    Details   interface{} `json:"details,omitempty"`
+    RequestID string      `json:"request_id,omitempty"`
+}
+
+// QuotationRequest is the body of POST /quote: a model at a URL and how
+// to print it.
+type QuotationRequest struct {
+    DownloadURL string  `json:"download_url" binding:"required"`
+    Material    string  `json:"material"`
+    LayerHeight float64 `json:"layer_height"`
+    // Nozzle diameter in mm: 0.25, 0.4 (the default), 0.6 or 0.8
+    Nozzle float64 `json:"nozzle"`
+    // none, brim (the default), raft or skirt
+    BedAdhesion string `json:"bed_adhesion"`
+    Infill      int    `json:"infill" binding:"required"`
+    Rush        bool   `json:"rush"`
+    MaxRetries  *int   `json:"max_retries"`
+    // Optional RFC3339 time to hold the job until
+    SubmitAt *time.Time `json:"submit_at"`
+    // Force a fresh slice even if a cached result exists
+    NoCache bool `json:"no_cache"`
+    // Optional region to slice in: us, eu or ap
+    Region string `json:"region"`
+    // Optional https URL POSTed the final status and result, signed with
+    // CallbackSecret, or WEBHOOK_SECRET without one
+    CallbackURL    string `json:"callback_url"`
+    CallbackSecret string `json:"callback_secret"`
+    // Optional address emailed the price, print time and a status link
+    // once the job completes or fails, when the server has SMTP set up
+    NotifyEmail string `json:"notify_email"`
+}
+
+// MaterialProfile is what the API knows about a material: how dense it is,
+// the layer heights and temperatures it prints at, and what it costs.
+type MaterialProfile struct {
+    Name string `json:"name"`
+    // Other names clients use for it, e.g. "PLA+"
+    Aliases            []string `json:"aliases"`
+    DensityGPerCM3     float64  `json:"density_g_per_cm3"`
+    DefaultLayerHeight float64  `json:"default_layer_height"`
+    MinLayerHeight     float64  `json:"min_layer_height"`
+    MaxLayerHeight     float64  `json:"max_layer_height"`
+    DefaultInfill      int      `json:"default_infill"`
+    PrintTempC         int      `json:"print_temp_c"`
+    BedTempC           int      `json:"bed_temp_c"`
+    CoolingEnabled     bool     `json:"cooling_enabled"`
+    // In USD
+    CostPerGram float64 `json:"cost_per_gram"`
+}
+
+// MaterialsResponse answers GET /materials.
+type MaterialsResponse struct {
+    Materials []MaterialProfile `json:"materials"`
+}
+
+// Rotation is a rotation about the X, then Y, then Z axis, in degrees.
+type Rotation struct {
+    X float64 `json:"x"`
+    Y float64 `json:"y"`
+    Z float64 `json:"z"`
+}
+
+// EstimateResponse answers POST /quote/estimate: the model's material use,
+// worked out from its volume without slicing it.
+type EstimateResponse struct {
+    Material  string  `json:"material"`
+    Triangles int     `json:"triangles"`
+    VolumeCM3 float64 `json:"volume_cm3"`
+    // Width, depth and height in millimetres
+    BoundingBoxMM [3]float64 `json:"bounding_box_mm"`
+    Nozzle        float64    `json:"nozzle"`
+    BedAdhesion   string     `json:"bed_adhesion"`
+    // What the model weighs printed solid, an upper bound for any infill
+    WeightGrams float64 `json:"weight_grams"`
+    // The skirt, brim or raft bed_adhesion adds around it
+    AdhesionWeightGrams float64 `json:"adhesion_weight_grams"`
+    // Of both together
+    Cost     float64 `json:"cost"`
+    Currency string  `json:"currency"`
+    // Extruding all of it at the nozzle's flow rate, without travel or
+    // cooling stops; a wider nozzle is faster
+    EstimatedPrintTimeSeconds int `json:"estimated_print_time_seconds"`
+    // How to lay the model on the bed, and the support it then needs as a
+    // percentage of its own volume; left out when working them out timed
+    // out
+    RecommendedRotationDegrees *Rotation `json:"recommended_rotation_degrees,omitempty"`
+    EstimatedSupportVolumePct  *float64  `json:"estimated_support_volume_pct,omitempty"`
+}
+
+// QueueWarning is added to an accepted submission while the queue is past
+// QUEUE_WARN_DEPTH.
+type QueueWarning struct {
+    Warning              string `json:"warning,omitempty"`
+    EstimatedWaitSeconds int    `json:"estimated_wait_seconds,omitempty"`
+}
+
+// SubmitJobResponse answers POST /quote, and the submissions to /quote or
+// /upload that are answered without queueing anything: duplicates of a
+// recent one and slice cache hits.
+type SubmitJobResponse struct {
+    JobID string `json:"job_id"`
+    // Shown once; send it as X-Job-Token to act on an anonymous job
+    AccessToken string `json:"access_token,omitempty"`
+    Message     string `json:"message"`
+    // Set for cache hits, which are completed at once
+    Status string `json:"status,omitempty"`
+    Cached bool   `json:"cached,omitempty"`
+    // The earlier job a duplicate submission was answered with
+    DuplicateOf string `json:"duplicate_of,omitempty"`
+    // The job POST /jobs/:id/retry resubmitted
+    RetryOf string `json:"retry_of,omitempty"`
+    // The job's 1-based place in pop order when it was queued
+    QueuePosition *int64           `json:"queue_position,omitempty"`
+    QueueDepths   map[string]int64 `json:"queue_depths,omitempty"`
+    // RFC3339 release time of a scheduled job
+    SubmitAt     string `json:"submit_at,omitempty"`
+    WorkerOnline *bool  `json:"worker_online,omitempty"`
+    // RFC3339 time the job's status and result expire
+    ExpiresAt string `json:"expires_at,omitempty"`
+    QueueWarning
+}
+
+// ModelInfo describes the file given to POST /upload.
+type ModelInfo struct {
+    Filename  string `json:"filename"`
+    SizeBytes int64  `json:"size_bytes"`
+    // Lowercase extension without the dot, e.g. "stl"
+    Format string `json:"format,omitempty"`
+}
+
+// UploadResponse answers a POST /upload that queued a job.
+type UploadResponse struct {
+    JobID        string    `json:"job_id"`
+    AccessToken  string    `json:"access_token,omitempty"`
+    Message      string    `json:"message"`
+    ModelInfo    ModelInfo `json:"model_info"`
+    WorkerOnline *bool     `json:"worker_online,omitempty"`
+    ExpiresAt    string    `json:"expires_at,omitempty"`
+    QueueWarning
+}
+
+// Result is what customers see of a worker's result, as StatusResponse's
+// Data. Fields the worker didn't report are left out.
+type Result struct {
+    Price            *float64  `json:"price,omitempty"`
+    Currency         string    `json:"currency,omitempty"`
+    PrintTimeSeconds *int64    `json:"print_time_seconds,omitempty"`
+    Filament         *Filament `json:"filament,omitempty"`
+    // filament.grams and filament.meters, for clients from before filament
+    FilamentGrams  *float64 `json:"filament_grams,omitempty"`
+    FilamentMeters *float64 `json:"filament_meters,omitempty"`
+    // Set for failures: one of download_failed, unsupported_format,
+    // geometry_error, slicer_crash, timeout, cancelled and internal_error
+    ErrorCode string `json:"error_code,omitempty"`
+    // The worker's own error text, for support rather than customers
+    ErrorMessage string `json:"error_message,omitempty"`
+    // What to tell the customer about error_code
+    ErrorDescription string `json:"error_description,omitempty"`
+    // Whether the customer can fix it, e.g. with a different file, rather
+    // than waiting on us
+    UserActionable *bool `json:"user_actionable,omitempty"`
+    // Whether GET /jobs/:id/gcode has a file to serve once the quote is
+    // accepted
+    GcodeAvailable bool `json:"gcode_available,omitempty"`
+}
+
+// Filament is the filament a job uses. Whichever amounts the worker
+// measured are given as they are, and the rest derived from the material's
+// density and 1.75 mm filament.
+type Filament struct {
+    Grams  *float64 `json:"grams,omitempty"`
+    Meters *float64 `json:"meters,omitempty"`
+    CM3    *float64 `json:"cm3,omitempty"`
+    // grams at the material's cost_per_gram, in USD
+    Cost *float64 `json:"cost,omitempty"`
+    // Which of grams, meters, cm3 and cost were measured, and which derived
+    Measured []string `json:"measured"`
+    Derived  []string `json:"derived"`
+}
+
+// StatusResponse answers GET /status/:id, and is each entry of POST
+// /status. Times are RFC3339 in UTC.
+type StatusResponse struct {
+    JobID  string `json:"job_id,omitempty"`
+    Status string `json:"status,omitempty"`
+    // Set instead of everything else for unknown IDs in POST /status
+    NotFound    bool   `json:"not_found,omitempty"`
+    Note        string `json:"note,omitempty"`
+    Attempts    *int   `json:"attempts,omitempty"`
+    NextRetryAt string `json:"next_retry_at,omitempty"`
+    Cached      bool   `json:"cached,omitempty"`
+    // Whether the callback_url got the final status, once it was tried
+    WebhookDelivered *bool  `json:"webhook_delivered,omitempty"`
+    AbortedAt        string `json:"aborted_at,omitempty"`
+    CreatedAt        string `json:"created_at,omitempty"`
+    StartedAt        string `json:"started_at,omitempty"`
+    CompletedAt      string `json:"completed_at,omitempty"`
+    StatusChangedAt  string `json:"status_changed_at,omitempty"`
+    // Whether GET /jobs/:id/thumbnail has a render of the model
+    HasThumbnail bool `json:"has_thumbnail,omitempty"`
+    // The worker's last progress report, while processing
+    CurrentStep       string `json:"current_step,omitempty"`
+    ProgressPercent   *int   `json:"progress_percent,omitempty"`
+    ProgressUpdatedAt string `json:"progress_updated_at,omitempty"`
+    ProgressStale     *bool  `json:"progress_stale,omitempty"`
+    // The result, once completed or failed
+    Data *Result `json:"data,omitempty"`
+    // Left out of POST /status, which would need a round trip per job
+    WorkerOnline *bool  `json:"worker_online,omitempty"`
+    Position     *int64 `json:"position,omitempty"`
+    EtaSeconds   *int64 `json:"eta_seconds,omitempty"`
+    ExpiresAt    string `json:"expires_at,omitempty"`
+}
+
+// JobSummary is one job in a page of GET /jobs.
+type JobSummary struct {
+    JobID     string `json:"job_id"`
+    Status    string `json:"status"`
+    CreatedAt string `json:"created_at,omitempty"`
+}
+
+// JobListResponse is a page of GET /jobs.
+type JobListResponse struct {
+    Jobs []JobSummary `json:"jobs"`
+    // Pass back as ?cursor= for the next page; null on the last one
+    NextCursor *string `json:"next_cursor"`
+}
+
+// DeprecatedRoute is a route scheduled for removal.
+type DeprecatedRoute struct {
+    Method string `json:"method"`
+    Path   string `json:"path"`
+    // When the route goes away, in RFC 3339
+    Sunset    string `json:"sunset"`
+    Successor string `json:"successor"`
+    // Requests the route has had since it was marked deprecated
+    Calls int64 `json:"calls"`
+}
+
+// DeprecationsResponse is GET /api/deprecations.
+type DeprecationsResponse struct {
+    Deprecations []DeprecatedRoute `json:"deprecations"`
+}
+
+// LogLine is one line of slicer output.
+type LogLine struct {
+    // The log stream entry ID, usable as ?offset= for the event stream
+    ID   string `json:"id"`
+    At   string `json:"at"`
+    Line string `json:"line"`
+}
+
+// JobLogsResponse answers GET /jobs/:id/logs with Accept: application/json.
+type JobLogsResponse struct {
+    JobID  string    `json:"job_id"`
+    Status string    `json:"status"`
+    Lines  []LogLine `json:"lines"`
+    // Set when older lines were left out to stay within LOG_TAIL_BYTES
+    Truncated bool `json:"truncated"`
+}
+
+// BulkStatusResponse answers POST /status, keyed by job ID.
+type BulkStatusResponse struct {
+    Jobs map[string]StatusResponse `json:"jobs"`
+}
@@ -0,0 +1,240 @@
+// Package client calls the REST API from Go. It speaks /v1/ and decodes
+// answers into the types in internal/api.
+//
+//	c := client.NewClient("https://slicer.example.com", apiKey)
+//	job, err := c.SubmitJob(ctx, api.QuotationRequest{DownloadURL: url, Infill: 20})
+//	updates, err := c.WatchStatus(ctx, job.JobID)
+//	for st := range updates {
+//	    ...
+//	}
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+
+    "slicer-api/internal/api"
+)
+
+// jobTokenHeader carries a job's access token, which anonymous callers need
+// for everything but submitting.
+const jobTokenHeader = "X-Job-Token"
+
+// Client is safe for concurrent use.
+type Client struct {
+    baseURL string
+    apiKey  string
+    http    *http.Client
+    // Access tokens of the jobs this client submitted, by job ID
+    tokens sync.Map
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces http.DefaultClient. A Timeout on it also cuts
+// WatchStatus streams short; prefer deadlines on the context.
+func WithHTTPClient(hc *http.Client) Option {
+    return func(c *Client) { c.http = hc }
+}
+
+// NewClient calls the API at baseURL, e.g. https://slicer.example.com,
+// with apiKey as its Bearer token. Without a key the calls are anonymous,
+// and jobs are reachable through the access tokens the client keeps from
+// submitting them.
+func NewClient(baseURL, apiKey string, opts ...Option) *Client {
+    c := &Client{
+        baseURL: strings.TrimSuffix(baseURL, "/") + "/v1",
+        apiKey:  apiKey,
+        http:    http.DefaultClient,
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    return c
+}
+
+// Error is an answer outside 2xx.
+type Error struct {
+    StatusCode int
+    Body       api.ErrorResponse
+}
+
+func (e *Error) Error() string {
+    if e.Body.Error == "" {
+        return fmt.Sprintf("slicer api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+    }
+    return fmt.Sprintf("slicer api: %d %s", e.StatusCode, e.Body.Error)
+}
+
+// newRequest builds a call to path, with the credentials for jobID when it
+// is set.
+func (c *Client) newRequest(ctx context.Context, method, path, jobID string, body io.Reader) (*http.Request, error) {
+    req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Accept", "application/json")
+    if c.apiKey != "" {
+        req.Header.Set("Authorization", "Bearer "+c.apiKey)
+    }
+    if token, ok := c.tokens.Load(jobID); ok && jobID != "" {
+        req.Header.Set(jobTokenHeader, token.(string))
+    }
+    return req, nil
+}
+
+// send makes req and decodes a 2xx answer into out, if it isn't nil.
+func (c *Client) send(req *http.Request, out interface{}) error {
+    resp, err := c.http.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if err := checkResponse(resp); err != nil {
+        return err
+    }
+    if out == nil {
+        io.Copy(io.Discard, resp.Body)
+        return nil
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkResponse is an *Error for answers outside 2xx.
+func checkResponse(resp *http.Response) error {
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        return nil
+    }
+    e := &Error{StatusCode: resp.StatusCode}
+    json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&e.Body)
+    return e
+}
+
+// SubmitJob queues a quote for the model at req.DownloadURL. A duplicate of
+// a recent submission, or a cached result, answers with the earlier job.
+func (c *Client) SubmitJob(ctx context.Context, req api.QuotationRequest) (*api.SubmitJobResponse, error) {
+    body, err := json.Marshal(req)
+    if err != nil {
+        return nil, err
+    }
+    httpReq, err := c.newRequest(ctx, http.MethodPost, "/quote", "", bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    httpReq.Header.Set("Content-Type", "application/json")
+    var resp api.SubmitJobResponse
+    if err := c.send(httpReq, &resp); err != nil {
+        return nil, err
+    }
+    c.keepToken(resp.JobID, resp.AccessToken)
+    return &resp, nil
+}
+
+// UploadOptions are the print settings of UploadFile. Zero values leave the
+// API's defaults: PLA, 0.2mm layers, 15% infill, a 0.4mm nozzle and a brim.
+type UploadOptions struct {
+    Material    string
+    LayerHeight float64
+    Nozzle      float64
+    BedAdhesion string
+    Infill      int
+    Rush        bool
+    MaxRetries  *int
+    NoCache     bool
+    Region      string
+    NotifyEmail string
+}
+
+func (o UploadOptions) fields() map[string]string {
+    f := map[string]string{}
+    set := func(name, value string, ok bool) {
+        if ok {
+            f[name] = value
+        }
+    }
+    set("material", o.Material, o.Material != "")
+    set("layer_height", strconv.FormatFloat(o.LayerHeight, 'f', -1, 64), o.LayerHeight > 0)
+    set("nozzle", strconv.FormatFloat(o.Nozzle, 'f', -1, 64), o.Nozzle > 0)
+    set("bed_adhesion", o.BedAdhesion, o.BedAdhesion != "")
+    set("infill", strconv.Itoa(o.Infill), o.Infill > 0)
+    set("rush", "true", o.Rush)
+    if o.MaxRetries != nil {
+        f["max_retries"] = strconv.Itoa(*o.MaxRetries)
+    }
+    set("no_cache", "true", o.NoCache)
+    set("region", o.Region, o.Region != "")
+    set("notify_email", o.NotifyEmail, o.NotifyEmail != "")
+    return f
+}
+
+// UploadFile uploads size bytes of r as filename and queues a quote for it.
+// The body is streamed, not buffered; size sets its Content-Length, so an
+// upload over the API's limit is refused before it is sent.
+func (c *Client) UploadFile(ctx context.Context, filename string, r io.Reader, size int64, opts UploadOptions) (*api.UploadResponse, error) {
+    // Everything around the file is written up front, so the length is known
+    var head bytes.Buffer
+    form := multipart.NewWriter(&head)
+    for name, value := range opts.fields() {
+        form.WriteField(name, value)
+    }
+    if _, err := form.CreateFormFile("file", filename); err != nil {
+        return nil, err
+    }
+    headLen := head.Len()
+    form.Close()
+    tail := append([]byte(nil), head.Bytes()[headLen:]...)
+    head.Truncate(headLen)
+
+    body := io.MultiReader(&head, io.LimitReader(r, size), bytes.NewReader(tail))
+    req, err := c.newRequest(ctx, http.MethodPost, "/upload", "", body)
+    if err != nil {
+        return nil, err
+    }
+    req.ContentLength = int64(headLen) + size + int64(len(tail))
+    req.Header.Set("Content-Type", form.FormDataContentType())
+    var resp api.UploadResponse
+    if err := c.send(req, &resp); err != nil {
+        return nil, err
+    }
+    c.keepToken(resp.JobID, resp.AccessToken)
+    return &resp, nil
+}
+
+func (c *Client) keepToken(jobID, token string) {
+    if jobID != "" && token != "" {
+        c.tokens.Store(jobID, token)
+    }
+}
+
+// GetStatus is the job's current status, with its result once finished.
+func (c *Client) GetStatus(ctx context.Context, jobID string) (*api.StatusResponse, error) {
+    req, err := c.newRequest(ctx, http.MethodGet, "/status/"+url.PathEscape(jobID), jobID, nil)
+    if err != nil {
+        return nil, err
+    }
+    var resp api.StatusResponse
+    if err := c.send(req, &resp); err != nil {
+        return nil, err
+    }
+    return &resp, nil
+}
+
+// CancelJob withdraws a job no worker has started. A processing or finished
+// job is an *Error with StatusCode 409.
+func (c *Client) CancelJob(ctx context.Context, jobID string) error {
+    req, err := c.newRequest(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(jobID), jobID, nil)
+    if err != nil {
+        return err
+    }
+    return c.send(req, nil)
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "slicer-api/internal/api"
+)
+
+func TestSubmitAndStatus(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method + " " + r.URL.Path {
+        case "POST /v1/quote":
+            var req api.QuotationRequest
+            json.NewDecoder(r.Body).Decode(&req)
+            if r.Header.Get("Authorization") != "" || req.DownloadURL != "https://example.com/part.stl" {
+                w.WriteHeader(http.StatusBadRequest)
+                return
+            }
+            w.WriteHeader(http.StatusAccepted)
+            json.NewEncoder(w).Encode(api.SubmitJobResponse{JobID: "j1", AccessToken: "tok"})
+        case "GET /v1/status/j1":
+            if r.Header.Get(jobTokenHeader) != "tok" {
+                w.WriteHeader(http.StatusForbidden)
+                json.NewEncoder(w).Encode(api.ErrorResponse{Error: "Forbidden"})
+                return
+            }
+            json.NewEncoder(w).Encode(api.StatusResponse{JobID: "j1", Status: "queued"})
+        default:
+            w.WriteHeader(http.StatusNotFound)
+        }
+    }))
+    defer srv.Close()
+    c := NewClient(srv.URL+"/", "")
+
+    job, err := c.SubmitJob(context.Background(), api.QuotationRequest{DownloadURL: "https://example.com/part.stl", Infill: 20})
+    if err != nil || job.JobID != "j1" {
+        t.Fatalf("SubmitJob = %+v, %v", job, err)
+    }
+    // The access token from submitting is sent for the job
+    st, err := c.GetStatus(context.Background(), "j1")
+    if err != nil || st.Status != "queued" {
+        t.Fatalf("GetStatus = %+v, %v", st, err)
+    }
+
+    _, err = NewClient(srv.URL, "").GetStatus(context.Background(), "j1")
+    var apiErr *Error
+    if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Body.Error != "Forbidden" {
+        t.Errorf("GetStatus without the token = %v, want a 403 *Error", err)
+    }
+}
+
+func TestUploadFile(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "Bearer k1" {
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        if r.ContentLength <= 0 {
+            http.Error(w, "no length", http.StatusLengthRequired)
+            return
+        }
+        file, header, err := r.FormFile("file")
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        data, _ := io.ReadAll(file)
+        json.NewEncoder(w).Encode(api.UploadResponse{
+            JobID:   "j2",
+            Message: fmt.Sprintf("%s %s %s %s", header.Filename, data, r.FormValue("material"), r.FormValue("infill")),
+        })
+    }))
+    defer srv.Close()
+
+    content := "solid cube"
+    resp, err := NewClient(srv.URL, "k1").UploadFile(context.Background(), "cube.stl", strings.NewReader(content+" and more"), int64(len(content)), UploadOptions{Material: "PETG", Infill: 30})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := "cube.stl solid cube PETG 30"; resp.Message != want {
+        t.Errorf("server saw %q, want %q", resp.Message, want)
+    }
+}
+
+func TestCancelJob(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodDelete {
+            w.WriteHeader(http.StatusMethodNotAllowed)
+            return
+        }
+        if r.URL.Path == "/v1/jobs/busy" {
+            w.WriteHeader(http.StatusConflict)
+            json.NewEncoder(w).Encode(api.ErrorResponse{Error: "Job is already processing"})
+            return
+        }
+        w.WriteHeader(http.StatusAccepted)
+        fmt.Fprint(w, `{"job_id":"j1","status":"cancelled"}`)
+    }))
+    defer srv.Close()
+    c := NewClient(srv.URL, "k1")
+
+    if err := c.CancelJob(context.Background(), "j1"); err != nil {
+        t.Errorf("CancelJob = %v", err)
+    }
+    var apiErr *Error
+    if err := c.CancelJob(context.Background(), "busy"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+        t.Errorf("CancelJob of a processing job = %v, want a 409 *Error", err)
+    }
+}
+
+// sseServer streams events, then holds the connection open until the
+// client goes.
+func sseServer(events ...string) *httptest.Server {
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/v1/status/j1/stream" {
+            w.WriteHeader(http.StatusNotFound)
+            json.NewEncoder(w).Encode(api.ErrorResponse{Error: "Job not found"})
+            return
+        }
+        w.Header().Set("Content-Type", "text/event-stream")
+        for _, ev := range events {
+            fmt.Fprint(w, ev)
+        }
+        w.(http.Flusher).Flush()
+        <-r.Context().Done()
+    }))
+}
+
+func collect(t *testing.T, updates <-chan api.StatusResponse) []string {
+    t.Helper()
+    var statuses []string
+    timeout := time.After(5 * time.Second)
+    for {
+        select {
+        case st, ok := <-updates:
+            if !ok {
+                return statuses
+            }
+            statuses = append(statuses, st.Status)
+        case <-timeout:
+            t.Fatalf("channel still open after %v", statuses)
+        }
+    }
+}
+
+func TestWatchStatusEndsOnFinalStatus(t *testing.T) {
+    srv := sseServer(
+        "event: status\ndata: {\"job_id\":\"j1\",\"status\":\"queued\"}\n\n",
+        ": heartbeat\n\n",
+        "event: status\ndata: {\"job_id\":\"j1\",\"status\":\"processing\",\"progress_percent\":40}\n\n",
+        "event: status\ndata: {\"job_id\":\"j1\",\"status\":\"completed\",\"data\":{\"price\":12.5}}\n\n",
+        "event: end\ndata: completed\n\n",
+    )
+    defer srv.Close()
+
+    updates, err := NewClient(srv.URL, "k1").WatchStatus(context.Background(), "j1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := strings.Join(collect(t, updates), ","); got != "queued,processing,completed" {
+        t.Errorf("statuses = %s", got)
+    }
+}
+
+func TestWatchStatusEndsWithContext(t *testing.T) {
+    srv := sseServer("event: status\ndata: {\"job_id\":\"j1\",\"status\":\"processing\"}\n\n")
+    defer srv.Close()
+
+    ctx, cancel := context.WithCancel(context.Background())
+    updates, err := NewClient(srv.URL, "k1").WatchStatus(ctx, "j1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if st := <-updates; st.Status != "processing" {
+        t.Fatalf("first update = %+v", st)
+    }
+    cancel()
+    if got := collect(t, updates); len(got) != 0 {
+        t.Errorf("updates after cancel = %v", got)
+    }
+}
+
+func TestWatchStatusUnknownJob(t *testing.T) {
+    srv := sseServer()
+    defer srv.Close()
+
+    _, err := NewClient(srv.URL, "k1").WatchStatus(context.Background(), "missing")
+    var apiErr *Error
+    if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+        t.Errorf("WatchStatus = %v, want a 404 *Error", err)
+    }
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/url"
+    "strings"
+
+    "slicer-api/internal/api"
+)
+
+// terminalStatuses are the ones a job doesn't leave.
+var terminalStatuses = map[string]bool{
+    "completed":     true,
+    "failed":        true,
+    "cancelled":     true,
+    "aborted":       true,
+    "dead_lettered": true,
+}
+
+// maxEventBytes bounds one server-sent event's line; results are well
+// under it.
+const maxEventBytes = 1 << 20
+
+// WatchStatus follows the job's status stream, sending its status now and
+// on every change. The channel is closed once the job reaches a final
+// status, when ctx ends, or when the stream breaks off; call GetStatus to
+// tell those apart. An unknown job, or missing credentials, is an *Error
+// before anything is sent.
+func (c *Client) WatchStatus(ctx context.Context, jobID string) (<-chan api.StatusResponse, error) {
+    req, err := c.newRequest(ctx, http.MethodGet, "/status/"+url.PathEscape(jobID)+"/stream", jobID, nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Accept", "text/event-stream")
+    resp, err := c.http.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    if err := checkResponse(resp); err != nil {
+        resp.Body.Close()
+        return nil, err
+    }
+
+    updates := make(chan api.StatusResponse)
+    go func() {
+        defer close(updates)
+        defer resp.Body.Close()
+        readEvents(resp, func(event, data string) bool {
+            if event != "status" {
+                // "end", "expired" or "error": nothing more follows
+                return false
+            }
+            var st api.StatusResponse
+            if json.Unmarshal([]byte(data), &st) != nil {
+                return true
+            }
+            select {
+            case updates <- st:
+            case <-ctx.Done():
+                return false
+            }
+            return !terminalStatuses[st.Status]
+        })
+    }()
+    return updates, nil
+}
+
+// readEvents passes handle each event of an SSE body until it returns false
+// or the body ends. Comments, such as the stream's heartbeats, are skipped.
+func readEvents(resp *http.Response, handle func(event, data string) bool) {
+    scanner := bufio.NewScanner(resp.Body)
+    scanner.Buffer(make([]byte, 0, 64<<10), maxEventBytes)
+    event, data := "", []string{}
+    for scanner.Scan() {
+        line := scanner.Text()
+        switch {
+        case line == "":
+            if len(data) > 0 || event != "" {
+                if event == "" {
+                    event = "message"
+                }
+                if !handle(event, strings.Join(data, "\n")) {
+                    return
+                }
+            }
+            event, data = "", data[:0]
+        case strings.HasPrefix(line, ":"):
+        default:
+            field, value, _ := strings.Cut(line, ":")
+            value = strings.TrimPrefix(value, " ")
+            switch field {
+            case "event":
+                event = value
+            case "data":
+                data = append(data, value)
+            }
+        }
+    }
+}
@@ -0,0 +1,7 @@
+// Package proto holds the PrintJobService gRPC API generated from
+// printjob.proto. Regenerate after editing it with
+//
+//	go generate ./internal/proto
+package proto
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative printjob.proto
@@ -0,0 +1,668 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: printjob.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SubmitJobRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	DownloadUrl string                 `protobuf:"bytes,1,opt,name=download_url,json=downloadUrl,proto3" json:"download_url,omitempty"`
+	Material    string                 `protobuf:"bytes,2,opt,name=material,proto3" json:"material,omitempty"`
+	LayerHeight float64                `protobuf:"fixed64,3,opt,name=layer_height,json=layerHeight,proto3" json:"layer_height,omitempty"`
+	Nozzle      float64                `protobuf:"fixed64,4,opt,name=nozzle,proto3" json:"nozzle,omitempty"`
+	Infill      int32                  `protobuf:"varint,5,opt,name=infill,proto3" json:"infill,omitempty"`
+	Rush        bool                   `protobuf:"varint,6,opt,name=rush,proto3" json:"rush,omitempty"`
+	MaxRetries  *int32                 `protobuf:"varint,7,opt,name=max_retries,json=maxRetries,proto3,oneof" json:"max_retries,omitempty"`
+	// RFC3339 time to hold the job until
+	SubmitAt       string `protobuf:"bytes,8,opt,name=submit_at,json=submitAt,proto3" json:"submit_at,omitempty"`
+	NoCache        bool   `protobuf:"varint,9,opt,name=no_cache,json=noCache,proto3" json:"no_cache,omitempty"`
+	Region         string `protobuf:"bytes,10,opt,name=region,proto3" json:"region,omitempty"`
+	CallbackUrl    string `protobuf:"bytes,11,opt,name=callback_url,json=callbackUrl,proto3" json:"callback_url,omitempty"`
+	CallbackSecret string `protobuf:"bytes,12,opt,name=callback_secret,json=callbackSecret,proto3" json:"callback_secret,omitempty"`
+	// Sent as Idempotency-Key
+	IdempotencyKey string `protobuf:"bytes,13,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SubmitJobRequest) Reset() {
+	*x = SubmitJobRequest{}
+	mi := &file_printjob_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobRequest) ProtoMessage() {}
+
+func (x *SubmitJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_printjob_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobRequest.ProtoReflect.Descriptor instead.
+func (*SubmitJobRequest) Descriptor() ([]byte, []int) {
+	return file_printjob_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitJobRequest) GetDownloadUrl() string {
+	if x != nil {
+		return x.DownloadUrl
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest) GetMaterial() string {
+	if x != nil {
+		return x.Material
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest) GetLayerHeight() float64 {
+	if x != nil {
+		return x.LayerHeight
+	}
+	return 0
+}
+
+func (x *SubmitJobRequest) GetNozzle() float64 {
+	if x != nil {
+		return x.Nozzle
+	}
+	return 0
+}
+
+func (x *SubmitJobRequest) GetInfill() int32 {
+	if x != nil {
+		return x.Infill
+	}
+	return 0
+}
+
+func (x *SubmitJobRequest) GetRush() bool {
+	if x != nil {
+		return x.Rush
+	}
+	return false
+}
+
+func (x *SubmitJobRequest) GetMaxRetries() int32 {
+	if x != nil && x.MaxRetries != nil {
+		return *x.MaxRetries
+	}
+	return 0
+}
+
+func (x *SubmitJobRequest) GetSubmitAt() string {
+	if x != nil {
+		return x.SubmitAt
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest) GetNoCache() bool {
+	if x != nil {
+		return x.NoCache
+	}
+	return false
+}
+
+func (x *SubmitJobRequest) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest) GetCallbackUrl() string {
+	if x != nil {
+		return x.CallbackUrl
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest) GetCallbackSecret() string {
+	if x != nil {
+		return x.CallbackSecret
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+type SubmitJobResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	JobId string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	// Required as x-job-token metadata for anonymous jobs
+	AccessToken   string `protobuf:"bytes,2,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
+	Message       string `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	WorkerOnline  bool   `protobuf:"varint,4,opt,name=worker_online,json=workerOnline,proto3" json:"worker_online,omitempty"`
+	SubmitAt      string `protobuf:"bytes,5,opt,name=submit_at,json=submitAt,proto3" json:"submit_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitJobResponse) Reset() {
+	*x = SubmitJobResponse{}
+	mi := &file_printjob_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobResponse) ProtoMessage() {}
+
+func (x *SubmitJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_printjob_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobResponse.ProtoReflect.Descriptor instead.
+func (*SubmitJobResponse) Descriptor() ([]byte, []int) {
+	return file_printjob_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SubmitJobResponse) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *SubmitJobResponse) GetAccessToken() string {
+	if x != nil {
+		return x.AccessToken
+	}
+	return ""
+}
+
+func (x *SubmitJobResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *SubmitJobResponse) GetWorkerOnline() bool {
+	if x != nil {
+		return x.WorkerOnline
+	}
+	return false
+}
+
+func (x *SubmitJobResponse) GetSubmitAt() string {
+	if x != nil {
+		return x.SubmitAt
+	}
+	return ""
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_printjob_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_printjob_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_printjob_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetStatusRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type StatusResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	JobId string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	// queued, scheduled, processing, completed, failed, cancelling,
+	// cancelled, aborted or dead_lettered; "expired" ends a watch whose
+	// job's keys lapsed
+	Status          string  `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Note            string  `protobuf:"bytes,3,opt,name=note,proto3" json:"note,omitempty"`
+	Attempts        int32   `protobuf:"varint,4,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	CurrentStep     string  `protobuf:"bytes,5,opt,name=current_step,json=currentStep,proto3" json:"current_step,omitempty"`
+	ProgressPercent float64 `protobuf:"fixed64,6,opt,name=progress_percent,json=progressPercent,proto3" json:"progress_percent,omitempty"`
+	// Place in the queue while queued, else -1
+	Position int64 `protobuf:"varint,7,opt,name=position,proto3" json:"position,omitempty"`
+	Cached   bool  `protobuf:"varint,8,opt,name=cached,proto3" json:"cached,omitempty"`
+	// The worker's result once completed or failed
+	Data          *structpb.Struct `protobuf:"bytes,9,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatusResponse) Reset() {
+	*x = StatusResponse{}
+	mi := &file_printjob_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusResponse) ProtoMessage() {}
+
+func (x *StatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_printjob_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusResponse.ProtoReflect.Descriptor instead.
+func (*StatusResponse) Descriptor() ([]byte, []int) {
+	return file_printjob_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *StatusResponse) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *StatusResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *StatusResponse) GetNote() string {
+	if x != nil {
+		return x.Note
+	}
+	return ""
+}
+
+func (x *StatusResponse) GetAttempts() int32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetCurrentStep() string {
+	if x != nil {
+		return x.CurrentStep
+	}
+	return ""
+}
+
+func (x *StatusResponse) GetProgressPercent() float64 {
+	if x != nil {
+		return x.ProgressPercent
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetPosition() int64 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *StatusResponse) GetData() *structpb.Struct {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type CancelJobRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	JobId string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	// Also stop a job a worker is processing
+	Force         bool `protobuf:"varint,2,opt,name=force,proto3" json:"force,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelJobRequest) Reset() {
+	*x = CancelJobRequest{}
+	mi := &file_printjob_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJobRequest) ProtoMessage() {}
+
+func (x *CancelJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_printjob_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJobRequest.ProtoReflect.Descriptor instead.
+func (*CancelJobRequest) Descriptor() ([]byte, []int) {
+	return file_printjob_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CancelJobRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *CancelJobRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+type CancelJobResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	JobId string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	// cancelled, or cancelling until the worker stops
+	Status        string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelJobResponse) Reset() {
+	*x = CancelJobResponse{}
+	mi := &file_printjob_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJobResponse) ProtoMessage() {}
+
+func (x *CancelJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_printjob_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJobResponse.ProtoReflect.Descriptor instead.
+func (*CancelJobResponse) Descriptor() ([]byte, []int) {
+	return file_printjob_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CancelJobResponse) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *CancelJobResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type WatchStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchStatusRequest) Reset() {
+	*x = WatchStatusRequest{}
+	mi := &file_printjob_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchStatusRequest) ProtoMessage() {}
+
+func (x *WatchStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_printjob_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchStatusRequest.ProtoReflect.Descriptor instead.
+func (*WatchStatusRequest) Descriptor() ([]byte, []int) {
+	return file_printjob_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WatchStatusRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+var File_printjob_proto protoreflect.FileDescriptor
+
+const file_printjob_proto_rawDesc = "" +
+	"\n" +
+	"\x0eprintjob.proto\x12\vprintjob.v1\x1a\x1cgoogle/protobuf/struct.proto\"\xb3\x03\n" +
+	"\x10SubmitJobRequest\x12!\n" +
+	"\fdownload_url\x18\x01 \x01(\tR\vdownloadUrl\x12\x1a\n" +
+	"\bmaterial\x18\x02 \x01(\tR\bmaterial\x12!\n" +
+	"\flayer_height\x18\x03 \x01(\x01R\vlayerHeight\x12\x16\n" +
+	"\x06nozzle\x18\x04 \x01(\x01R\x06nozzle\x12\x16\n" +
+	"\x06infill\x18\x05 \x01(\x05R\x06infill\x12\x12\n" +
+	"\x04rush\x18\x06 \x01(\bR\x04rush\x12$\n" +
+	"\vmax_retries\x18\a \x01(\x05H\x00R\n" +
+	"maxRetries\x88\x01\x01\x12\x1b\n" +
+	"\tsubmit_at\x18\b \x01(\tR\bsubmitAt\x12\x19\n" +
+	"\bno_cache\x18\t \x01(\bR\anoCache\x12\x16\n" +
+	"\x06region\x18\n" +
+	" \x01(\tR\x06region\x12!\n" +
+	"\fcallback_url\x18\v \x01(\tR\vcallbackUrl\x12'\n" +
+	"\x0fcallback_secret\x18\f \x01(\tR\x0ecallbackSecret\x12'\n" +
+	"\x0fidempotency_key\x18\r \x01(\tR\x0eidempotencyKeyB\x0e\n" +
+	"\f_max_retries\"\xa9\x01\n" +
+	"\x11SubmitJobResponse\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12!\n" +
+	"\faccess_token\x18\x02 \x01(\tR\vaccessToken\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12#\n" +
+	"\rworker_online\x18\x04 \x01(\bR\fworkerOnline\x12\x1b\n" +
+	"\tsubmit_at\x18\x05 \x01(\tR\bsubmitAt\")\n" +
+	"\x10GetStatusRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"\x9e\x02\n" +
+	"\x0eStatusResponse\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x12\n" +
+	"\x04note\x18\x03 \x01(\tR\x04note\x12\x1a\n" +
+	"\battempts\x18\x04 \x01(\x05R\battempts\x12!\n" +
+	"\fcurrent_step\x18\x05 \x01(\tR\vcurrentStep\x12)\n" +
+	"\x10progress_percent\x18\x06 \x01(\x01R\x0fprogressPercent\x12\x1a\n" +
+	"\bposition\x18\a \x01(\x03R\bposition\x12\x16\n" +
+	"\x06cached\x18\b \x01(\bR\x06cached\x12+\n" +
+	"\x04data\x18\t \x01(\v2\x17.google.protobuf.StructR\x04data\"?\n" +
+	"\x10CancelJobRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x14\n" +
+	"\x05force\x18\x02 \x01(\bR\x05force\"B\n" +
+	"\x11CancelJobResponse\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\"+\n" +
+	"\x12WatchStatusRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId2\xc1\x02\n" +
+	"\x0fPrintJobService\x12J\n" +
+	"\tSubmitJob\x12\x1d.printjob.v1.SubmitJobRequest\x1a\x1e.printjob.v1.SubmitJobResponse\x12G\n" +
+	"\tGetStatus\x12\x1d.printjob.v1.GetStatusRequest\x1a\x1b.printjob.v1.StatusResponse\x12J\n" +
+	"\tCancelJob\x12\x1d.printjob.v1.CancelJobRequest\x1a\x1e.printjob.v1.CancelJobResponse\x12M\n" +
+	"\vWatchStatus\x12\x1f.printjob.v1.WatchStatusRequest\x1a\x1b.printjob.v1.StatusResponse0\x01B!Z\x1fslicer-api/internal/proto;protob\x06proto3"
+
+var (
+	file_printjob_proto_rawDescOnce sync.Once
+	file_printjob_proto_rawDescData []byte
+)
+
+func file_printjob_proto_rawDescGZIP() []byte {
+	file_printjob_proto_rawDescOnce.Do(func() {
+		file_printjob_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_printjob_proto_rawDesc), len(file_printjob_proto_rawDesc)))
+	})
+	return file_printjob_proto_rawDescData
+}
+
+var file_printjob_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_printjob_proto_goTypes = []any{
+	(*SubmitJobRequest)(nil),   // 0: printjob.v1.SubmitJobRequest
+	(*SubmitJobResponse)(nil),  // 1: printjob.v1.SubmitJobResponse
+	(*GetStatusRequest)(nil),   // 2: printjob.v1.GetStatusRequest
+	(*StatusResponse)(nil),     // 3: printjob.v1.StatusResponse
+	(*CancelJobRequest)(nil),   // 4: printjob.v1.CancelJobRequest
+	(*CancelJobResponse)(nil),  // 5: printjob.v1.CancelJobResponse
+	(*WatchStatusRequest)(nil), // 6: printjob.v1.WatchStatusRequest
+	(*structpb.Struct)(nil),    // 7: google.protobuf.Struct
+}
+var file_printjob_proto_depIdxs = []int32{
+	7, // 0: printjob.v1.StatusResponse.data:type_name -> google.protobuf.Struct
+	0, // 1: printjob.v1.PrintJobService.SubmitJob:input_type -> printjob.v1.SubmitJobRequest
+	2, // 2: printjob.v1.PrintJobService.GetStatus:input_type -> printjob.v1.GetStatusRequest
+	4, // 3: printjob.v1.PrintJobService.CancelJob:input_type -> printjob.v1.CancelJobRequest
+	6, // 4: printjob.v1.PrintJobService.WatchStatus:input_type -> printjob.v1.WatchStatusRequest
+	1, // 5: printjob.v1.PrintJobService.SubmitJob:output_type -> printjob.v1.SubmitJobResponse
+	3, // 6: printjob.v1.PrintJobService.GetStatus:output_type -> printjob.v1.StatusResponse
+	5, // 7: printjob.v1.PrintJobService.CancelJob:output_type -> printjob.v1.CancelJobResponse
+	3, // 8: printjob.v1.PrintJobService.WatchStatus:output_type -> printjob.v1.StatusResponse
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_printjob_proto_init() }
+func file_printjob_proto_init() {
+	if File_printjob_proto != nil {
+		return
+	}
+	file_printjob_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_printjob_proto_rawDesc), len(file_printjob_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_printjob_proto_goTypes,
+		DependencyIndexes: file_printjob_proto_depIdxs,
+		MessageInfos:      file_printjob_proto_msgTypes,
+	}.Build()
+	File_printjob_proto = out.File
+	file_printjob_proto_goTypes = nil
+	file_printjob_proto_depIdxs = nil
+}
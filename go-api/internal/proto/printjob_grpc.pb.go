@@ -0,0 +1,257 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: printjob.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PrintJobService_SubmitJob_FullMethodName   = "/printjob.v1.PrintJobService/SubmitJob"
+	PrintJobService_GetStatus_FullMethodName   = "/printjob.v1.PrintJobService/GetStatus"
+	PrintJobService_CancelJob_FullMethodName   = "/printjob.v1.PrintJobService/CancelJob"
+	PrintJobService_WatchStatus_FullMethodName = "/printjob.v1.PrintJobService/WatchStatus"
+)
+
+// PrintJobServiceClient is the client API for PrintJobService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PrintJobService is the gRPC face of the REST API for internal services.
+// Every call goes through the same handlers as its REST route, so
+// credentials, quotas and validation are the same; see grpc.go.
+type PrintJobServiceClient interface {
+	// POST /quote
+	SubmitJob(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (*SubmitJobResponse, error)
+	// GET /status/:id
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// DELETE /jobs/:id
+	CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*CancelJobResponse, error)
+	// GET /status/:id/stream: the current status, then every change until
+	// the job finishes.
+	WatchStatus(ctx context.Context, in *WatchStatusRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StatusResponse], error)
+}
+
+type printJobServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPrintJobServiceClient(cc grpc.ClientConnInterface) PrintJobServiceClient {
+	return &printJobServiceClient{cc}
+}
+
+func (c *printJobServiceClient) SubmitJob(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (*SubmitJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitJobResponse)
+	err := c.cc.Invoke(ctx, PrintJobService_SubmitJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *printJobServiceClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, PrintJobService_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *printJobServiceClient) CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*CancelJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelJobResponse)
+	err := c.cc.Invoke(ctx, PrintJobService_CancelJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *printJobServiceClient) WatchStatus(ctx context.Context, in *WatchStatusRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StatusResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PrintJobService_ServiceDesc.Streams[0], PrintJobService_WatchStatus_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchStatusRequest, StatusResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PrintJobService_WatchStatusClient = grpc.ServerStreamingClient[StatusResponse]
+
+// PrintJobServiceServer is the server API for PrintJobService service.
+// All implementations must embed UnimplementedPrintJobServiceServer
+// for forward compatibility.
+//
+// PrintJobService is the gRPC face of the REST API for internal services.
+// Every call goes through the same handlers as its REST route, so
+// credentials, quotas and validation are the same; see grpc.go.
+type PrintJobServiceServer interface {
+	// POST /quote
+	SubmitJob(context.Context, *SubmitJobRequest) (*SubmitJobResponse, error)
+	// GET /status/:id
+	GetStatus(context.Context, *GetStatusRequest) (*StatusResponse, error)
+	// DELETE /jobs/:id
+	CancelJob(context.Context, *CancelJobRequest) (*CancelJobResponse, error)
+	// GET /status/:id/stream: the current status, then every change until
+	// the job finishes.
+	WatchStatus(*WatchStatusRequest, grpc.ServerStreamingServer[StatusResponse]) error
+	mustEmbedUnimplementedPrintJobServiceServer()
+}
+
+// UnimplementedPrintJobServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPrintJobServiceServer struct{}
+
+func (UnimplementedPrintJobServiceServer) SubmitJob(context.Context, *SubmitJobRequest) (*SubmitJobResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SubmitJob not implemented")
+}
+func (UnimplementedPrintJobServiceServer) GetStatus(context.Context, *GetStatusRequest) (*StatusResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedPrintJobServiceServer) CancelJob(context.Context, *CancelJobRequest) (*CancelJobResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CancelJob not implemented")
+}
+func (UnimplementedPrintJobServiceServer) WatchStatus(*WatchStatusRequest, grpc.ServerStreamingServer[StatusResponse]) error {
+	return status.Error(codes.Unimplemented, "method WatchStatus not implemented")
+}
+func (UnimplementedPrintJobServiceServer) mustEmbedUnimplementedPrintJobServiceServer() {}
+func (UnimplementedPrintJobServiceServer) testEmbeddedByValue()                         {}
+
+// UnsafePrintJobServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PrintJobServiceServer will
+// result in compilation errors.
+type UnsafePrintJobServiceServer interface {
+	mustEmbedUnimplementedPrintJobServiceServer()
+}
+
+func RegisterPrintJobServiceServer(s grpc.ServiceRegistrar, srv PrintJobServiceServer) {
+	// If the following call panics, it indicates UnimplementedPrintJobServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PrintJobService_ServiceDesc, srv)
+}
+
+func _PrintJobService_SubmitJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrintJobServiceServer).SubmitJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PrintJobService_SubmitJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrintJobServiceServer).SubmitJob(ctx, req.(*SubmitJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PrintJobService_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrintJobServiceServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PrintJobService_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrintJobServiceServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PrintJobService_CancelJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PrintJobServiceServer).CancelJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PrintJobService_CancelJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PrintJobServiceServer).CancelJob(ctx, req.(*CancelJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PrintJobService_WatchStatus_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStatusRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PrintJobServiceServer).WatchStatus(m, &grpc.GenericServerStream[WatchStatusRequest, StatusResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PrintJobService_WatchStatusServer = grpc.ServerStreamingServer[StatusResponse]
+
+// PrintJobService_ServiceDesc is the grpc.ServiceDesc for PrintJobService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PrintJobService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "printjob.v1.PrintJobService",
+	HandlerType: (*PrintJobServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitJob",
+			Handler:    _PrintJobService_SubmitJob_Handler,
+		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _PrintJobService_GetStatus_Handler,
+		},
+		{
+			MethodName: "CancelJob",
+			Handler:    _PrintJobService_CancelJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchStatus",
+			Handler:       _PrintJobService_WatchStatus_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "printjob.proto",
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// invoiceCounterKey is INCRed for each new invoice number. An invoice is
+// kept in invoice:{id} once issued, without expiry, so asking again returns
+// the same number after the job's own keys are gone.
+const (
+    invoiceCounterKey = "invoice_counter"
+    invoiceCurrency   = "USD"
+    mimePDF           = "application/pdf"
+)
+
+func invoiceKey(jobID string) string {
+    return "invoice:" + jobID
+}
+
+type InvoiceLineItem struct {
+    Description string  `json:"description"`
+    Quantity    int     `json:"quantity"`
+    UnitPrice   float64 `json:"unit_price"`
+    Amount      float64 `json:"amount"`
+}
+
+type InvoiceData struct {
+    Number     string            `json:"invoice_number"`
+    JobID      string            `json:"job_id"`
+    CustomerID string            `json:"customer_id,omitempty"`
+    Lines      []InvoiceLineItem `json:"lines"`
+    Total      float64           `json:"total"`
+    Currency   string            `json:"currency"`
+    IssuedAt   time.Time         `json:"issued_at"`
+    DueDate    time.Time         `json:"due_date"`
+}
+
+// errNoPrice means the result has nothing to bill.
+var errNoPrice = fmt.Errorf("job result has no price")
+
+// GET /jobs/:id/invoice bills a completed job: JSON by default, a PDF with
+// Accept: application/pdf. Other states get 409.
+func handleJobInvoice(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    status, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    stored, err := rdb.Get(ctx, invoiceKey(jobID)).Bytes()
+    if err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if status == "" && stored == nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if status != "" && !authorizeJob(c, jobID) {
+        return
+    }
+
+    var inv InvoiceData
+    if stored != nil {
+        if err := json.Unmarshal(stored, &inv); err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Unreadable invoice"})
+            return
+        }
+        // The job and its access token have expired; only the owner is left
+        if status == "" && inv.CustomerID != "" && inv.CustomerID != requestOwner(c) {
+            c.JSON(http.StatusForbidden, api.ErrorResponse{Error: "Not your job"})
+            return
+        }
+    } else {
+        if status != "completed" {
+            c.JSON(http.StatusConflict, gin.H{"error": "Only completed jobs can be invoiced", "status": status})
+            return
+        }
+        inv, err = issueInvoice(ctx, jobID)
+        if err == errNoPrice {
+            c.JSON(http.StatusConflict, api.ErrorResponse{Error: "Job result has no price to invoice"})
+            return
+        } else if err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+    }
+
+    if c.NegotiateFormat(gin.MIMEJSON, mimePDF) == mimePDF {
+        c.Header("Content-Disposition", `inline; filename="invoice-`+inv.Number+`.pdf"`)
+        c.Data(http.StatusOK, mimePDF, renderInvoicePDF(inv))
+        return
+    }
+    c.JSON(http.StatusOK, inv)
+}
+
+// issueInvoice builds the invoice for a completed job and stores it. Two
+// requests racing for the same job both take a number, and the one that
+// loses the SETNX leaves a gap in the sequence.
+func issueInvoice(ctx context.Context, jobID string) (InvoiceData, error) {
+    var inv InvoiceData
+    res, err := rdb.Get(ctx, "result:"+jobID).Bytes()
+    if err == redis.Nil {
+        return inv, errNoPrice
+    } else if err != nil {
+        return inv, err
+    }
+    price, ok := resultPrice(res)
+    if !ok {
+        return inv, errNoPrice
+    }
+    var result struct {
+        Summary struct {
+            PrintTime string `json:"print_time"`
+        } `json:"summary"`
+    }
+    json.Unmarshal(res, &result)
+
+    // Params are gone once the job's keys expire; the result alone still
+    // bills it
+    var job struct {
+        OwnerID     string  `json:"owner_id"`
+        Material    string  `json:"material"`
+        LayerHeight float64 `json:"layer_height"`
+        Infill      int     `json:"infill"`
+        Rush        bool    `json:"rush"`
+        Quantity    int     `json:"quantity"`
+    }
+    if payload, err := rdb.Get(ctx, "params:"+jobID).Bytes(); err == nil {
+        unmarshalPayload(payload, &job)
+    }
+    if job.Quantity < 1 {
+        job.Quantity = 1
+    }
+
+    n, err := rdb.Incr(ctx, invoiceCounterKey).Result()
+    if err != nil {
+        return inv, err
+    }
+    now := time.Now().UTC().Truncate(time.Second)
+    line := InvoiceLineItem{
+        Description: invoiceDescription(job.Material, job.LayerHeight, job.Infill, job.Rush, result.Summary.PrintTime),
+        Quantity:    job.Quantity,
+        UnitPrice:   price,
+        Amount:      roundCents(price * float64(job.Quantity)),
+    }
+    inv = InvoiceData{
+        Number:     fmt.Sprintf("%08d", n),
+        JobID:      jobID,
+        CustomerID: job.OwnerID,
+        Lines:      []InvoiceLineItem{line},
+        Total:      line.Amount,
+        Currency:   invoiceCurrency,
+        IssuedAt:   now,
+        DueDate:    now.Add(cfg().InvoiceDue()),
+    }
+    data, _ := json.Marshal(inv)
+    if ok, err := rdb.SetNX(ctx, invoiceKey(jobID), data, 0).Result(); err != nil {
+        return inv, err
+    } else if !ok {
+        // Another request issued it first; bill with that one
+        stored, err := rdb.Get(ctx, invoiceKey(jobID)).Bytes()
+        if err != nil {
+            return inv, err
+        }
+        err = json.Unmarshal(stored, &inv)
+        return inv, err
+    }
+    return inv, nil
+}
+
+// resultPrice reads the quoted price from a worker result: summary.total_cost,
+// or a flat estimated_price.
+func resultPrice(raw []byte) (float64, bool) {
+    var res struct {
+        EstimatedPrice *float64 `json:"estimated_price"`
+        Summary        struct {
+            TotalCost *float64 `json:"total_cost"`
+        } `json:"summary"`
+    }
+    if json.Unmarshal(raw, &res) != nil {
+        return 0, false
+    }
+    if res.Summary.TotalCost != nil {
+        return *res.Summary.TotalCost, true
+    }
+    if res.EstimatedPrice != nil {
+        return *res.EstimatedPrice, true
+    }
+    return 0, false
+}
+
+func invoiceDescription(material string, layerHeight float64, infill int, rush bool, printTime string) string {
+    parts := []string{"3D print"}
+    if material != "" {
+        parts = append(parts, material)
+    }
+    if layerHeight > 0 {
+        parts = append(parts, fmt.Sprintf("%gmm layers", layerHeight))
+    }
+    if infill > 0 {
+        parts = append(parts, fmt.Sprintf("%d%% infill", infill))
+    }
+    desc := strings.Join(parts, ", ")
+    if printTime != "" {
+        desc += " (est. print time " + printTime + ")"
+    }
+    if rush {
+        desc += ", rush"
+    }
+    return desc
+}
+
+func roundCents(v float64) float64 {
+    return float64(int64(v*100+0.5)) / 100
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// renderInvoicePDF lays inv out on one A4 page. The invoice is a handful of
+// text lines, so the PDF is written by hand with the built-in Helvetica font
+// rather than pulling in a PDF library.
+func renderInvoicePDF(inv InvoiceData) []byte {
+    var page pdfText
+    page.line(50, 790, 20, "Invoice "+inv.Number)
+    page.line(50, 760, 10, "Job: "+inv.JobID)
+    if inv.CustomerID != "" {
+        page.line(50, 745, 10, "Customer: "+inv.CustomerID)
+    }
+    page.line(50, 730, 10, "Issued: "+inv.IssuedAt.Format("2006-01-02"))
+    page.line(50, 715, 10, "Due: "+inv.DueDate.Format("2006-01-02"))
+
+    y := 680
+    page.line(50, y, 10, "Description")
+    page.line(380, y, 10, "Qty")
+    page.line(420, y, 10, "Unit price")
+    page.line(500, y, 10, "Amount")
+    for _, l := range inv.Lines {
+        y -= 18
+        page.line(50, y, 9, l.Description)
+        page.line(380, y, 9, strconv.Itoa(l.Quantity))
+        page.line(420, y, 9, money(l.UnitPrice, inv.Currency))
+        page.line(500, y, 9, money(l.Amount, inv.Currency))
+    }
+    page.line(420, y-30, 12, "Total: "+money(inv.Total, inv.Currency))
+
+    content := page.String()
+    objects := []string{
+        "<< /Type /Catalog /Pages 2 0 R >>",
+        "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+        "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+        "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+        fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+    }
+
+    var buf bytes.Buffer
+    buf.WriteString("%PDF-1.4\n")
+    offsets := make([]int, len(objects))
+    for i, obj := range objects {
+        offsets[i] = buf.Len()
+        fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+    }
+    xref := buf.Len()
+    fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+    for _, off := range offsets {
+        fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+    }
+    fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+    return buf.Bytes()
+}
+
+// pdfText accumulates a page's text drawing operators.
+type pdfText struct {
+    strings.Builder
+}
+
+func (p *pdfText) line(x, y, size int, text string) {
+    fmt.Fprintf(p, "BT /F1 %d Tf %d %d Td (%s) Tj ET\n", size, x, y, pdfEscape(text))
+}
+
+// pdfEscape quotes s for a PDF string literal. Helvetica here is
+// WinAnsi-encoded, so characters outside Latin-1 become "?".
+func pdfEscape(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch {
+        case r == '(' || r == ')' || r == '\\':
+            b.WriteByte('\\')
+            b.WriteRune(r)
+        case r < 0x20 || r > 0xff:
+            b.WriteByte('?')
+        case r > 0x7e:
+            fmt.Fprintf(&b, "\\%03o", r)
+        default:
+            b.WriteRune(r)
+        }
+    }
+    return b.String()
+}
+
+func money(v float64, currency string) string {
+    if currency == "USD" {
+        return fmt.Sprintf("$%.2f", v)
+    }
+    return fmt.Sprintf("%.2f %s", v, currency)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "testing"
+)
+
+func completedJob(t *testing.T, jobID string, price float64) {
+    t.Helper()
+    rdb.Set(ctx, "status:"+jobID, "completed", 0)
+    rdb.Set(ctx, "params:"+jobID, `{"id":"`+jobID+`","material":"PETG","layer_height":0.2,"infill":20}`, 0)
+    rdb.Set(ctx, "result:"+jobID, `{"success":true,"summary":{"total_cost":`+strconv.FormatFloat(price, 'f', -1, 64)+`,"print_time":"1h 5m"}}`, 0)
+}
+
+func getInvoice(t *testing.T, h http.Handler, jobID string) InvoiceData {
+    t.Helper()
+    w := do(h, http.MethodGet, "/jobs/"+jobID+"/invoice", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("invoice %s: status = %d, want 200 (body %s)", jobID, w.Code, w.Body)
+    }
+    var inv InvoiceData
+    json.Unmarshal(w.Body.Bytes(), &inv)
+    return inv
+}
+
+func TestInvoiceForCompletedJob(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    completedJob(t, "j1", 24.9)
+    completedJob(t, "j2", 9.9)
+
+    inv := getInvoice(t, r, "j1")
+    if inv.Number != "00000001" || inv.Total != 24.9 || len(inv.Lines) != 1 || inv.Lines[0].Quantity != 1 {
+        t.Fatalf("invoice = %+v, want number 00000001 for one line totalling 24.90", inv)
+    }
+    if due := inv.DueDate.Sub(inv.IssuedAt); due != cfg().InvoiceDue() {
+        t.Errorf("due %v after issue, want %v", due, cfg().InvoiceDue())
+    }
+    if again := getInvoice(t, r, "j1"); again.Number != inv.Number {
+        t.Errorf("second request got number %s, want the stored %s", again.Number, inv.Number)
+    }
+    if next := getInvoice(t, r, "j2"); next.Number != "00000002" {
+        t.Errorf("next job got number %s, want 00000002", next.Number)
+    }
+}
+
+func TestInvoiceNeedsCompletedJob(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    if w := do(r, http.MethodGet, "/jobs/j1/invoice", ""); w.Code != http.StatusConflict {
+        t.Fatalf("processing job: status = %d, want 409", w.Code)
+    }
+    if w := do(r, http.MethodGet, "/jobs/missing/invoice", ""); w.Code != http.StatusNotFound {
+        t.Fatalf("missing job: status = %d, want 404", w.Code)
+    }
+    if n := rdb.Exists(ctx, invoiceCounterKey).Val(); n != 0 {
+        t.Error("invoice number taken for a job that can't be invoiced")
+    }
+}
+
+func TestInvoicePDF(t *testing.T) {
+    setupTest(t)
+    completedJob(t, "j1", 24.9)
+
+    w := do(newRouter(), http.MethodGet, "/jobs/j1/invoice", "", "Accept", "application/pdf")
+    if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" {
+        t.Fatalf("status = %d, Content-Type %q; want a PDF", w.Code, w.Header().Get("Content-Type"))
+    }
+    pdf := w.Body.Bytes()
+    if !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+        t.Fatalf("body is not a PDF: %.40q", pdf)
+    }
+    // startxref must point at the xref table for readers to open it
+    i := bytes.LastIndex(pdf, []byte("startxref\n"))
+    off, err := strconv.Atoi(string(bytes.Fields(pdf[i+len("startxref\n"):])[0]))
+    if err != nil || !bytes.HasPrefix(pdf[off:], []byte("xref\n")) {
+        t.Fatalf("startxref %d doesn't point at the xref table", off)
+    }
+    if !bytes.Contains(pdf, []byte("(Invoice 00000001)")) || !bytes.Contains(pdf, []byte("$24.90")) {
+        t.Error("PDF is missing the invoice number or total")
+    }
+}
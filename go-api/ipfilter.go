@@ -0,0 +1,145 @@
+package main
+
+import (
+    "context"
+    "net"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// Entries added through POST /admin/blocklist, shared by all replicas.
+const dynamicBlocklistKey = "blocklist:dynamic"
+
+// parseIPNet accepts a CIDR or a bare IP, which is treated as a single host.
+func parseIPNet(s string) (*net.IPNet, error) {
+    s = strings.TrimSpace(s)
+    if !strings.Contains(s, "/") {
+        if ip := net.ParseIP(s); ip != nil {
+            if ip.To4() != nil {
+                s += "/32"
+            } else {
+                s += "/128"
+            }
+        }
+    }
+    _, n, err := net.ParseCIDR(s)
+    return n, err
+}
+
+func parseIPNets(list []string) ([]*net.IPNet, error) {
+    nets := make([]*net.IPNet, 0, len(list))
+    for _, s := range list {
+        if strings.TrimSpace(s) == "" {
+            continue
+        }
+        n, err := parseIPNet(s)
+        if err != nil {
+            return nil, err
+        }
+        nets = append(nets, n)
+    }
+    return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+    for _, n := range nets {
+        if n.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// dynamicallyBlocked checks ip against the Redis blocklist.
+func dynamicallyBlocked(ctx context.Context, ip net.IP) bool {
+    entries, err := rdb.SMembers(ctx, dynamicBlocklistKey).Result()
+    if err != nil {
+        return false
+    }
+    for _, e := range entries {
+        if n, err := parseIPNet(e); err == nil && n.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// ipLists are ALLOWED_IPS and BLOCKED_IPS parsed. They were checked in
+// Validate, so they parse here.
+type ipAccessLists struct {
+    allowed, blocked []*net.IPNet
+}
+
+var ipLists = configDerived[ipAccessLists]{build: func(c *Config) ipAccessLists {
+    var l ipAccessLists
+    l.allowed, _ = parseIPNets(c.AllowedIPs)
+    l.blocked, _ = parseIPNets(c.BlockedIPs)
+    return l
+}}
+
+// ipFilter answers 403 to clients on BLOCKED_IPS or the dynamic blocklist,
+// and, when ALLOWED_IPS is set, to anyone not on it. Blocking wins over
+// allowing.
+func ipFilter() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        lists := ipLists.get()
+        ip := net.ParseIP(c.ClientIP())
+        if ip == nil {
+            c.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResponse{Error: "Access denied"})
+            return
+        }
+        if containsIP(lists.blocked, ip) || dynamicallyBlocked(c.Request.Context(), ip) {
+            c.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResponse{Error: "Access denied"})
+            return
+        }
+        if len(lists.allowed) > 0 && !containsIP(lists.allowed, ip) {
+            c.AbortWithStatusJSON(http.StatusForbidden, api.ErrorResponse{Error: "Access denied"})
+            return
+        }
+        c.Next()
+    }
+}
+
+// POST /admin/blocklist {"ip": "203.0.113.7" or "203.0.113.0/24"}
+func handleAddBlocklist(c *gin.Context) {
+    var req struct {
+        IP string `json:"ip" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    n, err := parseIPNet(req.IP)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "ip must be an IP address or CIDR"})
+        return
+    }
+    if err := rdb.SAdd(c.Request.Context(), dynamicBlocklistKey, n.String()).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusCreated, gin.H{"blocked": n.String()})
+}
+
+// DELETE /admin/blocklist/:ip; CIDRs are given as-is, e.g. /admin/blocklist/203.0.113.0/24
+func handleRemoveBlocklist(c *gin.Context) {
+    n, err := parseIPNet(strings.TrimPrefix(c.Param("ip"), "/"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "ip must be an IP address or CIDR"})
+        return
+    }
+    removed, err := rdb.SRem(c.Request.Context(), dynamicBlocklistKey, n.String()).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if removed == 0 {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Not on the blocklist"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"unblocked": n.String()})
+}
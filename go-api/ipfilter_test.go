@@ -0,0 +1,34 @@
+package main
+
+import (
+    "net/http"
+    "testing"
+)
+
+func TestIPFilterIgnoresSpoofedForwardedFor(t *testing.T) {
+    tests := []struct {
+        name      string
+        configure func(*Config)
+        want      int
+    }{
+        {"blocked peer can't pose as another client", func(c *Config) {
+            c.BlockedIPs = []string{"192.0.2.1"}
+        }, http.StatusForbidden},
+        {"peer off the allowlist can't claim an allowed IP", func(c *Config) {
+            c.AllowedIPs = []string{"203.0.113.9"}
+        }, http.StatusForbidden},
+        {"trusted proxy's header is honoured", func(c *Config) {
+            c.AllowedIPs = []string{"203.0.113.9"}
+            c.TrustedProxies = []string{"192.0.2.0/24"}
+        }, http.StatusOK},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setupTest(t, tt.configure)
+            w := do(newRouter(), http.MethodGet, "/healthz", "", "X-Forwarded-For", "203.0.113.9")
+            if w.Code != tt.want {
+                t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body)
+            }
+        })
+    }
+}
@@ -0,0 +1,39 @@
+package main
+
+// A failed job's result carries one of these in error_code, so clients can
+// tell the customer more than "failed". Workers set it; results with a code
+// outside the list, or an error without one, are shown as internal_error.
+const (
+    errDownloadFailed    = "download_failed"
+    errUnsupportedFormat = "unsupported_format"
+    errGeometry          = "geometry_error"
+    errSlicerCrash       = "slicer_crash"
+    errTimeout           = "timeout"
+    errCancelled         = "cancelled"
+    errInternal          = "internal_error"
+)
+
+// jobError is what an error code tells the customer: a message for the
+// UI, and whether they can fix it themselves or have to wait for us.
+type jobError struct {
+    message    string
+    actionable bool
+}
+
+var jobErrors = map[string]jobError{
+    errDownloadFailed:    {"The file couldn't be downloaded. Check that the link works, or upload the file again.", true},
+    errUnsupportedFormat: {"This file type can't be sliced. Try an STL, 3MF, OBJ or STEP file.", true},
+    errGeometry:          {"The model's geometry couldn't be sliced. Repair the mesh or try a different file.", true},
+    errSlicerCrash:       {"The slicer crashed on this model. We've been notified and are looking into it.", false},
+    errTimeout:           {"Slicing took longer than allowed and was stopped. We've been notified and are looking into it.", false},
+    errCancelled:         {"The job was cancelled before it finished. Submit it again to get a quote.", true},
+    errInternal:          {"Something went wrong on our side. We've been notified and are looking into it.", false},
+}
+
+// normalizeErrorCode maps code onto the taxonomy.
+func normalizeErrorCode(code string) string {
+    if _, ok := jobErrors[code]; ok {
+        return code
+    }
+    return errInternal
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+    "context"
+    "encoding/base64"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// owner_jobs:{owner} indexes an owner's jobs for GET /jobs: a sorted set of
+// job IDs scored by submission time in Unix milliseconds. Anonymous jobs
+// have no owner to list them under. Entries are dropped once their jobs
+// can no longer exist, see jobListRetention.
+func ownerJobsKey(owner string) string {
+    return "owner_jobs:" + owner
+}
+
+const (
+    jobListDefaultLimit = 20
+    jobListMaxLimit     = 100
+)
+
+// indexJob adds jobID to its owner's index, dropping entries whose jobs
+// have expired.
+func indexJob(ctx context.Context, jobID, owner string, at time.Time) {
+    if owner == "" {
+        return
+    }
+    key := ownerJobsKey(owner)
+    pipe := rdb.TxPipeline()
+    pipe.ZAdd(ctx, key, &redis.Z{Score: float64(at.UnixMilli()), Member: jobID})
+    pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(at.Add(-jobListRetention()).UnixMilli(), 10))
+    pipe.Expire(ctx, key, jobListRetention())
+    pipe.Exec(ctx)
+}
+
+// jobCursor is the last entry of a page. Jobs submitted in the same
+// millisecond are told apart by ID, in the order Redis keeps them.
+type jobCursor struct {
+    score int64
+    id    string
+}
+
+var errBadCursor = errors.New("invalid cursor")
+
+// String is the opaque form handed to clients.
+func (cur jobCursor) String() string {
+    return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(cur.score, 10) + ":" + cur.id))
+}
+
+func parseJobCursor(s string) (jobCursor, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return jobCursor{}, errBadCursor
+    }
+    score, id, ok := strings.Cut(string(raw), ":")
+    n, err := strconv.ParseInt(score, 10, 64)
+    if !ok || err != nil || id == "" {
+        return jobCursor{}, errBadCursor
+    }
+    return jobCursor{n, id}, nil
+}
+
+// follows reports whether z comes after the cursor. Reads start at the
+// cursor's score, so only entries sharing it need the ID compared.
+func (cur jobCursor) follows(z redis.Z, desc bool) bool {
+    id, _ := z.Member.(string)
+    if int64(z.Score) != cur.score {
+        return true
+    }
+    if desc {
+        return id < cur.id
+    }
+    return id > cur.id
+}
+
+// jobPage reads up to limit entries of key after cur, or from the start
+// when cur is nil, and reports whether more follow. It reads one more than
+// it needs to find out, and goes on reading while entries sharing the
+// cursor's score are skipped.
+func jobPage(ctx context.Context, key string, cur *jobCursor, limit int, desc bool) ([]redis.Z, bool, error) {
+    from := "-inf"
+    if desc {
+        from = "+inf"
+    }
+    if cur != nil {
+        from = strconv.FormatInt(cur.score, 10)
+    }
+    count := int64(limit + 1)
+    var page []redis.Z
+    for offset := int64(0); ; offset += count {
+        var batch []redis.Z
+        var err error
+        if desc {
+            batch, err = rdb.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: from, Offset: offset, Count: count}).Result()
+        } else {
+            batch, err = rdb.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: from, Max: "+inf", Offset: offset, Count: count}).Result()
+        }
+        if err != nil {
+            return nil, false, err
+        }
+        for _, z := range batch {
+            if cur != nil && !cur.follows(z, desc) {
+                continue
+            }
+            if len(page) == limit {
+                return page, true, nil
+            }
+            page = append(page, z)
+        }
+        if int64(len(batch)) < count {
+            return page, false, nil
+        }
+    }
+}
+
+// GET /jobs lists the caller's jobs from the last day, newest first or with
+// ?order=asc oldest first, ?limit= at a time (20, at most 100). Each page's
+// next_cursor, passed back as ?cursor=, picks up after its last job, so jobs
+// submitted meanwhile don't shift later pages; it is null on the last page.
+//
+//	@Summary	List the caller's jobs
+//	@Produce	json
+//	@Param		cursor	query		string	false	"next_cursor of the previous page"
+//	@Param		order	query		string	false	"desc (default) or asc"
+//	@Param		limit	query		int		false	"Jobs per page, 1 to 100"
+//	@Param		fields	query		string	false	"Comma-separated job keys to return"
+//	@Success	200		{object}	api.JobListResponse
+//	@Failure	400		{object}	api.ErrorResponse
+//	@Failure	401		{object}	api.ErrorResponse
+//	@Router		/jobs [get]
+func handleListJobs(c *gin.Context) {
+    ctx := c.Request.Context()
+
+    limit := jobListDefaultLimit
+    if raw := c.Query("limit"); raw != "" {
+        n, err := strconv.Atoi(raw)
+        if err != nil || n < 1 || n > jobListMaxLimit {
+            c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "limit must be between 1 and " + strconv.Itoa(jobListMaxLimit)})
+            return
+        }
+        limit = n
+    }
+    var desc bool
+    switch c.DefaultQuery("order", "desc") {
+    case "desc":
+        desc = true
+    case "asc":
+    default:
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "order must be asc or desc"})
+        return
+    }
+    var cur *jobCursor
+    if raw := c.Query("cursor"); raw != "" {
+        parsed, err := parseJobCursor(raw)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Invalid cursor"})
+            return
+        }
+        cur = &parsed
+    }
+
+    key := ownerJobsKey(requestOwner(c))
+    page, more, err := jobPage(ctx, key, cur, limit, desc)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+
+    pipe := rdb.Pipeline()
+    reads := make([]*redis.SliceCmd, len(page))
+    for i, z := range page {
+        id, _ := z.Member.(string)
+        reads[i] = pipe.MGet(ctx, "status:"+id, "created_at:"+id)
+    }
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+
+    resp := api.JobListResponse{Jobs: []api.JobSummary{}}
+    for i, z := range page {
+        id, _ := z.Member.(string)
+        vals := reads[i].Val()
+        status, ok := vals[0].(string)
+        if !ok {
+            // Expired ahead of its index entry
+            rdb.ZRem(ctx, key, id)
+            continue
+        }
+        createdAt, _ := vals[1].(string)
+        resp.Jobs = append(resp.Jobs, api.JobSummary{JobID: id, Status: string(parseJobStatus(status)), CreatedAt: createdAt})
+    }
+    // From the last entry read rather than shown, so skipping expired jobs
+    // doesn't move the cursor back
+    if more {
+        last := page[len(page)-1]
+        id, _ := last.Member.(string)
+        next := jobCursor{int64(last.Score), id}.String()
+        resp.NextCursor = &next
+    }
+
+    // ?fields= trims each job; next_cursor is always there to page on
+    if fields := requestedFields(c); fields != nil {
+        jobs := make([]interface{}, len(resp.Jobs))
+        for i, j := range resp.Jobs {
+            jobs[i] = selectFields(j, fields)
+        }
+        c.JSON(http.StatusOK, gin.H{"jobs": jobs, "next_cursor": resp.NextCursor})
+        return
+    }
+    c.JSON(http.StatusOK, resp)
+}
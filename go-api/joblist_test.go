@@ -0,0 +1,192 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "reflect"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+func jobListTestRouter(t *testing.T) *gin.Engine {
+    t.Helper()
+    setupTest(t, func(c *Config) { c.APIKeys = map[string]string{"k1": "acme", "k2": "globex"} })
+    return newRouter()
+}
+
+// seedJob lists a queued job under owner as submitted at.
+func seedJob(id, owner string, at time.Time) {
+    rdb.Set(ctx, "status:"+id, "queued", time.Hour)
+    indexJob(ctx, id, owner, at)
+}
+
+func listJobs(t *testing.T, h http.Handler, query url.Values) api.JobListResponse {
+    t.Helper()
+    w := do(h, http.MethodGet, "/jobs?"+query.Encode(), "", "Authorization", "Bearer k1")
+    if w.Code != http.StatusOK {
+        t.Fatalf("GET /jobs?%s: status = %d, want 200: %s", query.Encode(), w.Code, w.Body)
+    }
+    var resp api.JobListResponse
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    }
+    return resp
+}
+
+// listAll follows next_cursor to the end, calling between after each page.
+func listAll(t *testing.T, h http.Handler, order string, limit int, between func(page int)) []string {
+    t.Helper()
+    var ids []string
+    query := url.Values{"order": {order}, "limit": {fmt.Sprint(limit)}}
+    for page := 0; ; page++ {
+        resp := listJobs(t, h, query)
+        for _, j := range resp.Jobs {
+            ids = append(ids, j.JobID)
+        }
+        if resp.NextCursor == nil {
+            return ids
+        }
+        if page > 50 {
+            t.Fatal("pagination doesn't end")
+        }
+        if between != nil {
+            between(page)
+        }
+        query.Set("cursor", *resp.NextCursor)
+    }
+}
+
+func TestListJobsPages(t *testing.T) {
+    r := jobListTestRouter(t)
+    base := time.Now().Add(-time.Hour)
+    // b1..b3 share a millisecond, so pages split on the ID tiebreaker
+    seedJob("a", "apikey:acme", base)
+    seedJob("b1", "apikey:acme", base.Add(time.Second))
+    seedJob("b2", "apikey:acme", base.Add(time.Second))
+    seedJob("b3", "apikey:acme", base.Add(time.Second))
+    seedJob("c", "apikey:acme", base.Add(2*time.Second))
+    seedJob("other", "apikey:globex", base)
+
+    asc := []string{"a", "b1", "b2", "b3", "c"}
+    desc := []string{"c", "b3", "b2", "b1", "a"}
+    for _, limit := range []int{1, 2, 3, 5, 100} {
+        if got := listAll(t, r, "asc", limit, nil); !reflect.DeepEqual(got, asc) {
+            t.Errorf("asc, limit %d = %v, want %v", limit, got, asc)
+        }
+        if got := listAll(t, r, "desc", limit, nil); !reflect.DeepEqual(got, desc) {
+            t.Errorf("desc, limit %d = %v, want %v", limit, got, desc)
+        }
+    }
+
+    resp := listJobs(t, r, url.Values{"limit": {"5"}})
+    if resp.NextCursor != nil {
+        t.Errorf("next_cursor = %q on the last page, want null", *resp.NextCursor)
+    }
+    if len(resp.Jobs) != 5 || resp.Jobs[0].JobID != "c" {
+        t.Errorf("default order = %+v, want newest first", resp.Jobs)
+    }
+}
+
+func TestListJobsStableUnderInserts(t *testing.T) {
+    r := jobListTestRouter(t)
+    base := time.Now().Add(-time.Hour)
+    var seeded []string
+    for i := 0; i < 10; i++ {
+        id := fmt.Sprintf("j%02d", i)
+        seedJob(id, "apikey:acme", base.Add(time.Duration(i)*time.Second))
+        seeded = append(seeded, id)
+    }
+
+    // Newer jobs arrive between pages, one sharing the millisecond of the
+    // newest seeded job
+    var added []string
+    insert := func(page int) {
+        id := fmt.Sprintf("new%d", page)
+        seedJob(id, "apikey:acme", time.Now().Add(time.Duration(page)*time.Millisecond))
+        added = append(added, id)
+        if page == 0 {
+            seedJob("j09z", "apikey:acme", base.Add(9*time.Second))
+            added = append(added, "j09z")
+        }
+    }
+
+    got := listAll(t, r, "desc", 3, insert)
+    seen := map[string]int{}
+    for _, id := range got {
+        seen[id]++
+    }
+    for _, id := range seeded {
+        if seen[id] != 1 {
+            t.Errorf("desc: %s listed %d times, want once", id, seen[id])
+        }
+    }
+    for id, n := range seen {
+        if n > 1 {
+            t.Errorf("desc: %s listed %d times", id, n)
+        }
+    }
+
+    added = nil
+    got = listAll(t, r, "asc", 3, insert)
+    seen = map[string]int{}
+    for _, id := range got {
+        seen[id]++
+    }
+    for _, id := range seeded {
+        if seen[id] != 1 {
+            t.Errorf("asc: %s listed %d times, want once", id, seen[id])
+        }
+    }
+    // Ascending reaches everything added past the cursor
+    for _, id := range added {
+        if seen[id] != 1 {
+            t.Errorf("asc: %s, added during pagination, listed %d times, want once", id, seen[id])
+        }
+    }
+}
+
+func TestListJobsSkipsExpired(t *testing.T) {
+    r := jobListTestRouter(t)
+    base := time.Now().Add(-time.Hour)
+    seedJob("a", "apikey:acme", base)
+    seedJob("b", "apikey:acme", base.Add(time.Second))
+    rdb.Del(ctx, "status:a")
+
+    resp := listJobs(t, r, url.Values{})
+    if len(resp.Jobs) != 1 || resp.Jobs[0].JobID != "b" {
+        t.Errorf("jobs = %+v, want only b", resp.Jobs)
+    }
+    if n := rdb.ZCard(ctx, ownerJobsKey("apikey:acme")).Val(); n != 1 {
+        t.Errorf("index holds %d entries, want the expired one dropped", n)
+    }
+}
+
+func TestListJobsSubmitted(t *testing.T) {
+    r := jobListTestRouter(t)
+    w := do(r, http.MethodPost, "/quote", versionQuote, "Authorization", "Bearer k1")
+    var sub api.SubmitJobResponse
+    json.Unmarshal(w.Body.Bytes(), &sub)
+
+    resp := listJobs(t, r, url.Values{})
+    if len(resp.Jobs) != 1 || resp.Jobs[0].JobID != sub.JobID || resp.Jobs[0].Status != "queued" || resp.Jobs[0].CreatedAt == "" {
+        t.Errorf("jobs = %+v, want the submitted job", resp.Jobs)
+    }
+}
+
+func TestListJobsRejects(t *testing.T) {
+    r := jobListTestRouter(t)
+    for _, query := range []string{"order=sideways", "limit=0", "limit=101", "cursor=!!", "cursor=" + url.QueryEscape(jobCursor{}.String())} {
+        if w := do(r, http.MethodGet, "/jobs?"+query, "", "Authorization", "Bearer k1"); w.Code != http.StatusBadRequest {
+            t.Errorf("GET /jobs?%s: status = %d, want 400", query, w.Code)
+        }
+    }
+    if w := do(r, http.MethodGet, "/jobs", ""); w.Code != http.StatusUnauthorized {
+        t.Errorf("anonymous GET /jobs: status = %d, want 401", w.Code)
+    }
+}
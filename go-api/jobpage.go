@@ -0,0 +1,115 @@
+package main
+
+import (
+    "fmt"
+    "html/template"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+// jobPageRefresh is how often, in seconds, the page of an unfinished job
+// reloads itself for browsers without JavaScript.
+const jobPageRefresh = 10
+
+// jobPageTemplate is jobpage.html, the page customers are texted a link to.
+var jobPageTemplate = template.Must(template.New("jobpage").Parse(string(jobPageHTML)))
+
+// jobPageLabels are the statuses as the page words them; any other is
+// shown as it is.
+var jobPageLabels = map[JobStatus]string{
+    StatusQueued:       "Waiting in the queue",
+    StatusScheduled:    "Scheduled",
+    StatusProcessing:   "Slicing your model",
+    StatusCancelling:   "Cancelling",
+    StatusCompleted:    "Your quote is ready",
+    StatusFailed:       "We couldn't quote your print",
+    StatusCancelled:    "Cancelled",
+    StatusAborted:      "Stopped",
+    StatusDeadLettered: "We couldn't quote your print",
+}
+
+// jobPageData is what jobPageTemplate is executed with. The quote's
+// figures are empty when the result doesn't have them.
+type jobPageData struct {
+    JobID, Status, Label, Note, CreatedAt string
+    NotFound, Terminal, Finished          bool
+    // Progress while processing
+    Step                               string
+    Percent                            int
+    Price, PrintTime, Filament, Reason string
+    // The status stream the script follows, and the seconds between
+    // reloads without it; both unset once the job is over
+    StreamURL string
+    Refresh   int
+}
+
+// GET /jobs/:id/page is the job's status as a small HTML page, for links
+// sent to customers. Anyone who may read GET /jobs/:id may read it. An
+// unfinished job's page follows the status stream, or reloads itself
+// every jobPageRefresh seconds without JavaScript; a finished quote prints
+// without the page's controls.
+func handleJobPage(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+    pipe := rdb.Pipeline()
+    read := queueStatusRead(ctx, pipe, jobID)
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        c.Data(http.StatusInternalServerError, "text/plain; charset=utf-8", []byte("Something went wrong; try again shortly.\n"))
+        return
+    }
+    st, ok := read.state()
+    if !ok {
+        renderJobPage(c, http.StatusNotFound, jobPageData{JobID: jobID, NotFound: true})
+        return
+    }
+
+    d := jobPageData{
+        JobID:     jobID,
+        Status:    string(st.status),
+        Label:     jobPageLabels[st.status],
+        Note:      st.note,
+        CreatedAt: st.createdAt,
+        Terminal:  st.status.IsTerminal(),
+        Finished:  st.finished(),
+    }
+    if d.Label == "" {
+        d.Label = d.Status
+    }
+    if st.hasProgress {
+        d.Step, d.Percent = strings.ReplaceAll(st.p.Stage, "_", " "), st.p.Percent
+    }
+    if d.Finished {
+        if r, ok := exposedResult(jobID, st.result); ok {
+            if r.Price != nil {
+                d.Price = fmt.Sprintf("%.2f %s", *r.Price, r.Currency)
+            }
+            if r.PrintTimeSeconds != nil {
+                d.PrintTime = formatPrintTime(*r.PrintTimeSeconds)
+            }
+            if r.Filament != nil && r.Filament.Grams != nil {
+                d.Filament = strconv.FormatFloat(round2(*r.Filament.Grams), 'f', -1, 64) + " g"
+            }
+            d.Reason = r.ErrorDescription
+        }
+    }
+    if d.Terminal {
+        c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(statusMaxAge.Seconds())))
+    } else {
+        c.Header("Cache-Control", "no-store")
+        // The stream at the same version as the page: /v1/status/:id/stream
+        // beside /v1/jobs/:id/page
+        d.StreamURL = strings.TrimSuffix(c.Request.URL.Path, "/jobs/"+jobID+"/page") + "/status/" + jobID + "/stream"
+        d.Refresh = jobPageRefresh
+    }
+    renderJobPage(c, http.StatusOK, d)
+}
+
+func renderJobPage(c *gin.Context, status int, d jobPageData) {
+    c.Header("Content-Type", "text/html; charset=utf-8")
+    c.Status(status)
+    jobPageTemplate.Execute(c.Writer, d)
+}
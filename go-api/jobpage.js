@@ -0,0 +1,32 @@
+// Follows the job on GET /jobs/:id/page through its status stream. Progress
+// is updated in place; a new status reloads the page, which the server
+// renders in full, so this never needs to know how a quote is laid out.
+const stream = document.body.dataset.stream;
+const rendered = document.body.dataset.status;
+
+const printButton = document.getElementById('print');
+if (printButton) {
+    printButton.hidden = false;
+    printButton.addEventListener('click', () => window.print());
+}
+
+if (stream) {
+    const source = new EventSource(stream);
+    source.addEventListener('status', (ev) => {
+        const snap = JSON.parse(ev.data);
+        if (snap.status !== rendered) {
+            source.close();
+            location.reload();
+            return;
+        }
+        const progress = document.getElementById('progress');
+        const step = document.getElementById('step');
+        if (progress && snap.progress_percent !== undefined) {
+            progress.value = snap.progress_percent;
+        }
+        if (step && snap.current_step) {
+            step.textContent = snap.current_step.replace('_', ' ') + ' · ' + snap.progress_percent + '%';
+        }
+    });
+    source.addEventListener('end', () => source.close());
+}
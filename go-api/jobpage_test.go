@@ -0,0 +1,86 @@
+package main
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestJobPageCompleted(t *testing.T) {
+    setupTest(t)
+    rdb.Set(ctx, "status:j1", "completed", 0)
+    rdb.Set(ctx, "result:j1", `{"price":12.5,"currency":"EUR","print_time_seconds":3900,"filament_grams":40.25}`, 0)
+
+    w := do(newRouter(), http.MethodGet, "/v1/jobs/j1/page", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200", w.Code)
+    }
+    if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+        t.Errorf("Content-Type = %q, want HTML", ct)
+    }
+    if cc := w.Header().Get("Cache-Control"); cc != "private, max-age=60" {
+        t.Errorf("Cache-Control = %q, want private, max-age=60", cc)
+    }
+    body := w.Body.String()
+    for _, want := range []string{"Your quote is ready", "12.50 EUR", "1h 05m", "40.25 g", `id="print"`, "@media print"} {
+        if !strings.Contains(body, want) {
+            t.Errorf("page lacks %q", want)
+        }
+    }
+    // Nothing left to follow
+    for _, unwanted := range []string{"data-stream", "http-equiv=\"refresh\"", "<progress"} {
+        if strings.Contains(body, unwanted) {
+            t.Errorf("finished page has %q", unwanted)
+        }
+    }
+}
+
+func TestJobPageProcessing(t *testing.T) {
+    setupTest(t)
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    rdb.Set(ctx, progressKey("j1"), `{"stage":"post_processing","percent":90}`, 0)
+    rdb.Set(ctx, "note:j1", `<script>alert(1)</script>`, 0)
+    r := newRouter()
+
+    w := do(r, http.MethodGet, "/v1/jobs/j1/page", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200", w.Code)
+    }
+    if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+        t.Errorf("Cache-Control = %q, want no-store", cc)
+    }
+    body := w.Body.String()
+    for _, want := range []string{
+        `data-stream="/v1/status/j1/stream"`,
+        `<noscript><meta http-equiv="refresh" content="10"></noscript>`,
+        `value="90"`,
+        "post processing · 90%",
+        "&lt;script&gt;alert(1)&lt;/script&gt;",
+    } {
+        if !strings.Contains(body, want) {
+            t.Errorf("page lacks %q", want)
+        }
+    }
+    if strings.Contains(body, "<script>alert") {
+        t.Error("the note isn't escaped")
+    }
+
+    // The bare path follows the bare stream
+    w = do(r, http.MethodGet, "/jobs/j1/page", "")
+    if !strings.Contains(w.Body.String(), `data-stream="/status/j1/stream"`) {
+        t.Errorf("bare page doesn't follow /status/j1/stream")
+    }
+}
+
+func TestJobPageNotFound(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    w := do(r, http.MethodGet, "/v1/jobs/missing/page", "")
+    if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Quote not found") {
+        t.Errorf("status = %d, body %s; want a 404 page", w.Code, w.Body)
+    }
+    w = do(r, http.MethodGet, "/jobpage.js", "")
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "EventSource") {
+        t.Errorf("/jobpage.js: status = %d", w.Code)
+    }
+}
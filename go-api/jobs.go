@@ -0,0 +1,447 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+
+    "slicer-api/internal/api"
+)
+
+// QuotationRequest is the body of POST /quote.
+type QuotationRequest = api.QuotationRequest
+
+// storageUploadURL is where TmpfilesStorage stores files.
+var storageUploadURL = "https://tmpfiles.org/api/v1/upload"
+
+// uploadFormSlack is what the rest of an /upload form may add to
+// MAX_UPLOAD_BYTES before the body is cut off.
+const uploadFormSlack = 1 << 20
+
+// Endpoint 1: Submit Job
+//
+//	@Summary	Submit a job for a model at a URL
+//	@Tags		jobs
+//	@Accept		json
+//	@Produce	json
+//	@Param		request			body		api.QuotationRequest	true	"Model URL and print settings"
+//	@Param		Idempotency-Key	header		string				false	"Replays the first response for retries"
+//	@Success	202				{object}	api.SubmitJobResponse
+//	@Success	200				{object}	api.SubmitJobResponse	"Duplicate submission or cache hit"
+//	@Failure	400				{object}	api.ErrorResponse
+//	@Failure	429				{object}	api.ErrorResponse
+//	@Failure	503				{object}	api.ErrorResponse
+//	@Router		/quote [post]
+func handleQuote(c *gin.Context) {
+    ctx := c.Request.Context()
+
+    var req QuotationRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+
+    if req.Nozzle == 0 {
+        req.Nozzle = defaultNozzle
+    }
+    if req.BedAdhesion == "" {
+        req.BedAdhesion = defaultBedAdhesion
+    }
+    if err := checkPrintSettings(req.Nozzle, req.BedAdhesion); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if !validRegion(req.Region) {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "region must be one of " + strings.Join(regions, ", ")})
+        return
+    }
+
+    if req.NotifyEmail != "" {
+        if err := validNotifyEmail(req.NotifyEmail); err != nil {
+            c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+            return
+        }
+    }
+    if req.CallbackURL != "" {
+        if err := validCallback(req.CallbackURL, req.CallbackSecret); err != nil {
+            c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+            return
+        }
+    }
+    region := routedRegion(req.Region, requestOwner(c))
+    jobFeats := jobFeatures(requestOwner(c))
+
+    jobID := uuid.New().String()
+    fingerprint := sliceCacheKey(featureScope(callerScope(c), jobFeats), "url:"+req.DownloadURL, req.Material, req.LayerHeight, req.Infill, req.Nozzle, req.BedAdhesion, req.Rush)
+    dupKey, dup := claimSubmission(c, duplicateKey(fingerprint, clampMaxRetries(req.MaxRetries), req.SubmitAt), jobID)
+    if dup {
+        return
+    }
+    defer releaseSubmission(c, dupKey, jobID)
+
+    var cacheKey string
+    if sliceCacheEnabled() {
+        cacheKey = fingerprint
+        if res, ok := cachedSliceResult(ctx, cacheKey); ok && !req.NoCache {
+            serveCachedJob(c, jobSpec{
+                ID:             jobID,
+                DownloadURL:    req.DownloadURL,
+                Material:       req.Material,
+                LayerHeight:    req.LayerHeight,
+                Infill:         req.Infill,
+                Rush:           req.Rush,
+                Nozzle:         req.Nozzle,
+                BedAdhesion:    req.BedAdhesion,
+                Region:         region,
+                MaxRetries:     clampMaxRetries(req.MaxRetries),
+                Deadline:       jobDeadline(0),
+                OwnerID:        requestOwner(c),
+                CacheKey:       cacheKey,
+                Features:       jobFeats,
+                CallbackURL:    req.CallbackURL,
+                CallbackSecret: req.CallbackSecret,
+                NotifyEmail:    req.NotifyEmail,
+            }, res)
+            return
+        }
+    }
+
+    queue, ok := routeJob(ctx, req.Material, region, req.Nozzle, req.Rush)
+    if !ok {
+        noCapableWorker(c)
+        return
+    }
+
+    scheduled := req.SubmitAt != nil && req.SubmitAt.After(time.Now())
+    if scheduled && req.SubmitAt.After(time.Now().Add(cfg().ScheduleHorizon())) {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "submit_at must be at most " + strconv.Itoa(cfg().ScheduleHorizonHours) + " hours ahead"})
+        return
+    }
+
+    // Backpressure is about the queue right now, which a scheduled job isn't in yet
+    var busy api.QueueWarning
+    if !scheduled {
+        if busy, ok = checkBackpressure(c); !ok {
+            return
+        }
+    }
+    charge, ok := chargeQuota(c, 0)
+    if !ok {
+        return
+    }
+    defer refundQuota(c, charge)
+
+    // Payload for the Python Worker
+    spec := jobSpec{
+        ID:          jobID,
+        DownloadURL: req.DownloadURL,
+        Material:    req.Material,
+        LayerHeight: req.LayerHeight,
+        Infill:      req.Infill,
+        Rush:        req.Rush,
+        Nozzle:      req.Nozzle,
+        BedAdhesion: req.BedAdhesion,
+        Queue:       queue,
+        Region:      region,
+        MaxRetries:  clampMaxRetries(req.MaxRetries),
+        Deadline:    jobDeadline(0),
+        OwnerID:     requestOwner(c),
+        CacheKey:    cacheKey,
+        Features:    jobFeats,
+        CallbackURL: req.CallbackURL,
+    }
+    if scheduled {
+        spec.SubmitAt = req.SubmitAt
+    }
+    jobData := newJobPayload(spec)
+    jsonData := marshalPayload(jobData)
+
+    if scheduled {
+        if err := scheduleJob(ctx, jobID, jsonData, *req.SubmitAt); err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to schedule job"})
+            return
+        }
+        registerCallback(ctx, jobID, req.CallbackURL, req.CallbackSecret)
+        recordCreated(ctx, jobID, jobData)
+        publishStatus(ctx, jobID, "scheduled", "for "+req.SubmitAt.UTC().Format(time.RFC3339))
+        registerNotifyEmail(ctx, jobID, req.NotifyEmail)
+        submitted := auditEventFor(c, auditJobSubmitted, jobID, requestOwner(c))
+        submitted.After = "scheduled"
+        audit.Record(ctx, submitted)
+        countSubmission(ctx)
+        fireWebhooks(requestOwner(c), "job.submitted", jobID, jobData)
+        online := workerOnline(ctx)
+        submitAt, _ := jobData["submit_at"].(string)
+        c.JSON(http.StatusAccepted, api.SubmitJobResponse{
+            JobID:        jobID,
+            AccessToken:  accessToken(c, jobID),
+            Message:      "Job scheduled. Poll " + statusPath(c, jobID) + " for results.",
+            SubmitAt:     submitAt,
+            WorkerOnline: &online,
+            ExpiresAt:    jobExpiry(time.Until(*req.SubmitAt) + 24*time.Hour),
+        })
+        return
+    }
+
+    // Set initial status first, so a worker that picks the job up at once
+    // doesn't have its report overwritten
+    if _, err := setStatus(ctx, jobID, StatusQueued, 24*time.Hour); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to queue job"})
+        return
+    }
+    // Push to "print_jobs" (or "print_jobs:rush" for rush orders)
+    if err := submitJob(ctx, queue, jobID, requestOwner(c), jsonData); err != nil {
+        rdb.Del(ctx, "status:"+jobID)
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to queue job"})
+        return
+    }
+    registerCallback(ctx, jobID, req.CallbackURL, req.CallbackSecret)
+    registerNotifyEmail(ctx, jobID, req.NotifyEmail)
+    recordCreated(ctx, jobID, jobData)
+    publishStatus(ctx, jobID, "queued", "")
+    submitted := auditEventFor(c, auditJobSubmitted, jobID, requestOwner(c))
+    submitted.After = "queued"
+    audit.Record(ctx, submitted)
+    countSubmission(ctx)
+    fireWebhooks(requestOwner(c), "job.submitted", jobID, jobData)
+
+    // Return the Ticket ID immediately
+    online := workerOnline(ctx)
+    response := api.SubmitJobResponse{
+        JobID:        jobID,
+        AccessToken:  accessToken(c, jobID),
+        Message:      "Job queued successfully. Poll " + statusPath(c, jobID) + " for results.",
+        QueueDepths:  queueDepths(ctx),
+        WorkerOnline: &online,
+        ExpiresAt:    jobExpiry(24 * time.Hour),
+        QueueWarning: busy,
+    }
+    if position, err := queuePosition(ctx, jobID); err == nil && position >= 0 {
+        response.QueuePosition = &position
+    }
+    c.JSON(http.StatusAccepted, response)
+}
+
+// Endpoint 4: Queue stats
+func handleQueue(c *gin.Context) {
+    ctx := c.Request.Context()
+    stats, err := cachedQueueStats(ctx)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to read queue stats"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "single_queue":           singleQueue(),
+        "queue_depths":           queueDepths(ctx),
+        "fair_scheduling":        cfg().FairScheduling,
+        "submitter_depths":       submitterDepths(ctx),
+        "status_counts":          stats.StatusCounts,
+        "oldest_queued_seconds":  stats.OldestQueuedSeconds,
+        "avg_completion_seconds": stats.AvgCompletionSeconds,
+        "stats_generated_at":     stats.GeneratedAt,
+    })
+}
+
+// Endpoint 5: Handle file uploads
+//
+//	@Summary	Upload a model and submit a job for it
+//	@Tags		jobs
+//	@Accept		multipart/form-data
+//	@Produce	json
+//	@Param		file		formData	file	true	"STL, 3MF, OBJ or STEP model"
+//	@Param		material	formData	string	false	"Defaults to PLA"
+//	@Param		infill		formData	int		false	"Percent, defaults to 15"
+//	@Param		nozzle		formData	number	false	"Nozzle diameter in mm: 0.25, 0.4, 0.6 or 0.8, defaults to 0.4"
+//	@Param		bed_adhesion	formData	string	false	"none, brim, raft or skirt, defaults to brim"
+//	@Param		notify_email	formData	string	false	"Emailed the price once the job finishes"
+//	@Success	202			{object}	api.UploadResponse
+//	@Success	200			{object}	api.SubmitJobResponse	"Duplicate submission or cache hit"
+//	@Failure	400			{object}	api.ErrorResponse
+//	@Failure	413			{object}	api.ErrorResponse
+//	@Failure	502			{object}	api.ErrorResponse
+//	@Router		/upload [post]
+func handleUpload(c *gin.Context) {
+    ctx := c.Request.Context()
+
+    maxBytes := cfg().MaxUploadBytes
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+uploadFormSlack)
+    fileHeader, err := c.FormFile("file")
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) || (err == nil && fileHeader.Size > maxBytes) {
+        c.JSON(http.StatusRequestEntityTooLarge, api.ErrorResponse{Error: fmt.Sprintf("File exceeds %d bytes", maxBytes)})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "No file uploaded"})
+        return
+    }
+
+    material := c.DefaultPostForm("material", "PLA")
+    nozzle, err := strconv.ParseFloat(c.DefaultPostForm("nozzle", "0.4"), 64)
+    if err != nil || nozzle <= 0 {
+        nozzle = defaultNozzle
+    }
+    bedAdhesion := c.DefaultPostForm("bed_adhesion", defaultBedAdhesion)
+    if err := checkPrintSettings(nozzle, bedAdhesion); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    notifyEmail := c.PostForm("notify_email")
+    if notifyEmail != "" {
+        if err := validNotifyEmail(notifyEmail); err != nil {
+            c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+            return
+        }
+    }
+    infillStr := c.DefaultPostForm("infill", "15")
+    layerHeight, err := strconv.ParseFloat(c.DefaultPostForm("layer_height", "0.2"), 64)
+    if err != nil || layerHeight <= 0 {
+        layerHeight = defaultLayerHeight
+    }
+    rush, _ := strconv.ParseBool(c.DefaultPostForm("rush", "false"))
+    var maxRetries *int
+    if n, err := strconv.Atoi(c.PostForm("max_retries")); err == nil {
+        maxRetries = &n
+    }
+    noCache, _ := strconv.ParseBool(c.DefaultPostForm("no_cache", "false"))
+    region := c.PostForm("region")
+    if !validRegion(region) {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "region must be one of " + strings.Join(regions, ", ")})
+        return
+    }
+    region = routedRegion(region, requestOwner(c))
+
+    // Parse infill to int
+    infill, err := strconv.Atoi(infillStr)
+    if err != nil {
+        infill = defaultInfill // Fallback default
+    }
+
+    jobID := uuid.New().String()
+    spec := jobSpec{
+        ID:          jobID,
+        Material:    material,
+        LayerHeight: layerHeight,
+        Infill:      infill,
+        Rush:        rush,
+        Nozzle:      nozzle,
+        BedAdhesion: bedAdhesion,
+        Region:      region,
+        MaxRetries:  clampMaxRetries(maxRetries),
+        Deadline:    jobDeadline(fileHeader.Size),
+        OwnerID:     requestOwner(c),
+        Features:    jobFeatures(requestOwner(c)),
+        NotifyEmail: notifyEmail,
+    }
+    if sliceCacheEnabled() || duplicateDetection() {
+        sum, err := fileSHA256(fileHeader)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to open file"})
+            return
+        }
+        fingerprint := sliceCacheKey(featureScope(callerScope(c), spec.Features), "sha256:"+sum, material, layerHeight, infill, nozzle, bedAdhesion, rush)
+        dupKey, dup := claimSubmission(c, duplicateKey(fingerprint, spec.MaxRetries, nil), jobID)
+        if dup {
+            return
+        }
+        defer releaseSubmission(c, dupKey, jobID)
+        if sliceCacheEnabled() {
+            spec.CacheKey = fingerprint
+        }
+    }
+    if spec.CacheKey != "" {
+        if res, ok := cachedSliceResult(ctx, spec.CacheKey); ok && !noCache {
+            serveCachedJob(c, spec, res)
+            return
+        }
+    }
+
+    // Check before proxying the file so a full queue doesn't cost bandwidth
+    busy, ok := checkBackpressure(c)
+    if !ok {
+        return
+    }
+    queue, ok := routeJob(ctx, material, region, nozzle, rush)
+    if !ok {
+        noCapableWorker(c)
+        return
+    }
+    charge, ok := chargeQuota(c, fileHeader.Size)
+    if !ok {
+        return
+    }
+    defer refundQuota(c, charge)
+
+    file, err := fileHeader.Open()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to open file"})
+        return
+    }
+    defer file.Close()
+
+    store := activeStorage()
+    name := storageName(jobID, fileHeader.Filename)
+    uploadStart := time.Now()
+    downloadURL, err := store.Save(ctx, name, file)
+    storageUploadDuration.WithLabelValues(store.Name()).Observe(time.Since(uploadStart).Seconds())
+    if errors.Is(err, errStorageRejected) {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Storage rejected file"})
+        return
+    } else if err != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Storage upload failed: " + err.Error()})
+        return
+    }
+
+    // 3. Queue Job
+    spec.DownloadURL = downloadURL
+    spec.StorageName = name
+    spec.Queue = queue
+    jobData := newJobPayload(spec)
+    jsonData := marshalPayload(jobData)
+    if _, err := setStatus(ctx, jobID, StatusQueued, 24*time.Hour); err != nil {
+        store.Delete(ctx, name)
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to queue job"})
+        return
+    }
+    if err := submitJob(ctx, queue, jobID, requestOwner(c), jsonData); err != nil {
+        rdb.Del(ctx, "status:"+jobID)
+        store.Delete(ctx, name)
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to queue job"})
+        return
+    }
+    registerNotifyEmail(ctx, jobID, notifyEmail)
+    recordCreated(ctx, jobID, jobData)
+    publishStatus(ctx, jobID, "queued", "")
+    submitted := auditEventFor(c, auditJobSubmitted, jobID, requestOwner(c))
+    submitted.After = "queued"
+    audit.Record(ctx, submitted)
+    countSubmission(ctx)
+    fireWebhooks(requestOwner(c), "job.submitted", jobID, jobData)
+
+    online := workerOnline(ctx)
+    c.JSON(http.StatusAccepted, api.UploadResponse{
+        JobID:       jobID,
+        AccessToken: accessToken(c, jobID),
+        Message:     "File uploaded",
+        ModelInfo: api.ModelInfo{
+            Filename:  filepath.Base(fileHeader.Filename),
+            SizeBytes: fileHeader.Size,
+            Format:    strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), "."),
+        },
+        WorkerOnline: &online,
+        ExpiresAt:    jobExpiry(24 * time.Hour),
+        QueueWarning: busy,
+    })
+}
+
+// jobExpiry is when the keys of a job written now with ttl expire.
+func jobExpiry(ttl time.Duration) string {
+    return time.Now().Add(ttl).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "log"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// JobStatus is what status:{id} holds. Workers and older replicas write the
+// key too, so parseJobStatus reads it rather than comparing raw strings.
+type JobStatus string
+
+const (
+    StatusQueued     JobStatus = "queued"
+    StatusScheduled  JobStatus = "scheduled"
+    StatusProcessing JobStatus = "processing"
+    // StatusCancelling is a forced cancel waiting for the worker to stop
+    StatusCancelling   JobStatus = "cancelling"
+    StatusCompleted    JobStatus = "completed"
+    StatusFailed       JobStatus = "failed"
+    StatusCancelled    JobStatus = "cancelled"
+    StatusAborted      JobStatus = "aborted"
+    StatusDeadLettered JobStatus = "dead_lettered"
+    // StatusUnknown stands for anything else found in Redis
+    StatusUnknown JobStatus = "unknown"
+)
+
+// jobStatuses is every status but StatusUnknown.
+var jobStatuses = []JobStatus{
+    StatusQueued, StatusScheduled, StatusProcessing, StatusCancelling, StatusCompleted,
+    StatusFailed, StatusCancelled, StatusAborted, StatusDeadLettered,
+}
+
+// statusTransitions lists the statuses each status may move to. New jobs
+// start queued, scheduled, or completed from the slice cache; those writes
+// aren't transitions. Staying put is always allowed.
+var statusTransitions = map[JobStatus][]JobStatus{
+    StatusScheduled: {StatusQueued, StatusCancelled},
+    // Workers may report their result without claiming the job first
+    StatusQueued: {StatusProcessing, StatusCompleted, StatusFailed, StatusCancelled},
+    // Back to queued when the worker goes away and the job is retried
+    StatusProcessing: {StatusCompleted, StatusFailed, StatusAborted, StatusCancelling, StatusCancelled, StatusQueued, StatusDeadLettered},
+    StatusCancelling: {StatusCancelled, StatusCompleted, StatusFailed},
+    // Transient failures are retried until max_retries runs out
+    StatusFailed: {StatusQueued, StatusDeadLettered},
+    // Requeued by an admin
+    StatusDeadLettered: {StatusQueued},
+}
+
+// parseJobStatus reads a stored status, mapping anything outside the set to
+// StatusUnknown.
+func parseJobStatus(s string) JobStatus {
+    for _, status := range jobStatuses {
+        if string(status) == s {
+            return status
+        }
+    }
+    return StatusUnknown
+}
+
+// IsTerminal reports whether the job's run is over: nothing changes it
+// short of a retry or an admin requeue.
+func (s JobStatus) IsTerminal() bool {
+    switch s {
+    case StatusCompleted, StatusFailed, StatusCancelled, StatusAborted, StatusDeadLettered:
+        return true
+    }
+    return false
+}
+
+// CanTransition reports whether the table lets s move to next.
+func (s JobStatus) CanTransition(next JobStatus) bool {
+    if s == next {
+        return true
+    }
+    for _, to := range statusTransitions[s] {
+        if to == next {
+            return true
+        }
+    }
+    return false
+}
+
+// statusesBefore are the statuses the table lets move to next, next itself
+// included.
+func statusesBefore(next JobStatus) []interface{} {
+    var before []interface{}
+    for _, from := range jobStatuses {
+        if from.CanTransition(next) {
+            before = append(before, string(from))
+        }
+    }
+    return before
+}
+
+var errInvalidTransition = errors.New("invalid status transition")
+
+// casTransition sets KEYS[1] to ARGV[1] when it holds one of ARGV[3:], or
+// has expired, returning whether it did and what it held.
+var casTransition = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1]) or ''
+local ok = cur == ''
+for i = 3, #ARGV do
+    if ARGV[i] == cur then
+        ok = true
+    end
+end
+if ok then
+    redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+end
+return {ok and 1 or 0, cur}
+`)
+
+// setStatus moves jobID to status if the transition table allows it from
+// the current one, and returns that status. A job whose status expired
+// takes any. Refusals are logged and leave the job as it was.
+func setStatus(ctx context.Context, jobID string, status JobStatus, ttl time.Duration) (JobStatus, error) {
+    args := append([]interface{}{string(status), int(ttl.Seconds())}, statusesBefore(status)...)
+    res, err := casTransition.Run(ctx, rdb, []string{"status:" + jobID}, args...).Slice()
+    if err != nil {
+        return "", err
+    }
+    raw, _ := res[1].(string)
+    before := parseJobStatus(raw)
+    if raw == "" {
+        before = ""
+    }
+    if ok, _ := res[0].(int64); ok == 0 {
+        logInvalidTransition(jobID, raw, status)
+        return before, errInvalidTransition
+    }
+    return before, nil
+}
+
+func logInvalidTransition(jobID, from string, to JobStatus) {
+    log.Printf("WARN status of %s left at %s: moving to %s is not a valid transition", jobID, from, to)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestParseJobStatus(t *testing.T) {
+    tests := []struct {
+        raw      string
+        want     JobStatus
+        terminal bool
+    }{
+        {"queued", StatusQueued, false},
+        {"cancelling", StatusCancelling, false},
+        {"completed", StatusCompleted, true},
+        {"dead_lettered", StatusDeadLettered, true},
+        {"aborted", StatusAborted, true},
+        {"complete", StatusUnknown, false},
+        {"", StatusUnknown, false},
+    }
+    for _, tt := range tests {
+        got := parseJobStatus(tt.raw)
+        if got != tt.want {
+            t.Errorf("parseJobStatus(%q) = %q, want %q", tt.raw, got, tt.want)
+        }
+        if got.IsTerminal() != tt.terminal {
+            t.Errorf("%q.IsTerminal() = %v, want %v", got, got.IsTerminal(), tt.terminal)
+        }
+    }
+}
+
+func TestCanTransition(t *testing.T) {
+    tests := []struct {
+        from, to JobStatus
+        want     bool
+    }{
+        {StatusQueued, StatusProcessing, true},
+        {StatusProcessing, StatusCompleted, true},
+        {StatusProcessing, StatusQueued, true},
+        {StatusFailed, StatusQueued, true},
+        {StatusDeadLettered, StatusQueued, true},
+        {StatusCompleted, StatusCompleted, true},
+        {StatusCompleted, StatusQueued, false},
+        {StatusCompleted, StatusProcessing, false},
+        {StatusCancelled, StatusQueued, false},
+        {StatusScheduled, StatusProcessing, false},
+        {StatusUnknown, StatusQueued, false},
+    }
+    for _, tt := range tests {
+        if got := tt.from.CanTransition(tt.to); got != tt.want {
+            t.Errorf("%s -> %s allowed = %v, want %v", tt.from, tt.to, got, tt.want)
+        }
+    }
+}
+
+func TestSetStatusEnforcesTransitions(t *testing.T) {
+    setupTest(t)
+    rdb.Set(ctx, "status:j1", "completed", 0)
+
+    before, err := setStatus(ctx, "j1", StatusQueued, time.Hour)
+    if err != errInvalidTransition || before != StatusCompleted {
+        t.Fatalf("completed -> queued = %q, %v, want it refused", before, err)
+    }
+    if got := rdb.Get(ctx, "status:j1").Val(); got != "completed" {
+        t.Errorf("status = %q after a refused move, want completed", got)
+    }
+
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    if _, err := setStatus(ctx, "j1", StatusFailed, time.Hour); err != nil {
+        t.Fatalf("processing -> failed: %v", err)
+    }
+    if got := rdb.Get(ctx, "status:j1").Val(); got != "failed" {
+        t.Errorf("status = %q, want failed", got)
+    }
+
+    // Nothing to check an expired status against
+    if before, err := setStatus(ctx, "gone", StatusQueued, time.Hour); err != nil || before != "" {
+        t.Errorf("expired -> queued = %q, %v, want it allowed", before, err)
+    }
+}
+
+// claimingQueue is a worker that claims each job the moment it is published.
+type claimingQueue struct {
+    RedisQueue
+}
+
+func (q claimingQueue) Publish(ctx context.Context, subject string, data []byte) error {
+    if err := q.RedisQueue.Publish(ctx, subject, data); err != nil {
+        return err
+    }
+    job, _ := readPayload(data)
+    jobID, _ := job["id"].(string)
+    _, err := setStatus(ctx, jobID, StatusProcessing, 24*time.Hour)
+    return err
+}
+
+func TestQueuedStatusWrittenBeforePublishing(t *testing.T) {
+    setupTest(t, func(c *Config) { c.FairScheduling = false })
+    jobQueue = claimingQueue{}
+    t.Cleanup(func() { jobQueue = RedisQueue{} })
+
+    code, jobID, _ := quoteJobID(t, newRouter(), `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`)
+    if code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202", code)
+    }
+    if s := rdb.Get(ctx, "status:"+jobID).Val(); s != "processing" {
+        t.Errorf("status = %q, want the worker's processing kept", s)
+    }
+}
+
+func TestRetryLeavesFinishedJobs(t *testing.T) {
+    setupTest(t)
+    rdb.Set(ctx, "status:j1", "completed", 0)
+
+    if err := scheduleRetry(map[string]interface{}{"id": "j1"}, "worker timeout"); err != nil {
+        t.Fatal(err)
+    }
+    if got := rdb.Get(ctx, "status:j1").Val(); got != "completed" {
+        t.Errorf("status = %q, want completed", got)
+    }
+    if n := rdb.ZCard(ctx, delayedQueue).Val(); n != 0 {
+        t.Errorf("delayed queue holds %d jobs, want the finished one left out", n)
+    }
+}
+
+func TestWorkerCannotReopenFinishedJob(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "completed", 0)
+
+    if code := reportStatus(t, r, "j1", `{"status":"processing"}`); code != http.StatusConflict {
+        t.Errorf("late claim: status = %d, want 409", code)
+    }
+    if got := rdb.Get(ctx, "status:j1").Val(); got != "completed" {
+        t.Errorf("status = %q, want completed", got)
+    }
+
+    rdb.Set(ctx, "status:j2", "queued", 0)
+    if code := reportStatus(t, r, "j2", `{"status":"processing"}`); code != http.StatusOK {
+        t.Errorf("claim: status = %d, want 200", code)
+    }
+}
+
+func TestUnknownStatusShownAsUnknown(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "complete", 0)
+    rdb.Set(ctx, "result:j1", `{"price":3}`, 0)
+
+    w := do(r, http.MethodGet, "/status/j1", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200", w.Code)
+    }
+    var resp struct {
+        Status string          `json:"status"`
+        Data   json.RawMessage `json:"data"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if resp.Status != "unknown" || resp.Data != nil {
+        t.Errorf("body = %s, want status unknown and no result", w.Body)
+    }
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Every submission gets an access token, returned once in the 202. Only its
+// hash is kept, in access_token:{id}, for as long as the job's other keys.
+// Callers without an owner identity prove a job is theirs with it.
+const jobTokenHeader = "X-Job-Token"
+
+func accessTokenKey(jobID string) string {
+    return "access_token:" + jobID
+}
+
+func hashJobToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// issueAccessToken creates and stores jobID's access token.
+func issueAccessToken(ctx context.Context, jobID string) (string, error) {
+    b := make([]byte, 24)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    token := hex.EncodeToString(b)
+    if err := rdb.Set(ctx, accessTokenKey(jobID), hashJobToken(token), 24*time.Hour).Err(); err != nil {
+        return "", err
+    }
+    return token, nil
+}
+
+// accessToken issues jobID's token for a 202, empty if it couldn't be
+// stored; the job is queued by then and shouldn't fail over it.
+func accessToken(c *gin.Context, jobID string) string {
+    token, err := issueAccessToken(c.Request.Context(), jobID)
+    if err != nil {
+        return ""
+    }
+    return token
+}
+
+// authorizeJob lets the caller act on jobID if they own it or, for jobs
+// without an owner, present its access token in X-Job-Token. Anonymous jobs
+// submitted before tokens existed have none to check. On refusal it has
+// already responded.
+func authorizeJob(c *gin.Context, jobID string) bool {
+    ctx := c.Request.Context()
+    if owner := jobOwner(ctx, jobID); owner != "" {
+        if owner != requestOwner(c) {
+            c.JSON(http.StatusForbidden, api.ErrorResponse{Error: "Not your job"})
+            return false
+        }
+        return true
+    }
+    want, err := rdb.Get(ctx, accessTokenKey(jobID)).Result()
+    if err == redis.Nil {
+        return true
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return false
+    }
+    given := c.GetHeader(jobTokenHeader)
+    if given == "" || !hmac.Equal([]byte(hashJobToken(given)), []byte(want)) {
+        c.JSON(http.StatusForbidden, api.ErrorResponse{Error: "Missing or invalid " + jobTokenHeader})
+        return false
+    }
+    return true
+}
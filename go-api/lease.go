@@ -0,0 +1,127 @@
+package main
+
+import (
+    "log"
+    "net/http"
+    "os"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "github.com/google/uuid"
+
+    "slicer-api/internal/api"
+)
+
+// replicaID names this process in lease:{name} keys. The hostname is for
+// whoever reads /admin/locks; the suffix keeps two replicas on one host
+// apart.
+var replicaID = func() string {
+    host, _ := os.Hostname()
+    if host == "" {
+        host = "api"
+    }
+    return host + "-" + uuid.NewString()[:8]
+}()
+
+// renewLease extends a lease only while we still hold it, so a replica that
+// stalled past its TTL can't extend one another replica has since taken.
+var renewLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// leaseNames are the leases this binary takes, for /admin/locks.
+var leaseNames = []string{}
+
+func leaseKey(name string) string {
+    return "lease:" + name
+}
+
+// registerLease records name for /admin/locks. Call it at startup.
+func registerLease(name string) {
+    for _, n := range leaseNames {
+        if n == name {
+            return
+        }
+    }
+    leaseNames = append(leaseNames, name)
+}
+
+// holdLease takes the lease for name, or renews it if we already hold it.
+// A holder that dies stops renewing, and another replica takes over once
+// ttl runs out.
+func holdLease(name string, ttl time.Duration) bool {
+    ok, err := rdb.SetNX(ctx, leaseKey(name), replicaID, ttl).Result()
+    if err != nil {
+        log.Printf("lease %s: %v", name, err)
+        return false
+    }
+    if ok {
+        return true
+    }
+    renewed, err := renewLease.Run(ctx, rdb, []string{leaseKey(name)}, replicaID, ttl.Milliseconds()).Int()
+    return err == nil && renewed == 1
+}
+
+// runLeased runs task if this replica holds the lease for name, renewing it
+// every ttl/3 while task runs so a slow tick doesn't hand the lease to
+// another replica halfway through.
+func runLeased(name string, ttl time.Duration, task func()) {
+    if !holdLease(name, ttl) {
+        return
+    }
+    done := make(chan struct{})
+    go func() {
+        t := time.NewTicker(ttl / 3)
+        defer t.Stop()
+        for {
+            select {
+            case <-done:
+                return
+            case <-t.C:
+                renewLease.Run(ctx, rdb, []string{leaseKey(name)}, replicaID, ttl.Milliseconds())
+            }
+        }
+    }()
+    defer close(done)
+    task()
+}
+
+// leaseTTL is how long a lease outlives a missed tick: three intervals, so a
+// holder that dies is replaced within about that long.
+func leaseTTL(interval time.Duration) time.Duration {
+    return 3 * interval
+}
+
+type leaseInfo struct {
+    Name      string `json:"name"`
+    Holder    string `json:"holder,omitempty"`
+    ExpiresIn int64  `json:"expires_in_ms,omitempty"`
+    Mine      bool   `json:"mine"`
+}
+
+// GET /admin/locks lists which replica holds each maintenance lease.
+func handleListLocks(c *gin.Context) {
+    reqCtx := c.Request.Context()
+    locks := make([]leaseInfo, 0, len(leaseNames))
+    for _, name := range leaseNames {
+        info := leaseInfo{Name: name}
+        holder, err := rdb.Get(reqCtx, leaseKey(name)).Result()
+        if err != nil && err != redis.Nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+        if holder != "" {
+            info.Holder = holder
+            info.Mine = holder == replicaID
+            if ttl, err := rdb.PTTL(reqCtx, leaseKey(name)).Result(); err == nil && ttl > 0 {
+                info.ExpiresIn = ttl.Milliseconds()
+            }
+        }
+        locks = append(locks, info)
+    }
+    c.JSON(http.StatusOK, gin.H{"replica": replicaID, "locks": locks})
+}
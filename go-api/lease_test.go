@@ -0,0 +1,82 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+)
+
+// asReplica runs f as if this process were replica id.
+func asReplica(t *testing.T, id string, f func()) {
+    t.Helper()
+    saved := replicaID
+    replicaID = id
+    defer func() { replicaID = saved }()
+    f()
+}
+
+func TestLeaseSingleHolderAndTakeover(t *testing.T) {
+    mr := setupTest(t)
+    ttl := 3 * time.Second
+
+    ran := map[string]int{}
+    tick := func() {
+        for _, id := range []string{"a", "b"} {
+            asReplica(t, id, func() { runLeased("sweep", ttl, func() { ran[id]++ }) })
+        }
+    }
+
+    tick()
+    tick()
+    if ran["a"] != 2 || ran["b"] != 0 {
+        t.Fatalf("runs = %v; want only a, every tick", ran)
+    }
+
+    // a keeps renewing, so b never gets in while a is alive
+    mr.FastForward(2 * time.Second)
+    tick()
+    mr.FastForward(2 * time.Second)
+    tick()
+    if ran["b"] != 0 {
+        t.Fatalf("b ran while a still held the lease: %v", ran)
+    }
+
+    // a dies: its lease runs out and b takes over
+    mr.FastForward(ttl + time.Second)
+    asReplica(t, "b", func() { runLeased("sweep", ttl, func() { ran["b"]++ }) })
+    asReplica(t, "a", func() {
+        if holdLease("sweep", ttl) {
+            t.Error("a renewed a lease b holds")
+        }
+    })
+    if ran["b"] != 1 {
+        t.Fatalf("b did not take over after the lease expired: %v", ran)
+    }
+}
+
+func TestListLocks(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    saved := leaseNames
+    leaseNames = []string{"reaper", "dlq"}
+    defer func() { leaseNames = saved }()
+    asReplica(t, "other", func() { holdLease("dlq", time.Minute) })
+
+    w := do(newRouter(), http.MethodGet, "/admin/locks", "", "Authorization", "Bearer secret")
+    var got struct {
+        Replica string      `json:"replica"`
+        Locks   []leaseInfo `json:"locks"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("status = %d, body %s", w.Code, w.Body)
+    }
+    if got.Replica != replicaID || len(got.Locks) != 2 {
+        t.Fatalf("body %s; want this replica and two locks", w.Body)
+    }
+    if got.Locks[0].Holder != "" {
+        t.Errorf("reaper lease held by %q, want unheld", got.Locks[0].Holder)
+    }
+    if dlq := got.Locks[1]; dlq.Holder != "other" || dlq.Mine || dlq.ExpiresIn <= 0 {
+        t.Errorf("dlq lease = %+v; want held by other with a TTL", dlq)
+    }
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+    "net/http"
+    "sync"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// uploadLimiter caps concurrent uploads at size(), read per request so a
+// reload can change it. When every slot is taken the request is turned away
+// immediately instead of queueing another goroutine behind the storage
+// proxy. Lowering the cap lets the uploads in flight finish.
+func uploadLimiter(size func() int) gin.HandlerFunc {
+    var mu sync.Mutex
+    inUse := 0
+
+    return func(c *gin.Context) {
+        mu.Lock()
+        if inUse >= size() {
+            mu.Unlock()
+            c.Header("Retry-After", "5")
+            c.AbortWithStatusJSON(http.StatusServiceUnavailable, api.ErrorResponse{Error: "Too many uploads in progress, try again shortly"})
+            return
+        }
+        inUse++
+        mu.Unlock()
+        uploadSlotsInUse.Inc()
+        defer func() {
+            mu.Lock()
+            inUse--
+            mu.Unlock()
+            uploadSlotsInUse.Dec()
+        }()
+
+        c.Next()
+    }
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUploadLimiterGauge(t *testing.T) {
+    setupTest(t)
+    entered, release := make(chan struct{}), make(chan struct{})
+    r := gin.New()
+    r.POST("/upload", uploadLimiter(func() int { return 1 }), func(c *gin.Context) {
+        entered <- struct{}{}
+        <-release
+        c.Status(http.StatusAccepted)
+    })
+    base := testutil.ToFloat64(uploadSlotsInUse)
+
+    done := make(chan *httptest.ResponseRecorder)
+    go func() { done <- do(r, http.MethodPost, "/upload", "") }()
+    <-entered
+    if got := testutil.ToFloat64(uploadSlotsInUse) - base; got != 1 {
+        t.Fatalf("upload_slots_in_use while an upload holds the slot = %v, want 1", got)
+    }
+
+    w := do(r, http.MethodPost, "/upload", "")
+    if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+        t.Fatalf("second upload: status = %d, Retry-After %q; want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+    }
+    if got := testutil.ToFloat64(uploadSlotsInUse) - base; got != 1 {
+        t.Fatalf("upload_slots_in_use after a rejected upload = %v, want 1", got)
+    }
+
+    close(release)
+    if w := <-done; w.Code != http.StatusAccepted {
+        t.Fatalf("first upload: status = %d, want 202", w.Code)
+    }
+    if got := testutil.ToFloat64(uploadSlotsInUse) - base; got != 0 {
+        t.Fatalf("upload_slots_in_use after the upload finished = %v, want 0", got)
+    }
+}
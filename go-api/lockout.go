@@ -0,0 +1,107 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// Failed API key, admin token and internal signature checks are counted per
+// client IP in auth_failures:{ip}. Reaching AUTH_LOCKOUT_THRESHOLD within the
+// window locks the IP out of every route via auth_lockout:{ip}.
+//
+// They are also counted per account, the credential being checked, in
+// auth_failures:account:{account}, so guesses spread over many addresses
+// still run out. Past AUTH_ACCOUNT_LOCKOUT_THRESHOLD that credential is
+// refused for everyone until auth_lockout:account:{account} expires.
+const authFailureWindow = 15 * time.Minute
+
+// Accounts the auth checks count failures against. API keys are anonymous
+// secrets, so they share one account.
+const (
+    authAccountAdmin    = "admin"
+    authAccountInternal = "internal"
+    authAccountAPIKey   = "apikey"
+)
+
+func accountKey(prefix, account string) string {
+    return prefix + "account:" + account
+}
+
+// rejectLockedOut answers 429 to locked-out IPs before anything else runs.
+func rejectLockedOut(c *gin.Context) {
+    ttl, err := rdb.TTL(c.Request.Context(), "auth_lockout:"+c.ClientIP()).Result()
+    if err != nil || ttl <= 0 {
+        c.Next()
+        return
+    }
+    c.Header("Retry-After", strconv.Itoa(int(ttl.Seconds())))
+    c.AbortWithStatusJSON(http.StatusTooManyRequests, api.ErrorResponse{Error: "Too many failed authentication attempts"})
+}
+
+// accountLockedOut answers 429 and returns true while account is locked, so
+// callers skip the credential check entirely.
+func accountLockedOut(c *gin.Context, account string) bool {
+    ttl, err := rdb.TTL(c.Request.Context(), accountKey("auth_lockout:", account)).Result()
+    if err != nil || ttl <= 0 {
+        return false
+    }
+    c.Header("Retry-After", strconv.Itoa(int(ttl.Seconds())))
+    c.AbortWithStatusJSON(http.StatusTooManyRequests, api.ErrorResponse{Error: "Too many failed authentication attempts for this credential"})
+    return true
+}
+
+// recordAuthFailure counts a failed check against the IP and the account and
+// starts a lockout once either reaches its threshold.
+func recordAuthFailure(c *gin.Context, account string) {
+    ip := c.ClientIP()
+    countFailure(c, "auth_failures:"+ip, "auth_lockout:"+ip, cfg().AuthLockoutThreshold)
+    countFailure(c, accountKey("auth_failures:", account), accountKey("auth_lockout:", account), cfg().AuthAccountLockoutThreshold)
+}
+
+func countFailure(c *gin.Context, key, lockKey string, threshold int) {
+    ctx := c.Request.Context()
+    n, err := rdb.Incr(ctx, key).Result()
+    if err != nil {
+        return
+    }
+    if n == 1 {
+        rdb.Expire(ctx, key, authFailureWindow)
+    }
+    if n >= int64(threshold) {
+        rdb.Set(ctx, lockKey, n, cfg().AuthLockoutDuration())
+        rdb.Del(ctx, key)
+    }
+}
+
+// clearAuthFailures resets the counts after a successful check, so only
+// consecutive failures lead to a lockout.
+func clearAuthFailures(c *gin.Context, account string) {
+    rdb.Del(c.Request.Context(), "auth_failures:"+c.ClientIP(), accountKey("auth_failures:", account))
+}
+
+// POST /admin/auth/unlock/:ip lifts a lockout and resets the count.
+func handleAuthUnlock(c *gin.Context) {
+    ip := c.Param("ip")
+    if err := rdb.Del(c.Request.Context(), "auth_failures:"+ip, "auth_lockout:"+ip).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"ip": ip, "unlocked": true})
+}
+
+// POST /admin/auth/unlock-account/:account does the same for an account
+// (apikey or internal; a locked admin account has to wait it out).
+func handleAuthUnlockAccount(c *gin.Context) {
+    account := c.Param("account")
+    err := rdb.Del(c.Request.Context(), accountKey("auth_failures:", account), accountKey("auth_lockout:", account)).Err()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"account": account, "unlocked": true})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestLockoutIgnoresRotatedForwardedFor(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.AdminToken = "secret"
+        c.AuthLockoutThreshold = 3
+    })
+    r := newRouter()
+    for i := 0; i < 3; i++ {
+        xff := fmt.Sprintf("198.51.100.%d", i)
+        do(r, http.MethodGet, "/admin/dlq", "", "Authorization", "Bearer wrong", "X-Forwarded-For", xff)
+    }
+    w := do(r, http.MethodGet, "/admin/dlq", "", "Authorization", "Bearer secret", "X-Forwarded-For", "198.51.100.99")
+    if w.Code != http.StatusTooManyRequests {
+        t.Fatalf("status = %d, want 429 once the peer IP reached the threshold", w.Code)
+    }
+}
+
+func TestAccountLockoutSpansIPs(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.AdminToken = "secret"
+        c.AuthLockoutThreshold = 100
+        c.AuthAccountLockoutThreshold = 3
+    })
+    r := newRouter()
+    from := func(ip, token string) int {
+        req := httptest.NewRequest(http.MethodGet, "/admin/dlq", nil)
+        req.RemoteAddr = ip + ":1234"
+        req.Header.Set("Authorization", "Bearer "+token)
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w.Code
+    }
+    for i := 0; i < 3; i++ {
+        if code := from(fmt.Sprintf("198.51.100.%d", i), "wrong"); code != http.StatusUnauthorized {
+            t.Fatalf("guess %d: status = %d, want 401", i, code)
+        }
+    }
+    if code := from("203.0.113.7", "secret"); code != http.StatusTooManyRequests {
+        t.Fatalf("status = %d, want 429 for a locked account", code)
+    }
+}
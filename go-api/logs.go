@@ -0,0 +1,185 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Workers XADD each line of slicer output to logs:{id} as field "line",
+// capped at about 10000 lines, and keep the stream an hour past the job's own
+// keys. Entry IDs start with the time the line was added.
+func logStreamKey(jobID string) string {
+    return "logs:" + jobID
+}
+
+var (
+    // logsBlock is how long one XREAD waits for new lines.
+    logsBlock = time.Second
+    // logsIdleClose ends the stream once the job has finished and no line
+    // has arrived for this long.
+    logsIdleClose = 5 * time.Second
+)
+
+// streamIDPattern matches the offsets clients may resume from: "0" for the
+// start or an entry ID they were sent.
+var streamIDPattern = regexp.MustCompile(`^\d+(-\d+)?$`)
+
+// GET /jobs/:id/logs is the worker's slicer output, for the job's owner or
+// holder of its access token. See serveJobLogs.
+func handleJobLogs(c *gin.Context) {
+    if _, err := rdb.Get(c.Request.Context(), "status:"+c.Param("id")).Result(); err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if !authorizeJob(c, c.Param("id")) {
+        return
+    }
+    serveJobLogs(c, c.Param("id"))
+}
+
+// GET /admin/jobs/:id/logs is the same for support, for any job.
+func handleAdminJobLogs(c *gin.Context) {
+    if _, err := rdb.Get(c.Request.Context(), "status:"+c.Param("id")).Result(); err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    serveJobLogs(c, c.Param("id"))
+}
+
+// serveJobLogs answers "Accept: application/json" with the last
+// LOG_TAIL_BYTES of output, whole lines with their times. Otherwise it
+// streams the output as server-sent events, one "data:" event per line with
+// the stream entry ID as its "id:". ?offset= (or Last-Event-ID on
+// reconnect) resumes after that entry; the default is the beginning.
+func serveJobLogs(c *gin.Context, jobID string) {
+    reqCtx := c.Request.Context()
+    if wantsJSON(c) {
+        serveLogTail(c, jobID)
+        return
+    }
+    offset := c.DefaultQuery("offset", "0")
+    if last := c.GetHeader("Last-Event-ID"); last != "" {
+        offset = last
+    }
+    if !streamIDPattern.MatchString(offset) {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "offset must be a log stream ID"})
+        return
+    }
+
+    c.Header("Content-Type", "text/event-stream")
+    c.Header("Cache-Control", "no-cache")
+    c.Header("X-Accel-Buffering", "no")
+    c.Status(http.StatusOK)
+    c.Writer.Flush()
+
+    lastLine := time.Now()
+    for {
+        streams, err := rdb.XRead(reqCtx, &redis.XReadArgs{
+            Streams: []string{logStreamKey(jobID), offset},
+            Count:   100,
+            Block:   logsBlock,
+        }).Result()
+        if reqCtx.Err() != nil {
+            return
+        }
+        if err != nil && err != redis.Nil {
+            fmt.Fprint(c.Writer, "event: error\ndata: Redis error\n\n")
+            c.Writer.Flush()
+            return
+        }
+
+        if len(streams) > 0 && len(streams[0].Messages) > 0 {
+            for _, m := range streams[0].Messages {
+                line, _ := m.Values["line"].(string)
+                fmt.Fprintf(c.Writer, "id: %s\n", m.ID)
+                for _, l := range strings.Split(line, "\n") {
+                    fmt.Fprintf(c.Writer, "data: %s\n", l)
+                }
+                fmt.Fprint(c.Writer, "\n")
+                offset = m.ID
+            }
+            c.Writer.Flush()
+            lastLine = time.Now()
+            continue
+        }
+
+        if time.Since(lastLine) < logsIdleClose {
+            continue
+        }
+        // An expired status means the job is long gone too
+        status, err := rdb.Get(reqCtx, "status:"+jobID).Result()
+        if err == redis.Nil || parseJobStatus(status).IsTerminal() {
+            fmt.Fprintf(c.Writer, "event: end\ndata: %s\n\n", status)
+            c.Writer.Flush()
+            return
+        }
+    }
+}
+
+// wantsJSON reports whether the client asked for JSON rather than events.
+func wantsJSON(c *gin.Context) bool {
+    accept := c.GetHeader("Accept")
+    return strings.Contains(accept, gin.MIMEJSON) && !strings.Contains(accept, "text/event-stream")
+}
+
+// serveLogTail reads logs:{id} newest first until LOG_TAIL_BYTES is used up,
+// and answers with those lines oldest first. A newest line that is too long
+// on its own keeps its end.
+func serveLogTail(c *gin.Context, jobID string) {
+    ctx := c.Request.Context()
+    budget := cfg().LogTailBytes
+    var lines []api.LogLine
+    truncated := false
+    end := "+"
+read:
+    for {
+        msgs, err := rdb.XRevRangeN(ctx, logStreamKey(jobID), end, "-", 100).Result()
+        if err != nil && err != redis.Nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+        for _, m := range msgs {
+            line, _ := m.Values["line"].(string)
+            if len(line)+1 > budget {
+                truncated = true
+                if len(lines) == 0 {
+                    lines = append(lines, logLine(m.ID, strings.ToValidUTF8(line[len(line)-budget:], "")))
+                }
+                break read
+            }
+            budget -= len(line) + 1
+            lines = append(lines, logLine(m.ID, line))
+        }
+        if len(msgs) < 100 {
+            break
+        }
+        end = "(" + msgs[len(msgs)-1].ID
+    }
+    for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+        lines[i], lines[j] = lines[j], lines[i]
+    }
+    if lines == nil {
+        lines = []api.LogLine{}
+    }
+    status, _ := rdb.Get(ctx, "status:"+jobID).Result()
+    c.JSON(http.StatusOK, api.JobLogsResponse{JobID: jobID, Status: string(parseJobStatus(status)), Lines: lines, Truncated: truncated})
+}
+
+// logLine stamps a log line with the time in its stream entry ID.
+func logLine(id, line string) api.LogLine {
+    l := api.LogLine{ID: id, Line: line}
+    ms, _, _ := strings.Cut(id, "-")
+    if n, err := strconv.ParseInt(ms, 10, 64); err == nil {
+        l.At = time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+    }
+    return l
+}
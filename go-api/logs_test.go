@@ -0,0 +1,157 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+func addLogLine(t *testing.T, jobID, line string) string {
+    t.Helper()
+    id, err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: logStreamKey(jobID), Values: map[string]interface{}{"line": line}}).Result()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return id
+}
+
+func shortLogTimers(t *testing.T) {
+    savedBlock, savedIdle := logsBlock, logsIdleClose
+    logsBlock, logsIdleClose = 10*time.Millisecond, 50*time.Millisecond
+    t.Cleanup(func() { logsBlock, logsIdleClose = savedBlock, savedIdle })
+}
+
+func TestJobLogsStreamsUntilFinished(t *testing.T) {
+    setupTest(t)
+    shortLogTimers(t)
+    rdb.Set(ctx, "status:j1", "completed", 0)
+    addLogLine(t, "j1", "Slicing model")
+    addLogLine(t, "j1", "Exporting G-code")
+
+    w := do(newRouter(), http.MethodGet, "/jobs/j1/logs", "")
+    if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "text/event-stream" {
+        t.Fatalf("status = %d, Content-Type %q; want a 200 event stream", w.Code, ct)
+    }
+    body := w.Body.String()
+    for _, want := range []string{"data: Slicing model\n", "data: Exporting G-code\n", "event: end\ndata: completed\n"} {
+        if !strings.Contains(body, want) {
+            t.Errorf("stream is missing %q:\n%s", want, body)
+        }
+    }
+}
+
+func TestJobLogsOffset(t *testing.T) {
+    setupTest(t)
+    shortLogTimers(t)
+    rdb.Set(ctx, "status:j1", "failed", 0)
+    first := addLogLine(t, "j1", "first")
+    addLogLine(t, "j1", "second")
+    r := newRouter()
+
+    body := do(r, http.MethodGet, "/jobs/j1/logs?offset="+first, "").Body.String()
+    if strings.Contains(body, "data: first") || !strings.Contains(body, "data: second") {
+        t.Errorf("resuming after %s should skip only the first line:\n%s", first, body)
+    }
+
+    if w := do(r, http.MethodGet, "/jobs/j1/logs?offset=$", ""); w.Code != http.StatusBadRequest {
+        t.Errorf("bad offset: status = %d, want 400", w.Code)
+    }
+}
+
+func TestJobLogsWaitsForRunningJob(t *testing.T) {
+    setupTest(t)
+    shortLogTimers(t)
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    go func() {
+        time.Sleep(100 * time.Millisecond)
+        rdb.XAdd(ctx, &redis.XAddArgs{Stream: logStreamKey("j1"), Values: map[string]interface{}{"line": "late line"}})
+        rdb.Set(ctx, "status:j1", "completed", 0)
+    }()
+
+    body := do(newRouter(), http.MethodGet, "/jobs/j1/logs", "").Body.String()
+    if !strings.Contains(body, "data: late line") || !strings.Contains(body, "event: end") {
+        t.Errorf("stream should carry the line written while processing, then end:\n%s", body)
+    }
+}
+
+func TestJobLogsTailAsJSON(t *testing.T) {
+    setupTest(t, func(c *Config) { c.LogTailBytes = 20 })
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    for _, line := range []string{"first line", "second", "third", "fourth"} {
+        addLogLine(t, "j1", line)
+    }
+
+    w := do(newRouter(), http.MethodGet, "/jobs/j1/logs", "", "Accept", "application/json")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+    }
+    var resp api.JobLogsResponse
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    var got []string
+    for _, l := range resp.Lines {
+        got = append(got, l.Line)
+        if _, err := time.Parse(time.RFC3339Nano, l.At); err != nil {
+            t.Errorf("line %q has time %q: %v", l.Line, l.At, err)
+        }
+    }
+    // 20 bytes hold the last three lines with their newlines
+    if want := []string{"second", "third", "fourth"}; !reflect.DeepEqual(got, want) || !resp.Truncated || resp.Status != "processing" {
+        t.Errorf("tail = %v, truncated %v, status %q; want %v, truncated, processing", got, resp.Truncated, resp.Status, want)
+    }
+}
+
+func TestJobLogsTailLongLine(t *testing.T) {
+    setupTest(t, func(c *Config) { c.LogTailBytes = 10 })
+    rdb.Set(ctx, "status:j1", "failed", 0)
+    addLogLine(t, "j1", "ERROR: mesh is not manifold")
+
+    var resp api.JobLogsResponse
+    json.Unmarshal(do(newRouter(), http.MethodGet, "/jobs/j1/logs", "", "Accept", "application/json").Body.Bytes(), &resp)
+    if len(resp.Lines) != 1 || resp.Lines[0].Line != "t manifold" || !resp.Truncated {
+        t.Errorf("tail = %+v, want the line's last 10 bytes", resp)
+    }
+}
+
+func TestJobLogsPaging(t *testing.T) {
+    setupTest(t)
+    rdb.Set(ctx, "status:j1", "completed", 0)
+    for i := 0; i < 250; i++ {
+        addLogLine(t, "j1", "layer")
+    }
+
+    var resp api.JobLogsResponse
+    json.Unmarshal(do(newRouter(), http.MethodGet, "/jobs/j1/logs", "", "Accept", "application/json").Body.Bytes(), &resp)
+    if len(resp.Lines) != 250 || resp.Truncated {
+        t.Errorf("got %d lines, truncated %v; want all 250", len(resp.Lines), resp.Truncated)
+    }
+}
+
+func TestJobLogsAccess(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    r := newRouter()
+    w := do(r, http.MethodPost, "/quote", versionQuote)
+    var sub api.SubmitJobResponse
+    json.Unmarshal(w.Body.Bytes(), &sub)
+    addLogLine(t, sub.JobID, "Slicing model")
+
+    path := "/jobs/" + sub.JobID + "/logs"
+    if w := do(r, http.MethodGet, path, "", "Accept", "application/json"); w.Code != http.StatusForbidden {
+        t.Errorf("without the access token: status = %d, want 403", w.Code)
+    }
+    if w := do(r, http.MethodGet, path, "", "Accept", "application/json", jobTokenHeader, sub.AccessToken); w.Code != http.StatusOK {
+        t.Errorf("with the access token: status = %d, want 200", w.Code)
+    }
+    if w := do(r, http.MethodGet, "/admin"+path, "", "Accept", "application/json", "Authorization", "Bearer secret"); w.Code != http.StatusOK {
+        t.Errorf("admin: status = %d, want 200", w.Code)
+    }
+    if w := do(r, http.MethodGet, "/admin/jobs/missing/logs", "", "Authorization", "Bearer secret"); w.Code != http.StatusNotFound {
+        t.Errorf("admin, unknown job: status = %d, want 404", w.Code)
+    }
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// maxStatusWait caps GET /status/:id?wait=, under the usual proxy idle
+// timeouts.
+const maxStatusWait = 30 * time.Second
+
+var errBadWait = errors.New("wait must be a duration such as 25s, or seconds")
+
+// parseStatusWait reads ?wait=, as a Go duration or whole seconds, capped at
+// maxStatusWait. Empty means don't wait.
+func parseStatusWait(s string) (time.Duration, error) {
+    if s == "" {
+        return 0, nil
+    }
+    d, err := time.ParseDuration(s)
+    if err != nil {
+        n, nerr := strconv.Atoi(s)
+        if nerr != nil {
+            return 0, errBadWait
+        }
+        d = time.Duration(n) * time.Second
+    }
+    if d < 0 {
+        return 0, errBadWait
+    }
+    return min(d, maxStatusWait), nil
+}
+
+// longPollTimeout is timeoutMiddleware with room for the request's ?wait=
+// on top of d. A bad value is left for the handler to reject.
+func longPollTimeout(d time.Duration) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        wait, _ := parseStatusWait(c.Query("wait"))
+        timeoutMiddleware(d+wait)(c)
+    }
+}
+
+// awaitStatusChange returns once jobID's status differs from what it was on
+// entry, wait has passed or ctx ends. It returns at once for unknown and
+// finished jobs. Each waiter has its own subscription, so one publish
+// releases them all; the poll covers workers that write to Redis directly.
+func awaitStatusChange(ctx context.Context, jobID string, wait time.Duration) error {
+    // Subscribe before the first read so no change in between is missed
+    sub := rdb.Subscribe(ctx, statusEventsPrefix+jobID)
+    defer sub.Close()
+    if _, err := sub.Receive(ctx); err != nil {
+        return err
+    }
+    from, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err != nil || parseJobStatus(from).IsTerminal() {
+        return nil
+    }
+
+    events := sub.Channel()
+    timer := time.NewTimer(wait)
+    defer timer.Stop()
+    poll := time.NewTicker(statusStreamPoll)
+    defer poll.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            // The client left; nobody reads what follows
+            return nil
+        case <-timer.C:
+            return nil
+        case <-events:
+        case <-poll.C:
+        }
+        // Progress reports are published too; only a new status counts
+        if status, err := rdb.Get(ctx, "status:"+jobID).Result(); err != nil || status != from {
+            return nil
+        }
+    }
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+)
+
+// longPoll starts GET /status/:id?wait= and waits until it has subscribed.
+// The returned channel yields the status it answered with.
+func longPoll(t *testing.T, h http.Handler, jobID, wait string) <-chan string {
+    t.Helper()
+    before := rdb.PubSubNumSub(ctx, statusEventsPrefix+jobID).Val()[statusEventsPrefix+jobID]
+    done := make(chan string, 1)
+    go func() {
+        w := do(h, http.MethodGet, "/status/"+jobID+"?wait="+wait, "")
+        var resp struct {
+            Status string `json:"status"`
+        }
+        json.Unmarshal(w.Body.Bytes(), &resp)
+        done <- resp.Status
+    }()
+    for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+        if rdb.PubSubNumSub(ctx, statusEventsPrefix+jobID).Val()[statusEventsPrefix+jobID] > before {
+            return done
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("long-poll never subscribed")
+        }
+    }
+}
+
+func pollResult(t *testing.T, done <-chan string, within time.Duration) string {
+    t.Helper()
+    select {
+    case status := <-done:
+        return status
+    case <-time.After(within):
+        t.Fatal("long-poll wasn't released")
+        return ""
+    }
+}
+
+func TestParseStatusWait(t *testing.T) {
+    tests := []struct {
+        in   string
+        want time.Duration
+        ok   bool
+    }{
+        {"", 0, true},
+        {"25s", 25 * time.Second, true},
+        {"10", 10 * time.Second, true},
+        {"90s", maxStatusWait, true},
+        {"-1s", 0, false},
+        {"soon", 0, false},
+    }
+    for _, tt := range tests {
+        got, err := parseStatusWait(tt.in)
+        if (err == nil) != tt.ok || got != tt.want {
+            t.Errorf("parseStatusWait(%q) = %v, %v; want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+        }
+    }
+}
+
+func TestLongPollReleasesAllWaiters(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    streamTimers(t, time.Hour, time.Hour)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    var waiters []<-chan string
+    for i := 0; i < 3; i++ {
+        waiters = append(waiters, longPoll(t, r, "j1", "25s"))
+    }
+    // Progress alone doesn't release them
+    reportStatus(t, r, "j1", `{"status":"processing","step":"slicing","progress_percent":40}`)
+    select {
+    case status := <-waiters[0]:
+        t.Fatalf("released by a progress report with %q", status)
+    case <-time.After(50 * time.Millisecond):
+    }
+    reportStatus(t, r, "j1", `{"status":"completed","result":{"summary":{"total_cost":9.9}}}`)
+    for _, w := range waiters {
+        if status := pollResult(t, w, time.Second); status != "completed" {
+            t.Errorf("long-poll answered %q, want completed", status)
+        }
+    }
+}
+
+func TestLongPollPollsForDirectWrites(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    streamTimers(t, 20*time.Millisecond, time.Hour)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "queued", 0)
+
+    done := longPoll(t, r, "j1", "25s")
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    if status := pollResult(t, done, time.Second); status != "processing" {
+        t.Fatalf("long-poll answered %q, want processing", status)
+    }
+}
+
+func TestLongPollTimesOut(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    streamTimers(t, time.Hour, time.Hour)
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    start := time.Now()
+    w := do(newRouter(), http.MethodGet, "/status/j1?wait=100ms", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200", w.Code)
+    }
+    if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+        t.Errorf("answered after %v, want about 100ms", elapsed)
+    }
+}
+
+func TestLongPollFinishedJobReturnsAtOnce(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    rdb.Set(ctx, "status:j1", "completed", 0)
+    start := time.Now()
+    if w := do(newRouter(), http.MethodGet, "/status/j1?wait=25s", ""); w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200", w.Code)
+    }
+    if elapsed := time.Since(start); elapsed > time.Second {
+        t.Errorf("finished job held for %v", elapsed)
+    }
+    if w := do(newRouter(), http.MethodGet, "/status/missing?wait=25s", ""); w.Code != http.StatusNotFound {
+        t.Errorf("unknown job: status = %d, want 404", w.Code)
+    }
+    if w := do(newRouter(), http.MethodGet, "/status/j1?wait=soon", ""); w.Code != http.StatusBadRequest {
+        t.Errorf("bad wait: status = %d, want 400", w.Code)
+    }
+}
+
+func TestLongPollOutlivesAPITimeout(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    streamTimers(t, time.Hour, time.Hour)
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    w := do(newRouter(WithAPITimeout(50*time.Millisecond)), http.MethodGet, "/status/j1?wait=150ms", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200 after the wait (body %s)", w.Code, w.Body)
+    }
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+    "embed"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// MaterialProfile is a material's print settings and cost.
+type MaterialProfile = api.MaterialProfile
+
+//go:embed materials.json
+var materialFiles embed.FS
+
+// materialProfilesFile is the profile list shipped with the API.
+const materialProfilesFile = "materials.json"
+
+// materialProfiles and materialIndex, by lowercase name and alias, are
+// loaded once; main refuses to start if the embedded file doesn't load.
+var (
+    materialProfiles, materialProfilesErr = LoadMaterialProfiles(materialProfilesFile)
+    materialIndex                         = indexMaterials(materialProfiles)
+)
+
+// LoadMaterialProfiles reads and checks the embedded profile list at path.
+// Names and aliases must be unique ignoring case, and each profile's
+// defaults must lie within its own limits.
+func LoadMaterialProfiles(path string) ([]MaterialProfile, error) {
+    data, err := materialFiles.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var profiles []MaterialProfile
+    if err := json.Unmarshal(data, &profiles); err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    if len(profiles) == 0 {
+        return nil, fmt.Errorf("%s has no profiles", path)
+    }
+    seen := map[string]string{}
+    for _, p := range profiles {
+        if p.Name == "" {
+            return nil, fmt.Errorf("%s: a profile has no name", path)
+        }
+        for _, name := range append([]string{p.Name}, p.Aliases...) {
+            key := strings.ToLower(name)
+            if other, dup := seen[key]; dup {
+                return nil, fmt.Errorf("%s: %q names both %s and %s", path, name, other, p.Name)
+            }
+            seen[key] = p.Name
+        }
+        switch {
+        case p.DensityGPerCM3 <= 0:
+            return nil, fmt.Errorf("%s: %s's density must be positive", path, p.Name)
+        case p.CostPerGram < 0:
+            return nil, fmt.Errorf("%s: %s's cost_per_gram must not be negative", path, p.Name)
+        case p.MinLayerHeight <= 0 || p.MinLayerHeight > p.DefaultLayerHeight || p.DefaultLayerHeight > p.MaxLayerHeight:
+            return nil, fmt.Errorf("%s: %s needs 0 < min_layer_height <= default_layer_height <= max_layer_height", path, p.Name)
+        case p.DefaultInfill < 0 || p.DefaultInfill > 100:
+            return nil, fmt.Errorf("%s: %s's default_infill must be between 0 and 100", path, p.Name)
+        }
+    }
+    return profiles, nil
+}
+
+func indexMaterials(profiles []MaterialProfile) map[string]int {
+    index := map[string]int{}
+    for i, p := range profiles {
+        for _, name := range append([]string{p.Name}, p.Aliases...) {
+            index[strings.ToLower(name)] = i
+        }
+    }
+    return index
+}
+
+// findMaterial looks name up among the profiles' names and aliases,
+// ignoring case and surrounding space.
+func findMaterial(name string) (MaterialProfile, bool) {
+    i, ok := materialIndex[strings.ToLower(strings.TrimSpace(name))]
+    if !ok {
+        return MaterialProfile{}, false
+    }
+    return materialProfiles[i], true
+}
+
+// GET /materials lists the material profiles.
+//
+//	@Summary	List material profiles
+//	@Produce	json
+//	@Success	200	{object}	api.MaterialsResponse
+//	@Router		/materials [get]
+func handleMaterials(c *gin.Context) {
+    c.JSON(http.StatusOK, api.MaterialsResponse{Materials: materialProfiles})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+
+    "slicer-api/internal/api"
+)
+
+func TestEmbeddedMaterialProfilesLoad(t *testing.T) {
+    if materialProfilesErr != nil {
+        t.Fatal(materialProfilesErr)
+    }
+    if _, err := LoadMaterialProfiles("missing.json"); err == nil {
+        t.Error("a missing file loaded")
+    }
+}
+
+func TestFindMaterial(t *testing.T) {
+    for name, want := range map[string]string{
+        "PLA":           "PLA",
+        "pla":           "PLA",
+        " Petg ":        "PETG",
+        "pla+":          "PLA",
+        "prusament asa": "ASA",
+        "FLEX":          "TPU",
+    } {
+        if p, ok := findMaterial(name); !ok || p.Name != want {
+            t.Errorf("findMaterial(%q) = %q, %v, want %s", name, p.Name, ok, want)
+        }
+    }
+    if p, ok := findMaterial("unobtainium"); ok {
+        t.Errorf("findMaterial(unobtainium) = %+v", p)
+    }
+}
+
+func TestListMaterials(t *testing.T) {
+    setupTest(t)
+    w := do(newRouter(), http.MethodGet, "/v1/materials", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200", w.Code)
+    }
+    var resp api.MaterialsResponse
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if len(resp.Materials) != len(materialProfiles) {
+        t.Fatalf("materials = %+v", resp.Materials)
+    }
+    pla := resp.Materials[0]
+    if pla.Name != "PLA" || pla.DensityGPerCM3 != 1.24 || pla.PrintTempC == 0 || len(pla.Aliases) == 0 {
+        t.Errorf("first profile = %+v, want PLA in full", pla)
+    }
+}
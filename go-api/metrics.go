@@ -0,0 +1,194 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "regexp"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var uploadSlotsInUse = promauto.NewGauge(prometheus.GaugeOpts{
+    Name: "upload_slots_in_use",
+    Help: "Number of /upload requests currently holding a concurrency slot.",
+})
+
+// Job lifecycle metrics. Labels stay to small fixed sets, never job IDs.
+var (
+    jobQueueWaitSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+        Name: "job_queue_wait_seconds",
+        Help: "Time from submission until a worker first reported the job processing.",
+        // 1s to about 4.5h
+        Buckets: prometheus.ExponentialBuckets(1, 2, 15),
+    })
+    jobProcessingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+        Name: "job_processing_seconds",
+        Help: "Time from a worker claiming the job until it reached status.",
+        // 5s to about 5.7h
+        Buckets: prometheus.ExponentialBuckets(5, 2, 13),
+    }, []string{"status"})
+    jobFailureTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "job_failure_total",
+        Help: "Jobs that failed, by the reason in their result.",
+    }, []string{"reason"})
+    storageUploadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+        Name: "storage_upload_duration_seconds",
+        Help: "Time to upload a file to storage, including failed uploads.",
+        // 50ms to about 200s
+        Buckets: prometheus.ExponentialBuckets(0.05, 2, 13),
+    }, []string{"backend"})
+    jobsSubmittedTotal = promauto.NewCounter(prometheus.CounterOpts{
+        Name: "jobs_submitted_total",
+        Help: "Jobs accepted by /quote and /upload, including scheduled and cached ones.",
+    })
+    redisCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+        Name: "redis_command_duration_seconds",
+        Help: "Round trip of Redis commands; pipelines and transactions count once as \"pipeline\".",
+        // 100µs to about 3s
+        Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+    }, []string{"command"})
+)
+
+// What Redis holds is read on each scrape, so every replica reports the same
+// shared queue; dashboards take the max across replicas rather than the sum.
+var (
+    queueDepthDesc    = prometheus.NewDesc("job_queue_depth", "Jobs waiting on each queue, fair lists included, and on the processing list.", []string{"queue"}, nil)
+    workersOnlineDesc = prometheus.NewDesc("workers_online", "Workers with a live heartbeat.", nil, nil)
+)
+
+// scrapeTimeout bounds the Redis reads of a scrape.
+const scrapeTimeout = 2 * time.Second
+
+type redisStateCollector struct{}
+
+func (redisStateCollector) Describe(ch chan<- *prometheus.Desc) {
+    ch <- queueDepthDesc
+    ch <- workersOnlineDesc
+}
+
+func (redisStateCollector) Collect(ch chan<- prometheus.Metric) {
+    ctx, cancel := context.WithTimeout(ctx, scrapeTimeout)
+    defer cancel()
+    depths := queueDepths(ctx)
+    // Jobs held back in the fair lists are waiting on their queue too
+    if cfg().FairScheduling {
+        for queue, submitters := range submitterDepths(ctx) {
+            for _, n := range submitters {
+                depths[queue] += n
+            }
+        }
+    }
+    for queue, n := range depths {
+        ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(n), queue)
+    }
+    if n, err := liveHeartbeats(ctx); err == nil {
+        ch <- prometheus.MustNewConstMetric(workersOnlineDesc, prometheus.GaugeValue, float64(n))
+    }
+}
+
+func init() {
+    prometheus.MustRegister(redisStateCollector{})
+}
+
+// metricsHandler serves Prometheus metrics on /metrics.
+func metricsHandler() gin.HandlerFunc {
+    return gin.WrapH(promhttp.Handler())
+}
+
+// failureReasonPattern keeps job_failure_total's reason label to short
+// codes such as "timeout"; free-text errors count as "other".
+var failureReasonPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// failureReason is the error_code, or older "reason", of a failed job's
+// result, "unspecified" when it has neither.
+func failureReason(result json.RawMessage) string {
+    var r struct {
+        ErrorCode *string `json:"error_code"`
+        Reason    *string `json:"reason"`
+    }
+    if json.Unmarshal(result, &r) != nil {
+        return "unspecified"
+    }
+    if r.ErrorCode != nil {
+        r.Reason = r.ErrorCode
+    }
+    if r.Reason == nil {
+        return "unspecified"
+    }
+    if !failureReasonPattern.MatchString(*r.Reason) {
+        return "other"
+    }
+    return *r.Reason
+}
+
+// observeTransition records the lifecycle metrics of jobID going from
+// before to status. Queue wait is only measured on the first pickup:
+// retried jobs have attempts:{id} and have been processed already.
+func observeTransition(ctx context.Context, jobID, before, status string, result json.RawMessage) {
+    switch {
+    case status == "processing" && before == "queued":
+        pipe := rdb.Pipeline()
+        params := pipe.Get(ctx, "params:"+jobID)
+        retried := pipe.Exists(ctx, "attempts:"+jobID)
+        pipe.Exec(ctx)
+        raw, err := params.Bytes()
+        if err != nil || retried.Val() > 0 {
+            return
+        }
+        job, err := readPayload(raw)
+        if err != nil {
+            return
+        }
+        submitted, ok := job["submitted_at"].(float64)
+        if !ok {
+            return
+        }
+        since := time.Unix(int64(submitted), 0)
+        // Scheduled jobs wait from when they were due
+        if at, ok := job["submit_at"].(string); ok {
+            if t, err := time.Parse(time.RFC3339, at); err == nil && t.After(since) {
+                since = t
+            }
+        }
+        jobQueueWaitSeconds.Observe(time.Since(since).Seconds())
+    case parseJobStatus(status).IsTerminal() && (before == "processing" || before == "cancelling"):
+        if startedAt, err := rdb.Get(ctx, "started_at:"+jobID).Int64(); err == nil {
+            jobProcessingSeconds.WithLabelValues(status).Observe(time.Since(time.Unix(startedAt, 0)).Seconds())
+        }
+    }
+    if status == "failed" && before != "failed" {
+        jobFailureTotal.WithLabelValues(failureReason(result)).Inc()
+    }
+}
+
+type metricsStartKey struct{}
+
+// redisMetricsHook times every command the client sends.
+type redisMetricsHook struct{}
+
+func (redisMetricsHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+    return context.WithValue(ctx, metricsStartKey{}, time.Now()), nil
+}
+
+func (redisMetricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+    if start, ok := ctx.Value(metricsStartKey{}).(time.Time); ok {
+        redisCommandDuration.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+    }
+    return nil
+}
+
+func (redisMetricsHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+    return context.WithValue(ctx, metricsStartKey{}, time.Now()), nil
+}
+
+func (redisMetricsHook) AfterProcessPipeline(ctx context.Context, _ []redis.Cmder) error {
+    if start, ok := ctx.Value(metricsStartKey{}).(time.Time); ok {
+        redisCommandDuration.WithLabelValues("pipeline").Observe(time.Since(start).Seconds())
+    }
+    return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    dto "github.com/prometheus/client_model/go"
+)
+
+// sampleCount is how many observations h has had.
+func sampleCount(t *testing.T, h prometheus.Observer) uint64 {
+    t.Helper()
+    var m dto.Metric
+    if err := h.(prometheus.Metric).Write(&m); err != nil {
+        t.Fatal(err)
+    }
+    return m.GetHistogram().GetSampleCount()
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+    t.Helper()
+    var m dto.Metric
+    if err := c.Write(&m); err != nil {
+        t.Fatal(err)
+    }
+    return m.GetCounter().GetValue()
+}
+
+func TestJobLifecycleMetrics(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    waits := sampleCount(t, jobQueueWaitSeconds)
+    completed := sampleCount(t, jobProcessingSeconds.WithLabelValues("completed"))
+
+    _, jobID, _ := quoteJobID(t, r, `{"download_url":"https://example.com/a.stl","material":"PLA","infill":20}`)
+    rdb.Set(ctx, "started_at:"+jobID, time.Now().Add(-42*time.Second).Unix(), time.Hour)
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    if got := sampleCount(t, jobQueueWaitSeconds); got != waits+1 {
+        t.Errorf("job_queue_wait_seconds has %d samples, want %d", got, waits+1)
+    }
+    // Progress reports aren't pickups
+    reportStatus(t, r, jobID, `{"status":"processing","step":"slicing"}`)
+    if got := sampleCount(t, jobQueueWaitSeconds); got != waits+1 {
+        t.Errorf("progress report observed a queue wait")
+    }
+    reportStatus(t, r, jobID, `{"status":"completed","result":{}}`)
+    if got := sampleCount(t, jobProcessingSeconds.WithLabelValues("completed")); got != completed+1 {
+        t.Errorf("job_processing_seconds{status=completed} has %d samples, want %d", got, completed+1)
+    }
+}
+
+func TestQueueWaitSkipsRetries(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    waits := sampleCount(t, jobQueueWaitSeconds)
+    _, jobID, _ := quoteJobID(t, r, `{"download_url":"https://example.com/b.stl","material":"PLA","infill":20}`)
+    rdb.Set(ctx, "attempts:"+jobID, 1, time.Hour)
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    if got := sampleCount(t, jobQueueWaitSeconds); got != waits {
+        t.Errorf("a retried pickup was observed as queue wait")
+    }
+}
+
+func TestJobFailureReasons(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.InternalSecret = "s"
+        c.DownloadRetryEnabled = false
+    })
+    r := newRouter()
+    for reason, result := range map[string]string{
+        "download_failed": `{"reason":"download_failed","error":"404"}`,
+        "geometry_error":  `{"error_code":"geometry_error","reason":"mesh"}`,
+        "other":           `{"reason":"The mesh at /tmp/x.stl is broken"}`,
+        "unspecified":     `{"success":false,"error":"Generation failed"}`,
+    } {
+        before := counterValue(t, jobFailureTotal.WithLabelValues(reason))
+        _, jobID, _ := quoteJobID(t, r, `{"download_url":"https://example.com/`+reason+`.stl","material":"PLA","infill":20}`)
+        reportStatus(t, r, jobID, `{"status":"processing"}`)
+        reportStatus(t, r, jobID, `{"status":"failed","result":`+result+`}`)
+        if got := counterValue(t, jobFailureTotal.WithLabelValues(reason)); got != before+1 {
+            t.Errorf("job_failure_total{reason=%q} = %v, want %v", reason, got, before+1)
+        }
+    }
+}
+
+func TestRedisCommandMetrics(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    rdb.AddHook(redisMetricsHook{})
+    sets := sampleCount(t, redisCommandDuration.WithLabelValues("set"))
+    pipes := sampleCount(t, redisCommandDuration.WithLabelValues("pipeline"))
+
+    rdb.Set(ctx, "k", "v", 0)
+    pipe := rdb.Pipeline()
+    pipe.Get(ctx, "k")
+    pipe.Exec(ctx)
+    if got := sampleCount(t, redisCommandDuration.WithLabelValues("set")); got != sets+1 {
+        t.Errorf("redis_command_duration_seconds{command=set} has %d samples, want %d", got, sets+1)
+    }
+    if got := sampleCount(t, redisCommandDuration.WithLabelValues("pipeline")); got != pipes+1 {
+        t.Errorf("redis_command_duration_seconds{command=pipeline} has %d samples, want %d", got, pipes+1)
+    }
+}
+
+func TestLifecycleMetricsExposed(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    jobFailureTotal.WithLabelValues("timeout")
+    storageUploadDuration.WithLabelValues(storageTmpfiles)
+    w := do(newRouter(), http.MethodGet, "/metrics", "")
+    for _, name := range []string{"job_queue_wait_seconds_bucket", "job_failure_total", "storage_upload_duration_seconds_bucket"} {
+        if !strings.Contains(w.Body.String(), name) {
+            t.Errorf("/metrics lacks %s", name)
+        }
+    }
+}
+
+func TestQueueAndWorkerGauges(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    r := newRouter()
+    submitted := counterValue(t, jobsSubmittedTotal)
+    quoteJobID(t, r, `{"download_url":"https://example.com/g.stl","material":"PLA","infill":20}`)
+    if got := counterValue(t, jobsSubmittedTotal); got != submitted+1 {
+        t.Errorf("jobs_submitted_total = %v, want %v", got, submitted+1)
+    }
+    // One held in the fair lists, two on the queue itself
+    enqueueTestJobs(t, 2)
+    pipe := rdb.TxPipeline()
+    recordHeartbeat(ctx, pipe, "w1", time.Minute)
+    pipe.Exec(ctx)
+
+    body := do(r, http.MethodGet, "/metrics", "").Body.String()
+    if !strings.Contains(body, `job_queue_depth{queue="print_jobs"} 3`) {
+        t.Errorf("/metrics lacks the queued job in job_queue_depth")
+    }
+    if !strings.Contains(body, "workers_online 1") {
+        t.Errorf("/metrics lacks workers_online 1")
+    }
+}
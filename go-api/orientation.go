@@ -0,0 +1,129 @@
+package main
+
+import (
+    "context"
+    "math"
+
+    "slicer-api/internal/api"
+)
+
+// overhangCos is the cosine of the 45° overhang past which a face needs
+// support: faces whose normal points further down than that.
+const overhangCos = math.Sqrt2 / 2
+
+// orientation is one way of laying a model down: the rotation that does it,
+// and the model's direction that then points up.
+type orientation struct {
+    rotation api.Rotation
+    up       [3]float64
+}
+
+// orientations are the three ways OrientationAdvisor considers, each with
+// a different pair of the bounding box's faces on the bed.
+var orientations = [3]orientation{
+    {api.Rotation{}, [3]float64{0, 0, 1}},       // as modelled, on its XY face
+    {api.Rotation{X: 90}, [3]float64{0, 1, 0}},  // on its XZ face
+    {api.Rotation{Y: 90}, [3]float64{-1, 0, 0}}, // on its YZ face
+}
+
+// OrientationAdvice is how to lay a model down, and the support it then
+// needs as a percentage of the model's volume.
+type OrientationAdvice struct {
+    RotationDegrees  api.Rotation
+    SupportVolumePct float64
+}
+
+// overhangs sums the faces needing support in one orientation: their area
+// projected onto the bed, and that area times the height of each face.
+type overhangs struct {
+    area, moment float64
+}
+
+// OrientationAdvisor estimates support from a model's overhanging faces.
+// It keeps the faces facing down and, in case the mesh is inside out, those
+// facing up, per orientation.
+type OrientationAdvisor struct {
+    volume   float64
+    down, up [len(orientations)]overhangs
+}
+
+// NewOrientationAdvisor reads the faces of the STL in data, giving up with
+// ctx's error once ctx ends.
+func NewOrientationAdvisor(ctx context.Context, data []byte) (OrientationAdvisor, error) {
+    var a OrientationAdvisor
+    n := 0
+    err := eachSTLTriangle(data, func(v [3][3]float64) error {
+        if n%4096 == 0 && ctx.Err() != nil {
+            return ctx.Err()
+        }
+        n++
+        a.add(v)
+        return nil
+    })
+    return a, err
+}
+
+func (a *OrientationAdvisor) add(v [3][3]float64) {
+    a.volume += signedVolume(v)
+    var e1, e2, centroid [3]float64
+    for k := range e1 {
+        e1[k], e2[k] = v[1][k]-v[0][k], v[2][k]-v[0][k]
+        centroid[k] = (v[0][k] + v[1][k] + v[2][k]) / 3
+    }
+    // Twice the face's area, along its normal
+    normal := [3]float64{e1[1]*e2[2] - e1[2]*e2[1], e1[2]*e2[0] - e1[0]*e2[2], e1[0]*e2[1] - e1[1]*e2[0]}
+    twiceArea := math.Sqrt(dot(normal, normal))
+    for i, o := range orientations {
+        along, height := dot(normal, o.up), dot(centroid, o.up)
+        switch {
+        case along < -overhangCos*twiceArea:
+            a.down[i].area += -along / 2
+            a.down[i].moment += -along / 2 * height
+        case along > overhangCos*twiceArea:
+            a.up[i].area += along / 2
+            a.up[i].moment += along / 2 * height
+        }
+    }
+}
+
+// Recommend lays the model on the bounding box face with the largest area,
+// keeping it as modelled on a tie. The support estimate fills the space
+// under each overhanging face straight down to the bed, which overstates
+// it for faces above other parts of the model.
+func (a OrientationAdvisor) Recommend(bb BoundingBox) OrientationAdvice {
+    var size [3]float64
+    for k := range size {
+        size[k] = bb.Max[k] - bb.Min[k]
+    }
+    footprints := [len(orientations)]float64{size[0] * size[1], size[0] * size[2], size[1] * size[2]}
+    best := 0
+    for i := range footprints {
+        if footprints[i] > footprints[best] {
+            best = i
+        }
+    }
+
+    o := orientations[best]
+    faces := a.down[best]
+    if a.volume < 0 {
+        faces = a.up[best]
+    }
+    // The bed is at the model's lowest point once rotated
+    bed := 0.0
+    for k, u := range o.up {
+        if u > 0 {
+            bed += u * bb.Min[k]
+        } else {
+            bed += u * bb.Max[k]
+        }
+    }
+    advice := OrientationAdvice{RotationDegrees: o.rotation}
+    if volume := math.Abs(a.volume); volume > 0 {
+        advice.SupportVolumePct = round2(math.Max(0, 100*(faces.moment-faces.area*bed)/volume))
+    }
+    return advice
+}
+
+func dot(a, b [3]float64) float64 {
+    return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
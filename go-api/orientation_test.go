@@ -0,0 +1,64 @@
+package main
+
+import (
+    "context"
+    "testing"
+
+    "slicer-api/internal/api"
+)
+
+func adviseOn(t *testing.T, tris [][3][3]float64) OrientationAdvice {
+    t.Helper()
+    data := binarySTL(tris)
+    meta, err := ParseSTLMetadata(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    advisor, err := NewOrientationAdvisor(context.Background(), data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return advisor.Recommend(meta.Bounds)
+}
+
+func TestRecommendLaysModelOnLargestFace(t *testing.T) {
+    for name, tt := range map[string]struct {
+        hi   [3]float64
+        want api.Rotation
+    }{
+        "flat plate":    {[3]float64{40, 30, 2}, api.Rotation{}},
+        "standing on y": {[3]float64{40, 2, 30}, api.Rotation{X: 90}},
+        "standing on x": {[3]float64{2, 40, 30}, api.Rotation{Y: 90}},
+        "cube":          {[3]float64{10, 10, 10}, api.Rotation{}},
+    } {
+        if got := adviseOn(t, boxTriangles([3]float64{}, tt.hi)); got != (OrientationAdvice{RotationDegrees: tt.want}) {
+            t.Errorf("%s: %+v, want %+v without support", name, got, tt.want)
+        }
+    }
+}
+
+func TestRecommendEstimatesSupport(t *testing.T) {
+    // A plate floating 5mm above another needs the gap filled: as much
+    // support as the two plates' volume
+    shelf := append(boxTriangles([3]float64{0, 0, 0}, [3]float64{40, 40, 5}),
+        boxTriangles([3]float64{0, 0, 10}, [3]float64{40, 40, 15})...)
+    if got := adviseOn(t, shelf); got.RotationDegrees != (api.Rotation{}) || got.SupportVolumePct != 100 {
+        t.Errorf("shelf = %+v, want 100%% support as modelled", got)
+    }
+
+    var insideOut [][3][3]float64
+    for _, tri := range shelf {
+        insideOut = append(insideOut, [3][3]float64{tri[0], tri[2], tri[1]})
+    }
+    if got := adviseOn(t, insideOut); got.SupportVolumePct != 100 {
+        t.Errorf("inside-out shelf = %+v, want the same support", got)
+    }
+}
+
+func TestOrientationAdvisorStopsWithContext(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if _, err := NewOrientationAdvisor(ctx, binarySTL(cubeTriangles(10))); err != context.Canceled {
+        t.Errorf("err = %v, want context.Canceled", err)
+    }
+}
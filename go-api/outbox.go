@@ -0,0 +1,334 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "github.com/google/uuid"
+
+    "slicer-api/internal/api"
+)
+
+// Every webhook and callback POST, quote email and chat message goes
+// through the outbox. outbox:{id} is a
+// hash describing the delivery and every attempt at it; webhook_outbox holds
+// the IDs still to be sent, scored by when the next attempt is due (Unix
+// ms), and webhook_outbox:failed those that ran out of attempts, scored by
+// when. The first attempt is made at once; replicas poll for the rest.
+const (
+    outboxKey       = "webhook_outbox"
+    outboxFailedKey = "webhook_outbox:failed"
+    outboxRecordTTL = 7 * 24 * time.Hour
+    // A claimed delivery is due again this long after, should the replica
+    // sending it die
+    outboxClaimTTL = time.Minute
+    outboxBatch    = 50
+)
+
+var outboxPollInterval = time.Second
+
+func outboxRecordKey(id string) string {
+    return "outbox:" + id
+}
+
+// What a delivery is for.
+const (
+    outboxWebhook      = "webhook"
+    outboxCallback     = "callback"
+    outboxSubscription = "subscription"
+    outboxEmail        = "email"
+    outboxSlack        = "slack"
+    outboxDiscord      = "discord"
+)
+
+// Delivery states.
+const (
+    outboxPending   = "pending"
+    outboxDelivered = "delivered"
+    outboxFailed    = "failed"
+)
+
+// errDeliveryGone fails a delivery at once: its webhook or subscription was
+// deleted or its callback or notify_email expired, so there is nowhere left
+// to send it.
+var errDeliveryGone = errors.New("webhook, callback or email address no longer exists")
+
+type outboxAttempt struct {
+    Attempt        int    `json:"attempt"`
+    At             string `json:"at"`
+    ResponseStatus int    `json:"response_status,omitempty"`
+    DurationMS     int64  `json:"duration_ms"`
+    Error          string `json:"error,omitempty"`
+}
+
+type outboxDelivery struct {
+    ID             string `json:"id"`
+    Kind           string `json:"kind"`
+    WebhookID      string `json:"webhook_id,omitempty"`
+    SubscriptionID string `json:"subscription_id,omitempty"`
+    JobID          string `json:"job_id,omitempty"`
+    Event          string `json:"event"`
+    Payload        string `json:"payload"`
+    State          string `json:"state"`
+    CreatedAt      string `json:"created_at"`
+    // Raised by a redeliver, so the delivery gets a fresh set of attempts
+    MaxAttempts   int             `json:"max_attempts"`
+    Attempts      []outboxAttempt `json:"attempts"`
+    NextAttemptAt string          `json:"next_attempt_at,omitempty"`
+    FailedAt      string          `json:"failed_at,omitempty"`
+}
+
+func saveOutbox(pipe redis.Pipeliner, d outboxDelivery) {
+    attempts, _ := json.Marshal(d.Attempts)
+    key := outboxRecordKey(d.ID)
+    pipe.HSet(ctx, key, map[string]interface{}{
+        "id":              d.ID,
+        "kind":            d.Kind,
+        "webhook_id":      d.WebhookID,
+        "subscription_id": d.SubscriptionID,
+        "job_id":          d.JobID,
+        "event":           d.Event,
+        "payload":         d.Payload,
+        "state":           d.State,
+        "created_at":      d.CreatedAt,
+        "max_attempts":    d.MaxAttempts,
+        "attempts":        attempts,
+        "next_attempt_at": d.NextAttemptAt,
+        "failed_at":       d.FailedAt,
+    })
+    pipe.Expire(ctx, key, outboxRecordTTL)
+}
+
+func loadOutbox(ctx context.Context, id string) (*outboxDelivery, error) {
+    h, err := rdb.HGetAll(ctx, outboxRecordKey(id)).Result()
+    if err != nil {
+        return nil, err
+    }
+    if len(h) == 0 {
+        return nil, redis.Nil
+    }
+    d := &outboxDelivery{
+        ID:             h["id"],
+        Kind:           h["kind"],
+        WebhookID:      h["webhook_id"],
+        SubscriptionID: h["subscription_id"],
+        JobID:          h["job_id"],
+        Event:          h["event"],
+        Payload:        h["payload"],
+        State:          h["state"],
+        CreatedAt:      h["created_at"],
+        NextAttemptAt:  h["next_attempt_at"],
+        FailedAt:       h["failed_at"],
+        Attempts:       []outboxAttempt{},
+    }
+    d.MaxAttempts, _ = strconv.Atoi(h["max_attempts"])
+    json.Unmarshal([]byte(h["attempts"]), &d.Attempts)
+    return d, nil
+}
+
+// enqueueDelivery stores d and returns its ID. It is due once outboxClaimTTL
+// has passed, leaving the caller that long to make the first attempt with
+// attemptDelivery.
+func enqueueDelivery(ctx context.Context, d outboxDelivery) (string, error) {
+    d.ID = uuid.New().String()
+    d.State = outboxPending
+    d.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+    d.MaxAttempts = cfg().WebhookMaxAttempts
+    pipe := rdb.TxPipeline()
+    saveOutbox(pipe, d)
+    pipe.ZAdd(ctx, outboxKey, &redis.Z{Score: float64(time.Now().Add(outboxClaimTTL).UnixMilli()), Member: d.ID})
+    _, err := pipe.Exec(ctx)
+    return d.ID, err
+}
+
+// outboxBackoff is how long after its attempt-th failure a delivery is
+// retried: WEBHOOK_RETRY_BASE_SECONDS, doubled for each attempt since the
+// first.
+func outboxBackoff(attempt int) time.Duration {
+    return cfg().WebhookRetryBase() << (attempt - 1)
+}
+
+// attemptDelivery makes the next attempt at delivery id and records it: done
+// on success, due again after outboxBackoff on failure, or failed once it is
+// out of attempts.
+func attemptDelivery(id string) {
+    d, err := loadOutbox(ctx, id)
+    if err == redis.Nil {
+        rdb.ZRem(ctx, outboxKey, id)
+        return
+    } else if err != nil {
+        log.Printf("outbox: loading %s: %v", id, err)
+        return
+    }
+    if d.State != outboxPending {
+        rdb.ZRem(ctx, outboxKey, id)
+        return
+    }
+
+    n := len(d.Attempts) + 1
+    start := time.Now()
+    var status int
+    switch d.Kind {
+    case outboxWebhook:
+        var w *webhook
+        if w, err = loadWebhook(ctx, d.WebhookID); err == redis.Nil {
+            err = errDeliveryGone
+        } else if err == nil {
+            status, err = sendWebhook(ctx, *w, d.Event, []byte(d.Payload), n, "")
+        }
+    case outboxCallback:
+        status, err = postCallback(ctx, d.JobID, d.Event, []byte(d.Payload))
+    case outboxEmail:
+        err = sendEmail(d.JobID, []byte(d.Payload))
+    case outboxSlack, outboxDiscord:
+        status, err = sendChat(ctx, d.Kind, []byte(d.Payload))
+    case outboxSubscription:
+        var s *subscription
+        if s, err = loadSubscription(ctx, d.SubscriptionID); err == redis.Nil {
+            err = errDeliveryGone
+        } else if err == nil {
+            status, err = sendWebhook(ctx, s.asWebhook(), d.Event, []byte(d.Payload), n, "")
+        }
+    default:
+        err = errDeliveryGone
+    }
+    d.Attempts = append(d.Attempts, outboxAttempt{
+        Attempt:        n,
+        At:             start.UTC().Format(time.RFC3339),
+        ResponseStatus: status,
+        DurationMS:     time.Since(start).Milliseconds(),
+        Error:          errString(err),
+    })
+
+    pipe := rdb.TxPipeline()
+    settled := true
+    switch {
+    case err == nil:
+        d.State, d.NextAttemptAt = outboxDelivered, ""
+        pipe.ZRem(ctx, outboxKey, id)
+    case n >= d.MaxAttempts || errors.Is(err, errDeliveryGone):
+        now := time.Now()
+        d.State, d.NextAttemptAt, d.FailedAt = outboxFailed, "", now.UTC().Format(time.RFC3339)
+        pipe.ZRem(ctx, outboxKey, id)
+        pipe.ZAdd(ctx, outboxFailedKey, &redis.Z{Score: float64(now.UnixMilli()), Member: id})
+        log.Printf("outbox: %s %s for %s failed after %d attempts: %v", d.Kind, d.Event, d.JobID, n, err)
+    default:
+        next := time.Now().Add(outboxBackoff(n))
+        d.NextAttemptAt = next.UTC().Format(time.RFC3339)
+        pipe.ZAdd(ctx, outboxKey, &redis.Z{Score: float64(next.UnixMilli()), Member: id})
+        settled = false
+    }
+    saveOutbox(pipe, *d)
+    if d.Kind == outboxCallback && !errors.Is(err, errDeliveryGone) {
+        recordCallbackOutcome(pipe, d.JobID, n, err, settled)
+    }
+    if _, err := pipe.Exec(ctx); err != nil {
+        log.Printf("outbox: recording %s: %v", id, err)
+    }
+}
+
+// claimOutbox takes up to ARGV[3] deliveries due by ARGV[1], pushing them
+// back to ARGV[2] so another replica polling meanwhile doesn't take them too.
+var claimOutbox = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(due) do
+    redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return due
+`)
+
+// drainOutbox makes the next attempt at every delivery that is due, in
+// parallel, and waits for them.
+func drainOutbox() {
+    now := time.Now()
+    ids, err := claimOutbox.Run(ctx, rdb, []string{outboxKey},
+        now.UnixMilli(), now.Add(outboxClaimTTL).UnixMilli(), outboxBatch).StringSlice()
+    if err != nil {
+        if err != redis.Nil {
+            log.Printf("outbox: %v", err)
+        }
+        return
+    }
+    var wg sync.WaitGroup
+    for _, id := range ids {
+        wg.Add(1)
+        go func(id string) {
+            defer wg.Done()
+            attemptDelivery(id)
+        }(id)
+    }
+    wg.Wait()
+}
+
+// startOutbox retries due deliveries every outboxPollInterval.
+func startOutbox() {
+    go func() {
+        for range time.Tick(outboxPollInterval) {
+            drainOutbox()
+        }
+    }()
+}
+
+// GET /admin/webhooks/failed lists the deliveries that ran out of attempts,
+// latest first, with every attempt's response status and latency.
+func handleListFailedDeliveries(c *gin.Context) {
+    ctx := c.Request.Context()
+    ids, err := rdb.ZRevRange(ctx, outboxFailedKey, 0, int64(deliveriesListLimit)-1).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    failed := []outboxDelivery{}
+    for _, id := range ids {
+        d, err := loadOutbox(ctx, id)
+        if err == redis.Nil {
+            // Expired
+            rdb.ZRem(ctx, outboxFailedKey, id)
+            continue
+        } else if err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+        failed = append(failed, *d)
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(failed), "deliveries": failed})
+}
+
+// POST /admin/webhooks/:id/redeliver gives a failed delivery another
+// WEBHOOK_MAX_ATTEMPTS attempts, the first of them now.
+func handleRedeliver(c *gin.Context) {
+    ctx := c.Request.Context()
+    id := c.Param("id")
+    d, err := loadOutbox(ctx, id)
+    if err == redis.Nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Delivery not found"})
+        return
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if d.State != outboxFailed {
+        c.JSON(http.StatusConflict, gin.H{"error": "Only failed deliveries can be redelivered", "state": d.State})
+        return
+    }
+    d.State, d.FailedAt = outboxPending, ""
+    d.MaxAttempts = len(d.Attempts) + cfg().WebhookMaxAttempts
+    pipe := rdb.TxPipeline()
+    saveOutbox(pipe, *d)
+    pipe.ZRem(ctx, outboxFailedKey, id)
+    pipe.ZAdd(ctx, outboxKey, &redis.Z{Score: float64(time.Now().Add(outboxClaimTTL).UnixMilli()), Member: id})
+    if _, err := pipe.Exec(ctx); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    go attemptDelivery(id)
+    c.JSON(http.StatusAccepted, gin.H{"id": id, "state": outboxPending})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// waitAttempts waits for delivery id to have been attempted n times.
+func waitAttempts(t *testing.T, id string, n int) *outboxDelivery {
+    t.Helper()
+    for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+        if d, err := loadOutbox(ctx, id); err == nil && len(d.Attempts) >= n && d.State != "" {
+            return d
+        }
+    }
+    t.Fatalf("delivery %s never reached %d attempts", id, n)
+    return nil
+}
+
+// retryDeliveries makes every queued delivery due and runs one poll.
+func retryDeliveries(t *testing.T) {
+    t.Helper()
+    ids := rdb.ZRange(ctx, outboxKey, 0, -1).Val()
+    for _, id := range ids {
+        rdb.ZAdd(ctx, outboxKey, &redis.Z{Score: 0, Member: id})
+    }
+    drainOutbox()
+}
+
+// outboxHook registers a webhook of owner acme for job.completed that posts
+// to a server answering *code, and returns the hook.
+func outboxHook(t *testing.T, code *int32, calls *int32) webhook {
+    t.Helper()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        atomic.AddInt32(calls, 1)
+        w.WriteHeader(int(atomic.LoadInt32(code)))
+    }))
+    t.Cleanup(srv.Close)
+    w := webhook{ID: "hook1", OwnerID: "apikey:acme", URL: srv.URL, Events: []string{"job.completed"}, ContentType: defaultWebhookContentType}
+    if err := saveWebhook(ctx, w); err != nil {
+        t.Fatal(err)
+    }
+    return w
+}
+
+func onlyDelivery(t *testing.T) string {
+    t.Helper()
+    for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+        if keys := rdb.Keys(ctx, "outbox:*").Val(); len(keys) == 1 {
+            return keys[0][len("outbox:"):]
+        }
+    }
+    t.Fatal("no single delivery in the outbox")
+    return ""
+}
+
+func TestOutboxRetriesAndRedelivers(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.AdminToken = "secret"
+        c.WebhookAllowPrivate = true
+        c.WebhookMaxAttempts = 2
+    })
+    code, calls := int32(http.StatusServiceUnavailable), int32(0)
+    outboxHook(t, &code, &calls)
+    r := newRouter()
+
+    fireWebhooks("apikey:acme", "job.completed", "job1", map[string]interface{}{"ok": true})
+    id := onlyDelivery(t)
+    d := waitAttempts(t, id, 1)
+    if d.State != outboxPending || d.NextAttemptAt == "" {
+        t.Fatalf("after one failure: %+v, want pending with a next attempt", d)
+    }
+    retryDeliveries(t)
+    d, _ = loadOutbox(ctx, id)
+    if d.State != outboxFailed || len(d.Attempts) != 2 {
+        t.Fatalf("after two failures: %+v, want failed", d)
+    }
+    for _, a := range d.Attempts {
+        if a.ResponseStatus != http.StatusServiceUnavailable || a.Error == "" {
+            t.Errorf("attempt %+v, want the 503 recorded", a)
+        }
+    }
+    if rdb.ZScore(ctx, outboxKey, id).Err() != redis.Nil {
+        t.Error("failed delivery still queued")
+    }
+
+    w := do(r, http.MethodGet, "/admin/webhooks/failed", "", "Authorization", "Bearer secret")
+    var list struct {
+        Deliveries []outboxDelivery `json:"deliveries"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &list)
+    if w.Code != http.StatusOK || len(list.Deliveries) != 1 || list.Deliveries[0].ID != id || list.Deliveries[0].WebhookID != "hook1" {
+        t.Fatalf("GET /admin/webhooks/failed = %d %s", w.Code, w.Body)
+    }
+
+    atomic.StoreInt32(&code, http.StatusOK)
+    if w := do(r, http.MethodPost, "/admin/webhooks/"+id+"/redeliver", "", "Authorization", "Bearer secret"); w.Code != http.StatusAccepted {
+        t.Fatalf("redeliver = %d %s, want 202", w.Code, w.Body)
+    }
+    d = waitAttempts(t, id, 3)
+    if d.State != outboxDelivered || d.Attempts[2].ResponseStatus != http.StatusOK {
+        t.Errorf("after redeliver: %+v, want delivered", d)
+    }
+    if n := rdb.ZCard(ctx, outboxFailedKey).Val(); n != 0 {
+        t.Errorf("%d failed deliveries listed, want 0", n)
+    }
+    if n := atomic.LoadInt32(&calls); n != 3 {
+        t.Errorf("%d POSTs, want 3", n)
+    }
+    // Each attempt is in the webhook's own delivery log too
+    if n := rdb.XLen(ctx, deliveriesKey("hook1")).Val(); n != 3 {
+        t.Errorf("%d logged deliveries, want 3", n)
+    }
+}
+
+func TestRedeliverOnlyFailed(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.AdminToken = "secret"
+        c.WebhookAllowPrivate = true
+    })
+    code, calls := int32(http.StatusOK), int32(0)
+    outboxHook(t, &code, &calls)
+    r := newRouter()
+    fireWebhooks("apikey:acme", "job.completed", "job1", nil)
+    id := onlyDelivery(t)
+    if d := waitAttempts(t, id, 1); d.State != outboxDelivered {
+        t.Fatalf("state = %s, want delivered", d.State)
+    }
+    if w := do(r, http.MethodPost, "/admin/webhooks/"+id+"/redeliver", "", "Authorization", "Bearer secret"); w.Code != http.StatusConflict {
+        t.Errorf("redeliver delivered = %d, want 409", w.Code)
+    }
+    if w := do(r, http.MethodPost, "/admin/webhooks/nope/redeliver", "", "Authorization", "Bearer secret"); w.Code != http.StatusNotFound {
+        t.Errorf("redeliver unknown = %d, want 404", w.Code)
+    }
+}
+
+func TestOutboxDropsDeletedWebhook(t *testing.T) {
+    setupTest(t, func(c *Config) { c.WebhookAllowPrivate = true })
+    id, err := enqueueDelivery(ctx, outboxDelivery{Kind: outboxWebhook, WebhookID: "gone", Event: "job.completed", Payload: "{}"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    attemptDelivery(id)
+    if d, _ := loadOutbox(ctx, id); d.State != outboxFailed || len(d.Attempts) != 1 {
+        t.Errorf("delivery = %+v, want failed at once", d)
+    }
+}
+
+func TestOutboxClaimIsExclusive(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    rdb.ZAdd(ctx, outboxKey, &redis.Z{Score: 0, Member: "d1"})
+    now := time.Now()
+    claim := func() []string {
+        ids, _ := claimOutbox.Run(ctx, rdb, []string{outboxKey}, now.UnixMilli(), now.Add(outboxClaimTTL).UnixMilli(), outboxBatch).StringSlice()
+        return ids
+    }
+    if got := claim(); len(got) != 1 {
+        t.Fatalf("first claim = %v, want [d1]", got)
+    }
+    if got := claim(); len(got) != 0 {
+        t.Errorf("second claim = %v, want nothing until the claim lapses", got)
+    }
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// While this key exists /quote and /upload turn jobs away. It lives in Redis
+// so every replica sees the same state; workers ignore it and keep draining.
+const intakePausedKey = "intake:paused"
+
+type intakePause struct {
+    Message  string `json:"message"`
+    PausedAt string `json:"paused_at"`
+}
+
+// currentPause returns the active pause, or nil when intake is open.
+func currentPause(ctx context.Context) (*intakePause, error) {
+    data, err := rdb.Get(ctx, intakePausedKey).Bytes()
+    if err == redis.Nil {
+        return nil, nil
+    } else if err != nil {
+        return nil, err
+    }
+    var p intakePause
+    if err := json.Unmarshal(data, &p); err != nil {
+        return nil, err
+    }
+    return &p, nil
+}
+
+// rejectWhenPaused answers 503 with Retry-After on submission routes while
+// intake is paused.
+func rejectWhenPaused(c *gin.Context) {
+    p, err := currentPause(c.Request.Context())
+    if err != nil || p == nil {
+        // As with backpressure, a failed check doesn't turn customers away
+        c.Next()
+        return
+    }
+    c.Header("Retry-After", strconv.Itoa(cfg().PausedRetryAfterSeconds))
+    c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+        "error":     p.Message,
+        "paused":    true,
+        "paused_at": p.PausedAt,
+    })
+}
+
+// handlePauseIntake stops accepting new jobs. The optional JSON body
+// {"message": "..."} overrides PAUSED_MESSAGE for this pause.
+func handlePauseIntake(c *gin.Context) {
+    var req struct {
+        Message string `json:"message"`
+    }
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&req); err != nil {
+            c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+            return
+        }
+    }
+    p := intakePause{
+        Message:  req.Message,
+        PausedAt: time.Now().UTC().Format(time.RFC3339),
+    }
+    if p.Message == "" {
+        p.Message = cfg().PausedMessage
+    }
+    data, _ := json.Marshal(p)
+    if err := rdb.Set(c.Request.Context(), intakePausedKey, data, 0).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"paused": true, "message": p.Message, "paused_at": p.PausedAt})
+}
+
+// handleResumeIntake reopens intake.
+func handleResumeIntake(c *gin.Context) {
+    if err := rdb.Del(c.Request.Context(), intakePausedKey).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"paused": false})
+}
+
+// handleHealthz reports Redis reachability and whether intake is paused. A
+// paused API is still healthy, so it answers 200.
+func handleHealthz(c *gin.Context) {
+    ctx := c.Request.Context()
+    if err := rdb.Ping(ctx).Err(); err != nil {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Redis unreachable"})
+        return
+    }
+    resp := gin.H{"status": "ok", "paused": false}
+    if p, err := currentPause(ctx); err == nil && p != nil {
+        resp["paused"] = true
+        resp["paused_at"] = p.PausedAt
+        resp["message"] = p.Message
+    }
+    online, lastSeen, err := workerLiveness(ctx)
+    resp["worker_online"] = online || err != nil
+    if !lastSeen.IsZero() {
+        resp["worker_last_seen"] = lastSeen.UTC().Format(time.RFC3339)
+    }
+    c.JSON(http.StatusOK, resp)
+}
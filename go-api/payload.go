@@ -0,0 +1,167 @@
+package main
+
+import "time"
+
+// payloadSchemaVersion is written to every job payload as "schema_version".
+// Bump it whenever the shape changes and add the matching step to
+// payloadUpgrades, so payloads still sitting in Redis can be read back.
+//
+// Version 0 is everything written before the field existed. Its oldest
+// shapes were {id, download_url, material, layer_height, infill, rush} from
+// /quote and {id, download_url, material, infill} from /upload; priority,
+// queue, nozzle, max_retries, deadline_seconds and submitted_at came later
+// and may each be missing. Version 2 added created_at, version 3
+// bed_adhesion.
+const payloadSchemaVersion = 3
+
+const (
+    defaultLayerHeight = 0.2
+    defaultInfill      = 15
+)
+
+// jobSpec holds what a submission decides about a job.
+type jobSpec struct {
+    ID          string
+    DownloadURL string
+    Material    string
+    LayerHeight float64
+    Infill      int
+    Rush        bool
+    Nozzle      float64
+    BedAdhesion string
+    Queue       string
+    Region      string
+    MaxRetries  int
+    Deadline    time.Duration
+    OwnerID     string
+    SubmitAt    *time.Time
+    CacheKey    string
+    Features    []string
+    CallbackURL string
+    // What /upload stored the model as, for deleting it with the job
+    StorageName string
+    // The job POST /jobs/:id/retry resubmitted this one for
+    RetryOf string
+    // Not part of the payload; registerCallback keeps it for signing
+    CallbackSecret string
+    // Not part of the payload either; registerNotifyEmail keeps it
+    NotifyEmail string
+}
+
+// newJobPayload is the one place job payloads are built.
+func newJobPayload(s jobSpec) map[string]interface{} {
+    now := time.Now()
+    job := map[string]interface{}{
+        "schema_version":   payloadSchemaVersion,
+        "id":               s.ID,
+        "download_url":     s.DownloadURL,
+        "material":         s.Material,
+        "layer_height":     s.LayerHeight,
+        "infill":           s.Infill,
+        "rush":             s.Rush,
+        "priority":         jobPriority(s.Rush),
+        "nozzle":           s.Nozzle,
+        "bed_adhesion":     s.BedAdhesion,
+        "queue":            s.Queue,
+        "max_retries":      s.MaxRetries,
+        "deadline_seconds": int(s.Deadline.Seconds()),
+        "submitted_at":     now.Unix(),
+        // The same instant for readers, such as workers timing the queue
+        "created_at": now.UTC().Format(time.RFC3339),
+    }
+    if s.OwnerID != "" {
+        job["owner_id"] = s.OwnerID
+    }
+    if s.Region != "" {
+        job["region"] = s.Region
+    }
+    if s.SubmitAt != nil {
+        job["submit_at"] = s.SubmitAt.UTC().Format(time.RFC3339)
+    }
+    if s.CallbackURL != "" {
+        job["callback_url"] = s.CallbackURL
+    }
+    if len(s.Features) > 0 {
+        job["features"] = s.Features
+    }
+    if s.StorageName != "" {
+        job["storage_name"] = s.StorageName
+    }
+    if s.RetryOf != "" {
+        job["retry_of"] = s.RetryOf
+    }
+    if s.CacheKey != "" {
+        job["cache_key"] = s.CacheKey
+        job["cache_ttl_seconds"] = int(cfg().SliceCacheTTL().Seconds())
+    }
+    return job
+}
+
+// payloadUpgrades[v] turns a version v payload into version v+1.
+var payloadUpgrades = []func(job map[string]interface{}){
+    // 0 -> 1: fill in every field an old writer could have left out
+    func(job map[string]interface{}) {
+        setDefault(job, "layer_height", defaultLayerHeight)
+        setDefault(job, "infill", defaultInfill)
+        setDefault(job, "rush", false)
+        rush, _ := job["rush"].(bool)
+        setDefault(job, "priority", jobPriority(rush))
+        setDefault(job, "nozzle", defaultNozzle)
+        setDefault(job, "queue", payloadQueue(job))
+        setDefault(job, "max_retries", jobMaxRetries(job))
+        setDefault(job, "deadline_seconds", int(jobDeadline(0).Seconds()))
+    },
+    // 1 -> 2: created_at is submitted_at, where there is one
+    func(job map[string]interface{}) {
+        if at, ok := job["submitted_at"].(float64); ok {
+            setDefault(job, "created_at", time.Unix(int64(at), 0).UTC().Format(time.RFC3339))
+        }
+    },
+    // 2 -> 3: earlier jobs were sliced with cfg.ini's skirt, not today's
+    // default brim
+    func(job map[string]interface{}) {
+        setDefault(job, "bed_adhesion", "skirt")
+    },
+}
+
+func setDefault(job map[string]interface{}, key string, value interface{}) {
+    if _, ok := job[key]; !ok {
+        job[key] = value
+    }
+}
+
+func payloadVersion(job map[string]interface{}) int {
+    v := 0
+    switch n := job["schema_version"].(type) {
+    case float64:
+        v = int(n)
+    case int:
+        v = n
+    }
+    if v < 0 {
+        return 0
+    }
+    return v
+}
+
+// upgradePayload brings a payload read back from Redis up to the current
+// version in place. Payloads from a newer API are left as they are.
+func upgradePayload(job map[string]interface{}) map[string]interface{} {
+    if job == nil {
+        return nil
+    }
+    for v := payloadVersion(job); v < payloadSchemaVersion; v++ {
+        payloadUpgrades[v](job)
+        job["schema_version"] = v + 1
+    }
+    return job
+}
+
+// readPayload decodes a payload read back from Redis and upgrades it.
+func readPayload(data []byte) (map[string]interface{}, error) {
+    var job map[string]interface{}
+    if err := unmarshalPayload(data, &job); err != nil {
+        return nil, err
+    }
+    return upgradePayload(job), nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+)
+
+// realisticPayload is a /upload job as the API writes it: most of its size
+// is the presigned download URL, whose session token and signature are
+// random and don't compress.
+func realisticPayload() map[string]interface{} {
+    rng := rand.New(rand.NewSource(1))
+    token := make([]byte, 600)
+    sig := make([]byte, 32)
+    rng.Read(token)
+    rng.Read(sig)
+    url := "https://slicer-uploads.s3.eu-central-1.amazonaws.com/uploads/6f1c2a9e-7d4b-4f0e-9a51-3c2d8e7b1f40.stl" +
+        "?X-Amz-Algorithm=AWS4-HMAC-SHA256" +
+        "&X-Amz-Credential=ASIAEXAMPLEKEY%2F20261014%2Feu-central-1%2Fs3%2Faws4_request" +
+        "&X-Amz-Date=20261014T120000Z&X-Amz-Expires=3600&X-Amz-SignedHeaders=host" +
+        "&X-Amz-Security-Token=" + base64.URLEncoding.EncodeToString(token) +
+        "&X-Amz-Signature=" + hex.EncodeToString(sig)
+    return newJobPayload(jobSpec{
+        ID:          "6f1c2a9e-7d4b-4f0e-9a51-3c2d8e7b1f40",
+        DownloadURL: url,
+        Material:    "PETG",
+        LayerHeight: 0.2,
+        Infill:      20,
+        Nozzle:      defaultNozzle,
+        Queue:       standardQueue,
+        MaxRetries:  3,
+        Deadline:    time.Hour,
+        OwnerID:     "apikey:acme",
+    })
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+    setupTest(t)
+    large := realisticPayload()
+    tests := []struct {
+        name       string
+        job        map[string]interface{}
+        compress   bool
+        compressed bool
+    }{
+        {"small stays plain", map[string]interface{}{"id": "j1", "material": "PLA"}, true, false},
+        {"large is gzipped", large, true, true},
+        {"compression off", large, false, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setupTest(t, func(c *Config) { c.PayloadCompression = tt.compress })
+            data := marshalPayload(tt.job)
+            if got := data[0] == gzipPayloadPrefix; got != tt.compressed {
+                t.Fatalf("compressed = %v, want %v", got, tt.compressed)
+            }
+
+            var back map[string]interface{}
+            if err := unmarshalPayload(data, &back); err != nil {
+                t.Fatal(err)
+            }
+            // Compare through JSON so ints and float64s line up
+            var want map[string]interface{}
+            plain, _ := json.Marshal(tt.job)
+            json.Unmarshal(plain, &want)
+            if !reflect.DeepEqual(back, want) {
+                t.Fatalf("round trip = %v, want %v", back, want)
+            }
+        })
+    }
+}
+
+func TestDecodePayloadRejectsCorruptGzip(t *testing.T) {
+    if _, err := decodePayload([]byte{gzipPayloadPrefix, 'n', 'o', 'p', 'e'}); err == nil {
+        t.Fatal("decodePayload accepted a corrupt gzip payload")
+    }
+}
+
+// BenchmarkPayload reports the stored size of a realistic payload with and
+// without compression, alongside the time to encode and decode it.
+func BenchmarkPayload(b *testing.B) {
+    setConfig(defaultConfig())
+    job := realisticPayload()
+    for _, compress := range []bool{false, true} {
+        name := "plain"
+        if compress {
+            name = "gzip"
+        }
+        setConfig(defaultConfig())
+        cfg().PayloadCompression = compress
+        data := marshalPayload(job)
+
+        b.Run(name+"/encode", func(b *testing.B) {
+            cfg().PayloadCompression = compress
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                marshalPayload(job)
+            }
+            b.ReportMetric(float64(len(data)), "stored-bytes")
+        })
+        b.Run(name+"/decode", func(b *testing.B) {
+            b.ReportAllocs()
+            var v map[string]interface{}
+            for i := 0; i < b.N; i++ {
+                unmarshalPayload(data, &v)
+            }
+            b.ReportMetric(float64(len(data)), "stored-bytes")
+        })
+    }
+}
+
+// TestUpgradeHistoricalPayloads reads one fixture per payload shape ever
+// written to the queues and checks each comes out in the current shape.
+func TestUpgradeHistoricalPayloads(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.QueueMap = map[string]string{"TPU": "print_jobs_flex"}
+    })
+    // Every field newJobPayload always writes, except submitted_at and the
+    // created_at made from it: the oldest payloads never recorded it and
+    // readers skip jobs without it
+    current := newJobPayload(jobSpec{})
+    delete(current, "submitted_at")
+    delete(current, "created_at")
+
+    tests := []struct {
+        file        string
+        maxRetries  float64
+        queue       string
+        layerHeight float64
+        // Jobs from before bed_adhesion were sliced with a skirt
+        adhesion string
+    }{
+        // The oldest /quote shape: rush picks the list
+        {"v0_quote.json", 2, "print_jobs:rush", 0.28, "skirt"},
+        // The oldest /upload shape had no layer_height or rush
+        {"v0_upload.json", 2, "print_jobs_flex", defaultLayerHeight, "skirt"},
+        // Later v0 writers already set the newer fields; keep them
+        {"v0_later_fields.json", 5, "print_jobs", 0.12, "skirt"},
+        {"v1.json", 1, "print_jobs_flex:rush", 0.16, "skirt"},
+        {"v2.json", 3, "print_jobs", 0.2, "skirt"},
+        {"v3.json", 3, "print_jobs", 0.2, "raft"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.file, func(t *testing.T) {
+            data, err := os.ReadFile(filepath.Join("testdata", "payloads", tt.file))
+            if err != nil {
+                t.Fatal(err)
+            }
+            // Store and read back the way requeue and the DLQ do
+            job, err := readPayload(data)
+            if err != nil {
+                t.Fatal(err)
+            }
+            job, err = readPayload(marshalPayload(job))
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            if v := payloadVersion(job); v != payloadSchemaVersion {
+                t.Errorf("schema_version = %d, want %d", v, payloadSchemaVersion)
+            }
+            for k := range current {
+                if _, ok := job[k]; !ok {
+                    t.Errorf("missing %q after upgrade", k)
+                }
+            }
+            if job["max_retries"] != tt.maxRetries {
+                t.Errorf("max_retries = %v, want %v", job["max_retries"], tt.maxRetries)
+            }
+            if job["queue"] != tt.queue {
+                t.Errorf("queue = %v, want %v", job["queue"], tt.queue)
+            }
+            if job["layer_height"] != tt.layerHeight {
+                t.Errorf("layer_height = %v, want %v", job["layer_height"], tt.layerHeight)
+            }
+            if job["bed_adhesion"] != tt.adhesion {
+                t.Errorf("bed_adhesion = %v, want %s", job["bed_adhesion"], tt.adhesion)
+            }
+            if at, ok := job["submitted_at"].(float64); ok {
+                if want := time.Unix(int64(at), 0).UTC().Format(time.RFC3339); job["created_at"] != want {
+                    t.Errorf("created_at = %v, want %s from submitted_at", job["created_at"], want)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// nozzleSizes are the nozzle diameters, in millimetres, PrusaSlicer has
+// profiles for; a job may ask for any of them, and routeJob then finds a
+// worker whose printer has it.
+var nozzleSizes = []float64{0.25, 0.4, 0.6, 0.8}
+
+// bedAdhesions are the bed_adhesion values, passed to the worker as they
+// are.
+var bedAdhesions = []string{"none", "brim", "raft", "skirt"}
+
+// defaultBedAdhesion is what a job without bed_adhesion is printed with.
+// Jobs from before the field existed were sliced with the worker's plain
+// skirt, which the payload upgrade records for them instead.
+const defaultBedAdhesion = "brim"
+
+func validNozzle(nozzle float64) bool {
+    for _, n := range nozzleSizes {
+        if math.Abs(n-nozzle) < nozzleTolerance {
+            return true
+        }
+    }
+    return false
+}
+
+func validBedAdhesion(adhesion string) bool {
+    for _, a := range bedAdhesions {
+        if a == adhesion {
+            return true
+        }
+    }
+    return false
+}
+
+// checkPrintSettings is the 400 message for a nozzle or bed_adhesion
+// outside the allowed sets, which the caller has already defaulted.
+func checkPrintSettings(nozzle float64, adhesion string) error {
+    if !validNozzle(nozzle) {
+        sizes := make([]string, len(nozzleSizes))
+        for i, n := range nozzleSizes {
+            sizes[i] = strconv.FormatFloat(n, 'f', -1, 64)
+        }
+        return fmt.Errorf("nozzle must be one of %s (mm)", strings.Join(sizes, ", "))
+    }
+    if !validBedAdhesion(adhesion) {
+        return fmt.Errorf("bed_adhesion must be one of %s", strings.Join(bedAdhesions, ", "))
+    }
+    return nil
+}
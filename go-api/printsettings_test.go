@@ -0,0 +1,85 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+
+    "slicer-api/internal/api"
+)
+
+func TestQuotePrintSettings(t *testing.T) {
+    setupTest(t, func(c *Config) { c.DuplicateWindowSeconds = 0 })
+    r := newRouter()
+
+    code, id, _ := quoteJobID(t, r, `{"download_url":"https://example.com/a.stl","infill":20}`)
+    if code != http.StatusAccepted {
+        t.Fatalf("submit = %d", code)
+    }
+    raw, _ := rdb.Get(ctx, "params:"+id).Bytes()
+    if payload, _ := readPayload(raw); payload["nozzle"] != 0.4 || payload["bed_adhesion"] != "brim" {
+        t.Errorf("payload = %v, want a 0.4mm nozzle and a brim", payload)
+    }
+    code, id, _ = quoteJobID(t, r, `{"download_url":"https://example.com/a.stl","infill":20,"nozzle":0.25,"bed_adhesion":"none"}`)
+    raw, _ = rdb.Get(ctx, "params:"+id).Bytes()
+    if payload, _ := readPayload(raw); code != http.StatusAccepted || payload["nozzle"] != 0.25 || payload["bed_adhesion"] != "none" {
+        t.Errorf("submit = %d, payload %v; want the settings passed through", code, payload)
+    }
+
+    for _, body := range []string{
+        `{"download_url":"https://example.com/a.stl","infill":20,"nozzle":0.5}`,
+        `{"download_url":"https://example.com/a.stl","infill":20,"bed_adhesion":"glue"}`,
+    } {
+        if code, _, _ := quoteJobID(t, r, body); code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", body, code)
+        }
+    }
+}
+
+func TestEstimatePrintSettings(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    cube := binarySTL(cubeTriangles(40))
+
+    estimate := func(fields ...string) api.EstimateResponse {
+        t.Helper()
+        w := postEstimate(r, "cube.stl", cube, "PETG", fields...)
+        if w.Code != http.StatusOK {
+            t.Fatalf("%v: status = %d %s", fields, w.Code, w.Body)
+        }
+        var resp api.EstimateResponse
+        json.Unmarshal(w.Body.Bytes(), &resp)
+        return resp
+    }
+
+    // 40mm cube of PETG, 81.28g on its own
+    for _, tt := range []struct {
+        adhesion string
+        grams    float64
+        cost     float64
+    }{
+        {"none", 0, 2.28},
+        // 176mm around, three layers of one line
+        {"skirt", 0.06, 2.28},
+        {"brim", 0.23, 2.28},
+        // 43mm square, three layers at 90%
+        {"raft", 1.27, 2.31},
+    } {
+        resp := estimate("bed_adhesion", tt.adhesion)
+        if resp.BedAdhesion != tt.adhesion || resp.AdhesionWeightGrams != tt.grams || resp.Cost != tt.cost || resp.WeightGrams != 81.28 {
+            t.Errorf("%s: %+v, want %vg of adhesion costing %v in all", tt.adhesion, resp, tt.grams, tt.cost)
+        }
+    }
+
+    slow := estimate("bed_adhesion", "none", "nozzle", "0.4").EstimatedPrintTimeSeconds
+    fast := estimate("bed_adhesion", "none", "nozzle", "0.8").EstimatedPrintTimeSeconds
+    if slow != 12800 || fast != 3200 {
+        t.Errorf("print time = %ds at 0.4mm, %ds at 0.8mm; want 12800 and a quarter of it", slow, fast)
+    }
+
+    for _, fields := range [][]string{{"nozzle", "0.5"}, {"nozzle", "wide"}, {"bed_adhesion", "glue"}} {
+        if w := postEstimate(r, "cube.stl", cube, "PETG", fields...); w.Code != http.StatusBadRequest {
+            t.Errorf("%v: status = %d, want 400", fields, w.Code)
+        }
+    }
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Admin requests may name the operator in X-Operator-ID; reorders record it
+// in priority_override:{id} alongside the audit event.
+const operatorHeader = "X-Operator-ID"
+
+type priorityOverride struct {
+    Action   string `json:"action"`
+    Operator string `json:"operator"`
+    From     string `json:"from"`
+    To       string `json:"to"`
+    At       string `json:"at"`
+}
+
+func operatorOf(c *gin.Context) string {
+    if op := strings.TrimSpace(c.GetHeader(operatorHeader)); op != "" {
+        return op
+    }
+    return "admin"
+}
+
+// POST /admin/jobs/:id/prioritize moves a queued job to the head of its list,
+// or with ?to=rush onto the head of the rush list. Only the placement and
+// priority change: the rush flag drives pricing, so the customer's quote is
+// left as it was. Only the legacy lists have an order to change; stream
+// entries are delivered as they were added.
+func handlePrioritize(c *gin.Context) {
+    reorderJob(c, "prioritized", func(from string, job map[string]interface{}) string {
+        if c.Query("to") != "rush" {
+            return from
+        }
+        material, _ := job["material"].(string)
+        region, _ := job["region"].(string)
+        job["priority"] = jobPriority(true)
+        return queueFor(material, region, true)
+    })
+}
+
+// POST /admin/jobs/:id/deprioritize moves a queued job to the tail of the
+// standard list, off the rush list if it was there. As with prioritize the
+// rush flag and so the price stay as they were.
+func handleDeprioritize(c *gin.Context) {
+    reorderJob(c, "deprioritized", func(from string, job map[string]interface{}) string {
+        job["priority"] = jobPriority(false)
+        return strings.TrimSuffix(from, ":rush")
+    })
+}
+
+// reorderJob takes a queued job off its list and puts it back on the list
+// target picks: at the head when prioritizing, at the tail otherwise.
+func reorderJob(c *gin.Context, action string, target func(from string, job map[string]interface{}) string) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    if !legacyListQueue() {
+        c.JSON(http.StatusConflict, api.ErrorResponse{Error: "Reordering needs LEGACY_LIST_QUEUE"})
+        return
+    }
+
+    payload, err := rdb.Get(ctx, "params:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    job, err := readPayload([]byte(payload))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Unreadable job payload"})
+        return
+    }
+    from := payloadQueue(job)
+
+    // LREM is the claim: if a worker popped the job first there is nothing
+    // left to move
+    removed, err := rdb.LRem(ctx, from, 1, payload).Result()
+    if err == nil && removed == 0 && cfg().FairScheduling {
+        // Still waiting for the dispatcher: skip the rotation too
+        owner, _ := job["owner_id"].(string)
+        removed, err = rdb.LRem(ctx, fairListKey(from, submitterOf(owner)), 1, payload).Result()
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if removed == 0 {
+        c.JSON(http.StatusConflict, api.ErrorResponse{Error: "Job is no longer queued"})
+        return
+    }
+
+    to := target(from, job)
+    job["queue"] = to
+    jsonData := marshalPayload(job)
+    override, _ := json.Marshal(priorityOverride{
+        Action:   action,
+        Operator: operatorOf(c),
+        From:     from,
+        To:       to,
+        At:       time.Now().UTC().Format(time.RFC3339),
+    })
+    pipe := rdb.TxPipeline()
+    if action == "prioritized" {
+        pipe.LPush(ctx, to, jsonData)
+    } else {
+        pipe.RPush(ctx, to, jsonData)
+    }
+    pipe.Set(ctx, "params:"+jobID, jsonData, 24*time.Hour)
+    pipe.Set(ctx, "priority_override:"+jobID, override, 24*time.Hour)
+    if _, err := pipe.Exec(ctx); err != nil {
+        rdb.RPush(ctx, from, payload)
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to requeue job"})
+        return
+    }
+
+    place := "head"
+    if action != "prioritized" {
+        place = "tail"
+    }
+    recordHistory(ctx, jobID, action, "moved to the "+place+" of "+to)
+    owner, _ := job["owner_id"].(string)
+    event := auditEventFor(c, auditJobReordered, jobID, owner)
+    event.Before, event.After = from, to
+    audit.Record(ctx, event)
+
+    position, _ := queuePosition(ctx, jobID)
+    c.JSON(http.StatusOK, gin.H{"job_id": jobID, "queue": to, "position": position, "operator": operatorOf(c)})
+}
+
+// GET /jobs/:id/position reports where a queued job waits: index is its
+// 0-based place on the list it is in, position how many jobs a worker takes
+// before it, counting the rush list ahead, plus one.
+func handleJobPosition(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    status, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if status != "queued" {
+        c.JSON(http.StatusConflict, gin.H{"error": "Job is not queued", "status": status})
+        return
+    }
+    payload, err := rdb.Get(ctx, "params:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    job, err := readPayload([]byte(payload))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Unreadable job payload"})
+        return
+    }
+
+    queue := payloadQueue(job)
+    idx, found, err := queueIndex(ctx, queue, payload)
+    if err == nil && !found {
+        // Not dispatched yet: its place is on the submitter's fair list
+        owner, _ := job["owner_id"].(string)
+        queue = fairListKey(queue, submitterOf(owner))
+        idx, err = rdb.LPos(ctx, queue, payload, redis.LPosArgs{}).Result()
+        found = err == nil
+        if err == redis.Nil {
+            err = nil
+        }
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if !found {
+        // Taken by a worker, or backing off before a retry
+        c.JSON(http.StatusConflict, api.ErrorResponse{Error: "Job is not waiting in a queue right now"})
+        return
+    }
+    position, _ := queuePosition(ctx, jobID)
+    c.JSON(http.StatusOK, gin.H{"job_id": jobID, "queue": queue, "index": idx, "position": position})
+}
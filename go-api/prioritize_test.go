@@ -0,0 +1,86 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+)
+
+func TestPrioritizeToRushKeepsPricing(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    data, _ := json.Marshal(map[string]interface{}{"id": "j1", "rush": false, "priority": jobPriority(false)})
+    enqueue(ctx, standardQueue, "j1", data)
+
+    w := do(newRouter(), http.MethodPost, "/admin/jobs/j1/prioritize?to=rush", "", "Authorization", "Bearer secret")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+    var job map[string]interface{}
+    json.Unmarshal([]byte(rdb.Get(ctx, "params:j1").Val()), &job)
+    if job["rush"] != false {
+        t.Errorf("rush = %v, want false", job["rush"])
+    }
+    if job["priority"] != "rush" || job["queue"] != rushQueueFor(standardQueue) {
+        t.Errorf("priority, queue = %v, %v; want rush, %s", job["priority"], job["queue"], rushQueueFor(standardQueue))
+    }
+    if pos, _ := queuePosition(ctx, "j1"); pos != 1 {
+        t.Errorf("queuePosition = %d, want 1 on the rush list", pos)
+    }
+}
+
+func TestDeprioritizeMovesToStandardTail(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    rush := rushQueueFor(standardQueue)
+    enqueue(ctx, rush, "j1", marshalPayload(map[string]interface{}{"id": "j1", "rush": true, "queue": rush}))
+    enqueue(ctx, standardQueue, "j2", marshalPayload(map[string]interface{}{"id": "j2", "queue": standardQueue}))
+
+    w := do(newRouter(), http.MethodPost, "/admin/jobs/j1/deprioritize", "", "Authorization", "Bearer secret", operatorHeader, "ops-7")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+    if n := rdb.LLen(ctx, rush).Val(); n != 0 {
+        t.Errorf("rush list still holds %d jobs", n)
+    }
+    tail, _ := readPayload([]byte(rdb.LIndex(ctx, standardQueue, -1).Val()))
+    if tail["id"] != "j1" || tail["rush"] != true {
+        t.Errorf("tail of %s = %v; want j1 with its rush flag kept", standardQueue, tail)
+    }
+
+    var override priorityOverride
+    json.Unmarshal([]byte(rdb.Get(ctx, "priority_override:j1").Val()), &override)
+    if override.Action != "deprioritized" || override.Operator != "ops-7" || override.To != standardQueue {
+        t.Errorf("priority_override = %+v; want deprioritized by ops-7 to %s", override, standardQueue)
+    }
+    events, _ := rdb.XRange(ctx, auditStream, "-", "+").Result()
+    if len(events) != 1 || events[0].Values["event_type"] != auditJobReordered {
+        t.Errorf("audit events = %v; want one %s", events, auditJobReordered)
+    }
+}
+
+func TestJobPosition(t *testing.T) {
+    setupTest(t, func(c *Config) { c.FairScheduling = false })
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    for _, id := range []string{"j1", "j2", "j3"} {
+        enqueue(ctx, standardQueue, id, marshalPayload(map[string]interface{}{"id": id, "queue": standardQueue}))
+        rdb.Set(ctx, "status:"+id, "queued", 0)
+    }
+    r := newRouter()
+
+    var got struct {
+        Queue    string `json:"queue"`
+        Index    int64  `json:"index"`
+        Position int64  `json:"position"`
+    }
+    w := do(r, http.MethodGet, "/jobs/j3/position", "")
+    json.Unmarshal(w.Body.Bytes(), &got)
+    if w.Code != http.StatusOK || got.Queue != standardQueue || got.Index != 2 || got.Position != 3 {
+        t.Fatalf("status = %d, body %s; want j3 at index 2, position 3 of %s", w.Code, w.Body, standardQueue)
+    }
+
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    if w := do(r, http.MethodGet, "/jobs/j1/position", ""); w.Code != http.StatusConflict {
+        t.Errorf("processing job: status = %d, want 409", w.Code)
+    }
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// progress:{id} holds the worker's latest report while a job is processing,
+// as {"stage": "slicing", "percent": 40, "updated_at": <unix seconds>}.
+// Workers without the internal API write it themselves, so readers take
+// whatever is there and treat a missing or unreadable blob as no progress.
+type jobProgress struct {
+    Stage     string `json:"stage"`
+    Percent   int    `json:"percent"`
+    UpdatedAt int64  `json:"updated_at"`
+}
+
+const (
+    // progressStaleAfter flags a report in /status once no newer one has
+    // arrived for this long; slicing a large model can take a while
+    progressStaleAfter = 10 * time.Minute
+    // progressLinger is how long progress:{id} outlives the job finishing
+    progressLinger = 5 * time.Minute
+)
+
+func progressKey(jobID string) string {
+    return "progress:" + jobID
+}
+
+// progress_history:{id} is a stream of the job's progress reports, oldest
+// first, for drawing a progress curve. Each entry's "progress" field is a
+// progress:{id} value; the newest progressHistoryMax are kept.
+func progressHistoryKey(jobID string) string {
+    return "progress_history:" + jobID
+}
+
+const progressHistoryMax = 100
+
+// progressHistoryPoll is how often reports are copied into the histories;
+// a var so tests needn't wait for it.
+var progressHistoryPoll = 2 * time.Second
+
+// appendProgressHistory adds KEYS[1], the job's current progress, to its
+// history KEYS[2] unless it is the last entry already, trimming it to
+// ARGV[1] entries and giving it the TTL ARGV[2]. It returns 1 when it
+// added one.
+var appendProgressHistory = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+    return 0
+end
+local last = redis.call('XREVRANGE', KEYS[2], '+', '-', 'COUNT', 1)
+if last[1] and last[1][2][2] == raw then
+    return 0
+end
+redis.call('XADD', KEYS[2], 'MAXLEN', ARGV[1], '*', 'progress', raw)
+redis.call('EXPIRE', KEYS[2], ARGV[2])
+return 1
+`)
+
+// recordProgressHistory copies jobID's current progress into its history.
+func recordProgressHistory(ctx context.Context, jobID string) error {
+    ttl := int(jobTTL(ctx, jobID).Seconds())
+    return appendProgressHistory.Run(ctx, rdb, []string{progressKey(jobID), progressHistoryKey(jobID)}, progressHistoryMax, ttl).Err()
+}
+
+// copyProgressHistories records every job's latest progress. The API does
+// it as it stores a report, so this catches the workers that write
+// progress:{id} to Redis themselves. The script skips reports already
+// copied, so every replica may run it.
+func copyProgressHistories(ctx context.Context) {
+    iter := rdb.Scan(ctx, 0, progressKey("*"), 500).Iterator()
+    for iter.Next(ctx) {
+        jobID := iter.Val()[len(progressKey("")):]
+        if err := recordProgressHistory(ctx, jobID); err != nil {
+            log.Printf("progress: copying %s into its history: %v", jobID, err)
+        }
+    }
+}
+
+// startProgressHistory copies reports into the histories every
+// progressHistoryPoll.
+func startProgressHistory() {
+    go func() {
+        for range time.Tick(progressHistoryPoll) {
+            copyProgressHistories(ctx)
+        }
+    }()
+}
+
+func newProgress(stage string, percent int) []byte {
+    data, _ := json.Marshal(jobProgress{Stage: stage, Percent: percent, UpdatedAt: time.Now().Unix()})
+    return data
+}
+
+// parseProgress reads a progress:{id} value; false if it isn't one.
+func parseProgress(raw string) (jobProgress, bool) {
+    var p jobProgress
+    if raw == "" || json.Unmarshal([]byte(raw), &p) != nil {
+        return p, false
+    }
+    if _, _, ok := progressRange(p.Stage); !ok || p.Percent < 0 || p.Percent > 100 {
+        return p, false
+    }
+    return p, true
+}
+
+// jobStep is one stage of processing and the progress_percent range a
+// worker may report while in it: from its own floor up to the next step's.
+type jobStep struct {
+    name  string
+    floor int
+}
+
+// jobSteps are the steps a worker may report, in the order it goes through
+// them.
+var jobSteps = []jobStep{
+    {"downloading", 0},
+    {"parsing", 10},
+    {"slicing", 25},
+    {"pricing", 80},
+    {"post_processing", 85},
+    {"uploading_result", 95},
+}
+
+// progressRange returns the progress_percent bounds for step; an empty step
+// allows the whole range.
+func progressRange(step string) (int, int, bool) {
+    if step == "" {
+        return 0, 100, true
+    }
+    for i, s := range jobSteps {
+        if s.name != step {
+            continue
+        }
+        if i+1 < len(jobSteps) {
+            return s.floor, jobSteps[i+1].floor, true
+        }
+        return s.floor, 100, true
+    }
+    return 0, 0, false
+}
+
+// checkProgress validates a step and progress pair a worker reported.
+// progress is nil when only the step changed.
+func checkProgress(step string, progress *int) error {
+    lo, hi, ok := progressRange(step)
+    if !ok {
+        return fmt.Errorf("unknown step %s", step)
+    }
+    if progress != nil && (*progress < lo || *progress > hi) {
+        if step == "" {
+            return fmt.Errorf("progress_percent must be between %d and %d", lo, hi)
+        }
+        return fmt.Errorf("progress_percent during %s must be between %d and %d", step, lo, hi)
+    }
+    return nil
+}
+
+// GET /jobs/:id/progress returns the job's progress reports, oldest first,
+// as [{"step", "percent", "at"}], up to the latest 100. A job that never
+// reported progress has none; an unknown or expired one gets 404.
+func handleJobProgress(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    pipe := rdb.Pipeline()
+    status := pipe.Get(ctx, "status:"+jobID)
+    entries := pipe.XRange(ctx, progressHistoryKey(jobID), "-", "+")
+    pipe.Exec(ctx)
+    if err := entries.Err(); err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if status.Val() == "" {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+
+    progress := make([]gin.H, 0, len(entries.Val()))
+    for _, e := range entries.Val() {
+        raw, _ := e.Values["progress"].(string)
+        if p, ok := parseProgress(raw); ok {
+            progress = append(progress, gin.H{
+                "step":    p.Stage,
+                "percent": p.Percent,
+                "at":      time.Unix(p.UpdatedAt, 0).UTC().Format(time.RFC3339),
+            })
+        }
+    }
+    c.JSON(http.StatusOK, gin.H{"job_id": jobID, "status": status.Val(), "progress": progress})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "testing"
+    "time"
+)
+
+// stubWorkerProgress writes progress:{id} the way worker.py's report_step does
+// when it has no internal API to report through. Both sides must agree on
+// this shape.
+func stubWorkerProgress(t *testing.T, jobID, stage string, percent int, at time.Time) {
+    t.Helper()
+    blob := `{"stage": "` + stage + `", "percent": ` + strconv.Itoa(percent) + `, "updated_at": ` + strconv.FormatInt(at.Unix(), 10) + `}`
+    if err := rdb.Set(ctx, "progress:"+jobID, blob, 24*time.Hour).Err(); err != nil {
+        t.Fatal(err)
+    }
+}
+
+type progressFields struct {
+    CurrentStep     string `json:"current_step"`
+    ProgressPercent *int   `json:"progress_percent"`
+    UpdatedAt       string `json:"progress_updated_at"`
+    Stale           *bool  `json:"progress_stale"`
+}
+
+func statusProgress(t *testing.T, h http.Handler, jobID string) progressFields {
+    t.Helper()
+    w := do(h, http.MethodGet, "/status/"+jobID, "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("/status: %d %s", w.Code, w.Body)
+    }
+    var got progressFields
+    json.Unmarshal(w.Body.Bytes(), &got)
+    return got
+}
+
+func reportStatus(t *testing.T, h http.Handler, jobID, body string) int {
+    t.Helper()
+    w := do(h, http.MethodPost, "/internal/jobs/"+jobID+"/status", body, "X-Internal-Signature", "sha256="+signBody("s", []byte(body)))
+    return w.Code
+}
+
+func TestStepProgressInStatus(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "queued", 0)
+
+    if code := reportStatus(t, r, "j1", `{"status":"processing","step":"slicing"}`); code != http.StatusOK {
+        t.Fatalf("step report: status = %d, want 200", code)
+    }
+    if code := reportStatus(t, r, "j1", `{"status":"processing","progress_percent":60}`); code != http.StatusOK {
+        t.Fatalf("progress report: status = %d, want 200", code)
+    }
+
+    var got struct {
+        CurrentStep     string `json:"current_step"`
+        ProgressPercent *int   `json:"progress_percent"`
+    }
+    w := do(r, http.MethodGet, "/status/j1", "")
+    json.Unmarshal(w.Body.Bytes(), &got)
+    if got.CurrentStep != "slicing" || got.ProgressPercent == nil || *got.ProgressPercent != 60 {
+        t.Fatalf("status body %s; want current_step slicing at 60%%", w.Body)
+    }
+
+    if code := reportStatus(t, r, "j1", `{"status":"completed","result":{"price":1}}`); code != http.StatusOK {
+        t.Fatalf("completion: status = %d, want 200", code)
+    }
+    got.CurrentStep, got.ProgressPercent = "", nil
+    w = do(r, http.MethodGet, "/status/j1", "")
+    json.Unmarshal(w.Body.Bytes(), &got)
+    if got.CurrentStep != "" || got.ProgressPercent != nil {
+        t.Errorf("completed job still reports progress: %s", w.Body)
+    }
+}
+
+func TestStepProgressValidation(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    stubWorkerProgress(t, "j1", "downloading", 0, time.Now())
+
+    tests := []struct {
+        name string
+        body string
+        want int
+    }{
+        {"unknown step", `{"status":"processing","step":"mining"}`, http.StatusBadRequest},
+        {"outside the step's range", `{"status":"processing","step":"parsing","progress_percent":50}`, http.StatusBadRequest},
+        {"outside the stored step's range", `{"status":"processing","progress_percent":20}`, http.StatusBadRequest},
+        {"over 100", `{"status":"processing","step":"uploading_result","progress_percent":101}`, http.StatusBadRequest},
+        {"step with a final status", `{"status":"completed","step":"slicing"}`, http.StatusBadRequest},
+        {"last step at 100", `{"status":"processing","step":"uploading_result","progress_percent":100}`, http.StatusOK},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if code := reportStatus(t, r, "j1", tt.body); code != tt.want {
+                t.Errorf("status = %d, want %d", code, tt.want)
+            }
+        })
+    }
+}
+
+func TestStatusMergesWorkerProgress(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    stubWorkerProgress(t, "j1", "pricing", 82, time.Now())
+    got := statusProgress(t, r, "j1")
+    if got.CurrentStep != "pricing" || got.ProgressPercent == nil || *got.ProgressPercent != 82 {
+        t.Fatalf("progress = %+v, want pricing at 82%%", got)
+    }
+    if got.UpdatedAt == "" || got.Stale == nil || *got.Stale {
+        t.Fatalf("progress = %+v, want a fresh report with its time", got)
+    }
+
+    stubWorkerProgress(t, "j1", "slicing", 40, time.Now().Add(-progressStaleAfter-time.Minute))
+    if got := statusProgress(t, r, "j1"); got.Stale == nil || !*got.Stale || got.CurrentStep != "slicing" {
+        t.Fatalf("progress = %+v, want the old report flagged stale", got)
+    }
+}
+
+func TestStatusToleratesBadProgress(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    for _, raw := range []string{"", "60", `{"stage":"mining","percent":10}`, `{"stage":"slicing","percent":400}`} {
+        rdb.Set(ctx, "progress:j1", raw, 0)
+        if got := statusProgress(t, r, "j1"); got.CurrentStep != "" || got.ProgressPercent != nil {
+            t.Errorf("progress %q shown as %+v", raw, got)
+        }
+    }
+}
+
+func TestProgressExpiresAfterCompletion(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    stubWorkerProgress(t, "j1", "post_processing", 90, time.Now())
+
+    if code := reportStatus(t, r, "j1", `{"status":"completed","result":{"price":1}}`); code != http.StatusOK {
+        t.Fatalf("completion: status = %d, want 200", code)
+    }
+    if ttl := rdb.TTL(ctx, "progress:j1").Val(); ttl <= 0 || ttl > progressLinger {
+        t.Fatalf("progress TTL = %v, want at most %v", ttl, progressLinger)
+    }
+}
+
+func patchProgress(t *testing.T, h http.Handler, jobID, body string) int {
+    t.Helper()
+    w := do(h, http.MethodPatch, "/internal/jobs/"+jobID+"/progress", body, "X-Internal-Signature", "sha256="+signBody("s", []byte(body)))
+    return w.Code
+}
+
+func TestPatchProgress(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", time.Hour)
+    rdb.Set(ctx, "status:j2", "queued", time.Hour)
+
+    tests := []struct {
+        name string
+        job  string
+        body string
+        want int
+    }{
+        {"no percent", "j1", `{"step":"slicing"}`, http.StatusBadRequest},
+        {"not an integer", "j1", `{"percent":42.5}`, http.StatusBadRequest},
+        {"over 100", "j1", `{"percent":101}`, http.StatusUnprocessableEntity},
+        {"negative", "j1", `{"percent":-1}`, http.StatusUnprocessableEntity},
+        {"unknown step", "j1", `{"percent":42,"step":"mining"}`, http.StatusBadRequest},
+        {"outside the step's range", "j1", `{"percent":90,"step":"slicing"}`, http.StatusUnprocessableEntity},
+        {"not processing", "j2", `{"percent":42,"step":"slicing"}`, http.StatusConflict},
+        {"unknown job", "nope", `{"percent":42,"step":"slicing"}`, http.StatusNotFound},
+        {"in the step's range", "j1", `{"percent":42,"step":"slicing"}`, http.StatusOK},
+        {"within the stored step", "j1", `{"percent":60}`, http.StatusOK},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if code := patchProgress(t, r, tt.job, tt.body); code != tt.want {
+                t.Errorf("status = %d, want %d", code, tt.want)
+            }
+        })
+    }
+
+    if got := statusProgress(t, r, "j1"); got.CurrentStep != "slicing" || got.ProgressPercent == nil || *got.ProgressPercent != 60 {
+        t.Errorf("progress = %+v, want slicing at 60%%", got)
+    }
+    if ttl := rdb.TTL(ctx, progressKey("j1")).Val(); ttl <= 0 || ttl > time.Hour {
+        t.Errorf("progress TTL = %s, want the job's", ttl)
+    }
+}
+
+func TestProgressHistory(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", time.Hour)
+
+    patchProgress(t, r, "j1", `{"percent":30,"step":"slicing"}`)
+    reportStatus(t, r, "j1", `{"status":"processing","progress_percent":50}`)
+    // A worker writing to Redis itself is picked up by the copier, once
+    stubWorkerProgress(t, "j1", "pricing", 82, time.Now())
+    copyProgressHistories(ctx)
+    copyProgressHistories(ctx)
+
+    w := do(r, http.MethodGet, "/jobs/j1/progress", "")
+    var got struct {
+        Progress []struct {
+            Step    string `json:"step"`
+            Percent int    `json:"percent"`
+            At      string `json:"at"`
+        } `json:"progress"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &got)
+    if w.Code != http.StatusOK || len(got.Progress) != 3 {
+        t.Fatalf("GET progress: %d %s; want three reports", w.Code, w.Body)
+    }
+    for i, want := range []int{30, 50, 82} {
+        if got.Progress[i].Percent != want || got.Progress[i].At == "" {
+            t.Errorf("report %d = %+v, want %d%%", i, got.Progress[i], want)
+        }
+    }
+    if ttl, job := rdb.TTL(ctx, progressHistoryKey("j1")).Val(), rdb.TTL(ctx, "status:j1").Val(); ttl <= 0 || ttl > job {
+        t.Errorf("history TTL = %s, want the job's %s", ttl, job)
+    }
+
+    // Up through slicing and back down again: more reports than are kept
+    for p := 25; p <= 80; p++ {
+        patchProgress(t, r, "j1", `{"percent":`+strconv.Itoa(p)+`,"step":"slicing"}`)
+    }
+    for p := 79; p >= 25; p-- {
+        patchProgress(t, r, "j1", `{"percent":`+strconv.Itoa(p)+`,"step":"slicing"}`)
+    }
+    if n := rdb.XLen(ctx, progressHistoryKey("j1")).Val(); n != progressHistoryMax {
+        t.Errorf("history has %d entries, want it capped at %d", n, progressHistoryMax)
+    }
+
+    if w := do(r, http.MethodGet, "/jobs/nope/progress", ""); w.Code != http.StatusNotFound {
+        t.Errorf("unknown job: %d, want 404", w.Code)
+    }
+}
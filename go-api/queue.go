@@ -0,0 +1,277 @@
+package main
+
+import (
+    "context"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// Redis lists the worker pops from. Rush jobs get their own list so they
+// don't wait behind standard ones; the worker must BLPOP the rush list first:
+//
+//	BLPOP print_jobs:rush print_jobs 0
+//
+// QUEUE_MAP can route materials to other lists, each with its own ":rush".
+const (
+    standardQueue   = "print_jobs"
+    processingQueue = "print_jobs:processing"
+)
+
+// Each list has a Redis Stream counterpart ("<list>:stream") read through the
+// consumer group below, so a job stays pending until the worker XACKs it and
+// a crash mid-slice no longer loses it.
+const (
+    streamSuffix  = ":stream"
+    consumerGroup = "workers"
+    streamMaxLen  = 10000
+)
+
+func streamFor(queue string) string {
+    return queue + streamSuffix
+}
+
+// legacyListQueue reports whether jobs should still be RPUSHed to the plain
+// lists. On by default while old list-popping workers are being migrated;
+// set LEGACY_LIST_QUEUE=false once every worker reads the streams.
+func legacyListQueue() bool {
+    return cfg().LegacyListQueue
+}
+
+// initStreams creates the consumer group on every job stream.
+func initStreams() error {
+    for _, q := range jobQueues() {
+        err := rdb.XGroupCreateMkStream(ctx, streamFor(q), consumerGroup, "0").Err()
+        if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+            return err
+        }
+    }
+    return nil
+}
+
+// enqueue publishes a serialized job on the queue backend: with Redis, to
+// the stream and, during migration, to the legacy list as well. The exact
+// bytes are kept under params:{id} so the entry can be found in the list
+// again (LPOS/LREM).
+func enqueue(ctx context.Context, queue, jobID string, jsonData []byte) error {
+    if err := rdb.Set(ctx, "params:"+jobID, jsonData, 24*time.Hour).Err(); err != nil {
+        return err
+    }
+    return jobQueue.Publish(ctx, queue, jsonData)
+}
+
+// singleQueue reports whether SINGLE_QUEUE is set, which collapses rush jobs
+// back onto print_jobs (the old behaviour, for workers that only pop one list).
+func singleQueue() bool {
+    return cfg().SingleQueue
+}
+
+// materialQueue is the list QUEUE_MAP routes a material to (matched
+// case-insensitively), falling back to its "default" entry, then print_jobs.
+func materialQueue(material string) string {
+    var fallback string
+    for m, q := range cfg().QueueMap {
+        if strings.EqualFold(m, material) {
+            return q
+        }
+        if m == "default" {
+            fallback = q
+        }
+    }
+    if fallback != "" {
+        return fallback
+    }
+    return standardQueue
+}
+
+// rushQueueFor is the rush list served before base; print_jobs:rush for
+// print_jobs.
+func rushQueueFor(base string) string {
+    return base + ":rush"
+}
+
+// queueFor picks the list a job should be pushed to.
+func queueFor(material, region string, rush bool) string {
+    base := regionQueue(materialQueue(material), region)
+    if rush && !singleQueue() {
+        return rushQueueFor(base)
+    }
+    return base
+}
+
+// payloadQueue is the list a serialized job belongs on: the "queue" recorded
+// at submission, or for older payloads the one its fields map to.
+func payloadQueue(job map[string]interface{}) string {
+    if q, ok := job["queue"].(string); ok && q != "" {
+        return q
+    }
+    material, _ := job["material"].(string)
+    region, _ := job["region"].(string)
+    rush, _ := job["rush"].(bool)
+    return queueFor(material, region, rush)
+}
+
+// jobQueues lists every job list in pop order, each rush list before its
+// base list.
+func jobQueues() []string {
+    bases := []string{standardQueue}
+    seen := map[string]bool{standardQueue: true}
+    for _, q := range cfg().QueueMap {
+        if !seen[q] {
+            seen[q] = true
+            bases = append(bases, q)
+        }
+    }
+    sort.Strings(bases[1:])
+    if cfg().RegionRoutingEnabled {
+        all := make([]string, 0, len(bases)*(1+len(regions)))
+        for _, b := range bases {
+            all = append(all, b)
+            for _, r := range regions {
+                all = append(all, regionQueue(b, r))
+            }
+        }
+        bases = all
+    }
+    queues := make([]string, 0, 2*len(bases))
+    for _, b := range bases {
+        queues = append(queues, rushQueueFor(b), b)
+    }
+    return queues
+}
+
+// knownQueue reports whether base is one of the base lists jobQueues covers,
+// i.e. one the API creates streams for, dispatches to and reports on.
+func knownQueue(base string) bool {
+    if r := queueRegion(base); r != "" {
+        base = strings.TrimSuffix(base, ":"+r)
+    }
+    if base == standardQueue {
+        return true
+    }
+    for _, q := range cfg().QueueMap {
+        if q == base {
+            return true
+        }
+    }
+    return false
+}
+
+// jobPriority is the "priority" field sent to the worker in the payload.
+func jobPriority(rush bool) string {
+    if rush {
+        return "rush"
+    }
+    return "standard"
+}
+
+// queueDepths returns the number of jobs waiting on each queue, plus the
+// length of the processing list.
+func queueDepths(ctx context.Context) map[string]int64 {
+    depths := map[string]int64{}
+    for _, q := range jobQueues() {
+        n, err := queueBacklog(ctx, q)
+        if err != nil {
+            continue
+        }
+        depths[q] = n
+    }
+    if n, err := rdb.LLen(ctx, processingQueue).Result(); err == nil {
+        depths[processingQueue] = n
+    }
+    return depths
+}
+
+// queueBacklog is how many jobs on queue are still waiting for a worker.
+// While publishing to both, each job is taken from only one side and the
+// other copy is left behind, so the smaller backlog is the one draining.
+func queueBacklog(ctx context.Context, queue string) (int64, error) {
+    n, err := streamBacklog(ctx, queue)
+    if err != nil || !legacyListQueue() {
+        return n, err
+    }
+    listed, err := rdb.LLen(ctx, queue).Result()
+    if err != nil {
+        return 0, err
+    }
+    return min(n, listed), nil
+}
+
+// streamBacklog counts the entries on queue's stream not yet delivered to
+// the consumer group. Redis 7 reports that as the group's lag; when it can't
+// (older servers, or entries-read unknown after an XDEL) the entries past
+// last-delivered-id are counted instead.
+func streamBacklog(ctx context.Context, queue string) (int64, error) {
+    group, err := streamGroup(ctx, queue)
+    if err != nil || group == nil {
+        return 0, err
+    }
+    if lag, ok := group["lag"].(int64); ok && group["entries-read"] != nil {
+        return lag, nil
+    }
+    entries, err := undelivered(ctx, queue, group, streamMaxLen)
+    return int64(len(entries)), err
+}
+
+// claimUndeliveredLua starts scripts that take stream entry ARGV[1] off
+// KEYS[1] before any worker gets it: it returns 0 unless consumer group
+// ARGV[2] has yet to deliver the entry. Checking last-delivered-id and
+// deleting in one script is the claim, so once a worker has read the entry
+// it is left alone. IDs may lack the sequence part ("0" for a group created
+// at the start).
+const claimUndeliveredLua = `
+local function parse(id)
+    local ms, seq = string.match(id, '^(%d+)-?(%d*)$')
+    return tonumber(ms) or 0, tonumber(seq) or 0
+end
+local function after(a, b)
+    local am, as = parse(a)
+    local bm, bs = parse(b)
+    return am > bm or (am == bm and as > bs)
+end
+for _, g in ipairs(redis.call('XINFO', 'GROUPS', KEYS[1])) do
+    local f = {}
+    for i = 1, #g, 2 do f[g[i]] = g[i + 1] end
+    if f['name'] == ARGV[2] and not after(ARGV[1], f['last-delivered-id']) then
+        return 0
+    end
+end
+`
+
+// undelivered returns up to n stream entries the group hasn't read yet,
+// oldest first.
+func undelivered(ctx context.Context, queue string, group map[string]interface{}, n int64) ([]redis.XMessage, error) {
+    last, _ := group["last-delivered-id"].(string)
+    if last == "" {
+        last = "0-0"
+    }
+    return rdb.XRangeN(ctx, streamFor(queue), "("+last, "+", n).Result()
+}
+
+// streamGroup reads the consumer group's XINFO GROUPS fields, nil when the
+// stream or group doesn't exist yet. The reply is read raw because
+// go-redis's XInfoGroups rejects the longer Redis 7 form.
+func streamGroup(ctx context.Context, queue string) (map[string]interface{}, error) {
+    groups, err := rdb.Do(ctx, "XINFO", "GROUPS", streamFor(queue)).Slice()
+    if err != nil {
+        if strings.Contains(err.Error(), "no such key") {
+            return nil, nil
+        }
+        return nil, err
+    }
+    for _, g := range groups {
+        fields, _ := g.([]interface{})
+        group := map[string]interface{}{}
+        for i := 0; i+1 < len(fields); i += 2 {
+            if k, ok := fields[i].(string); ok {
+                group[k] = fields[i+1]
+            }
+        }
+        if group["name"] == consumerGroup {
+            return group, nil
+        }
+    }
+    return nil, nil
+}
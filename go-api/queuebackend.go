@@ -0,0 +1,201 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "log"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+    "github.com/google/uuid"
+    "github.com/nats-io/nats.go"
+    "github.com/nats-io/nats.go/jetstream"
+)
+
+// QueueBackend hands serialized jobs to workers. subject is a queue name
+// such as print_jobs:rush; Subscribe calls handler with each job published
+// to it, in the background until ctx ends, and acknowledges a job once
+// handler returns, so a consumer that dies mid-job has it redelivered.
+//
+// Job state (params:, status:, results) stays in Redis whichever backend
+// carries the jobs.
+type QueueBackend interface {
+    Publish(ctx context.Context, subject string, data []byte) error
+    Subscribe(ctx context.Context, subject string, handler func([]byte)) error
+}
+
+const (
+    queueBackendRedis = "redis"
+    queueBackendNATS  = "nats"
+)
+
+// jobQueue is the QUEUE_BACKEND that enqueue publishes to.
+var jobQueue QueueBackend = RedisQueue{}
+
+// startQueueBackend connects the configured backend.
+func startQueueBackend() {
+    if cfg().QueueBackend != queueBackendNATS {
+        return
+    }
+    q, err := newNATSQueue(ctx, cfg())
+    if err != nil {
+        panic("Failed to set up NATS JetStream: " + err.Error())
+    }
+    jobQueue = q
+    log.Printf("INFO queueing jobs on NATS stream %s", cfg().NATSStream)
+}
+
+// RedisQueue is the queue workers have always read: each queue's stream,
+// through the workers consumer group, and during migration its legacy list.
+type RedisQueue struct{}
+
+func (RedisQueue) Publish(ctx context.Context, subject string, data []byte) error {
+    err := rdb.XAdd(ctx, &redis.XAddArgs{
+        Stream: streamFor(subject),
+        MaxLen: streamMaxLen,
+        Approx: true,
+        Values: map[string]interface{}{"payload": data},
+    }).Err()
+    if err != nil {
+        return err
+    }
+    if legacyListQueue() {
+        return rdb.RPush(ctx, subject, data).Err()
+    }
+    return nil
+}
+
+// Subscribe reads the stream as a member of the workers group and XACKs
+// each entry after handler. Entries left pending by a consumer that died
+// are the reaper's to reclaim, as for the Python workers.
+func (RedisQueue) Subscribe(ctx context.Context, subject string, handler func([]byte)) error {
+    stream := streamFor(subject)
+    err := rdb.XGroupCreateMkStream(ctx, stream, consumerGroup, "0").Err()
+    if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+        return err
+    }
+    host, _ := os.Hostname()
+    consumer := "api-" + host + "-" + uuid.New().String()[:8]
+    go func() {
+        for ctx.Err() == nil {
+            res, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+                Group:    consumerGroup,
+                Consumer: consumer,
+                Streams:  []string{stream, ">"},
+                Count:    10,
+                Block:    time.Second,
+            }).Result()
+            if err == redis.Nil {
+                continue
+            } else if err != nil {
+                if ctx.Err() == nil {
+                    log.Printf("WARN reading %s: %v", stream, err)
+                    time.Sleep(time.Second)
+                }
+                continue
+            }
+            for _, s := range res {
+                for _, m := range s.Messages {
+                    payload, _ := m.Values["payload"].(string)
+                    handler([]byte(payload))
+                    rdb.XAck(ctx, stream, consumerGroup, m.ID)
+                }
+            }
+        }
+    }()
+    return nil
+}
+
+var natsRetentions = map[string]jetstream.RetentionPolicy{
+    "limits":    jetstream.LimitsPolicy,
+    "workqueue": jetstream.WorkQueuePolicy,
+    "interest":  jetstream.InterestPolicy,
+}
+
+// NATSQueue carries jobs on one JetStream stream, each queue a subject under
+// NATS_SUBJECT_PREFIX with its own durable consumer that workers share.
+type NATSQueue struct {
+    nc     *nats.Conn
+    js     jetstream.JetStream
+    stream string
+    prefix string
+    // How long a delivered job may go unacked before it is redelivered
+    ackWait time.Duration
+}
+
+// newNATSQueue connects to NATS_URL and creates or updates the stream with
+// the configured retention, replicas and max age.
+func newNATSQueue(ctx context.Context, c *Config) (*NATSQueue, error) {
+    nc, err := nats.Connect(c.NATSURL, nats.Name("slicer-api"), nats.MaxReconnects(-1))
+    if err != nil {
+        return nil, err
+    }
+    js, err := jetstream.New(nc)
+    if err != nil {
+        nc.Close()
+        return nil, err
+    }
+    _, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+        Name:      c.NATSStream,
+        Subjects:  []string{c.NATSSubjectPrefix + ".>"},
+        Retention: natsRetentions[c.NATSRetention],
+        Replicas:  c.NATSReplicas,
+        MaxAge:    c.NATSMaxAge(),
+        Storage:   jetstream.FileStorage,
+    })
+    if err != nil {
+        nc.Close()
+        return nil, err
+    }
+    return &NATSQueue{nc: nc, js: js, stream: c.NATSStream, prefix: c.NATSSubjectPrefix, ackWait: c.VisibilityTimeout()}, nil
+}
+
+// Close drops the connection, and with it every subscription.
+func (q *NATSQueue) Close() {
+    q.nc.Close()
+}
+
+// subject maps a queue to its subject: print_jobs:rush to jobs.print_jobs.rush.
+func (q *NATSQueue) subject(queue string) string {
+    return q.prefix + "." + strings.ReplaceAll(queue, ":", ".")
+}
+
+// durable names the queue's consumer, e.g. workers_print_jobs_rush.
+func (q *NATSQueue) durable(queue string) string {
+    return consumerGroup + "_" + strings.NewReplacer(":", "_", ".", "_").Replace(queue)
+}
+
+// Publish returns once JetStream has stored the job.
+func (q *NATSQueue) Publish(ctx context.Context, subject string, data []byte) error {
+    _, err := q.js.Publish(ctx, q.subject(subject), data)
+    return err
+}
+
+func (q *NATSQueue) Subscribe(ctx context.Context, subject string, handler func([]byte)) error {
+    consumer, err := q.js.CreateOrUpdateConsumer(ctx, q.stream, jetstream.ConsumerConfig{
+        Durable:       q.durable(subject),
+        FilterSubject: q.subject(subject),
+        AckPolicy:     jetstream.AckExplicitPolicy,
+        AckWait:       q.ackWait,
+        MaxDeliver:    -1,
+    })
+    if err != nil {
+        return err
+    }
+    cc, err := consumer.Consume(func(msg jetstream.Msg) {
+        handler(msg.Data())
+        if err := msg.Ack(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+            log.Printf("WARN acking %s: %v", msg.Subject(), err)
+        }
+    })
+    if err != nil {
+        return err
+    }
+    go func() {
+        <-ctx.Done()
+        cc.Stop()
+    }()
+    return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "sync"
+    "testing"
+    "time"
+
+    natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// received collects what a subscription is handed.
+type received struct {
+    mu   sync.Mutex
+    msgs []string
+}
+
+func (r *received) handle(data []byte) {
+    r.mu.Lock()
+    r.msgs = append(r.msgs, string(data))
+    r.mu.Unlock()
+}
+
+func (r *received) wait(t *testing.T, n int) []string {
+    t.Helper()
+    for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+        r.mu.Lock()
+        got := append([]string(nil), r.msgs...)
+        r.mu.Unlock()
+        if len(got) >= n {
+            return got
+        }
+    }
+    t.Fatalf("received %d messages, want %d", len(r.msgs), n)
+    return nil
+}
+
+// testQueueBackend is the suite every QueueBackend must pass. pending
+// reports how many delivered messages of subject are still unacked.
+func testQueueBackend(t *testing.T, q QueueBackend, pending func(subject string) int64) {
+    t.Run("delivers in order what was published before subscribing", func(t *testing.T) {
+        for i := 0; i < 3; i++ {
+            if err := q.Publish(ctx, "suite_a", []byte(fmt.Sprint("job", i))); err != nil {
+                t.Fatal(err)
+            }
+        }
+        subCtx, cancel := context.WithCancel(ctx)
+        defer cancel()
+        var got received
+        if err := q.Subscribe(subCtx, "suite_a", got.handle); err != nil {
+            t.Fatal(err)
+        }
+        msgs := got.wait(t, 3)
+        if fmt.Sprint(msgs) != "[job0 job1 job2]" {
+            t.Errorf("received %v", msgs)
+        }
+        for deadline := time.Now().Add(2 * time.Second); pending("suite_a") != 0 && time.Now().Before(deadline); {
+            time.Sleep(5 * time.Millisecond)
+        }
+        if n := pending("suite_a"); n != 0 {
+            t.Errorf("%d messages left unacked after handling", n)
+        }
+    })
+
+    t.Run("keeps subjects apart", func(t *testing.T) {
+        subCtx, cancel := context.WithCancel(ctx)
+        defer cancel()
+        var rush, standard received
+        if err := q.Subscribe(subCtx, "suite_b:rush", rush.handle); err != nil {
+            t.Fatal(err)
+        }
+        if err := q.Subscribe(subCtx, "suite_b", standard.handle); err != nil {
+            t.Fatal(err)
+        }
+        q.Publish(ctx, "suite_b", []byte("standard"))
+        q.Publish(ctx, "suite_b:rush", []byte("rush"))
+        if got := rush.wait(t, 1); fmt.Sprint(got) != "[rush]" {
+            t.Errorf("rush subscriber got %v", got)
+        }
+        if got := standard.wait(t, 1); fmt.Sprint(got) != "[standard]" {
+            t.Errorf("standard subscriber got %v", got)
+        }
+    })
+
+    t.Run("hands each job to one of the subscribers sharing a queue", func(t *testing.T) {
+        subCtx, cancel := context.WithCancel(ctx)
+        defer cancel()
+        var all received
+        for i := 0; i < 2; i++ {
+            if err := q.Subscribe(subCtx, "suite_c", all.handle); err != nil {
+                t.Fatal(err)
+            }
+        }
+        for i := 0; i < 10; i++ {
+            q.Publish(ctx, "suite_c", []byte(fmt.Sprint("job", i)))
+        }
+        all.wait(t, 10)
+        time.Sleep(50 * time.Millisecond)
+        if got := all.wait(t, 10); len(got) != 10 {
+            t.Errorf("received %d messages for 10 jobs", len(got))
+        }
+    })
+}
+
+func TestRedisQueueBackend(t *testing.T) {
+    setupTest(t)
+    testQueueBackend(t, RedisQueue{}, func(subject string) int64 {
+        p, _ := rdb.XPending(ctx, streamFor(subject), consumerGroup).Result()
+        if p == nil {
+            return 0
+        }
+        return p.Count
+    })
+}
+
+// startNATS runs an embedded JetStream server for the test and returns its
+// URL.
+func startNATS(t *testing.T) string {
+    t.Helper()
+    s, err := natsserver.NewServer(&natsserver.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    go s.Start()
+    if !s.ReadyForConnections(5 * time.Second) {
+        t.Fatal("NATS server did not start")
+    }
+    t.Cleanup(s.Shutdown)
+    return s.ClientURL()
+}
+
+func natsQueue(t *testing.T, configure func(*Config)) *NATSQueue {
+    t.Helper()
+    c := defaultConfig()
+    c.NATSURL = startNATS(t)
+    if configure != nil {
+        configure(c)
+    }
+    q, err := newNATSQueue(ctx, c)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(q.Close)
+    return q
+}
+
+func TestNATSBackendRejected(t *testing.T) {
+    c := defaultConfig()
+    c.QueueBackend = queueBackendNATS
+    if c.Validate() == nil {
+        t.Fatal("Validate accepted queue_backend nats")
+    }
+}
+
+func TestNATSQueueBackend(t *testing.T) {
+    setupTest(t)
+    q := natsQueue(t, nil)
+    testQueueBackend(t, q, func(subject string) int64 {
+        info, err := q.js.Consumer(ctx, q.stream, q.durable(subject))
+        if err != nil {
+            return -1
+        }
+        return int64(info.CachedInfo().NumAckPending)
+    })
+}
+
+func TestNATSStreamConfig(t *testing.T) {
+    setupTest(t)
+    q := natsQueue(t, func(c *Config) {
+        c.NATSStream = "JOBS_TEST"
+        c.NATSRetention = "limits"
+        c.NATSMaxAgeHours = 2
+    })
+    s, err := q.js.Stream(ctx, "JOBS_TEST")
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg := s.CachedInfo().Config
+    if cfg.Retention.String() != "Limits" || cfg.MaxAge != 2*time.Hour || cfg.Replicas != 1 || cfg.Subjects[0] != "jobs.>" {
+        t.Errorf("stream config = %+v", cfg)
+    }
+}
+
+// A subscriber that dies before acking doesn't lose the job: the durable
+// consumer hands it to the next one once the ack wait is up.
+func TestNATSRedeliversUnackedJobs(t *testing.T) {
+    setupTest(t)
+    q := natsQueue(t, nil)
+    q.ackWait = time.Second
+
+    crashed, cancel := context.WithCancel(ctx)
+    stuck := make(chan struct{})
+    release := make(chan struct{})
+    var once sync.Once
+    if err := q.Subscribe(crashed, "print_jobs", func([]byte) {
+        once.Do(func() { close(stuck) })
+        <-release
+    }); err != nil {
+        t.Fatal(err)
+    }
+    q.Publish(ctx, "print_jobs", []byte("job1"))
+    <-stuck
+    cancel()
+    defer close(release)
+
+    var got received
+    if err := q.Subscribe(ctx, "print_jobs", got.handle); err != nil {
+        t.Fatal(err)
+    }
+    if msgs := got.wait(t, 1); msgs[0] != "job1" {
+        t.Errorf("redelivered %v", msgs)
+    }
+}
+
+// With QUEUE_BACKEND=nats, submissions reach JetStream rather than the
+// Redis stream, while their state stays in Redis.
+func TestQuoteOnNATS(t *testing.T) {
+    setupTest(t, func(c *Config) { c.FairScheduling = false })
+    q := natsQueue(t, nil)
+    jobQueue = q
+    t.Cleanup(func() { jobQueue = RedisQueue{} })
+
+    var got received
+    q.Subscribe(ctx, standardQueue, got.handle)
+    code, jobID, _ := quoteJobID(t, newRouter(), `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`)
+    if code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202", code)
+    }
+    msgs := got.wait(t, 1)
+    job, _ := readPayload([]byte(msgs[0]))
+    if job["id"] != jobID {
+        t.Errorf("NATS job = %v, want %s", job, jobID)
+    }
+    if rdb.Get(ctx, "status:"+jobID).Val() != "queued" || rdb.XLen(ctx, streamFor(standardQueue)).Val() != 0 {
+        t.Errorf("want a queued status in Redis and nothing on the Redis stream")
+    }
+}
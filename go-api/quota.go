@@ -0,0 +1,177 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// quota:{owner_id} is a hash of the owner's limits, set by operators with
+// HSET; a missing field means no limit. Usage is counted for every owner in
+// quota_usage:{owner_id}:{window} keys that expire when the window ends, so
+// GET /quota works before any limit is set. Anonymous callers have no quota.
+var quotaLimits = []string{"max_jobs_per_day", "max_jobs_per_hour", "max_total_bytes_per_day"}
+
+func quotaKey(owner string) string {
+    return "quota:" + owner
+}
+
+// quotaWindows returns, for each of quotaLimits, the usage key at now and
+// when it resets: the start of the next UTC day or hour.
+func quotaWindows(owner string, now time.Time) ([]string, []time.Time) {
+    now = now.UTC()
+    day := now.Format("20060102")
+    nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+    nextHour := now.Truncate(time.Hour).Add(time.Hour)
+    prefix := "quota_usage:" + owner + ":"
+    keys := []string{prefix + "jobs:" + day, prefix + "jobs:" + now.Format("2006010215"), prefix + "bytes:" + day}
+    return keys, []time.Time{nextDay, nextHour, nextDay}
+}
+
+// chargeQuotaScript checks every limit and only then counts the submission
+// against all of them, so concurrent submissions can't both take the last
+// slot. It returns the index (1-based) of the first limit that would be
+// exceeded, or 0, followed by the usage in each window.
+var chargeQuotaScript = redis.NewScript(`
+local limits = redis.call('HMGET', KEYS[1], 'max_jobs_per_day', 'max_jobs_per_hour', 'max_total_bytes_per_day')
+local incr = {1, 1, tonumber(ARGV[1])}
+local resets = {ARGV[2], ARGV[3], ARGV[2]}
+local used = {}
+local exceeded = 0
+for i = 1, 3 do
+    used[i] = tonumber(redis.call('GET', KEYS[i + 1]) or '0')
+    local limit = tonumber(limits[i])
+    if exceeded == 0 and limit and used[i] + incr[i] > limit then
+        exceeded = i
+    end
+end
+if exceeded == 0 then
+    for i = 1, 3 do
+        if incr[i] > 0 then
+            used[i] = redis.call('INCRBY', KEYS[i + 1], incr[i])
+            redis.call('EXPIREAT', KEYS[i + 1], resets[i])
+        end
+    end
+end
+return {exceeded, used[1], used[2], used[3]}
+`)
+
+// quotaCharge is what chargeQuota counted, for refundQuota.
+type quotaCharge struct {
+    keys  []string
+    bytes int64
+}
+
+// chargeQuota counts a submission of size bytes against the caller's quota.
+// When a limit would be exceeded it answers 429 itself and returns false.
+// The charge is nil when nothing was counted.
+func chargeQuota(c *gin.Context, bytes int64) (*quotaCharge, bool) {
+    owner := requestOwner(c)
+    if owner == "" {
+        return nil, true
+    }
+    ctx := c.Request.Context()
+    keys, resets := quotaWindows(owner, time.Now())
+    res, err := chargeQuotaScript.Run(ctx, rdb, append([]string{quotaKey(owner)}, keys...),
+        bytes, resets[0].Unix(), resets[1].Unix()).Int64Slice()
+    if err != nil {
+        // Don't turn customers away because the check itself failed
+        return nil, true
+    }
+    if exceeded := res[0]; exceeded > 0 {
+        reset := resets[exceeded-1]
+        c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+        remaining, _ := quotaUsage(ctx, owner)
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error":           "Quota exceeded: " + quotaLimits[exceeded-1],
+            "quota":           quotaLimits[exceeded-1],
+            "resets_at":       reset.Format(time.RFC3339),
+            "quota_remaining": remainingQuota(remaining),
+        })
+        return nil, false
+    }
+    return &quotaCharge{keys: keys, bytes: bytes}, true
+}
+
+// refundQuota gives back a charge when the submission was turned away after
+// it, so failed uploads don't use up the quota.
+func refundQuota(c *gin.Context, charge *quotaCharge) {
+    if charge == nil {
+        return
+    }
+    if s := c.Writer.Status(); s == http.StatusOK || s == http.StatusAccepted {
+        return
+    }
+    pipe := rdb.Pipeline()
+    pipe.Decr(ctx, charge.keys[0])
+    pipe.Decr(ctx, charge.keys[1])
+    if charge.bytes > 0 {
+        pipe.DecrBy(ctx, charge.keys[2], charge.bytes)
+    }
+    pipe.Exec(ctx)
+}
+
+type quotaState struct {
+    Limit     *int64 `json:"limit"`
+    Used      int64  `json:"used"`
+    Remaining *int64 `json:"remaining"`
+    ResetsAt  string `json:"resets_at"`
+}
+
+// quotaUsage reads owner's limits and usage in the current windows.
+func quotaUsage(ctx context.Context, owner string) (map[string]quotaState, error) {
+    keys, resets := quotaWindows(owner, time.Now())
+    pipe := rdb.Pipeline()
+    limits := pipe.HMGet(ctx, quotaKey(owner), quotaLimits...)
+    used := pipe.MGet(ctx, keys...)
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        return nil, err
+    }
+    states := make(map[string]quotaState, len(quotaLimits))
+    for i, name := range quotaLimits {
+        s := quotaState{ResetsAt: resets[i].Format(time.RFC3339)}
+        if v, ok := used.Val()[i].(string); ok {
+            s.Used, _ = strconv.ParseInt(v, 10, 64)
+        }
+        if v, ok := limits.Val()[i].(string); ok {
+            if limit, err := strconv.ParseInt(v, 10, 64); err == nil {
+                remaining := max(limit-s.Used, 0)
+                s.Limit, s.Remaining = &limit, &remaining
+            }
+        }
+        states[name] = s
+    }
+    return states, nil
+}
+
+// remainingQuota is the "quota_remaining" object: what is left under each
+// limit that is set.
+func remainingQuota(states map[string]quotaState) gin.H {
+    remaining := gin.H{}
+    for name, s := range states {
+        if s.Remaining != nil {
+            remaining[name] = *s.Remaining
+        }
+    }
+    return remaining
+}
+
+// GET /quota reports the caller's limits and what they have used of them.
+func handleGetQuota(c *gin.Context) {
+    states, err := quotaUsage(c.Request.Context(), requestOwner(c))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "owner_id":        requestOwner(c),
+        "quotas":          states,
+        "quota_remaining": remainingQuota(states),
+    })
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sync"
+    "testing"
+    "time"
+)
+
+func quotaSubmit(h http.Handler, n int) int {
+    body := fmt.Sprintf(`{"download_url":"https://example.com/part-%d.stl","material":"PLA","infill":20}`, n)
+    return do(h, http.MethodPost, "/quote", body, "Authorization", "Bearer k1").Code
+}
+
+func TestQuotaRejectsOverLimit(t *testing.T) {
+    setupTest(t, func(c *Config) { c.APIKeys = map[string]string{"k1": "acme"} })
+    r := newRouter()
+    rdb.HSet(ctx, quotaKey("apikey:acme"), "max_jobs_per_hour", 2)
+
+    for i := 0; i < 2; i++ {
+        if code := quotaSubmit(r, i); code != http.StatusAccepted {
+            t.Fatalf("submission %d: status = %d, want 202", i, code)
+        }
+    }
+    body := `{"download_url":"https://example.com/over.stl","material":"PLA","infill":20}`
+    w := do(r, http.MethodPost, "/quote", body, "Authorization", "Bearer k1")
+    if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+        t.Fatalf("over quota: status = %d, Retry-After %q; want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+    }
+    var rejected struct {
+        Quota     string           `json:"quota"`
+        Remaining map[string]int64 `json:"quota_remaining"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &rejected)
+    if rejected.Quota != "max_jobs_per_hour" || rejected.Remaining["max_jobs_per_hour"] != 0 {
+        t.Fatalf("429 body %s; want max_jobs_per_hour with 0 remaining", w.Body)
+    }
+
+    w = do(r, http.MethodGet, "/quota", "", "Authorization", "Bearer k1")
+    var got struct {
+        Quotas map[string]quotaState `json:"quotas"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &got)
+    hour := got.Quotas["max_jobs_per_hour"]
+    if w.Code != http.StatusOK || hour.Used != 2 || hour.Limit == nil || *hour.Limit != 2 {
+        t.Fatalf("/quota = %d %s; want 2 of 2 jobs used this hour", w.Code, w.Body)
+    }
+    if day := got.Quotas["max_jobs_per_day"]; day.Used != 2 || day.Limit != nil {
+        t.Fatalf("/quota day = %+v; want 2 used with no limit", day)
+    }
+    keys, _ := quotaWindows("apikey:acme", time.Now())
+    if ttl := rdb.TTL(ctx, keys[1]).Val(); ttl <= 0 {
+        t.Errorf("hourly counter has no expiry (TTL %v)", ttl)
+    }
+}
+
+func TestQuotaHoldsUnderConcurrency(t *testing.T) {
+    setupTest(t, func(c *Config) { c.APIKeys = map[string]string{"k1": "acme"} })
+    r := newRouter()
+    rdb.HSet(ctx, quotaKey("apikey:acme"), "max_jobs_per_day", 3)
+
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    accepted := 0
+    for i := 0; i < 10; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            if quotaSubmit(r, i) == http.StatusAccepted {
+                mu.Lock()
+                accepted++
+                mu.Unlock()
+            }
+        }(i)
+    }
+    wg.Wait()
+    if accepted != 3 {
+        t.Fatalf("%d submissions accepted, want 3", accepted)
+    }
+}
+
+func TestQuotaNeedsOwner(t *testing.T) {
+    setupTest(t)
+    if w := do(newRouter(), http.MethodGet, "/quota", ""); w.Code != http.StatusUnauthorized {
+        t.Fatalf("anonymous /quota: status = %d, want 401", w.Code)
+    }
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "log"
+    "time"
+)
+
+// Workers claim jobs with LMOVE print_jobs -> print_jobs:processing and
+// record the claim time in this hash (job id -> unix seconds). When they
+// finish they LREM the payload and HDEL the claim.
+const claimedAtKey = "print_jobs:processing:claimed"
+
+// startReaper periodically requeues jobs that have sat in the processing list
+// longer than the visibility timeout, i.e. whose worker most likely died,
+// and runs the other maintenance sweeps. Each sweep has its own lease, so
+// with several replicas exactly one runs it per tick and they can spread
+// across replicas.
+func startReaper() {
+    interval := cfg().ReaperInterval()
+    ttl := leaseTTL(interval)
+    tasks := []struct {
+        name string
+        run  func()
+    }{
+        {"reaper", func() {
+            if err := reapProcessing(); err != nil {
+                log.Printf("reaper: %v", err)
+            }
+        }},
+        {"retry", drainRetryQueue},
+        {"delayed", promoteDelayed},
+        {"scheduled", releaseScheduled},
+        {"aging", promoteAgedJobs},
+        {"dlq", pruneDLQ},
+        {"deadlines", failOverdueJobs},
+        {"uploads", pruneStoredUploads},
+    }
+    for _, task := range tasks {
+        registerLease(task.name)
+    }
+
+    go func() {
+        for range time.Tick(interval) {
+            for _, task := range tasks {
+                runLeased(task.name, ttl, task.run)
+            }
+        }
+    }()
+}
+
+// jobVisibilityTimeout is VISIBILITY_TIMEOUT_SECONDS, stretched by whatever
+// extra deadline the job got for its upload size so the margin over the
+// deadline stays the same.
+func jobVisibilityTimeout(job map[string]interface{}) time.Duration {
+    timeout := cfg().VisibilityTimeout()
+    if d, ok := job["deadline_seconds"].(float64); ok {
+        if extra := time.Duration(d)*time.Second - cfg().ProcessingDeadline(); extra > 0 {
+            timeout += extra
+        }
+    }
+    return timeout
+}
+
+func reapProcessing() error {
+    entries, err := rdb.LRange(ctx, processingQueue, 0, -1).Result()
+    if err != nil {
+        return err
+    }
+
+    now := time.Now()
+    for _, entry := range entries {
+        job, err := readPayload([]byte(entry))
+        if err != nil {
+            log.Printf("reaper: dropping unreadable entry: %v", err)
+            rdb.LRem(ctx, processingQueue, 1, entry)
+            continue
+        }
+        jobID, _ := job["id"].(string)
+
+        // Workers that predate the claim hash don't write it; start the
+        // clock the first time we see the entry instead
+        rdb.HSetNX(ctx, claimedAtKey, jobID, now.Unix())
+        claimedAt, err := rdb.HGet(ctx, claimedAtKey, jobID).Int64()
+        if err != nil || now.Sub(time.Unix(claimedAt, 0)) < jobVisibilityTimeout(job) {
+            continue
+        }
+        // Finished jobs are left alone: the worker or the sweeper already
+        // settled them, only the list entry is left over
+        status := parseJobStatus(rdb.Get(ctx, "status:"+jobID).Val())
+        if status.IsTerminal() || status == StatusCancelling {
+            rdb.LRem(ctx, processingQueue, 1, entry)
+            rdb.HDel(ctx, claimedAtKey, jobID)
+            // Its worker died before it could stop; nothing left to wait for
+            if status == StatusCancelling {
+                settleCancel(jobID, "the worker went away")
+            }
+            continue
+        }
+
+        if err := requeueStale(entry, job); err != nil {
+            log.Printf("reaper: requeue %s: %v", jobID, err)
+        }
+    }
+    return nil
+}
+
+// requeueStale treats an expired entry as a worker crash and hands it to the
+// retry policy. LREM is the claim: only the replica that actually removed
+// the entry acts on it.
+func requeueStale(entry string, job map[string]interface{}) error {
+    removed, err := rdb.LRem(ctx, processingQueue, 1, entry).Result()
+    if err != nil || removed == 0 {
+        return err
+    }
+
+    jobID, _ := job["id"].(string)
+    rdb.HDel(ctx, claimedAtKey, jobID)
+
+    if err := scheduleRetry(job, "worker timeout"); err != nil {
+        // Put it back so the next sweep can retry
+        rdb.RPush(ctx, processingQueue, entry)
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+)
+
+func TestReaperRequeuesStaleClaims(t *testing.T) {
+    tests := []struct {
+        name       string
+        claimedAgo time.Duration
+        status     string
+        wantQueued bool
+    }{
+        {"still within the timeout", 100 * time.Second, "processing", false},
+        {"past the visibility timeout", 4000 * time.Second, "processing", true},
+        {"already finished", 4000 * time.Second, "completed", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setupTest(t)
+            entry, _ := json.Marshal(map[string]interface{}{"id": "j1"})
+            rdb.RPush(ctx, processingQueue, entry)
+            rdb.HSet(ctx, claimedAtKey, "j1", time.Now().Add(-tt.claimedAgo).Unix())
+            rdb.Set(ctx, "status:j1", tt.status, time.Hour)
+
+            if err := reapProcessing(); err != nil {
+                t.Fatal(err)
+            }
+            // Retried with backoff through the delayed set
+            queued, _ := rdb.ZCard(ctx, delayedQueue).Result()
+            if (queued == 1) != tt.wantQueued {
+                t.Fatalf("requeued = %v, want %v", queued == 1, tt.wantQueued)
+            }
+            left, _ := rdb.LLen(ctx, processingQueue).Result()
+            if wantLeft := tt.claimedAgo < cfg().VisibilityTimeout(); (left == 1) != wantLeft {
+                t.Errorf("entry left in processing = %v, want %v", left == 1, wantLeft)
+            }
+            if status, _ := rdb.Get(ctx, "status:j1").Result(); tt.wantQueued && status != "queued" {
+                t.Errorf("status = %q, want queued", status)
+            }
+        })
+    }
+}
+
+func TestReaperLeavesSlowJobsToTheirDeadline(t *testing.T) {
+    tests := []struct {
+        name       string
+        claimedAgo time.Duration
+        deadline   int
+        wantReaped bool
+    }{
+        {"slow but within deadline", 1000 * time.Second, 3600, false},
+        {"past the visibility timeout", 4000 * time.Second, 3600, true},
+        {"big upload keeps its margin", 4000 * time.Second, 5400, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setupTest(t)
+            entry, _ := json.Marshal(map[string]interface{}{"id": "j1", "deadline_seconds": tt.deadline})
+            rdb.RPush(ctx, processingQueue, entry)
+            rdb.HSet(ctx, claimedAtKey, "j1", time.Now().Add(-tt.claimedAgo).Unix())
+            rdb.Set(ctx, "status:j1", "processing", time.Hour)
+
+            if err := reapProcessing(); err != nil {
+                t.Fatal(err)
+            }
+            left, _ := rdb.LLen(ctx, processingQueue).Result()
+            if reaped := left == 0; reaped != tt.wantReaped {
+                t.Fatalf("reaped = %v, want %v", reaped, tt.wantReaped)
+            }
+        })
+    }
+}
+
+func TestVisibilityTimeoutMustExceedDeadline(t *testing.T) {
+    c := defaultConfig()
+    c.VisibilityTimeoutSeconds = c.ProcessingDeadlineSeconds
+    if c.Validate() == nil {
+        t.Fatal("Validate accepted a visibility timeout equal to the processing deadline")
+    }
+}
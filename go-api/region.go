@@ -0,0 +1,82 @@
+package main
+
+import (
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// regions are the values the "region" field accepts. With
+// REGION_ROUTING_ENABLED each base list gets one list per region beside it,
+// print_jobs:eu and print_jobs:eu:rush for print_jobs, served by workers
+// started with WORKER_REGION. Job metadata stays in the one Redis.
+var regions = []string{"us", "eu", "ap"}
+
+// validRegion reports whether r may be given as a job's region; empty means
+// none.
+func validRegion(r string) bool {
+    if r == "" {
+        return true
+    }
+    for _, known := range regions {
+        if r == known {
+            return true
+        }
+    }
+    return false
+}
+
+// regionQueue is base's list for region, or base itself when the job has no
+// region or region routing is off.
+func regionQueue(base, region string) string {
+    if !cfg().RegionRoutingEnabled || region == "" {
+        return base
+    }
+    return base + ":" + region
+}
+
+// queueRegion is the region queue belongs to, or "" for the global lists.
+func queueRegion(queue string) string {
+    if !cfg().RegionRoutingEnabled {
+        return ""
+    }
+    queue = strings.TrimSuffix(queue, ":rush")
+    for _, r := range regions {
+        if strings.HasSuffix(queue, ":"+r) {
+            return r
+        }
+    }
+    return ""
+}
+
+// GET /admin/queues reports how many jobs wait on each list, grouped by
+// region; the global lists are under "default".
+func handleAdminQueues(c *gin.Context) {
+    ctx := c.Request.Context()
+    byRegion := map[string]map[string]int64{}
+    var total int64
+    for _, q := range jobQueues() {
+        n, err := queueBacklog(ctx, q)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+        region := queueRegion(q)
+        if region == "" {
+            region = "default"
+        }
+        if byRegion[region] == nil {
+            byRegion[region] = map[string]int64{}
+        }
+        byRegion[region][q] = n
+        total += n
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "region_routing": cfg().RegionRoutingEnabled,
+        "regions":        byRegion,
+        "total":          total,
+    })
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+)
+
+const regionQuote = `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20,"region":"eu"}`
+
+func TestQuoteRoutesToRegionQueue(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.RegionRoutingEnabled = true
+        c.FairScheduling = false
+    })
+    code, jobID, _ := quoteJobID(t, newRouter(), regionQuote)
+    if code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202", code)
+    }
+    if n := rdb.LLen(ctx, "print_jobs:eu").Val(); n != 1 {
+        t.Fatalf("print_jobs:eu has %d jobs, want 1", n)
+    }
+    if n := rdb.LLen(ctx, standardQueue).Val(); n != 0 {
+        t.Fatalf("print_jobs has %d jobs, want 0", n)
+    }
+    payload, _ := rdb.Get(ctx, "params:"+jobID).Bytes()
+    job, err := readPayload(payload)
+    if err != nil || job["region"] != "eu" || job["queue"] != "print_jobs:eu" {
+        t.Fatalf("params = %v (%v), want region eu on print_jobs:eu", job, err)
+    }
+}
+
+func TestQuoteIgnoresRegionWhenRoutingOff(t *testing.T) {
+    setupTest(t, func(c *Config) { c.FairScheduling = false })
+    if code, _, _ := quoteJobID(t, newRouter(), regionQuote); code != http.StatusAccepted {
+        t.Fatalf("status = %d, want 202", code)
+    }
+    if n := rdb.LLen(ctx, standardQueue).Val(); n != 1 {
+        t.Fatalf("print_jobs has %d jobs, want 1", n)
+    }
+}
+
+func TestQuoteRejectsUnknownRegion(t *testing.T) {
+    setupTest(t, func(c *Config) { c.RegionRoutingEnabled = true })
+    body := `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20,"region":"mars"}`
+    if w := do(newRouter(), http.MethodPost, "/quote", body); w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400 (body %s)", w.Code, w.Body)
+    }
+}
+
+func TestRouteJobStaysInRegion(t *testing.T) {
+    setupTest(t, func(c *Config) { c.RegionRoutingEnabled = true })
+    registerTestWorker(t, workerInfo{ID: "us1", Queue: "print_jobs:us", Materials: []string{"PLA"}})
+
+    if queue, ok := routeJob(ctx, "PLA", "eu", defaultNozzle, false); ok {
+        t.Fatalf("routeJob = %q, want no eu worker", queue)
+    }
+    queue, ok := routeJob(ctx, "PLA", "us", defaultNozzle, true)
+    if !ok || queue != "print_jobs:us:rush" {
+        t.Fatalf("routeJob = %q, %v; want print_jobs:us:rush", queue, ok)
+    }
+}
+
+func TestAdminQueuesGroupsByRegion(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.RegionRoutingEnabled = true
+        c.FairScheduling = false
+        c.AdminToken = "secret"
+    })
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    r := newRouter()
+    quoteJobID(t, r, regionQuote)
+
+    w := do(r, http.MethodGet, "/admin/queues", "", "Authorization", "Bearer secret")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+    var resp struct {
+        Regions map[string]map[string]int64 `json:"regions"`
+        Total   int64                       `json:"total"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if resp.Regions["eu"]["print_jobs:eu"] != 1 || resp.Total != 1 {
+        t.Fatalf("queues = %s, want one job on print_jobs:eu", w.Body)
+    }
+    if _, ok := resp.Regions["default"][standardQueue]; !ok {
+        t.Fatalf("queues = %s, want print_jobs under default", w.Body)
+    }
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "log"
+    "net/http"
+    "os"
+    "os/signal"
+    "reflect"
+    "strings"
+    "sync"
+    "syscall"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// configPath is where the config was loaded from, for reloads.
+var configPath = "config.yaml"
+
+// restartOnly are the Config fields read once while the server starts: the
+// Redis connection, secrets that sign cookies and sessions, and settings
+// baked into the router and background loops. A reload keeps their running
+// values.
+var restartOnly = []string{
+    "RedisURL", "CSRFAuthKey", "SessionSecret", "TrustedProxies",
+    "APITimeoutSeconds", "UploadTimeoutSeconds",
+    "AuditStreamMaxLen", "FairScheduling", "GRPCAddr",
+    "QueueBackend", "NATSURL", "NATSStream", "NATSSubjectPrefix", "NATSRetention", "NATSReplicas", "NATSMaxAgeHours",
+    "StorageBackend", "LocalStoragePath",
+}
+
+// reloadMu keeps reloads from SIGHUP and /admin/reload from interleaving.
+var reloadMu sync.Mutex
+
+// reloadConfig rereads the config file and environment and swaps the result
+// in. On error the running config stays. It returns the restart-only
+// settings whose new values were not applied.
+func reloadConfig() ([]string, error) {
+    reloadMu.Lock()
+    defer reloadMu.Unlock()
+    next, err := LoadConfig(configPath)
+    if err != nil {
+        log.Printf("ERROR config reload failed, keeping the running config: %v", err)
+        return nil, err
+    }
+    prev := cfg()
+    var kept []string
+    nv, pv := reflect.ValueOf(next).Elem(), reflect.ValueOf(prev).Elem()
+    for _, name := range restartOnly {
+        field := nv.FieldByName(name)
+        if !reflect.DeepEqual(field.Interface(), pv.FieldByName(name).Interface()) {
+            kept = append(kept, name)
+        }
+        field.Set(pv.FieldByName(name))
+    }
+    setConfig(next)
+    log.Printf("INFO config reloaded: %+v", next.Masked())
+    if len(kept) > 0 {
+        log.Printf("WARNING: config reload: %s only change on restart", strings.Join(kept, ", "))
+    }
+    return kept, nil
+}
+
+// reloadOnSIGHUP reloads the config whenever the process gets SIGHUP.
+func reloadOnSIGHUP() {
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    go func() {
+        for range hup {
+            reloadConfig()
+        }
+    }()
+}
+
+// POST /admin/reload does what SIGHUP does and reports the outcome.
+func handleReloadConfig(c *gin.Context) {
+    kept, err := reloadConfig()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Reload failed, running config unchanged: " + err.Error()})
+        return
+    }
+    if kept == nil {
+        kept = []string{}
+    }
+    c.JSON(http.StatusOK, gin.H{"reloaded": true, "restart_required": kept})
+}
+
+// configDerived caches what build makes of the active config until a reload
+// replaces it, for settings that are costly to interpret per request.
+type configDerived[T any] struct {
+    build func(*Config) T
+    mu    sync.Mutex
+    from  *Config
+    value T
+}
+
+func (d *configDerived[T]) get() T {
+    c := cfg()
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    if d.from != c {
+        d.value, d.from = d.build(c), c
+    }
+    return d.value
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "syscall"
+    "testing"
+    "time"
+)
+
+// writeConfigFile points reloads at a file holding yaml.
+func writeConfigFile(t *testing.T, yaml string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "config.yaml")
+    if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    saved := configPath
+    configPath = path
+    t.Cleanup(func() { configPath = saved })
+    return path
+}
+
+func TestAdminReloadConfig(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    r := newRouter()
+    writeConfigFile(t, "admin_token: secret\nqueue_warn_depth: 7\napi_timeout_seconds: 99\napi_keys:\n  k2: beta\n")
+    before := cfg()
+
+    w := do(r, http.MethodPost, "/admin/reload", "", "Authorization", "Bearer secret")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+    var resp struct {
+        RestartRequired []string `json:"restart_required"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if len(resp.RestartRequired) != 1 || resp.RestartRequired[0] != "APITimeoutSeconds" {
+        t.Errorf("restart_required = %v, want [APITimeoutSeconds]", resp.RestartRequired)
+    }
+    if cfg().QueueWarnDepth != 7 {
+        t.Errorf("queue_warn_depth = %d, want 7 after reload", cfg().QueueWarnDepth)
+    }
+    if cfg().APITimeoutSeconds != before.APITimeoutSeconds {
+        t.Errorf("api_timeout_seconds = %d, want the running %d", cfg().APITimeoutSeconds, before.APITimeoutSeconds)
+    }
+    if before.QueueWarnDepth == 7 {
+        t.Error("the previous config was changed in place")
+    }
+    // Derived settings follow the new config
+    if name, ok := apiKeyOwner("k2"); !ok || name != "beta" {
+        t.Errorf("apiKeyOwner(k2) = %q, %v; want beta from the reloaded keys", name, ok)
+    }
+}
+
+func TestReloadKeepsConfigOnError(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    r := newRouter()
+    writeConfigFile(t, "admin_token: secret\nallowed_ips: [not-a-cidr]\n")
+    before := cfg()
+
+    if w := do(r, http.MethodPost, "/admin/reload", "", "Authorization", "Bearer secret"); w.Code != http.StatusInternalServerError {
+        t.Fatalf("status = %d, want 500", w.Code)
+    }
+    if cfg() != before {
+        t.Error("a failed reload replaced the config")
+    }
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    writeConfigFile(t, "queue_warn_depth: 3\n")
+    reloadOnSIGHUP()
+    if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+        t.Fatal(err)
+    }
+    for deadline := time.Now().Add(2 * time.Second); cfg().QueueWarnDepth != 3; time.Sleep(5 * time.Millisecond) {
+        if time.Now().After(deadline) {
+            t.Fatal("SIGHUP didn't reload the config")
+        }
+    }
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "sort"
+    "strings"
+    "testing"
+)
+
+// bodyKeys lists the top-level fields of a JSON object body.
+func bodyKeys(t *testing.T, body string) []string {
+    t.Helper()
+    var m map[string]json.RawMessage
+    if err := json.Unmarshal([]byte(body), &m); err != nil {
+        t.Fatalf("body %s: %v", body, err)
+    }
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func TestTypedResponsesKeepFieldNames(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+
+    w := do(r, http.MethodPost, "/quote", `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`)
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("quote = %d %s", w.Code, w.Body)
+    }
+    want := "access_token expires_at job_id message queue_depths queue_position worker_online"
+    if got := strings.Join(bodyKeys(t, w.Body.String()), " "); got != want {
+        t.Errorf("quote fields = %s, want %s", got, want)
+    }
+    var quote struct {
+        JobID string `json:"job_id"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &quote)
+
+    reportStatus(t, r, quote.JobID, `{"status":"processing","step":"slicing"}`)
+    reportStatus(t, r, quote.JobID, `{"status":"completed","result":{"price":12.5}}`)
+    w = do(r, http.MethodGet, "/status/"+quote.JobID, "")
+    want = "completed_at created_at data expires_at job_id started_at status status_changed_at"
+    if got := strings.Join(bodyKeys(t, w.Body.String()), " "); got != want {
+        t.Errorf("status fields = %s, want %s", got, want)
+    }
+
+    w = do(r, http.MethodGet, "/status/nope", "")
+    if got := strings.Join(bodyKeys(t, w.Body.String()), " "); w.Code != http.StatusNotFound || got != "error" {
+        t.Errorf("error body = %d %s, want 404 with only error", w.Code, w.Body)
+    }
+}
+
+func TestUploadResponseModelInfo(t *testing.T) {
+    localStorage(t)
+    w := uploadFile(t, newRouter(), "Bracket.STL", "solid bracket")
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("upload = %d %s", w.Code, w.Body)
+    }
+    var resp struct {
+        ModelInfo struct {
+            Filename  string `json:"filename"`
+            SizeBytes int64  `json:"size_bytes"`
+            Format    string `json:"format"`
+        } `json:"model_info"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if m := resp.ModelInfo; m.Filename != "Bracket.STL" || m.SizeBytes != 13 || m.Format != "stl" {
+        t.Fatalf("model_info = %+v", m)
+    }
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+
+    "slicer-api/internal/api"
+)
+
+// retryCountKey counts the resubmissions of an original job. Retries of a
+// retry count against the original, so chains can't go on forever.
+func retryCountKey(originalID string) string {
+    return "retry_count:" + originalID
+}
+
+// POST /jobs/:id/retry resubmits a finished job as a new one, with the same
+// file and parameters and "retry_of" naming the original. Each original may
+// be retried MAX_MANUAL_RETRIES times.
+//
+//	@Summary	Resubmit a finished job
+//	@Produce	json
+//	@Param		id	path		string	true	"Job ID"
+//	@Success	202	{object}	api.SubmitJobResponse
+//	@Failure	404	{object}	api.ErrorResponse
+//	@Failure	409	{object}	api.ErrorResponse	"The job hasn't finished, or was retried too often"
+//	@Failure	410	{object}	api.ErrorResponse	"The job's file or parameters are gone"
+//	@Router		/jobs/{id}/retry [post]
+func handleRetryJob(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    raw, err := rdb.Get(ctx, "status:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if !authorizeJob(c, jobID) {
+        return
+    }
+    if !parseJobStatus(raw).IsTerminal() {
+        c.JSON(http.StatusConflict, gin.H{"error": "Only finished jobs can be retried", "status": raw})
+        return
+    }
+    payload, err := rdb.Get(ctx, "params:"+jobID).Bytes()
+    if err != nil {
+        c.JSON(http.StatusGone, api.ErrorResponse{Error: "The job's parameters are no longer stored; submit it again"})
+        return
+    }
+    job, err := readPayload(payload)
+    if err != nil {
+        c.JSON(http.StatusGone, api.ErrorResponse{Error: "The job's parameters are no longer stored; submit it again"})
+        return
+    }
+
+    downloadURL, _ := job["download_url"].(string)
+    if stored, err := activeStorage().Exists(ctx, downloadURL); err != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Couldn't check the stored file: " + err.Error()})
+        return
+    } else if !stored {
+        c.JSON(http.StatusGone, api.ErrorResponse{Error: "The uploaded file has been cleaned up; upload it again"})
+        return
+    }
+
+    spec := resubmissionSpec(job)
+    queue, ok := routeJob(ctx, spec.Material, spec.Region, spec.Nozzle, spec.Rush)
+    if !ok {
+        noCapableWorker(c)
+        return
+    }
+    spec.Queue = queue
+    busy, ok := checkBackpressure(c)
+    if !ok {
+        return
+    }
+
+    // Counted last, so refusals above don't use up retries
+    original := spec.RetryOf
+    countKey := retryCountKey(original)
+    n, err := rdb.Incr(ctx, countKey).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    rdb.Expire(ctx, countKey, 24*time.Hour)
+    if n > int64(cfg().MaxManualRetries) {
+        rdb.Decr(ctx, countKey)
+        c.JSON(http.StatusConflict, gin.H{"error": "Job " + original + " was already retried " + strconv.Itoa(cfg().MaxManualRetries) + " times", "retry_of": original})
+        return
+    }
+    charge, ok := chargeQuota(c, 0)
+    if !ok {
+        rdb.Decr(ctx, countKey)
+        return
+    }
+    defer refundQuota(c, charge)
+
+    newID := spec.ID
+    jobData := newJobPayload(spec)
+    if _, err := setStatus(ctx, newID, StatusQueued, 24*time.Hour); err != nil {
+        rdb.Decr(ctx, countKey)
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to queue job"})
+        return
+    }
+    if err := submitJob(ctx, queue, newID, spec.OwnerID, marshalPayload(jobData)); err != nil {
+        rdb.Del(ctx, "status:"+newID)
+        rdb.Decr(ctx, countKey)
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to queue job"})
+        return
+    }
+    if spec.CallbackURL != "" {
+        secret, _ := rdb.HGet(ctx, callbackKey(jobID), "secret").Result()
+        registerCallback(ctx, newID, spec.CallbackURL, secret)
+    }
+
+    if address, err := rdb.HGet(ctx, notifyEmailKey(jobID), "address").Result(); err == nil {
+        registerNotifyEmail(ctx, newID, address)
+    }
+    recordCreated(ctx, newID, jobData)
+    publishStatus(ctx, newID, string(StatusQueued), "retry of "+jobID)
+    recordHistory(ctx, jobID, "retried", "as "+newID)
+    submitted := auditEventFor(c, auditJobSubmitted, newID, spec.OwnerID)
+    submitted.After = "queued"
+    audit.Record(ctx, submitted)
+    countSubmission(ctx)
+    fireWebhooks(spec.OwnerID, "job.submitted", newID, jobData)
+
+    online := workerOnline(ctx)
+    response := api.SubmitJobResponse{
+        JobID:        newID,
+        AccessToken:  accessToken(c, newID),
+        Message:      "Job resubmitted. Poll " + statusPath(c, newID) + " for results.",
+        RetryOf:      original,
+        WorkerOnline: &online,
+        ExpiresAt:    jobExpiry(24 * time.Hour),
+        QueueWarning: busy,
+    }
+    if position, err := queuePosition(ctx, newID); err == nil && position >= 0 {
+        response.QueuePosition = &position
+    }
+    c.JSON(http.StatusAccepted, response)
+}
+
+// resubmissionSpec is a new job with the payload's file and parameters.
+// A scheduled original runs now; its queue is routed afresh.
+func resubmissionSpec(job map[string]interface{}) jobSpec {
+    str := func(key string) string {
+        s, _ := job[key].(string)
+        return s
+    }
+    num := func(key string) float64 {
+        f, _ := job[key].(float64)
+        return f
+    }
+    spec := jobSpec{
+        ID:          uuid.New().String(),
+        DownloadURL: str("download_url"),
+        Material:    str("material"),
+        LayerHeight: num("layer_height"),
+        Infill:      int(num("infill")),
+        Nozzle:      num("nozzle"),
+        BedAdhesion: str("bed_adhesion"),
+        Region:      str("region"),
+        MaxRetries:  jobMaxRetries(job),
+        Deadline:    time.Duration(num("deadline_seconds")) * time.Second,
+        OwnerID:     str("owner_id"),
+        CacheKey:    str("cache_key"),
+        CallbackURL: str("callback_url"),
+        RetryOf:     str("retry_of"),
+    }
+    spec.Rush, _ = job["rush"].(bool)
+    if spec.RetryOf == "" {
+        spec.RetryOf = str("id")
+    }
+    if feats, ok := job["features"].([]interface{}); ok {
+        for _, f := range feats {
+            if s, ok := f.(string); ok {
+                spec.Features = append(spec.Features, s)
+            }
+        }
+    }
+    return spec
+}
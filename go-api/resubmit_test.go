@@ -0,0 +1,156 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "slicer-api/internal/api"
+)
+
+// submitForRetry queues a /quote job and marks it status, returning its ID
+// and access token.
+func submitForRetry(t *testing.T, h http.Handler, status string) (string, string) {
+    t.Helper()
+    w := do(h, http.MethodPost, "/quote", versionQuote)
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("quote = %d %s", w.Code, w.Body)
+    }
+    var resp api.SubmitJobResponse
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    rdb.Set(ctx, "status:"+resp.JobID, status, 0)
+    return resp.JobID, resp.AccessToken
+}
+
+func retryJob(h http.Handler, jobID, token string) *httptest.ResponseRecorder {
+    return do(h, http.MethodPost, "/jobs/"+jobID+"/retry", "", jobTokenHeader, token)
+}
+
+func TestRetryFailedJob(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    jobID, token := submitForRetry(t, r, "failed")
+
+    w := retryJob(r, jobID, token)
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("retry = %d %s, want 202", w.Code, w.Body)
+    }
+    var resp api.SubmitJobResponse
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if resp.JobID == "" || resp.JobID == jobID || resp.RetryOf != jobID {
+        t.Fatalf("retry = %+v, want a new job with retry_of %s", resp, jobID)
+    }
+    if got := rdb.Get(ctx, "status:"+resp.JobID).Val(); got != "queued" {
+        t.Errorf("new job status = %q, want queued", got)
+    }
+
+    raw, _ := rdb.Get(ctx, "params:"+resp.JobID).Bytes()
+    job, err := readPayload(raw)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if job["download_url"] != "https://example.com/part.stl" || job["material"] != "PLA" || job["infill"] != float64(20) || job["retry_of"] != jobID {
+        t.Errorf("new payload = %v, want the original's file and parameters", job)
+    }
+    if !strings.Contains(rdb.LIndex(ctx, "history:"+jobID, -1).Val(), `"retried"`) {
+        t.Errorf("original's history doesn't record the retry")
+    }
+}
+
+func TestRetryRefusesUnfinishedJob(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    jobID, token := submitForRetry(t, r, "processing")
+
+    if w := retryJob(r, jobID, token); w.Code != http.StatusConflict {
+        t.Errorf("retry of a processing job = %d, want 409", w.Code)
+    }
+    if w := retryJob(r, jobID, "wrong"); w.Code != http.StatusForbidden {
+        t.Errorf("retry without the job's token = %d, want 403", w.Code)
+    }
+    if w := retryJob(r, "missing", token); w.Code != http.StatusNotFound {
+        t.Errorf("retry of an unknown job = %d, want 404", w.Code)
+    }
+}
+
+func TestRetryCountsAgainstOriginal(t *testing.T) {
+    setupTest(t, func(c *Config) { c.MaxManualRetries = 2 })
+    r := newRouter()
+    jobID, token := submitForRetry(t, r, "failed")
+
+    w := retryJob(r, jobID, token)
+    var first api.SubmitJobResponse
+    json.Unmarshal(w.Body.Bytes(), &first)
+    rdb.Set(ctx, "status:"+first.JobID, "failed", 0)
+
+    // A retry of the retry still names, and counts against, the original
+    w = retryJob(r, first.JobID, first.AccessToken)
+    var second api.SubmitJobResponse
+    json.Unmarshal(w.Body.Bytes(), &second)
+    if w.Code != http.StatusAccepted || second.RetryOf != jobID {
+        t.Fatalf("second retry = %d %s, want 202 with retry_of %s", w.Code, w.Body, jobID)
+    }
+
+    if w := retryJob(r, jobID, token); w.Code != http.StatusConflict {
+        t.Errorf("third retry = %d %s, want 409", w.Code, w.Body)
+    }
+}
+
+func TestRetryGoneParameters(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    jobID, token := submitForRetry(t, r, "cancelled")
+    rdb.Del(ctx, "params:"+jobID)
+
+    if w := retryJob(r, jobID, token); w.Code != http.StatusGone {
+        t.Errorf("retry without params = %d, want 410", w.Code)
+    }
+}
+
+func TestRetryCleanedUpUpload(t *testing.T) {
+    dir := localStorage(t)
+    r := newRouter()
+
+    w := uploadFile(t, r, "bracket.stl", "solid bracket")
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("upload = %d %s", w.Code, w.Body)
+    }
+    var up api.UploadResponse
+    json.Unmarshal(w.Body.Bytes(), &up)
+    rdb.Set(ctx, "status:"+up.JobID, "failed", 0)
+    os.Remove(filepath.Join(dir, up.JobID+".stl"))
+
+    if w := retryJob(r, up.JobID, up.AccessToken); w.Code != http.StatusGone {
+        t.Errorf("retry after cleanup = %d %s, want 410", w.Code, w.Body)
+    }
+    if n := rdb.Get(ctx, retryCountKey(up.JobID)).Val(); n != "" {
+        t.Errorf("retry count = %q after a refusal, want none used", n)
+    }
+}
+
+func TestTmpfilesExists(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/dl/1/gone.stl" {
+            w.WriteHeader(http.StatusNotFound)
+        }
+    }))
+    defer srv.Close()
+    saved := storageUploadURL
+    storageUploadURL = srv.URL + "/api/v1/upload"
+    t.Cleanup(func() { storageUploadURL = saved })
+
+    for url, want := range map[string]bool{
+        srv.URL + "/dl/1/part.stl":     true,
+        srv.URL + "/dl/1/gone.stl":     false,
+        "https://example.com/gone.stl": true,
+    } {
+        got, err := TmpfilesStorage{}.Exists(ctx, url)
+        if err != nil || got != want {
+            t.Errorf("Exists(%s) = %v, %v, want %v", url, got, err, want)
+        }
+    }
+}
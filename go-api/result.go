@@ -0,0 +1,172 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "slicer-api/internal/api"
+)
+
+// Result is what customers see of a worker's result, as "data" in /status,
+// status streams and share links. Workers write whatever they like to
+// result:{id}; only its fields are passed on, so debugging output such as
+// file paths stays inside.
+type Result = api.Result
+
+// workerResult is every shape of result workers have written: the Result
+// fields themselves, and the bundled worker's summary, error and reason.
+type workerResult struct {
+    Price            *float64 `json:"price"`
+    EstimatedPrice   *float64 `json:"estimated_price"`
+    Currency         string   `json:"currency"`
+    PrintTimeSeconds *float64 `json:"print_time_seconds"`
+    FilamentGrams    *float64 `json:"filament_grams"`
+    FilamentMeters   *float64 `json:"filament_meters"`
+    FilamentCM3      *float64 `json:"filament_cm3"`
+    Filament         struct {
+        Grams  *float64 `json:"grams"`
+        Meters *float64 `json:"meters"`
+        CM3    *float64 `json:"cm3"`
+    } `json:"filament"`
+    Material     string `json:"material"`
+    ErrorCode    string `json:"error_code"`
+    ErrorMessage string `json:"error_message"`
+    Reason       string `json:"reason"`
+    Error        string `json:"error"`
+    GcodeURL     string `json:"gcode_url"`
+    Summary      struct {
+        TotalCost        *float64 `json:"total_cost"`
+        PrintTime        string   `json:"print_time"`
+        PrintTimeSeconds *float64 `json:"print_time_seconds"`
+        Material         string   `json:"material"`
+    } `json:"summary"`
+    // Older bundled workers' breakdowns
+    Slicing struct {
+        FilamentUsedMM    *float64 `json:"filament_used_mm"`
+        FilamentUsedGrams *float64 `json:"filament_used_grams"`
+    } `json:"slicing"`
+    Pricing struct {
+        FilamentWeightGrams *float64 `json:"filament_weight_grams"`
+        Material            string   `json:"material"`
+    } `json:"pricing"`
+}
+
+var (
+    currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+    // printTimePattern reads the slicer's "1d 2h 30m 45s"
+    printTimePattern = regexp.MustCompile(`^\s*(?:(\d+)d\s*)?(?:(\d+)h\s*)?(?:(\d+)m\s*)?(?:(\d+)s)?\s*$`)
+    // pathPattern finds absolute paths in error messages, keeping the file
+    // name
+    pathPattern = regexp.MustCompile(`(?:/[^\s/'":]+)+/([^\s/'":]+)`)
+)
+
+// errorMessageMax caps the error message shown to customers.
+const errorMessageMax = 500
+
+// parseResult validates a worker's result and normalizes it to a Result.
+func parseResult(raw []byte) (Result, error) {
+    var w workerResult
+    if err := json.Unmarshal(raw, &w); err != nil {
+        return Result{}, err
+    }
+
+    var r Result
+    r.Price = firstSet(w.Price, w.Summary.TotalCost, w.EstimatedPrice)
+    if r.Price != nil {
+        if math.IsNaN(*r.Price) || math.IsInf(*r.Price, 0) || *r.Price < 0 {
+            return Result{}, fmt.Errorf("price %v is not a price", *r.Price)
+        }
+        r.Currency = w.Currency
+        if r.Currency == "" {
+            r.Currency = invoiceCurrency
+        }
+    }
+    if r.Currency != "" && !currencyPattern.MatchString(r.Currency) {
+        return Result{}, fmt.Errorf("currency %q is not an ISO 4217 code", r.Currency)
+    }
+
+    seconds := firstSet(w.PrintTimeSeconds, w.Summary.PrintTimeSeconds)
+    if seconds == nil && w.Summary.PrintTime != "" {
+        if s, ok := parsePrintTime(w.Summary.PrintTime); ok {
+            f := float64(s)
+            seconds = &f
+        }
+    }
+    if seconds != nil {
+        if *seconds < 0 || *seconds > math.MaxInt32 {
+            return Result{}, fmt.Errorf("print_time_seconds %v is out of range", *seconds)
+        }
+        s := int64(math.Round(*seconds))
+        r.PrintTimeSeconds = &s
+    }
+
+    filament, err := normalizeFilament(w)
+    if err != nil {
+        return Result{}, err
+    }
+    if filament != nil {
+        r.Filament, r.FilamentGrams, r.FilamentMeters = filament, filament.Grams, filament.Meters
+    }
+    r.GcodeAvailable = w.GcodeURL != ""
+
+    r.ErrorCode = w.ErrorCode
+    if r.ErrorCode == "" {
+        r.ErrorCode = w.Reason
+    }
+    r.ErrorMessage = w.ErrorMessage
+    if r.ErrorMessage == "" {
+        r.ErrorMessage = w.Error
+    }
+    r.ErrorMessage = pathPattern.ReplaceAllString(r.ErrorMessage, "$1")
+    if len(r.ErrorMessage) > errorMessageMax {
+        r.ErrorMessage = strings.ToValidUTF8(r.ErrorMessage[:errorMessageMax], "")
+    }
+    if r.ErrorCode != "" || r.ErrorMessage != "" {
+        r.ErrorCode = normalizeErrorCode(r.ErrorCode)
+        e := jobErrors[r.ErrorCode]
+        r.ErrorDescription, r.UserActionable = e.message, &e.actionable
+    }
+    return r, nil
+}
+
+func firstSet(vs ...*float64) *float64 {
+    for _, v := range vs {
+        if v != nil {
+            return v
+        }
+    }
+    return nil
+}
+
+// parsePrintTime reads the slicer's print time, e.g. "4h 15m", as seconds.
+func parsePrintTime(s string) (int64, bool) {
+    m := printTimePattern.FindStringSubmatch(s)
+    if m == nil {
+        return 0, false
+    }
+    var total int64
+    for i, unit := range []int64{86400, 3600, 60, 1} {
+        if m[i+1] == "" {
+            continue
+        }
+        n, _ := strconv.ParseInt(m[i+1], 10, 64)
+        total += n * unit
+    }
+    return total, true
+}
+
+// exposedResult is jobID's result as customers may see it. A result that
+// doesn't validate is logged with its raw payload and left out.
+func exposedResult(jobID, raw string) (Result, bool) {
+    r, err := parseResult([]byte(raw))
+    if err != nil {
+        log.Printf("WARN result of %s failed validation, not shown: %v: %s", jobID, err, raw)
+        return Result{}, false
+    }
+    return r, true
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// No overall timeout: G-code files can be hundreds of MB, the request context
+// cancels the upstream call when the client goes away.
+var storageClient = &http.Client{}
+
+var errBadRange = errors.New("invalid range")
+
+// byteRange is an inclusive [start, end] range, as in Content-Range.
+type byteRange struct {
+    start, end int64
+}
+
+// parseRange parses a single "bytes=" range against a known size. Multi-range
+// requests are not supported and are treated as invalid.
+func parseRange(header string, size int64) (byteRange, error) {
+    spec, ok := strings.CutPrefix(header, "bytes=")
+    if !ok || strings.Contains(spec, ",") {
+        return byteRange{}, errBadRange
+    }
+    startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+    if !ok {
+        return byteRange{}, errBadRange
+    }
+
+    if startStr == "" {
+        // Suffix range: last N bytes
+        n, err := strconv.ParseInt(endStr, 10, 64)
+        if err != nil || n <= 0 {
+            return byteRange{}, errBadRange
+        }
+        if n > size {
+            n = size
+        }
+        return byteRange{size - n, size - 1}, nil
+    }
+
+    start, err := strconv.ParseInt(startStr, 10, 64)
+    if err != nil || start < 0 || start >= size {
+        return byteRange{}, errBadRange
+    }
+    end := size - 1
+    if endStr != "" {
+        end, err = strconv.ParseInt(endStr, 10, 64)
+        if err != nil || end < start {
+            return byteRange{}, errBadRange
+        }
+        if end > size-1 {
+            end = size - 1
+        }
+    }
+    return byteRange{start, end}, nil
+}
+
+// gcodeURL looks up the upstream G-code location the worker stored in the result.
+func gcodeURL(ctx context.Context, jobID string) (string, error) {
+    res, err := rdb.Get(ctx, "result:"+jobID).Result()
+    if err != nil {
+        return "", err
+    }
+    var result struct {
+        GcodeURL string `json:"gcode_url"`
+    }
+    if err := json.Unmarshal([]byte(res), &result); err != nil {
+        return "", err
+    }
+    return result.GcodeURL, nil
+}
+
+// gcodeMissing answers 404 for a G-code that isn't there, with why.
+func gcodeMissing(c *gin.Context, reason, message string) {
+    c.JSON(http.StatusNotFound, gin.H{"error": message, "reason": reason})
+}
+
+// proxyGcode streams the sliced G-code from upstream storage, honouring a
+// Range header when the upstream supports byte ranges.
+func proxyGcode(c *gin.Context, jobID, url string) {
+    // HEAD first so the range can be validated against the real size
+    head, err := http.NewRequestWithContext(c.Request.Context(), http.MethodHead, url, nil)
+    if err != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Invalid storage URL"})
+        return
+    }
+    headResp, err := storageClient.Do(head)
+    if err != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Storage connection failed: " + err.Error()})
+        return
+    }
+    headResp.Body.Close()
+    if headResp.StatusCode == http.StatusNotFound || headResp.StatusCode == http.StatusGone {
+        gcodeMissing(c, gcodeExpired, "The G-code has expired from storage; retry the job to slice it again")
+        return
+    }
+    if headResp.StatusCode != http.StatusOK {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Storage returned " + headResp.Status})
+        return
+    }
+    size := headResp.ContentLength
+    rangeSupported := headResp.Header.Get("Accept-Ranges") == "bytes" && size > 0
+
+    rangeHeader := c.GetHeader("Range")
+    var br byteRange
+    partial := false
+    if rangeHeader != "" {
+        if !rangeSupported {
+            c.Header("Warning", `199 - "upstream storage does not support range requests, sending full file"`)
+        } else {
+            br, err = parseRange(rangeHeader, size)
+            if err != nil {
+                c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+                c.JSON(http.StatusRequestedRangeNotSatisfiable, api.ErrorResponse{Error: "Invalid Range header"})
+                return
+            }
+            partial = true
+        }
+    }
+
+    get, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, url, nil)
+    if partial {
+        get.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", br.start, br.end))
+    }
+    resp, err := storageClient.Do(get)
+    if err != nil {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Storage connection failed: " + err.Error()})
+        return
+    }
+    defer resp.Body.Close()
+
+    // Upstream advertised ranges but ignored ours: fall back to the full file
+    if partial && resp.StatusCode != http.StatusPartialContent {
+        partial = false
+        c.Header("Warning", `199 - "upstream storage ignored the range request, sending full file"`)
+    }
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+        c.JSON(http.StatusBadGateway, api.ErrorResponse{Error: "Storage returned " + resp.Status})
+        return
+    }
+
+    c.Header("Content-Type", "text/x.gcode")
+    c.Header("Content-Disposition", `attachment; filename="`+jobID+`.gcode"`)
+    if rangeSupported {
+        c.Header("Accept-Ranges", "bytes")
+    }
+    if partial {
+        c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", br.start, br.end, size))
+        c.Header("Content-Length", strconv.FormatInt(br.end-br.start+1, 10))
+        c.Status(http.StatusPartialContent)
+    } else {
+        if resp.ContentLength >= 0 {
+            c.Header("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+        }
+        c.Status(http.StatusOK)
+    }
+    io.Copy(c.Writer, resp.Body)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "log"
+    "net/http"
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestParseResultNormalizes(t *testing.T) {
+    tests := []struct {
+        name, raw string
+        want      string
+    }{
+        {"typed", `{"price":12.5,"currency":"EUR","print_time_seconds":3600,"filament_grams":40.2,"filament_meters":13.1}`,
+            `{"price":12.5,"currency":"EUR","print_time_seconds":3600,"filament":{"grams":40.2,"meters":13.1,"cm3":31.51,"measured":["grams","meters"],"derived":["cm3"]},"filament_grams":40.2,"filament_meters":13.1}`},
+        {"bundled worker", `{"success":true,"job_id":"j1","summary":{"total_cost":24.9,"print_time":"4h 15m","material":"PLA"}}`,
+            `{"price":24.9,"currency":"USD","print_time_seconds":15300}`},
+        {"estimated price", `{"estimated_price":3}`, `{"price":3,"currency":"USD"}`},
+        {"unknown fields dropped", `{"price":1,"debug":{"stl":"/srv/jobs/j1/model.stl"},"config_path":"/etc/slicer.ini"}`, `{"price":1,"currency":"USD"}`},
+        {"empty", `{}`, `{}`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r, err := parseResult([]byte(tt.raw))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got, _ := json.Marshal(r); string(got) != tt.want {
+                t.Fatalf("got %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseResultRejects(t *testing.T) {
+    for _, raw := range []string{
+        `not json`,
+        `{"price":"twelve"}`,
+        `{"price":-1}`,
+        `{"price":1,"currency":"dollars"}`,
+        `{"print_time_seconds":-5}`,
+        `{"filament_grams":-0.5}`,
+    } {
+        if r, err := parseResult([]byte(raw)); err == nil {
+            t.Errorf("%s: accepted as %+v", raw, r)
+        }
+    }
+}
+
+func TestParseResultErrorCodes(t *testing.T) {
+    tests := []struct {
+        name, raw     string
+        code, message string
+        actionable    bool
+    }{
+        {"reason", `{"success":false,"reason":"download_failed","error":"404"}`, errDownloadFailed, "404", true},
+        {"error_code", `{"error_code":"geometry_error","error":"Mesh validation failed: not watertight"}`, errGeometry, "Mesh validation failed: not watertight", true},
+        {"crash", `{"error_code":"slicer_crash","error":"Slicer failed: segfault"}`, errSlicerCrash, "Slicer failed: segfault", false},
+        {"unknown code", `{"error_code":"disk_full","error":"No space left"}`, errInternal, "No space left", false},
+        {"free text reason", `{"reason":"The mesh at /tmp/x.stl is broken"}`, errInternal, "", false},
+        {"no code", `{"error":"Slicing error: cannot open /tmp/prusa/j1/model.stl"}`, errInternal, "Slicing error: cannot open model.stl", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r, err := parseResult([]byte(tt.raw))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if r.ErrorCode != tt.code || r.ErrorMessage != tt.message {
+                t.Errorf("error_code, error_message = %q, %q, want %q, %q", r.ErrorCode, r.ErrorMessage, tt.code, tt.message)
+            }
+            if r.ErrorDescription != jobErrors[tt.code].message || r.UserActionable == nil || *r.UserActionable != tt.actionable {
+                t.Errorf("error_description, user_actionable = %q, %v, want %q, %v", r.ErrorDescription, r.UserActionable, jobErrors[tt.code].message, tt.actionable)
+            }
+        })
+    }
+
+    r, _ := parseResult([]byte(`{"price":1}`))
+    if r.ErrorCode != "" || r.ErrorDescription != "" || r.UserActionable != nil {
+        t.Errorf("success = %+v, want no error fields", r)
+    }
+}
+
+func TestStatusShowsErrorCode(t *testing.T) {
+    setupTest(t)
+    rdb.Set(ctx, "status:j1", "failed", 0)
+    rdb.Set(ctx, "result:j1", `{"success":false,"error_code":"unsupported_format","error":"Unsupported format .dwg"}`, 0)
+
+    w := do(newRouter(), http.MethodGet, "/status/j1", "")
+    var body struct {
+        Data Result `json:"data"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &body)
+    if body.Data.ErrorCode != errUnsupportedFormat || body.Data.ErrorDescription == "" || body.Data.UserActionable == nil || !*body.Data.UserActionable {
+        t.Errorf("data = %s, want unsupported_format as actionable", w.Body)
+    }
+}
+
+func TestStatusOmitsInvalidResult(t *testing.T) {
+    setupTest(t)
+    rdb.Set(ctx, "status:j1", "completed", 0)
+    rdb.Set(ctx, "result:j1", `{"price":"/home/worker/secret.txt"}`, 0)
+
+    var logged bytes.Buffer
+    log.SetOutput(&logged)
+    t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+    w := do(newRouter(), http.MethodGet, "/status/j1", "")
+    var body map[string]interface{}
+    json.Unmarshal(w.Body.Bytes(), &body)
+    if w.Code != http.StatusOK || body["status"] != "completed" {
+        t.Fatalf("status = %d %s", w.Code, w.Body)
+    }
+    if _, ok := body["data"]; ok || strings.Contains(w.Body.String(), "secret") {
+        t.Fatalf("invalid result shown: %s", w.Body)
+    }
+    if !strings.Contains(logged.String(), "failed validation") || !strings.Contains(logged.String(), "secret.txt") {
+        t.Fatalf("log = %q, want a warning with the raw result", logged.String())
+    }
+}
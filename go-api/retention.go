@@ -0,0 +1,132 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// A job is kept for a day while it waits and runs. Once it finishes, all of
+// its keys are given RESULT_TTL_COMPLETED_HOURS or RESULT_TTL_FAILED_HOURS,
+// so its result doesn't outlive its status or the other way around.
+// POST /jobs/:id/extend keeps it longer, up to RESULT_TTL_MAX_HOURS past
+// its completed_at.
+
+// retainedJobKeys are the keys that live as long as the job's status.
+// progress:{id} isn't one: it lingers only briefly after the job finishes.
+func retainedJobKeys(jobID string) []string {
+    return []string{
+        "status:" + jobID, "result:" + jobID, "params:" + jobID, "note:" + jobID,
+        "attempts:" + jobID, "next_retry_at:" + jobID, "cached:" + jobID, "aborted_at:" + jobID,
+        "created_at:" + jobID, "started_at:" + jobID, "completed_at:" + jobID,
+        "history:" + jobID, statusChangedKey(jobID), "tags:" + jobID, "priority_override:" + jobID,
+        callbackKey(jobID), notifyEmailKey(jobID), thumbnailKey(jobID), acceptedKey(jobID),
+        accessTokenKey(jobID), subscriptionStatusKey(jobID), logStreamKey(jobID), progressHistoryKey(jobID),
+    }
+}
+
+// retainJob gives each of jobID's keys ttl, and keeps its tags' indexes and
+// its stored upload at least as long.
+func retainJob(ctx context.Context, jobID string, ttl time.Duration) error {
+    pipe := rdb.TxPipeline()
+    for _, key := range retainedJobKeys(jobID) {
+        pipe.Expire(ctx, key, ttl)
+    }
+    tags := pipe.SMembers(ctx, "tags:"+jobID)
+    if _, err := pipe.Exec(ctx); err != nil {
+        return err
+    }
+    retainUpload(ctx, jobID, ttl)
+    for _, t := range tags.Val() {
+        if left, _ := rdb.TTL(ctx, "tagged:"+t).Result(); left < ttl {
+            rdb.Expire(ctx, "tagged:"+t, ttl)
+        }
+    }
+    return nil
+}
+
+// retainFinishedJob applies the retention for status once the job has
+// finished with it; publishStatus calls it for every status.
+func retainFinishedJob(ctx context.Context, jobID, status string) {
+    if s := parseJobStatus(status); s.IsTerminal() {
+        retainJob(ctx, jobID, cfg().ResultTTL(s))
+    }
+}
+
+// jobListRetention is how long an owner's index keeps a job: a day for it
+// to wait, a day to run and as long as it may then be kept.
+func jobListRetention() time.Duration {
+    return 48*time.Hour + cfg().ResultTTLMax()
+}
+
+// POST /jobs/:id/extend {"hours": 72} keeps a finished job for another
+// hours, by default its status's retention. It never shortens what the job
+// has left, and stops at RESULT_TTL_MAX_HOURS past its completed_at.
+func handleExtendJob(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+    var req struct {
+        Hours *int `json:"hours"`
+    }
+    if c.Request.ContentLength != 0 {
+        if err := c.ShouldBindJSON(&req); err != nil {
+            c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+            return
+        }
+    }
+    if req.Hours != nil && *req.Hours <= 0 {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "hours must be positive"})
+        return
+    }
+
+    vals, err := rdb.MGet(ctx, "status:"+jobID, "completed_at:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    raw, _ := vals[0].(string)
+    if raw == "" {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if !authorizeJob(c, jobID) {
+        return
+    }
+    status := parseJobStatus(raw)
+    if !status.IsTerminal() {
+        c.JSON(http.StatusConflict, gin.H{"error": "Job is " + raw + "; only finished jobs can be extended", "status": raw})
+        return
+    }
+
+    want := cfg().ResultTTL(status)
+    if req.Hours != nil {
+        want = time.Duration(*req.Hours) * time.Hour
+    }
+    finishedAt := time.Now()
+    if at, _ := vals[1].(string); at != "" {
+        if t, err := time.Parse(time.RFC3339, at); err == nil {
+            finishedAt = t
+        }
+    }
+    limit := time.Until(finishedAt.Add(cfg().ResultTTLMax()))
+    capped := want > limit
+    if capped {
+        want = limit
+    }
+    ttl := jobTTL(ctx, jobID)
+    if want > ttl {
+        if err := retainJob(ctx, jobID, want); err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+        ttl = want
+    }
+    expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second).Format(time.RFC3339)
+    recordHistory(ctx, jobID, "extended", "kept until "+expiresAt)
+
+    c.JSON(http.StatusOK, gin.H{"job_id": jobID, "status": raw, "expires_at": expiresAt, "capped": capped})
+}
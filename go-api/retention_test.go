@@ -0,0 +1,107 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestFinishedJobsTakeTheirRetention(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.InternalSecret = "s"
+        c.ResultTTLCompletedHours = 48
+        c.ResultTTLFailedHours = 2
+    })
+    r := newRouter()
+    _, done, _ := quoteJobID(t, r, `{"download_url":"https://example.com/a.stl","material":"PLA","infill":20}`)
+    _, failed, _ := quoteJobID(t, r, `{"download_url":"https://example.com/b.stl","material":"PLA","infill":25}`)
+    for _, id := range []string{done, failed} {
+        reportStatus(t, r, id, `{"status":"processing"}`)
+    }
+    if ttl := rdb.TTL(ctx, "history:"+done).Val(); ttl > 24*time.Hour {
+        t.Fatalf("history TTL = %s while processing, want a day", ttl)
+    }
+    reportStatus(t, r, done, `{"status":"completed","result":{"price":1}}`)
+    reportStatus(t, r, failed, `{"status":"failed","result":{"error":"bad mesh"}}`)
+
+    for id, want := range map[string]time.Duration{done: 48 * time.Hour, failed: 2 * time.Hour} {
+        for _, key := range []string{"status:" + id, "result:" + id, "params:" + id, "history:" + id, "created_at:" + id, "completed_at:" + id, statusChangedKey(id)} {
+            if ttl := rdb.TTL(ctx, key).Val(); ttl <= want-time.Minute || ttl > want {
+                t.Errorf("%s TTL = %s, want %s", key, ttl, want)
+            }
+        }
+    }
+
+    var status struct {
+        ExpiresAt string `json:"expires_at"`
+    }
+    w := do(r, http.MethodGet, "/status/"+done, "")
+    json.Unmarshal(w.Body.Bytes(), &status)
+    if at, err := time.Parse(time.RFC3339, status.ExpiresAt); err != nil || time.Until(at) < 47*time.Hour {
+        t.Errorf("expires_at = %q, want two days out", status.ExpiresAt)
+    }
+}
+
+func TestExtendJob(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.InternalSecret = "s"
+        c.ResultTTLMaxHours = 100
+    })
+    r := newRouter()
+    id, token := submitForCancel(t, r)
+    rdb.SAdd(ctx, "tags:"+id, "keep")
+    rdb.SAdd(ctx, "tagged:keep", id)
+    rdb.Expire(ctx, "tagged:keep", time.Hour)
+
+    if w := do(r, http.MethodPost, "/jobs/"+id+"/extend", `{"hours":48}`, jobTokenHeader, token); w.Code != http.StatusConflict {
+        t.Fatalf("queued job: %d %s, want 409", w.Code, w.Body)
+    }
+    reportStatus(t, r, id, `{"status":"processing"}`)
+    reportStatus(t, r, id, `{"status":"completed","result":{"price":1}}`)
+
+    extend := func(body string) (int, bool) {
+        t.Helper()
+        w := do(r, http.MethodPost, "/jobs/"+id+"/extend", body, jobTokenHeader, token)
+        var resp struct {
+            ExpiresAt string `json:"expires_at"`
+            Capped    bool   `json:"capped"`
+        }
+        json.Unmarshal(w.Body.Bytes(), &resp)
+        if w.Code == http.StatusOK && resp.ExpiresAt == "" {
+            t.Errorf("no expires_at: %s", w.Body)
+        }
+        return w.Code, resp.Capped
+    }
+    if w := do(r, http.MethodPost, "/jobs/"+id+"/extend", `{"hours":48}`); w.Code != http.StatusForbidden {
+        t.Errorf("without the job's access token: %d, want 403", w.Code)
+    }
+    if code, _ := extend(`{"hours":0}`); code != http.StatusBadRequest {
+        t.Errorf("hours 0: %d, want 400", code)
+    }
+    if code, capped := extend(`{"hours":48}`); code != http.StatusOK || capped {
+        t.Fatalf("48 hours: %d capped=%v", code, capped)
+    }
+    for _, key := range []string{"status:" + id, "result:" + id, "history:" + id, "tags:" + id, "tagged:keep"} {
+        if ttl := rdb.TTL(ctx, key).Val(); ttl <= 47*time.Hour || ttl > 48*time.Hour {
+            t.Errorf("%s TTL = %s, want 48h", key, ttl)
+        }
+    }
+    // The default, a day, is less than the job has left
+    if code, _ := extend(""); code != http.StatusOK {
+        t.Fatalf("default: %d", code)
+    }
+    if ttl := rdb.TTL(ctx, "status:"+id).Val(); ttl <= 47*time.Hour {
+        t.Errorf("status TTL = %s after a shorter extension, want it kept at 48h", ttl)
+    }
+    if code, capped := extend(`{"hours":1000}`); code != http.StatusOK || !capped {
+        t.Errorf("1000 hours: %d capped=%v, want capped", code, capped)
+    }
+    if ttl := rdb.TTL(ctx, "result:"+id).Val(); ttl <= 99*time.Hour || ttl > 100*time.Hour {
+        t.Errorf("result TTL = %s, want RESULT_TTL_MAX_HOURS", ttl)
+    }
+
+    if w := do(r, http.MethodPost, "/jobs/nope/extend", ""); w.Code != http.StatusNotFound {
+        t.Errorf("unknown job: %d, want 404", w.Code)
+    }
+}
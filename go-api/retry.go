@@ -0,0 +1,141 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "strconv"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+const (
+    // Jobs waiting out their backoff: payload -> ready_at (unix seconds)
+    delayedQueue = "print_jobs:delayed"
+    // Transient failures reported by the worker ({"job": ..., "error": ...})
+    retryQueue = "print_jobs:retry"
+)
+
+// jobMaxRetries is the payload's max_retries, for payloads written before it
+// existed the global MAX_ATTEMPTS applies.
+func jobMaxRetries(job map[string]interface{}) int {
+    if n, ok := job["max_retries"].(float64); ok {
+        return int(n)
+    }
+    if n, ok := job["max_retries"].(int); ok {
+        return n
+    }
+    return cfg().MaxAttempts - 1
+}
+
+// clampMaxRetries applies the default and cap to a client-requested value.
+func clampMaxRetries(requested *int) int {
+    if requested == nil || *requested < 0 {
+        return cfg().DefaultMaxRetries
+    }
+    if *requested > cfg().MaxRetriesCap {
+        return cfg().MaxRetriesCap
+    }
+    return *requested
+}
+
+// retryDelay doubles from RETRY_BASE_DELAY_SECONDS with each attempt, capped at an hour.
+func retryDelay(attempt int) time.Duration {
+    d := cfg().RetryBaseDelay() * time.Duration(math.Pow(2, float64(attempt-1)))
+    if d > time.Hour || d <= 0 {
+        return time.Hour
+    }
+    return d
+}
+
+// scheduleRetry records a transient failure and parks the job in the delayed
+// set until its backoff expires, or dead-letters it once max_retries is used up.
+func scheduleRetry(job map[string]interface{}, reason string) error {
+    jobID, _ := job["id"].(string)
+    attempts, _ := job["attempts"].(float64)
+    attempt := int(attempts) + 1
+    job["attempts"] = attempt
+
+    if attempt > jobMaxRetries(job) {
+        return deadLetterJob(job, reason)
+    }
+
+    // A job that finished or was withdrawn meanwhile isn't retried
+    if _, err := setStatus(ctx, jobID, StatusQueued, 24*time.Hour); err == errInvalidTransition {
+        return nil
+    } else if err != nil {
+        return err
+    }
+    return delayRetry(job, attempt, jobMaxRetries(job), reason, StatusQueued)
+}
+
+// delayRetry parks job in the delayed set for attempt's backoff, telling
+// clients it is retrying, out of maxRetries. status is the one it is shown
+// with meanwhile.
+func delayRetry(job map[string]interface{}, attempt, maxRetries int, reason string, status JobStatus) error {
+    jobID, _ := job["id"].(string)
+    readyAt := time.Now().Add(retryDelay(attempt))
+    jsonData := marshalPayload(job)
+    if err := rdb.ZAdd(ctx, delayedQueue, &redis.Z{Score: float64(readyAt.Unix()), Member: jsonData}).Err(); err != nil {
+        return err
+    }
+
+    note := fmt.Sprintf("Retrying after %s (attempt %d of %d)", reason, attempt+1, maxRetries+1)
+    rdb.Set(ctx, "note:"+jobID, note, 24*time.Hour)
+    rdb.Set(ctx, "attempts:"+jobID, attempt, 24*time.Hour)
+    rdb.Set(ctx, "next_retry_at:"+jobID, readyAt.UTC().Format(time.RFC3339), 24*time.Hour)
+    publishStatus(ctx, jobID, string(status), "retrying after "+reason)
+    log.Printf("retry: %s %s", jobID, note)
+    return nil
+}
+
+// promoteDelayed moves jobs whose backoff has expired onto their queue. ZREM
+// is the claim, so replicas sweeping at the same time don't double-push.
+func promoteDelayed() {
+    due, err := rdb.ZRangeByScore(ctx, delayedQueue, &redis.ZRangeBy{
+        Min: "-inf",
+        Max: strconv.FormatInt(time.Now().Unix(), 10),
+    }).Result()
+    if err != nil {
+        return
+    }
+    for _, entry := range due {
+        if removed, _ := rdb.ZRem(ctx, delayedQueue, entry).Result(); removed == 0 {
+            continue
+        }
+        job, err := readPayload([]byte(entry))
+        if err != nil {
+            continue
+        }
+        jobID, _ := job["id"].(string)
+        if err := enqueue(ctx, payloadQueue(job), jobID, marshalPayload(job)); err != nil {
+            rdb.ZAdd(ctx, delayedQueue, &redis.Z{Score: float64(time.Now().Unix()), Member: entry})
+            continue
+        }
+        rdb.Del(ctx, "next_retry_at:"+jobID)
+    }
+}
+
+// drainRetryQueue schedules every transient failure the worker reported.
+func drainRetryQueue() {
+    for {
+        entry, err := rdb.LPop(ctx, retryQueue).Result()
+        if err != nil {
+            return
+        }
+        var failure struct {
+            Job   map[string]interface{} `json:"job"`
+            Error string                 `json:"error"`
+        }
+        if err := json.Unmarshal([]byte(entry), &failure); err != nil || failure.Job == nil {
+            log.Printf("retry: dropping unreadable entry: %s", entry)
+            continue
+        }
+        if err := scheduleRetry(upgradePayload(failure.Job), failure.Error); err != nil {
+            rdb.RPush(ctx, retryQueue, entry)
+            return
+        }
+    }
+}
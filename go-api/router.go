@@ -0,0 +1,218 @@
+package main
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+type routerOptions struct {
+    uploadTimeout time.Duration
+    apiTimeout    time.Duration
+    sessions      SessionStore
+}
+
+// RouterOption overrides a router setting, mainly so tests don't have to
+// wait out production timeouts.
+type RouterOption func(*routerOptions)
+
+// WithUploadTimeout overrides UPLOAD_TIMEOUT_SECONDS for the upload routes.
+func WithUploadTimeout(d time.Duration) RouterOption {
+    return func(o *routerOptions) { o.uploadTimeout = d }
+}
+
+// WithAPITimeout overrides API_TIMEOUT_SECONDS for the quote/status routes.
+func WithAPITimeout(d time.Duration) RouterOption {
+    return func(o *routerOptions) { o.apiTimeout = d }
+}
+
+// WithSessionStore replaces the Redis-backed session store, e.g. with an
+// in-memory fake.
+func WithSessionStore(s SessionStore) RouterOption {
+    return func(o *routerOptions) { o.sessions = s }
+}
+
+func newRouter(opts ...RouterOption) *gin.Engine {
+    o := routerOptions{
+        uploadTimeout: cfg().UploadTimeout(),
+        apiTimeout:    cfg().APITimeout(),
+    }
+    for _, opt := range opts {
+        opt(&o)
+    }
+    if o.sessions == nil {
+        o.sessions = newRedisSessionStore(rdb, sessionSecret())
+    }
+
+    r := gin.Default()
+    // Validate checked the list. With none, ClientIP is the peer address and
+    // a spoofed X-Forwarded-For can't dodge the IP filter or the lockout
+    r.SetTrustedProxies(cfg().TrustedProxies)
+    r.Use(securityHeaders())
+    r.Use(ipFilter())
+    r.Use(rejectLockedOut)
+    r.Use(compressMiddleware(func() int { return cfg().CompressMinBytes }))
+    r.Use(csrfMiddleware())
+    r.Use(sessionMiddleware(o.sessions))
+
+    //serve frontend html
+    r.GET("/", requireLogin, handleIndex)
+    r.GET("/app.js", func(c *gin.Context) {
+        c.Data(http.StatusOK, "text/javascript; charset=utf-8", appJS)
+    })
+    r.GET("/jobpage.js", func(c *gin.Context) {
+        c.Data(http.StatusOK, "text/javascript; charset=utf-8", jobPageJS)
+    })
+
+    // Serve the Embedded Image
+    r.GET("/system-architecture-diagram.jpg", func(c *gin.Context) {
+        c.Data(http.StatusOK, "image/jpeg", diagramImg)
+    })
+
+    // The API at /v1/, and at the bare paths it was first served from.
+    // Only /quote, /upload and /status/:id were public before /v1/, so
+    // those are the ones marked deprecated
+    registerAPI(r.Group("", negotiateAPIVersion), o, deprecatedAlias)
+    registerAPI(r.Group("/"+apiV1, withAPIVersion(apiV1)), o, func(method, path string) gin.HandlerFunc {
+        return func(c *gin.Context) { c.Next() }
+    })
+    v2 := r.Group("/"+apiV2, withAPIVersion(apiV2))
+    v2.GET("/", handleV2Index(r))
+    r.GET("/api/deprecations", timeoutMiddleware(o.apiTimeout), handleDeprecations)
+
+    // Workers download local uploads without credentials; the names are job IDs
+    if cfg().StorageBackend == storageLocal {
+        r.GET("/files/:filename", handleLocalFile)
+    }
+
+    r.GET("/metrics", metricsHandler())
+    r.GET("/healthz", handleHealthz)
+    // Kubernetes probes: liveness without backend checks, readiness with
+    r.GET("/health/live", handleLive)
+    r.GET("/health/ready", handleReady)
+
+    // OAuth2 login for the web UI
+    r.GET("/auth/login", handleAuthLogin)
+    r.GET("/auth/callback", handleAuthCallback)
+    r.POST("/auth/logout", handleAuthLogout)
+
+    return r
+}
+
+// registerAPI adds the versioned API to g. deprecated returns the handler
+// that marks the responses of a route scheduled for removal.
+func registerAPI(g *gin.RouterGroup, o routerOptions, deprecated func(method, path string) gin.HandlerFunc) {
+    api := g.Group("", timeoutMiddleware(o.apiTimeout), apiKeyAuth)
+
+    // Endpoint 1: Submit Job
+    api.POST("/quote", deprecated(http.MethodPost, "/quote"), rejectWhenPaused, rejectWhenWorkersAbsent, idempotent, handleQuote)
+
+    // Endpoint 2: Check Status (Polling), with its own timeout since
+    // long-polls hold it open
+    g.GET("/status/:id", deprecated(http.MethodGet, "/status/:id"), longPollTimeout(o.apiTimeout), apiKeyAuth, handleStatus)
+    g.GET("/jobs/:id", longPollTimeout(o.apiTimeout), apiKeyAuth, handleStatus)
+    // The same for people, as a page to send them a link to
+    g.GET("/jobs/:id/page", timeoutMiddleware(o.apiTimeout), apiKeyAuth, handleJobPage)
+    api.POST("/status", handleBulkStatus)
+    api.GET("/jobs", requireOwner, handleListJobs)
+    api.DELETE("/jobs/:id", handleCancelJob)
+    api.POST("/jobs/:id/abort", handleAbortJob)
+    api.POST("/jobs/:id/retry", rejectWhenPaused, rejectWhenWorkersAbsent, idempotent, handleRetryJob)
+    api.GET("/jobs/:id/position", handleJobPosition)
+    api.GET("/jobs/:id/history", handleJobHistory)
+    api.GET("/jobs/:id/progress", handleJobProgress)
+    api.POST("/jobs/:id/extend", handleExtendJob)
+    api.GET("/jobs/:id/invoice", handleJobInvoice)
+    api.POST("/jobs/:id/accept", handleAcceptQuote)
+    api.GET("/jobs/:id/thumbnail", handleJobThumbnail)
+    api.GET("/quota", requireOwner, handleGetQuota)
+    api.GET("/materials", handleMaterials)
+
+    // Job tags
+    api.POST("/jobs/:id/tags", handleAddTags)
+    api.GET("/jobs/:id/tags", handleListTags)
+    api.DELETE("/jobs/:id/tags/:tag", handleRemoveTag)
+    api.GET("/jobs/tagged/:tag", handleListTagged)
+
+    // Parameter diff of two jobs
+    api.GET("/jobs/compare", handleCompareJobs)
+
+    // Share links, readable without credentials
+    api.POST("/jobs/:id/share", requireShareSecret, handleCreateShare)
+    api.DELETE("/jobs/:id/share/:token", requireShareSecret, handleRevokeShare)
+    g.GET("/shared/:token", requireShareSecret, timeoutMiddleware(o.apiTimeout), handleShared)
+
+    // Live slicer output and status changes as server-sent events, and the
+    // WebSocket; these outlive the API timeout
+    g.GET("/jobs/:id/logs", apiKeyAuth, handleJobLogs)
+    g.GET("/status/:id/stream", apiKeyAuth, handleStatusStream)
+    g.GET("/ws/jobs/:id", apiKeyAuth, handleJobWebSocket)
+
+    // Endpoint 3: Download the sliced G-code (supports Range), outliving
+    // the API timeout
+    g.GET("/jobs/:id/gcode", apiKeyAuth, handleJobGcode)
+    g.GET("/jobs/:id/result", apiKeyAuth, handleJobGcode)
+
+    // Endpoint 4: Queue stats
+    api.GET("/queue", handleQueue)
+
+    //Endpoint 5: Handle file uploads
+    upload := g.Group("", apiKeyAuth, uploadLimiter(func() int { return cfg().MaxConcurrentUploads }), timeoutMiddleware(o.uploadTimeout))
+    upload.POST("/quote/estimate", handleEstimate)
+    upload.POST("/upload", deprecated(http.MethodPost, "/upload"), requireLogin, rejectWhenPaused, rejectWhenWorkersAbsent, idempotent, handleUpload)
+
+    // What deliveries look like and how to verify them, for anyone
+    g.GET("/webhooks/schema", timeoutMiddleware(o.apiTimeout), handleWebhookSchema)
+
+    // Webhooks of the calling API key or user
+    hooks := g.Group("/webhooks", timeoutMiddleware(o.apiTimeout), apiKeyAuth, requireOwner)
+    hooks.POST("", handleCreateWebhook)
+    hooks.GET("", handleListWebhooks)
+    hooks.PUT("/:id", handleUpdateWebhook)
+    hooks.DELETE("/:id", handleDeleteWebhook)
+    hooks.GET("/:id/deliveries", handleListDeliveries)
+    hooks.POST("/:id/deliveries/:delivery_id/replay", handleReplayDelivery)
+
+    // Worker callbacks, HMAC-signed with INTERNAL_SECRET
+    internal := g.Group("/internal", requireInternalSignature)
+    internal.POST("/jobs/:id/status", handleInternalStatus)
+    internal.PATCH("/jobs/:id/progress", handleInternalProgress)
+    internal.POST("/jobs/:id/thumbnail", handleInternalThumbnail)
+    g.POST("/workers/register", requireInternalSignature, handleRegisterWorker)
+
+    // Job history as CSV for analysts; streams past the API timeout
+    g.GET("/history/export", requireAdmin, handleHistoryExport)
+
+    // Admin endpoints
+    admin := g.Group("/admin", requireAdmin)
+    admin.GET("/stuck-jobs", handleStuckJobs)
+    admin.GET("/jobs/:id/logs", handleAdminJobLogs)
+    admin.GET("/dlq", handleListDLQ)
+    admin.POST("/dlq/:id/requeue", handleRequeueDLQ)
+    admin.POST("/queue/pause", handlePauseIntake)
+    admin.POST("/queue/resume", handleResumeIntake)
+    admin.POST("/jobs/:id/prioritize", handlePrioritize)
+    admin.POST("/jobs/:id/deprioritize", handleDeprioritize)
+    admin.GET("/audit", handleListAudit)
+    admin.GET("/workers", handleListWorkers)
+    admin.GET("/workers/stale", handleListStaleWorkers)
+    admin.GET("/reports/sla", handleSLAReport)
+    admin.GET("/stats/daily", handleDailyStats)
+    admin.GET("/locks", handleListLocks)
+    admin.GET("/queues", handleAdminQueues)
+    admin.POST("/reload", handleReloadConfig)
+    admin.GET("/webhooks/failed", handleListFailedDeliveries)
+    admin.POST("/webhooks/subscriptions", handleCreateSubscription)
+    admin.GET("/webhooks/subscriptions", handleListSubscriptions)
+    admin.PUT("/webhooks/subscriptions/:id", handleUpdateSubscription)
+    admin.DELETE("/webhooks/subscriptions/:id", handleDeleteSubscription)
+    admin.POST("/webhooks/:id/redeliver", handleRedeliver)
+    admin.GET("/dashboard/grafana", handleGrafanaDashboard)
+    admin.GET("/features", handleListFeatures)
+    admin.PUT("/features/:name", handleSetFeature)
+    admin.POST("/auth/unlock/:ip", handleAuthUnlock)
+    admin.POST("/auth/unlock-account/:account", handleAuthUnlockAccount)
+    admin.POST("/blocklist", handleAddBlocklist)
+    admin.DELETE("/blocklist/*ip", handleRemoveBlocklist)
+}
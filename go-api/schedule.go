@@ -0,0 +1,63 @@
+package main
+
+import (
+    "context"
+    "strconv"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// Jobs submitted with a future submit_at wait here: payload -> release time
+// (unix seconds). The reaper loop moves them onto their queue once due.
+const scheduledQueue = "print_jobs:scheduled"
+
+// scheduleJob parks a job until at. Its keys outlive the usual 24h by the
+// time it spends waiting.
+func scheduleJob(ctx context.Context, jobID string, jsonData []byte, at time.Time) error {
+    ttl := time.Until(at) + 24*time.Hour
+    if _, err := setStatus(ctx, jobID, StatusScheduled, ttl); err != nil {
+        return err
+    }
+    pipe := rdb.TxPipeline()
+    pipe.ZAdd(ctx, scheduledQueue, &redis.Z{Score: float64(at.Unix()), Member: jsonData})
+    pipe.Set(ctx, "params:"+jobID, jsonData, ttl)
+    pipe.Set(ctx, "note:"+jobID, "Scheduled for "+at.UTC().Format(time.RFC3339), ttl)
+    if _, err := pipe.Exec(ctx); err != nil {
+        rdb.Del(ctx, "status:"+jobID)
+        return err
+    }
+    return nil
+}
+
+// releaseScheduled enqueues scheduled jobs that are due. As with
+// promoteDelayed, ZREM is the claim between replicas.
+func releaseScheduled() {
+    due, err := rdb.ZRangeByScore(ctx, scheduledQueue, &redis.ZRangeBy{
+        Min: "-inf",
+        Max: strconv.FormatInt(time.Now().Unix(), 10),
+    }).Result()
+    if err != nil {
+        return
+    }
+    for _, entry := range due {
+        if removed, _ := rdb.ZRem(ctx, scheduledQueue, entry).Result(); removed == 0 {
+            continue
+        }
+        job, err := readPayload([]byte(entry))
+        if err != nil {
+            continue
+        }
+        jobID, _ := job["id"].(string)
+        if err := enqueue(ctx, payloadQueue(job), jobID, marshalPayload(job)); err != nil {
+            rdb.ZAdd(ctx, scheduledQueue, &redis.Z{Score: float64(time.Now().Unix()), Member: entry})
+            continue
+        }
+        // A job cancelled meanwhile stays cancelled; workers skip it
+        if _, err := setStatus(ctx, jobID, StatusQueued, 24*time.Hour); err != nil {
+            continue
+        }
+        rdb.Del(ctx, "note:"+jobID)
+        publishStatus(ctx, jobID, string(StatusQueued), "released at its submit_at")
+    }
+}
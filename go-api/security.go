@@ -0,0 +1,31 @@
+package main
+
+import (
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+)
+
+// defaultCSP only allows scripts served from our own origin, so the UI's
+// JavaScript lives in app.js rather than inline in index.html.
+const defaultCSP = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+    "img-src 'self' data:; frame-ancestors 'none'; base-uri 'self'; form-action 'self'"
+
+// securityHeaders sets the headers audits look for. They are written before
+// the handler runs so aborted and error responses carry them too. /metrics
+// is scraped by Prometheus, not browsers, and is left alone.
+func securityHeaders() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if c.Request.URL.Path == "/metrics" {
+            c.Next()
+            return
+        }
+        h := c.Writer.Header()
+        h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(cfg().HSTSMaxAgeSeconds)+"; includeSubDomains")
+        h.Set("Content-Security-Policy", cfg().CSP)
+        h.Set("X-Content-Type-Options", "nosniff")
+        h.Set("X-Frame-Options", "DENY")
+        h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+        c.Next()
+    }
+}
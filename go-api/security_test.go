@@ -0,0 +1,72 @@
+package main
+
+import (
+    "net/http"
+    "regexp"
+    "strings"
+    "testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    want := map[string]string{
+        "Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+        "Content-Security-Policy":   defaultCSP,
+        "X-Content-Type-Options":    "nosniff",
+        "X-Frame-Options":           "DENY",
+        "Referrer-Policy":           "strict-origin-when-cross-origin",
+    }
+    // The UI, its script, and an error response all carry them
+    for _, path := range []string{"/", "/app.js", "/status/missing"} {
+        w := do(r, http.MethodGet, path, "")
+        for k, v := range want {
+            if got := w.Header().Get(k); got != v {
+                t.Errorf("%s: %s = %q, want %q", path, k, got, v)
+            }
+        }
+    }
+    if w := do(r, http.MethodGet, "/metrics", ""); w.Header().Get("Content-Security-Policy") != "" {
+        t.Error("/metrics should not carry browser security headers")
+    }
+}
+
+// TestUIRunsUnderCSP checks the page only uses scripts the default policy
+// allows: same-origin files, no inline <script> bodies or on* handlers.
+func TestUIRunsUnderCSP(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    for _, directive := range strings.Split(defaultCSP, ";") {
+        if d := strings.TrimSpace(directive); strings.HasPrefix(d, "script-src") && d != "script-src 'self'" {
+            t.Fatalf("default CSP has %q, want same-origin scripts only", d)
+        }
+    }
+
+    index := do(r, http.MethodGet, "/", "")
+    if index.Code != http.StatusOK {
+        t.Fatalf("GET /: status = %d, want 200", index.Code)
+    }
+    page := index.Body.String()
+    scripts := regexp.MustCompile(`(?is)<script([^>]*)>(.*?)</script>`).FindAllStringSubmatch(page, -1)
+    if len(scripts) == 0 {
+        t.Fatal("index has no <script> tags")
+    }
+    for _, s := range scripts {
+        src := regexp.MustCompile(`src="([^"]+)"`).FindStringSubmatch(s[1])
+        if src == nil || strings.TrimSpace(s[2]) != "" {
+            t.Errorf("inline script would be blocked by the CSP: %.80s", s[0])
+            continue
+        }
+        if !strings.HasPrefix(src[1], "/") || strings.HasPrefix(src[1], "//") {
+            t.Errorf("script %s is not same-origin", src[1])
+            continue
+        }
+        js := do(r, http.MethodGet, src[1], "")
+        if js.Code != http.StatusOK || !strings.HasPrefix(js.Header().Get("Content-Type"), "text/javascript") {
+            t.Errorf("GET %s: status = %d, Content-Type %q; want 200 JavaScript", src[1], js.Code, js.Header().Get("Content-Type"))
+        }
+    }
+    if handler := regexp.MustCompile(`(?i)\son[a-z]+\s*=`).FindString(page); handler != "" {
+        t.Errorf("inline event handler %q would be blocked by the CSP", handler)
+    }
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+// ErrNoSession means the token is unknown, expired or wasn't signed by us.
+var ErrNoSession = errors.New("session not found")
+
+// SessionStore keeps web UI logins. Tokens are "<id>.<signature>" so forged
+// cookies are rejected without a round trip to the store.
+type SessionStore interface {
+    CreateSession(ctx context.Context, ownerID string, expiresIn time.Duration) (string, error)
+    GetSession(ctx context.Context, token string) (string, error)
+    DeleteSession(ctx context.Context, token string) error
+}
+
+// session is what "session:{token}" holds.
+type session struct {
+    OwnerID   string `json:"owner_id"`
+    CreatedAt int64  `json:"created_at"`
+}
+
+// redisSessionStore is the SessionStore used outside of tests.
+type redisSessionStore struct {
+    rdb    *redis.Client
+    secret []byte
+}
+
+func newRedisSessionStore(client *redis.Client, secret []byte) *redisSessionStore {
+    return &redisSessionStore{rdb: client, secret: secret}
+}
+
+// sessionSecret decodes SESSION_SECRET. Without one a random key is used, so
+// sessions don't survive a restart and replicas reject each other's tokens.
+func sessionSecret() []byte {
+    if cfg().SessionSecret != "" {
+        return []byte(cfg().SessionSecret)
+    }
+    log.Printf("WARNING: SESSION_SECRET is not set, using a random key")
+    b := make([]byte, 32)
+    rand.Read(b)
+    return b
+}
+
+func (s *redisSessionStore) sign(id string) string {
+    mac := hmac.New(sha256.New, s.secret)
+    mac.Write([]byte(id))
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the token's signature.
+func (s *redisSessionStore) verify(token string) bool {
+    id, sig, ok := strings.Cut(token, ".")
+    return ok && hmac.Equal([]byte(sig), []byte(s.sign(id)))
+}
+
+func (s *redisSessionStore) CreateSession(ctx context.Context, ownerID string, expiresIn time.Duration) (string, error) {
+    b := make([]byte, 24)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    id := base64.RawURLEncoding.EncodeToString(b)
+    token := id + "." + s.sign(id)
+
+    data, _ := json.Marshal(session{OwnerID: ownerID, CreatedAt: time.Now().Unix()})
+    if err := s.rdb.Set(ctx, "session:"+token, data, expiresIn).Err(); err != nil {
+        return "", err
+    }
+    return token, nil
+}
+
+func (s *redisSessionStore) GetSession(ctx context.Context, token string) (string, error) {
+    if !s.verify(token) {
+        return "", ErrNoSession
+    }
+    data, err := s.rdb.Get(ctx, "session:"+token).Bytes()
+    if err == redis.Nil {
+        return "", ErrNoSession
+    } else if err != nil {
+        return "", err
+    }
+    var sess session
+    if err := json.Unmarshal(data, &sess); err != nil || sess.OwnerID == "" {
+        return "", ErrNoSession
+    }
+    return sess.OwnerID, nil
+}
+
+func (s *redisSessionStore) DeleteSession(ctx context.Context, token string) error {
+    return s.rdb.Del(ctx, "session:"+token).Err()
+}
+
+// Context keys set by sessionMiddleware (and apiKeyAuth for owner_id): the
+// caller's owner_id, if any, and the store itself for the auth handlers.
+const (
+    ownerIDKey      = "owner_id"
+    sessionStoreKey = "session_store"
+)
+
+// sessionMiddleware resolves the session cookie, if any, on every request.
+func sessionMiddleware(store SessionStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Set(sessionStoreKey, store)
+        if token, err := c.Cookie(sessionCookie); err == nil && token != "" {
+            if owner, err := store.GetSession(c.Request.Context(), token); err == nil {
+                c.Set(ownerIDKey, owner)
+            }
+        }
+        c.Next()
+    }
+}
+
+// sessionStoreFrom returns the store sessionMiddleware was set up with.
+func sessionStoreFrom(c *gin.Context) SessionStore {
+    return c.MustGet(sessionStoreKey).(SessionStore)
+}
+
+// requireLogin guards the web UI once OAuth2 is configured: page loads are
+// redirected to /auth/login, and script calls get a 401 pointing there.
+func requireLogin(c *gin.Context) {
+    if cfg().OAuth2Provider == "" || requestOwner(c) != "" {
+        c.Next()
+        return
+    }
+    if c.Request.Method == http.MethodGet {
+        c.Redirect(http.StatusFound, "/auth/login")
+        c.Abort()
+        return
+    }
+    c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required", "login_url": "/auth/login"})
+}
+
+// requestOwner returns the caller's owner_id: the logged-in web UI user or
+// the API key's owner, empty for anonymous requests.
+func requestOwner(c *gin.Context) string {
+    return c.GetString(ownerIDKey)
+}
+
+// callerScope namespaces per-caller state (idempotency keys, cached
+// results): the owner, or for anonymous callers their IP.
+func callerScope(c *gin.Context) string {
+    submitter := submitterOf(requestOwner(c))
+    if submitter == anonymousSubmitter {
+        submitter += ":" + c.ClientIP()
+    }
+    return submitter
+}
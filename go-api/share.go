@@ -0,0 +1,143 @@
+package main
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// Share tokens look like "<nonce>.<expiry unix>.<sig>", where sig is the
+// HMAC-SHA256 of "<job id>.<nonce>.<expiry>" keyed with SHARE_SECRET.
+// share:{token} maps each to its job until it expires or is revoked. The
+// key has to be configured: links outlive restarts and are opened on any
+// replica, so there is no random fallback.
+func shareSecret() []byte {
+    return []byte(cfg().ShareSecret)
+}
+
+// requireShareSecret turns the share endpoints off until SHARE_SECRET is set.
+func requireShareSecret(c *gin.Context) {
+    if cfg().ShareSecret == "" {
+        c.AbortWithStatusJSON(http.StatusServiceUnavailable, api.ErrorResponse{Error: "Share links are not enabled"})
+        return
+    }
+    c.Next()
+}
+
+func signShare(jobID, nonce, expiry string) string {
+    mac := hmac.New(sha256.New, shareSecret())
+    mac.Write([]byte(jobID + "." + nonce + "." + expiry))
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newShareToken(jobID string, expiresAt time.Time) string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    nonce := base64.RawURLEncoding.EncodeToString(b)
+    expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+    return nonce + "." + expiry + "." + signShare(jobID, nonce, expiry)
+}
+
+// verifyShareToken checks token was issued for jobID and hasn't expired.
+func verifyShareToken(token, jobID string) bool {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return false
+    }
+    expiry, err := strconv.ParseInt(parts[1], 10, 64)
+    if err != nil || time.Now().Unix() >= expiry {
+        return false
+    }
+    return hmac.Equal([]byte(parts[2]), []byte(signShare(jobID, parts[0], parts[1])))
+}
+
+// POST /jobs/:id/share creates a link that shows the job's status and
+// result without credentials.
+func handleCreateShare(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+    if n, _ := rdb.Exists(ctx, "status:"+jobID).Result(); n == 0 {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    if !authorizeJob(c, jobID) {
+        return
+    }
+    token, expiresAt, err := createShare(ctx, jobID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusCreated, gin.H{
+        "job_id":     jobID,
+        "token":      token,
+        "url":        sharePath(token, expiresAt),
+        "expires_at": expiresAt.Format(time.RFC3339),
+    })
+}
+
+// createShare issues and stores a new share link for jobID.
+func createShare(ctx context.Context, jobID string) (string, time.Time, error) {
+    expiresAt := time.Now().Add(cfg().ShareLinkExpiry()).UTC()
+    token := newShareToken(jobID, expiresAt)
+    err := rdb.Set(ctx, "share:"+token, jobID, cfg().ShareLinkExpiry()).Err()
+    return token, expiresAt, err
+}
+
+func sharePath(token string, expiresAt time.Time) string {
+    return "/shared/" + token + "?expires=" + expiresAt.Format(time.RFC3339)
+}
+
+// DELETE /jobs/:id/share/:token revokes one link.
+func handleRevokeShare(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID, token := c.Param("id"), c.Param("token")
+    if !authorizeJob(c, jobID) {
+        return
+    }
+    if shared, err := rdb.Get(ctx, "share:"+token).Result(); err != nil || shared != jobID {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Share link not found"})
+        return
+    }
+    rdb.Del(ctx, "share:"+token)
+    c.Status(http.StatusNoContent)
+}
+
+// GET /shared/:token is public. The ?expires= on the link is only for
+// display; the expiry that counts is the one signed into the token.
+func handleShared(c *gin.Context) {
+    ctx := c.Request.Context()
+    token := c.Param("token")
+    jobID, err := rdb.Get(ctx, "share:"+token).Result()
+    if err != nil || !verifyShareToken(token, jobID) {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Share link not found or expired"})
+        return
+    }
+    vals, err := rdb.MGet(ctx, "status:"+jobID, "result:"+jobID).Result()
+    if err != nil || vals[0] == nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    expiry, _ := strconv.ParseInt(strings.Split(token, ".")[1], 10, 64)
+    response := gin.H{
+        "job_id":     jobID,
+        "status":     vals[0],
+        "expires_at": time.Unix(expiry, 0).UTC().Format(time.RFC3339),
+    }
+    if res, ok := vals[1].(string); ok {
+        if data, ok := exposedResult(jobID, res); ok {
+            response["data"] = data
+        }
+    }
+    c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestShareLinksNeedShareSecret(t *testing.T) {
+    setupTest(t, func(c *Config) { c.SessionSecret = "session" })
+    rdb.Set(ctx, "status:j1", "completed", 0)
+
+    w := do(newRouter(), http.MethodPost, "/jobs/j1/share", "")
+    if w.Code != http.StatusServiceUnavailable {
+        t.Fatalf("status = %d, want 503 without SHARE_SECRET (body %s)", w.Code, w.Body)
+    }
+}
+
+func TestShareLinksSurviveSessionSecretChanges(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.ShareSecret = "share"
+        c.SessionSecret = "session"
+    })
+    rdb.Set(ctx, "status:j1", "completed", 0)
+
+    w := do(newRouter(), http.MethodPost, "/jobs/j1/share", "")
+    if w.Code != http.StatusCreated {
+        t.Fatalf("create: status = %d, want 201 (body %s)", w.Code, w.Body)
+    }
+    var created struct {
+        Token string `json:"token"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &created)
+    if created.Token == "" {
+        t.Fatalf("no token in %s", w.Body)
+    }
+
+    // Another replica, or this one restarted with a rotated session key
+    cfg().SessionSecret = "rotated"
+    if w := do(newRouter(), http.MethodGet, "/shared/"+created.Token, ""); w.Code != http.StatusOK {
+        t.Fatalf("shared: status = %d, want 200 (body %s)", w.Code, w.Body)
+    }
+
+    cfg().ShareSecret = "other"
+    if w := do(newRouter(), http.MethodGet, "/shared/"+created.Token, ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Share link") {
+        t.Fatalf("shared under another key: status = %d, want 404 (body %s)", w.Code, w.Body)
+    }
+}
+
+func TestShareLinksNeedTheJobsAccessToken(t *testing.T) {
+    setupTest(t, func(c *Config) { c.ShareSecret = "share" })
+    r := newRouter()
+    jobID, token := submitForCancel(t, r)
+
+    if w := do(r, http.MethodPost, "/jobs/"+jobID+"/share", ""); w.Code != http.StatusForbidden {
+        t.Fatalf("create without the access token: status = %d, want 403", w.Code)
+    }
+    w := do(r, http.MethodPost, "/jobs/"+jobID+"/share", "", jobTokenHeader, token)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("create: status = %d, want 201 (body %s)", w.Code, w.Body)
+    }
+    var created struct {
+        Token string `json:"token"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &created)
+
+    revoke := "/jobs/" + jobID + "/share/" + created.Token
+    if w := do(r, http.MethodDelete, revoke, ""); w.Code != http.StatusForbidden {
+        t.Fatalf("revoke without the access token: status = %d, want 403", w.Code)
+    }
+    if w := do(r, http.MethodDelete, revoke, "", jobTokenHeader, token); w.Code != http.StatusNoContent {
+        t.Fatalf("revoke: status = %d, want 204", w.Code)
+    }
+}
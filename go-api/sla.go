@@ -0,0 +1,207 @@
+package main
+
+import (
+    "context"
+    "encoding/csv"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Each completed job's time from created_at to completed_at is kept in its
+// lane's sla_completions:{rush|standard}, a sorted set of "{job_id}:{seconds}"
+// scored by when it completed, for GET /admin/reports/sla. Entries older
+// than slaRetentionDays are dropped as new ones arrive.
+const slaRetentionDays = 90
+
+// slaBatch is how many entries one ZRANGEBYSCORE of the report reads, so
+// the report never holds Redis up on one large read.
+var slaBatch int64 = 1000
+
+var slaLanes = []string{"rush", "standard"}
+
+func slaCompletionsKey(lane string) string {
+    return "sla_completions:" + lane
+}
+
+// recordSLA adds jobID's completion to its lane. publishStatus calls it
+// for every status; only completions count towards the SLA.
+func recordSLA(ctx context.Context, jobID, status string) {
+    if status != string(StatusCompleted) {
+        return
+    }
+    vals, err := rdb.MGet(ctx, "params:"+jobID, "created_at:"+jobID).Result()
+    if err != nil {
+        return
+    }
+    var job struct {
+        Rush      bool   `json:"rush"`
+        CreatedAt string `json:"created_at"`
+    }
+    if raw, ok := vals[0].(string); ok {
+        unmarshalPayload([]byte(raw), &job)
+    }
+    if job.CreatedAt == "" {
+        job.CreatedAt, _ = vals[1].(string)
+    }
+    created, err := time.Parse(time.RFC3339, job.CreatedAt)
+    if err != nil {
+        return
+    }
+    now := time.Now()
+    seconds := math.Max(0, math.Round(now.Sub(created).Seconds()))
+    lane := "standard"
+    if job.Rush {
+        lane = "rush"
+    }
+    key := slaCompletionsKey(lane)
+    pipe := rdb.TxPipeline()
+    pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.Unix()), Member: jobID + ":" + strconv.FormatFloat(seconds, 'f', 0, 64)})
+    pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.AddDate(0, 0, -slaRetentionDays).Unix(), 10))
+    pipe.Exec(ctx)
+}
+
+// slaLane sums up one lane's completion times. WithinSLA and SLAHitPct are
+// for the rush lane only, which RUSH_SLA_MINUTES applies to.
+type slaLane struct {
+    Lane        string   `json:"lane"`
+    Jobs        int      `json:"jobs"`
+    WithinSLA   *int     `json:"within_sla,omitempty"`
+    SLAHitPct   *float64 `json:"sla_hit_pct,omitempty"`
+    MeanSeconds float64  `json:"mean_seconds"`
+    P95Seconds  float64  `json:"p95_seconds"`
+    P99Seconds  float64  `json:"p99_seconds"`
+}
+
+// laneCompletionTimes reads the completion times of lane's jobs completed
+// since from, a batch at a time.
+func laneCompletionTimes(ctx context.Context, lane string, from time.Time) ([]float64, error) {
+    var times []float64
+    for offset := int64(0); ; offset += slaBatch {
+        members, err := rdb.ZRangeByScore(ctx, slaCompletionsKey(lane), &redis.ZRangeBy{
+            Min:    strconv.FormatInt(from.Unix(), 10),
+            Max:    "+inf",
+            Offset: offset,
+            Count:  slaBatch,
+        }).Result()
+        if err != nil {
+            return nil, err
+        }
+        for _, m := range members {
+            if i := strings.LastIndexByte(m, ':'); i >= 0 {
+                if s, err := strconv.ParseFloat(m[i+1:], 64); err == nil {
+                    times = append(times, s)
+                }
+            }
+        }
+        if int64(len(members)) < slaBatch {
+            return times, nil
+        }
+    }
+}
+
+// summarizeLane works out the figures for times, which it sorts.
+// slaSeconds of 0 leaves out the SLA figures.
+func summarizeLane(lane string, times []float64, slaSeconds float64) slaLane {
+    s := slaLane{Lane: lane, Jobs: len(times)}
+    if slaSeconds > 0 {
+        within, pct := 0, 0.0
+        for _, t := range times {
+            if t <= slaSeconds {
+                within++
+            }
+        }
+        if len(times) > 0 {
+            pct = round2(100 * float64(within) / float64(len(times)))
+        }
+        s.WithinSLA, s.SLAHitPct = &within, &pct
+    }
+    if len(times) == 0 {
+        return s
+    }
+    sort.Float64s(times)
+    sum := 0.0
+    for _, t := range times {
+        sum += t
+    }
+    s.MeanSeconds = round2(sum / float64(len(times)))
+    s.P95Seconds = percentile(times, 95)
+    s.P99Seconds = percentile(times, 99)
+    return s
+}
+
+// percentile is the nearest-rank p-th percentile of sorted.
+func percentile(sorted []float64, p float64) float64 {
+    rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+    return sorted[max(rank, 1)-1]
+}
+
+var slaCSVHeader = []string{"lane", "jobs", "within_sla", "sla_hit_pct", "mean_seconds", "p95_seconds", "p99_seconds"}
+
+// GET /admin/reports/sla?days=30&format=csv reports how fast the jobs
+// completed in the last days were, from created_at to completed_at, for the
+// rush and standard lanes, and how many rush jobs made RUSH_SLA_MINUTES.
+func handleSLAReport(c *gin.Context) {
+    ctx := c.Request.Context()
+    days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+    if err != nil || days < 1 || days > slaRetentionDays {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "days must be between 1 and " + strconv.Itoa(slaRetentionDays)})
+        return
+    }
+    format := c.DefaultQuery("format", "json")
+    if format != "json" && format != "csv" {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "format must be json or csv"})
+        return
+    }
+
+    now := time.Now().UTC()
+    from := now.AddDate(0, 0, -days)
+    slaSeconds := float64(cfg().RushSLAMinutes * 60)
+    lanes := make([]slaLane, len(slaLanes))
+    for i, lane := range slaLanes {
+        times, err := laneCompletionTimes(ctx, lane, from)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+        if lane != "rush" {
+            lanes[i] = summarizeLane(lane, times, 0)
+        } else {
+            lanes[i] = summarizeLane(lane, times, slaSeconds)
+        }
+    }
+
+    if format == "csv" {
+        c.Header("Content-Type", "text/csv; charset=utf-8")
+        c.Header("Content-Disposition", `attachment; filename="sla_`+now.Format("20060102")+`.csv"`)
+        c.Status(http.StatusOK)
+        w := csv.NewWriter(c.Writer)
+        w.Write(slaCSVHeader)
+        for _, l := range lanes {
+            within, pct := "", ""
+            if l.WithinSLA != nil {
+                within, pct = strconv.Itoa(*l.WithinSLA), strconv.FormatFloat(*l.SLAHitPct, 'f', -1, 64)
+            }
+            w.Write([]string{l.Lane, strconv.Itoa(l.Jobs), within, pct,
+                strconv.FormatFloat(l.MeanSeconds, 'f', -1, 64), strconv.FormatFloat(l.P95Seconds, 'f', -1, 64), strconv.FormatFloat(l.P99Seconds, 'f', -1, 64)})
+        }
+        w.Flush()
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "days":             days,
+        "from":             from.Format(time.RFC3339),
+        "to":               now.Format(time.RFC3339),
+        "rush_sla_minutes": cfg().RushSLAMinutes,
+        "rush":             lanes[0],
+        "standard":         lanes[1],
+    })
+}
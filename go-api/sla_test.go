@@ -0,0 +1,96 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// completeAfter records a job of the lane that completed minutes after it
+// was created.
+func completeAfter(t *testing.T, id string, rush bool, minutes int) {
+    t.Helper()
+    created := time.Now().Add(-time.Duration(minutes) * time.Minute).UTC().Format(time.RFC3339)
+    rdb.Set(ctx, "params:"+id, marshalPayload(map[string]interface{}{"id": id, "rush": rush, "created_at": created}), time.Hour)
+    recordSLA(ctx, id, "completed")
+}
+
+func TestSLAReport(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.AdminToken = "secret"
+        c.RushSLAMinutes = 30
+    })
+    r := newRouter()
+    saved := slaBatch
+    slaBatch = 2
+    t.Cleanup(func() { slaBatch = saved })
+
+    for i, minutes := range []int{10, 20, 25, 40, 90} {
+        completeAfter(t, "rush"+strconv.Itoa(i), true, minutes)
+    }
+    for i, minutes := range []int{60, 120, 180} {
+        completeAfter(t, "std"+strconv.Itoa(i), false, minutes)
+    }
+    recordSLA(ctx, "std0", "failed")
+    // Completed before the window
+    rdb.ZAdd(ctx, slaCompletionsKey("rush"), &redis.Z{Score: float64(time.Now().AddDate(0, 0, -40).Unix()), Member: "old:60"})
+
+    w := do(r, http.MethodGet, "/admin/reports/sla", "", "Authorization", "Bearer secret")
+    var report struct {
+        Days     int     `json:"days"`
+        Rush     slaLane `json:"rush"`
+        Standard slaLane `json:"standard"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("report: %d %s", w.Code, w.Body)
+    }
+    rush := report.Rush
+    if report.Days != 30 || rush.Jobs != 5 || rush.WithinSLA == nil || *rush.WithinSLA != 3 || *rush.SLAHitPct != 60 {
+        t.Errorf("rush = %+v, want 3 of 5 within 30 minutes", rush)
+    }
+    // Give or take the second created_at is rounded to
+    near := func(got, want float64) bool { return got >= want && got <= want+2 }
+    if !near(rush.MeanSeconds, 37*60) || !near(rush.P95Seconds, 90*60) || !near(rush.P99Seconds, 90*60) {
+        t.Errorf("rush times = %+v, want mean 37m and p95/p99 90m", rush)
+    }
+    std := report.Standard
+    if std.Jobs != 3 || std.WithinSLA != nil || !near(std.MeanSeconds, 120*60) || !near(std.P95Seconds, 180*60) {
+        t.Errorf("standard = %+v, want 3 jobs averaging 2h, without SLA figures", std)
+    }
+
+    w = do(r, http.MethodGet, "/admin/reports/sla?days=60&format=csv", "", "Authorization", "Bearer secret")
+    rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+    if err != nil || len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(slaCSVHeader, ",") {
+        t.Fatalf("CSV: %v %q", err, w.Body)
+    }
+    // The older completion is within 60 days, and made the SLA
+    if got := strings.Join(rows[1][:4], ","); got != "rush,6,4,66.67" {
+        t.Errorf("rush row = %v", rows[1])
+    }
+    if got := strings.Join(rows[2][:4], ","); got != "standard,3,," || rows[2][6] == "" {
+        t.Errorf("standard row = %v", rows[2])
+    }
+
+    for _, q := range []string{"days=0", "days=91", "format=xml"} {
+        if w := do(r, http.MethodGet, "/admin/reports/sla?"+q, "", "Authorization", "Bearer secret"); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: %d, want 400", q, w.Code)
+        }
+    }
+}
+
+func TestCompletionsFeedTheSLAReport(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    _, id, _ := quoteJobID(t, r, `{"download_url":"https://example.com/a.stl","material":"PLA","infill":20,"rush":true}`)
+    reportStatus(t, r, id, `{"status":"processing"}`)
+    reportStatus(t, r, id, `{"status":"completed","result":{"price":1}}`)
+    if got := rdb.ZRange(ctx, slaCompletionsKey("rush"), 0, -1).Val(); len(got) != 1 || !strings.HasPrefix(got[0], id+":") {
+        t.Errorf("rush completions = %v, want %s", got, id)
+    }
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+
+    "slicer-api/internal/api"
+)
+
+// Successful results are cached under slice_cache:{key} for
+// SLICE_CACHE_TTL_HOURS. The key only covers what the server itself knows:
+// the sha256 of the bytes /upload received, or for /quote (which never sees
+// the file) its download_url, plus the parameters that change the slice or
+// the price. Entries are scoped to the caller so nobody can plant a result
+// another tenant will be served. Jobs carry their key as "cache_key" so the
+// result can be stored when they complete.
+
+func sliceCacheEnabled() bool {
+    return cfg().SliceCacheTTLHours > 0
+}
+
+// sliceCacheKey normalizes the parameters so equivalent requests
+// ("pla" vs "PLA", 0.2 vs 0.20) share an entry. source is "sha256:<hex>" or
+// "url:<download_url>".
+func sliceCacheKey(scope, source, material string, layerHeight float64, infill int, nozzle float64, bedAdhesion string, rush bool) string {
+    normalized := fmt.Sprintf("%s\n%s\n%s|%.3f|%d|%.2f|%s|%t",
+        scope, source, strings.ToLower(strings.TrimSpace(material)), layerHeight, infill, nozzle, bedAdhesion, rush)
+    sum := sha256.Sum256([]byte(normalized))
+    return hex.EncodeToString(sum[:])
+}
+
+func cachedSliceResult(ctx context.Context, key string) (string, bool) {
+    if key == "" || !sliceCacheEnabled() {
+        return "", false
+    }
+    res, err := rdb.Get(ctx, "slice_cache:"+key).Result()
+    return res, err == nil
+}
+
+// storeSliceResult caches a completed job's result if it was submitted with
+// a cache key and the slice succeeded.
+func storeSliceResult(ctx context.Context, jobID string, result []byte) {
+    if !sliceCacheEnabled() {
+        return
+    }
+    payload, err := rdb.Get(ctx, "params:"+jobID).Bytes()
+    if err != nil {
+        return
+    }
+    var job struct {
+        CacheKey string `json:"cache_key"`
+    }
+    var res struct {
+        Success bool `json:"success"`
+    }
+    if unmarshalPayload(payload, &job) != nil || job.CacheKey == "" || json.Unmarshal(result, &res) != nil || !res.Success {
+        return
+    }
+    rdb.Set(ctx, "slice_cache:"+job.CacheKey, result, cfg().SliceCacheTTL())
+}
+
+// serveCachedJob completes a new job straight from the cache without
+// queueing it.
+func serveCachedJob(c *gin.Context, spec jobSpec, result string) {
+    ctx := c.Request.Context()
+    if spec.ID == "" {
+        spec.ID = uuid.New().String()
+    }
+    jobData := newJobPayload(spec)
+    jobData["cached"] = true
+
+    pipe := rdb.TxPipeline()
+    pipe.Set(ctx, "params:"+spec.ID, marshalPayload(jobData), 24*time.Hour)
+    pipe.Set(ctx, "result:"+spec.ID, result, 24*time.Hour)
+    pipe.Set(ctx, "cached:"+spec.ID, 1, 24*time.Hour)
+    if _, err := pipe.Exec(ctx); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to create job"})
+        return
+    }
+    // Last, so the job is never completed without its result
+    if _, err := setStatus(ctx, spec.ID, StatusCompleted, 24*time.Hour); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to create job"})
+        return
+    }
+    recordCreated(ctx, spec.ID, jobData)
+    publishStatus(ctx, spec.ID, "completed", "served from cache")
+
+    submitted := auditEventFor(c, auditJobSubmitted, spec.ID, spec.OwnerID)
+    submitted.After = "completed"
+    audit.Record(ctx, submitted)
+    countSubmission(ctx)
+    fireWebhooks(spec.OwnerID, "job.submitted", spec.ID, jobData)
+    fireWebhooks(spec.OwnerID, "job.completed", spec.ID, json.RawMessage(result))
+    registerCallback(ctx, spec.ID, spec.CallbackURL, spec.CallbackSecret)
+    fireCallback(spec.ID, "completed", json.RawMessage(result))
+    registerNotifyEmail(ctx, spec.ID, spec.NotifyEmail)
+    fireEmail(spec.ID, "completed", json.RawMessage(result))
+
+    c.JSON(http.StatusOK, api.SubmitJobResponse{
+        JobID:     spec.ID,
+        Status:    "completed",
+        Cached:    true,
+        Message:   "Result served from cache. Fetch it from " + statusPath(c, spec.ID) + ".",
+        ExpiresAt: jobExpiry(cfg().ResultTTL(StatusCompleted)),
+    })
+}
+
+func fileSHA256(fh *multipart.FileHeader) (string, error) {
+    f, err := fh.Open()
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    h := sha256.New()
+    if _, err := io.Copy(h, f); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// The SCAN-based aggregates behind GET /queue are cached here so dashboards
+// polling every second don't each walk the keyspace.
+const (
+    queueStatsKey = "stats:queue"
+    queueStatsTTL = 10 * time.Second
+)
+
+type queueStats struct {
+    // Jobs per status; status:{id} keys expire after 24h, so this covers
+    // the last day
+    StatusCounts map[string]int64 `json:"status_counts"`
+    // Age of the longest-waiting job still on a list, nil when none are
+    OldestQueuedSeconds *int64 `json:"oldest_queued_seconds"`
+    // Mean of recent completions, nil until there is history
+    AvgCompletionSeconds *int64 `json:"avg_completion_seconds"`
+    GeneratedAt          string `json:"generated_at"`
+}
+
+// cachedQueueStats returns the cached aggregates, recomputing them when
+// the cache has expired.
+func cachedQueueStats(ctx context.Context) (*queueStats, error) {
+    var stats queueStats
+    data, err := rdb.Get(ctx, queueStatsKey).Bytes()
+    if err == nil && json.Unmarshal(data, &stats) == nil {
+        return &stats, nil
+    } else if err != nil && err != redis.Nil {
+        return nil, err
+    }
+
+    s, err := computeQueueStats(ctx)
+    if err != nil {
+        return nil, err
+    }
+    data, _ = json.Marshal(s)
+    rdb.Set(ctx, queueStatsKey, data, queueStatsTTL)
+    return s, nil
+}
+
+func computeQueueStats(ctx context.Context) (*queueStats, error) {
+    counts, err := statusCounts(ctx)
+    if err != nil {
+        return nil, err
+    }
+    s := &queueStats{
+        StatusCounts: counts,
+        GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+    }
+    if oldest, ok := oldestQueuedAge(ctx); ok {
+        s.OldestQueuedSeconds = &oldest
+    }
+    if avg, ok := recordedSliceTime(ctx); ok {
+        secs := int64(avg.Seconds())
+        s.AvgCompletionSeconds = &secs
+    }
+    return s, nil
+}
+
+// statusCounts SCANs status:* and tallies the values in batches.
+func statusCounts(ctx context.Context) (map[string]int64, error) {
+    counts := map[string]int64{}
+    iter := rdb.Scan(ctx, 0, "status:*", 500).Iterator()
+    var batch []string
+    flush := func() error {
+        if len(batch) == 0 {
+            return nil
+        }
+        vals, err := rdb.MGet(ctx, batch...).Result()
+        if err != nil {
+            return err
+        }
+        for _, v := range vals {
+            if status, ok := v.(string); ok {
+                counts[status]++
+            }
+        }
+        batch = batch[:0]
+        return nil
+    }
+    for iter.Next(ctx) {
+        batch = append(batch, iter.Val())
+        if len(batch) == 500 {
+            if err := flush(); err != nil {
+                return nil, err
+            }
+        }
+    }
+    if err := iter.Err(); err != nil {
+        return nil, err
+    }
+    return counts, flush()
+}
+
+// oldestQueuedAge looks at the head of each queue and of each submitter's
+// fair list, which are the jobs that have waited longest there. Payloads
+// without submitted_at are skipped.
+func oldestQueuedAge(ctx context.Context) (int64, bool) {
+    var oldest int64
+    found := false
+    note := func(submittedAt int64) {
+        if age := time.Now().Unix() - submittedAt; !found || age > oldest {
+            oldest, found = age, true
+        }
+    }
+    for _, q := range jobQueues() {
+        if submittedAt, ok := queueHeadSubmittedAt(ctx, q); ok {
+            note(submittedAt)
+        }
+        // Read even with FAIR_SCHEDULING off, so jobs left behind when it
+        // was turned off still count
+        submitters, _ := rdb.ZRange(ctx, fairIndexKey(q), 0, -1).Result()
+        for _, s := range submitters {
+            head, err := rdb.LIndex(ctx, fairListKey(q, s), 0).Result()
+            if err != nil {
+                continue
+            }
+            if submittedAt, ok := payloadSubmittedAt(head); ok {
+                note(submittedAt)
+            }
+        }
+    }
+    return oldest, found
+}
+
+// queueHeadSubmittedAt is when the job at the head of queue was submitted:
+// the first undelivered stream entry, and while publishing to both the
+// newer of that and the list head, as in queueBacklog.
+func queueHeadSubmittedAt(ctx context.Context, queue string) (int64, bool) {
+    var heads []string
+    if group, err := streamGroup(ctx, queue); err == nil && group != nil {
+        if entries, err := undelivered(ctx, queue, group, 1); err == nil && len(entries) > 0 {
+            if p, ok := entries[0].Values["payload"].(string); ok {
+                heads = append(heads, p)
+            }
+        }
+    }
+    if legacyListQueue() {
+        head, err := rdb.LIndex(ctx, queue, 0).Result()
+        if err != nil || len(heads) == 0 {
+            return 0, false
+        }
+        heads = append(heads, head)
+    }
+
+    var newest int64
+    for _, h := range heads {
+        submittedAt, ok := payloadSubmittedAt(h)
+        if !ok {
+            return 0, false
+        }
+        newest = max(newest, submittedAt)
+    }
+    return newest, newest > 0
+}
+
+func payloadSubmittedAt(payload string) (int64, bool) {
+    var job struct {
+        SubmittedAt int64 `json:"submitted_at"`
+    }
+    if unmarshalPayload([]byte(payload), &job) != nil || job.SubmittedAt == 0 {
+        return 0, false
+    }
+    return job.SubmittedAt, true
+}
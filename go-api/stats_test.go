@@ -0,0 +1,44 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+)
+
+func TestOldestQueuedAgeSkipsClaimedEntries(t *testing.T) {
+    setupTest(t, func(c *Config) { c.LegacyListQueue = false })
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    now := time.Now().Unix()
+    for i, ago := range []int64{600, 5} {
+        id := []string{"claimed", "waiting"}[i]
+        data, _ := json.Marshal(map[string]interface{}{"id": id, "submitted_at": now - ago})
+        enqueue(ctx, standardQueue, id, data)
+    }
+    // A worker has the older job, so only the newer one is still waiting
+    readFromStream(t, 1)
+
+    age, ok := oldestQueuedAge(ctx)
+    if !ok || age < 5 || age > 15 {
+        t.Fatalf("oldestQueuedAge = %d, %v; want about 5", age, ok)
+    }
+}
+
+func TestOldestQueuedAgeIncludesFairLists(t *testing.T) {
+    setupTest(t, func(c *Config) { c.FairScheduling = true })
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    now := time.Now().Unix()
+    fresh, _ := json.Marshal(map[string]interface{}{"id": "fresh", "submitted_at": now - 5})
+    held, _ := json.Marshal(map[string]interface{}{"id": "held", "submitted_at": now - 600})
+    enqueue(ctx, standardQueue, "fresh", fresh)
+    submitJob(ctx, standardQueue, "held", "alice", held)
+
+    age, ok := oldestQueuedAge(ctx)
+    if !ok || age < 600 || age > 610 {
+        t.Fatalf("oldestQueuedAge = %d, %v; want about 600", age, ok)
+    }
+}
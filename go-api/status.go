@@ -0,0 +1,312 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/base64"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// statusETag hashes the raw Redis bytes the response is built from. Jobs that
+// haven't finished get a weak tag since their result is not final yet.
+func statusETag(status, result string, complete bool) string {
+    sum := sha256.Sum256([]byte(status + result))
+    tag := `"` + base64.StdEncoding.EncodeToString(sum[:]) + `"`
+    if !complete {
+        return "W/" + tag
+    }
+    return tag
+}
+
+// statusMaxAge is how long clients and proxies may reuse the /status of a
+// finished job without asking again. Its result won't change, though an
+// extension or a late callback delivery may still touch the rest.
+const statusMaxAge = 60 * time.Second
+
+// etagMatches implements the weak comparison If-None-Match uses.
+func etagMatches(ifNoneMatch, etag string) bool {
+    if ifNoneMatch == "" {
+        return false
+    }
+    want := strings.TrimPrefix(etag, "W/")
+    for _, candidate := range strings.Split(ifNoneMatch, ",") {
+        candidate = strings.TrimSpace(candidate)
+        if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+            return true
+        }
+    }
+    return false
+}
+
+// Endpoint 2: Check Status (Polling). With ?wait= it long-polls: the
+// response is held until the status changes or the wait is up. ?fields=
+// trims it to the named keys, e.g. fields=status,progress.
+//
+//	@Summary	Get a job's status, and its result once finished
+//	@Tags		jobs
+//	@Produce	json
+//	@Param		id		path		string	true	"Job ID"
+//	@Param		wait	query		string	false	"Long-poll up to this long, e.g. 25s"
+//	@Param		fields	query		string	false	"Comma-separated response keys to return"
+//	@Success	200		{object}	api.StatusResponse
+//	@Success	304		"Unchanged since If-None-Match"
+//	@Failure	404		{object}	api.ErrorResponse
+//	@Router		/status/{id} [get]
+func handleStatus(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    wait, err := parseStatusWait(c.Query("wait"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if wait > 0 {
+        if err := awaitStatusChange(ctx, jobID, wait); err != nil {
+            c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+            return
+        }
+    }
+
+    // 1. Read STATUS and RESULT in one round trip so the ETag and the body
+    // always describe the same snapshot, even if the worker writes in between
+    pipe := rdb.Pipeline()
+    read := queueStatusRead(ctx, pipe, jobID)
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+
+    // Handle missing key: Job ID invalid or expired
+    st, ok := read.state()
+    if !ok {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+
+    // Position moves as jobs ahead complete, so it's part of the ETag too
+    var position int64 = -1
+    if st.status == StatusQueued {
+        position, _ = queuePosition(ctx, jobID)
+    }
+    // So do workers going away, for jobs still waiting on one
+    workersUp := st.status.IsTerminal() || workerOnline(ctx)
+    fields := requestedFields(c)
+
+    // 2. Short-circuit unchanged polls
+    etag := statusETag(string(st.status)+st.note+st.attempts+st.nextRetryAt+strconv.FormatInt(position, 10)+st.progress+strconv.FormatBool(st.stale)+st.abortedAt+st.createdAt+st.startedAt+st.completedAt+st.statusChangedAt+st.expiresAt+st.delivered+strconv.FormatBool(st.hasThumbnail)+strconv.FormatBool(workersUp)+strings.Join(fields, ","), st.result, st.finished() && st.result != "")
+    c.Header("ETag", etag)
+    // The response depends on the caller's credentials, hence private; an
+    // unfinished job is never to be served from a cache
+    if st.status.IsTerminal() {
+        c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(statusMaxAge.Seconds())))
+    } else {
+        c.Header("Cache-Control", "no-store")
+    }
+    if etagMatches(c.GetHeader("If-None-Match"), etag) {
+        c.Status(http.StatusNotModified)
+        return
+    }
+
+    // 3. Prepare the response
+    response := st.response()
+    if !st.status.IsTerminal() {
+        response.WorkerOnline = &workersUp
+    }
+    if position >= 0 {
+        eta := int64(averageSliceTime(ctx).Seconds()) * position
+        response.Position, response.EtaSeconds = &position, &eta
+    }
+
+    c.JSON(http.StatusOK, selectFields(response, fields))
+}
+
+// statusRead is the reads /status makes for one job, queued on a pipeline so
+// any number of jobs can be read in one round trip.
+type statusRead struct {
+    jobID    string
+    mget     *redis.SliceCmd
+    ttl      *redis.DurationCmd
+    callback *redis.StringCmd
+    thumb    *redis.IntCmd
+}
+
+func queueStatusRead(ctx context.Context, pipe redis.Pipeliner, jobID string) statusRead {
+    return statusRead{
+        jobID: jobID,
+        mget: pipe.MGet(ctx, "status:"+jobID, "result:"+jobID, "note:"+jobID,
+            "attempts:"+jobID, "next_retry_at:"+jobID, "cached:"+jobID, progressKey(jobID), "aborted_at:"+jobID,
+            "created_at:"+jobID, "started_at:"+jobID, "completed_at:"+jobID, statusChangedKey(jobID)),
+        ttl:      pipe.TTL(ctx, "status:"+jobID),
+        callback: pipe.HGet(ctx, callbackKey(jobID), "delivered"),
+        thumb:    pipe.Exists(ctx, thumbnailKey(jobID)),
+    }
+}
+
+// jobState is a job as its keys describe it, once the pipeline has run.
+type jobState struct {
+    jobID                                                         string
+    status                                                        JobStatus
+    result, note, attempts, nextRetryAt, progress, abortedAt      string
+    createdAt, startedAt, completedAt, statusChangedAt, expiresAt string
+    cached, stale, hasProgress, hasThumbnail                      bool
+    p                                                             jobProgress
+    // Set once the callback_url has been tried
+    delivered string
+}
+
+// state reports false when the job has no status: its ID is invalid or it
+// expired.
+func (r statusRead) state() (jobState, bool) {
+    vals := r.mget.Val()
+    if len(vals) == 0 {
+        return jobState{}, false
+    }
+    st := jobState{jobID: r.jobID}
+    raw, ok := vals[0].(string)
+    if !ok {
+        return jobState{}, false
+    }
+    if st.status = parseJobStatus(raw); st.status == StatusUnknown {
+        log.Printf("WARN status of %s is %q, which isn't a status", r.jobID, raw)
+    }
+    st.result, _ = vals[1].(string)
+    st.note, _ = vals[2].(string)
+    st.attempts, _ = vals[3].(string)
+    st.nextRetryAt, _ = vals[4].(string)
+    st.cached = vals[5] != nil
+    st.progress, _ = vals[6].(string)
+    st.abortedAt, _ = vals[7].(string)
+    st.createdAt, _ = vals[8].(string)
+    if raw, ok := vals[9].(string); ok {
+        st.startedAt = startedAtTime(raw)
+    }
+    st.completedAt, _ = vals[10].(string)
+    st.statusChangedAt, _ = vals[11].(string)
+    st.delivered = r.callback.Val()
+    st.hasThumbnail = r.thumb.Val() > 0
+    // Keys without an expiry report a negative TTL
+    if ttl := r.ttl.Val(); ttl > 0 {
+        st.expiresAt = time.Now().Add(ttl).UTC().Truncate(time.Minute).Format(time.RFC3339)
+    }
+    if st.status != StatusProcessing {
+        st.progress = ""
+    }
+    // A report turning stale changes the body without any key changing
+    st.p, st.hasProgress = parseProgress(st.progress)
+    st.stale = st.hasProgress && st.p.UpdatedAt > 0 && time.Since(time.Unix(st.p.UpdatedAt, 0)) > progressStaleAfter
+    if !st.finished() {
+        st.result = ""
+    }
+    return st, true
+}
+
+func (st jobState) finished() bool {
+    return st.status == StatusCompleted || st.status == StatusFailed
+}
+
+// response is the /status body as far as the job's own keys go; queue
+// position and worker liveness are left to the caller.
+func (st jobState) response() api.StatusResponse {
+    response := api.StatusResponse{
+        JobID:           st.jobID,
+        Status:          string(st.status),
+        Note:            st.note,
+        NextRetryAt:     st.nextRetryAt,
+        Cached:          st.cached,
+        CreatedAt:       st.createdAt,
+        StartedAt:       st.startedAt,
+        StatusChangedAt: st.statusChangedAt,
+        ExpiresAt:       st.expiresAt,
+        HasThumbnail:    st.hasThumbnail,
+    }
+    if n, err := strconv.Atoi(st.attempts); err == nil {
+        response.Attempts = &n
+    }
+    if st.delivered != "" {
+        delivered := st.delivered == "true"
+        response.WebhookDelivered = &delivered
+    }
+    if st.status == StatusAborted {
+        response.AbortedAt = st.abortedAt
+    }
+    // A replayed job's last finish no longer applies
+    if st.status.IsTerminal() {
+        response.CompletedAt = st.completedAt
+    }
+    if st.hasProgress {
+        response.CurrentStep = st.p.Stage
+        response.ProgressPercent = &st.p.Percent
+        if st.p.UpdatedAt > 0 {
+            response.ProgressUpdatedAt = time.Unix(st.p.UpdatedAt, 0).UTC().Format(time.RFC3339)
+            response.ProgressStale = &st.stale
+        }
+    }
+
+    // If finished completed OR failed, attach the result data
+    if st.finished() && st.result != "" {
+        if data, ok := exposedResult(st.jobID, st.result); ok {
+            response.Data = &data
+        }
+    }
+    return response
+}
+
+// bulkStatusLimit caps how many jobs one POST /status may ask about.
+const bulkStatusLimit = 100
+
+// POST /status {"ids": [...]} returns {"jobs": {id: status}} for up to 100
+// jobs, read in one pipeline. Each status is what GET /status/:id returns
+// apart from position, eta_seconds and worker_online, which cost a round trip
+// per job; jobs that don't exist are {"not_found": true}.
+//
+//	@Summary	Get the status of up to 100 jobs
+//	@Tags		jobs
+//	@Accept		json
+//	@Produce	json
+//	@Success	200	{object}	api.BulkStatusResponse
+//	@Failure	400	{object}	api.ErrorResponse
+//	@Router		/status [post]
+func handleBulkStatus(c *gin.Context) {
+    var req struct {
+        IDs []string `json:"ids" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if len(req.IDs) == 0 || len(req.IDs) > bulkStatusLimit {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "ids must list 1 to " + strconv.Itoa(bulkStatusLimit) + " jobs"})
+        return
+    }
+    ctx := c.Request.Context()
+    pipe := rdb.Pipeline()
+    reads := make(map[string]statusRead, len(req.IDs))
+    for _, id := range req.IDs {
+        if _, seen := reads[id]; !seen {
+            reads[id] = queueStatusRead(ctx, pipe, id)
+        }
+    }
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    jobs := make(map[string]api.StatusResponse, len(reads))
+    for id, read := range reads {
+        if st, ok := read.state(); ok {
+            jobs[id] = st.response()
+        } else {
+            jobs[id] = api.StatusResponse{NotFound: true}
+        }
+    }
+    c.JSON(http.StatusOK, api.BulkStatusResponse{Jobs: jobs})
+}
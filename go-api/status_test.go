@@ -0,0 +1,108 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestStatusETag(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    first := do(r, http.MethodGet, "/status/j1", "")
+    etag := first.Header().Get("ETag")
+    if first.Code != http.StatusOK || etag == "" {
+        t.Fatalf("status = %d, ETag %q; want 200 with an ETag", first.Code, etag)
+    }
+    if !strings.HasPrefix(etag, "W/") {
+        t.Errorf("ETag %q of an unfinished job should be weak", etag)
+    }
+    if cc := first.Header().Get("Cache-Control"); cc != "no-store" {
+        t.Errorf("Cache-Control %q of an unfinished job, want no-store", cc)
+    }
+
+    w := do(r, http.MethodGet, "/status/j1", "", "If-None-Match", etag)
+    if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+        t.Fatalf("matching poll: status = %d, body %q; want an empty 304", w.Code, w.Body)
+    }
+
+    rdb.Set(ctx, "status:j1", "completed", 0)
+    rdb.Set(ctx, "result:j1", `{"price":12.5}`, 0)
+    w = do(r, http.MethodGet, "/status/j1", "", "If-None-Match", etag)
+    done := w.Header().Get("ETag")
+    if w.Code != http.StatusOK || done == "" || done == etag {
+        t.Fatalf("after completion: status = %d, ETag %q (was %q); want 200 with a new ETag", w.Code, done, etag)
+    }
+    if strings.HasPrefix(done, "W/") {
+        t.Errorf("ETag %q of a completed job should be strong", done)
+    }
+    if cc := w.Header().Get("Cache-Control"); cc != "private, max-age=60" {
+        t.Errorf("Cache-Control %q of a completed job, want private, max-age=60", cc)
+    }
+    if w := do(r, http.MethodGet, "/status/j1", "", "If-None-Match", done); w.Code != http.StatusNotModified || w.Header().Get("Cache-Control") == "" {
+        t.Errorf("304 for a completed job: %d, Cache-Control %q; want it kept on the 304", w.Code, w.Header().Get("Cache-Control"))
+    }
+
+    tests := []struct {
+        name        string
+        ifNoneMatch string
+        want        int
+    }{
+        {"weak form of the strong tag", "W/" + done, http.StatusNotModified},
+        {"one of several", `"stale", ` + done + `, "other"`, http.StatusNotModified},
+        {"list without it", `"stale", W/"other"`, http.StatusOK},
+        {"wildcard", "*", http.StatusNotModified},
+        {"previous tag", etag, http.StatusOK},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if w := do(r, http.MethodGet, "/status/j1", "", "If-None-Match", tt.ifNoneMatch); w.Code != tt.want {
+                t.Errorf("If-None-Match %s: status = %d, want %d", tt.ifNoneMatch, w.Code, tt.want)
+            }
+        })
+    }
+}
+
+func TestBulkStatus(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+    rdb.Set(ctx, "note:j1", "slicing", 0)
+    rdb.Set(ctx, "status:j2", "completed", 0)
+    rdb.Set(ctx, "result:j2", `{"price":12.5}`, 0)
+
+    w := do(r, http.MethodPost, "/status", `{"ids":["j1","j2","nope","j1"]}`)
+    if w.Code != http.StatusOK {
+        t.Fatalf("status = %d, body %s", w.Code, w.Body)
+    }
+    var resp struct {
+        Jobs map[string]map[string]interface{} `json:"jobs"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if len(resp.Jobs) != 3 {
+        t.Fatalf("jobs = %v, want 3 entries", resp.Jobs)
+    }
+    if j := resp.Jobs["j1"]; j["status"] != "processing" || j["note"] != "slicing" {
+        t.Errorf("j1 = %v", j)
+    }
+    if data, _ := resp.Jobs["j2"]["data"].(map[string]interface{}); data["price"] != 12.5 {
+        t.Errorf("j2 = %v, want its result as data", resp.Jobs["j2"])
+    }
+    if resp.Jobs["nope"]["not_found"] != true {
+        t.Errorf("nope = %v, want not_found", resp.Jobs["nope"])
+    }
+
+    ids := make([]string, bulkStatusLimit+1)
+    for i := range ids {
+        ids[i] = fmt.Sprintf("%q", fmt.Sprint("j", i))
+    }
+    for _, body := range []string{`{"ids":[]}`, `{"ids":[` + strings.Join(ids, ",") + `]}`, `{}`} {
+        if w := do(r, http.MethodPost, "/status", body); w.Code != http.StatusBadRequest {
+            t.Errorf("%.40s: status = %d, want 400", body, w.Code)
+        }
+    }
+}
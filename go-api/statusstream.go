@@ -0,0 +1,208 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// statusEventsPrefix + job ID is the pub/sub channel the API publishes the
+// new status on whenever it writes one or a progress report. Workers that
+// write to Redis directly don't publish, which the streams' poll covers.
+const statusEventsPrefix = "status-events:"
+
+var (
+    // statusStreamPoll is how often a stream rereads the job regardless of
+    // events.
+    statusStreamPoll = 2 * time.Second
+    // statusStreamHeartbeat is how often an idle stream sends a comment so
+    // proxies don't time the connection out.
+    statusStreamHeartbeat = 15 * time.Second
+)
+
+// publishStatus records the job's new status, with detail, in its history
+// and timestamps, tells its status streams and passes it on to
+// subscriptions and chat. A final status also sets how long the job is
+// kept, and completions and failures count towards the SLA
+// report and the daily stats. Every status the API writes goes through here.
+func publishStatus(ctx context.Context, jobID, status, detail string) {
+    stampStatus(ctx, jobID, status)
+    recordTransition(ctx, jobID, status, detail)
+    rdb.Publish(ctx, statusEventsPrefix+jobID, status)
+    fanOutStatus(ctx, jobID, status)
+    notifyChat(ctx, jobID, status)
+    retainFinishedJob(ctx, jobID, status)
+    recordSLA(ctx, jobID, status)
+    countFinished(ctx, jobID, status)
+}
+
+// publishProgress tells the job's status streams of a progress report that
+// left the status as it was.
+func publishProgress(ctx context.Context, jobID, status string) {
+    rdb.Publish(ctx, statusEventsPrefix+jobID, status)
+}
+
+// statusSnapshot is what a status stream sends: the status, its note and
+// progress while processing, and the result data and has_thumbnail once
+// finished, in the same shape as /status. It returns redis.Nil for unknown or expired jobs.
+func statusSnapshot(ctx context.Context, jobID string) (gin.H, error) {
+    vals, err := rdb.MGet(ctx, "status:"+jobID, "result:"+jobID, "note:"+jobID, progressKey(jobID)).Result()
+    if err != nil {
+        return nil, err
+    }
+    status, ok := vals[0].(string)
+    if !ok {
+        return nil, redis.Nil
+    }
+    snap := gin.H{"job_id": jobID, "status": status}
+    if note, _ := vals[2].(string); note != "" {
+        snap["note"] = note
+    }
+    if raw, _ := vals[3].(string); status == "processing" {
+        if p, ok := parseProgress(raw); ok {
+            snap["current_step"] = p.Stage
+            snap["progress_percent"] = p.Percent
+        }
+    }
+    if res, _ := vals[1].(string); res != "" && (status == "completed" || status == "failed") {
+        if data, ok := exposedResult(jobID, res); ok {
+            snap["data"] = data
+        }
+        // Workers store it before reporting the job completed
+        if n, _ := rdb.Exists(ctx, thumbnailKey(jobID)).Result(); n > 0 {
+            snap["has_thumbnail"] = true
+        }
+    }
+    return snap, nil
+}
+
+// statusEvent is one message of a status stream: a changed snapshot, the
+// final status ("end", or "expired" when the keys went first), a heartbeat
+// while idle, or an error that ends the stream.
+type statusEvent struct {
+    Kind   string
+    Snap   gin.H
+    Detail string
+}
+
+// subscribeStatus subscribes to jobID's changes and then reads its first
+// snapshot, so no change in between is missed. On error the subscription is
+// already closed; redis.Nil means the job is unknown.
+func subscribeStatus(ctx context.Context, jobID string) (*redis.PubSub, gin.H, error) {
+    sub := rdb.Subscribe(ctx, statusEventsPrefix+jobID)
+    if _, err := sub.Receive(ctx); err != nil {
+        sub.Close()
+        return nil, nil, err
+    }
+    snap, err := statusSnapshot(ctx, jobID)
+    if err != nil {
+        sub.Close()
+        return nil, nil, err
+    }
+    return sub, snap, nil
+}
+
+// watchStatus passes emit snap and then every snapshot that differs from the
+// last, rereading on each published change and every statusStreamPoll, until
+// the job finishes, ctx ends or emit returns false. It backs both the SSE
+// stream and the WebSocket.
+func watchStatus(ctx context.Context, sub *redis.PubSub, jobID string, snap gin.H, emit func(statusEvent) bool) {
+    var last string
+    // next emits snap if it changed and reports whether to go on
+    next := func(snap gin.H) bool {
+        data, _ := json.Marshal(snap)
+        if string(data) != last {
+            last = string(data)
+            if !emit(statusEvent{Kind: "status", Snap: snap}) {
+                return false
+            }
+        }
+        status, _ := snap["status"].(string)
+        if parseJobStatus(status).IsTerminal() {
+            emit(statusEvent{Kind: "end", Detail: status})
+            return false
+        }
+        return true
+    }
+    if !next(snap) {
+        return
+    }
+
+    events := sub.Channel()
+    poll := time.NewTicker(statusStreamPoll)
+    defer poll.Stop()
+    heartbeat := time.NewTicker(statusStreamHeartbeat)
+    defer heartbeat.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-heartbeat.C:
+            if !emit(statusEvent{Kind: "heartbeat"}) {
+                return
+            }
+            continue
+        case <-events:
+        case <-poll.C:
+        }
+        snap, err := statusSnapshot(ctx, jobID)
+        if ctx.Err() != nil {
+            return
+        }
+        if err == redis.Nil {
+            // Its keys expired while we watched
+            emit(statusEvent{Kind: "end", Detail: "expired"})
+            return
+        } else if err != nil {
+            emit(statusEvent{Kind: "error", Detail: "Redis error"})
+            return
+        }
+        if !next(snap) {
+            return
+        }
+    }
+}
+
+// GET /status/:id/stream sends the job's status as server-sent events: a
+// "status" event straight away and on every change, then "end" with the
+// final status once it finishes.
+func handleStatusStream(c *gin.Context) {
+    reqCtx := c.Request.Context()
+    jobID := c.Param("id")
+
+    sub, snap, err := subscribeStatus(reqCtx, jobID)
+    if err == redis.Nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    defer sub.Close()
+
+    c.Header("Content-Type", "text/event-stream")
+    c.Header("Cache-Control", "no-cache")
+    c.Header("X-Accel-Buffering", "no")
+    c.Status(http.StatusOK)
+
+    watchStatus(reqCtx, sub, jobID, snap, func(ev statusEvent) bool {
+        switch ev.Kind {
+        case "status":
+            data, _ := json.Marshal(ev.Snap)
+            fmt.Fprintf(c.Writer, "event: status\ndata: %s\n\n", data)
+        case "heartbeat":
+            fmt.Fprint(c.Writer, ": heartbeat\n\n")
+        default:
+            fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", ev.Kind, ev.Detail)
+        }
+        c.Writer.Flush()
+        return true
+    })
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func streamTimers(t *testing.T, poll, heartbeat time.Duration) {
+    savedPoll, savedHeartbeat := statusStreamPoll, statusStreamHeartbeat
+    statusStreamPoll, statusStreamHeartbeat = poll, heartbeat
+    t.Cleanup(func() { statusStreamPoll, statusStreamHeartbeat = savedPoll, savedHeartbeat })
+}
+
+// openStatusStream starts GET /status/:id/stream and waits until it has
+// subscribed. The returned channel yields the body once the stream ends.
+func openStatusStream(t *testing.T, h http.Handler, jobID string) <-chan string {
+    t.Helper()
+    done := make(chan string, 1)
+    go func() {
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status/"+jobID+"/stream", nil))
+        done <- w.Body.String()
+    }()
+    for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+        if rdb.PubSubNumSub(ctx, statusEventsPrefix+jobID).Val()[statusEventsPrefix+jobID] > 0 {
+            return done
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("stream never subscribed")
+        }
+    }
+}
+
+func streamBody(t *testing.T, done <-chan string) string {
+    t.Helper()
+    select {
+    case body := <-done:
+        return body
+    case <-time.After(2 * time.Second):
+        t.Fatal("stream didn't end")
+        return ""
+    }
+}
+
+func TestStatusStreamFollowsEvents(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    // Only pub/sub can move the stream along
+    streamTimers(t, time.Hour, time.Hour)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    done := openStatusStream(t, r, "j1")
+    reportStatus(t, r, "j1", `{"status":"processing","step":"slicing","progress_percent":40}`)
+    reportStatus(t, r, "j1", `{"status":"completed","result":{"summary":{"total_cost":9.9}}}`)
+    body := streamBody(t, done)
+
+    want := []string{
+        `data: {"job_id":"j1","status":"processing"}`,
+        `"current_step":"slicing","job_id":"j1","progress_percent":40`,
+        `"status":"completed"`,
+        "event: end\ndata: completed\n",
+    }
+    at := 0
+    for _, w := range want {
+        i := strings.Index(body[at:], w)
+        if i < 0 {
+            t.Fatalf("stream is missing %q after offset %d:\n%s", w, at, body)
+        }
+        at += i + len(w)
+    }
+}
+
+func TestStatusStreamPollsForDirectWrites(t *testing.T) {
+    setupTest(t)
+    streamTimers(t, 10*time.Millisecond, 5*time.Millisecond)
+    rdb.Set(ctx, "status:j1", "processing", 0)
+
+    done := openStatusStream(t, newRouter(), "j1")
+    time.Sleep(30 * time.Millisecond)
+    // As a worker without the internal API does, without publishing
+    rdb.Set(ctx, "status:j1", "failed", 0)
+    body := streamBody(t, done)
+    if !strings.Contains(body, "event: end\ndata: failed\n") {
+        t.Fatalf("stream didn't pick up the failure:\n%s", body)
+    }
+    if !strings.Contains(body, ": heartbeat\n") {
+        t.Errorf("stream sent no heartbeat:\n%s", body)
+    }
+}
+
+func TestStatusStreamFinishedJob(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "cancelled", 0)
+
+    w := do(r, http.MethodGet, "/status/j1/stream", "")
+    if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "text/event-stream" {
+        t.Fatalf("status = %d, Content-Type %q; want a 200 event stream", w.Code, ct)
+    }
+    if body := w.Body.String(); !strings.Contains(body, `"status":"cancelled"`) || !strings.Contains(body, "event: end\ndata: cancelled\n") {
+        t.Fatalf("finished job should get its status and end at once:\n%s", body)
+    }
+    if w := do(r, http.MethodGet, "/status/missing/stream", ""); w.Code != http.StatusNotFound {
+        t.Errorf("missing job: status = %d, want 404", w.Code)
+    }
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// STLMetadata is what ParseSTLMetadata reads from a model, in millimetres
+// as STL files conventionally are.
+type STLMetadata struct {
+    Triangles int
+    // Enclosed volume; meshes with holes come out low
+    VolumeMM3 float64
+    // Width, depth and height of the bounding box
+    SizeMM [3]float64
+    Bounds BoundingBox
+}
+
+// BoundingBox is the smallest axis-aligned box around a model.
+type BoundingBox struct {
+    Min, Max [3]float64
+}
+
+// VolumeCM3 is the volume in cubic centimetres.
+func (m STLMetadata) VolumeCM3() float64 {
+    return m.VolumeMM3 / 1000
+}
+
+var errNotSTL = errors.New("not an STL file")
+
+// stlBinaryHeader is the 80-byte header and triangle count of a binary STL;
+// each triangle then takes 50 bytes.
+const (
+    stlBinaryHeader   = 84
+    stlBinaryTriangle = 50
+)
+
+// ParseSTLMetadata reads a binary or ASCII STL. The volume is the sum of
+// the signed tetrahedra each triangle forms with the origin, so it needs a
+// closed, consistently wound mesh; an inside-out one comes out the same.
+func ParseSTLMetadata(data []byte) (STLMetadata, error) {
+    var acc stlAccumulator
+    if err := eachSTLTriangle(data, acc.add); err != nil {
+        return STLMetadata{}, err
+    }
+    return acc.metadata()
+}
+
+// eachSTLTriangle calls add with the vertices of each of data's triangles,
+// stopping at the first error.
+func eachSTLTriangle(data []byte, add func(v [3][3]float64) error) error {
+    if len(data) >= stlBinaryHeader {
+        n := binary.LittleEndian.Uint32(data[80:84])
+        // Binary files may start with "solid" too; the size settles it
+        if uint64(len(data)) == stlBinaryHeader+uint64(n)*stlBinaryTriangle {
+            for i := 0; i < int(n); i++ {
+                // Each triangle: its normal, three vertices, two spare bytes
+                t := data[stlBinaryHeader+i*stlBinaryTriangle+12:]
+                var v [3][3]float64
+                for j := range v {
+                    for k := range v[j] {
+                        v[j][k] = float64(math.Float32frombits(binary.LittleEndian.Uint32(t[(j*3+k)*4:])))
+                    }
+                }
+                if err := add(v); err != nil {
+                    return err
+                }
+            }
+            return nil
+        }
+    }
+    if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+        return errNotSTL
+    }
+
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    var v [3][3]float64
+    vertices := 0
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 0 || fields[0] != "vertex" {
+            continue
+        }
+        if len(fields) != 4 {
+            return errNotSTL
+        }
+        for k := 0; k < 3; k++ {
+            f, err := strconv.ParseFloat(fields[k+1], 64)
+            if err != nil {
+                return errNotSTL
+            }
+            v[vertices%3][k] = f
+        }
+        vertices++
+        if vertices%3 == 0 {
+            if err := add(v); err != nil {
+                return err
+            }
+        }
+    }
+    if err := scanner.Err(); err != nil || vertices%3 != 0 {
+        return errNotSTL
+    }
+    return nil
+}
+
+// stlAccumulator sums the volume and bounds triangle by triangle.
+type stlAccumulator struct {
+    triangles int
+    volume    float64
+    min, max  [3]float64
+}
+
+func (a *stlAccumulator) add(v [3][3]float64) error {
+    if a.triangles == 0 {
+        a.min, a.max = v[0], v[0]
+    }
+    for _, p := range v {
+        for k, c := range p {
+            if math.IsNaN(c) || math.IsInf(c, 0) {
+                return errNotSTL
+            }
+            a.min[k] = math.Min(a.min[k], c)
+            a.max[k] = math.Max(a.max[k], c)
+        }
+    }
+    a.volume += signedVolume(v)
+    a.triangles++
+    return nil
+}
+
+// signedVolume is that of the tetrahedron v forms with the origin, positive
+// when v is wound counter-clockwise seen from outside.
+func signedVolume(v [3][3]float64) float64 {
+    // v0 · (v1 × v2) is six times the tetrahedron's signed volume
+    return (v[0][0]*(v[1][1]*v[2][2]-v[1][2]*v[2][1]) -
+        v[0][1]*(v[1][0]*v[2][2]-v[1][2]*v[2][0]) +
+        v[0][2]*(v[1][0]*v[2][1]-v[1][1]*v[2][0])) / 6
+}
+
+func (a *stlAccumulator) metadata() (STLMetadata, error) {
+    if a.triangles == 0 {
+        return STLMetadata{}, errors.New("the model has no triangles")
+    }
+    m := STLMetadata{Triangles: a.triangles, VolumeMM3: math.Abs(a.volume), Bounds: BoundingBox{a.min, a.max}}
+    for k := range m.SizeMM {
+        m.SizeMM[k] = a.max[k] - a.min[k]
+    }
+    return m, nil
+}
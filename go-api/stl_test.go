@@ -0,0 +1,102 @@
+package main
+
+import (
+    "encoding/binary"
+    "fmt"
+    "math"
+    "strings"
+    "testing"
+)
+
+// cubeTriangles are the 12 outward-facing triangles of a cube with edge
+// side at the origin.
+func cubeTriangles(side float64) [][3][3]float64 {
+    return boxTriangles([3]float64{}, [3]float64{side, side, side})
+}
+
+// boxTriangles are those of the box from lo to hi.
+func boxTriangles(lo, hi [3]float64) [][3][3]float64 {
+    x0, y0, z0, x1, y1, z1 := lo[0], lo[1], lo[2], hi[0], hi[1], hi[2]
+    quads := [][4][3]float64{
+        {{x0, y0, z0}, {x0, y1, z0}, {x1, y1, z0}, {x1, y0, z0}}, // bottom
+        {{x0, y0, z1}, {x1, y0, z1}, {x1, y1, z1}, {x0, y1, z1}}, // top
+        {{x0, y0, z0}, {x1, y0, z0}, {x1, y0, z1}, {x0, y0, z1}}, // front
+        {{x0, y1, z0}, {x0, y1, z1}, {x1, y1, z1}, {x1, y1, z0}}, // back
+        {{x0, y0, z0}, {x0, y0, z1}, {x0, y1, z1}, {x0, y1, z0}}, // left
+        {{x1, y0, z0}, {x1, y1, z0}, {x1, y1, z1}, {x1, y0, z1}}, // right
+    }
+    var tris [][3][3]float64
+    for _, q := range quads {
+        tris = append(tris, [3][3]float64{q[0], q[1], q[2]}, [3][3]float64{q[0], q[2], q[3]})
+    }
+    return tris
+}
+
+func asciiSTL(tris [][3][3]float64) string {
+    var b strings.Builder
+    b.WriteString("solid cube\n")
+    for _, t := range tris {
+        b.WriteString("  facet normal 0 0 0\n    outer loop\n")
+        for _, v := range t {
+            fmt.Fprintf(&b, "      vertex %g %g %g\n", v[0], v[1], v[2])
+        }
+        b.WriteString("    endloop\n  endfacet\n")
+    }
+    b.WriteString("endsolid cube\n")
+    return b.String()
+}
+
+func binarySTL(tris [][3][3]float64) []byte {
+    // A header saying "solid", as some exporters write
+    data := make([]byte, stlBinaryHeader, stlBinaryHeader+len(tris)*stlBinaryTriangle)
+    copy(data, "solid exported")
+    binary.LittleEndian.PutUint32(data[80:], uint32(len(tris)))
+    for _, t := range tris {
+        tri := make([]byte, stlBinaryTriangle)
+        for j, v := range t {
+            for k, c := range v {
+                binary.LittleEndian.PutUint32(tri[12+(j*3+k)*4:], math.Float32bits(float32(c)))
+            }
+        }
+        data = append(data, tri...)
+    }
+    return data
+}
+
+func TestParseSTLMetadata(t *testing.T) {
+    cube := cubeTriangles(20)
+    // Inside out: every triangle wound the other way
+    var flipped [][3][3]float64
+    for _, tri := range cube {
+        flipped = append(flipped, [3][3]float64{tri[0], tri[2], tri[1]})
+    }
+    for name, data := range map[string][]byte{
+        "ascii":          []byte(asciiSTL(cube)),
+        "binary":         binarySTL(cube),
+        "inside out":     binarySTL(flipped),
+        "ascii, windows": []byte(strings.ReplaceAll(asciiSTL(cube), "\n", "\r\n")),
+    } {
+        m, err := ParseSTLMetadata(data)
+        if err != nil {
+            t.Errorf("%s: %v", name, err)
+            continue
+        }
+        if m.Triangles != 12 || math.Abs(m.VolumeCM3()-8) > 1e-9 || m.SizeMM != [3]float64{20, 20, 20} {
+            t.Errorf("%s: %+v, want 12 triangles, 8 cm³ and a 20mm box", name, m)
+        }
+    }
+}
+
+func TestParseSTLMetadataRejects(t *testing.T) {
+    for name, data := range map[string]string{
+        "not stl":        "ply\nformat ascii 1.0\n",
+        "empty solid":    "solid nothing\nendsolid nothing\n",
+        "half a facet":   "solid x\nvertex 0 0 0\nvertex 1 0 0\nendsolid x\n",
+        "bad coordinate": "solid x\nvertex 0 0 zero\nvertex 1 0 0\nvertex 0 1 0\nendsolid x\n",
+        "short binary":   string(binarySTL(cubeTriangles(1))[:200]),
+    } {
+        if m, err := ParseSTLMetadata([]byte(data)); err == nil {
+            t.Errorf("%s: accepted as %+v", name, m)
+        }
+    }
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "mime/multipart"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Storage holds /upload models until the worker downloads them. STORAGE_BACKEND
+// picks one: tmpfiles (tmpfiles.org, the default) or local (a directory this
+// server serves itself, for development without external services).
+type Storage interface {
+    // Name labels the backend in metrics.
+    Name() string
+    // Save stores r as name and returns the URL workers download it from.
+    Save(ctx context.Context, name string, r io.Reader) (string, error)
+    Delete(ctx context.Context, name string) error
+    // Exists reports whether the file at url, as Save returned it, is still
+    // stored. URLs the backend didn't hand out count as there.
+    Exists(ctx context.Context, url string) (bool, error)
+    // Check is the readiness probe's test of the backend.
+    Check(ctx context.Context) error
+}
+
+const (
+    storageTmpfiles = "tmpfiles"
+    storageLocal    = "local"
+)
+
+// localStorageWarnBytes is the upload size past which serving files from
+// the API's own disk is a poor fit outside development.
+const localStorageWarnBytes = 100 << 20
+
+// errStorageRejected is a storage answer that isn't a stored file.
+var errStorageRejected = errors.New("storage rejected file")
+
+// activeStorage is the configured backend.
+func activeStorage() Storage {
+    if cfg().StorageBackend == storageLocal {
+        return LocalStorage{Dir: cfg().LocalStoragePath, BaseURL: cfg().Host}
+    }
+    return TmpfilesStorage{}
+}
+
+// initStorage prepares the configured backend while the server starts.
+func initStorage() error {
+    c := cfg()
+    if c.StorageBackend != storageLocal {
+        return nil
+    }
+    if err := os.MkdirAll(c.LocalStoragePath, 0o750); err != nil {
+        return err
+    }
+    if gin.Mode() == gin.ReleaseMode && c.MaxUploadBytes > localStorageWarnBytes {
+        log.Printf("WARNING: local storage in %s with MAX_UPLOAD_BYTES=%d; files over 100 MB belong on external storage in production", c.LocalStoragePath, c.MaxUploadBytes)
+    }
+    return nil
+}
+
+// storageName is what uploads are stored as: the job ID, keeping only the
+// file's extension from whatever name the client sent.
+func storageName(jobID, filename string) string {
+    ext := strings.ToLower(filepath.Ext(filepath.Base(filename)))
+    if len(ext) > 10 {
+        return jobID
+    }
+    for _, r := range ext[min(1, len(ext)):] {
+        if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+            return jobID
+        }
+    }
+    return jobID + ext
+}
+
+// storedUploadsKey orders stored /upload models by when their finished
+// job's retention runs out (unix seconds); the uploads sweep deletes them
+// then.
+const storedUploadsKey = "stored_uploads"
+
+// uploadName is what /upload stored jobID's model as, from storage_name in
+// its params, or "" for jobs that didn't upload one.
+func uploadName(ctx context.Context, jobID string) string {
+    payload, err := rdb.Get(ctx, "params:"+jobID).Result()
+    if err != nil {
+        return ""
+    }
+    job, err := readPayload([]byte(payload))
+    if err != nil {
+        return ""
+    }
+    name, _ := job["storage_name"].(string)
+    return name
+}
+
+// deleteUpload removes the model /upload stored for jobID once no worker
+// will download it. Call it before params:{id} is deleted.
+func deleteUpload(ctx context.Context, jobID string) {
+    name := uploadName(ctx, jobID)
+    if name == "" {
+        return
+    }
+    if err := activeStorage().Delete(ctx, name); err != nil && !errors.Is(err, os.ErrNotExist) {
+        log.Printf("storage: deleting %s for %s: %v", name, jobID, err)
+    }
+    rdb.ZRem(ctx, storedUploadsKey, name)
+}
+
+// retainUpload keeps jobID's stored model for as long as its params, ttl
+// from now.
+func retainUpload(ctx context.Context, jobID string, ttl time.Duration) {
+    if name := uploadName(ctx, jobID); name != "" {
+        rdb.ZAdd(ctx, storedUploadsKey, &redis.Z{Score: float64(time.Now().Add(ttl).Unix()), Member: name})
+    }
+}
+
+// pruneStoredUploads deletes the models of jobs whose retention has run out.
+func pruneStoredUploads() {
+    due, err := rdb.ZRangeByScore(ctx, storedUploadsKey, &redis.ZRangeBy{
+        Min: "-inf",
+        Max: strconv.FormatInt(time.Now().Unix(), 10),
+    }).Result()
+    if err != nil {
+        log.Printf("storage: %v", err)
+        return
+    }
+    store := activeStorage()
+    for _, name := range due {
+        if err := store.Delete(ctx, name); err != nil && !errors.Is(err, os.ErrNotExist) {
+            log.Printf("storage: deleting %s: %v", name, err)
+            continue
+        }
+        rdb.ZRem(ctx, storedUploadsKey, name)
+    }
+}
+
+// TmpfilesStorage proxies uploads to tmpfiles.org, which deletes them itself
+// after an hour.
+type TmpfilesStorage struct{}
+
+func (TmpfilesStorage) Name() string { return storageTmpfiles }
+
+func (TmpfilesStorage) Save(ctx context.Context, name string, r io.Reader) (string, error) {
+    body := &bytes.Buffer{}
+    writer := multipart.NewWriter(body)
+    part, _ := writer.CreateFormFile("file", name)
+    io.Copy(part, r)
+    writer.Close()
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, storageUploadURL, body)
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Content-Type", writer.FormDataContentType())
+    client := &http.Client{Timeout: 60 * time.Second}
+    resp, err := client.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    var tmpResp struct {
+        Status string `json:"status"`
+        Data   struct {
+            URL string `json:"url"`
+        } `json:"data"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&tmpResp); err != nil {
+        return "", fmt.Errorf("invalid response from storage: %w", err)
+    }
+    if tmpResp.Status != "success" {
+        return "", errStorageRejected
+    }
+    // CRITICAL: Convert Viewer URL to Download URL
+    // Viewer:   https://tmpfiles.org/12345/file.stl
+    // Download: https://tmpfiles.org/dl/12345/file.stl
+    return strings.Replace(tmpResp.Data.URL, "tmpfiles.org/", "tmpfiles.org/dl/", 1), nil
+}
+
+// Delete does nothing: tmpfiles.org has no delete API.
+func (TmpfilesStorage) Delete(context.Context, string) error { return nil }
+
+// Exists asks tmpfiles.org for the file, which it deletes after an hour.
+func (TmpfilesStorage) Exists(ctx context.Context, fileURL string) (bool, error) {
+    u, err := url.Parse(fileURL)
+    if err != nil {
+        return true, nil
+    }
+    if upload, _ := url.Parse(storageUploadURL); upload == nil || u.Host != upload.Host {
+        return true, nil
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodHead, fileURL, nil)
+    if err != nil {
+        return false, err
+    }
+    resp, err := storageClient.Do(req)
+    if err != nil {
+        return false, err
+    }
+    resp.Body.Close()
+    switch {
+    case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+        return false, nil
+    case resp.StatusCode >= 500:
+        return false, fmt.Errorf("storage answered %d", resp.StatusCode)
+    }
+    return true, nil
+}
+
+// Check counts tmpfiles.org as reachable when it answers at all below 500;
+// the upload endpoint needn't accept a HEAD.
+func (TmpfilesStorage) Check(ctx context.Context) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodHead, storageUploadURL, nil)
+    if err != nil {
+        return err
+    }
+    resp, err := storageClient.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    if resp.StatusCode >= 500 {
+        return fmt.Errorf("storage answered %d", resp.StatusCode)
+    }
+    return nil
+}
+
+// LocalStorage keeps uploads in Dir and serves them at BaseURL/files/:name.
+type LocalStorage struct {
+    Dir     string
+    BaseURL string
+}
+
+func (LocalStorage) Name() string { return storageLocal }
+
+func (s LocalStorage) path(name string) (string, error) {
+    if name == "" || filepath.Base(name) != name || name == "." || name == ".." {
+        return "", fmt.Errorf("invalid file name %q", name)
+    }
+    return filepath.Join(s.Dir, name), nil
+}
+
+func (s LocalStorage) Save(_ context.Context, name string, r io.Reader) (string, error) {
+    path, err := s.path(name)
+    if err != nil {
+        return "", err
+    }
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+    if err != nil {
+        return "", err
+    }
+    if _, err := io.Copy(f, r); err != nil {
+        f.Close()
+        os.Remove(path)
+        return "", err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(path)
+        return "", err
+    }
+    return strings.TrimSuffix(s.BaseURL, "/") + "/files/" + name, nil
+}
+
+func (s LocalStorage) Delete(_ context.Context, name string) error {
+    path, err := s.path(name)
+    if err != nil {
+        return err
+    }
+    return os.Remove(path)
+}
+
+func (s LocalStorage) Exists(_ context.Context, fileURL string) (bool, error) {
+    name, ok := strings.CutPrefix(fileURL, strings.TrimSuffix(s.BaseURL, "/")+"/files/")
+    if !ok {
+        return true, nil
+    }
+    path, err := s.path(name)
+    if err != nil {
+        return false, nil
+    }
+    if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+        return false, nil
+    } else if err != nil {
+        return false, err
+    }
+    return true, nil
+}
+
+func (s LocalStorage) Check(context.Context) error {
+    info, err := os.Stat(s.Dir)
+    if err != nil {
+        return err
+    }
+    if !info.IsDir() {
+        return fmt.Errorf("%s is not a directory", s.Dir)
+    }
+    return nil
+}
+
+// GET /files/:filename serves a file saved by LocalStorage. Names are job
+// IDs, so they can't be guessed.
+func handleLocalFile(c *gin.Context) {
+    s, ok := activeStorage().(LocalStorage)
+    if !ok {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "File not found"})
+        return
+    }
+    path, err := s.path(c.Param("filename"))
+    if err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "File not found"})
+        return
+    }
+    if _, err := os.Stat(path); err != nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "File not found"})
+        return
+    }
+    c.File(path)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// localStorage configures the local backend in a temporary directory.
+func localStorage(t *testing.T, configure ...func(*Config)) string {
+    t.Helper()
+    dir := filepath.Join(t.TempDir(), "uploads")
+    setupTest(t, append([]func(*Config){func(c *Config) {
+        c.StorageBackend = storageLocal
+        c.LocalStoragePath = dir
+        c.Host = "http://slicer.test:8000/"
+    }}, configure...)...)
+    if err := initStorage(); err != nil {
+        t.Fatal(err)
+    }
+    return dir
+}
+
+func uploadFile(t *testing.T, r http.Handler, filename, content string) *httptest.ResponseRecorder {
+    t.Helper()
+    body := &bytes.Buffer{}
+    mw := multipart.NewWriter(body)
+    part, _ := mw.CreateFormFile("file", filename)
+    part.Write([]byte(content))
+    mw.WriteField("material", "PLA")
+    mw.Close()
+    req := httptest.NewRequest(http.MethodPost, "/upload", body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    return w
+}
+
+func TestLocalStorageUploadAndServe(t *testing.T) {
+    dir := localStorage(t)
+    r := newRouter()
+
+    w := uploadFile(t, r, "../../bracket.STL", "solid bracket")
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("upload = %d %s, want 202", w.Code, w.Body)
+    }
+    var up struct {
+        JobID string `json:"job_id"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &up)
+    // The stored name is the job ID, whatever path the client sent
+    if data, err := os.ReadFile(filepath.Join(dir, up.JobID+".stl")); err != nil || string(data) != "solid bracket" {
+        t.Fatalf("stored file = %q, %v", data, err)
+    }
+
+    var job struct {
+        DownloadURL string `json:"download_url"`
+    }
+    params, _ := rdb.Get(ctx, "params:"+up.JobID).Result()
+    unmarshalPayload([]byte(params), &job)
+    want := "http://slicer.test:8000/files/" + up.JobID + ".stl"
+    if job.DownloadURL != want {
+        t.Fatalf("download_url = %q, want %q", job.DownloadURL, want)
+    }
+
+    w = do(r, http.MethodGet, strings.TrimPrefix(job.DownloadURL, "http://slicer.test:8000"), "")
+    if w.Code != http.StatusOK || w.Body.String() != "solid bracket" {
+        t.Fatalf("GET /files = %d %q", w.Code, w.Body)
+    }
+}
+
+func TestLocalFilesRejectsOtherPaths(t *testing.T) {
+    dir := localStorage(t)
+    os.WriteFile(filepath.Join(filepath.Dir(dir), "secret"), []byte("x"), 0o600)
+    r := newRouter()
+    for _, path := range []string{"/files/..%2Fsecret", "/files/..", "/files/missing.stl"} {
+        if w := do(r, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+            t.Errorf("GET %s = %d, want 404", path, w.Code)
+        }
+    }
+}
+
+func TestLocalStorageDelete(t *testing.T) {
+    dir := localStorage(t)
+    s := activeStorage()
+    if _, err := s.Save(context.Background(), "job.3mf", strings.NewReader("model")); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Delete(context.Background(), "job.3mf"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := os.Stat(filepath.Join(dir, "job.3mf")); !os.IsNotExist(err) {
+        t.Fatalf("file still there: %v", err)
+    }
+    if err := s.Delete(context.Background(), "../job.3mf"); err == nil {
+        t.Fatal("Delete outside the directory succeeded")
+    }
+}
+
+func TestCancelDeletesStoredUpload(t *testing.T) {
+    dir := localStorage(t)
+    r := newRouter()
+
+    w := uploadFile(t, r, "bracket.stl", "solid bracket")
+    var up struct {
+        JobID       string `json:"job_id"`
+        AccessToken string `json:"access_token"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &up)
+    if w.Code != http.StatusAccepted || up.AccessToken == "" {
+        t.Fatalf("upload = %d %s, want 202 with an access_token", w.Code, w.Body)
+    }
+    stored := filepath.Join(dir, up.JobID+".stl")
+    if _, err := os.Stat(stored); err != nil {
+        t.Fatal(err)
+    }
+
+    if w := do(r, http.MethodDelete, "/jobs/"+up.JobID, "", jobTokenHeader, up.AccessToken); w.Code != http.StatusOK {
+        t.Fatalf("cancel = %d %s, want 200", w.Code, w.Body)
+    }
+    if _, err := os.Stat(stored); !os.IsNotExist(err) {
+        t.Fatalf("stored upload still there after the cancel: %v", err)
+    }
+}
+
+func TestStoredUploadExpiresWithItsJob(t *testing.T) {
+    dir := localStorage(t)
+    r := newRouter()
+
+    w := uploadFile(t, r, "bracket.stl", "solid bracket")
+    var up struct {
+        JobID string `json:"job_id"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &up)
+    stored := filepath.Join(dir, up.JobID+".stl")
+
+    publishStatus(ctx, up.JobID, "completed", "")
+    due, err := rdb.ZScore(ctx, storedUploadsKey, up.JobID+".stl").Result()
+    if err != nil {
+        t.Fatalf("finished upload not scheduled for deletion: %v", err)
+    }
+    if want := time.Now().Add(cfg().ResultTTL(StatusCompleted)).Unix(); int64(due) < want-5 || int64(due) > want+5 {
+        t.Errorf("deletion due at %v, want about %d", due, want)
+    }
+    pruneStoredUploads()
+    if _, err := os.Stat(stored); err != nil {
+        t.Fatalf("upload deleted before its job's retention ran out: %v", err)
+    }
+
+    rdb.ZAdd(ctx, storedUploadsKey, &redis.Z{Score: float64(time.Now().Add(-time.Second).Unix()), Member: up.JobID + ".stl"})
+    pruneStoredUploads()
+    if _, err := os.Stat(stored); !os.IsNotExist(err) {
+        t.Fatalf("upload still there after its job's retention: %v", err)
+    }
+    if n := rdb.ZCard(ctx, storedUploadsKey).Val(); n != 0 {
+        t.Errorf("%d uploads still scheduled, want 0", n)
+    }
+}
+
+func TestUploadOverMaxBytes(t *testing.T) {
+    dir := localStorage(t, func(c *Config) { c.MaxUploadBytes = 8 })
+    w := uploadFile(t, newRouter(), "big.stl", "solid far too big")
+    if w.Code != http.StatusRequestEntityTooLarge {
+        t.Fatalf("upload = %d %s, want 413", w.Code, w.Body)
+    }
+    if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+        t.Fatalf("oversize upload was stored: %v", entries)
+    }
+}
+
+func TestFilesRouteOnlyWithLocalStorage(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    if w := do(newRouter(), http.MethodGet, "/files/x.stl", ""); w.Code != http.StatusNotFound {
+        t.Fatalf("GET /files = %d with tmpfiles storage, want 404", w.Code)
+    }
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "github.com/google/uuid"
+
+    "slicer-api/internal/api"
+)
+
+// Subscriptions are standing, system-wide webhooks managed by admins:
+// subscription:{id} is a hash and subscriptions the set of IDs. Every status
+// published for any job (see publishStatus) is matched against them and
+// queued in the outbox for each subscription that wants it.
+const subscriptionsKey = "subscriptions"
+
+func subscriptionKey(id string) string {
+    return "subscription:" + id
+}
+
+// subscriptionStatusKey is the last status fanned out for a job, so progress
+// reports, which publish "processing" again, aren't sent on.
+func subscriptionStatusKey(jobID string) string {
+    return "subscription_status:" + jobID
+}
+
+// Events a subscription can filter on, each "job." and the status.
+var subscriptionEvents = map[string]bool{
+    "job.queued":     true,
+    "job.processing": true,
+    "job.completed":  true,
+    "job.failed":     true,
+    "job.cancelled":  true,
+}
+
+type subscription struct {
+    ID        string   `json:"id"`
+    URL       string   `json:"url"`
+    Events    []string `json:"events"`
+    Secret    string   `json:"-"`
+    Active    bool     `json:"active"`
+    CreatedAt string   `json:"created_at"`
+}
+
+type subscriptionRequest struct {
+    URL    string   `json:"url" binding:"required"`
+    Events []string `json:"events" binding:"required"`
+    Secret string   `json:"secret"`
+    // Defaults to true; false keeps the subscription but sends nothing
+    Active *bool `json:"active"`
+}
+
+func (r subscriptionRequest) validate() error {
+    if err := checkWebhookURL(r.URL); err != nil {
+        return err
+    }
+    if len(r.Events) == 0 {
+        return fmt.Errorf("events must not be empty")
+    }
+    for _, e := range r.Events {
+        if !subscriptionEvents[e] {
+            return fmt.Errorf("unknown event %q", e)
+        }
+    }
+    return nil
+}
+
+func (s subscription) subscribed(event string) bool {
+    for _, e := range s.Events {
+        if e == event {
+            return true
+        }
+    }
+    return false
+}
+
+// asWebhook lets deliveries reuse the webhook sender and its signing.
+func (s subscription) asWebhook() webhook {
+    return webhook{ID: s.ID, URL: s.URL, Events: s.Events, Secret: s.Secret, ContentType: defaultWebhookContentType}
+}
+
+func saveSubscription(ctx context.Context, s subscription) error {
+    pipe := rdb.TxPipeline()
+    pipe.HSet(ctx, subscriptionKey(s.ID), map[string]interface{}{
+        "id":         s.ID,
+        "url":        s.URL,
+        "events":     strings.Join(s.Events, ","),
+        "secret":     s.Secret,
+        "active":     strconv.FormatBool(s.Active),
+        "created_at": s.CreatedAt,
+    })
+    pipe.SAdd(ctx, subscriptionsKey, s.ID)
+    _, err := pipe.Exec(ctx)
+    return err
+}
+
+func loadSubscription(ctx context.Context, id string) (*subscription, error) {
+    h, err := rdb.HGetAll(ctx, subscriptionKey(id)).Result()
+    if err != nil {
+        return nil, err
+    }
+    if len(h) == 0 {
+        return nil, redis.Nil
+    }
+    return &subscription{
+        ID:        h["id"],
+        URL:       h["url"],
+        Events:    strings.Split(h["events"], ","),
+        Secret:    h["secret"],
+        Active:    h["active"] == "true",
+        CreatedAt: h["created_at"],
+    }, nil
+}
+
+func allSubscriptions(ctx context.Context) ([]subscription, error) {
+    ids, err := rdb.SMembers(ctx, subscriptionsKey).Result()
+    if err != nil {
+        return nil, err
+    }
+    subs := []subscription{}
+    for _, id := range ids {
+        s, err := loadSubscription(ctx, id)
+        if err == redis.Nil {
+            rdb.SRem(ctx, subscriptionsKey, id)
+            continue
+        } else if err != nil {
+            return nil, err
+        }
+        subs = append(subs, *s)
+    }
+    return subs, nil
+}
+
+// fanOutStatus queues jobID's new status for every active subscription to
+// its event. It does nothing, beyond one SCARD, while there are none.
+func fanOutStatus(ctx context.Context, jobID, status string) {
+    event := "job." + status
+    if !subscriptionEvents[event] {
+        return
+    }
+    if n, err := rdb.SCard(ctx, subscriptionsKey).Result(); err != nil || n == 0 {
+        return
+    }
+    prev, err := rdb.GetSet(ctx, subscriptionStatusKey(jobID), status).Result()
+    if err != nil && err != redis.Nil {
+        return
+    }
+    rdb.Expire(ctx, subscriptionStatusKey(jobID), 24*time.Hour)
+    if prev == status {
+        return
+    }
+    subs, err := allSubscriptions(ctx)
+    if err != nil {
+        log.Printf("subscriptions: loading for %s %s: %v", event, jobID, err)
+        return
+    }
+    var body []byte
+    for _, s := range subs {
+        if !s.Active || !s.subscribed(event) {
+            continue
+        }
+        if body == nil {
+            snap, _ := statusSnapshot(ctx, jobID)
+            body, _ = json.Marshal(gin.H{
+                "event":     event,
+                "job_id":    jobID,
+                "data":      snap,
+                "timestamp": time.Now().UTC().Format(time.RFC3339),
+            })
+        }
+        id, err := enqueueDelivery(ctx, outboxDelivery{
+            Kind:           outboxSubscription,
+            SubscriptionID: s.ID,
+            JobID:          jobID,
+            Event:          event,
+            Payload:        string(body),
+        })
+        if err != nil {
+            log.Printf("subscriptions: queueing %s %s for %s: %v", s.ID, event, jobID, err)
+            continue
+        }
+        go attemptDelivery(id)
+    }
+}
+
+// subscriptionStats sums up the latest logged attempts of a subscription.
+func subscriptionStats(ctx context.Context, id string) gin.H {
+    msgs, _ := rdb.XRevRangeN(ctx, deliveriesKey(id), "+", "-", deliveriesListLimit).Result()
+    stats := gin.H{"attempts": len(msgs)}
+    var failed int
+    var total int64
+    for _, m := range msgs {
+        if e, _ := m.Values["error_message"].(string); e != "" {
+            failed++
+        }
+        ms, _ := strconv.ParseInt(fmt.Sprint(m.Values["duration_ms"]), 10, 64)
+        total += ms
+    }
+    stats["succeeded"], stats["failed"] = len(msgs)-failed, failed
+    if len(msgs) > 0 {
+        stats["avg_duration_ms"] = total / int64(len(msgs))
+        stats["last_attempt_at"] = msgs[0].Values["delivered_at"]
+        if code, _ := strconv.Atoi(fmt.Sprint(msgs[0].Values["response_status"])); code != 0 {
+            stats["last_response_status"] = code
+        }
+        if e, _ := msgs[0].Values["error_message"].(string); e != "" {
+            stats["last_error"] = e
+        }
+    }
+    return stats
+}
+
+func bindSubscription(c *gin.Context) (subscriptionRequest, bool) {
+    var req subscriptionRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return req, false
+    }
+    if err := req.validate(); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return req, false
+    }
+    return req, true
+}
+
+// POST /admin/webhooks/subscriptions {"url", "events", "secret"}
+func handleCreateSubscription(c *gin.Context) {
+    req, ok := bindSubscription(c)
+    if !ok {
+        return
+    }
+    s := subscription{
+        ID:        uuid.New().String(),
+        URL:       req.URL,
+        Events:    req.Events,
+        Secret:    req.Secret,
+        Active:    req.Active == nil || *req.Active,
+        CreatedAt: time.Now().UTC().Format(time.RFC3339),
+    }
+    if err := saveSubscription(c.Request.Context(), s); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusCreated, s)
+}
+
+// GET /admin/webhooks/subscriptions lists every subscription, without its
+// secret, with stats over its latest 50 attempts.
+func handleListSubscriptions(c *gin.Context) {
+    ctx := c.Request.Context()
+    subs, err := allSubscriptions(ctx)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    list := make([]gin.H, 0, len(subs))
+    for _, s := range subs {
+        list = append(list, gin.H{
+            "id":         s.ID,
+            "url":        s.URL,
+            "events":     s.Events,
+            "active":     s.Active,
+            "created_at": s.CreatedAt,
+            "deliveries": subscriptionStats(ctx, s.ID),
+        })
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(list), "subscriptions": list})
+}
+
+func loadedSubscription(c *gin.Context) *subscription {
+    s, err := loadSubscription(c.Request.Context(), c.Param("id"))
+    if err == redis.Nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Subscription not found"})
+        return nil
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return nil
+    }
+    return s
+}
+
+// PUT /admin/webhooks/subscriptions/:id replaces url, events, secret and
+// active.
+func handleUpdateSubscription(c *gin.Context) {
+    s := loadedSubscription(c)
+    if s == nil {
+        return
+    }
+    req, ok := bindSubscription(c)
+    if !ok {
+        return
+    }
+    s.URL, s.Events, s.Secret = req.URL, req.Events, req.Secret
+    s.Active = req.Active == nil || *req.Active
+    if err := saveSubscription(c.Request.Context(), *s); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, s)
+}
+
+// DELETE /admin/webhooks/subscriptions/:id; deliveries still queued for it
+// fail as having nowhere to go.
+func handleDeleteSubscription(c *gin.Context) {
+    s := loadedSubscription(c)
+    if s == nil {
+        return
+    }
+    ctx := c.Request.Context()
+    pipe := rdb.TxPipeline()
+    pipe.Del(ctx, subscriptionKey(s.ID), deliveriesKey(s.ID))
+    pipe.SRem(ctx, subscriptionsKey, s.ID)
+    if _, err := pipe.Exec(ctx); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
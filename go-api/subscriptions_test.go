@@ -0,0 +1,147 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+const adminAuth = "Bearer secret"
+
+func TestSubscriptionCRUD(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.AdminToken = "secret"
+        c.WebhookAllowPrivate = true
+    })
+    r := newRouter()
+    path := "/admin/webhooks/subscriptions"
+
+    for _, body := range []string{
+        `{"url":"ftp://127.0.0.1/x","events":["job.completed"]}`,
+        `{"url":"http://127.0.0.1/x","events":["job.exploded"]}`,
+        `{"url":"http://127.0.0.1/x","events":[]}`,
+    } {
+        if w := do(r, http.MethodPost, path, body, "Authorization", adminAuth); w.Code != http.StatusBadRequest {
+            t.Errorf("create %s: status = %d, want 400", body, w.Code)
+        }
+    }
+    w := do(r, http.MethodPost, path, `{"url":"http://127.0.0.1/x","events":["job.completed"],"secret":"sub-secret"}`, "Authorization", adminAuth)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("create: status = %d, body %s", w.Code, w.Body)
+    }
+    var created subscription
+    json.Unmarshal(w.Body.Bytes(), &created)
+    if !created.Active || strings.Contains(w.Body.String(), "sub-secret") {
+        t.Errorf("created = %s, want active and no secret", w.Body)
+    }
+
+    w = do(r, http.MethodPut, path+"/"+created.ID, `{"url":"http://127.0.0.1/y","events":["job.failed"],"active":false}`, "Authorization", adminAuth)
+    if w.Code != http.StatusOK {
+        t.Fatalf("update: status = %d, body %s", w.Code, w.Body)
+    }
+    s, _ := loadSubscription(ctx, created.ID)
+    if s.Active || s.URL != "http://127.0.0.1/y" || !s.subscribed("job.failed") || s.subscribed("job.completed") {
+        t.Errorf("after update: %+v", s)
+    }
+
+    w = do(r, http.MethodGet, path, "", "Authorization", adminAuth)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"count":1`) {
+        t.Fatalf("list: status = %d, body %s", w.Code, w.Body)
+    }
+
+    if w := do(r, http.MethodDelete, path+"/"+created.ID, "", "Authorization", adminAuth); w.Code != http.StatusNoContent {
+        t.Fatalf("delete: status = %d", w.Code)
+    }
+    if w := do(r, http.MethodDelete, path+"/"+created.ID, "", "Authorization", adminAuth); w.Code != http.StatusNotFound {
+        t.Errorf("second delete: status = %d, want 404", w.Code)
+    }
+}
+
+// subscriptionServer records the event and signature of each request.
+func subscriptionServer(t *testing.T) (*httptest.Server, func() []string) {
+    t.Helper()
+    var mu sync.Mutex
+    var got []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        var msg struct {
+            Event string `json:"event"`
+            JobID string `json:"job_id"`
+        }
+        json.Unmarshal(body, &msg)
+        if r.Header.Get("X-Signature") == "" || msg.JobID == "" {
+            w.WriteHeader(http.StatusBadRequest)
+            return
+        }
+        mu.Lock()
+        got = append(got, msg.Event)
+        mu.Unlock()
+    }))
+    t.Cleanup(srv.Close)
+    return srv, func() []string {
+        mu.Lock()
+        defer mu.Unlock()
+        return append([]string(nil), got...)
+    }
+}
+
+func TestSubscriptionsReceiveMatchingEvents(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.AdminToken = "secret"
+        c.InternalSecret = "s"
+        c.WebhookAllowPrivate = true
+        c.WebhookSecret = "global"
+    })
+    srv, got := subscriptionServer(t)
+    r := newRouter()
+    w := do(r, http.MethodPost, "/admin/webhooks/subscriptions", `{"url":"`+srv.URL+`","events":["job.queued","job.completed"]}`, "Authorization", adminAuth)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("create: status = %d, body %s", w.Code, w.Body)
+    }
+    var sub subscription
+    json.Unmarshal(w.Body.Bytes(), &sub)
+    // Inactive subscriptions get nothing
+    inactive := subscription{ID: "off", URL: srv.URL, Events: []string{"job.completed"}}
+    saveSubscription(ctx, inactive)
+
+    _, jobID, _ := quoteJobID(t, r, `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`)
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    reportStatus(t, r, jobID, `{"status":"processing","progress":50}`)
+    reportStatus(t, r, jobID, `{"status":"completed","result":{"summary":{"total_cost":9.9}}}`)
+
+    deadline := time.Now().Add(2 * time.Second)
+    for len(got()) < 2 && time.Now().Before(deadline) {
+        time.Sleep(5 * time.Millisecond)
+    }
+    time.Sleep(20 * time.Millisecond)
+    if events := got(); len(events) != 2 || events[0] != "job.queued" || events[1] != "job.completed" {
+        t.Fatalf("events = %v, want [job.queued job.completed]", events)
+    }
+
+    w = do(r, http.MethodGet, "/admin/webhooks/subscriptions", "", "Authorization", adminAuth)
+    var list struct {
+        Subscriptions []struct {
+            ID         string `json:"id"`
+            Deliveries struct {
+                Attempts           int `json:"attempts"`
+                Succeeded          int `json:"succeeded"`
+                LastResponseStatus int `json:"last_response_status"`
+            } `json:"deliveries"`
+        } `json:"subscriptions"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &list)
+    for _, s := range list.Subscriptions {
+        want := 0
+        if s.ID == sub.ID {
+            want = 2
+        }
+        if s.Deliveries.Attempts != want || s.Deliveries.Succeeded != want {
+            t.Errorf("subscription %s deliveries = %+v, want %d succeeded", s.ID, s.Deliveries, want)
+        }
+    }
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "encoding/json"
+    "log"
+    "strconv"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// When a worker claims a job it writes started_at:{id} and adds the job to
+// this set scored by started_at + the payload's deadline_seconds. Finished
+// jobs are removed; anything left past its score is overdue.
+const deadlinesKey = "print_jobs:deadlines"
+
+// jobDeadline is how long a job may stay in processing. Big uploads get an
+// extra allowance per MB on top of the base deadline.
+func jobDeadline(sizeBytes int64) time.Duration {
+    mb := sizeBytes / (1 << 20)
+    return cfg().ProcessingDeadline() + time.Duration(mb)*cfg().ProcessingDeadlinePerMB()
+}
+
+// failOverdueJobs marks jobs that blew through their deadline as failed with
+// reason "timeout" so pollers stop waiting. ZREM is the claim, so only one
+// API replica acts on each job.
+func failOverdueJobs() {
+    overdue, err := rdb.ZRangeByScore(ctx, deadlinesKey, &redis.ZRangeBy{
+        Min: "-inf",
+        Max: strconv.FormatInt(time.Now().Unix(), 10),
+    }).Result()
+    if err != nil {
+        return
+    }
+
+    for _, jobID := range overdue {
+        if removed, _ := rdb.ZRem(ctx, deadlinesKey, jobID).Result(); removed == 0 {
+            continue
+        }
+        // It may have been requeued or finished since; only fail live ones
+        status, _ := rdb.Get(ctx, "status:"+jobID).Result()
+        if status == "cancelling" {
+            settleCancel(jobID, "the worker never confirmed")
+            continue
+        }
+        if parseJobStatus(status) != StatusProcessing {
+            continue
+        }
+        // Checked again as it's written, in case the result just came in
+        if _, err := setStatus(ctx, jobID, StatusFailed, 24*time.Hour); err != nil {
+            continue
+        }
+
+        result, _ := json.Marshal(map[string]interface{}{
+            "success": false,
+            "error":   "Processing exceeded its deadline",
+            "reason":  "timeout",
+        })
+        rdb.Set(ctx, "result:"+jobID, result, 24*time.Hour)
+        // Drop the claim too, so a dead worker's entry isn't retried later
+        if payload, err := rdb.Get(ctx, "params:"+jobID).Result(); err == nil {
+            rdb.LRem(ctx, processingQueue, 1, payload)
+        }
+        rdb.HDel(ctx, claimedAtKey, jobID)
+        observeTransition(ctx, jobID, string(StatusProcessing), string(StatusFailed), result)
+        publishStatus(ctx, jobID, string(StatusFailed), "processing exceeded its deadline")
+        log.Printf("sweeper: %s failed, stuck in processing past its deadline", jobID)
+    }
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+func TestSweeperFailsOverdueJobBeforeTheReaper(t *testing.T) {
+    setupTest(t)
+    entry, _ := json.Marshal(map[string]interface{}{"id": "j1", "deadline_seconds": 3600})
+    rdb.Set(ctx, "params:j1", entry, time.Hour)
+    rdb.Set(ctx, "status:j1", "processing", time.Hour)
+    rdb.RPush(ctx, processingQueue, entry)
+    claimed := time.Now().Add(-3700 * time.Second).Unix()
+    rdb.HSet(ctx, claimedAtKey, "j1", claimed)
+    rdb.ZAdd(ctx, deadlinesKey, &redis.Z{Score: float64(claimed + 3600), Member: "j1"})
+
+    // The reaper runs first in the loop and must not claim it yet
+    if err := reapProcessing(); err != nil {
+        t.Fatal(err)
+    }
+    failOverdueJobs()
+
+    if status, _ := rdb.Get(ctx, "status:j1").Result(); status != "failed" {
+        t.Fatalf("status = %q, want failed", status)
+    }
+    if n, _ := rdb.LLen(ctx, processingQueue).Result(); n != 0 {
+        t.Fatalf("processing list still holds %d entries", n)
+    }
+    if n, _ := rdb.ZCard(ctx, delayedQueue).Result(); n != 0 {
+        t.Fatal("overdue job was scheduled for a retry")
+    }
+}
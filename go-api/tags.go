@@ -0,0 +1,189 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "regexp"
+    "sort"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Tags of a job live in tags:{id}, expiring with the job; tagged:{tag} is the
+// reverse index, pruned of expired jobs as it is read.
+const maxJobTags = 10
+
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+func validateTags(tags []string) error {
+    for _, t := range tags {
+        if !tagPattern.MatchString(t) {
+            return fmt.Errorf("invalid tag %q: use up to 64 letters, digits and hyphens", t)
+        }
+    }
+    return nil
+}
+
+// jobTTL is how long the job's keys have left, 24h if Redis can't say.
+func jobTTL(ctx context.Context, jobID string) time.Duration {
+    ttl, err := rdb.TTL(ctx, "status:"+jobID).Result()
+    if err != nil || ttl <= 0 {
+        return 24 * time.Hour
+    }
+    return ttl
+}
+
+// ownJob answers 404 for jobs that don't exist and otherwise leaves the
+// rest to authorizeJob.
+func ownJob(c *gin.Context, jobID string) bool {
+    if n, _ := rdb.Exists(c.Request.Context(), "status:"+jobID).Result(); n == 0 {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return false
+    }
+    return authorizeJob(c, jobID)
+}
+
+// POST /jobs/:id/tags {"tags": [...]} adds tags to a job.
+func handleAddTags(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+    var req struct {
+        Tags []string `json:"tags" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if err := validateTags(req.Tags); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if !ownJob(c, jobID) {
+        return
+    }
+
+    existing, err := rdb.SMembers(ctx, "tags:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    merged := map[string]bool{}
+    for _, t := range append(existing, req.Tags...) {
+        merged[t] = true
+    }
+    if len(merged) > maxJobTags {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: fmt.Sprintf("A job can have at most %d tags", maxJobTags)})
+        return
+    }
+
+    ttl := jobTTL(ctx, jobID)
+    pipe := rdb.TxPipeline()
+    for _, t := range req.Tags {
+        pipe.SAdd(ctx, "tags:"+jobID, t)
+        pipe.SAdd(ctx, "tagged:"+t, jobID)
+    }
+    pipe.Expire(ctx, "tags:"+jobID, ttl)
+    if _, err := pipe.Exec(ctx); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    // Keep each index at least as long as its newest job
+    for _, t := range req.Tags {
+        if left, _ := rdb.TTL(ctx, "tagged:"+t).Result(); left < ttl {
+            rdb.Expire(ctx, "tagged:"+t, ttl)
+        }
+    }
+
+    tags := make([]string, 0, len(merged))
+    for t := range merged {
+        tags = append(tags, t)
+    }
+    sort.Strings(tags)
+    c.JSON(http.StatusOK, gin.H{"job_id": jobID, "tags": tags})
+}
+
+// GET /jobs/:id/tags
+func handleListTags(c *gin.Context) {
+    jobID := c.Param("id")
+    if !ownJob(c, jobID) {
+        return
+    }
+    tags, err := rdb.SMembers(c.Request.Context(), "tags:"+jobID).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"job_id": jobID, "tags": tags})
+}
+
+// DELETE /jobs/:id/tags/:tag
+func handleRemoveTag(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID, tag := c.Param("id"), c.Param("tag")
+    if !ownJob(c, jobID) {
+        return
+    }
+    removed, err := rdb.SRem(ctx, "tags:"+jobID, tag).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if removed == 0 {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Tag not found"})
+        return
+    }
+    rdb.SRem(ctx, "tagged:"+tag, jobID)
+    c.Status(http.StatusNoContent)
+}
+
+// GET /jobs/tagged/:tag lists the jobs with a tag the caller may see (theirs
+// and unowned ones, as for ownJob), each with its current status and params.
+func handleListTagged(c *gin.Context) {
+    ctx := c.Request.Context()
+    tag := c.Param("tag")
+    if err := validateTags([]string{tag}); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    ids, err := rdb.SMembers(ctx, "tagged:"+tag).Result()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+
+    pipe := rdb.Pipeline()
+    statuses := make([]*redis.StringCmd, len(ids))
+    params := make([]*redis.StringCmd, len(ids))
+    for i, id := range ids {
+        statuses[i] = pipe.Get(ctx, "status:"+id)
+        params[i] = pipe.Get(ctx, "params:"+id)
+    }
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+
+    owner := requestOwner(c)
+    jobs := []gin.H{}
+    for i, id := range ids {
+        status, err := statuses[i].Result()
+        if err == redis.Nil {
+            rdb.SRem(ctx, "tagged:"+tag, id)
+            continue
+        }
+        var job map[string]interface{}
+        if raw, err := params[i].Bytes(); err == nil {
+            job, _ = readPayload(raw)
+        }
+        if jobOwnerID, _ := job["owner_id"].(string); jobOwnerID != "" && jobOwnerID != owner {
+            continue
+        }
+        jobs = append(jobs, gin.H{"job_id": id, "status": status, "params": job})
+    }
+    c.JSON(http.StatusOK, gin.H{"tag": tag, "count": len(jobs), "jobs": jobs})
+}
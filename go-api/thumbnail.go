@@ -0,0 +1,92 @@
+package main
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Workers send a render of the model with its result, taken from the PNG
+// the slicer embeds in the G-code. It is kept in result:{id}:thumb, as raw
+// PNG bytes, for as long as the job's other keys; a job is only sliced
+// once, so it never changes.
+func thumbnailKey(jobID string) string {
+    return "result:" + jobID + ":thumb"
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type thumbnailUpload struct {
+    PNGBase64 string `json:"png_base64" binding:"required"`
+}
+
+// POST /internal/jobs/:id/thumbnail stores a job's thumbnail. Ones over
+// THUMBNAIL_MAX_BYTES get 413, since a cut-off PNG is no image at all.
+func handleInternalThumbnail(c *gin.Context) {
+    ctx := c.Request.Context()
+    jobID := c.Param("id")
+
+    if n, err := rdb.Exists(ctx, "status:"+jobID).Result(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    } else if n == 0 {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    }
+    var upload thumbnailUpload
+    if err := c.ShouldBindJSON(&upload); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    png, err := base64.StdEncoding.DecodeString(upload.PNGBase64)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "png_base64 is not base64"})
+        return
+    }
+    if max := cfg().ThumbnailMaxBytes; int64(len(png)) > max {
+        c.JSON(http.StatusRequestEntityTooLarge, api.ErrorResponse{Error: fmt.Sprintf("Thumbnail exceeds %d bytes", max)})
+        return
+    }
+    if !bytes.HasPrefix(png, pngSignature) {
+        c.JSON(http.StatusUnsupportedMediaType, api.ErrorResponse{Error: "Thumbnails must be PNG"})
+        return
+    }
+
+    if err := rdb.Set(ctx, thumbnailKey(jobID), png, jobTTL(ctx, jobID)).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"job_id": jobID, "bytes": len(png)})
+}
+
+// GET /jobs/:id/thumbnail serves the job's thumbnail, to anyone with the
+// job ID like /status. It is cached for a year; /status says whether there
+// is one.
+func handleJobThumbnail(c *gin.Context) {
+    png, err := rdb.Get(c.Request.Context(), thumbnailKey(c.Param("id"))).Bytes()
+    if err == redis.Nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "No thumbnail for this job"})
+        return
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+
+    sum := sha256.Sum256(png)
+    etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+    c.Header("ETag", etag)
+    c.Header("Cache-Control", "public, max-age=31536000, immutable")
+    if etagMatches(c.GetHeader("If-None-Match"), etag) {
+        c.Status(http.StatusNotModified)
+        return
+    }
+    c.Data(http.StatusOK, "image/png", png)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "bytes"
+    "encoding/base64"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestThumbnailRoundTrip(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "completed", time.Hour)
+    if strings.Contains(do(r, http.MethodGet, "/status/j1", "").Body.String(), "has_thumbnail") {
+        t.Fatal("status shows a thumbnail before there is one")
+    }
+    if w := do(r, http.MethodGet, "/jobs/j1/thumbnail", ""); w.Code != http.StatusNotFound {
+        t.Fatalf("missing thumbnail: status = %d, want 404", w.Code)
+    }
+
+    png := append(append([]byte{}, pngSignature...), "IHDR and the rest"...)
+    body := `{"png_base64":"` + base64.StdEncoding.EncodeToString(png) + `"}`
+    if w := do(r, http.MethodPost, "/internal/jobs/j1/thumbnail", body, "X-Internal-Signature", signBody("s", []byte(body))); w.Code != http.StatusOK {
+        t.Fatalf("storing: status = %d %s", w.Code, w.Body)
+    }
+    if ttl := rdb.TTL(ctx, thumbnailKey("j1")).Val(); ttl <= 0 || ttl > time.Hour {
+        t.Errorf("thumbnail TTL = %v, want the job's", ttl)
+    }
+    if !strings.Contains(do(r, http.MethodGet, "/status/j1", "").Body.String(), `"has_thumbnail":true`) {
+        t.Error("status doesn't show the thumbnail")
+    }
+
+    w := do(r, http.MethodGet, "/jobs/j1/thumbnail", "")
+    if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), png) || w.Header().Get("Content-Type") != "image/png" {
+        t.Fatalf("thumbnail = %d %q %s", w.Code, w.Body, w.Header().Get("Content-Type"))
+    }
+    if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age=31536000") {
+        t.Errorf("Cache-Control = %q, want it cached for long", cc)
+    }
+    if w := do(r, http.MethodGet, "/jobs/j1/thumbnail", "", "If-None-Match", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+        t.Errorf("revalidation: status = %d, want 304", w.Code)
+    }
+}
+
+func TestThumbnailRejects(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret, c.ThumbnailMaxBytes = "s", 64 })
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "completed", time.Hour)
+
+    for name, tt := range map[string]struct {
+        job, body string
+        want      int
+    }{
+        "unknown job": {"nope", `{"png_base64":"` + base64.StdEncoding.EncodeToString(pngSignature) + `"}`, http.StatusNotFound},
+        "not base64":  {"j1", `{"png_base64":"%%%"}`, http.StatusBadRequest},
+        "not png":     {"j1", `{"png_base64":"` + base64.StdEncoding.EncodeToString([]byte("GIF89a")) + `"}`, http.StatusUnsupportedMediaType},
+        "oversized":   {"j1", `{"png_base64":"` + base64.StdEncoding.EncodeToString(append(append([]byte{}, pngSignature...), make([]byte, 64)...)) + `"}`, http.StatusRequestEntityTooLarge},
+    } {
+        w := do(r, http.MethodPost, "/internal/jobs/"+tt.job+"/thumbnail", tt.body, "X-Internal-Signature", signBody("s", []byte(tt.body)))
+        if w.Code != tt.want {
+            t.Errorf("%s: status = %d, want %d", name, w.Code, tt.want)
+        }
+    }
+    if n := rdb.Exists(ctx, thumbnailKey("j1")).Val(); n != 0 {
+        t.Error("a rejected thumbnail was stored")
+    }
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// bufferedWriter holds the handler's response, headers included, so a
+// timeout can replace it. Once closed, later writes are dropped.
+type bufferedWriter struct {
+    gin.ResponseWriter
+    mu      sync.Mutex
+    header  http.Header
+    body    bytes.Buffer
+    status  int
+    written bool
+    closed  bool
+}
+
+func newBufferedWriter(w gin.ResponseWriter) *bufferedWriter {
+    return &bufferedWriter{ResponseWriter: w, header: http.Header{}, status: http.StatusOK}
+}
+
+func (w *bufferedWriter) Header() http.Header {
+    return w.header
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if !w.written && !w.closed {
+        w.status = code
+    }
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if w.closed {
+        return 0, http.ErrHandlerTimeout
+    }
+    w.written = true
+    return w.body.Write(p)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+    return w.Write([]byte(s))
+}
+
+func (w *bufferedWriter) Status() int {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if !w.written {
+        return -1
+    }
+    return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    return w.written
+}
+
+func (w *bufferedWriter) Flush() {}
+
+// close stops the handler from writing any more.
+func (w *bufferedWriter) close() {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    w.closed = true
+}
+
+// timeoutMiddleware bounds a request to d. The request context carries the
+// deadline, so handlers that pass c.Request.Context() to Redis and outbound
+// HTTP calls get cancelled with it, and the connection read deadline stops a
+// slow client from trickling the body in forever. The handler runs on its
+// own goroutine against a buffer: if it finishes in time the buffer is sent,
+// otherwise the client gets a 504 as soon as the deadline passes and the
+// handler's later writes are dropped. The middleware still waits for it to
+// return before handing c back, since gin reuses contexts.
+func timeoutMiddleware(d time.Duration) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        deadline := time.Now().Add(d)
+        tctx, cancel := context.WithDeadline(c.Request.Context(), deadline)
+        defer cancel()
+        c.Request = c.Request.WithContext(tctx)
+        http.NewResponseController(c.Writer).SetReadDeadline(deadline)
+
+        rw := c.Writer
+        w := newBufferedWriter(rw)
+        c.Writer = w
+        done := make(chan struct{})
+        var panicked interface{}
+        go func() {
+            defer close(done)
+            defer func() { panicked = recover() }()
+            c.Next()
+        }()
+
+        select {
+        case <-done:
+        case <-tctx.Done():
+        }
+
+        // The body read can fail on the connection deadline a moment before
+        // the context timer fires, so compare against the clock too
+        if errors.Is(tctx.Err(), context.DeadlineExceeded) || !time.Now().Before(deadline) {
+            w.close()
+            // Until the handler returns c is still its to use, so write
+            // straight to the connection
+            body, _ := json.Marshal(gin.H{"error": "Request timed out"})
+            rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+            rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+            rw.WriteHeader(http.StatusGatewayTimeout)
+            rw.Write(body)
+            rw.Flush()
+            <-done
+            c.Writer = rw
+            if panicked != nil {
+                panic(panicked)
+            }
+            return
+        }
+
+        // Cancelled by the client going away; let the handler wind down
+        <-done
+        c.Writer = rw
+        if panicked != nil {
+            panic(panicked)
+        }
+        for k, v := range w.header {
+            rw.Header()[k] = v
+        }
+        rw.WriteHeader(w.status)
+        rw.Write(w.body.Bytes())
+    }
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func timeoutTestServer(t *testing.T, d time.Duration, h gin.HandlerFunc) *httptest.Server {
+    t.Helper()
+    setupTest(t)
+    r := gin.New()
+    r.GET("/", timeoutMiddleware(d), h)
+    srv := httptest.NewServer(r)
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func TestTimeoutAnswersWithoutWaitingForHandler(t *testing.T) {
+    release := make(chan struct{})
+    defer close(release)
+    srv := timeoutTestServer(t, 50*time.Millisecond, func(c *gin.Context) {
+        // Ignores the context, like a handler stuck in a blocking call
+        select {
+        case <-release:
+        case <-time.After(2 * time.Second):
+        }
+        c.Header("X-Late", "1")
+        c.String(http.StatusOK, "too late")
+    })
+
+    start := time.Now()
+    resp, err := http.Get(srv.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, _ := io.ReadAll(resp.Body)
+    resp.Body.Close()
+    if elapsed := time.Since(start); elapsed > time.Second {
+        t.Errorf("response took %v, want it at the deadline", elapsed)
+    }
+    if resp.StatusCode != http.StatusGatewayTimeout || !strings.Contains(string(body), "timed out") {
+        t.Errorf("got %d %s, want the 504", resp.StatusCode, body)
+    }
+    if resp.Header.Get("X-Late") != "" {
+        t.Error("late handler header leaked into the 504")
+    }
+}
+
+func TestTimeoutPassesThroughInTime(t *testing.T) {
+    srv := timeoutTestServer(t, time.Second, func(c *gin.Context) {
+        c.Header("X-Handler", "1")
+        c.String(http.StatusCreated, "ok")
+    })
+
+    resp, err := http.Get(srv.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, _ := io.ReadAll(resp.Body)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusCreated || string(body) != "ok" || resp.Header.Get("X-Handler") != "1" {
+        t.Errorf("got %d %q (X-Handler %q), want the handler's 201", resp.StatusCode, body, resp.Header.Get("X-Handler"))
+    }
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "context"
+    "strconv"
+    "time"
+)
+
+// Every job records when it was created, when a worker started it and when
+// it finished, each kept with the job for 24 hours:
+//
+//	created_at:{id}    RFC3339, from the payload, on submission
+//	started_at:{id}    Unix seconds; workers write it when they claim the
+//	                   job, and the API on the first processing status
+//	completed_at:{id}  RFC3339, on every final status
+//
+// /status shows all three as RFC3339 in UTC.
+
+// recordCreated keeps the payload's created_at for /status, which can't
+// rely on params:{id}: it goes once a job is cancelled. It also lists the
+// job under its owner for GET /jobs.
+func recordCreated(ctx context.Context, jobID string, job map[string]interface{}) {
+    if at, ok := job["created_at"].(string); ok {
+        rdb.Set(ctx, "created_at:"+jobID, at, 24*time.Hour)
+    }
+    owner, _ := job["owner_id"].(string)
+    indexJob(ctx, jobID, owner, time.Now())
+}
+
+// stampStatus records the time of a transition publishStatus announces. A
+// job that runs again after finishing, from a DLQ replay say, gets the time
+// it finished last.
+func stampStatus(ctx context.Context, jobID, status string) {
+    switch {
+    case status == "processing":
+        rdb.SetNX(ctx, "started_at:"+jobID, time.Now().Unix(), 24*time.Hour)
+    case parseJobStatus(status).IsTerminal():
+        rdb.Set(ctx, "completed_at:"+jobID, time.Now().UTC().Format(time.RFC3339), 24*time.Hour)
+    }
+}
+
+// startedAtTime formats a started_at:{id} value for /status.
+func startedAtTime(raw string) string {
+    sec, err := strconv.ParseInt(raw, 10, 64)
+    if err != nil {
+        return ""
+    }
+    return time.Unix(sec, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func statusTimes(t *testing.T, h http.Handler, jobID string) map[string]string {
+    t.Helper()
+    w := do(h, http.MethodGet, "/status/"+jobID, "")
+    var resp map[string]interface{}
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    times := map[string]string{}
+    for _, key := range []string{"created_at", "started_at", "completed_at"} {
+        if s, ok := resp[key].(string); ok {
+            if _, err := time.Parse(time.RFC3339, s); err != nil {
+                t.Errorf("%s = %q, not RFC3339", key, s)
+            }
+            times[key] = s
+        }
+    }
+    return times
+}
+
+func TestJobTimestamps(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    r := newRouter()
+    _, jobID, _ := quoteJobID(t, r, `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`)
+
+    payload, _ := rdb.Get(ctx, "params:"+jobID).Bytes()
+    job, _ := readPayload(payload)
+    times := statusTimes(t, r, jobID)
+    if times["created_at"] == "" || times["created_at"] != job["created_at"] {
+        t.Fatalf("queued: times %v, payload created_at %v; want the same created_at", times, job["created_at"])
+    }
+    if len(times) != 1 {
+        t.Errorf("queued: times %v, want only created_at", times)
+    }
+
+    reportStatus(t, r, jobID, `{"status":"processing"}`)
+    started := statusTimes(t, r, jobID)["started_at"]
+    if started == "" {
+        t.Fatal("processing: no started_at")
+    }
+    // A worker's claim writes its own start, which later reports keep
+    claimed := time.Now().Add(-time.Minute).Truncate(time.Second)
+    rdb.Set(ctx, "started_at:"+jobID, claimed.Unix(), 0)
+    reportStatus(t, r, jobID, `{"status":"processing","step":"slicing"}`)
+    if got := statusTimes(t, r, jobID)["started_at"]; got != claimed.UTC().Format(time.RFC3339) {
+        t.Errorf("after a step, started_at = %q, want the worker's %s", got, claimed.UTC().Format(time.RFC3339))
+    }
+
+    reportStatus(t, r, jobID, `{"status":"failed","result":{"error":"boom"}}`)
+    times = statusTimes(t, r, jobID)
+    if times["completed_at"] == "" || times["completed_at"] < times["created_at"] {
+        t.Errorf("failed: times %v, want a completed_at after created_at", times)
+    }
+}
+
+func TestCancelledJobHasCompletedAt(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    w := do(r, http.MethodPost, "/quote", `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`)
+    var sub struct {
+        JobID       string `json:"job_id"`
+        AccessToken string `json:"access_token"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &sub)
+    jobID := sub.JobID
+    if w := do(r, http.MethodDelete, "/jobs/"+jobID, "", jobTokenHeader, sub.AccessToken); w.Code != http.StatusOK {
+        t.Fatalf("cancel: status = %d, body %s", w.Code, w.Body)
+    }
+    // params:{id} is gone, created_at stays
+    times := statusTimes(t, r, jobID)
+    if times["created_at"] == "" || times["completed_at"] == "" {
+        t.Errorf("cancelled: times %v, want created_at and completed_at", times)
+    }
+}
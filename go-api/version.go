@@ -0,0 +1,118 @@
+package main
+
+import (
+    "net/http"
+    "regexp"
+    "sort"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    "slicer-api/internal/api"
+)
+
+// The API is served under /v1/, and at the bare paths it started with for
+// existing clients. Breaking changes go to /v2/, which is only a stub so
+// far. Handlers read the version a request was made against with
+// apiVersion(c).
+const (
+    apiV1 = "v1"
+    apiV2 = "v2"
+    // apiVersionKey holds the request's version in the gin.Context
+    apiVersionKey = "api_version"
+    // apiNegotiatedKey marks requests that chose their version through
+    // Accept
+    apiNegotiatedKey = "api_version_negotiated"
+)
+
+// apiVendorType is the Accept media type that picks a version without the
+// URL prefix, e.g. application/vnd.prusaslicer.v1+json.
+var apiVendorType = regexp.MustCompile(`application/vnd\.prusaslicer\.(v\d+)\+json`)
+
+// apiVersions are the versions served at the bare paths through Accept.
+var apiVersions = map[string]bool{apiV1: true}
+
+// withAPIVersion records that the request came in under version's prefix.
+func withAPIVersion(version string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Set(apiVersionKey, version)
+        c.Next()
+    }
+}
+
+// negotiateAPIVersion serves the bare paths as v1, or as the version the
+// Accept header asks for. Versions that don't exist get 406.
+func negotiateAPIVersion(c *gin.Context) {
+    version := apiV1
+    if m := apiVendorType.FindStringSubmatch(c.GetHeader("Accept")); m != nil {
+        if !apiVersions[m[1]] {
+            c.AbortWithStatusJSON(http.StatusNotAcceptable, api.ErrorResponse{Error: "API version " + m[1] + " is not available at this path; see GET /v2/"})
+            return
+        }
+        version = m[1]
+        c.Set(apiNegotiatedKey, true)
+    }
+    c.Set(apiVersionKey, version)
+    c.Next()
+}
+
+// apiVersion is the version the request is served as.
+func apiVersion(c *gin.Context) string {
+    if v := c.GetString(apiVersionKey); v != "" {
+        return v
+    }
+    return apiV1
+}
+
+func versionedPath(version, path string) string {
+    return "/" + version + path
+}
+
+// statusPath is where to poll jobID, under the prefix the request used.
+func statusPath(c *gin.Context, jobID string) string {
+    path := "/status/" + jobID
+    if full := c.FullPath(); unversionedPath(full) != full {
+        return versionedPath(apiVersion(c), path)
+    }
+    return path
+}
+
+// unversionedPath strips the version prefix, so path checks and
+// fingerprints treat /v1/quote and /quote alike.
+func unversionedPath(path string) string {
+    for _, v := range []string{apiV1, apiV2} {
+        if rest, ok := strings.CutPrefix(path, "/"+v); ok && (rest == "" || rest[0] == '/') {
+            return rest
+        }
+    }
+    return path
+}
+
+type apiEndpoint struct {
+    Method string `json:"method"`
+    Path   string `json:"path"`
+}
+
+// handleV2Index lists what /v2/ serves, read from the router so it can't go
+// stale as endpoints are added.
+func handleV2Index(r *gin.Engine) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        endpoints := []apiEndpoint{}
+        for _, route := range r.Routes() {
+            if strings.HasPrefix(route.Path, "/v2/") {
+                endpoints = append(endpoints, apiEndpoint{Method: route.Method, Path: route.Path})
+            }
+        }
+        sort.Slice(endpoints, func(i, j int) bool {
+            if endpoints[i].Path != endpoints[j].Path {
+                return endpoints[i].Path < endpoints[j].Path
+            }
+            return endpoints[i].Method < endpoints[j].Method
+        })
+        c.JSON(http.StatusOK, gin.H{
+            "version":   apiV2,
+            "stable":    versionedPath(apiV1, "/"),
+            "endpoints": endpoints,
+        })
+    }
+}
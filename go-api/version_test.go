@@ -0,0 +1,168 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+const versionQuote = `{"download_url":"https://example.com/part.stl","material":"PLA","infill":20}`
+
+func TestUnversionedPath(t *testing.T) {
+    tests := []struct{ path, want string }{
+        {"/v1/quote", "/quote"},
+        {"/v1/internal/jobs/:id/status", "/internal/jobs/:id/status"},
+        {"/v2/", "/"},
+        {"/v1", ""},
+        {"/quote", "/quote"},
+        {"/v10/quote", "/v10/quote"},
+        {"/v1quote", "/v1quote"},
+    }
+    for _, tt := range tests {
+        if got := unversionedPath(tt.path); got != tt.want {
+            t.Errorf("unversionedPath(%q) = %q, want %q", tt.path, got, tt.want)
+        }
+    }
+}
+
+func TestV1ServesTheAPI(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+
+    w := do(r, http.MethodPost, "/v1/quote", versionQuote)
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("POST /v1/quote: status = %d, want 202: %s", w.Code, w.Body)
+    }
+    if got := w.Header().Get("Deprecation"); got != "" {
+        t.Errorf("POST /v1/quote: Deprecation = %q, want none", got)
+    }
+    var resp struct {
+        JobID   string `json:"job_id"`
+        Message string `json:"message"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if want := "Poll /v1/status/" + resp.JobID; !strings.Contains(resp.Message, want) {
+        t.Errorf("message = %q, want it to say %q", resp.Message, want)
+    }
+
+    w = do(r, http.MethodGet, "/v1/status/"+resp.JobID, "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("GET /v1/status: status = %d, want 200: %s", w.Code, w.Body)
+    }
+    if w := do(r, http.MethodGet, "/v1/queue", ""); w.Code != http.StatusOK {
+        t.Errorf("GET /v1/queue: status = %d, want 200", w.Code)
+    }
+}
+
+func TestBareAliasesAreDeprecated(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+    rdb.Set(ctx, "status:j1", "queued", 0)
+
+    tests := []struct {
+        method, path, body string
+        wantLink           string
+    }{
+        {http.MethodPost, "/quote", versionQuote, `</v1/quote>; rel="successor-version"`},
+        {http.MethodGet, "/status/j1", "", `</v1/status/j1>; rel="successor-version"`},
+        {http.MethodPost, "/upload", "", `</v1/upload>; rel="successor-version"`},
+        {http.MethodGet, "/queue", "", ""},
+    }
+    for _, tt := range tests {
+        w := do(r, tt.method, tt.path, tt.body)
+        wantDeprecation := ""
+        if tt.wantLink != "" {
+            wantDeprecation = "true"
+        }
+        if got := w.Header().Get("Deprecation"); got != wantDeprecation {
+            t.Errorf("%s %s: Deprecation = %q, want %q", tt.method, tt.path, got, wantDeprecation)
+        }
+        if got := w.Header().Get("Link"); got != tt.wantLink {
+            t.Errorf("%s %s: Link = %q, want %q", tt.method, tt.path, got, tt.wantLink)
+        }
+        if got := w.Header().Get("Sunset"); (got != "") != (tt.wantLink != "") {
+            t.Errorf("%s %s: Sunset = %q", tt.method, tt.path, got)
+        }
+    }
+}
+
+func TestAcceptNegotiatesVersion(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+
+    w := do(r, http.MethodPost, "/quote", versionQuote, "Accept", "application/vnd.prusaslicer.v1+json")
+    if w.Code != http.StatusAccepted {
+        t.Fatalf("v1 by Accept: status = %d, want 202: %s", w.Code, w.Body)
+    }
+    if got := w.Header().Get("Deprecation"); got != "" {
+        t.Errorf("v1 by Accept: Deprecation = %q, want none", got)
+    }
+
+    w = do(r, http.MethodPost, "/quote", versionQuote, "Accept", "application/vnd.prusaslicer.v3+json")
+    if w.Code != http.StatusNotAcceptable {
+        t.Errorf("v3 by Accept: status = %d, want 406", w.Code)
+    }
+}
+
+func TestAPIVersionInContext(t *testing.T) {
+    setupTest(t)
+    r := gin.New()
+    echo := func(c *gin.Context) { c.String(http.StatusOK, apiVersion(c)) }
+    r.GET("/ping", negotiateAPIVersion, echo)
+    r.Group("/v1", withAPIVersion(apiV1)).GET("/ping", echo)
+    r.Group("/v2", withAPIVersion(apiV2)).GET("/ping", echo)
+
+    for path, want := range map[string]string{"/ping": apiV1, "/v1/ping": apiV1, "/v2/ping": apiV2} {
+        if got := do(r, http.MethodGet, path, "").Body.String(); got != want {
+            t.Errorf("GET %s: apiVersion = %q, want %q", path, got, want)
+        }
+    }
+}
+
+func TestV2Index(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+
+    w := do(r, http.MethodGet, "/v2/", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("GET /v2/: status = %d, want 200", w.Code)
+    }
+    var resp struct {
+        Version   string        `json:"version"`
+        Stable    string        `json:"stable"`
+        Endpoints []apiEndpoint `json:"endpoints"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    }
+    if resp.Version != apiV2 || resp.Stable != "/v1/" {
+        t.Errorf("GET /v2/ = %+v, want version v2 pointing at /v1/", resp)
+    }
+    if len(resp.Endpoints) != 1 || resp.Endpoints[0] != (apiEndpoint{http.MethodGet, "/v2/"}) {
+        t.Errorf("endpoints = %+v, want only GET /v2/", resp.Endpoints)
+    }
+}
+
+func TestIdempotencyKeySpansVersions(t *testing.T) {
+    setupTest(t)
+    r := newRouter()
+
+    ids := map[string]bool{}
+    for _, path := range []string{"/quote", "/v1/quote"} {
+        w := do(r, http.MethodPost, path, versionQuote, idempotencyHeader, "k1")
+        if w.Code != http.StatusAccepted && w.Code != http.StatusOK {
+            t.Fatalf("POST %s: status = %d: %s", path, w.Code, w.Body)
+        }
+        var resp struct {
+            JobID string `json:"job_id"`
+        }
+        json.Unmarshal(w.Body.Bytes(), &resp)
+        ids[resp.JobID] = true
+    }
+    if len(ids) != 1 {
+        t.Errorf("job IDs = %v, want the /v1/ retry to replay the bare submission", ids)
+    }
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "net/http"
+    "net/url"
+    "syscall"
+    "time"
+)
+
+// webhookClient delivers every webhook. Its dialer refuses internal
+// addresses on each connection, so a hostname that resolves somewhere else
+// after registration is still caught, and redirects are not followed.
+var webhookClient = &http.Client{
+    Timeout: webhookTimeout,
+    Transport: &http.Transport{
+        DialContext: (&net.Dialer{
+            Timeout: 5 * time.Second,
+            Control: webhookDialControl,
+        }).DialContext,
+        TLSHandshakeTimeout: 5 * time.Second,
+        MaxIdleConns:        10,
+        IdleConnTimeout:     90 * time.Second,
+    },
+    CheckRedirect: func(*http.Request, []*http.Request) error {
+        return http.ErrUseLastResponse
+    },
+}
+
+// webhookAddrAllowed rejects loopback, private, link-local, multicast and
+// unspecified addresses, which would let a webhook reach this host or the
+// network behind it (e.g. the 169.254.169.254 metadata service).
+func webhookAddrAllowed(ip net.IP) bool {
+    if cfg().WebhookAllowPrivate {
+        return true
+    }
+    return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+        ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+        ip.IsMulticast() || ip.IsUnspecified())
+}
+
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return err
+    }
+    if ip := net.ParseIP(host); ip == nil || !webhookAddrAllowed(ip) {
+        return fmt.Errorf("webhook address %s is not allowed", host)
+    }
+    return nil
+}
+
+// checkWebhookURL accepts http(s) URLs with a host, then resolves the host
+// and fails if any of its addresses is internal, so such hooks are refused
+// before anything is sent.
+func checkWebhookURL(raw string) error {
+    u, err := url.Parse(raw)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return fmt.Errorf("url must be an http(s) URL")
+    }
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+    addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+    if err != nil {
+        return fmt.Errorf("url host does not resolve")
+    }
+    for _, a := range addrs {
+        if !webhookAddrAllowed(a.IP) {
+            return fmt.Errorf("url must not point to a loopback, private or link-local address")
+        }
+    }
+    return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+)
+
+// webhookSignatureTolerance is how old an X-Timestamp receivers are told to
+// accept.
+const webhookSignatureTolerance = 300
+
+// webhookSchema describes what webhooks and callbacks POST and how to check
+// they came from us.
+var webhookSchema = gin.H{
+    "webhook": gin.H{
+        "description": "POSTed to registered webhooks for each subscribed event, unless the webhook has a payload_template",
+        "body": gin.H{
+            "event":     "job.submitted, job.completed, job.failed, job.aborted or ping",
+            "job_id":    "string",
+            "data":      "the job payload on submission, otherwise the worker's result",
+            "timestamp": "RFC3339 time the event was sent",
+        },
+    },
+    "callback": gin.H{
+        "description": "POSTed once to a job's callback_url when it completes or fails",
+        "body": gin.H{
+            "job_id":    "string",
+            "status":    "completed or failed",
+            "result":    "the worker's result",
+            "timestamp": "RFC3339 time the callback was sent",
+        },
+    },
+    "headers": gin.H{
+        "X-Webhook-Event":     "the event, e.g. job.completed",
+        "X-Timestamp":         "Unix time in seconds the delivery was signed",
+        "X-Signature":         `"sha256=" followed by the hex HMAC-SHA256 of "{X-Timestamp}.{raw body}"`,
+        "X-Webhook-Signature": "webhooks with their own secret only: hex HMAC-SHA256 of the raw body",
+    },
+    "secret": "the webhook's secret or the job's callback_secret when given, otherwise the deployment's shared webhook secret",
+    "verification": []string{
+        "Read the raw request body before parsing it.",
+        "Compute the HMAC-SHA256 of the X-Timestamp value, a \".\" and the raw body, keyed with the secret, and hex-encode it.",
+        "Compare it with X-Signature, after its \"sha256=\" prefix, in constant time; reject the request if they differ.",
+        "Reject the request if X-Timestamp is more than tolerance_seconds from your clock, so a captured delivery can't be replayed later.",
+    },
+    "tolerance_seconds": webhookSignatureTolerance,
+}
+
+// GET /webhooks/schema documents delivery bodies, headers and signature
+// verification.
+func handleWebhookSchema(c *gin.Context) {
+    c.JSON(http.StatusOK, webhookSchema)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "mime"
+    "strings"
+    "text/template"
+    "time"
+)
+
+const defaultWebhookContentType = "application/json"
+
+// WebhookData is what a webhook's payload_template is executed with.
+// CompletedAt is zero until the job has finished.
+type WebhookData struct {
+    Event       string
+    JobID       string
+    Status      string
+    Result      map[string]interface{}
+    SubmittedAt time.Time
+    CompletedAt time.Time
+    OwnerID     string
+    Material    string
+}
+
+// Templates may pipe values through json, e.g. {{json .Result}}.
+var webhookTemplateFuncs = template.FuncMap{
+    "json": func(v interface{}) (string, error) {
+        b, err := json.Marshal(v)
+        return string(b), err
+    },
+}
+
+func parseWebhookTemplate(text string) (*template.Template, error) {
+    return template.New("payload_template").Funcs(webhookTemplateFuncs).Parse(text)
+}
+
+func validContentType(ct string) error {
+    if _, _, err := mime.ParseMediaType(ct); err != nil {
+        return fmt.Errorf("content_type: %v", err)
+    }
+    return nil
+}
+
+// webhookData fills WebhookData from the job's stored payload and the event's
+// data (the worker's result for job.completed, job.failed and job.aborted).
+func webhookData(ctx context.Context, event, jobID string, data interface{}) WebhookData {
+    d := WebhookData{Event: event, JobID: jobID}
+    switch event {
+    case "job.completed", "job.failed", "job.aborted":
+        d.Status = strings.TrimPrefix(event, "job.")
+        d.CompletedAt = time.Now().UTC()
+    case "job.submitted":
+        d.Status = "queued"
+    }
+    if event != "job.submitted" {
+        raw, _ := json.Marshal(data)
+        json.Unmarshal(raw, &d.Result)
+    }
+    if jobID == "" {
+        return d
+    }
+    payload, err := rdb.Get(ctx, "params:"+jobID).Bytes()
+    if err != nil {
+        return d
+    }
+    var job struct {
+        OwnerID     string  `json:"owner_id"`
+        Material    string  `json:"material"`
+        SubmittedAt float64 `json:"submitted_at"`
+        SubmitAt    string  `json:"submit_at"`
+    }
+    unmarshalPayload(payload, &job)
+    d.OwnerID, d.Material = job.OwnerID, job.Material
+    if job.SubmittedAt > 0 {
+        d.SubmittedAt = time.Unix(int64(job.SubmittedAt), 0).UTC()
+    }
+    if event == "job.submitted" && job.SubmitAt != "" {
+        d.Status = "scheduled"
+    }
+    return d
+}
+
+// renderWebhook executes the hook's template; templates are compiled on
+// every delivery since only the raw text is stored.
+func renderWebhook(ctx context.Context, w webhook, event, jobID string, data interface{}) ([]byte, error) {
+    tmpl, err := parseWebhookTemplate(w.PayloadTemplate)
+    if err != nil {
+        return nil, err
+    }
+    var buf bytes.Buffer
+    if err := tmpl.Execute(&buf, webhookData(ctx, event, jobID, data)); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "github.com/google/uuid"
+
+    "slicer-api/internal/api"
+)
+
+// Webhooks belong to an owner: webhook:{id} is a hash, webhooks:{owner_id}
+// the set of that owner's IDs.
+const webhookTimeout = 10 * time.Second
+
+// Events a webhook can subscribe to. "ping" is sent once on creation.
+var webhookEvents = map[string]bool{
+    "job.submitted": true,
+    "job.completed": true,
+    "job.failed":    true,
+    "job.aborted":   true,
+}
+
+type webhook struct {
+    ID      string   `json:"id"`
+    OwnerID string   `json:"owner_id"`
+    URL     string   `json:"url"`
+    Events  []string `json:"events"`
+    Secret  string   `json:"-"`
+    // Raw text/template source; empty means the default JSON body
+    PayloadTemplate string `json:"payload_template,omitempty"`
+    ContentType     string `json:"content_type"`
+}
+
+type webhookRequest struct {
+    URL             string   `json:"url" binding:"required"`
+    Events          []string `json:"events" binding:"required"`
+    Secret          string   `json:"secret"`
+    PayloadTemplate *string  `json:"payload_template"`
+    ContentType     string   `json:"content_type"`
+}
+
+func (r webhookRequest) validate() error {
+    if err := checkWebhookURL(r.URL); err != nil {
+        return err
+    }
+    if len(r.Events) == 0 {
+        return fmt.Errorf("events must not be empty")
+    }
+    for _, e := range r.Events {
+        if !webhookEvents[e] {
+            return fmt.Errorf("unknown event %q", e)
+        }
+    }
+    if r.ContentType != "" {
+        if err := validContentType(r.ContentType); err != nil {
+            return err
+        }
+    }
+    if r.PayloadTemplate != nil {
+        if _, err := parseWebhookTemplate(*r.PayloadTemplate); err != nil {
+            return fmt.Errorf("payload_template: %v", err)
+        }
+    }
+    return nil
+}
+
+// apply copies the request's settings onto w.
+func (r webhookRequest) apply(w *webhook) {
+    w.URL, w.Events, w.Secret = r.URL, r.Events, r.Secret
+    w.PayloadTemplate = ""
+    if r.PayloadTemplate != nil {
+        w.PayloadTemplate = *r.PayloadTemplate
+    }
+    w.ContentType = r.ContentType
+    if w.ContentType == "" {
+        w.ContentType = defaultWebhookContentType
+    }
+}
+
+func (w webhook) subscribed(event string) bool {
+    for _, e := range w.Events {
+        if e == event {
+            return true
+        }
+    }
+    return false
+}
+
+func saveWebhook(ctx context.Context, w webhook) error {
+    pipe := rdb.TxPipeline()
+    pipe.HSet(ctx, "webhook:"+w.ID, map[string]interface{}{
+        "id":               w.ID,
+        "owner_id":         w.OwnerID,
+        "url":              w.URL,
+        "events":           strings.Join(w.Events, ","),
+        "secret":           w.Secret,
+        "payload_template": w.PayloadTemplate,
+        "content_type":     w.ContentType,
+    })
+    pipe.SAdd(ctx, "webhooks:"+w.OwnerID, w.ID)
+    _, err := pipe.Exec(ctx)
+    return err
+}
+
+func loadWebhook(ctx context.Context, id string) (*webhook, error) {
+    h, err := rdb.HGetAll(ctx, "webhook:"+id).Result()
+    if err != nil {
+        return nil, err
+    }
+    if len(h) == 0 {
+        return nil, redis.Nil
+    }
+    w := &webhook{
+        ID:              h["id"],
+        OwnerID:         h["owner_id"],
+        URL:             h["url"],
+        Events:          strings.Split(h["events"], ","),
+        Secret:          h["secret"],
+        PayloadTemplate: h["payload_template"],
+        ContentType:     h["content_type"],
+    }
+    if w.ContentType == "" {
+        w.ContentType = defaultWebhookContentType
+    }
+    return w, nil
+}
+
+func ownerWebhooks(ctx context.Context, owner string) ([]webhook, error) {
+    ids, err := rdb.SMembers(ctx, "webhooks:"+owner).Result()
+    if err != nil {
+        return nil, err
+    }
+    hooks := []webhook{}
+    for _, id := range ids {
+        w, err := loadWebhook(ctx, id)
+        if err == redis.Nil {
+            rdb.SRem(ctx, "webhooks:"+owner, id)
+            continue
+        } else if err != nil {
+            return nil, err
+        }
+        hooks = append(hooks, *w)
+    }
+    return hooks, nil
+}
+
+// webhookBody is the hook's rendered payload_template, or by default
+// {"event", "job_id", "data", "timestamp"}. A template that fails to execute
+// is logged as a failed attempt.
+func webhookBody(ctx context.Context, w webhook, event, jobID string, data interface{}) ([]byte, error) {
+    if w.PayloadTemplate != "" {
+        body, err := renderWebhook(ctx, w, event, jobID, data)
+        if err != nil {
+            err = fmt.Errorf("payload_template: %v", err)
+            logDelivery(w.ID, webhookDelivery{
+                Event:       event,
+                DeliveredAt: time.Now().UTC().Format(time.RFC3339),
+                Error:       err.Error(),
+                Attempt:     1,
+            })
+            return nil, err
+        }
+        return body, nil
+    }
+    body, _ := json.Marshal(gin.H{
+        "event":     event,
+        "job_id":    jobID,
+        "data":      data,
+        "timestamp": time.Now().UTC().Format(time.RFC3339),
+    })
+    return body, nil
+}
+
+// deliverWebhook POSTs the hook's body once, for the ping a new hook has to
+// answer.
+func deliverWebhook(ctx context.Context, w webhook, event, jobID string, data interface{}) error {
+    body, err := webhookBody(ctx, w, event, jobID, data)
+    if err != nil {
+        return err
+    }
+    _, err = sendWebhook(ctx, w, event, body, 1, "")
+    return err
+}
+
+// sendWebhook POSTs body as is and logs the attempt, noting the delivery it
+// replays if any. It's signed like
+// /internal: X-Webhook-Signature is the hex HMAC-SHA256 of the body keyed
+// with the hook's secret (omitted when it has none). Replays are signed
+// afresh, with X-Timestamp and X-Signature as in setSignatureHeaders. It
+// returns the response status, 0 when there was none.
+func sendWebhook(ctx context.Context, w webhook, event string, body []byte, attempt int, replayOf string) (int, error) {
+    start := time.Now()
+    status, respBytes, err := postWebhook(ctx, w, event, body)
+    logDelivery(w.ID, webhookDelivery{
+        Event:          event,
+        Payload:        string(body),
+        DeliveredAt:    start.UTC().Format(time.RFC3339),
+        ResponseStatus: status,
+        ResponseBytes:  respBytes,
+        Error:          errString(err),
+        Attempt:        attempt,
+        DurationMS:     time.Since(start).Milliseconds(),
+        ReplayOf:       replayOf,
+    })
+    return status, err
+}
+
+// postWebhook returns the response status and how many bytes of the body
+// were read, up to deliveryBodyLimit.
+func postWebhook(ctx context.Context, w webhook, event string, body []byte) (int, int64, error) {
+    ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+    if err != nil {
+        return 0, 0, err
+    }
+    req.Header.Set("Content-Type", w.ContentType)
+    req.Header.Set("X-Webhook-Event", event)
+    if w.Secret != "" {
+        req.Header.Set("X-Webhook-Signature", signBody(w.Secret, body))
+    }
+    setSignatureHeaders(req.Header, signingSecret(w.Secret), body)
+    resp, err := webhookClient.Do(req)
+    if err != nil {
+        return 0, 0, err
+    }
+    defer resp.Body.Close()
+    n, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, deliveryBodyLimit))
+    if resp.StatusCode >= 300 {
+        return resp.StatusCode, n, fmt.Errorf("webhook answered %d", resp.StatusCode)
+    }
+    return resp.StatusCode, n, nil
+}
+
+// signingSecret is what a delivery is signed with: its own secret, or else
+// WEBHOOK_SECRET.
+func signingSecret(own string) string {
+    if own != "" {
+        return own
+    }
+    return cfg().WebhookSecret
+}
+
+// setSignatureHeaders signs a delivery, unless secret is empty: X-Timestamp
+// is the Unix time it is sent and X-Signature "sha256=" and the hex
+// HMAC-SHA256 of "{timestamp}.{body}" keyed with secret. Covering the
+// timestamp lets receivers refuse old deliveries replayed at them.
+func setSignatureHeaders(h http.Header, secret string, body []byte) {
+    if secret == "" {
+        return
+    }
+    ts := strconv.FormatInt(time.Now().Unix(), 10)
+    h.Set("X-Timestamp", ts)
+    h.Set("X-Signature", "sha256="+signBody(secret, append([]byte(ts+"."), body...)))
+}
+
+func errString(err error) string {
+    if err == nil {
+        return ""
+    }
+    return err.Error()
+}
+
+// fireWebhooks notifies, in the background, every webhook of owner that
+// subscribes to event, through the outbox so a failed POST is retried.
+func fireWebhooks(owner, event, jobID string, data interface{}) {
+    if owner == "" {
+        return
+    }
+    go func() {
+        hooks, err := ownerWebhooks(ctx, owner)
+        if err != nil {
+            return
+        }
+        for _, w := range hooks {
+            if !w.subscribed(event) {
+                continue
+            }
+            body, err := webhookBody(ctx, w, event, jobID, data)
+            if err != nil {
+                log.Printf("webhook: %s %s for %s: %v", w.ID, event, jobID, err)
+                continue
+            }
+            id, err := enqueueDelivery(ctx, outboxDelivery{
+                Kind:      outboxWebhook,
+                WebhookID: w.ID,
+                JobID:     jobID,
+                Event:     event,
+                Payload:   string(body),
+            })
+            if err != nil {
+                log.Printf("webhook: queueing %s %s for %s: %v", w.ID, event, jobID, err)
+                continue
+            }
+            attemptDelivery(id)
+        }
+    }()
+}
+
+// requireOwner limits a route to callers with an API key or login session.
+func requireOwner(c *gin.Context) {
+    if requestOwner(c) == "" {
+        c.AbortWithStatusJSON(http.StatusUnauthorized, api.ErrorResponse{Error: "API key or login required"})
+        return
+    }
+    c.Next()
+}
+
+// ownedWebhook loads :id and checks it belongs to the caller; it answers the
+// request itself when it returns nil.
+func ownedWebhook(c *gin.Context) *webhook {
+    w, err := loadWebhook(c.Request.Context(), c.Param("id"))
+    if err == redis.Nil || (err == nil && w.OwnerID != requestOwner(c)) {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Webhook not found"})
+        return nil
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return nil
+    }
+    return w
+}
+
+// POST /webhooks registers a webhook after a successful "ping" delivery.
+func handleCreateWebhook(c *gin.Context) {
+    var req webhookRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if err := req.validate(); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+
+    w := webhook{
+        ID:      uuid.New().String(),
+        OwnerID: requestOwner(c),
+    }
+    req.apply(&w)
+    ctx := c.Request.Context()
+    if err := deliverWebhook(ctx, w, "ping", "", gin.H{"webhook_id": w.ID}); err != nil {
+        rdb.Del(ctx, deliveriesKey(w.ID))
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Ping delivery failed: " + err.Error()})
+        return
+    }
+    if err := saveWebhook(ctx, w); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusCreated, w)
+}
+
+// GET /webhooks lists the caller's webhooks, without their secrets.
+func handleListWebhooks(c *gin.Context) {
+    hooks, err := ownerWebhooks(c.Request.Context(), requestOwner(c))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(hooks), "webhooks": hooks})
+}
+
+// PUT /webhooks/:id replaces url, events, secret, payload_template and
+// content_type.
+func handleUpdateWebhook(c *gin.Context) {
+    w := ownedWebhook(c)
+    if w == nil {
+        return
+    }
+    var req webhookRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if err := req.validate(); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    req.apply(w)
+    if err := saveWebhook(c.Request.Context(), *w); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, w)
+}
+
+// DELETE /webhooks/:id
+func handleDeleteWebhook(c *gin.Context) {
+    w := ownedWebhook(c)
+    if w == nil {
+        return
+    }
+    ctx := c.Request.Context()
+    pipe := rdb.TxPipeline()
+    pipe.Del(ctx, "webhook:"+w.ID)
+    pipe.Del(ctx, deliveriesKey(w.ID))
+    pipe.SRem(ctx, "webhooks:"+w.OwnerID, w.ID)
+    if _, err := pipe.Exec(ctx); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func webhookTestConfig(allowPrivate bool) func(*Config) {
+    return func(c *Config) {
+        c.APIKeys = map[string]string{"k1": "acme"}
+        c.WebhookAllowPrivate = allowPrivate
+    }
+}
+
+func TestCreateWebhookRejectsInternalAddresses(t *testing.T) {
+    setupTest(t, webhookTestConfig(false))
+    r := newRouter()
+    for _, u := range []string{
+        "http://127.0.0.1:6379/",
+        "http://localhost/",
+        "http://169.254.169.254/latest/meta-data/",
+        "http://10.0.0.5/",
+        "http://[::1]/",
+    } {
+        body := `{"url":"` + u + `","events":["job.completed"]}`
+        w := do(r, http.MethodPost, "/webhooks", body, "Authorization", "Bearer k1")
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400 (body %s)", u, w.Code, w.Body)
+        }
+        if !strings.Contains(w.Body.String(), "loopback") {
+            t.Errorf("%s: body = %s, want the address rejection", u, w.Body)
+        }
+    }
+}
+
+func TestCheckWebhookURLNeedsHTTPAndAHost(t *testing.T) {
+    for _, u := range []string{"ftp://example.com/", "javascript:alert(1)", "https://", "/hook", "::"} {
+        if err := checkWebhookURL(u); err == nil || !strings.Contains(err.Error(), "http(s)") {
+            t.Errorf("checkWebhookURL(%q) = %v, want the http(s) rejection", u, err)
+        }
+    }
+}
+
+func TestWebhookDialRefusesInternalAddresses(t *testing.T) {
+    setupTest(t, webhookTestConfig(false))
+    hit := false
+    srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { hit = true }))
+    defer srv.Close()
+
+    // Stored before the rules applied, or its DNS changed since
+    _, _, err := postWebhook(ctx, webhook{URL: srv.URL, ContentType: defaultWebhookContentType}, "ping", []byte("{}"))
+    if err == nil || !strings.Contains(err.Error(), "not allowed") || hit {
+        t.Fatalf("postWebhook to %s: err = %v, hit = %v; want refused", srv.URL, err, hit)
+    }
+}
+
+func TestWebhookRedirectsAreNotFollowed(t *testing.T) {
+    setupTest(t, webhookTestConfig(true))
+    followed := false
+    target := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { followed = true }))
+    defer target.Close()
+    srv := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+    defer srv.Close()
+
+    status, _, err := postWebhook(ctx, webhook{URL: srv.URL, ContentType: defaultWebhookContentType}, "ping", []byte("{}"))
+    if status != http.StatusFound || err == nil || followed {
+        t.Fatalf("status = %d, err = %v, followed = %v; want the 302 back unfollowed", status, err, followed)
+    }
+}
+
+func TestWebhookSignatureHeaders(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.WebhookAllowPrivate = true
+        c.WebhookSecret = "shared"
+    })
+    var header http.Header
+    srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { header = r.Header }))
+    defer srv.Close()
+    body := []byte(`{"event":"ping"}`)
+
+    for _, tc := range []struct {
+        own, key string
+        legacy   bool
+    }{
+        {"", "shared", false},
+        {"own", "own", true},
+    } {
+        w := webhook{URL: srv.URL, ContentType: defaultWebhookContentType, Secret: tc.own}
+        if _, _, err := postWebhook(ctx, w, "ping", body); err != nil {
+            t.Fatal(err)
+        }
+        ts := header.Get("X-Timestamp")
+        if want := "sha256=" + signBody(tc.key, []byte(ts+"."+string(body))); ts == "" || header.Get("X-Signature") != want {
+            t.Errorf("secret %q: X-Timestamp %q, X-Signature %q; want %q", tc.own, ts, header.Get("X-Signature"), want)
+        }
+        if legacy := header.Get("X-Webhook-Signature") != ""; legacy != tc.legacy {
+            t.Errorf("secret %q: X-Webhook-Signature sent = %v, want %v", tc.own, legacy, tc.legacy)
+        }
+    }
+}
+
+func TestWebhookSchemaDocumentsVerification(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    w := do(newRouter(), http.MethodGet, "/webhooks/schema", "")
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "X-Signature") || !strings.Contains(w.Body.String(), "verification") {
+        t.Fatalf("GET /webhooks/schema = %d %s", w.Code, w.Body)
+    }
+}
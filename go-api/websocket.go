@@ -0,0 +1,257 @@
+package main
+
+import (
+    "context"
+    "crypto/hmac"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "golang.org/x/net/websocket"
+
+    "slicer-api/internal/api"
+)
+
+// WebSocket close codes (RFC 6455 section 7.4.1).
+const (
+    wsCloseNormal   = 1000
+    wsClosePolicy   = 1008
+    wsCloseInternal = 1011
+)
+
+var (
+    // wsSendBuffer is how many messages may wait for a slow client before
+    // the server gives up on it and closes with wsClosePolicy.
+    wsSendBuffer = 16
+    // wsWriteTimeout bounds a single write to the client.
+    wsWriteTimeout = 10 * time.Second
+    // wsSend writes one message; tests slow it down.
+    wsSend = websocket.JSON.Send
+)
+
+// wsAction is a message from the client.
+type wsAction struct {
+    Action string `json:"action"`
+    Force  bool   `json:"force"`
+}
+
+// GET /ws/jobs/:id upgrades to a WebSocket carrying the same messages as
+// /status/:id/stream, as JSON with a "type" of status, end, heartbeat or
+// error, and taking {"action":"cancel"} (with "force": true for processing
+// jobs) from the client, answered by a "cancel" message with the code and
+// body DELETE /jobs/:id would return. Browsers can't set headers on the
+// upgrade, so the access token may come as ?token= too.
+func handleJobWebSocket(c *gin.Context) {
+    reqCtx := c.Request.Context()
+    jobID := c.Param("id")
+
+    if !authorizeJobUpgrade(c, jobID) {
+        return
+    }
+    sub, snap, err := subscribeStatus(reqCtx, jobID)
+    if err == redis.Nil {
+        c.JSON(http.StatusNotFound, api.ErrorResponse{Error: "Job not found"})
+        return
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    defer sub.Close()
+
+    server := websocket.Server{
+        Handshake: checkWebSocketOrigin,
+        Handler: func(ws *websocket.Conn) {
+            serveJobWebSocket(c, ws, sub, jobID, snap)
+        },
+    }
+    server.ServeHTTP(c.Writer, c.Request)
+}
+
+// authorizeJobUpgrade admits a caller presenting jobID's access token, in
+// X-Job-Token or ?token=, and otherwise applies authorizeJob.
+func authorizeJobUpgrade(c *gin.Context, jobID string) bool {
+    given := c.GetHeader(jobTokenHeader)
+    if given == "" {
+        given = c.Query("token")
+    }
+    if given != "" {
+        want, err := rdb.Get(c.Request.Context(), accessTokenKey(jobID)).Result()
+        if err == nil && hmac.Equal([]byte(hashJobToken(given)), []byte(want)) {
+            return true
+        }
+    }
+    return authorizeJob(c, jobID)
+}
+
+// checkWebSocketOrigin accepts clients that send no Origin, which only
+// non-browser clients omit, and pages on the API's own host, so another site
+// can't open a socket with the user's session.
+func checkWebSocketOrigin(config *websocket.Config, req *http.Request) error {
+    origin := req.Header.Get("Origin")
+    if origin == "" {
+        return nil
+    }
+    u, err := url.Parse(origin)
+    if err != nil || u.Host != req.Host {
+        return fmt.Errorf("cross-origin WebSocket from %q refused", origin)
+    }
+    config.Origin = u
+    return nil
+}
+
+// serveJobWebSocket runs one connection. Status messages are queued for a
+// single writer without blocking; when a client falls wsSendBuffer messages
+// behind it is closed rather than left to hold the watcher up.
+func serveJobWebSocket(c *gin.Context, ws *websocket.Conn, sub *redis.PubSub, jobID string, snap gin.H) {
+    ctx, cancel := context.WithCancel(c.Request.Context())
+    defer cancel()
+
+    out := make(chan gin.H, wsSendBuffer)
+    slow := make(chan struct{})
+    var overflow sync.Once
+    send := func(msg gin.H) bool {
+        select {
+        case out <- msg:
+            return true
+        default:
+            overflow.Do(func() { close(slow) })
+            return false
+        }
+    }
+
+    // The reader handles client actions until the client goes away. It holds
+    // busy while it acts so a cancel's reply isn't lost to the end message
+    // the cancel itself causes.
+    var busy sync.Mutex
+    readerDone := make(chan struct{})
+    go func() {
+        defer close(readerDone)
+        defer cancel()
+        for {
+            var msg wsAction
+            if err := websocket.JSON.Receive(ws, &msg); err != nil {
+                var syntax *json.SyntaxError
+                var typ *json.UnmarshalTypeError
+                if !errors.As(err, &syntax) && !errors.As(err, &typ) {
+                    // Gone, or closed by us
+                    return
+                }
+                if !send(gin.H{"type": "error", "error": "Messages must be JSON objects"}) {
+                    return
+                }
+                continue
+            }
+            busy.Lock()
+            ok := handleWebSocketAction(c, jobID, msg, send)
+            busy.Unlock()
+            if !ok {
+                return
+            }
+        }
+    }()
+
+    // closeCode is set by the watcher before it stops
+    watchDone := make(chan struct{})
+    closeCode := wsCloseNormal
+    go func() {
+        defer close(watchDone)
+        watchStatus(ctx, sub, jobID, snap, func(ev statusEvent) bool {
+            switch ev.Kind {
+            case "status":
+                msg := gin.H{"type": "status"}
+                for k, v := range ev.Snap {
+                    msg[k] = v
+                }
+                return send(msg)
+            case "heartbeat":
+                return send(gin.H{"type": "heartbeat"})
+            case "end":
+                return send(gin.H{"type": "end", "status": ev.Detail})
+            default:
+                closeCode = wsCloseInternal
+                return send(gin.H{"type": ev.Kind, "error": ev.Detail})
+            }
+        })
+    }()
+
+    write := func(msg gin.H) bool {
+        ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+        return wsSend(ws, msg) == nil
+    }
+    // code 0 means the client is gone and there is no one to tell
+    code := 0
+loop:
+    for {
+        select {
+        case msg := <-out:
+            if !write(msg) {
+                break loop
+            }
+        case <-slow:
+            code = wsClosePolicy
+            break loop
+        case <-watchDone:
+            if ctx.Err() != nil {
+                break loop
+            }
+            // Flush what the watcher and an action in progress queued
+            busy.Lock()
+            flushed := true
+            for len(out) > 0 && flushed {
+                flushed = write(<-out)
+            }
+            busy.Unlock()
+            if !flushed {
+                break loop
+            }
+            code = closeCode
+            select {
+            case <-slow:
+                code = wsClosePolicy
+            default:
+            }
+            break loop
+        case <-ctx.Done():
+            break loop
+        }
+    }
+    if code != 0 {
+        ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+        ws.WriteClose(code)
+    }
+
+    // Unblock the reader and wait for both goroutines: they use c, which
+    // gin reuses once the handler returns
+    cancel()
+    ws.SetReadDeadline(time.Now())
+    <-readerDone
+    <-watchDone
+}
+
+// handleWebSocketAction carries out one client message and queues the reply,
+// reporting whether the reply could be queued.
+func handleWebSocketAction(c *gin.Context, jobID string, msg wsAction, send func(gin.H) bool) bool {
+    if msg.Action != "cancel" {
+        return send(gin.H{"type": "error", "error": fmt.Sprintf("Unknown action %q", msg.Action)})
+    }
+    reply := gin.H{"type": "cancel"}
+    status, err := rdb.Get(c.Request.Context(), "status:"+jobID).Result()
+    if err == redis.Nil {
+        reply["code"], reply["error"] = http.StatusNotFound, "Job not found"
+    } else if err != nil {
+        reply["code"], reply["error"] = http.StatusInternalServerError, "Redis error"
+    } else {
+        code, body := cancelJob(c, jobID, status, msg.Force)
+        for k, v := range body {
+            reply[k] = v
+        }
+        reply["code"] = code
+    }
+    return send(reply)
+}
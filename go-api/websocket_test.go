@@ -0,0 +1,192 @@
+package main
+
+import (
+    "bufio"
+    "encoding/binary"
+    "encoding/json"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "golang.org/x/net/websocket"
+)
+
+// wsClient is just enough of a WebSocket client to see close codes, which
+// x/net/websocket's own client hides.
+type wsClient struct {
+    conn net.Conn
+    r    *bufio.Reader
+}
+
+// dialJobWebSocket opens /ws/jobs/:id on srv with query (e.g. "token=..."),
+// returning the response status when the upgrade is refused.
+func dialJobWebSocket(t *testing.T, srv *httptest.Server, jobID, query string) (*wsClient, int) {
+    t.Helper()
+    conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    conn.SetDeadline(time.Now().Add(5 * time.Second))
+    req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ws/jobs/"+jobID+"?"+query, nil)
+    req.Header.Set("Upgrade", "websocket")
+    req.Header.Set("Connection", "Upgrade")
+    req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+    req.Header.Set("Sec-WebSocket-Version", "13")
+    if err := req.Write(conn); err != nil {
+        t.Fatal(err)
+    }
+    r := bufio.NewReader(conn)
+    resp, err := http.ReadResponse(r, req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusSwitchingProtocols {
+        return nil, resp.StatusCode
+    }
+    return &wsClient{conn: conn, r: r}, resp.StatusCode
+}
+
+// next reads a frame, returning the decoded message of a text frame or the
+// code of a close frame.
+func (ws *wsClient) next(t *testing.T) (map[string]interface{}, int) {
+    t.Helper()
+    var head [2]byte
+    if _, err := io.ReadFull(ws.r, head[:]); err != nil {
+        t.Fatalf("reading frame: %v", err)
+    }
+    n := int(head[1] & 0x7f)
+    if n == 126 {
+        var ext [2]byte
+        io.ReadFull(ws.r, ext[:])
+        n = int(binary.BigEndian.Uint16(ext[:]))
+    }
+    payload := make([]byte, n)
+    io.ReadFull(ws.r, payload)
+    if head[0]&0x0f == websocket.CloseFrame {
+        if n < 2 {
+            return nil, 1005
+        }
+        return nil, int(binary.BigEndian.Uint16(payload))
+    }
+    var msg map[string]interface{}
+    if err := json.Unmarshal(payload, &msg); err != nil {
+        t.Fatalf("frame %q isn't JSON", payload)
+    }
+    return msg, 0
+}
+
+// until reads messages until one of type typ, failing on a close first.
+func (ws *wsClient) until(t *testing.T, typ string) map[string]interface{} {
+    t.Helper()
+    for {
+        msg, code := ws.next(t)
+        if code != 0 {
+            t.Fatalf("closed with %d before a %q message", code, typ)
+        }
+        if msg["type"] == typ {
+            return msg
+        }
+    }
+}
+
+func (ws *wsClient) send(t *testing.T, text string) {
+    t.Helper()
+    // A masked text frame with an all-zero key, so the payload goes as is
+    frame := append([]byte{0x81, 0x80 | byte(len(text)), 0, 0, 0, 0}, text...)
+    if _, err := ws.conn.Write(frame); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestJobWebSocketCancel(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    streamTimers(t, time.Hour, time.Hour)
+    srv := httptest.NewServer(newRouter())
+    defer srv.Close()
+    jobID, token := submitForCancel(t, srv.Config.Handler)
+
+    ws, _ := dialJobWebSocket(t, srv, jobID, "token="+token)
+    if ws == nil {
+        t.Fatal("upgrade refused with a valid token")
+    }
+    if msg := ws.until(t, "status"); msg["status"] != "queued" {
+        t.Fatalf("first status = %v; want queued", msg)
+    }
+    ws.send(t, `{"action":"pause"}`)
+    if msg := ws.until(t, "error"); !strings.Contains(msg["error"].(string), "pause") {
+        t.Errorf("unknown action error = %v", msg)
+    }
+
+    // The end the cancel causes may overtake its reply
+    ws.send(t, `{"action":"cancel"}`)
+    got := map[string]map[string]interface{}{}
+    for {
+        msg, code := ws.next(t)
+        if code != 0 {
+            if code != wsCloseNormal {
+                t.Errorf("close code = %d; want %d", code, wsCloseNormal)
+            }
+            break
+        }
+        got[msg["type"].(string)] = msg
+    }
+    if reply := got["cancel"]; reply["code"] != float64(http.StatusOK) || reply["status"] != "cancelled" {
+        t.Errorf("cancel reply = %v; want code 200, status cancelled", reply)
+    }
+    if end := got["end"]; end["status"] != "cancelled" {
+        t.Errorf("end = %v; want cancelled", end)
+    }
+    if got := rdb.Get(ctx, "status:"+jobID).Val(); got != "cancelled" {
+        t.Errorf("status = %q; want cancelled", got)
+    }
+}
+
+func TestJobWebSocketNeedsToken(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    srv := httptest.NewServer(newRouter())
+    defer srv.Close()
+    jobID, _ := submitForCancel(t, srv.Config.Handler)
+
+    for _, query := range []string{"", "token=guess"} {
+        if ws, code := dialJobWebSocket(t, srv, jobID, query); ws != nil || code != http.StatusForbidden {
+            t.Errorf("%q: upgrade status = %d; want 403", query, code)
+        }
+    }
+    if _, code := dialJobWebSocket(t, srv, "missing", ""); code != http.StatusNotFound {
+        t.Errorf("unknown job: status = %d; want 404", code)
+    }
+}
+
+func TestJobWebSocketClosesSlowConsumer(t *testing.T) {
+    setupTest(t, func(*Config) {})
+    // Heartbeats arrive far faster than the client takes them
+    streamTimers(t, time.Hour, time.Millisecond)
+    saved, savedBuffer := wsSend, wsSendBuffer
+    wsSend = func(ws *websocket.Conn, v interface{}) error {
+        time.Sleep(50 * time.Millisecond)
+        return saved(ws, v)
+    }
+    wsSendBuffer = 2
+    t.Cleanup(func() { wsSend, wsSendBuffer = saved, savedBuffer })
+    srv := httptest.NewServer(newRouter())
+    defer srv.Close()
+    jobID, token := submitForCancel(t, srv.Config.Handler)
+
+    ws, _ := dialJobWebSocket(t, srv, jobID, "token="+token)
+    if ws == nil {
+        t.Fatal("upgrade refused with a valid token")
+    }
+    for {
+        if _, code := ws.next(t); code != 0 {
+            if code != wsClosePolicy {
+                t.Errorf("close code = %d; want %d", code, wsClosePolicy)
+            }
+            return
+        }
+    }
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Workers announce themselves by POSTing to /workers/register (signed like
+// /internal) every heartbeat interval. worker:{id} expires after a few
+// missed heartbeats; workersKey indexes the IDs.
+const (
+    workersKey          = "workers"
+    missedHeartbeats    = 3
+    defaultNozzle       = 0.4
+    nozzleTolerance     = 1e-6
+    minHeartbeatSeconds = 5
+)
+
+type workerInfo struct {
+    ID               string    `json:"id" binding:"required"`
+    Queue            string    `json:"queue"`
+    Materials        []string  `json:"materials"`
+    Nozzles          []float64 `json:"nozzles"`
+    HeartbeatSeconds int       `json:"heartbeat_interval" binding:"required"`
+    LastSeen         string    `json:"last_seen"`
+}
+
+// handles reports whether the worker can slice material with nozzle. An
+// empty capability list means "any".
+func (w workerInfo) handles(material string, nozzle float64) bool {
+    if len(w.Materials) > 0 && !containsFold(w.Materials, material) {
+        return false
+    }
+    if len(w.Nozzles) == 0 {
+        return true
+    }
+    for _, n := range w.Nozzles {
+        if math.Abs(n-nozzle) < nozzleTolerance {
+            return true
+        }
+    }
+    return false
+}
+
+func containsFold(list []string, s string) bool {
+    for _, v := range list {
+        if strings.EqualFold(v, s) {
+            return true
+        }
+    }
+    return false
+}
+
+// liveWorkers returns registered workers whose heartbeat hasn't lapsed,
+// sorted by ID, and drops lapsed ones from the index.
+func liveWorkers(ctx context.Context) ([]workerInfo, error) {
+    ids, err := rdb.SMembers(ctx, workersKey).Result()
+    if err != nil || len(ids) == 0 {
+        return nil, err
+    }
+    keys := make([]string, len(ids))
+    for i, id := range ids {
+        keys[i] = "worker:" + id
+    }
+    vals, err := rdb.MGet(ctx, keys...).Result()
+    if err != nil {
+        return nil, err
+    }
+    var live []workerInfo
+    for i, v := range vals {
+        s, ok := v.(string)
+        var w workerInfo
+        if !ok || json.Unmarshal([]byte(s), &w) != nil {
+            rdb.SRem(ctx, workersKey, ids[i])
+            continue
+        }
+        live = append(live, w)
+    }
+    sort.Slice(live, func(i, j int) bool { return live[i].ID < live[j].ID })
+    return live, nil
+}
+
+// routeJob picks the queue for a job among the live workers; see
+// chooseQueue. A registry Redis can't read counts as empty.
+func routeJob(ctx context.Context, material, region string, nozzle float64, rush bool) (string, bool) {
+    workers, _ := liveWorkers(ctx)
+    return chooseQueue(workers, material, region, nozzle, rush)
+}
+
+// chooseQueue routes a job given the live workers, sorted by ID. With none
+// registered (older workers don't register) the QUEUE_MAP routing applies
+// unchanged, unless REQUIRE_CAPABLE_WORKER. Otherwise the mapped queue is
+// kept if a capable worker listens on it, else the job goes to the first
+// capable worker's queue; false means nobody can take it. Jobs never leave
+// their region: only workers on the same region's lists (or, without one,
+// the global lists) count.
+func chooseQueue(workers []workerInfo, material, region string, nozzle float64, rush bool) (string, bool) {
+    preferred := queueFor(material, region, rush)
+    if len(workers) == 0 {
+        return preferred, !cfg().RequireCapableWorker
+    }
+
+    base := regionQueue(materialQueue(material), region)
+    var capable []workerInfo
+    for _, w := range workers {
+        // Registration refuses unknown queues, but QUEUE_MAP may have
+        // changed since; a job routed there would never be dispatched
+        if !w.handles(material, nozzle) || !knownQueue(w.Queue) || queueRegion(w.Queue) != queueRegion(base) {
+            continue
+        }
+        if w.Queue == base {
+            return preferred, true
+        }
+        capable = append(capable, w)
+    }
+    if len(capable) == 0 {
+        return "", false
+    }
+    if rush && !singleQueue() {
+        return rushQueueFor(capable[0].Queue), true
+    }
+    return capable[0].Queue, true
+}
+
+// noCapableWorker answers a submission routeJob found no queue for: 422
+// by default, or with REQUIRE_CAPABLE_WORKER a 503 to retry once a worker
+// for the material is back.
+func noCapableWorker(c *gin.Context) {
+    if !cfg().RequireCapableWorker {
+        c.JSON(http.StatusUnprocessableEntity, api.ErrorResponse{Error: "No registered worker can handle this material and nozzle"})
+        return
+    }
+    c.Header("Retry-After", strconv.Itoa(absentRetryAfter))
+    c.JSON(http.StatusServiceUnavailable, gin.H{
+        "error":      "No live worker can handle this material and nozzle, please try again later",
+        "error_code": "no_capable_workers",
+    })
+}
+
+// POST /workers/register doubles as the heartbeat.
+func handleRegisterWorker(c *gin.Context) {
+    var w workerInfo
+    if err := c.ShouldBindJSON(&w); err != nil {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+        return
+    }
+    if w.HeartbeatSeconds < minHeartbeatSeconds {
+        w.HeartbeatSeconds = minHeartbeatSeconds
+    }
+    if w.Queue == "" {
+        w.Queue = standardQueue
+    }
+    if !knownQueue(w.Queue) {
+        c.JSON(http.StatusBadRequest, api.ErrorResponse{Error: "Queue " + w.Queue + " is not configured; add it to QUEUE_MAP first"})
+        return
+    }
+    w.LastSeen = time.Now().UTC().Format(time.RFC3339)
+
+    ctx := c.Request.Context()
+    data, _ := json.Marshal(w)
+    ttl := time.Duration(w.HeartbeatSeconds*missedHeartbeats) * time.Second
+    pipe := rdb.TxPipeline()
+    pipe.Set(ctx, "worker:"+w.ID, data, ttl)
+    pipe.SAdd(ctx, workersKey, w.ID)
+    recordHeartbeat(ctx, pipe, w.ID, ttl)
+    if _, err := pipe.Exec(ctx); err != nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"id": w.ID, "queue": w.Queue, "expires_in_seconds": int(ttl.Seconds())})
+}
+
+// GET /admin/workers lists live workers and when they last checked in.
+func handleListWorkers(c *gin.Context) {
+    workers, err := liveWorkers(c.Request.Context())
+    if err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    if workers == nil {
+        workers = []workerInfo{}
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(workers), "workers": workers})
+}
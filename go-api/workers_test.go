@@ -0,0 +1,97 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func registerTestWorker(t *testing.T, w workerInfo) {
+    t.Helper()
+    data, _ := json.Marshal(w)
+    rdb.Set(ctx, "worker:"+w.ID, data, time.Minute)
+    rdb.SAdd(ctx, workersKey, w.ID)
+}
+
+func TestRouteJobSkipsUnconfiguredQueues(t *testing.T) {
+    setupTest(t, func(c *Config) {
+        c.QueueMap = map[string]string{"TPU": "print_jobs_flex"}
+    })
+    registerTestWorker(t, workerInfo{ID: "a", Queue: "print_jobs_rogue", Materials: []string{"PETG"}})
+    registerTestWorker(t, workerInfo{ID: "b", Queue: "print_jobs_flex", Materials: []string{"PETG"}})
+
+    queue, ok := routeJob(ctx, "PETG", "", defaultNozzle, false)
+    if !ok || queue != "print_jobs_flex" {
+        t.Fatalf("routeJob = %q, %v; want print_jobs_flex", queue, ok)
+    }
+}
+
+func TestRegisterWorkerRejectsUnknownQueue(t *testing.T) {
+    setupTest(t, func(c *Config) { c.InternalSecret = "s" })
+    body := `{"id":"w1","queue":"print_jobs_rogue","heartbeat_interval":30}`
+    w := do(newRouter(), http.MethodPost, "/workers/register", body, "X-Internal-Signature", "sha256="+signBody("s", []byte(body)))
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("status = %d, want 400 (body %s)", w.Code, w.Body)
+    }
+}
+
+// chooseQueue needs only the config and the workers it is given, no Redis.
+func TestChooseQueue(t *testing.T) {
+    c := defaultConfig()
+    c.QueueMap = map[string]string{"TPU": "print_jobs_flex"}
+    setConfig(c)
+    basic := workerInfo{ID: "a", Queue: standardQueue, Materials: []string{"PLA", "PETG"}, Nozzles: []float64{0.4}}
+    flex := workerInfo{ID: "b", Queue: "print_jobs_flex", Materials: []string{"TPU", "ASA"}}
+    fine := workerInfo{ID: "c", Queue: standardQueue, Nozzles: []float64{0.25}}
+
+    for _, tt := range []struct {
+        name     string
+        workers  []workerInfo
+        material string
+        nozzle   float64
+        rush     bool
+        queue    string
+        ok       bool
+    }{
+        {"no registry uses QUEUE_MAP", nil, "TPU", 0.4, false, "print_jobs_flex", true},
+        {"mapped queue kept", []workerInfo{basic, flex}, "TPU", 0.4, false, "print_jobs_flex", true},
+        {"rush on the mapped queue", []workerInfo{basic, flex}, "PLA", 0.4, true, "print_jobs:rush", true},
+        {"moved to a capable worker", []workerInfo{basic, flex}, "asa", 0.4, false, "print_jobs_flex", true},
+        {"rush follows the move", []workerInfo{basic, flex}, "ASA", 0.4, true, "print_jobs_flex:rush", true},
+        {"no worker for the material", []workerInfo{basic, flex}, "Nylon", 0.4, false, "", false},
+        {"no worker for the nozzle", []workerInfo{basic, fine}, "PLA", 0.8, false, "", false},
+        {"any material with the nozzle", []workerInfo{basic, fine}, "Nylon", 0.25, false, standardQueue, true},
+    } {
+        queue, ok := chooseQueue(tt.workers, tt.material, "", tt.nozzle, tt.rush)
+        if queue != tt.queue || ok != tt.ok {
+            t.Errorf("%s: chooseQueue = %q, %v; want %q, %v", tt.name, queue, ok, tt.queue, tt.ok)
+        }
+    }
+
+    c.RequireCapableWorker = true
+    if queue, ok := chooseQueue(nil, "PLA", "", 0.4, false); ok {
+        t.Errorf("with REQUIRE_CAPABLE_WORKER and no registry: %q, want refused", queue)
+    }
+}
+
+func TestRequireCapableWorker(t *testing.T) {
+    setupTest(t, func(c *Config) { c.RequireCapableWorker = true })
+    r := newRouter()
+    quote := `{"download_url":"https://example.com/part.stl","material":"ASA","infill":20}`
+
+    w := do(r, http.MethodPost, "/quote", quote)
+    var resp map[string]interface{}
+    json.Unmarshal(w.Body.Bytes(), &resp)
+    if w.Code != http.StatusServiceUnavailable || resp["error_code"] != "no_capable_workers" || w.Header().Get("Retry-After") == "" {
+        t.Fatalf("no workers: %d %s, want 503 no_capable_workers", w.Code, w.Body)
+    }
+    registerTestWorker(t, workerInfo{ID: "a", Queue: standardQueue, Materials: []string{"PLA", "PETG"}})
+    if w := do(r, http.MethodPost, "/quote", quote); w.Code != http.StatusServiceUnavailable {
+        t.Errorf("PLA/PETG worker only: %d, want 503", w.Code)
+    }
+    registerTestWorker(t, workerInfo{ID: "b", Queue: standardQueue, Materials: []string{"ASA"}})
+    if w := do(r, http.MethodPost, "/quote", quote); w.Code != http.StatusAccepted {
+        t.Errorf("with an ASA worker: %d %s, want 202", w.Code, w.Body)
+    }
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+
+    "slicer-api/internal/api"
+)
+
+// Each worker's last heartbeat is also kept in activeWorkersKey, a sorted
+// set scored by its unix time, which outlives the heartbeat key. Every
+// HEARTBEAT_CHECK_INTERVAL_SECONDS the sweep moves workers silent for
+// WORKER_HEARTBEAT_TIMEOUT_SECONDS to staleWorkersKey, and those silent
+// for WORKER_DEAD_TIMEOUT_SECONDS on to deadWorkersKey, handing their jobs
+// back to the queue. Both keep the last heartbeat as the score. A worker
+// that beats again is active once more.
+const (
+    activeWorkersKey = "workers:active"
+    staleWorkersKey  = "workers:stale"
+    deadWorkersKey   = "workers:dead"
+    // deadWorkersRetention is how long dead workers stay listed
+    deadWorkersRetention = 7 * 24 * time.Hour
+)
+
+// workerJobsKey is the set of IDs of the jobs workerID has claimed from
+// the processing list and not yet finished with. Stream entries don't
+// need one: the consumer group records who holds them.
+func workerJobsKey(workerID string) string {
+    return "worker_jobs:" + workerID
+}
+
+func startWorkerSweep() {
+    interval := cfg().HeartbeatCheckInterval()
+    registerLease("workers")
+    go func() {
+        for range time.Tick(interval) {
+            runLeased("workers", leaseTTL(interval), func() {
+                if err := sweepWorkers(ctx, time.Now()); err != nil {
+                    log.Printf("WARN sweeping workers: %v", err)
+                }
+            })
+        }
+    }()
+}
+
+// sweepWorkers marks the workers silent as of now stale or dead.
+func sweepWorkers(ctx context.Context, now time.Time) error {
+    stale, err := silentWorkers(ctx, activeWorkersKey, now.Add(-cfg().WorkerHeartbeatTimeout()))
+    if err != nil {
+        return err
+    }
+    for _, w := range stale {
+        id := w.Member.(string)
+        if moved, _ := moveWorker(ctx, activeWorkersKey, staleWorkersKey, w); moved {
+            log.Printf("WARN worker stale worker_id=%s last_heartbeat=%s silent_seconds=%d", id, heartbeatTime(w.Score), int(now.Sub(time.Unix(int64(w.Score), 0)).Seconds()))
+        }
+    }
+
+    dead, err := silentWorkers(ctx, staleWorkersKey, now.Add(-cfg().WorkerDeadTimeout()))
+    if err != nil {
+        return err
+    }
+    for _, w := range dead {
+        id := w.Member.(string)
+        if moved, _ := moveWorker(ctx, staleWorkersKey, deadWorkersKey, w); !moved {
+            continue
+        }
+        freed, err := freeWorkerJobs(ctx, id)
+        log.Printf("WARN worker dead worker_id=%s last_heartbeat=%s jobs_requeued=%d", id, heartbeatTime(w.Score), freed)
+        if err != nil {
+            log.Printf("WARN requeueing the jobs of worker %s: %v", id, err)
+        }
+    }
+    rdb.ZRemRangeByScore(ctx, deadWorkersKey, "-inf", "("+strconv.FormatInt(now.Add(-deadWorkersRetention).Unix(), 10))
+    return nil
+}
+
+// silentWorkers are the members of key whose last heartbeat was at or
+// before since.
+func silentWorkers(ctx context.Context, key string, since time.Time) ([]redis.Z, error) {
+    return rdb.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "0", Max: strconv.FormatInt(since.Unix(), 10)}).Result()
+}
+
+// moveWorker moves w from one set to the other. The ZREM is the claim, so
+// two sweeps running at once don't both act on it.
+func moveWorker(ctx context.Context, from, to string, w redis.Z) (bool, error) {
+    n, err := rdb.ZRem(ctx, from, w.Member).Result()
+    if err != nil || n == 0 {
+        return false, err
+    }
+    return true, rdb.ZAdd(ctx, to, &w).Err()
+}
+
+func heartbeatTime(score float64) string {
+    return time.Unix(int64(score), 0).UTC().Format(time.RFC3339)
+}
+
+// freeWorkerJobs hands the jobs a dead worker still holds back to the
+// retry policy, as the reaper would once their visibility timeout ran out,
+// and returns how many.
+func freeWorkerJobs(ctx context.Context, workerID string) (int, error) {
+    freed := 0
+    held, err := rdb.SMembers(ctx, workerJobsKey(workerID)).Result()
+    if err != nil {
+        return 0, err
+    }
+    if len(held) > 0 {
+        holds := make(map[string]bool, len(held))
+        for _, id := range held {
+            holds[id] = true
+        }
+        entries, err := rdb.LRange(ctx, processingQueue, 0, -1).Result()
+        if err != nil {
+            return 0, err
+        }
+        for _, entry := range entries {
+            job, err := readPayload([]byte(entry))
+            if err != nil {
+                continue
+            }
+            if jobID, _ := job["id"].(string); holds[jobID] && releaseJob(jobID) {
+                if err := requeueStale(entry, job); err != nil {
+                    return freed, err
+                }
+                freed++
+            }
+        }
+        rdb.Del(ctx, workerJobsKey(workerID))
+    }
+
+    for _, q := range jobQueues() {
+        stream := streamFor(q)
+        pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+            Stream:   stream,
+            Group:    consumerGroup,
+            Start:    "-",
+            End:      "+",
+            Count:    100,
+            Consumer: workerID,
+        }).Result()
+        if err != nil {
+            // No stream or group for this queue
+            continue
+        }
+        for _, p := range pending {
+            msgs, err := rdb.XRangeN(ctx, stream, p.ID, p.ID, 1).Result()
+            // Acking is the claim, as LREM is for the list
+            if acked, _ := rdb.XAck(ctx, stream, consumerGroup, p.ID).Result(); err != nil || len(msgs) == 0 || acked == 0 {
+                continue
+            }
+            payload, _ := msgs[0].Values["payload"].(string)
+            job, err := readPayload([]byte(payload))
+            if err != nil {
+                continue
+            }
+            if jobID, _ := job["id"].(string); !releaseJob(jobID) {
+                continue
+            }
+            if err := scheduleRetry(job, "worker went away"); err != nil {
+                return freed, err
+            }
+            freed++
+        }
+    }
+    return freed, nil
+}
+
+// releaseJob reports whether a dead worker's job should be retried: not if
+// it already finished, and not if it was being cancelled, which its
+// worker is no longer there to confirm.
+func releaseJob(jobID string) bool {
+    switch parseJobStatus(rdb.Get(ctx, "status:"+jobID).Val()) {
+    case StatusProcessing:
+        return true
+    case StatusCancelling:
+        settleCancel(jobID, "the worker went away")
+    }
+    return false
+}
+
+// GET /admin/workers/stale lists the workers that stopped sending
+// heartbeats, most recently heard from first: "stale" ones and those
+// since declared "dead".
+func handleListStaleWorkers(c *gin.Context) {
+    ctx := c.Request.Context()
+    pipe := rdb.Pipeline()
+    stale := pipe.ZRevRangeWithScores(ctx, staleWorkersKey, 0, -1)
+    dead := pipe.ZRevRangeWithScores(ctx, deadWorkersKey, 0, -1)
+    if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+        c.JSON(http.StatusInternalServerError, api.ErrorResponse{Error: "Redis error"})
+        return
+    }
+    list := func(ws []redis.Z) []gin.H {
+        out := make([]gin.H, 0, len(ws))
+        for _, w := range ws {
+            out = append(out, gin.H{
+                "id":             w.Member,
+                "last_heartbeat": heartbeatTime(w.Score),
+                "silent_seconds": int(time.Since(time.Unix(int64(w.Score), 0)).Seconds()),
+            })
+        }
+        return out
+    }
+    c.JSON(http.StatusOK, gin.H{"stale": list(stale.Val()), "dead": list(dead.Val())})
+}
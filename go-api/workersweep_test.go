@@ -0,0 +1,124 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// beatAt records workerID's last heartbeat as at.
+func beatAt(t *testing.T, workerID string, at time.Time) {
+    t.Helper()
+    pipe := rdb.TxPipeline()
+    recordHeartbeat(ctx, pipe, workerID, time.Minute)
+    pipe.ZAdd(ctx, activeWorkersKey, &redis.Z{Score: float64(at.Unix()), Member: workerID})
+    if _, err := pipe.Exec(ctx); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestSilentWorkersGoStaleThenDead(t *testing.T) {
+    setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+    r := newRouter()
+    now := time.Now()
+    beatAt(t, "gone", now.Add(-2*time.Minute))
+    beatAt(t, "alive", now)
+
+    // A job the worker claimed from the processing list
+    job := map[string]interface{}{"id": "j1", "queue": standardQueue}
+    entry := marshalPayload(job)
+    rdb.RPush(ctx, processingQueue, entry)
+    rdb.HSet(ctx, claimedAtKey, "j1", now.Unix())
+    rdb.SAdd(ctx, workerJobsKey("gone"), "j1")
+    rdb.Set(ctx, "status:j1", "processing", time.Hour)
+
+    if err := sweepWorkers(ctx, now); err != nil {
+        t.Fatal(err)
+    }
+    var listed struct {
+        Stale []struct {
+            ID            string `json:"id"`
+            LastHeartbeat string `json:"last_heartbeat"`
+        } `json:"stale"`
+        Dead []struct {
+            ID string `json:"id"`
+        } `json:"dead"`
+    }
+    w := do(r, http.MethodGet, "/admin/workers/stale", "", "Authorization", "Bearer secret")
+    json.Unmarshal(w.Body.Bytes(), &listed)
+    if w.Code != http.StatusOK || len(listed.Stale) != 1 || listed.Stale[0].ID != "gone" || listed.Stale[0].LastHeartbeat == "" || len(listed.Dead) != 0 {
+        t.Fatalf("after the heartbeat timeout: %d %s; want only gone stale", w.Code, w.Body)
+    }
+    if n := rdb.ZCard(ctx, activeWorkersKey).Val(); n != 1 {
+        t.Errorf("%d active workers, want 1", n)
+    }
+    if got := rdb.Get(ctx, "status:j1").Val(); got != "processing" {
+        t.Errorf("stale worker's job is %s, want it left processing", got)
+    }
+
+    if err := sweepWorkers(ctx, now.Add(cfg().WorkerDeadTimeout()-time.Minute)); err != nil {
+        t.Fatal(err)
+    }
+    w = do(r, http.MethodGet, "/admin/workers/stale", "", "Authorization", "Bearer secret")
+    listed.Stale, listed.Dead = nil, nil
+    json.Unmarshal(w.Body.Bytes(), &listed)
+    // "alive" has gone silent by then, but not for as long
+    if len(listed.Dead) != 1 || listed.Dead[0].ID != "gone" || len(listed.Stale) != 1 || listed.Stale[0].ID != "alive" {
+        t.Fatalf("after the dead timeout: %s; want gone dead and alive stale", w.Body)
+    }
+    if got := rdb.Get(ctx, "status:j1").Val(); got != "queued" {
+        t.Errorf("dead worker's job is %s, want it queued for retry", got)
+    }
+    if n := rdb.LLen(ctx, processingQueue).Val(); n != 0 {
+        t.Errorf("%d entries left in the processing list", n)
+    }
+    if n := rdb.Exists(ctx, workerJobsKey("gone")).Val(); n != 0 {
+        t.Error("worker_jobs outlived its worker")
+    }
+
+    // Heard from again
+    beatAt(t, "gone", time.Now())
+    if n := rdb.ZCard(ctx, deadWorkersKey).Val(); n != 0 {
+        t.Errorf("%d dead workers after a heartbeat, want 0", n)
+    }
+}
+
+func TestDeadWorkerReleasesStreamEntries(t *testing.T) {
+    setupTest(t)
+    if err := initStreams(); err != nil {
+        t.Fatal(err)
+    }
+    data := marshalPayload(map[string]interface{}{"id": "j1", "queue": standardQueue})
+    if err := enqueue(ctx, standardQueue, "j1", data); err != nil {
+        t.Fatal(err)
+    }
+    rdb.Set(ctx, "status:j1", "processing", time.Hour)
+    err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+        Group:    consumerGroup,
+        Consumer: "gone",
+        Streams:  []string{streamFor(standardQueue), ">"},
+        Count:    1,
+        Block:    -1,
+    }).Err()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if n, err := freeWorkerJobs(ctx, "gone"); err != nil || n != 1 {
+        t.Fatalf("freed %d, %v; want 1", n, err)
+    }
+    if got := rdb.Get(ctx, "status:j1").Val(); got != "queued" {
+        t.Errorf("job is %s, want it queued for retry", got)
+    }
+    pending, _ := rdb.XPending(ctx, streamFor(standardQueue), consumerGroup).Result()
+    if pending.Count != 0 {
+        t.Errorf("%d entries still pending", pending.Count)
+    }
+    // Nothing left to hand back a second time
+    if n, _ := freeWorkerJobs(ctx, "gone"); n != 0 {
+        t.Errorf("freed %d again", n)
+    }
+}
@@ -5,6 +5,7 @@ Compatible with Next.js web applications through REST API
 """
 
 import subprocess
+import threading
 import os
 import uuid
 import re
@@ -37,7 +38,19 @@ CONFIG = {
             "ABS": 1.2
         },
         "rush_multiplier": 1.2  # 20% extra for rush orders
-    }
+    },
+    # Rates for jobs the API flags with the pricing_v2 feature, so new
+    # pricing can be rolled out to a share of customers. Keys left out
+    # fall back to "pricing".
+    "pricing_v2": {}
+}
+
+# cfg.ini keys each bed adhesion type of the API's bed_adhesion sets
+BED_ADHESION_SETTINGS = {
+    "none": {"skirts": 0, "brim_width": 0, "raft_layers": 0},
+    "skirt": {"skirts": 1, "brim_width": 0, "raft_layers": 0},
+    "brim": {"skirts": 0, "brim_width": 5, "raft_layers": 0},
+    "raft": {"skirts": 0, "brim_width": 0, "raft_layers": 3},
 }
 
 class QuotationEngine:
@@ -45,8 +58,22 @@ class QuotationEngine:
     
     def __init__(self, config: Dict = None):
         self.config = config or CONFIG
+        # Called with each line of slicer output as it is produced
+        self.log_sink = None
+        # The running slicer, so abort() can stop it
+        self.current_proc = None
+        # Called with "slicing" and "pricing" as generate_quotation reaches them
+        self.on_stage = None
+        # Feature flags the API set on the job being processed
+        self.features = set()
         # self.ensure_directories()
     
+    def abort(self):
+        """Kill the slicer if one is running"""
+        proc = self.current_proc
+        if proc and proc.poll() is None:
+            proc.kill()
+    
     def ensure_directories(self):
         """Create necessary directories"""
         for dir_name in ["output_dir", "upload_dir"]:
@@ -209,9 +236,10 @@ class QuotationEngine:
             # print(f"⚠️ {error_msg}, using original orientation")
             return stl_file, f"Orientation error, using original", orientation_data
     
-    def get_config_file(self, layer_height: float, infill: int) -> str:
+    def get_config_file(self, layer_height: float, infill: int, bed_adhesion: str = "skirt",
+                        nozzle: float = 0.4) -> str:
         """
-        Generate a config file with the specified layer height and infill percentage.
+        Generate a config file with the specified layer height, infill percentage, bed adhesion and nozzle diameter.
         Reads a base config file and modifies the fill_density value dynamically.
         Returns: path to temporary config file
         """
@@ -244,8 +272,25 @@ class QuotationEngine:
                 flags=re.MULTILINE
             )
         
+        # Bed adhesion: cfg.ini itself is a plain skirt
+        for key, value in BED_ADHESION_SETTINGS.get(bed_adhesion, BED_ADHESION_SETTINGS["skirt"]).items():
+            content = re.sub(
+                rf'^{key} = .*$',
+                f'{key} = {value}',
+                content,
+                flags=re.MULTILINE
+            )
+        
+        # Nozzle: cfg.ini itself is set up for the stock 0.4mm nozzle
+        content = re.sub(
+            r'^nozzle_diameter = .*$',
+            f'nozzle_diameter = {nozzle}',
+            content,
+            flags=re.MULTILINE
+        )
+        
         # Write to a temporary config file
-        output_file = os.path.join("temp", f"config_{layer_height}_{infill}.ini")
+        output_file = os.path.join("temp", f"config_{layer_height}_{infill}_{bed_adhesion}_{nozzle}.ini")
         os.makedirs("temp", exist_ok=True)
         with open(output_file, 'w') as f:
             f.write(content)
@@ -291,15 +336,16 @@ class QuotationEngine:
             return "medium"
     
     def slice_model(self, stl_path: str, job_id: str, material: str = "PLA", 
-                    layer_height: float = 0.2, infill: int =15) ->  Dict:
+                    layer_height: float = 0.2, infill: int =15, bed_adhesion: str = "skirt",
+                    nozzle: float = 0.4) ->  Dict:
         """
         Slice the model and extract printing information
         Returns: ( slicing_data)
         """
-        print(f"🔪 Slicing model (material: {material}, layer: {layer_height}mm, infill: {infill}%)")
+        print(f"🔪 Slicing model (material: {material}, layer: {layer_height}mm, infill: {infill}%, nozzle: {nozzle}mm)")
         
         gcode_path = os.path.join("temp", f"{job_id}.gcode")
-        config_file = self.get_config_file(layer_height, infill)
+        config_file = self.get_config_file(layer_height, infill, bed_adhesion, nozzle)
         
         cmd = [
             self.config["paths"]["prusaslicer"],
@@ -310,25 +356,48 @@ class QuotationEngine:
         ]
         
         try:
-            result = subprocess.run(
-                cmd, 
-                capture_output=True, 
+            # Read output line by line so it can be streamed while slicing
+            proc = subprocess.Popen(
+                cmd,
+                stdout=subprocess.PIPE,
+                stderr=subprocess.STDOUT,
                 text=True,
                 encoding='utf-8',
-                errors='replace',
-                timeout=self.config["printing"]["timeout"]
+                errors='replace'
             )
-            print(result.stdout)
-            
-            if result.returncode != 0:
-                error_msg = f"Slicer failed: {result.stderr}"
+            self.current_proc = proc
+            timed_out = threading.Event()
+            def kill():
+                timed_out.set()
+                proc.kill()
+            timer = threading.Timer(self.config["printing"]["timeout"], kill)
+            timer.start()
+            output = []
+            try:
+                for line in proc.stdout:
+                    line = line.rstrip("\n")
+                    print(line)
+                    output.append(line)
+                    if self.log_sink:
+                        self.log_sink(line)
+                proc.wait()
+            finally:
+                timer.cancel()
+                self.current_proc = None
+            
+            if proc.returncode != 0:
+                tail = "\n".join(output[-20:])
+                if timed_out.is_set():
+                    return {"error": f"Slicer timed out after {self.config['printing']['timeout']}s", "error_code": "timeout"}
+                error_msg = f"Slicer failed: {tail}"
                 # print(f"❌ {error_msg}")
-                return {"error": error_msg}
+                return {"error": error_msg, "error_code": "slicer_crash"}
             
             # Parse G-code for printing information
             slicing_data = self.parse_gcode(gcode_path, material, layer_height, infill)
             print(f"✅ Slicing completed - {slicing_data.get('print_time', 'Unknown')} estimated")
-            shutil.os.remove(gcode_path)  # Clean up gcode file
+            # Kept for the worker to upload; it cleans up temp/ after each job
+            slicing_data["gcode_path"] = gcode_path
             
             # Clean up temporary config file
             if os.path.exists(config_file):
@@ -344,7 +413,7 @@ class QuotationEngine:
             if os.path.exists(config_file):
                 os.remove(config_file)
             
-            return {"error": error_msg}
+            return {"error": error_msg, "error_code": "slicer_crash"}
     
     def parse_gcode(self, gcode_path: str, material: str, layer_height: float, infill: int) -> Dict:
         """Extract detailed information from generated G-code (reads last 500 lines for efficiency)"""
@@ -382,6 +451,17 @@ class QuotationEngine:
                     data["print_time_seconds"] = self.parse_time_to_seconds(time_str)
                     data["print_time_hours"] = round(data["print_time_seconds"] / 3600, 2)
                 
+                # Filament used, summed over extruders; the API derives
+                # whatever is missing from the material's density
+                filament = {}
+                for unit, key, scale in (("mm", "meters", 0.001), ("cm3", "cm3", 1), ("g", "grams", 1)):
+                    used_match = re.search(rf'; filament used \[{unit}\] = ([\d., ]+)', content)
+                    if used_match:
+                        amounts = [float(a) for a in used_match.group(1).split(",") if a.strip()]
+                        filament[key] = round(sum(amounts) * scale, 3)
+                if filament:
+                    data["filament"] = filament
+
                 # # Extract filament usage
                 # filament_match = re.search(r'; filament used \[mm\] = ([\d.]+)', content)
                 # if filament_match:
@@ -471,6 +551,10 @@ class QuotationEngine:
         Then apply custom rounding rules
         """
         pricing = self.config["pricing"]
+        version = "v1"
+        if "pricing_v2" in self.features:
+            pricing = {**pricing, **self.config.get("pricing_v2", {})}
+            version = "v2"
         
         # Complexity multipliers
         complexity_multipliers = {
@@ -507,6 +591,7 @@ class QuotationEngine:
         rounded_price = self.round_price(final_cost)
         
         return {
+            "pricing_version": version,
             "print_time_hours": round(time_hours, 2),
             "base_rate_per_hour": pricing["base_rate_per_hour"],
             "base_cost": round(base_cost, 2),
@@ -525,7 +610,8 @@ class QuotationEngine:
     
     def generate_quotation(self, input_file: str, material: str = "PLA", 
                           layer_height: float = 0.2, infill: int = 15,
-                          rush_order: bool = False, job_id: str = None) -> Dict:
+                          rush_order: bool = False, job_id: str = None,
+                          bed_adhesion: str = "skirt", nozzle: float = 0.4) -> Dict:
         """
         Generate complete quotation with STEP conversion, mesh validation, orientation, slicing, and pricing
         Main entry point for the quotation engine
@@ -551,6 +637,7 @@ class QuotationEngine:
             return {
                 "success": False,
                 "error": validation_msg,
+                "error_code": "unsupported_format",
                 "job_id": job_id,
                 "timestamp": datetime.now().isoformat()
             }
@@ -563,6 +650,7 @@ class QuotationEngine:
                 return {
                     "success": False,
                     "error": convert_msg,
+                    "error_code": "unsupported_format",
                     "job_id": job_id,
                     "timestamp": datetime.now().isoformat()
                 }
@@ -577,6 +665,7 @@ class QuotationEngine:
             return {
                 "success": False,
                 "error": f"Mesh validation failed: {mesh_msg}",
+                "error_code": "geometry_error",
                 "job_id": job_id,
                 "timestamp": datetime.now().isoformat()
             }
@@ -587,6 +676,7 @@ class QuotationEngine:
             return {
                 "success": False,
                 "error": f"Orientation failed: {orient_msg}",
+                "error_code": "geometry_error",
                 "job_id": job_id,
                 "timestamp": datetime.now().isoformat()
             }
@@ -597,17 +687,22 @@ class QuotationEngine:
         final_stl = self.center_and_ground_model(oriented_stl)
         
         # Step 4: Slice model
-        slicing_data = self.slice_model(final_stl, job_id, material, layer_height, infill)
+        if self.on_stage:
+            self.on_stage("slicing")
+        slicing_data = self.slice_model(final_stl, job_id, material, layer_height, infill, bed_adhesion, nozzle)
         
         if slicing_data.get("error") is not None:
             return {
                 "success": False,
                 "error": slicing_data.get("error", "Slicing failed"),
+                "error_code": slicing_data.get("error_code", "slicer_crash"),
                 "job_id": job_id,
                 "timestamp": datetime.now().isoformat()
             }
         
         # Step 5: Calculate pricing
+        if self.on_stage:
+            self.on_stage("pricing")
         pricing_data = self.calculate_pricing(slicing_data, complexity, material, rush_order)
         
         quotation = {
@@ -643,11 +738,19 @@ class QuotationEngine:
                 "material": material,
                 "layer_height": layer_height,
                 "infill_percentage": infill,
+                "bed_adhesion": bed_adhesion,
+                "nozzle": nozzle,
                 "print_time": slicing_data.get("print_time", "Unknown"),
                 "complexity": complexity,
                 "total_cost": pricing_data["total"],
                 "Expedite": rush_order
-            }
+            },
+
+            # Measured filament use, normalized by the API
+            "filament": slicing_data.get("filament"),
+
+            # Local path of the sliced file, not part of the stored result
+            "gcode_path": slicing_data.get("gcode_path")
         }
         
         
@@ -1,4 +1,8 @@
+import base64
 import glob
+import gzip
+import hashlib
+import hmac
 import redis
 import json
 import os
@@ -7,9 +11,280 @@ import httpx
 import threading
 from http.server import HTTPServer, BaseHTTPRequestHandler
 import uuid
+from datetime import datetime
 
 from quotation_engine import QuotationEngine
 
+# Job lists in pop order, rush first. With USE_STREAMS=true the worker reads
+# the "<list>:stream" counterparts through the "workers" consumer group and
+# XACKs each entry only once its result is stored, so a crash leaves the job
+# pending (visible in GET /admin/stuck-jobs) instead of losing it.
+#
+# In list mode jobs are moved atomically into PROCESSING_QUEUE and the claim
+# time recorded in CLAIMED_AT; the API requeues entries that outlive its
+# VISIBILITY_TIMEOUT_SECONDS, so a restarted worker doesn't strand its job.
+#
+# JOB_QUEUE picks the list this worker serves, matching the API's QUEUE_MAP
+# (e.g. JOB_QUEUE=print_jobs_flex on the TPU machine). WORKER_REGION (us, eu
+# or ap) serves that region's list instead, for an API running with
+# REGION_ROUTING_ENABLED.
+JOB_QUEUE = os.getenv("JOB_QUEUE", "print_jobs")
+WORKER_REGION = os.getenv("WORKER_REGION", "")
+if WORKER_REGION:
+    JOB_QUEUE = f"{JOB_QUEUE}:{WORKER_REGION}"
+JOB_QUEUES = [f"{JOB_QUEUE}:rush", JOB_QUEUE]
+PROCESSING_QUEUE = "print_jobs:processing"
+CLAIMED_AT = "print_jobs:processing:claimed"
+USE_STREAMS = os.getenv("USE_STREAMS", "false").lower() == "true"
+CONSUMER_GROUP = "workers"
+CONSUMER_NAME = os.getenv("WORKER_ID", str(uuid.uuid4()))
+
+# Transient failures (the file host timing out, a flaky network) are handed
+# back to the API on RETRY_QUEUE, which requeues them with backoff up to the
+# job's max_retries. Anything else is permanent and marked failed right away.
+RETRY_QUEUE = "print_jobs:retry"
+
+# Claimed jobs go into DEADLINES scored by when they must be finished; the
+# API fails anything still processing past that with reason "timeout".
+DEADLINES = "print_jobs:deadlines"
+DEFAULT_DEADLINE_SECONDS = 3600
+
+class TransientJobError(Exception):
+    pass
+
+class JobAborted(Exception):
+    pass
+
+# A failure with one of the API's error codes (download_failed,
+# unsupported_format, geometry_error, slicer_crash, timeout, cancelled);
+# anything else is reported without one and shown as internal_error.
+class JobFailed(Exception):
+    def __init__(self, message, error_code):
+        super().__init__(message)
+        self.error_code = error_code
+
+# POST /jobs/:id/abort and DELETE /jobs/:id?force=true set abort:{id}; a
+# forced cancel is also published on cancel:{id}. The watcher listens on the
+# channel and checks the key while a job is processing, and stops the
+# slicer.
+ABORT_POLL_INTERVAL = 2
+
+def watch_abort(r, job_id, engine, aborted, done):
+    pubsub = r.pubsub(ignore_subscribe_messages=True)
+    try:
+        pubsub.subscribe(f"cancel:{job_id}")
+        while not done.is_set():
+            try:
+                if pubsub.get_message(timeout=ABORT_POLL_INTERVAL) or r.exists(f"abort:{job_id}"):
+                    aborted.set()
+                    engine.abort()
+                    return
+            except Exception as e:
+                print(f"Abort check for {job_id} failed: {e}")
+                done.wait(ABORT_POLL_INTERVAL)
+    finally:
+        pubsub.close()
+
+def check_abort(aborted):
+    if aborted.is_set():
+        raise JobAborted()
+
+# With INTERNAL_API_URL and INTERNAL_SECRET set, status updates go through the
+# API's signed POST /internal/jobs/:id/status instead of writing Redis keys.
+INTERNAL_API_URL = os.getenv("INTERNAL_API_URL")
+INTERNAL_SECRET = os.getenv("INTERNAL_SECRET")
+
+def post_signed(path, payload):
+    body = json.dumps(payload).encode()
+    signature = hmac.new(INTERNAL_SECRET.encode(), body, hashlib.sha256).hexdigest()
+    resp = httpx.post(
+        f"{INTERNAL_API_URL.rstrip('/')}{path}",
+        content=body,
+        headers={"Content-Type": "application/json", "X-Internal-Signature": signature},
+        timeout=10.0,
+    )
+    resp.raise_for_status()
+
+# How long finished jobs are kept; must match RESULT_TTL_COMPLETED_HOURS and
+# RESULT_TTL_FAILED_HOURS of the API, which applies them itself to updates
+# sent through /internal
+RESULT_TTL_COMPLETED = int(os.getenv("RESULT_TTL_COMPLETED_HOURS", "24")) * 3600
+RESULT_TTL_FAILED = int(os.getenv("RESULT_TTL_FAILED_HOURS", "24")) * 3600
+
+def report_status(r, job_id, status, result=None):
+    if INTERNAL_API_URL and INTERNAL_SECRET:
+        post_signed(f"/internal/jobs/{job_id}/status", {"status": status, "result": result} if result is not None else {"status": status})
+        return
+
+    # Mirror the API's rules for forced cancels (applyWorkerStatus in
+    # go-api/internal.go): stopping confirms one, a result that got there
+    # first stands, and a cancelled job stays cancelled
+    current = r.get(f"status:{job_id}")
+    if current == b"cancelled":
+        return
+    if current == b"cancelling":
+        if status == "aborted":
+            status = "cancelled"
+        elif status == "processing":
+            return
+
+    ttl = 86400
+    if status == "completed":
+        ttl = RESULT_TTL_COMPLETED
+    elif status in ("failed", "aborted", "cancelled"):
+        ttl = RESULT_TTL_FAILED
+    if result is not None:
+        r.set(f"result:{job_id}", json.dumps(result), ex=ttl)
+    r.set(f"status:{job_id}", status, ex=ttl)
+    if status == "processing":
+        r.delete(f"progress:{job_id}")
+    else:
+        r.expire(f"progress:{job_id}", PROGRESS_LINGER)
+    if status in ("aborted", "cancelled") or current == b"cancelling":
+        r.delete(f"abort:{job_id}")
+    if status in ("completed", "failed", "aborted", "cancelled"):
+        r.set(f"completed_at:{job_id}", time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime()), ex=ttl)
+        for key in (f"params:{job_id}", f"history:{job_id}", f"started_at:{job_id}", f"created_at:{job_id}"):
+            r.expire(key, ttl)
+    if status == "aborted":
+        r.set(f"aborted_at:{job_id}", time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime()), ex=ttl)
+
+    # Feed the rolling average behind the queue ETA in /status (the API does
+    # this itself for updates sent through /internal)
+    started_at = r.get(f"started_at:{job_id}")
+    if status == "completed" and started_at:
+        r.lpush("stats:slice_durations", int(time.time()) - int(started_at))
+        r.ltrim("stats:slice_durations", 0, 49)
+
+# Steps a job goes through while processing, with the progress_percent each
+# starts at. Must match jobSteps in go-api/progress.go, which rejects others.
+STEP_PROGRESS = {
+    "downloading": 0,
+    "parsing": 10,
+    "slicing": 25,
+    "pricing": 80,
+    "post_processing": 85,
+    "uploading_result": 95,
+}
+
+# progress:{job_id} is kept this long after the job finishes (progressLinger)
+PROGRESS_LINGER = 300
+
+def report_step(r, job_id, step, progress=None):
+    if progress is None:
+        progress = STEP_PROGRESS[step]
+    try:
+        if INTERNAL_API_URL and INTERNAL_SECRET:
+            post_signed(f"/internal/jobs/{job_id}/status", {"status": "processing", "step": step, "progress_percent": progress})
+            return
+        # Same shape the API stores, see jobProgress in go-api/progress.go
+        blob = {"stage": step, "percent": progress, "updated_at": int(time.time())}
+        r.set(f"progress:{job_id}", json.dumps(blob), ex=86400)
+    except Exception as e:
+        # Progress is informational; never fail the job over it
+        print(f"Progress report for {job_id} failed: {e}")
+
+# Slicer output goes to logs:{job_id} for GET /jobs/:id/logs. The stream
+# outlives the job's 24h keys by an hour.
+LOG_STREAM_TTL = 86400 + 3600
+LOG_STREAM_MAXLEN = 10000
+
+def log_sink(r, job_id):
+    key = f"logs:{job_id}"
+    def sink(line):
+        try:
+            pipe = r.pipeline()
+            pipe.xadd(key, {"line": line}, maxlen=LOG_STREAM_MAXLEN, approximate=True)
+            pipe.expire(key, LOG_STREAM_TTL)
+            pipe.execute()
+        except Exception as e:
+            print(f"Log push for {job_id} failed: {e}")
+    return sink
+
+# Workers register what they can slice so the API only routes them jobs they
+# can handle. Empty lists mean "anything". Needs INTERNAL_API_URL/SECRET.
+WORKER_MATERIALS = [m for m in os.getenv("WORKER_MATERIALS", "").split(",") if m]
+WORKER_NOZZLES = [float(n) for n in os.getenv("WORKER_NOZZLES", "").split(",") if n]
+HEARTBEAT_INTERVAL = int(os.getenv("HEARTBEAT_INTERVAL", "30"))
+
+# Every worker also writes worker:heartbeat:{id} (expiring after three missed
+# beats) so the API can tell users when no worker is online, and its time in
+# workers:active so the API can tell when it went silent; see
+# go-api/heartbeat.go and go-api/workersweep.go.
+def write_heartbeat(r):
+    now = int(time.time())
+    pipe = r.pipeline()
+    pipe.set(f"worker:heartbeat:{CONSUMER_NAME}", now, ex=HEARTBEAT_INTERVAL * 3)
+    pipe.sadd("workers:heartbeat", CONSUMER_NAME)
+    pipe.set("workers:last_heartbeat", now)
+    pipe.zadd("workers:active", {CONSUMER_NAME: now})
+    pipe.zrem("workers:stale", CONSUMER_NAME)
+    pipe.zrem("workers:dead", CONSUMER_NAME)
+    pipe.execute()
+
+def heartbeat_loop(r):
+    while True:
+        try:
+            write_heartbeat(r)
+        except Exception as e:
+            print(f"Heartbeat failed: {e}")
+        if INTERNAL_API_URL and INTERNAL_SECRET:
+            try:
+                post_signed("/workers/register", {
+                    "id": CONSUMER_NAME,
+                    "queue": JOB_QUEUE,
+                    "materials": WORKER_MATERIALS,
+                    "nozzles": WORKER_NOZZLES,
+                    "heartbeat_interval": HEARTBEAT_INTERVAL,
+                })
+            except Exception as e:
+                print(f"Worker registration failed: {e}")
+        time.sleep(HEARTBEAT_INTERVAL)
+
+# The API gzips large payloads and marks them with a leading 0x01 byte;
+# plain payloads are JSON and start with "{".
+GZIP_PAYLOAD_PREFIX = b"\x01"
+
+# Highest payload "schema_version" this worker understands; the API bumps it
+# in go-api/payload.go whenever the payload shape changes.
+SCHEMA_VERSION = 3
+
+def decode_payload(job_json):
+    if job_json[:1] == GZIP_PAYLOAD_PREFIX:
+        return json.loads(gzip.decompress(job_json[1:]))
+    return json.loads(job_json)
+
+def next_job(r):
+    """Blocks until a job is available. Returns (job_json, ack) where ack()
+    acknowledges the stream entry (a no-op for the legacy lists)."""
+    if not USE_STREAMS:
+        while True:
+            # Rush list first so rush orders jump the line
+            job_json = r.lmove(JOB_QUEUES[0], PROCESSING_QUEUE, "LEFT", "RIGHT")
+            if job_json is None:
+                job_json = r.blmove(JOB_QUEUES[1], PROCESSING_QUEUE, 1, "LEFT", "RIGHT")
+            if job_json is None:
+                continue
+            job_id = decode_payload(job_json)["id"]
+            r.hset(CLAIMED_AT, job_id, int(time.time()))
+            # So the API can hand it back should this worker die
+            r.sadd(f"worker_jobs:{CONSUMER_NAME}", job_id)
+
+            def ack(job_json=job_json, job_id=job_id):
+                r.lrem(PROCESSING_QUEUE, 1, job_json)
+                r.hdel(CLAIMED_AT, job_id)
+                r.srem(f"worker_jobs:{CONSUMER_NAME}", job_id)
+            return job_json, ack
+
+    while True:
+        # Check streams one at a time so rush entries are always served first
+        for queue in JOB_QUEUES:
+            stream = f"{queue}:stream"
+            entries = r.xreadgroup(CONSUMER_GROUP, CONSUMER_NAME, {stream: ">"}, count=1, block=1000)
+            if entries:
+                entry_id, fields = entries[0][1][0]
+                return fields[b"payload"], lambda: r.xack(stream, CONSUMER_GROUP, entry_id)
+
 def download_file(url):
     try:
         path = url.split('?')[0]
@@ -27,6 +302,68 @@ def download_file(url):
         print(f"Download failed: {e}")
         return None
 
+# Sliced G-code goes to tmpfiles.org, like the API's uploads; the API serves
+# it from there at GET /jobs/:id/gcode once the quote is accepted
+GCODE_UPLOAD_URL = os.getenv("GCODE_UPLOAD_URL", "https://tmpfiles.org/api/v1/upload")
+
+def upload_gcode(path, job_id):
+    """Returns the G-code's download URL, or None if there is none or it
+    couldn't be stored; the quote stands either way."""
+    if not path or not os.path.exists(path):
+        return None
+    try:
+        with open(path, "rb") as f:
+            resp = httpx.post(GCODE_UPLOAD_URL, files={"file": (f"{job_id}.gcode", f)}, timeout=120.0)
+        resp.raise_for_status()
+        data = resp.json()
+        if data.get("status") != "success":
+            raise ValueError(f"storage answered {data}")
+        # Viewer URL to download URL, as go-api/storage.go does
+        return data["data"]["url"].replace("tmpfiles.org/", "tmpfiles.org/dl/", 1)
+    except Exception as e:
+        print(f"G-code upload failed: {e}")
+        return None
+
+# Matches THUMBNAIL_MAX_BYTES on the API, which refuses larger thumbnails
+THUMBNAIL_MAX_BYTES = int(os.getenv("THUMBNAIL_MAX_BYTES", str(256 << 10)))
+
+def extract_thumbnail(gcode_path):
+    """The base64 PNG PrusaSlicer puts at the top of the G-code (the
+    thumbnails setting in cfg.ini), or None if there is none."""
+    if not gcode_path or not os.path.exists(gcode_path):
+        return None
+    chunks, inside = [], False
+    with open(gcode_path, "r", encoding="utf-8", errors="replace") as f:
+        for line in f:
+            line = line.strip()
+            if line.startswith("; thumbnail begin"):
+                chunks, inside = [], True
+            elif line.startswith("; thumbnail end"):
+                return "".join(chunks)
+            elif inside:
+                chunks.append(line.lstrip("; "))
+            elif line and not line.startswith(";"):
+                # Thumbnails come before the first command
+                return None
+    return None
+
+def store_thumbnail(r, job_id, png_base64):
+    """Keeps the thumbnail in result:{id}:thumb, which GET /jobs/:id/thumbnail
+    serves. Failing to is logged and otherwise ignored."""
+    if not png_base64:
+        return
+    try:
+        if INTERNAL_API_URL and INTERNAL_SECRET:
+            post_signed(f"/internal/jobs/{job_id}/thumbnail", {"png_base64": png_base64})
+            return
+        png = base64.b64decode(png_base64)
+        if len(png) > THUMBNAIL_MAX_BYTES or not png.startswith(b"\x89PNG\r\n\x1a\n"):
+            print(f"Thumbnail of {job_id} is not a PNG of at most {THUMBNAIL_MAX_BYTES} bytes; leaving it out")
+            return
+        r.set(f"result:{job_id}:thumb", png, ex=86400)
+    except Exception as e:
+        print(f"Thumbnail not stored: {e}")
+
 def start_health_check_server():
     """
     Starts a dummy HTTP server on port 7860 to satisfy Hugging Face's health check.
@@ -67,51 +404,97 @@ def main():
             print("Retrying in 5 seconds...")
             time.sleep(5) # Wait before retrying to avoid log spam
 
+    threading.Thread(target=heartbeat_loop, args=(r,), daemon=True).start()
+
     # 3. Initialize Engine
     engine = QuotationEngine()
     print("Worker started. Waiting for jobs...")
 
     while True:
         try:
-            # Blocking pop
-            _, job_json = r.blpop("print_jobs")
-            job = json.loads(job_json)
+            job_json, ack = next_job(r)
+            job = decode_payload(job_json)
             job_id = job['id']
             print(f"Processing Job {job_id}...")
+            if job.get("schema_version", 0) > SCHEMA_VERSION:
+                print(f"Job {job_id} has payload schema_version {job['schema_version']}, newer than {SCHEMA_VERSION}; update this worker")
+            if job.get("created_at"):
+                waited = time.time() - datetime.fromisoformat(job["created_at"].replace("Z", "+00:00")).timestamp()
+                print(f"Job {job_id} waited {waited:.0f}s in the queue")
 
-            r.set(f"status:{job_id}", "processing", ex=86400)
+            report_status(r, job_id, "processing")
+            started_at = int(time.time())
+            r.set(f"started_at:{job_id}", started_at, ex=86400)
+            r.zadd(DEADLINES, {job_id: started_at + int(job.get("deadline_seconds", DEFAULT_DEADLINE_SECONDS))})
             
             file_path = None
+            aborted, done = threading.Event(), threading.Event()
+            threading.Thread(target=watch_abort, args=(r, job_id, engine, aborted, done), daemon=True).start()
             try:
                 # Download
+                report_step(r, job_id, "downloading")
                 file_path = download_file(job['download_url'])
                 if not file_path:
-                    raise Exception("Failed to download file")
+                    raise TransientJobError("Failed to download file")
+                check_abort(aborted)
 
                 # Slice
+                report_step(r, job_id, "parsing")
+                engine.log_sink = log_sink(r, job_id)
+                engine.on_stage = lambda stage: report_step(r, job_id, stage)
+                engine.features = set(job.get("features", []))
                 result = engine.generate_quotation(
                     input_file=file_path,
                     material=job['material'],
                     layer_height=float(job.get('layer_height', 0.2)),
                     infill=int(job.get('infill', 15)),
                     rush_order=job.get('rush', False),
-                    job_id=job_id
+                    job_id=job_id,
+                    bed_adhesion=job.get('bed_adhesion', 'skirt'),
+                    nozzle=float(job.get('nozzle') or 0.4)
                 )
+                check_abort(aborted)
 
+                report_step(r, job_id, "post_processing")
                 if not result or not result.get("success"):
-                     raise Exception(result.get("error", "Generation failed"))
+                     result = result or {}
+                     raise JobFailed(result.get("error", "Generation failed"), result.get("error_code", "internal_error"))
 
-                r.set(f"result:{job_id}", json.dumps(result), ex=86400)
-                r.set(f"status:{job_id}", "completed", ex=86400)
+                report_step(r, job_id, "uploading_result")
+                gcode_path = result.pop("gcode_path", None)
+                store_thumbnail(r, job_id, extract_thumbnail(gcode_path))
+                gcode_url = upload_gcode(gcode_path, job_id)
+                if gcode_url:
+                    result["gcode_url"] = gcode_url
+                report_status(r, job_id, "completed", result)
+                # The API caches results itself when they go through /internal
+                if job.get("cache_key") and not (INTERNAL_API_URL and INTERNAL_SECRET):
+                    r.set(f"slice_cache:{job['cache_key']}", json.dumps(result), ex=int(job.get("cache_ttl_seconds", 86400)))
                 print(f"✅ Job {job_id} completed!")
 
+            except JobAborted:
+                print(f"🛑 Job {job_id} aborted on request")
+                report_status(r, job_id, "aborted")
+
+            except TransientJobError as e:
+                print(f"🔁 Job {job_id} hit a transient error, handing back for retry: {e}")
+                r.rpush(RETRY_QUEUE, json.dumps({"job": job, "error": str(e)}))
+
+            except JobFailed as e:
+                print(f"❌ Job {job_id} failed ({e.error_code}): {e}")
+                report_status(r, job_id, "failed", {"success": False, "error": str(e), "error_code": e.error_code})
+
             except Exception as e:
                 print(f"❌ Job {job_id} failed: {e}")
-                error_data = {"success": False, "error": str(e)}
-                r.set(f"result:{job_id}", json.dumps(error_data), ex=86400)
-                r.set(f"status:{job_id}", "failed", ex=86400)
+                error_data = {"success": False, "error": str(e), "error_code": "internal_error"}
+                report_status(r, job_id, "failed", error_data)
 
             finally:
+                done.set()
+                engine.log_sink = None
+                r.zrem(DEADLINES, job_id)
+                ack()
+
                 # Cleanup
                 if file_path and os.path.exists(file_path):
                     try: